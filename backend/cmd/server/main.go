@@ -8,8 +8,10 @@ package main
 // @name Authorization
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	_ "smart-city-surveillance/docs"
 	"smart-city-surveillance/internal/config"
@@ -18,6 +20,13 @@ import (
 	"smart-city-surveillance/internal/middleware"
 	"smart-city-surveillance/internal/models"
 	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/cache"
+	"smart-city-surveillance/pkg/capture"
+	"smart-city-surveillance/pkg/mail"
+	"smart-city-surveillance/pkg/notify"
+	"smart-city-surveillance/pkg/onvif"
+	"smart-city-surveillance/pkg/recording"
+	"smart-city-surveillance/pkg/storage"
 	"smart-city-surveillance/pkg/websocket"
 
 	"github.com/gin-contrib/cors"
@@ -56,16 +65,133 @@ func main() {
 	}
 
 	// Initialize WebSocket hub
-	wsHub := websocket.NewHub()
-	go wsHub.Run()
+	var (
+		backplane websocket.Backplane
+		outbox    websocket.Outbox
+	)
+	outboxRetention := time.Duration(cfg.Realtime.OutboxRetentionHours) * time.Hour
+	switch cfg.Realtime.Backplane {
+	case websocket.BackplaneRedis:
+		redisAddr := cfg.Redis.Host + ":" + cfg.Redis.Port
+		redisBackplane, err := websocket.NewRedisBackplane(redisAddr, cfg.Redis.Password, cfg.Redis.DB)
+		if err != nil {
+			log.Fatalf("Failed to connect websocket backplane: %v", err)
+		}
+		defer redisBackplane.Close()
+		redisOutbox, err := websocket.NewRedisOutbox(redisAddr, cfg.Redis.Password, cfg.Redis.DB, cfg.Realtime.OutboxSize, outboxRetention)
+		if err != nil {
+			log.Fatalf("Failed to connect websocket outbox: %v", err)
+		}
+		defer redisOutbox.Close()
+		backplane, outbox = redisBackplane, redisOutbox
+	default:
+		backplane = websocket.NewMemoryBackplane()
+		outbox = websocket.NewMemoryOutbox(cfg.Realtime.OutboxSize, outboxRetention)
+	}
+	wsHub := websocket.NewHub(backplane, outbox, websocket.DeliveryOptions{
+		AckTimeout:  time.Duration(cfg.Realtime.AckTimeoutSeconds) * time.Second,
+		MaxAttempts: cfg.Realtime.MaxDeliveryAttempts,
+	})
+	wsHub.SetTopicAuthorizer(services.NewTopicAuthorizer(database.GetDB()))
+	wsHub.SetDefaultTopics(string(models.RoleSCSOperator), services.DefaultOperatorTopics...)
+
+	// Notification preferences, which also filter the realtime feed
+	preferencesService := services.NewPreferencesService(database.GetDB())
+	wsHub.SetMessageFilter(preferencesService)
+	preferenceHandler := handlers.NewPreferenceHandler(preferencesService)
+
+	// Notifications by email, SMS and push
+	mailSender := mail.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+	notifyProviders := map[models.NotificationChannel]notify.Provider{
+		models.NotificationChannelEmail: notify.NewFake("email"),
+		models.NotificationChannelSMS:   notify.NewFake("sms"),
+		models.NotificationChannelPush:  notify.NewFake("push"),
+	}
+	if cfg.Notify.EmailProvider == notify.ProviderSMTP {
+		notifyProviders[models.NotificationChannelEmail] = notify.NewEmail(mailSender)
+	}
+	if cfg.Notify.SMSProvider == notify.ProviderHTTP {
+		notifyProviders[models.NotificationChannelSMS] = notify.NewSMSGateway(cfg.Notify.SMSGatewayURL, cfg.Notify.SMSAPIKey, cfg.Notify.SMSFrom)
+	}
+	if cfg.Notify.PushProvider == notify.ProviderHTTP {
+		notifyProviders[models.NotificationChannelPush] = notify.NewPush(notify.PushConfig{
+			FCMURL:    cfg.Notify.FCMURL,
+			FCMToken:  cfg.Notify.FCMToken,
+			APNsURL:   cfg.Notify.APNsURL,
+			APNsToken: cfg.Notify.APNsToken,
+			APNsTopic: cfg.Notify.APNsTopic,
+		})
+	}
+	notificationsService := services.NewNotificationsService(database.GetDB(), preferencesService, notifyProviders, services.NotificationOptions{
+		MaxAttempts: cfg.Notify.MaxAttempts,
+		RetryBase:   time.Duration(cfg.Notify.RetryBaseSeconds) * time.Second,
+	})
+	notificationHandler := handlers.NewNotificationHandler(notificationsService)
+
+	// Tell operators when a guard never received a message that needed an ack
+	wsHub.OnUndelivered(func(entry websocket.OutboxEntry) {
+		wsHub.BroadcastToRole(string(models.RoleSCSOperator), "delivery_failed", map[string]any{
+			"user_id": entry.UserID,
+			"seq":     entry.Seq,
+			"message": entry.Data,
+			"sent_at": entry.CreatedAt,
+		})
+		notificationsService.NotifyUndelivered(context.Background(), entry)
+	})
+
+	// Media storage & snapshot capture
+	mediaStore, err := storage.NewLocal(cfg.Media.Root, cfg.Media.PublicURL, cfg.Media.SigningKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+	captureBackend, err := capture.New(cfg.Capture.Backend, cfg.Capture.FFmpegPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize capture backend: %v", err)
+	}
+	snapshotService := services.NewSnapshotService(database.GetDB(), wsHub, captureBackend, mediaStore, cfg)
+	mediaHandler := handlers.NewMediaHandler(mediaStore)
 
 	// Initialize handlers
 	//premises
 	premisesService := services.NewPremisesService(database.GetDB())
 	premiseHandler := handlers.NewPremiseHandler(premisesService)
 
-	camerasService := services.NewCameraService(database.GetDB())
-	cameraHandler := handlers.NewCameraHandler(camerasService)
+	// Audit
+	auditService := services.NewAuditService(database.GetDB())
+	auditHandler := handlers.NewAuditHandler(auditService)
+
+	// Maintenance windows, which suppress alerts during planned work
+	maintenanceService := services.NewMaintenanceService(database.GetDB(), auditService, services.MaintenanceOptions{
+		CameraAutoWindow: cfg.Maintenance.CameraAutoWindow,
+		CameraWindow:     time.Duration(cfg.Maintenance.CameraWindowMinutes) * time.Minute,
+	})
+	maintenanceHandler := handlers.NewMaintenanceHandler(maintenanceService)
+
+	// Arming schedules and the policy for alerts from disarmed areas
+	armingService := services.NewArmingService(database.GetDB(), wsHub, auditService)
+	armingHandler := handlers.NewArmingHandler(armingService)
+
+	camerasService := services.NewCameraService(database.GetDB(), wsHub, maintenanceService)
+	cameraHandler := handlers.NewCameraHandler(camerasService, snapshotService)
+
+	// Outbound webhooks, fed by every event published to the hub
+	webhooksService := services.NewWebhooksService(database.GetDB(), auditService, services.WebhookOptions{
+		MaxAttempts:         cfg.Webhook.MaxAttempts,
+		RetryBase:           time.Duration(cfg.Webhook.RetryBaseSeconds) * time.Second,
+		Timeout:             time.Duration(cfg.Webhook.TimeoutSeconds) * time.Second,
+		DisableAfter:        cfg.Webhook.DisableAfterFailures,
+		AllowPrivateTargets: cfg.Webhook.AllowPrivateTargets,
+	})
+	wsHub.OnPublish(webhooksService.Publish)
+	webhookHandler := handlers.NewWebhookHandler(webhooksService)
+
+	// PTZ control
+	onvifClients, err := onvif.NewFactory(cfg.PTZ.ONVIFMode)
+	if err != nil {
+		log.Fatalf("Failed to initialize ONVIF client: %v", err)
+	}
+	ptzService := services.NewPTZService(database.GetDB(), wsHub, auditService, onvifClients, time.Duration(cfg.PTZ.LockTTLSeconds)*time.Second)
+	ptzHandler := handlers.NewPTZHandler(ptzService)
 
 		// Users
 	userService := services.NewUserService(database.GetDB())
@@ -76,15 +202,113 @@ func main() {
 	authHandler := handlers.NewAuthHandler(cfg, authService)
 
 	// Alerts
-	alertsService := services.NewAlertsService(database.GetDB(), wsHub)
+	alertsService := services.NewAlertsService(database.GetDB(), wsHub, snapshotService, notificationsService, maintenanceService, armingService, auditService)
 	alertHandler := handlers.NewAlertHandler(alertsService)
 
 	// Incidents
-	incidentsService := services.NewIncidentsService(database.GetDB(), wsHub)
+	incidentsService := services.NewIncidentsService(database.GetDB(), wsHub, auditService)
 	incidentHandler := handlers.NewIncidentHandler(incidentsService)
 
-	// Setup Gin router
-	router := gin.Default()
+	// Incident chat
+	incidentMessagesService := services.NewIncidentMessagesService(database.GetDB(), wsHub, mediaStore, time.Duration(cfg.Media.URLTTL)*time.Minute)
+	incidentMessageHandler := handlers.NewIncidentMessageHandler(incidentMessagesService)
+
+	// Post-incident reports
+	incidentReportsService := services.NewIncidentReportsService(database.GetDB(), mediaStore, time.Duration(cfg.Media.URLTTL)*time.Minute, auditService)
+	incidentReportHandler := handlers.NewIncidentReportHandler(incidentReportsService)
+
+	// Floor plans
+	floorPlansService := services.NewFloorPlansService(database.GetDB(), mediaStore, time.Duration(cfg.Media.URLTTL)*time.Minute)
+	floorPlanHandler := handlers.NewFloorPlanHandler(floorPlansService)
+
+	// Map
+	mapService := services.NewMapService(database.GetDB(), wsHub)
+	mapHandler := handlers.NewMapHandler(mapService)
+
+	// Guard safety: SOS and lone-worker check-ins
+	safetyService := services.NewSafetyService(database.GetDB(), wsHub, alertsService, mapService, notificationsService, auditService, services.SafetyOptions{
+		Grace:       time.Duration(cfg.Safety.CheckInGraceSeconds) * time.Second,
+		MinInterval: time.Duration(cfg.Safety.MinCheckInMinutes) * time.Minute,
+		MaxInterval: time.Duration(cfg.Safety.MaxCheckInMinutes) * time.Minute,
+	})
+	safetyHandler := handlers.NewSafetyHandler(safetyService)
+
+	// Patrols
+	patrolsService := services.NewPatrolsService(database.GetDB(), wsHub, alertsService, mapService, auditService, time.Duration(cfg.Patrol.MissedGraceMinutes)*time.Minute)
+	patrolHandler := handlers.NewPatrolHandler(patrolsService)
+
+	// SOP checklists
+	sopService := services.NewSOPService(database.GetDB(), wsHub, mediaStore, auditService, time.Duration(cfg.Media.URLTTL)*time.Minute)
+	sopHandler := handlers.NewSOPHandler(sopService)
+
+	// Full-text search
+	searchService := services.NewSearchService(database.GetDB())
+	searchHandler := handlers.NewSearchHandler(searchService)
+
+	// Analytics, cached so dashboards can poll
+	var analyticsCache cache.Cache
+	switch cfg.Analytics.Cache {
+	case cache.BackendRedis:
+		redisCache, err := cache.NewRedis(cfg.Redis.Host+":"+cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB, "scs:")
+		if err != nil {
+			log.Fatalf("Failed to connect analytics cache: %v", err)
+		}
+		defer redisCache.Close()
+		analyticsCache = redisCache
+	default:
+		analyticsCache = cache.NewMemory()
+	}
+	analyticsService := services.NewAnalyticsService(database.GetDB(), analyticsCache, time.Duration(cfg.Analytics.CacheTTLSeconds)*time.Second)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
+
+	// Scheduled reports, archived in media storage and emailed
+	reportsService := services.NewReportsService(database.GetDB(), mediaStore, analyticsService, mailSender, auditService)
+	reportHandler := handlers.NewReportHandler(reportsService)
+
+	// Websocket commands use the same services as the REST handlers
+	wsHub.SetCommandHandler(handlers.NewWSCommandRouter(alertsService, incidentsService, incidentMessagesService, safetyService, patrolsService))
+
+	// Server-Sent Events fallback for the realtime feed
+	eventsHandler := handlers.NewEventsHandler(wsHub)
+
+	// Presence
+	presenceService := services.NewPresenceService(database.GetDB(), wsHub, auditService)
+	presenceHandler := handlers.NewPresenceHandler(presenceService)
+
+	// Recordings
+	var recordingAdapter recording.Adapter
+	var recorder recording.Recorder
+	switch cfg.Recording.Adapter {
+	case recording.AdapterNVR:
+		recordingAdapter = recording.NewNVR(cfg.Recording.NVRBaseURL, cfg.Recording.NVRToken)
+	default:
+		local, err := recording.NewLocal(cfg.Recording.Root, cfg.Recording.FFmpegPath, cfg.Recording.SegmentSeconds)
+		if err != nil {
+			log.Fatalf("Failed to initialize recorder: %v", err)
+		}
+		recordingAdapter = local
+		if cfg.Recording.Record {
+			recorder = local
+		}
+	}
+	recordingsService := services.NewRecordingsService(database.GetDB(), recordingAdapter, recorder, cfg.Recording.DefaultRetentionDays)
+	recordingHandler := handlers.NewRecordingHandler(recordingsService, alertsService, camerasService)
+
+	// Start the hub once every service has registered its callbacks, then
+	// the background workers, so nothing they publish is lost
+	wsHub.Start()
+	go notificationsService.Run(context.Background(), time.Duration(cfg.Notify.WorkerIntervalSeconds)*time.Second)
+	go snapshotService.RunPrebuffer(context.Background())
+	go webhooksService.Run(context.Background(), time.Duration(cfg.Webhook.WorkerIntervalSeconds)*time.Second)
+	go safetyService.Run(context.Background(), time.Duration(cfg.Safety.WatchIntervalSeconds)*time.Second)
+	go patrolsService.Run(context.Background(), time.Duration(cfg.Patrol.WatchIntervalSeconds)*time.Second)
+	go reportsService.Run(context.Background(), time.Duration(cfg.Report.SchedulerIntervalSeconds)*time.Second)
+	go recordingsService.Run(context.Background(), time.Duration(cfg.Recording.SyncIntervalSeconds)*time.Second)
+
+	// Setup Gin router. Streams may carry the access token in the query
+	// string, so requests are logged with it redacted.
+	router := gin.New()
+	router.Use(middleware.RequestLogger(), gin.Recovery())
 
 	// CORS configuration
 	router.Use(cors.New(cors.Config{
@@ -99,7 +323,7 @@ func main() {
         "http://127.0.0.1:3000",
     },
     AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-    AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+    AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Last-Event-ID", "X-App-Version", "X-Device"},
     ExposeHeaders:    []string{"Content-Length"},
     AllowCredentials: true,
 	
@@ -114,6 +338,9 @@ func main() {
 	})
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Signed media downloads (snapshots, uploads)
+	router.GET("/media/*key", mediaHandler.ServeMedia)
+
 	// API routes
 	api := router.Group("/api")
 	{
@@ -123,6 +350,29 @@ func main() {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/logout", authHandler.Logout)
 			auth.GET("/me", middleware.AuthMiddleware(cfg), authHandler.GetCurrentUser)
+			auth.POST("/me/location", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), mapHandler.UpdateMyLocation)
+			auth.PUT("/me/duty", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), mapHandler.UpdateMyDuty)
+			auth.POST("/me/sos", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), safetyHandler.RaiseSOS)
+			auth.GET("/me/lone-worker", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), safetyHandler.GetMyLoneWorker)
+			auth.POST("/me/lone-worker", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), safetyHandler.StartLoneWorker)
+			auth.POST("/me/lone-worker/check-in", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), safetyHandler.CheckIn)
+			auth.DELETE("/me/lone-worker", middleware.AuthMiddleware(cfg), middleware.RoleMiddleware(models.RoleSecurityGuard), safetyHandler.EndLoneWorker)
+			auth.GET("/me/preferences", middleware.AuthMiddleware(cfg), preferenceHandler.GetMyPreferences)
+			auth.PUT("/me/preferences", middleware.AuthMiddleware(cfg), preferenceHandler.UpdateMyPreferences)
+			auth.DELETE("/me/preferences", middleware.AuthMiddleware(cfg), preferenceHandler.ResetMyPreferences)
+			auth.PUT("/me/preferences/events/:event", middleware.AuthMiddleware(cfg), preferenceHandler.SetMyEventPreference)
+			auth.DELETE("/me/preferences/events/:event", middleware.AuthMiddleware(cfg), preferenceHandler.ResetMyEventPreference)
+			auth.GET("/me/devices", middleware.AuthMiddleware(cfg), notificationHandler.GetMyDevices)
+			auth.POST("/me/devices", middleware.AuthMiddleware(cfg), notificationHandler.RegisterDevice)
+			auth.DELETE("/me/devices/:id", middleware.AuthMiddleware(cfg), notificationHandler.RemoveDevice)
+			auth.POST("/me/notifications/test", middleware.AuthMiddleware(cfg), notificationHandler.SendTestNotification)
+		}
+
+		// Realtime events over SSE; the stream accepts the token as a query parameter
+		events := api.Group("/events")
+		{
+			events.GET("/stream", middleware.StreamAuthMiddleware(cfg), eventsHandler.Stream)
+			events.POST("/ack", middleware.AuthMiddleware(cfg), eventsHandler.Ack)
 		}
 
 		// Protected routes
@@ -135,6 +385,24 @@ func main() {
 					premises.GET("", middleware.RoleMiddleware(models.RoleSCSOperator), premiseHandler.GetPremises)
 					premises.GET("/:id", middleware.RoleMiddleware(models.RoleSCSOperator), premiseHandler.GetPremise)
 					premises.GET("/:id/cameras", premiseHandler.GetPremiseCameras)
+					premises.GET("/:id/retention", middleware.RoleMiddleware(models.RoleSCSOperator), recordingHandler.GetRetentionPolicy)
+					premises.PUT("/:id/retention", middleware.RoleMiddleware(models.RoleSCSOperator), recordingHandler.UpdateRetentionPolicy)
+					premises.GET("/:id/floors", middleware.RoleMiddleware(models.RoleSCSOperator), floorPlanHandler.GetFloors)
+					premises.POST("/:id/floors", middleware.RoleMiddleware(models.RoleSCSOperator), floorPlanHandler.CreateFloor)
+					premises.PUT("/:id/location", middleware.RoleMiddleware(models.RoleSCSOperator), mapHandler.UpdatePremiseLocation)
+				}
+
+				// Floor plan routes
+				floors := protected.Group("/floors", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					floors.GET("/:id", floorPlanHandler.GetFloor)
+					floors.DELETE("/:id", floorPlanHandler.DeleteFloor)
+					floors.POST("/:id/zones", floorPlanHandler.CreateZone)
+				}
+				zones := protected.Group("/zones", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					zones.PUT("/:id", floorPlanHandler.UpdateZone)
+					zones.DELETE("/:id", floorPlanHandler.DeleteZone)
 				}
 
 						// Cameras routes
@@ -144,7 +412,26 @@ func main() {
 					cameras.GET("/premise/:id", middleware.RoleMiddleware(models.RoleSCSOperator), cameraHandler.GetCamerasByPremise)
 					cameras.GET("/assigned", middleware.RoleMiddleware(models.RoleSecurityGuard), cameraHandler.GetAssignedCameras)
 					cameras.GET("/:id", cameraHandler.GetCamera)
+					cameras.GET("/:id/snapshot", cameraHandler.GetCameraSnapshot)
+					cameras.GET("/:id/recordings", recordingHandler.GetCameraRecordings)
 					cameras.PUT("/:id/status", middleware.RoleMiddleware(models.RoleSCSOperator), cameraHandler.UpdateCameraStatus)
+					cameras.PUT("/:id/capabilities", middleware.RoleMiddleware(models.RoleSCSOperator), cameraHandler.UpdateCameraCapabilities)
+					cameras.PUT("/:id/position", middleware.RoleMiddleware(models.RoleSCSOperator), floorPlanHandler.PositionCamera)
+					cameras.PUT("/:id/location", middleware.RoleMiddleware(models.RoleSCSOperator), mapHandler.UpdateCameraLocation)
+
+					// PTZ control
+					ptz := cameras.Group("/:id/ptz", middleware.RoleMiddleware(models.RoleSCSOperator))
+					{
+						ptz.GET("/lock", ptzHandler.GetLock)
+						ptz.POST("/lock", ptzHandler.AcquireLock)
+						ptz.DELETE("/lock", ptzHandler.ReleaseLock)
+						ptz.POST("/move", ptzHandler.Move)
+						ptz.POST("/zoom", ptzHandler.Zoom)
+						ptz.POST("/stop", ptzHandler.Stop)
+						ptz.GET("/presets", ptzHandler.GetPresets)
+						ptz.POST("/presets", ptzHandler.SavePreset)
+						ptz.POST("/presets/:token/goto", ptzHandler.GotoPreset)
+					}
 				}
 
 							// Alerts routes
@@ -152,6 +439,7 @@ func main() {
 				{
 					alerts.GET("", middleware.RoleMiddleware(models.RoleSCSOperator), alertHandler.GetAlerts)
 					alerts.GET("/:id", alertHandler.GetAlert)
+					alerts.GET("/:id/clip", recordingHandler.GetAlertClip)
 					alerts.POST("/:id/acknowledge", middleware.RoleMiddleware(models.RoleSCSOperator), alertHandler.AcknowledgeAlert)
 					alerts.POST("/:id/assign", middleware.RoleMiddleware(models.RoleSCSOperator), alertHandler.AssignAlert)
 					alerts.POST("", middleware.RoleMiddleware(models.RoleSCSOperator), alertHandler.CreateAlert)
@@ -167,6 +455,22 @@ func main() {
 					incidents.GET("/assigned/me", middleware.RoleMiddleware(models.RoleSecurityGuard), incidentHandler.GetAssignedIncidents)
 					incidents.PUT("/:id", incidentHandler.UpdateIncident)
 					incidents.POST("/:id/updates", incidentHandler.AddIncidentUpdate)
+
+					// Chat between operators and assigned guards
+					incidents.GET("/messages/unread", incidentMessageHandler.GetUnreadCounts)
+					incidents.GET("/quick-replies", incidentMessageHandler.GetQuickReplies)
+					incidents.POST("/quick-replies", middleware.RoleMiddleware(models.RoleSCSOperator), incidentMessageHandler.CreateQuickReply)
+					incidents.DELETE("/quick-replies/:id", middleware.RoleMiddleware(models.RoleSCSOperator), incidentMessageHandler.DeleteQuickReply)
+					incidents.GET("/:id/messages", incidentMessageHandler.GetMessages)
+					incidents.POST("/:id/messages", incidentMessageHandler.SendMessage)
+					incidents.POST("/:id/messages/read", incidentMessageHandler.MarkRead)
+					incidents.GET("/:id/checklist", sopHandler.GetChecklist)
+					incidents.POST("/:id/checklist/items/:item_id/complete", sopHandler.CompleteStep)
+					incidents.DELETE("/:id/checklist/items/:item_id/complete", sopHandler.ReopenStep)
+					incidents.POST("/:id/checklist/override", middleware.RoleMiddleware(models.RoleSCSOperator), sopHandler.OverrideChecklist)
+					incidents.GET("/:id/report", incidentReportHandler.GetReport)
+					incidents.PUT("/:id/report", middleware.RoleMiddleware(models.RoleSCSOperator), incidentReportHandler.UpdateReport)
+					incidents.POST("/:id/report/finalize", middleware.RoleMiddleware(models.RoleSCSOperator), incidentReportHandler.FinalizeReport)
 				}
 				
 
@@ -177,20 +481,141 @@ func main() {
 					users.GET("/assigned/camera/:id", middleware.RoleMiddleware(models.RoleSCSOperator), userHandler.GetUsersByAssignedCamera)
 					users.GET("/assigned/incident/:id", middleware.RoleMiddleware(models.RoleSCSOperator), userHandler.GetUsersByAssignedIncident)
 				}
+
+				// Analytics
+				analytics := protected.Group("/analytics", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					analytics.GET("/response-times", analyticsHandler.GetResponseTimes)
+					analytics.GET("/volumes", analyticsHandler.GetVolumes)
+					analytics.GET("/false-alarms", analyticsHandler.GetFalseAlarms)
+					analytics.GET("/guards", analyticsHandler.GetGuardPerformance)
+				}
+
+				// Reports
+				reportSchedules := protected.Group("/report-schedules", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					reportSchedules.GET("", reportHandler.GetSchedules)
+					reportSchedules.GET("/:id", reportHandler.GetSchedule)
+					reportSchedules.POST("", reportHandler.CreateSchedule)
+					reportSchedules.PUT("/:id", reportHandler.UpdateSchedule)
+					reportSchedules.DELETE("/:id", reportHandler.DeleteSchedule)
+					reportSchedules.POST("/:id/run", reportHandler.RunSchedule)
+				}
+				reports := protected.Group("/reports", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					reports.GET("", reportHandler.GetReports)
+					reports.POST("", reportHandler.GenerateReport)
+					reports.GET("/:id", reportHandler.GetReport)
+					reports.GET("/:id/download", reportHandler.DownloadReport)
+				}
+
+				// Search
+				protected.GET("/search", searchHandler.Search)
+
+				// Map feed
+				protected.GET("/map", middleware.RoleMiddleware(models.RoleSCSOperator), mapHandler.GetMap)
+
+				// Audit log
+				protected.GET("/audit-logs", middleware.RoleMiddleware(models.RoleSCSOperator), auditHandler.GetAuditLogs)
+
+				// Patrols
+				patrols := protected.Group("/patrols")
+				{
+					patrols.GET("/routes", patrolHandler.GetRoutes)
+					patrols.GET("/routes/:id", patrolHandler.GetRoute)
+					patrols.POST("/routes", middleware.RoleMiddleware(models.RoleSCSOperator), patrolHandler.CreateRoute)
+					patrols.PUT("/routes/:id", middleware.RoleMiddleware(models.RoleSCSOperator), patrolHandler.UpdateRoute)
+					patrols.DELETE("/routes/:id", middleware.RoleMiddleware(models.RoleSCSOperator), patrolHandler.DeleteRoute)
+					patrols.POST("/routes/:id/start", middleware.RoleMiddleware(models.RoleSecurityGuard), patrolHandler.StartPatrol)
+					patrols.POST("/scan", middleware.RoleMiddleware(models.RoleSecurityGuard), patrolHandler.Scan)
+					patrols.GET("/runs", patrolHandler.GetRuns)
+					patrols.GET("/runs/:id", patrolHandler.GetRun)
+					patrols.GET("/compliance", patrolHandler.GetCompliance)
+				}
+
+				// SOP templates
+				sopTemplates := protected.Group("/sop-templates", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					sopTemplates.GET("", sopHandler.GetTemplates)
+					sopTemplates.GET("/:id", sopHandler.GetTemplate)
+					sopTemplates.POST("", sopHandler.CreateTemplate)
+					sopTemplates.PUT("/:id", sopHandler.UpdateTemplate)
+					sopTemplates.DELETE("/:id", sopHandler.DeleteTemplate)
+				}
+
+				// Notification delivery log
+				notifications := protected.Group("/notifications", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					notifications.GET("/deliveries", notificationHandler.GetDeliveries)
+					notifications.GET("/deliveries/:id", notificationHandler.GetDelivery)
+				}
+
+				// Maintenance windows and the alerts they suppressed
+				maintenance := protected.Group("/maintenance", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					maintenance.GET("/windows", maintenanceHandler.GetWindows)
+					maintenance.POST("/windows", maintenanceHandler.CreateWindow)
+					maintenance.GET("/windows/:id", maintenanceHandler.GetWindow)
+					maintenance.PUT("/windows/:id", maintenanceHandler.UpdateWindow)
+					maintenance.DELETE("/windows/:id", maintenanceHandler.DeleteWindow)
+					maintenance.POST("/windows/:id/end", maintenanceHandler.EndWindow)
+					maintenance.GET("/suppressed-alerts", maintenanceHandler.GetSuppressedAlerts)
+				}
+
+				// Arming schedules, holidays, manual arming and the alert policy
+				arming := protected.Group("/arming", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					arming.GET("/state", armingHandler.GetState)
+					arming.POST("/arm", armingHandler.Arm)
+					arming.POST("/disarm", armingHandler.Disarm)
+					arming.POST("/resume", armingHandler.Resume)
+					arming.GET("/overrides", armingHandler.GetOverrides)
+					arming.GET("/schedules", armingHandler.GetSchedules)
+					arming.POST("/schedules", armingHandler.CreateSchedule)
+					arming.GET("/schedules/:id", armingHandler.GetSchedule)
+					arming.PUT("/schedules/:id", armingHandler.UpdateSchedule)
+					arming.DELETE("/schedules/:id", armingHandler.DeleteSchedule)
+					arming.GET("/calendars", armingHandler.GetCalendars)
+					arming.POST("/calendars", armingHandler.CreateCalendar)
+					arming.GET("/calendars/:id", armingHandler.GetCalendar)
+					arming.PUT("/calendars/:id", armingHandler.UpdateCalendar)
+					arming.DELETE("/calendars/:id", armingHandler.DeleteCalendar)
+					arming.GET("/policies", armingHandler.GetPolicies)
+					arming.PUT("/policies/:type", armingHandler.SetPolicy)
+					arming.DELETE("/policies/:type", armingHandler.DeletePolicy)
+				}
+
+				// Outbound webhooks
+				webhooks := protected.Group("/webhooks", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					webhooks.GET("", webhookHandler.GetWebhooks)
+					webhooks.POST("", webhookHandler.CreateWebhook)
+					webhooks.GET("/:id", webhookHandler.GetWebhook)
+					webhooks.PUT("/:id", webhookHandler.UpdateWebhook)
+					webhooks.DELETE("/:id", webhookHandler.DeleteWebhook)
+					webhooks.POST("/:id/rotate-secret", webhookHandler.RotateWebhookSecret)
+					webhooks.POST("/:id/ping", webhookHandler.PingWebhook)
+					webhooks.GET("/:id/deliveries", webhookHandler.GetWebhookDeliveries)
+					webhooks.GET("/:id/deliveries/:delivery_id", webhookHandler.GetWebhookDelivery)
+					webhooks.POST("/:id/deliveries/:delivery_id/redeliver", webhookHandler.RedeliverWebhook)
+				}
+
+				// Lone workers
+				protected.GET("/lone-workers", middleware.RoleMiddleware(models.RoleSCSOperator), safetyHandler.GetLoneWorkers)
+
+				// Presence and connection diagnostics
+				protected.GET("/presence", middleware.RoleMiddleware(models.RoleSCSOperator), presenceHandler.GetPresence)
+				admin := protected.Group("/admin", middleware.RoleMiddleware(models.RoleSCSOperator))
+				{
+					admin.GET("/connections", presenceHandler.GetConnections)
+					admin.DELETE("/connections/:id", presenceHandler.Disconnect)
+				}
 		}
 
 		// WebSocket endpoint
-		router.GET("/ws", func(c *gin.Context) {
-			// Extract user info from query params (in real app, use JWT)
-			userID := c.Query("user_id")
-			role := c.Query("role")
-			
-			if userID == "" || role == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "user_id and role required"})
-				return
-			}
-
-			websocket.ServeWebSocket(wsHub, userID, role)(c.Writer, c.Request)
+		router.GET("/ws", middleware.StreamAuthMiddleware(cfg), func(c *gin.Context) {
+			role, _ := c.Get("role")
+			websocket.ServeWebSocket(wsHub, c.GetString("user_id"), string(role.(models.UserRole)))(c.Writer, c.Request)
 		})
 	}
 
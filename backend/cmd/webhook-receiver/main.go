@@ -0,0 +1,59 @@
+// Command webhook-receiver is a local endpoint for trying out outbound
+// webhooks. It verifies each request's signature and logs the event;
+// -status makes it answer with another status to exercise retries and
+// auto-disable.
+//
+// The server only posts to it with WEBHOOK_ALLOW_PRIVATE_TARGETS=true.
+//
+//	go run ./cmd/webhook-receiver -secret whsec_... -addr :9000
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/pkg/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	secret := flag.String("secret", "", "webhook secret; signatures are not checked when empty")
+	status := flag.Int("status", http.StatusOK, "status to answer verified requests with")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "how old a signed timestamp may be")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if *secret != "" {
+			if err := webhook.Verify(*secret, r.Header, body, *tolerance, time.Now()); err != nil {
+				log.Printf("Rejected %s %s: %v", r.Header.Get(webhook.HeaderEvent), r.Header.Get(webhook.HeaderDelivery), err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, body, "", "  "); err != nil {
+			pretty.Write(body)
+		}
+		log.Printf("Received %s (delivery %s), answering %d\n%s",
+			r.Header.Get(webhook.HeaderEvent), r.Header.Get(webhook.HeaderDelivery), *status, pretty.String())
+		w.WriteHeader(*status)
+	})
+
+	log.Printf("Webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
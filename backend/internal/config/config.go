@@ -8,11 +8,24 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	Kafka    KafkaConfig
-	JWT      JWTConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	Kafka       KafkaConfig
+	JWT         JWTConfig
+	Media       MediaConfig
+	Capture     CaptureConfig
+	PTZ         PTZConfig
+	Recording   RecordingConfig
+	Realtime    RealtimeConfig
+	Safety      SafetyConfig
+	Patrol      PatrolConfig
+	Analytics   AnalyticsConfig
+	SMTP        SMTPConfig
+	Report      ReportConfig
+	Notify      NotifyConfig
+	Webhook     WebhookConfig
+	Maintenance MaintenanceConfig
 }
 
 type ServerConfig struct {
@@ -46,6 +59,119 @@ type JWTConfig struct {
 	Duration  int // in hours
 }
 
+type MediaConfig struct {
+	Root       string
+	PublicURL  string
+	SigningKey string
+	URLTTL     int // in minutes
+}
+
+type CaptureConfig struct {
+	Backend             string
+	FFmpegPath          string
+	TimeoutSeconds      int
+	AlertTimeoutSeconds int // for the frame taken while an alert is raised
+	PreEventSeconds     int
+	PostEventSeconds    int
+	IntervalSeconds     int
+}
+
+type PTZConfig struct {
+	ONVIFMode      string
+	LockTTLSeconds int
+}
+
+type RecordingConfig struct {
+	Adapter              string
+	Root                 string
+	Record               bool // run the local ffmpeg recorder
+	FFmpegPath           string
+	SegmentSeconds       int
+	NVRBaseURL           string
+	NVRToken             string
+	SyncIntervalSeconds  int
+	DefaultRetentionDays int
+}
+
+type RealtimeConfig struct {
+	Backplane            string // memory | redis; redis also keeps the outbox
+	OutboxSize           int    // messages kept per user for replay
+	OutboxRetentionHours int
+	AckTimeoutSeconds    int
+	MaxDeliveryAttempts  int
+}
+
+type SafetyConfig struct {
+	CheckInGraceSeconds  int // after a missed check-in, before escalating
+	MinCheckInMinutes    int
+	MaxCheckInMinutes    int
+	WatchIntervalSeconds int
+}
+
+type PatrolConfig struct {
+	MissedGraceMinutes   int // after a checkpoint turns late, before it counts as missed
+	WatchIntervalSeconds int
+}
+
+type AnalyticsConfig struct {
+	Cache           string // memory | redis
+	CacheTTLSeconds int
+}
+
+// SMTPConfig is the outgoing mail server. The defaults point at a local mail
+// catcher such as Mailpit; leave Username empty for servers without auth.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type ReportConfig struct {
+	SchedulerIntervalSeconds int
+}
+
+// NotifyConfig selects the provider of each notification channel. Email is
+// smtp or fake; SMS and push are http or fake, and fake only logs.
+type NotifyConfig struct {
+	EmailProvider         string
+	SMSProvider           string
+	SMSGatewayURL         string
+	SMSAPIKey             string
+	SMSFrom               string
+	PushProvider          string
+	FCMURL                string
+	FCMToken              string
+	APNsURL               string
+	APNsToken             string
+	APNsTopic             string
+	MaxAttempts           int
+	RetryBaseSeconds      int // doubles after every failed attempt
+	WorkerIntervalSeconds int
+}
+
+// WebhookConfig tunes outbound webhook delivery. A subscription is disabled
+// after DisableAfterFailures failed attempts in a row. Receivers on
+// loopback, private and link-local addresses are refused unless
+// AllowPrivateTargets is set.
+type WebhookConfig struct {
+	MaxAttempts           int
+	RetryBaseSeconds      int // doubles after every failed attempt
+	TimeoutSeconds        int
+	DisableAfterFailures  int
+	WorkerIntervalSeconds int
+	AllowPrivateTargets   bool
+}
+
+// MaintenanceConfig controls the maintenance window opened when a camera is
+// put into maintenance. A duration of 0 keeps it open until the camera is
+// back in service.
+type MaintenanceConfig struct {
+	CameraAutoWindow    bool
+	CameraWindowMinutes int
+}
+
 const (
 	// Server defaults
 	DefaultServerPort = "8080"
@@ -72,6 +198,82 @@ const (
 	// JWT defaults
 	DefaultJWTSecretKey     = "your-secret-key"
 	DefaultJWTDurationHours = 24
+
+	// Media defaults
+	DefaultMediaRoot       = "./data/media"
+	DefaultMediaPublicURL  = "http://localhost:8081/media"
+	DefaultMediaSigningKey = "your-media-signing-key"
+	DefaultMediaURLTTLMins = 60
+
+	// Capture defaults
+	DefaultCaptureBackend             = "simulated"
+	DefaultCaptureFFmpegPath          = "ffmpeg"
+	DefaultCaptureTimeoutSeconds      = 10
+	DefaultCaptureAlertTimeoutSeconds = 2
+	DefaultCapturePreEventSeconds     = 4
+	DefaultCapturePostEventSeconds    = 4
+	DefaultCaptureIntervalSeconds     = 2
+
+	// PTZ defaults
+	DefaultPTZONVIFMode      = "simulator"
+	DefaultPTZLockTTLSeconds = 60
+
+	// Recording defaults
+	DefaultRecordingAdapter             = "local"
+	DefaultRecordingRoot                = "./data/recordings"
+	DefaultRecordingRecord              = false
+	DefaultRecordingSegmentSeconds      = 10
+	DefaultRecordingSyncIntervalSeconds = 30
+	DefaultRecordingRetentionDays       = 30
+
+	// Realtime defaults
+	DefaultRealtimeBackplane            = "memory"
+	DefaultRealtimeOutboxSize           = 200
+	DefaultRealtimeOutboxRetentionHours = 24
+	DefaultRealtimeAckTimeoutSeconds    = 15
+	DefaultRealtimeMaxDeliveryAttempts  = 8
+
+	// Safety defaults
+	DefaultSafetyCheckInGraceSeconds  = 120
+	DefaultSafetyMinCheckInMinutes    = 5
+	DefaultSafetyMaxCheckInMinutes    = 240
+	DefaultSafetyWatchIntervalSeconds = 15
+
+	// Patrol defaults
+	DefaultPatrolMissedGraceMinutes   = 10
+	DefaultPatrolWatchIntervalSeconds = 30
+
+	// Analytics defaults
+	DefaultAnalyticsCache           = "memory"
+	DefaultAnalyticsCacheTTLSeconds = 60
+
+	// SMTP defaults
+	DefaultSMTPHost = "localhost"
+	DefaultSMTPPort = 1025
+	DefaultSMTPFrom = "Smart City Surveillance <reports@scs.local>"
+
+	// Report defaults
+	DefaultReportSchedulerIntervalSeconds = 60
+
+	// Notification defaults
+	DefaultNotifyEmailProvider         = "smtp"
+	DefaultNotifySMSProvider           = "fake"
+	DefaultNotifyPushProvider          = "fake"
+	DefaultNotifyMaxAttempts           = 5
+	DefaultNotifyRetryBaseSeconds      = 30
+	DefaultNotifyWorkerIntervalSeconds = 5
+
+	// Webhook defaults
+	DefaultWebhookMaxAttempts           = 8
+	DefaultWebhookRetryBaseSeconds      = 30
+	DefaultWebhookTimeoutSeconds        = 10
+	DefaultWebhookDisableAfterFailures  = 20
+	DefaultWebhookWorkerIntervalSeconds = 5
+	DefaultWebhookAllowPrivateTargets   = false
+
+	// Maintenance defaults
+	DefaultMaintenanceCameraAutoWindow    = true
+	DefaultMaintenanceCameraWindowMinutes = 0
 )
 
 func Load() (*Config, error) {
@@ -106,12 +308,100 @@ func Load() (*Config, error) {
 			SecretKey: getEnv("JWT_SECRET_KEY", DefaultJWTSecretKey),
 			Duration:  getEnvAsInt("JWT_DURATION_HOURS", DefaultJWTDurationHours),
 		},
+		Media: MediaConfig{
+			Root:       getEnv("MEDIA_ROOT", DefaultMediaRoot),
+			PublicURL:  getEnv("MEDIA_PUBLIC_URL", DefaultMediaPublicURL),
+			SigningKey: getEnv("MEDIA_SIGNING_KEY", DefaultMediaSigningKey),
+			URLTTL:     getEnvAsInt("MEDIA_URL_TTL_MINUTES", DefaultMediaURLTTLMins),
+		},
+		Capture: CaptureConfig{
+			Backend:             getEnv("CAPTURE_BACKEND", DefaultCaptureBackend),
+			FFmpegPath:          getEnv("CAPTURE_FFMPEG_PATH", DefaultCaptureFFmpegPath),
+			TimeoutSeconds:      getEnvAsInt("CAPTURE_TIMEOUT_SECONDS", DefaultCaptureTimeoutSeconds),
+			AlertTimeoutSeconds: getEnvAsInt("CAPTURE_ALERT_TIMEOUT_SECONDS", DefaultCaptureAlertTimeoutSeconds),
+			PreEventSeconds:     getEnvAsInt("CAPTURE_PRE_EVENT_SECONDS", DefaultCapturePreEventSeconds),
+			PostEventSeconds:    getEnvAsInt("CAPTURE_POST_EVENT_SECONDS", DefaultCapturePostEventSeconds),
+			IntervalSeconds:     getEnvAsInt("CAPTURE_INTERVAL_SECONDS", DefaultCaptureIntervalSeconds),
+		},
+		PTZ: PTZConfig{
+			ONVIFMode:      getEnv("PTZ_ONVIF_MODE", DefaultPTZONVIFMode),
+			LockTTLSeconds: getEnvAsInt("PTZ_LOCK_TTL_SECONDS", DefaultPTZLockTTLSeconds),
+		},
+		Recording: RecordingConfig{
+			Adapter:              getEnv("RECORDING_ADAPTER", DefaultRecordingAdapter),
+			Root:                 getEnv("RECORDING_ROOT", DefaultRecordingRoot),
+			Record:               getEnvAsBool("RECORDING_LOCAL_RECORD", DefaultRecordingRecord),
+			FFmpegPath:           getEnv("RECORDING_FFMPEG_PATH", DefaultCaptureFFmpegPath),
+			SegmentSeconds:       getEnvAsInt("RECORDING_SEGMENT_SECONDS", DefaultRecordingSegmentSeconds),
+			NVRBaseURL:           getEnv("RECORDING_NVR_BASE_URL", ""),
+			NVRToken:             getEnv("RECORDING_NVR_TOKEN", ""),
+			SyncIntervalSeconds:  getEnvAsInt("RECORDING_SYNC_INTERVAL_SECONDS", DefaultRecordingSyncIntervalSeconds),
+			DefaultRetentionDays: getEnvAsInt("RECORDING_RETENTION_DAYS", DefaultRecordingRetentionDays),
+		},
+		Realtime: RealtimeConfig{
+			Backplane:            getEnv("REALTIME_BACKPLANE", DefaultRealtimeBackplane),
+			OutboxSize:           getEnvAsInt("REALTIME_OUTBOX_SIZE", DefaultRealtimeOutboxSize),
+			OutboxRetentionHours: getEnvAsInt("REALTIME_OUTBOX_RETENTION_HOURS", DefaultRealtimeOutboxRetentionHours),
+			AckTimeoutSeconds:    getEnvAsInt("REALTIME_ACK_TIMEOUT_SECONDS", DefaultRealtimeAckTimeoutSeconds),
+			MaxDeliveryAttempts:  getEnvAsInt("REALTIME_MAX_DELIVERY_ATTEMPTS", DefaultRealtimeMaxDeliveryAttempts),
+		},
+		Safety: SafetyConfig{
+			CheckInGraceSeconds:  getEnvAsInt("SAFETY_CHECKIN_GRACE_SECONDS", DefaultSafetyCheckInGraceSeconds),
+			MinCheckInMinutes:    getEnvAsInt("SAFETY_MIN_CHECKIN_MINUTES", DefaultSafetyMinCheckInMinutes),
+			MaxCheckInMinutes:    getEnvAsInt("SAFETY_MAX_CHECKIN_MINUTES", DefaultSafetyMaxCheckInMinutes),
+			WatchIntervalSeconds: getEnvAsInt("SAFETY_WATCH_INTERVAL_SECONDS", DefaultSafetyWatchIntervalSeconds),
+		},
+		Patrol: PatrolConfig{
+			MissedGraceMinutes:   getEnvAsInt("PATROL_MISSED_GRACE_MINUTES", DefaultPatrolMissedGraceMinutes),
+			WatchIntervalSeconds: getEnvAsInt("PATROL_WATCH_INTERVAL_SECONDS", DefaultPatrolWatchIntervalSeconds),
+		},
+		Analytics: AnalyticsConfig{
+			Cache:           getEnv("ANALYTICS_CACHE", DefaultAnalyticsCache),
+			CacheTTLSeconds: getEnvAsInt("ANALYTICS_CACHE_TTL_SECONDS", DefaultAnalyticsCacheTTLSeconds),
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", DefaultSMTPHost),
+			Port:     getEnvAsInt("SMTP_PORT", DefaultSMTPPort),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", DefaultSMTPFrom),
+		},
+		Report: ReportConfig{
+			SchedulerIntervalSeconds: getEnvAsInt("REPORT_SCHEDULER_INTERVAL_SECONDS", DefaultReportSchedulerIntervalSeconds),
+		},
+		Notify: NotifyConfig{
+			EmailProvider:         getEnv("NOTIFY_EMAIL_PROVIDER", DefaultNotifyEmailProvider),
+			SMSProvider:           getEnv("NOTIFY_SMS_PROVIDER", DefaultNotifySMSProvider),
+			SMSGatewayURL:         getEnv("NOTIFY_SMS_GATEWAY_URL", ""),
+			SMSAPIKey:             getEnv("NOTIFY_SMS_API_KEY", ""),
+			SMSFrom:               getEnv("NOTIFY_SMS_FROM", ""),
+			PushProvider:          getEnv("NOTIFY_PUSH_PROVIDER", DefaultNotifyPushProvider),
+			FCMURL:                getEnv("NOTIFY_FCM_URL", ""),
+			FCMToken:              getEnv("NOTIFY_FCM_TOKEN", ""),
+			APNsURL:               getEnv("NOTIFY_APNS_URL", ""),
+			APNsToken:             getEnv("NOTIFY_APNS_TOKEN", ""),
+			APNsTopic:             getEnv("NOTIFY_APNS_TOPIC", ""),
+			MaxAttempts:           getEnvAsInt("NOTIFY_MAX_ATTEMPTS", DefaultNotifyMaxAttempts),
+			RetryBaseSeconds:      getEnvAsInt("NOTIFY_RETRY_BASE_SECONDS", DefaultNotifyRetryBaseSeconds),
+			WorkerIntervalSeconds: getEnvAsInt("NOTIFY_WORKER_INTERVAL_SECONDS", DefaultNotifyWorkerIntervalSeconds),
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:           getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", DefaultWebhookMaxAttempts),
+			RetryBaseSeconds:      getEnvAsInt("WEBHOOK_RETRY_BASE_SECONDS", DefaultWebhookRetryBaseSeconds),
+			TimeoutSeconds:        getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", DefaultWebhookTimeoutSeconds),
+			DisableAfterFailures:  getEnvAsInt("WEBHOOK_DISABLE_AFTER_FAILURES", DefaultWebhookDisableAfterFailures),
+			WorkerIntervalSeconds: getEnvAsInt("WEBHOOK_WORKER_INTERVAL_SECONDS", DefaultWebhookWorkerIntervalSeconds),
+			AllowPrivateTargets:   getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", DefaultWebhookAllowPrivateTargets),
+		},
+		Maintenance: MaintenanceConfig{
+			CameraAutoWindow:    getEnvAsBool("MAINTENANCE_CAMERA_AUTO_WINDOW", DefaultMaintenanceCameraAutoWindow),
+			CameraWindowMinutes: getEnvAsInt("MAINTENANCE_CAMERA_WINDOW_MINUTES", DefaultMaintenanceCameraWindowMinutes),
+		},
 	}
 
 	return config, nil
 }
 
-
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -126,4 +416,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
-} 
\ No newline at end of file
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -8,6 +8,7 @@ import (
 	"smart-city-surveillance/internal/middleware"
 	"smart-city-surveillance/internal/models"
 
+	"github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -44,18 +45,83 @@ func Migrate() error {
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.Premise{},
+		&models.FloorPlan{},
+		&models.Zone{},
 		&models.Camera{},
+		&models.PTZLock{},
 		&models.Alert{},
+		&models.AlertSnapshot{},
 		&models.Incident{},
 		&models.IncidentUpdate{},
+		&models.StatusChange{},
+		&models.IncidentMessage{},
+		&models.MessageAttachment{},
+		&models.IncidentReadReceipt{},
+		&models.QuickReply{},
 		&models.CameraGuard{},
 		&models.IncidentGuard{},
+		&models.AuditLog{},
+		&models.GuardLocation{},
+		&models.LoneWorkerSession{},
+		&models.PatrolRoute{},
+		&models.PatrolCheckpoint{},
+		&models.PatrolRun{},
+		&models.PatrolVisit{},
+		&models.SOPTemplate{},
+		&models.SOPStep{},
+		&models.IncidentChecklistItem{},
+		&models.RecordingSegment{},
+		&models.RetentionPolicy{},
+		&models.ReportSchedule{},
+		&models.Report{},
+		&models.IncidentReport{},
+		&models.DeviceToken{},
+		&models.NotificationPreference{},
+		&models.NotificationSettings{},
+		&models.NotificationDelivery{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.MaintenanceWindow{},
+		&models.SuppressionRule{},
+		&models.SuppressedAlert{},
+		&models.HolidayCalendar{},
+		&models.Holiday{},
+		&models.ArmingSchedule{},
+		&models.ArmingPeriod{},
+		&models.ArmingOverride{},
+		&models.ArmingPolicy{},
 	)
 	
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Full-text search indexes; the documents must match services/search.go
+	searchIndexes := map[string]string{
+		"idx_alerts_search":           "alerts USING GIN (to_tsvector('english', coalesce(alerts.title, '') || ' ' || coalesce(alerts.description, '') || ' ' || coalesce(alerts.location, '')))",
+		"idx_incidents_search":        "incidents USING GIN (to_tsvector('english', coalesce(incidents.description, '') || ' ' || coalesce(incidents.location, '')))",
+		"idx_incident_updates_search": "incident_updates USING GIN (to_tsvector('english', coalesce(incident_updates.message, '')))",
+		"idx_cameras_search":          "cameras USING GIN (to_tsvector('english', coalesce(cameras.name, '') || ' ' || coalesce(cameras.location, '')))",
+		"idx_premises_search":         "premises USING GIN (to_tsvector('english', coalesce(premises.name, '') || ' ' || coalesce(premises.address, '')))",
+	}
+	for name, definition := range searchIndexes {
+		if err := DB.Exec("CREATE INDEX IF NOT EXISTS " + name + " ON " + definition).Error; err != nil {
+			return fmt.Errorf("failed to create search index %s: %w", name, err)
+		}
+	}
+
+	// One arming schedule per area. idx_arming_schedule_area covers zones;
+	// premise-wide schedules need their own index, since their zone is null
+	uniqueIndexes := map[string]string{
+		"idx_arming_schedule_premise_wide": "arming_schedules (premise_id) WHERE zone_id IS NULL",
+	}
+	for name, definition := range uniqueIndexes {
+		if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS " + name + " ON " + definition).Error; err != nil {
+			return fmt.Errorf("failed to create unique index %s: %w", name, err)
+		}
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
@@ -125,6 +191,8 @@ func SeedData() error {
 			FloorPlans:  "https://example.com/floorplans/hq.pdf",
 			Description: "Main headquarters building",
 			IsActive:    true,
+			Latitude:    floatPtr(1.3778),
+			Longitude:   floatPtr(103.8486),
 		},
 		{
 			Name:        "Jurong Substation",
@@ -133,6 +201,8 @@ func SeedData() error {
 			FloorPlans:  "https://example.com/floorplans/jurong.pdf",
 			Description: "Power grid substation",
 			IsActive:    true,
+			Latitude:    floatPtr(1.3457),
+			Longitude:   floatPtr(103.6899),
 		},
 		{
 			Name:        "Woodlands Substation",
@@ -141,6 +211,8 @@ func SeedData() error {
 			FloorPlans:  "https://example.com/floorplans/woodlands.pdf",
 			Description: "Power grid substation",
 			IsActive:    true,
+			Latitude:    floatPtr(1.4343),
+			Longitude:   floatPtr(103.7862),
 		},
 	}
 
@@ -163,6 +235,11 @@ func SeedData() error {
 			StreamURL: "rtsp://camera1.example.com/stream1",
 			Status:    models.CameraStatusActive,
 			PremiseID: premises[0].ID, // ST Engineering HQ
+
+			PTZSupported:     true,
+			PresetsSupported: true,
+			ONVIFAddress:     "http://camera1.example.com/onvif/ptz_service",
+			ONVIFProfile:     "Profile_1",
 		},
 		{
 			Name:      "Parking Lot",
@@ -184,6 +261,12 @@ func SeedData() error {
 			StreamURL: "rtsp://camera4.example.com/stream4",
 			Status:    models.CameraStatusActive,
 			PremiseID: premises[1].ID, // Jurong Substation
+
+			PTZSupported:     true,
+			PresetsSupported: true,
+			AudioSupported:   true,
+			ONVIFAddress:     "http://camera4.example.com/onvif/ptz_service",
+			ONVIFProfile:     "Profile_1",
 		},
 		{
 			Name:      "Control Room",
@@ -228,10 +311,105 @@ func SeedData() error {
 		}
 	}
 
+	// Canned chat replies
+	quickReplies := []models.QuickReply{
+		{Text: "On my way", Role: models.RoleSecurityGuard, SortOrder: 1},
+		{Text: "Arrived on scene", Role: models.RoleSecurityGuard, SortOrder: 2},
+		{Text: "Need backup", Role: models.RoleSecurityGuard, SortOrder: 3},
+		{Text: "All clear", Role: models.RoleSecurityGuard, SortOrder: 4},
+		{Text: "Acknowledged", SortOrder: 5},
+		{Text: "Please send a photo", Role: models.RoleSCSOperator, SortOrder: 6},
+		{Text: "Hold position", Role: models.RoleSCSOperator, SortOrder: 7},
+	}
+	if err := DB.Create(&quickReplies).Error; err != nil {
+		return fmt.Errorf("failed to create quick replies: %w", err)
+	}
+
+	// Evening patrol of HQ for guard1
+	hqRoute := models.PatrolRoute{
+		PremiseID:   premises[0].ID,
+		Name:        "HQ perimeter",
+		Description: "Front gate, car park and loading bay",
+		GuardID:     &guards[0].ID,
+		StartTimes:  pq.StringArray{"20:00", "02:00"},
+		Timezone:    "Asia/Singapore",
+		IsActive:    true,
+		Checkpoints: []models.PatrolCheckpoint{
+			{Sequence: 1, Name: "Front gate", TagCode: "HQ-CP-01", TagType: models.TagTypeQR, ExpectedOffsetMinutes: 0, ToleranceMinutes: 5},
+			{Sequence: 2, Name: "Underground car park", TagCode: "HQ-CP-02", TagType: models.TagTypeNFC, ExpectedOffsetMinutes: 15, ToleranceMinutes: 5},
+			{Sequence: 3, Name: "Loading bay", TagCode: "HQ-CP-03", TagType: models.TagTypeQR, ExpectedOffsetMinutes: 30, ToleranceMinutes: 10},
+		},
+	}
+	if err := DB.Create(&hqRoute).Error; err != nil {
+		return fmt.Errorf("failed to create patrol route: %w", err)
+	}
+
+	// Standard operating procedures, most specific match wins
+	sopTemplates := []models.SOPTemplate{
+		{
+			Name:        "General alert response",
+			Description: "Fallback procedure for any alert",
+			IsActive:    true,
+			Steps: []models.SOPStep{
+				{Sequence: 1, Title: "Acknowledge dispatch", Mandatory: true},
+				{Sequence: 2, Title: "Arrive on scene", Instructions: "Report your arrival in the incident chat", Mandatory: true},
+				{Sequence: 3, Title: "Assess and report", Instructions: "Describe what you found", Mandatory: true},
+			},
+		},
+		{
+			Name:        "Unauthorized access",
+			Description: "Intruder or forced entry",
+			AlertType:   models.AlertTypeUnauthorizedAccess,
+			IsActive:    true,
+			Steps: []models.SOPStep{
+				{Sequence: 1, Title: "Secure the entry point", Mandatory: true},
+				{Sequence: 2, Title: "Sweep the area", Instructions: "Check adjoining rooms and exits", Mandatory: true},
+				{Sequence: 3, Title: "Photograph the entry point", Mandatory: true, RequiresPhoto: true},
+				{Sequence: 4, Title: "Notify police if anyone is found", Instructions: "Call 999 and keep a safe distance"},
+			},
+		},
+		{
+			Name:        "Substation equipment damage",
+			Description: "Damage to equipment at a substation",
+			AlertType:   models.AlertTypeEquipmentDamage,
+			PremiseType: models.PremiseTypeSubstation,
+			IsActive:    true,
+			Steps: []models.SOPStep{
+				{Sequence: 1, Title: "Do not touch exposed equipment", Instructions: "Keep a safe distance from live parts", Mandatory: true},
+				{Sequence: 2, Title: "Photograph the damage", Mandatory: true, RequiresPhoto: true},
+				{Sequence: 3, Title: "Call the grid control room", Mandatory: true},
+				{Sequence: 4, Title: "Cordon off the area"},
+			},
+		},
+	}
+	if err := DB.Create(&sopTemplates).Error; err != nil {
+		return fmt.Errorf("failed to create SOP templates: %w", err)
+	}
+
+	// Weekly security summary for the HQ client, Monday morning local time.
+	// The scheduler sets the first run.
+	weeklySummary := models.ReportSchedule{
+		Name:       "HQ weekly security summary",
+		Kind:       models.ReportKindPremiseSummary,
+		Format:     models.ReportFormatPDF,
+		PremiseID:  &premises[0].ID,
+		Cron:       "0 7 * * MON",
+		Timezone:   "Asia/Singapore",
+		Recipients: pq.StringArray{"facilities@st-engineering.com"},
+		IsActive:   true,
+	}
+	if err := DB.Create(&weeklySummary).Error; err != nil {
+		return fmt.Errorf("failed to create report schedule: %w", err)
+	}
+
 	log.Println("Database seeding completed successfully")
 	return nil
 }
 
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
 // GetDB returns the database instance
 func GetDB() *gorm.DB {
 	return DB
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"smart-city-surveillance/internal/handlers/dto"
@@ -25,35 +26,45 @@ func NewAlertHandler(service services.AlertsService) *AlertHandler {
 
 // GetAlerts godoc
 // @Summary Get alerts
-// @Description Get all alerts with optional filters
+// @Description List alerts a page at a time, newest first. Filters take comma separated values; sort keys are created_at, updated_at, severity, status, type and title.
 // @Tags alerts
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, updated_at, severity, status, type and title, - for descending (e.g. -severity,created_at)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: camera, premise, assigned_guard, zone, incident, guard"
 // @Param status query string false "Filter by status"
 // @Param severity query string false "Filter by severity"
 // @Param type query string false "Filter by type"
 // @Param premise_id query string false "Filter by premise ID"
+// @Param camera_id query string false "Filter by camera ID"
+// @Param zone_id query string false "Filter by zone ID"
+// @Param assigned_guard_id query string false "Filter by assigned guard ID"
 // @Success 200 {array} models.Alert
+// @Failure 400 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/alerts [get]
 func (h *AlertHandler) GetAlerts(c *gin.Context) {
-	filters := services.AlertsFilter{
-		Status:    c.Query("status"),
-		Severity:  c.Query("severity"),
-		Type:      c.Query("type"),
-		PremiseID: c.Query("premise_id"),
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
 	}
 
 	role, _ := c.Get("role")
 	userID := c.GetString("user_id")
 
-	alerts, err := h.service.GetAlerts(c.Request.Context(), filters, role.(models.UserRole), userID)
+	page, err := h.service.GetAlerts(c.Request.Context(), q, role.(models.UserRole), userID)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+		listError(c, err, "Internal Server")
 		return
 	}
-	response.Success(c, http.StatusOK, alerts)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 }
 
 // GetAlert godoc
@@ -97,8 +108,9 @@ func (h *AlertHandler) GetAlert(c *gin.Context) {
 func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
 	id := c.Param("id")
 	role, _ := c.Get("role")
+	userID := c.GetString("user_id")
 
-	alert, err := h.service.AcknowledgeAlert(c.Request.Context(), id, role.(models.UserRole))
+	alert, err := h.service.AcknowledgeAlert(c.Request.Context(), id, role.(models.UserRole), userID)
 	if err != nil {
 		if err.Error() == "permission denied" {
 			response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
@@ -112,7 +124,7 @@ func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
 
 // AssignAlert godoc
 // @Summary Assign alert to guard
-// @Description Assign an alert to a security guard (SCS Operator only)
+// @Description Assign an alert to a security guard (SCS Operator only). Refused once an incident of the alert has a finalized report.
 // @Tags alerts
 // @Accept json
 // @Produce json
@@ -122,6 +134,7 @@ func (h *AlertHandler) AcknowledgeAlert(c *gin.Context) {
 // @Failure 400 {object} response.ApiResponse
 // @Failure 403 {object} response.ApiResponse
 // @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/alerts/{id}/assign [post]
@@ -134,6 +147,10 @@ func (h *AlertHandler) AssignAlert(c *gin.Context) {
 	}
 
 	alert, incident, err := h.service.AssignAlert(c.Request.Context(), id, req.GuardID)
+	if errors.Is(err, services.ErrIncidentReportLocked) {
+		response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+		return
+	}
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
 		return
@@ -146,12 +163,13 @@ func (h *AlertHandler) AssignAlert(c *gin.Context) {
 
 // CreateAlert godoc
 // @Summary Create alert
-// @Description Create a new alert (testing/demo)
+// @Description Create a new alert (testing/demo). An alert covered by a maintenance window is recorded as suppressed instead and returned with 202.
 // @Tags alerts
 // @Accept json
 // @Produce json
 // @Param payload body dto.CreateAlertRequest true "Create alert payload"
 // @Success 201 {object} models.Alert
+// @Success 202 {object} models.SuppressedAlert
 // @Failure 400 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
@@ -164,6 +182,11 @@ func (h *AlertHandler) CreateAlert(c *gin.Context) {
 	}
 
 	created, err := h.service.CreateAlert(c.Request.Context(), alert)
+	var suppressed *services.AlertSuppressedError
+	if errors.As(err, &suppressed) {
+		response.Success(c, http.StatusAccepted, suppressed.Suppressed)
+		return
+	}
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, "Failed to create alert", err)
 		return
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AnalyticsHandler serves operations metrics
+type AnalyticsHandler struct {
+	service services.AnalyticsService
+}
+
+func NewAnalyticsHandler(service services.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{service: service}
+}
+
+// GetResponseTimes godoc
+// @Summary Response times
+// @Description Mean time to acknowledge, assign, arrive and resolve, per bucket and overall (SCS Operator). Acknowledge, assign and resolve are from the alert being raised; arrive is from dispatch to the first arrival update.
+// @Tags analytics
+// @Produce json
+// @Param from query string false "Start (RFC 3339, default 30 days before to)"
+// @Param to query string false "End, exclusive (RFC 3339, default now)"
+// @Param bucket query string false "day, week or month (default day)"
+// @Param tz query string false "IANA timezone buckets are cut in (default UTC)"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Success 200 {object} services.ResponseTimesReport
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/analytics/response-times [get]
+func (h *AnalyticsHandler) GetResponseTimes(c *gin.Context) {
+	q, ok := analyticsQuery(c)
+	if !ok {
+		return
+	}
+	report, err := h.service.ResponseTimes(c.Request.Context(), q)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// GetVolumes godoc
+// @Summary Alert volumes
+// @Description Alerts raised per bucket, broken down by type, severity, premise, camera or hour of day (SCS Operator)
+// @Tags analytics
+// @Produce json
+// @Param group_by query string false "type, severity, premise, camera or hour (default type)"
+// @Param from query string false "Start (RFC 3339, default 30 days before to)"
+// @Param to query string false "End, exclusive (RFC 3339, default now)"
+// @Param bucket query string false "day, week or month (default day)"
+// @Param tz query string false "IANA timezone buckets and hours are in (default UTC)"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Success 200 {object} services.VolumeReport
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/analytics/volumes [get]
+func (h *AnalyticsHandler) GetVolumes(c *gin.Context) {
+	q, ok := analyticsQuery(c)
+	if !ok {
+		return
+	}
+	report, err := h.service.Volumes(c.Request.Context(), q, c.Query("group_by"))
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// GetFalseAlarms godoc
+// @Summary False-alarm rate
+// @Description Alerts marked false_alarm as a share of the alerts closed out, per bucket and overall (SCS Operator)
+// @Tags analytics
+// @Produce json
+// @Param from query string false "Start (RFC 3339, default 30 days before to)"
+// @Param to query string false "End, exclusive (RFC 3339, default now)"
+// @Param bucket query string false "day, week or month (default day)"
+// @Param tz query string false "IANA timezone buckets are cut in (default UTC)"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Success 200 {object} services.FalseAlarmReport
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/analytics/false-alarms [get]
+func (h *AnalyticsHandler) GetFalseAlarms(c *gin.Context) {
+	q, ok := analyticsQuery(c)
+	if !ok {
+		return
+	}
+	report, err := h.service.FalseAlarms(c.Request.Context(), q)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// GetGuardPerformance godoc
+// @Summary Guard performance
+// @Description Incidents dispatched to each guard in the period, how many were resolved and the guard's mean arrival and resolution times (SCS Operator)
+// @Tags analytics
+// @Produce json
+// @Param from query string false "Start (RFC 3339, default 30 days before to)"
+// @Param to query string false "End, exclusive (RFC 3339, default now)"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Success 200 {object} services.GuardPerformanceReport
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/analytics/guards [get]
+func (h *AnalyticsHandler) GetGuardPerformance(c *gin.Context) {
+	q, ok := analyticsQuery(c)
+	if !ok {
+		return
+	}
+	report, err := h.service.GuardPerformance(c.Request.Context(), q)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// analyticsQuery reads the period parameters, responding 400 when they are invalid
+func analyticsQuery(c *gin.Context) (services.AnalyticsQuery, bool) {
+	q := services.AnalyticsQuery{
+		Bucket:   c.Query("bucket"),
+		Timezone: c.Query("tz"),
+	}
+	for _, name := range []string{"from", "to"} {
+		t, err := queryTime(c, name)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", err)
+			return q, false
+		}
+		if t != nil && name == "from" {
+			q.From = *t
+		} else if t != nil {
+			q.To = *t
+		}
+	}
+	for _, raw := range splitList(c.QueryArray("premise_id")) {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", errors.New("premise_id must be UUIDs"))
+			return q, false
+		}
+		q.PremiseIDs = append(q.PremiseIDs, id)
+	}
+	return q, true
+}
+
+func analyticsError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidAnalyticsQuery) {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ArmingHandler handles arming schedules, holiday calendars, manual arming
+// and the policy for alerts from disarmed areas
+type ArmingHandler struct {
+	service services.ArmingService
+}
+
+func NewArmingHandler(service services.ArmingService) *ArmingHandler {
+	return &ArmingHandler{service: service}
+}
+
+// GetState godoc
+// @Summary Get arming state
+// @Description Whether a premise and each of its zones is armed, and why: override (armed or disarmed by hand), holiday, schedule or default (no schedule, always armed) (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param premise_id query string true "Premise ID"
+// @Param at query string false "RFC 3339 time to evaluate at (default now)"
+// @Success 200 {object} services.PremiseArmingState
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/state [get]
+func (h *ArmingHandler) GetState(c *gin.Context) {
+	premiseID, err := uuid.Parse(c.Query("premise_id"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "premise_id is required", err)
+		return
+	}
+	at := time.Now()
+	if raw := c.Query("at"); raw != "" {
+		if at, err = time.Parse(time.RFC3339, raw); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", err)
+			return
+		}
+	}
+	state, err := h.service.GetState(c.Request.Context(), premiseID, at)
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, state)
+}
+
+// Arm godoc
+// @Summary Arm area
+// @Description Arm a premise, or one zone of it, over its schedule until the given time or until resumed (SCS Operator). Audited and published to the premise topic as arming_changed.
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param payload body dto.ArmRequest true "Area"
+// @Success 200 {object} services.AreaState
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/arm [post]
+func (h *ArmingHandler) Arm(c *gin.Context) {
+	h.setArmed(c, true)
+}
+
+// Disarm godoc
+// @Summary Disarm area
+// @Description Disarm a premise, or one zone of it, over its schedule until the given time or until resumed (SCS Operator). Audited and published to the premise topic as arming_changed.
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param payload body dto.ArmRequest true "Area"
+// @Success 200 {object} services.AreaState
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/disarm [post]
+func (h *ArmingHandler) Disarm(c *gin.Context) {
+	h.setArmed(c, false)
+}
+
+func (h *ArmingHandler) setArmed(c *gin.Context, armed bool) {
+	var req dto.ArmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	input := services.ArmInput{
+		PremiseID: uuid.MustParse(req.PremiseID),
+		ZoneID:    optionalUUID(req.ZoneID),
+		Until:     req.Until,
+		Reason:    req.Reason,
+	}
+	state, err := h.service.SetArmed(c.Request.Context(), input, armed, c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, state)
+}
+
+// Resume godoc
+// @Summary Resume arming schedule
+// @Description Clear the manual arming of a premise, or one zone of it, handing it back to its schedule (SCS Operator)
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param payload body dto.ResumeArmingRequest true "Area"
+// @Success 200 {object} services.AreaState
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/resume [post]
+func (h *ArmingHandler) Resume(c *gin.Context) {
+	var req dto.ResumeArmingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	state, err := h.service.Resume(c.Request.Context(), uuid.MustParse(req.PremiseID), optionalUUID(req.ZoneID), c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, state)
+}
+
+// GetOverrides godoc
+// @Summary Get manual arming history
+// @Description Manual arm and disarm actions, newest first (SCS Operator). Filters: premise_id, zone_id, armed; expand=created_by.
+// @Tags arming
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Param zone_id query string false "Comma separated zone IDs"
+// @Param armed query bool false "Arm (true) or disarm (false) actions"
+// @Param expand query string false "created_by"
+// @Success 200 {array} models.ArmingOverride
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/overrides [get]
+func (h *ArmingHandler) GetOverrides(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.ListOverrides(c.Request.Context(), q)
+	if err != nil {
+		listError(c, err, "Failed to fetch arming history")
+		return
+	}
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
+}
+
+// GetSchedules godoc
+// @Summary Get arming schedules
+// @Description List arming schedules with their disarmed periods (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param premise_id query string false "Premise ID"
+// @Success 200 {array} models.ArmingSchedule
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/schedules [get]
+func (h *ArmingHandler) GetSchedules(c *gin.Context) {
+	var premiseID *uuid.UUID
+	if raw := c.Query("premise_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", err)
+			return
+		}
+		premiseID = &id
+	}
+	schedules, err := h.service.ListSchedules(c.Request.Context(), premiseID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch arming schedules", err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedules)
+}
+
+// GetSchedule godoc
+// @Summary Get arming schedule
+// @Description Get an arming schedule with its periods and holiday calendar (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.ArmingSchedule
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/schedules/{id} [get]
+func (h *ArmingHandler) GetSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Arming schedule not found", err)
+		return
+	}
+	schedule, err := h.service.GetSchedule(c.Request.Context(), id)
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedule)
+}
+
+// CreateSchedule godoc
+// @Summary Create arming schedule
+// @Description Schedule when a premise, or one zone of it, is disarmed (SCS Operator). The area is disarmed during each period in timezone, armed the rest of the time and all day on the holidays of its calendar. A zone's schedule takes precedence over its premise's; each area has at most one.
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param payload body dto.ArmingScheduleRequest true "Schedule"
+// @Success 201 {object} models.ArmingSchedule
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/schedules [post]
+func (h *ArmingHandler) CreateSchedule(c *gin.Context) {
+	var req dto.ArmingScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	schedule, err := h.service.CreateSchedule(c.Request.Context(), armingScheduleInput(req), c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, schedule)
+}
+
+// UpdateSchedule godoc
+// @Summary Update arming schedule
+// @Description Replace an arming schedule and its periods (SCS Operator)
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param payload body dto.ArmingScheduleRequest true "Schedule"
+// @Success 200 {object} models.ArmingSchedule
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/schedules/{id} [put]
+func (h *ArmingHandler) UpdateSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Arming schedule not found", err)
+		return
+	}
+	var req dto.ArmingScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	schedule, err := h.service.UpdateSchedule(c.Request.Context(), id, armingScheduleInput(req), c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedule)
+}
+
+// DeleteSchedule godoc
+// @Summary Delete arming schedule
+// @Description Delete an arming schedule; the area falls back to its premise's schedule, or is always armed (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/schedules/{id} [delete]
+func (h *ArmingHandler) DeleteSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Arming schedule not found", err)
+		return
+	}
+	if err := h.service.DeleteSchedule(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// GetCalendars godoc
+// @Summary Get holiday calendars
+// @Description List holiday calendars with their holidays (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Success 200 {array} models.HolidayCalendar
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/calendars [get]
+func (h *ArmingHandler) GetCalendars(c *gin.Context) {
+	calendars, err := h.service.ListCalendars(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch holiday calendars", err)
+		return
+	}
+	response.Success(c, http.StatusOK, calendars)
+}
+
+// GetCalendar godoc
+// @Summary Get holiday calendar
+// @Description Get a holiday calendar with its holidays (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param id path string true "Calendar ID"
+// @Success 200 {object} models.HolidayCalendar
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/calendars/{id} [get]
+func (h *ArmingHandler) GetCalendar(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Holiday calendar not found", err)
+		return
+	}
+	calendar, err := h.service.GetCalendar(c.Request.Context(), id)
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, calendar)
+}
+
+// CreateCalendar godoc
+// @Summary Create holiday calendar
+// @Description Create a holiday calendar (SCS Operator). Areas whose schedule uses it stay armed all day on its holidays.
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param payload body dto.HolidayCalendarRequest true "Calendar"
+// @Success 201 {object} models.HolidayCalendar
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/calendars [post]
+func (h *ArmingHandler) CreateCalendar(c *gin.Context) {
+	var req dto.HolidayCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	calendar, err := h.service.CreateCalendar(c.Request.Context(), holidayCalendarInput(req), c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, calendar)
+}
+
+// UpdateCalendar godoc
+// @Summary Update holiday calendar
+// @Description Replace a holiday calendar and its holidays (SCS Operator)
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param id path string true "Calendar ID"
+// @Param payload body dto.HolidayCalendarRequest true "Calendar"
+// @Success 200 {object} models.HolidayCalendar
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/calendars/{id} [put]
+func (h *ArmingHandler) UpdateCalendar(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Holiday calendar not found", err)
+		return
+	}
+	var req dto.HolidayCalendarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	calendar, err := h.service.UpdateCalendar(c.Request.Context(), id, holidayCalendarInput(req), c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, calendar)
+}
+
+// DeleteCalendar godoc
+// @Summary Delete holiday calendar
+// @Description Delete a holiday calendar; schedules using it keep running without holidays (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param id path string true "Calendar ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/calendars/{id} [delete]
+func (h *ArmingHandler) DeleteCalendar(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Holiday calendar not found", err)
+		return
+	}
+	if err := h.service.DeleteCalendar(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// GetPolicies godoc
+// @Summary Get arming policies
+// @Description What happens to alerts of each type raised in a disarmed area (SCS Operator). Types without a policy are raised as usual.
+// @Tags arming
+// @Produce json
+// @Success 200 {array} models.ArmingPolicy
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/policies [get]
+func (h *ArmingHandler) GetPolicies(c *gin.Context) {
+	policies, err := h.service.ListPolicies(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch arming policies", err)
+		return
+	}
+	response.Success(c, http.StatusOK, policies)
+}
+
+// SetPolicy godoc
+// @Summary Set arming policy
+// @Description Set what happens to alerts of a type raised in a disarmed area (SCS Operator): raise as usual, downgrade to the given severity, or discard (recorded as a suppressed alert with cause disarmed). Guard distress and missed check-in alerts are always raised.
+// @Tags arming
+// @Accept json
+// @Produce json
+// @Param type path string true "Alert type"
+// @Param payload body dto.ArmingPolicyRequest true "Policy"
+// @Success 200 {object} models.ArmingPolicy
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/policies/{type} [put]
+func (h *ArmingHandler) SetPolicy(c *gin.Context) {
+	var req dto.ArmingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	input := services.ArmingPolicyInput{Action: models.ArmingPolicyAction(req.Action), Severity: models.AlertSeverity(req.Severity)}
+	policy, err := h.service.SetPolicy(c.Request.Context(), models.AlertType(c.Param("type")), input, c.GetString("user_id"))
+	if err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, policy)
+}
+
+// DeletePolicy godoc
+// @Summary Delete arming policy
+// @Description Remove the policy for an alert type, so its alerts are raised as usual (SCS Operator)
+// @Tags arming
+// @Produce json
+// @Param type path string true "Alert type"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/arming/policies/{type} [delete]
+func (h *ArmingHandler) DeletePolicy(c *gin.Context) {
+	if err := h.service.DeletePolicy(c.Request.Context(), models.AlertType(c.Param("type")), c.GetString("user_id")); err != nil {
+		armingError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+func armingScheduleInput(req dto.ArmingScheduleRequest) services.ArmingScheduleInput {
+	input := services.ArmingScheduleInput{
+		Name:              req.Name,
+		PremiseID:         uuid.MustParse(req.PremiseID),
+		ZoneID:            optionalUUID(req.ZoneID),
+		Timezone:          req.Timezone,
+		HolidayCalendarID: optionalUUID(req.HolidayCalendarID),
+	}
+	for _, period := range req.Periods {
+		input.Periods = append(input.Periods, services.ArmingPeriodInput{
+			Weekdays: period.Weekdays,
+			DisarmAt: period.DisarmAt,
+			ArmAt:    period.ArmAt,
+		})
+	}
+	return input
+}
+
+func holidayCalendarInput(req dto.HolidayCalendarRequest) services.HolidayCalendarInput {
+	input := services.HolidayCalendarInput{Name: req.Name}
+	for _, holiday := range req.Holidays {
+		input.Holidays = append(input.Holidays, services.HolidayInput{Date: holiday.Date, Name: holiday.Name})
+	}
+	return input
+}
+
+func armingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidArming):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
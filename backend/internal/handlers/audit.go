@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler exposes the audit log
+type AuditHandler struct {
+	service services.AuditService
+}
+
+func NewAuditHandler(service services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// GetAuditLogs godoc
+// @Summary Get audit log
+// @Description List audit entries, newest first (SCS Operator only)
+// @Tags audit
+// @Produce json
+// @Param actor_id query string false "Filter by actor"
+// @Param action query string false "Filter by action"
+// @Param resource_type query string false "Filter by resource type"
+// @Param resource_id query string false "Filter by resource ID"
+// @Param limit query int false "Max entries (default 100)"
+// @Success 200 {array} models.AuditLog
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/audit-logs [get]
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	entries, err := h.service.List(c.Request.Context(), services.AuditFilter{
+		ActorID:      c.Query("actor_id"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		Limit:        limit,
+	})
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch audit log", err)
+		return
+	}
+	response.Success(c, http.StatusOK, entries)
+}
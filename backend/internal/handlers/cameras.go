@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"smart-city-surveillance/internal/handlers/dto"
 	"smart-city-surveillance/internal/models"
 	"smart-city-surveillance/internal/services"
 	"smart-city-surveillance/pkg/response"
@@ -12,20 +13,34 @@ import (
 
 // CameraHandler handles camera-related endpoints
 type CameraHandler struct {
-	service services.CameraService
+	service   services.CameraService
+	snapshots services.SnapshotService
 }
 
-func NewCameraHandler(service services.CameraService) *CameraHandler {
-	return &CameraHandler{service: service}
+func NewCameraHandler(service services.CameraService, snapshots services.SnapshotService) *CameraHandler {
+	return &CameraHandler{service: service, snapshots: snapshots}
 }
 
 // GetCameras godoc
 // @Summary Get all cameras
-// @Description Get a list of all cameras (SCS Operator only)
+// @Description List cameras a page at a time, by name (SCS Operator only). Filters take comma separated values; sort keys are created_at, updated_at, name and status.
 // @Tags cameras
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, updated_at, name and status, - for descending (e.g. status,name)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: premise, guards"
+// @Param status query string false "Filter by status"
+// @Param premise_id query string false "Filter by premise ID"
+// @Param zone_id query string false "Filter by zone ID"
+// @Param floor_plan_id query string false "Filter by floor plan ID"
+// @Param ptz_supported query bool false "Filter by PTZ support"
 // @Success 200 {array} models.Camera
+// @Failure 400 {object} response.ApiResponse
 // @Failure 403 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
@@ -36,17 +51,18 @@ func (h *CameraHandler) GetCameras(c *gin.Context) {
 		response.Error(c, http.StatusUnauthorized, "Role not found", nil)
 		return
 	}
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
 
-	cameras, err := h.service.GetAll(c.Request.Context(), role.(models.UserRole))
+	page, err := h.service.GetAll(c.Request.Context(), q, role.(models.UserRole))
 	if err != nil {
-		if err.Error() == "permission denied" {
-			response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
-			return
-		}
-		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+		listError(c, err, "Internal Server")
 		return
 	}
-	response.Success(c, http.StatusOK, cameras)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 }
 
 // GetCamera godoc
@@ -87,9 +103,43 @@ func (h *CameraHandler) GetCamera(c *gin.Context) {
 	response.Success(c, http.StatusOK, camera)
 }
 
+// GetCameraSnapshot godoc
+// @Summary Get camera snapshot
+// @Description Grab a still frame from the camera stream (SCS Operator or assigned Security Guard)
+// @Tags cameras
+// @Produce image/jpeg
+// @Param id path string true "Camera ID"
+// @Success 200 {file} binary
+// @Failure 404 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/snapshot [get]
+func (h *CameraHandler) GetCameraSnapshot(c *gin.Context) {
+	role, exists := c.Get("role")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "Role not found", nil)
+		return
+	}
+	userID := c.GetString("user_id")
+
+	camera, err := h.service.GetByID(c.Request.Context(), c.Param("id"), userID, role.(models.UserRole))
+	if err != nil || camera == nil {
+		response.Error(c, http.StatusNotFound, "Camera not found", err)
+		return
+	}
+
+	data, err := h.snapshots.CaptureCamera(c.Request.Context(), camera)
+	if err != nil {
+		response.Error(c, http.StatusBadGateway, "Failed to capture snapshot", err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
+
 // UpdateCameraStatus godoc
 // @Summary Update camera status
-// @Description Update the status of a camera (SCS Operator only)
+// @Description Update the status of a camera (SCS Operator only). Setting maintenance opens a maintenance window suppressing the camera's alerts unless open_maintenance_window is false; another status ends it.
 // @Tags cameras
 // @Accept json
 // @Produce json
@@ -108,9 +158,7 @@ func (h *CameraHandler) UpdateCameraStatus(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Status string `json:"status" binding:"required,oneof=active inactive maintenance"`
-	}
+	var req dto.UpdateStatusRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, http.StatusBadRequest, "Internal Server",err)
@@ -118,7 +166,12 @@ func (h *CameraHandler) UpdateCameraStatus(c *gin.Context) {
 	}
 
 	id := c.Param("id")
-	err := h.service.UpdateStatus(c.Request.Context(), id, models.CameraStatus(req.Status), role.(models.UserRole))
+	maintenance := services.CameraMaintenance{
+		OpenWindow:      req.OpenMaintenanceWindow,
+		DurationMinutes: req.WindowMinutes,
+		Reason:          req.Reason,
+	}
+	err := h.service.UpdateStatus(c.Request.Context(), id, models.CameraStatus(req.Status), maintenance, role.(models.UserRole), c.GetString("user_id"))
 	if err != nil {
 		if err.Error() == "permission denied" {
 			response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
@@ -130,6 +183,53 @@ func (h *CameraHandler) UpdateCameraStatus(c *gin.Context) {
 	response.Success(c, http.StatusOK, nil )
 }
 
+// UpdateCameraCapabilities godoc
+// @Summary Update camera capabilities
+// @Description Update PTZ/preset/audio capabilities and ONVIF settings of a camera (SCS Operator only)
+// @Tags cameras
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.UpdateCapabilitiesRequest true "Capabilities"
+// @Success 200 {object} models.Camera
+// @Failure 400 {object} response.ApiResponse
+// @Failure 403 {object} response.ApiResponse
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/capabilities [put]
+func (h *CameraHandler) UpdateCameraCapabilities(c *gin.Context) {
+	role, exists := c.Get("role")
+	if !exists {
+		response.Error(c, http.StatusUnauthorized, "Role not found", nil)
+		return
+	}
+
+	var req dto.UpdateCapabilitiesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	camera, err := h.service.UpdateCapabilities(c.Request.Context(), c.Param("id"), services.CameraCapabilities{
+		PTZSupported:     req.PTZSupported,
+		PresetsSupported: req.PresetsSupported,
+		AudioSupported:   req.AudioSupported,
+		ONVIFAddress:     req.ONVIFAddress,
+		ONVIFProfile:     req.ONVIFProfile,
+		ONVIFUsername:    req.ONVIFUsername,
+		ONVIFPassword:    req.ONVIFPassword,
+	}, role.(models.UserRole))
+	if err != nil {
+		if err.Error() == "permission denied" {
+			response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+		return
+	}
+	response.Success(c, http.StatusOK, camera)
+}
+
 // GetCamerasByPremise godoc
 // @Summary Get cameras by premise ID
 // @Description Get cameras under a premise (SCS Operator only)
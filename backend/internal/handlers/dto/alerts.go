@@ -4,7 +4,7 @@ type AssignAlertRequest struct {
 	GuardID []string `json:"guard_id" binding:"required"`
 }
 type UpdateAlertStatusRequest struct {
-	Status string `json:"status" binding:"required,oneof=pending acknowledged assigned resolved closed"`
+	Status string `json:"status" binding:"required,oneof=pending acknowledged assigned resolved closed false_alarm"`
 
 }
 
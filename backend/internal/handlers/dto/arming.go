@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+// ArmingScheduleRequest creates or replaces the arming schedule of a premise,
+// or of one zone of it
+type ArmingScheduleRequest struct {
+	Name              string                `json:"name" binding:"required,max=200"`
+	PremiseID         string                `json:"premise_id" binding:"required,uuid"`
+	ZoneID            *string               `json:"zone_id,omitempty" binding:"omitempty,uuid"`    // omit for the whole premise
+	Timezone          string                `json:"timezone,omitempty" example:"Asia/Ho_Chi_Minh"` // defaults to UTC
+	HolidayCalendarID *string               `json:"holiday_calendar_id,omitempty" binding:"omitempty,uuid"`
+	Periods           []ArmingPeriodRequest `json:"periods" binding:"max=50,dive"`
+}
+
+// ArmingPeriodRequest disarms from disarm_at to arm_at on each weekday; an
+// arm_at not after disarm_at runs past midnight
+type ArmingPeriodRequest struct {
+	Weekdays []string `json:"weekdays" binding:"required,min=1,max=7,dive,oneof=mon tue wed thu fri sat sun" example:"mon,tue,wed,thu,fri"`
+	DisarmAt string   `json:"disarm_at" binding:"required" example:"08:00"`
+	ArmAt    string   `json:"arm_at" binding:"required" example:"18:00"`
+}
+
+type HolidayCalendarRequest struct {
+	Name     string           `json:"name" binding:"required,max=200"`
+	Holidays []HolidayRequest `json:"holidays" binding:"max=500,dive"`
+}
+
+type HolidayRequest struct {
+	Date string `json:"date" binding:"required" example:"2026-09-02"`
+	Name string `json:"name,omitempty" binding:"max=200" example:"National Day"`
+}
+
+type ArmingPolicyRequest struct {
+	Action   string `json:"action" binding:"required,oneof=raise downgrade discard"`
+	Severity string `json:"severity,omitempty" binding:"omitempty,oneof=low medium high critical"` // what downgrade lowers alerts to
+}
+
+// ArmRequest arms or disarms a premise, or one zone of it, by hand
+type ArmRequest struct {
+	PremiseID string     `json:"premise_id" binding:"required,uuid"`
+	ZoneID    *string    `json:"zone_id,omitempty" binding:"omitempty,uuid"`
+	Until     *time.Time `json:"until,omitempty"` // until resumed when omitted
+	Reason    string     `json:"reason,omitempty" binding:"max=500"`
+}
+
+// ResumeArmingRequest hands an area back to its schedule
+type ResumeArmingRequest struct {
+	PremiseID string  `json:"premise_id" binding:"required,uuid"`
+	ZoneID    *string `json:"zone_id,omitempty" binding:"omitempty,uuid"`
+}
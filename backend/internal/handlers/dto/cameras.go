@@ -1,4 +1,35 @@
 package dto
 type UpdateStatusRequest struct {
     Status string `json:"status" binding:"required,oneof=active inactive maintenance"`
+	// With status maintenance: whether to open a maintenance window for the
+	// camera (server default when omitted) and for how long (0 until the
+	// camera is back in service)
+	OpenMaintenanceWindow *bool  `json:"open_maintenance_window,omitempty"`
+	WindowMinutes         *int   `json:"window_minutes,omitempty" binding:"omitempty,min=0,max=10080"`
+	Reason                string `json:"reason,omitempty" binding:"max=500"`
+}
+
+type UpdateCapabilitiesRequest struct {
+	PTZSupported     bool   `json:"ptz_supported"`
+	PresetsSupported bool   `json:"presets_supported"`
+	AudioSupported   bool   `json:"audio_supported"`
+	ONVIFAddress     string `json:"onvif_address" binding:"omitempty,url"`
+	ONVIFProfile     string `json:"onvif_profile"`
+	ONVIFUsername    string `json:"onvif_username"`
+	ONVIFPassword    string `json:"onvif_password"`
+}
+
+type PTZMoveRequest struct {
+	Pan        float64 `json:"pan" binding:"min=-1,max=1"`
+	Tilt       float64 `json:"tilt" binding:"min=-1,max=1"`
+	DurationMs int     `json:"duration_ms" binding:"omitempty,min=100,max=5000"`
+}
+
+type PTZZoomRequest struct {
+	Zoom       float64 `json:"zoom" binding:"required,min=-1,max=1"`
+	DurationMs int     `json:"duration_ms" binding:"omitempty,min=100,max=5000"`
+}
+
+type SavePresetRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
 }
@@ -0,0 +1,5 @@
+package dto
+
+type AckEventsRequest struct {
+	Seq uint64 `json:"seq" binding:"required"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+import "smart-city-surveillance/internal/models"
+
+type ZoneRequest struct {
+	Name    string         `json:"name" binding:"required"`
+	Polygon models.Polygon `json:"polygon" binding:"required,min=3"`
+}
+
+type PositionCameraRequest struct {
+	FloorPlanID string   `json:"floor_plan_id" binding:"required,uuid"`
+	X           *float64 `json:"x" binding:"required,min=0,max=1"`
+	Y           *float64 `json:"y" binding:"required,min=0,max=1"`
+	Heading     *float64 `json:"heading,omitempty" binding:"omitempty,min=0,max=360"`
+	FieldOfView *float64 `json:"field_of_view,omitempty" binding:"omitempty,min=1,max=360"`
+}
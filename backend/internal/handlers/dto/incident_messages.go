@@ -0,0 +1,16 @@
+package dto
+
+type SendIncidentMessageRequest struct {
+	Body         string `json:"body" form:"body" binding:"max=4000"`
+	QuickReplyID string `json:"quick_reply_id,omitempty" form:"quick_reply_id" binding:"omitempty,uuid"`
+}
+
+type MarkMessagesReadRequest struct {
+	MessageID string `json:"message_id" binding:"required,uuid"`
+}
+
+type QuickReplyRequest struct {
+	Text      string `json:"text" binding:"required,max=200"`
+	Role      string `json:"role,omitempty" binding:"omitempty,oneof=scs_operator security_guard"`
+	SortOrder int    `json:"sort_order"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+type IncidentReportRequest struct {
+	Summary         string `json:"summary,omitempty" binding:"max=10000"`
+	ResolutionNotes string `json:"resolution_notes,omitempty" binding:"max=10000"`
+	Recommendations string `json:"recommendations,omitempty" binding:"max=10000"`
+}
+
+type FinalizeIncidentReportRequest struct {
+	SignOffName  string `json:"sign_off_name" binding:"required,max=200"`
+	SignOffTitle string `json:"sign_off_title,omitempty" binding:"max=200"`
+}
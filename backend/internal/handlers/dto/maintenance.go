@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+// MaintenanceWindowRequest creates or replaces a maintenance window. Leave
+// recurrence empty for a one-off window from starts_at to ends_at.
+type MaintenanceWindowRequest struct {
+	Name            string                   `json:"name" binding:"required,max=200"`
+	Reason          string                   `json:"reason,omitempty" binding:"max=500"`
+	PremiseID       *string                  `json:"premise_id,omitempty" binding:"omitempty,uuid"` // defaults to the camera's premise
+	CameraID        *string                  `json:"camera_id,omitempty" binding:"omitempty,uuid"`  // limits the window to one camera
+	StartsAt        *time.Time               `json:"starts_at,omitempty"`                           // defaults to now
+	EndsAt          *time.Time               `json:"ends_at,omitempty"`                             // open until ended when omitted
+	Recurrence      string                   `json:"recurrence,omitempty" binding:"max=100" example:"0 22 * * SAT"`
+	DurationMinutes int                      `json:"duration_minutes,omitempty" binding:"min=0"`    // length of each occurrence of a recurring window
+	Timezone        string                   `json:"timezone,omitempty" example:"Asia/Ho_Chi_Minh"` // of recurrence; defaults to UTC
+	Rules           []SuppressionRuleRequest `json:"rules,omitempty" binding:"max=50,dive"`         // omit to suppress every alert in scope
+}
+
+// SuppressionRuleRequest matches alerts by type, severity and camera; each
+// list left empty matches anything
+type SuppressionRuleRequest struct {
+	AlertTypes []string `json:"alert_types,omitempty" binding:"max=20" example:"suspicious_activity"`
+	Severities []string `json:"severities,omitempty" binding:"max=4,dive,oneof=low medium high critical"`
+	CameraIDs  []string `json:"camera_ids,omitempty" binding:"max=200,dive,uuid"`
+}
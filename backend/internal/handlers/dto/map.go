@@ -0,0 +1,27 @@
+package dto
+
+import "time"
+
+type LocationRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+}
+
+// CameraLocationRequest sets a camera's own position; send nulls to fall
+// back to the premise position
+type CameraLocationRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+}
+
+type GuardLocationRequest struct {
+	Latitude   *float64   `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude  *float64   `json:"longitude" binding:"required,min=-180,max=180"`
+	Accuracy   *float64   `json:"accuracy,omitempty" binding:"omitempty,min=0"`
+	Heading    *float64   `json:"heading,omitempty" binding:"omitempty,min=0,max=360"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+}
+
+type DutyRequest struct {
+	OnDuty *bool `json:"on_duty" binding:"required"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+// RegisterDeviceRequest registers the app's push token for the current user
+type RegisterDeviceRequest struct {
+	Platform string `json:"platform" binding:"required,oneof=android ios"`
+	Token    string `json:"token" binding:"required,max=4096"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+type PatrolRouteRequest struct {
+	PremiseID   string                    `json:"premise_id" binding:"required,uuid"`
+	Name        string                    `json:"name" binding:"required,max=200"`
+	Description string                    `json:"description,omitempty" binding:"max=2000"`
+	GuardID     *string                   `json:"guard_id,omitempty" binding:"omitempty,uuid"`
+	StartTimes  []string                  `json:"start_times,omitempty" binding:"max=48"` // "HH:MM" in timezone
+	Timezone    string                    `json:"timezone,omitempty"`                     // IANA name, defaults to UTC
+	IsActive    *bool                     `json:"is_active,omitempty"`                    // defaults to true
+	Checkpoints []PatrolCheckpointRequest `json:"checkpoints" binding:"required,min=1,max=200,dive"`
+}
+
+type PatrolCheckpointRequest struct {
+	ID                    *string  `json:"id,omitempty" binding:"omitempty,uuid"`
+	Name                  string   `json:"name" binding:"required,max=200"`
+	TagCode               string   `json:"tag_code,omitempty" binding:"max=128"`
+	TagType               string   `json:"tag_type,omitempty" binding:"omitempty,oneof=qr nfc"`
+	ExpectedOffsetMinutes int      `json:"expected_offset_minutes" binding:"min=0,max=1440"`
+	ToleranceMinutes      int      `json:"tolerance_minutes" binding:"min=0,max=240"`
+	Latitude              *float64 `json:"latitude,omitempty" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude             *float64 `json:"longitude,omitempty" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+}
+
+type PatrolScanRequest struct {
+	TagCode   string   `json:"tag_code" binding:"required,max=128"`
+	Latitude  *float64 `json:"latitude,omitempty" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+	Accuracy  *float64 `json:"accuracy,omitempty" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,20 @@
+package dto
+
+// PreferencesRequest replaces the quiet hours and the channels of the
+// events listed. Channels map a channel (realtime, email, sms, push) to the
+// lowest severity sent on it; "" sends every severity.
+type PreferencesRequest struct {
+	Timezone          string `json:"timezone" binding:"max=64"`
+	QuietHoursEnabled bool   `json:"quiet_hours_enabled"`
+	QuietHoursStart   string `json:"quiet_hours_start" binding:"max=5"`
+	QuietHoursEnd     string `json:"quiet_hours_end" binding:"max=5"`
+	// Defaults to true
+	CriticalOverridesQuiet *bool                        `json:"critical_overrides_quiet"`
+	Events                 map[string]map[string]string `json:"events,omitempty"`
+}
+
+// EventPreferenceRequest sets the channels of one event; no channels turns
+// it off
+type EventPreferenceRequest struct {
+	Channels map[string]string `json:"channels"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type DisconnectRequest struct {
+	Reason string `json:"reason,omitempty" binding:"max=200"`
+}
@@ -0,0 +1,6 @@
+package dto
+
+type UpdateRetentionPolicyRequest struct {
+	RetentionDays      int `json:"retention_days" binding:"required,min=1,max=3650"`
+	AlertRetentionDays int `json:"alert_retention_days" binding:"omitempty,min=0,max=3650"`
+}
@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+type ReportScheduleRequest struct {
+	Name       string   `json:"name" binding:"required,max=200"`
+	Kind       string   `json:"kind" binding:"required,oneof=shift_handover premise_summary incident_report"`
+	Format     string   `json:"format" binding:"required,oneof=pdf csv"`
+	PremiseID  *string  `json:"premise_id,omitempty" binding:"omitempty,uuid"` // omit for all premises
+	Cron       string   `json:"cron" binding:"required,max=100" example:"0 7 * * MON"`
+	Timezone   string   `json:"timezone,omitempty" example:"Asia/Singapore"` // defaults to UTC
+	Recipients []string `json:"recipients" binding:"required,min=1,max=50,dive,email"`
+	IsActive   *bool    `json:"is_active,omitempty"` // defaults to true
+}
+
+type GenerateReportRequest struct {
+	Kind       string     `json:"kind" binding:"required,oneof=shift_handover premise_summary incident_report"`
+	Format     string     `json:"format,omitempty" binding:"omitempty,oneof=pdf csv"` // defaults to pdf
+	PremiseID  *string    `json:"premise_id,omitempty" binding:"omitempty,uuid"`
+	From       *time.Time `json:"from,omitempty"` // defaults to the kind's usual period before to
+	To         *time.Time `json:"to,omitempty"`   // defaults to now
+	Timezone   string     `json:"timezone,omitempty"`
+	Recipients []string   `json:"recipients,omitempty" binding:"max=50,dive,email"`
+}
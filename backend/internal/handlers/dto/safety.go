@@ -0,0 +1,19 @@
+package dto
+
+// SOSRequest is sent by the panic button; the position is optional
+type SOSRequest struct {
+	Latitude  *float64 `json:"latitude,omitempty" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+	Accuracy  *float64 `json:"accuracy,omitempty" binding:"omitempty,min=0"`
+	Message   string   `json:"message,omitempty" binding:"max=500"`
+}
+
+type StartLoneWorkerRequest struct {
+	IntervalMinutes int `json:"interval_minutes" binding:"required,min=1"`
+}
+
+type CheckInRequest struct {
+	Latitude  *float64 `json:"latitude,omitempty" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude,omitempty" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+	Accuracy  *float64 `json:"accuracy,omitempty" binding:"omitempty,min=0"`
+}
@@ -0,0 +1,26 @@
+package dto
+
+type SOPTemplateRequest struct {
+	Name        string           `json:"name" binding:"required,max=200"`
+	Description string           `json:"description,omitempty" binding:"max=2000"`
+	AlertType   string           `json:"alert_type,omitempty" binding:"omitempty,oneof=unauthorized_access suspicious_activity equipment_damage system_failure guard_distress missed_check_in patrol_checkpoint_late patrol_checkpoint_missed"`
+	PremiseType string           `json:"premise_type,omitempty" binding:"omitempty,oneof=office substation"`
+	Severity    string           `json:"severity,omitempty" binding:"omitempty,oneof=low medium high critical"`
+	IsActive    *bool            `json:"is_active,omitempty"` // defaults to true
+	Steps       []SOPStepRequest `json:"steps" binding:"required,min=1,max=100,dive"`
+}
+
+type SOPStepRequest struct {
+	Title         string `json:"title" binding:"required,max=200"`
+	Instructions  string `json:"instructions,omitempty" binding:"max=2000"`
+	Mandatory     bool   `json:"mandatory"`
+	RequiresPhoto bool   `json:"requires_photo"`
+}
+
+type CompleteChecklistStepRequest struct {
+	Note string `json:"note,omitempty" form:"note" binding:"max=2000"`
+}
+
+type ChecklistOverrideRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
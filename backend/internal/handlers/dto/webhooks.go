@@ -0,0 +1,11 @@
+package dto
+
+// WebhookRequest creates or replaces a webhook subscription
+type WebhookRequest struct {
+	Name       string   `json:"name" binding:"required,max=200"`
+	URL        string   `json:"url" binding:"required,url,max=2048" example:"https://example.com/hooks/scs"`
+	Secret     string   `json:"secret,omitempty" binding:"omitempty,min=16,max=200"`            // generated when omitted on create, kept on update
+	EventTypes []string `json:"event_types,omitempty" binding:"max=20" example:"alert_created"` // omit for every event
+	PremiseIDs []string `json:"premise_ids,omitempty" binding:"max=200,dive,uuid"`              // omit for every premise
+	Active     *bool    `json:"active,omitempty"`                                               // true re-enables a disabled webhook
+}
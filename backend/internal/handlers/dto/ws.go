@@ -0,0 +1,31 @@
+package dto
+
+// Payloads of inbound websocket commands
+
+type AcknowledgeAlertCommand struct {
+	AlertID string `json:"alert_id" binding:"required,uuid"`
+}
+
+type UpdateIncidentStatusCommand struct {
+	IncidentID string `json:"incident_id" binding:"required,uuid"`
+	Status     string `json:"status" binding:"required,oneof=open in_progress resolved closed"`
+}
+
+type AddIncidentUpdateCommand struct {
+	IncidentID string   `json:"incident_id" binding:"required,uuid"`
+	Type       string   `json:"type" binding:"required,oneof=arrival investigation resolution"`
+	Message    string   `json:"message" binding:"required"`
+	MediaURLs  []string `json:"media_urls,omitempty"`
+	Location   string   `json:"location,omitempty"`
+}
+
+type SendIncidentMessageCommand struct {
+	IncidentID   string `json:"incident_id" binding:"required,uuid"`
+	Body         string `json:"body" binding:"max=4000"`
+	QuickReplyID string `json:"quick_reply_id,omitempty" binding:"omitempty,uuid"`
+}
+
+type MarkMessagesReadCommand struct {
+	IncidentID string `json:"incident_id" binding:"required,uuid"`
+	MessageID  string `json:"message_id" binding:"required,uuid"`
+}
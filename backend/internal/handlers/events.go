@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/response"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventsHandler serves the realtime feed over Server-Sent Events, the
+// fallback for networks that block WebSocket upgrades
+type EventsHandler struct {
+	hub *websocket.Hub
+}
+
+func NewEventsHandler(hub *websocket.Hub) *EventsHandler {
+	return &EventsHandler{hub: hub}
+}
+
+// Stream godoc
+// @Summary Realtime event stream
+// @Description Server-Sent Events carrying the same messages as the websocket. Pass the token as access_token since EventSource cannot set headers. Reconnects resume from Last-Event-ID; a resync_required message means events were missed.
+// @Tags events
+// @Produce text/event-stream
+// @Param access_token query string false "JWT when the Authorization header cannot be set"
+// @Param topics query string false "Comma separated topics to subscribe to, e.g. premise:<id>,alerts:severity>=high"
+// @Param last_event_id query string false "Resume after this event when the Last-Event-ID header cannot be set"
+// @Success 200 {string} string "event stream"
+// @Failure 401 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/events/stream [get]
+func (h *EventsHandler) Stream(c *gin.Context) {
+	role, _ := c.Get("role")
+	websocket.ServeEvents(h.hub, c.GetString("user_id"), string(role.(models.UserRole)))(c.Writer, c.Request)
+}
+
+// Ack godoc
+// @Summary Acknowledge events
+// @Description Acknowledge sequenced messages up to and including seq, for clients on the event stream
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param payload body dto.AckEventsRequest true "Last sequence number handled"
+// @Success 200 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/events/ack [post]
+func (h *EventsHandler) Ack(c *gin.Context) {
+	var req dto.AckEventsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if err := h.hub.Ack(c.Request.Context(), c.GetString("user_id"), req.Seq); err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to acknowledge events", err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
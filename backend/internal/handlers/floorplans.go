@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FloorPlanHandler handles floor plan, zone and camera placement endpoints
+type FloorPlanHandler struct {
+	service services.FloorPlansService
+}
+
+func NewFloorPlanHandler(service services.FloorPlansService) *FloorPlanHandler {
+	return &FloorPlanHandler{service: service}
+}
+
+// GetFloors godoc
+// @Summary Get premise floors
+// @Description List the floors of a premise with their zones
+// @Tags floorplans
+// @Produce json
+// @Param id path string true "Premise ID"
+// @Success 200 {array} models.FloorPlan
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/premises/{id}/floors [get]
+func (h *FloorPlanHandler) GetFloors(c *gin.Context) {
+	premiseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	floors, err := h.service.GetFloors(c.Request.Context(), premiseID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch floors", err)
+		return
+	}
+	response.Success(c, http.StatusOK, floors)
+}
+
+// CreateFloor godoc
+// @Summary Create premise floor
+// @Description Upload a floor plan image and create a floor for the premise
+// @Tags floorplans
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Premise ID"
+// @Param name formData string true "Floor name"
+// @Param level formData int false "Floor level (0 = ground)"
+// @Param image formData file true "Floor plan image (PNG, JPEG or GIF)"
+// @Success 201 {object} models.FloorPlan
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/premises/{id}/floors [post]
+func (h *FloorPlanHandler) CreateFloor(c *gin.Context) {
+	premiseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		response.Error(c, http.StatusBadRequest, "Floor name required", nil)
+		return
+	}
+	level, _ := strconv.Atoi(c.PostForm("level"))
+
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Floor plan image required", err)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid floor plan image", err)
+		return
+	}
+	defer file.Close()
+
+	floor, err := h.service.CreateFloor(c.Request.Context(), premiseID, name, level, file)
+	if err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, floor)
+}
+
+// GetFloor godoc
+// @Summary Get floor overlay
+// @Description Get a floor with its zones, cameras (with live status) and active alerts
+// @Tags floorplans
+// @Produce json
+// @Param id path string true "Floor ID"
+// @Success 200 {object} services.FloorOverlay
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/floors/{id} [get]
+func (h *FloorPlanHandler) GetFloor(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Floor not found", err)
+		return
+	}
+	overlay, err := h.service.GetFloorOverlay(c.Request.Context(), id)
+	if err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, overlay)
+}
+
+// DeleteFloor godoc
+// @Summary Delete floor
+// @Description Delete a floor, its zones and camera placements
+// @Tags floorplans
+// @Produce json
+// @Param id path string true "Floor ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/floors/{id} [delete]
+func (h *FloorPlanHandler) DeleteFloor(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Floor not found", err)
+		return
+	}
+	if err := h.service.DeleteFloor(c.Request.Context(), id); err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// CreateZone godoc
+// @Summary Create zone
+// @Description Create a named polygon zone on a floor
+// @Tags floorplans
+// @Accept json
+// @Produce json
+// @Param id path string true "Floor ID"
+// @Param payload body dto.ZoneRequest true "Zone"
+// @Success 201 {object} models.Zone
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/floors/{id}/zones [post]
+func (h *FloorPlanHandler) CreateZone(c *gin.Context) {
+	floorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Floor not found", err)
+		return
+	}
+	var req dto.ZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	zone, err := h.service.CreateZone(c.Request.Context(), floorID, req.Name, req.Polygon)
+	if err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, zone)
+}
+
+// UpdateZone godoc
+// @Summary Update zone
+// @Description Rename or reshape a zone
+// @Tags floorplans
+// @Accept json
+// @Produce json
+// @Param id path string true "Zone ID"
+// @Param payload body dto.ZoneRequest true "Zone"
+// @Success 200 {object} models.Zone
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/zones/{id} [put]
+func (h *FloorPlanHandler) UpdateZone(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Zone not found", err)
+		return
+	}
+	var req dto.ZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	zone, err := h.service.UpdateZone(c.Request.Context(), id, req.Name, req.Polygon)
+	if err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, zone)
+}
+
+// DeleteZone godoc
+// @Summary Delete zone
+// @Description Delete a zone; cameras inside it lose their zone
+// @Tags floorplans
+// @Produce json
+// @Param id path string true "Zone ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/zones/{id} [delete]
+func (h *FloorPlanHandler) DeleteZone(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Zone not found", err)
+		return
+	}
+	if err := h.service.DeleteZone(c.Request.Context(), id); err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// PositionCamera godoc
+// @Summary Position camera on floor
+// @Description Place a camera on a floor plan; its zone is derived from the position
+// @Tags floorplans
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.PositionCameraRequest true "Position"
+// @Success 200 {object} models.Camera
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/position [put]
+func (h *FloorPlanHandler) PositionCamera(c *gin.Context) {
+	cameraID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Camera not found", err)
+		return
+	}
+	var req dto.PositionCameraRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	camera, err := h.service.PositionCamera(c.Request.Context(), cameraID, services.CameraPosition{
+		FloorPlanID: uuid.MustParse(req.FloorPlanID),
+		X:           *req.X,
+		Y:           *req.Y,
+		Heading:     req.Heading,
+		FieldOfView: req.FieldOfView,
+	})
+	if err != nil {
+		floorPlanError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, camera)
+}
+
+func floorPlanError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidPolygon), errors.Is(err, services.ErrInvalidPosition), errors.Is(err, services.ErrInvalidFloorImage),
+		errors.Is(err, services.ErrFloorMismatch):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IncidentMessageHandler handles the chat thread of an incident
+type IncidentMessageHandler struct {
+	service services.IncidentMessagesService
+}
+
+func NewIncidentMessageHandler(service services.IncidentMessagesService) *IncidentMessageHandler {
+	return &IncidentMessageHandler{service: service}
+}
+
+// GetMessages godoc
+// @Summary Get incident messages
+// @Description Page through an incident's chat, oldest first, with read receipts and the caller's unread count. Guards must be assigned.
+// @Tags incident-chat
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param before query string false "Return messages older than this message ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Success 200 {object} services.MessageThread
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/messages [get]
+func (h *IncidentMessageHandler) GetMessages(c *gin.Context) {
+	role, _ := c.Get("role")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	thread, err := h.service.ListMessages(c.Request.Context(), c.Param("id"), c.Query("before"), limit, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		incidentMessageError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, thread)
+}
+
+// SendMessage godoc
+// @Summary Send incident message
+// @Description Post to an incident's chat as JSON, or as multipart form data with body, quick_reply_id and up to 5 attachments files (images, video, audio or PDF). Delivered as incident_message events.
+// @Tags incident-chat
+// @Accept json
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param payload body dto.SendIncidentMessageRequest false "Message"
+// @Success 201 {object} models.IncidentMessage
+// @Failure 400 {object} response.ApiResponse
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/messages [post]
+func (h *IncidentMessageHandler) SendMessage(c *gin.Context) {
+	var req dto.SendIncidentMessageRequest
+	var msg services.NewIncidentMessage
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBind(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+		form, err := c.MultipartForm()
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+		for _, fileHeader := range form.File["attachments"] {
+			file, err := fileHeader.Open()
+			if err != nil {
+				response.Error(c, http.StatusBadRequest, "Invalid attachment", err)
+				return
+			}
+			defer file.Close()
+			msg.Attachments = append(msg.Attachments, services.AttachmentUpload{FileName: fileHeader.Filename, Reader: file})
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	msg.Body = req.Body
+	msg.QuickReplyID = req.QuickReplyID
+
+	role, _ := c.Get("role")
+	message, err := h.service.SendMessage(c.Request.Context(), c.Param("id"), msg, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		incidentMessageError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, message)
+}
+
+// MarkRead godoc
+// @Summary Mark incident messages read
+// @Description Move the caller's read position up to the given message; published as incident_message_read
+// @Tags incident-chat
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param payload body dto.MarkMessagesReadRequest true "Last read message"
+// @Success 200 {object} models.IncidentReadReceipt
+// @Failure 400 {object} response.ApiResponse
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/messages/read [post]
+func (h *IncidentMessageHandler) MarkRead(c *gin.Context) {
+	var req dto.MarkMessagesReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	receipt, err := h.service.MarkRead(c.Request.Context(), c.Param("id"), req.MessageID, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		incidentMessageError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, receipt)
+}
+
+// GetUnreadCounts godoc
+// @Summary Get unread message counts
+// @Description Unread chat messages per incident for the caller; incidents without unread messages are omitted
+// @Tags incident-chat
+// @Produce json
+// @Success 200 {array} services.UnreadCount
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/messages/unread [get]
+func (h *IncidentMessageHandler) GetUnreadCounts(c *gin.Context) {
+	role, _ := c.Get("role")
+	counts, err := h.service.UnreadCounts(c.Request.Context(), role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to count unread messages", err)
+		return
+	}
+	response.Success(c, http.StatusOK, counts)
+}
+
+// GetQuickReplies godoc
+// @Summary Get quick replies
+// @Description Canned chat replies available to the caller's role
+// @Tags incident-chat
+// @Produce json
+// @Success 200 {array} models.QuickReply
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/quick-replies [get]
+func (h *IncidentMessageHandler) GetQuickReplies(c *gin.Context) {
+	role, _ := c.Get("role")
+	replies, err := h.service.ListQuickReplies(c.Request.Context(), role.(models.UserRole))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to get quick replies", err)
+		return
+	}
+	response.Success(c, http.StatusOK, replies)
+}
+
+// CreateQuickReply godoc
+// @Summary Create quick reply
+// @Description Add a canned chat reply; an empty role offers it to everyone (SCS Operator)
+// @Tags incident-chat
+// @Accept json
+// @Produce json
+// @Param payload body dto.QuickReplyRequest true "Quick reply"
+// @Success 201 {object} models.QuickReply
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/quick-replies [post]
+func (h *IncidentMessageHandler) CreateQuickReply(c *gin.Context) {
+	var req dto.QuickReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	reply, err := h.service.CreateQuickReply(c.Request.Context(), models.QuickReply{
+		Text:      req.Text,
+		Role:      models.UserRole(req.Role),
+		SortOrder: req.SortOrder,
+	})
+	if err != nil {
+		incidentMessageError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, reply)
+}
+
+// DeleteQuickReply godoc
+// @Summary Delete quick reply
+// @Description Remove a canned chat reply; messages already sent keep their text (SCS Operator)
+// @Tags incident-chat
+// @Produce json
+// @Param id path string true "Quick reply ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/quick-replies/{id} [delete]
+func (h *IncidentMessageHandler) DeleteQuickReply(c *gin.Context) {
+	if err := h.service.DeleteQuickReply(c.Request.Context(), c.Param("id")); err != nil {
+		incidentMessageError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+func incidentMessageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrQuickReplyNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrPermissionDenied):
+		response.Error(c, http.StatusForbidden, "Access denied", err)
+	case errors.Is(err, services.ErrIncidentClosed):
+		response.Error(c, http.StatusConflict, "Incident is closed", err)
+	case errors.Is(err, services.ErrIncidentReportLocked):
+		response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+	case errors.Is(err, services.ErrEmptyMessage), errors.Is(err, services.ErrMessageTooLong),
+		errors.Is(err, services.ErrInvalidAttachment), errors.Is(err, services.ErrTooManyAttachments):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
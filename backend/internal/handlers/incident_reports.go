@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IncidentReportHandler serves post-incident reports
+type IncidentReportHandler struct {
+	service services.IncidentReportsService
+}
+
+func NewIncidentReportHandler(service services.IncidentReportsService) *IncidentReportHandler {
+	return &IncidentReportHandler{service: service}
+}
+
+// GetReport godoc
+// @Summary Get incident report
+// @Description The post-incident report: alert, premise and camera, dispatched guards, timeline with durations, updates with photo thumbnails, written notes and sign-off. format=pdf downloads a PDF and format=html a page Word opens as a document; times in those are shown in timezone (default UTC). A finalized report shows the incident as it stood at sign-off. Guards must be assigned.
+// @Tags incidents
+// @Produce json
+// @Produce application/pdf
+// @Produce text/html
+// @Param id path string true "Incident ID"
+// @Param format query string false "json (default), pdf or html"
+// @Param timezone query string false "IANA timezone for pdf and html"
+// @Success 200 {object} services.IncidentReportDocument
+// @Failure 400 {object} response.ApiResponse
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/report [get]
+func (h *IncidentReportHandler) GetReport(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" && format != "html" {
+		response.Error(c, http.StatusBadRequest, "Invalid format", fmt.Errorf("unknown format %q", format))
+		return
+	}
+	loc, err := time.LoadLocation(c.DefaultQuery("timezone", "UTC"))
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid timezone", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	doc, err := h.service.GetReport(c.Request.Context(), c.Param("id"), role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		incidentReportError(c, err)
+		return
+	}
+
+	switch format {
+	case "pdf":
+		content, err := doc.PDF(loc)
+		if err != nil {
+			response.Error(c, http.StatusInternalServerError, "Failed to render report", err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, doc.FileName("pdf")))
+		c.Data(http.StatusOK, "application/pdf", content)
+	case "html":
+		content, err := doc.HTML(loc)
+		if err != nil {
+			response.Error(c, http.StatusInternalServerError, "Failed to render report", err)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, doc.FileName("html")))
+		c.Data(http.StatusOK, "text/html; charset=utf-8", content)
+	default:
+		response.Success(c, http.StatusOK, doc)
+	}
+}
+
+// UpdateReport godoc
+// @Summary Write incident report
+// @Description Save the summary, resolution notes and recommendations of a draft report; the writer is recorded as preparer (SCS Operator)
+// @Tags incidents
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param payload body dto.IncidentReportRequest true "Report notes"
+// @Success 200 {object} models.IncidentReport
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/report [put]
+func (h *IncidentReportHandler) UpdateReport(c *gin.Context) {
+	var req dto.IncidentReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	report, err := h.service.UpdateReport(c.Request.Context(), c.Param("id"), services.IncidentReportInput{
+		Summary:         req.Summary,
+		ResolutionNotes: req.ResolutionNotes,
+		Recommendations: req.Recommendations,
+	}, c.GetString("user_id"))
+	if err != nil {
+		incidentReportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// FinalizeReport godoc
+// @Summary Finalize incident report
+// @Description Sign the report off and lock it (SCS Operator). The incident must be resolved and resolution notes written. Afterwards the notes cannot be edited and no incident updates can be added.
+// @Tags incidents
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param payload body dto.FinalizeIncidentReportRequest true "Sign-off"
+// @Success 200 {object} models.IncidentReport
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/report/finalize [post]
+func (h *IncidentReportHandler) FinalizeReport(c *gin.Context) {
+	var req dto.FinalizeIncidentReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	report, err := h.service.FinalizeReport(c.Request.Context(), c.Param("id"), services.IncidentSignOff{
+		Name:  req.SignOffName,
+		Title: req.SignOffTitle,
+	}, c.GetString("user_id"))
+	if err != nil {
+		incidentReportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+func incidentReportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Incident not found", err)
+	case errors.Is(err, services.ErrPermissionDenied):
+		response.Error(c, http.StatusForbidden, "Access denied", err)
+	case errors.Is(err, services.ErrInvalidIncidentReport):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	case errors.Is(err, services.ErrIncidentReportLocked):
+		response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+	case errors.Is(err, services.ErrIncidentNotResolved):
+		response.Error(c, http.StatusConflict, "Incident is not resolved", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"smart-city-surveillance/internal/models"
@@ -24,26 +25,42 @@ func NewIncidentHandler(service services.IncidentsService) *IncidentHandler {
 
 // GetIncidents godoc
 // @Summary Get incidents
-// @Description Get incidents, filtered by status; guards see only their incidents
+// @Description List incidents a page at a time, newest first; guards see only their incidents. Filters take comma separated values; sort keys are created_at, updated_at and status.
 // @Tags incidents
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, updated_at and status, - for descending (e.g. status,-updated_at)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: alert, assigned_guards, updates, checklist"
 // @Param status query string false "Filter by status"
+// @Param alert_id query string false "Filter by alert ID"
+// @Param premise_id query string false "Filter by the alert's premise ID"
+// @Param severity query string false "Filter by the alert's severity"
+// @Param assigned_guard_id query string false "Filter by assigned guard ID"
 // @Success 200 {array} models.Incident
+// @Failure 400 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/incidents [get]
 func (h *IncidentHandler) GetIncidents(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
 	userRole, _ := c.Get("role")
 	userID := c.GetString("user_id")
-	status := c.Query("status")
 
-	incidents, err := h.service.GetIncidents(c.Request.Context(), userRole.(models.UserRole), userID, status)
+	page, err := h.service.GetIncidents(c.Request.Context(), q, userRole.(models.UserRole), userID)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, "Failed to fetch incidents", err)
+		listError(c, err, "Failed to fetch incidents")
 		return
 	}
-	response.Success(c, http.StatusOK, incidents)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 }
 
 // GetIncident godoc
@@ -73,7 +90,7 @@ func (h *IncidentHandler) GetIncident(c *gin.Context) {
 
 // UpdateIncident godoc
 // @Summary Update incident status
-// @Description Update an incident's status; guards must be assigned
+// @Description Update an incident's status; guards must be assigned. Resolving or closing needs the mandatory checklist steps done or an operator override. The status cannot change once the incident report is finalized.
 // @Tags incidents
 // @Accept json
 // @Produce json
@@ -83,6 +100,7 @@ func (h *IncidentHandler) GetIncident(c *gin.Context) {
 // @Failure 400 {object} response.ApiResponse
 // @Failure 403 {object} response.ApiResponse
 // @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/incidents/{id} [put]
@@ -105,6 +123,14 @@ func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
 			response.Error(c, http.StatusForbidden, "Access denied", err)
 			return
 		}
+		if errors.Is(err, services.ErrChecklistIncomplete) {
+			response.Error(c, http.StatusConflict, "Checklist incomplete", err)
+			return
+		}
+		if errors.Is(err, services.ErrIncidentReportLocked) {
+			response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+			return
+		}
 		response.Error(c, http.StatusInternalServerError, "Failed to update incident", err)
 		return
 	}
@@ -113,7 +139,7 @@ func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
 
 // AddIncidentUpdate godoc
 // @Summary Add incident update
-// @Description Add an update to an incident; guards must be assigned
+// @Description Add an update to an incident; guards must be assigned. A resolution update needs the mandatory checklist steps done or an operator override. No updates can be added once the incident report is finalized.
 // @Tags incidents
 // @Accept json
 // @Produce json
@@ -123,6 +149,7 @@ func (h *IncidentHandler) UpdateIncident(c *gin.Context) {
 // @Failure 400 {object} response.ApiResponse
 // @Failure 403 {object} response.ApiResponse
 // @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/incidents/{id}/updates [post]
@@ -143,6 +170,14 @@ func (h *IncidentHandler) AddIncidentUpdate(c *gin.Context) {
 			response.Error(c, http.StatusForbidden, "Access denied", err)
 			return
 		}
+		if errors.Is(err, services.ErrChecklistIncomplete) {
+			response.Error(c, http.StatusConflict, "Checklist incomplete", err)
+			return
+		}
+		if errors.Is(err, services.ErrIncidentReportLocked) {
+			response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+			return
+		}
 		response.Error(c, http.StatusInternalServerError, "Failed to create update", err)
 		return
 	}
@@ -173,11 +208,19 @@ func (h *IncidentHandler) GetIncidentByAlertID(c *gin.Context) {
 
 // GetAssignedIncidents godoc
 // @Summary Get my assigned incidents
-// @Description Get incidents assigned to the authenticated guard
+// @Description Get incidents assigned to the authenticated guard; takes the same list parameters as GET /api/incidents
 // @Tags incidents
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, updated_at and status, - for descending (e.g. status,-updated_at)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: alert, assigned_guards, updates, checklist"
 // @Success 200 {array} models.Incident
+// @Failure 400 {object} response.ApiResponse
 // @Failure 401 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
@@ -188,11 +231,16 @@ func (h *IncidentHandler) GetAssignedIncidents(c *gin.Context) {
 		response.Error(c, http.StatusUnauthorized, "User not authenticated", nil)
 		return
 	}
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
 
-	incidents, err := h.service.GetIncidents(c.Request.Context(), models.RoleSecurityGuard, userID.(string), "")
+	page, err := h.service.GetIncidents(c.Request.Context(), q, models.RoleSecurityGuard, userID.(string))
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, "Failed to fetch incidents", err)
+		listError(c, err, "Failed to fetch incidents")
 		return
 	}
-	response.Success(c, http.StatusOK, incidents)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 } 
\ No newline at end of file
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Query parameters every list endpoint understands; any other parameter is
+// a filter
+var listParams = map[string]bool{
+	"limit":          true,
+	"cursor":         true,
+	"sort":           true,
+	"created_after":  true,
+	"created_before": true,
+	"fields":         true,
+	"expand":         true,
+}
+
+// parseListQuery reads limit, cursor, sort (comma separated, - for
+// descending), created_after/created_before (RFC 3339), fields, expand and
+// filters, whose values may be repeated or comma separated
+func parseListQuery(c *gin.Context) (services.ListQuery, error) {
+	var q services.ListQuery
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = limit
+	}
+	q.Cursor = c.Query("cursor")
+
+	for _, key := range splitList(c.QueryArray("sort")) {
+		field := services.SortField{Field: key}
+		if strings.HasPrefix(key, "-") {
+			field = services.SortField{Field: key[1:], Desc: true}
+		}
+		q.Sort = append(q.Sort, field)
+	}
+
+	var err error
+	if q.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		return q, err
+	}
+
+	q.Fields = splitList(c.QueryArray("fields"))
+	q.Expand = splitList(c.QueryArray("expand"))
+
+	for name, values := range c.Request.URL.Query() {
+		if listParams[name] {
+			continue
+		}
+		if values = splitList(values); len(values) > 0 {
+			if q.Filters == nil {
+				q.Filters = map[string][]string{}
+			}
+			q.Filters[name] = values
+		}
+	}
+	return q, nil
+}
+
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, errors.New(name + " must be an RFC 3339 time")
+	}
+	return &t, nil
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// listError responds to a failed list query
+func listError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidListQuery):
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+	case err.Error() == "permission denied":
+		response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, message, err)
+	}
+}
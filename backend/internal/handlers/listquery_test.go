@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"smart-city-surveillance/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testListContext(url string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", url, nil)
+	return c
+}
+
+func TestParseListQuery(t *testing.T) {
+	q, err := parseListQuery(testListContext("/alerts?limit=20&cursor=abc&sort=-severity,created_at&sort=id" +
+		"&created_after=2026-03-01T00:00:00Z&fields=id,+status&expand=camera&status=new,acknowledged&status=resolved&camera_id="))
+	if err != nil {
+		t.Fatalf("parseListQuery: %v", err)
+	}
+	if q.Limit != 20 || q.Cursor != "abc" || q.CreatedAfter == nil || q.CreatedBefore != nil {
+		t.Errorf("parsed %+v", q)
+	}
+	if want := []services.SortField{{Field: "severity", Desc: true}, {Field: "created_at"}, {Field: "id"}}; !reflect.DeepEqual(q.Sort, want) {
+		t.Errorf("sort = %+v, want %+v", q.Sort, want)
+	}
+	if !reflect.DeepEqual(q.Fields, []string{"id", "status"}) || !reflect.DeepEqual(q.Expand, []string{"camera"}) {
+		t.Errorf("fields %q, expand %q", q.Fields, q.Expand)
+	}
+	// Empty filters are dropped and list parameters are not filters
+	if want := map[string][]string{"status": {"new", "acknowledged", "resolved"}}; !reflect.DeepEqual(q.Filters, want) {
+		t.Errorf("filters = %v, want %v", q.Filters, want)
+	}
+
+	for _, url := range []string{"/alerts?limit=0", "/alerts?limit=ten", "/alerts?created_before=yesterday"} {
+		if _, err := parseListQuery(testListContext(url)); err == nil {
+			t.Errorf("parseListQuery(%s) succeeded", url)
+		}
+	}
+}
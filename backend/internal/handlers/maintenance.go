@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaintenanceHandler handles maintenance windows and the alerts they
+// suppressed
+type MaintenanceHandler struct {
+	service services.MaintenanceService
+}
+
+func NewMaintenanceHandler(service services.MaintenanceService) *MaintenanceHandler {
+	return &MaintenanceHandler{service: service}
+}
+
+// GetWindows godoc
+// @Summary Get maintenance windows
+// @Description List maintenance windows, latest start first (SCS Operator). active=true keeps the windows suppressing alerts now.
+// @Tags maintenance
+// @Produce json
+// @Param premise_id query string false "Premise ID"
+// @Param camera_id query string false "Camera ID"
+// @Param active query bool false "Only windows open now"
+// @Success 200 {array} models.MaintenanceWindow
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows [get]
+func (h *MaintenanceHandler) GetWindows(c *gin.Context) {
+	var filter services.MaintenanceWindowFilter
+	for key, dst := range map[string]**uuid.UUID{"premise_id": &filter.PremiseID, "camera_id": &filter.CameraID} {
+		if raw := c.Query(key); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				response.Error(c, http.StatusBadRequest, "Invalid query", err)
+				return
+			}
+			*dst = &id
+		}
+	}
+	if raw := c.Query("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", err)
+			return
+		}
+		if active {
+			now := time.Now()
+			filter.ActiveAt = &now
+		}
+	}
+
+	windows, err := h.service.ListWindows(c.Request.Context(), filter)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch maintenance windows", err)
+		return
+	}
+	response.Success(c, http.StatusOK, windows)
+}
+
+// GetWindow godoc
+// @Summary Get maintenance window
+// @Description Get a maintenance window with its suppression rules (SCS Operator)
+// @Tags maintenance
+// @Produce json
+// @Param id path string true "Window ID"
+// @Success 200 {object} models.MaintenanceWindow
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows/{id} [get]
+func (h *MaintenanceHandler) GetWindow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Maintenance window not found", err)
+		return
+	}
+	window, err := h.service.GetWindow(c.Request.Context(), id)
+	if err != nil {
+		maintenanceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, window)
+}
+
+// CreateWindow godoc
+// @Summary Create maintenance window
+// @Description Suppress alerts at a premise, or from one camera, during planned work (SCS Operator). A one-off window runs from starts_at to ends_at; a recurring one opens at each time of its recurrence cron expression in timezone for duration_minutes. Rules narrow what is suppressed by alert type, severity and camera; without rules every alert in scope is. Guard distress and missed check-in alerts are never suppressed.
+// @Tags maintenance
+// @Accept json
+// @Produce json
+// @Param payload body dto.MaintenanceWindowRequest true "Window"
+// @Success 201 {object} models.MaintenanceWindow
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows [post]
+func (h *MaintenanceHandler) CreateWindow(c *gin.Context) {
+	var req dto.MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	window, err := h.service.CreateWindow(c.Request.Context(), maintenanceWindowInput(req), c.GetString("user_id"))
+	if err != nil {
+		maintenanceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, window)
+}
+
+// UpdateWindow godoc
+// @Summary Update maintenance window
+// @Description Replace a maintenance window and its rules (SCS Operator)
+// @Tags maintenance
+// @Accept json
+// @Produce json
+// @Param id path string true "Window ID"
+// @Param payload body dto.MaintenanceWindowRequest true "Window"
+// @Success 200 {object} models.MaintenanceWindow
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows/{id} [put]
+func (h *MaintenanceHandler) UpdateWindow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Maintenance window not found", err)
+		return
+	}
+	var req dto.MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	window, err := h.service.UpdateWindow(c.Request.Context(), id, maintenanceWindowInput(req), c.GetString("user_id"))
+	if err != nil {
+		maintenanceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, window)
+}
+
+// EndWindow godoc
+// @Summary End maintenance window
+// @Description End a maintenance window now, including a recurring one (SCS Operator). Alerts are raised as usual from then on.
+// @Tags maintenance
+// @Produce json
+// @Param id path string true "Window ID"
+// @Success 200 {object} models.MaintenanceWindow
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows/{id}/end [post]
+func (h *MaintenanceHandler) EndWindow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Maintenance window not found", err)
+		return
+	}
+	window, err := h.service.EndWindow(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		maintenanceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, window)
+}
+
+// DeleteWindow godoc
+// @Summary Delete maintenance window
+// @Description Delete a maintenance window (SCS Operator). The alerts it suppressed stay on record.
+// @Tags maintenance
+// @Produce json
+// @Param id path string true "Window ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/windows/{id} [delete]
+func (h *MaintenanceHandler) DeleteWindow(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Maintenance window not found", err)
+		return
+	}
+	if err := h.service.DeleteWindow(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		maintenanceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// GetSuppressedAlerts godoc
+// @Summary Get suppressed alerts
+// @Description Alerts recorded instead of raised, newest first (SCS Operator): cause maintenance when a maintenance window covered them, disarmed when the arming policy discarded them. Filters: cause, severity, premise_id, camera_id, window_id; expand=premise,camera,window.
+// @Tags maintenance
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "created_at, severity or type; prefix - for descending"
+// @Param cause query string false "Comma separated causes (maintenance, disarmed)"
+// @Param type query string false "Comma separated alert types"
+// @Param severity query string false "Comma separated severities"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Param camera_id query string false "Comma separated camera IDs"
+// @Param window_id query string false "Comma separated window IDs"
+// @Param expand query string false "premise, camera, window"
+// @Success 200 {array} models.SuppressedAlert
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/maintenance/suppressed-alerts [get]
+func (h *MaintenanceHandler) GetSuppressedAlerts(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.ListSuppressed(c.Request.Context(), q)
+	if err != nil {
+		listError(c, err, "Failed to fetch suppressed alerts")
+		return
+	}
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
+}
+
+func maintenanceWindowInput(req dto.MaintenanceWindowRequest) services.MaintenanceWindowInput {
+	input := services.MaintenanceWindowInput{
+		Name:            req.Name,
+		Reason:          req.Reason,
+		PremiseID:       optionalUUID(req.PremiseID),
+		CameraID:        optionalUUID(req.CameraID),
+		StartsAt:        req.StartsAt,
+		EndsAt:          req.EndsAt,
+		Recurrence:      req.Recurrence,
+		DurationMinutes: req.DurationMinutes,
+		Timezone:        req.Timezone,
+	}
+	for _, rule := range req.Rules {
+		input.Rules = append(input.Rules, services.SuppressionRuleInput{
+			AlertTypes: rule.AlertTypes,
+			Severities: rule.Severities,
+			CameraIDs:  rule.CameraIDs,
+		})
+	}
+	return input
+}
+
+func maintenanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidMaintenanceWindow):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/geojson"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MapHandler handles the geospatial map feed and location updates
+type MapHandler struct {
+	service services.MapService
+}
+
+func NewMapHandler(service services.MapService) *MapHandler {
+	return &MapHandler{service: service}
+}
+
+// GetMap godoc
+// @Summary Get map feed
+// @Description GeoJSON FeatureCollections of premises, cameras, open alerts and on-duty guards. Live changes are pushed as map_diff websocket events.
+// @Tags map
+// @Produce json
+// @Param bbox query string false "Bounding box minLon,minLat,maxLon,maxLat"
+// @Param layers query string false "Comma separated layers (premises,cameras,alerts,guards); default all"
+// @Success 200 {object} services.MapFeed
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/map [get]
+func (h *MapHandler) GetMap(c *gin.Context) {
+	var bbox *geojson.BBox
+	if raw := c.Query("bbox"); raw != "" {
+		var err error
+		if bbox, err = geojson.ParseBBox(raw); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid bbox", err)
+			return
+		}
+	}
+
+	var layers []string
+	if raw := c.Query("layers"); raw != "" {
+		for _, layer := range strings.Split(raw, ",") {
+			layer = strings.TrimSpace(layer)
+			if !validMapLayer(layer) {
+				response.Error(c, http.StatusBadRequest, "Invalid layer: "+layer, nil)
+				return
+			}
+			layers = append(layers, layer)
+		}
+	}
+
+	feed, err := h.service.GetMap(c.Request.Context(), bbox, layers)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to build map", err)
+		return
+	}
+	response.Success(c, http.StatusOK, feed)
+}
+
+// UpdatePremiseLocation godoc
+// @Summary Set premise location
+// @Description Set the geographic position of a premise
+// @Tags map
+// @Accept json
+// @Produce json
+// @Param id path string true "Premise ID"
+// @Param payload body dto.LocationRequest true "Position"
+// @Success 200 {object} models.Premise
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/premises/{id}/location [put]
+func (h *MapHandler) UpdatePremiseLocation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	var req dto.LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	premise, err := h.service.SetPremiseLocation(c.Request.Context(), id, *req.Latitude, *req.Longitude)
+	if err != nil {
+		mapError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, premise)
+}
+
+// UpdateCameraLocation godoc
+// @Summary Set camera location
+// @Description Set the geographic position of a camera; null coordinates fall back to the premise position
+// @Tags map
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.CameraLocationRequest true "Position"
+// @Success 200 {object} models.Camera
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/location [put]
+func (h *MapHandler) UpdateCameraLocation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Camera not found", err)
+		return
+	}
+	var req dto.CameraLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	camera, err := h.service.SetCameraLocation(c.Request.Context(), id, req.Latitude, req.Longitude)
+	if err != nil {
+		mapError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, camera)
+}
+
+// UpdateMyLocation godoc
+// @Summary Report guard location
+// @Description Report the current position of the authenticated guard
+// @Tags map
+// @Accept json
+// @Produce json
+// @Param payload body dto.GuardLocationRequest true "Position fix"
+// @Success 200 {object} models.GuardLocation
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/location [post]
+func (h *MapHandler) UpdateMyLocation(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.GuardLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	fix := services.GuardFix{
+		Latitude:  *req.Latitude,
+		Longitude: *req.Longitude,
+		Accuracy:  req.Accuracy,
+		Heading:   req.Heading,
+	}
+	if req.RecordedAt != nil {
+		fix.RecordedAt = *req.RecordedAt
+	}
+
+	location, err := h.service.UpdateGuardLocation(c.Request.Context(), guardID, fix)
+	if err != nil {
+		mapError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, location)
+}
+
+// UpdateMyDuty godoc
+// @Summary Set guard duty status
+// @Description Go on or off duty; only on-duty guards are shown on the map
+// @Tags map
+// @Accept json
+// @Produce json
+// @Param payload body dto.DutyRequest true "Duty status"
+// @Success 200 {object} models.User
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/duty [put]
+func (h *MapHandler) UpdateMyDuty(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.DutyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	guard, err := h.service.SetOnDuty(c.Request.Context(), guardID, *req.OnDuty)
+	if err != nil {
+		mapError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, guard)
+}
+
+func validMapLayer(layer string) bool {
+	for _, l := range services.MapLayers {
+		if l == layer {
+			return true
+		}
+	}
+	return false
+}
+
+func mapError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidCoordinates):
+		response.Error(c, http.StatusBadRequest, "Invalid coordinates", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
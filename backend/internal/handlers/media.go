@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"smart-city-surveillance/pkg/response"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaHandler serves stored media through signed URLs
+type MediaHandler struct {
+	store storage.Storage
+}
+
+func NewMediaHandler(store storage.Storage) *MediaHandler {
+	return &MediaHandler{store: store}
+}
+
+// ServeMedia godoc
+// @Summary Download media
+// @Description Serve a stored media object; requires a signed URL
+// @Tags media
+// @Produce octet-stream
+// @Param key path string true "Storage key"
+// @Param expires query string true "Expiry (unix seconds)"
+// @Param signature query string true "URL signature"
+// @Success 200 {file} binary
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Router /media/{key} [get]
+func (h *MediaHandler) ServeMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !h.store.Verify(key, c.Query("expires"), c.Query("signature")) {
+		response.Error(c, http.StatusForbidden, "Invalid or expired signature", nil)
+		return
+	}
+
+	r, err := h.store.Open(c.Request.Context(), key)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Media not found", err)
+		return
+	}
+	defer r.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Only raster images are shown inline; anything else a browser could
+	// render, such as HTML from an older upload, is downloaded instead
+	if !strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "image/svg") {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, path.Base(key)))
+	}
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, r)
+}
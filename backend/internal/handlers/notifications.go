@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationHandler handles push devices, test notifications and the
+// delivery log
+type NotificationHandler struct {
+	service services.NotificationsService
+}
+
+func NewNotificationHandler(service services.NotificationsService) *NotificationHandler {
+	return &NotificationHandler{service: service}
+}
+
+// GetMyDevices godoc
+// @Summary Get my devices
+// @Description List the devices registered for push notifications to the current user
+// @Tags notifications
+// @Produce json
+// @Success 200 {array} models.DeviceToken
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/devices [get]
+func (h *NotificationHandler) GetMyDevices(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	devices, err := h.service.ListDevices(c.Request.Context(), userID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch devices", err)
+		return
+	}
+	response.Success(c, http.StatusOK, devices)
+}
+
+// RegisterDevice godoc
+// @Summary Register device
+// @Description Register the app's FCM (android) or APNs (ios) token for push notifications. Registering a token again refreshes it; a token registered by another user moves to the current one.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param payload body dto.RegisterDeviceRequest true "Device"
+// @Success 201 {object} models.DeviceToken
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/devices [post]
+func (h *NotificationHandler) RegisterDevice(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	device, err := h.service.RegisterDevice(c.Request.Context(), userID, models.DevicePlatform(req.Platform), req.Token)
+	if err != nil {
+		notificationError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, device)
+}
+
+// RemoveDevice godoc
+// @Summary Remove device
+// @Description Stop push notifications to one of the current user's devices, e.g. on logout
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/devices/{id} [delete]
+func (h *NotificationHandler) RemoveDevice(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Device not found", err)
+		return
+	}
+	if err := h.service.RemoveDevice(c.Request.Context(), userID, id); err != nil {
+		notificationError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// SendTestNotification godoc
+// @Summary Send test notification
+// @Description Send the current user a test notification on every channel they can be reached on: email, SMS to their phone and push to each registered device. Returns the queued deliveries.
+// @Tags notifications
+// @Produce json
+// @Success 202 {array} models.NotificationDelivery
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/notifications/test [post]
+func (h *NotificationHandler) SendTestNotification(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	deliveries, err := h.service.SendTest(c.Request.Context(), userID)
+	if err != nil {
+		notificationError(c, err)
+		return
+	}
+	response.Success(c, http.StatusAccepted, deliveries)
+}
+
+// GetDeliveries godoc
+// @Summary Get notification deliveries
+// @Description The delivery log, newest first (SCS Operator). Filters: user_id, event, channel, status (pending, sent, failed); expand=user.
+// @Tags notifications
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param user_id query string false "Comma separated user IDs"
+// @Param event query string false "Comma separated events"
+// @Param channel query string false "Comma separated channels"
+// @Param status query string false "Comma separated statuses"
+// @Success 200 {array} models.NotificationDelivery
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/notifications/deliveries [get]
+func (h *NotificationHandler) GetDeliveries(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.ListDeliveries(c.Request.Context(), q)
+	if err != nil {
+		listError(c, err, "Failed to fetch deliveries")
+		return
+	}
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
+}
+
+// GetDelivery godoc
+// @Summary Get notification delivery
+// @Description A delivery with its attempts and last error (SCS Operator)
+// @Tags notifications
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} models.NotificationDelivery
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/notifications/deliveries/{id} [get]
+func (h *NotificationHandler) GetDelivery(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Delivery not found", err)
+		return
+	}
+	delivery, err := h.service.GetDelivery(c.Request.Context(), id)
+	if err != nil {
+		notificationError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, delivery)
+}
+
+func notificationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidDevice):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
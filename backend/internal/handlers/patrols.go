@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const defaultComplianceWindow = 30 * 24 * time.Hour
+
+// PatrolHandler handles patrol route, checkpoint scan and compliance endpoints
+type PatrolHandler struct {
+	service services.PatrolsService
+}
+
+func NewPatrolHandler(service services.PatrolsService) *PatrolHandler {
+	return &PatrolHandler{service: service}
+}
+
+// GetRoutes godoc
+// @Summary Get patrol routes
+// @Description List patrol routes with their checkpoints. Guards see the routes they may walk, without tag codes.
+// @Tags patrols
+// @Produce json
+// @Param premise_id query string false "Premise ID"
+// @Success 200 {array} models.PatrolRoute
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes [get]
+func (h *PatrolHandler) GetRoutes(c *gin.Context) {
+	premiseID, err := queryUUID(c, "premise_id")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid premise_id", err)
+		return
+	}
+	role, _ := c.Get("role")
+	routes, err := h.service.ListRoutes(c.Request.Context(), premiseID, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch patrol routes", err)
+		return
+	}
+	response.Success(c, http.StatusOK, routes)
+}
+
+// GetRoute godoc
+// @Summary Get patrol route
+// @Description Get a patrol route with its checkpoints in walking order
+// @Tags patrols
+// @Produce json
+// @Param id path string true "Route ID"
+// @Success 200 {object} models.PatrolRoute
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes/{id} [get]
+func (h *PatrolHandler) GetRoute(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Patrol route not found", err)
+		return
+	}
+	role, _ := c.Get("role")
+	route, err := h.service.GetRoute(c.Request.Context(), id, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, route)
+}
+
+// CreateRoute godoc
+// @Summary Create patrol route
+// @Description Create a patrol route with ordered checkpoints. Missing tag codes are generated. A route with a guard and start_times is scheduled daily in its timezone.
+// @Tags patrols
+// @Accept json
+// @Produce json
+// @Param payload body dto.PatrolRouteRequest true "Route"
+// @Success 201 {object} models.PatrolRoute
+// @Failure 400 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes [post]
+func (h *PatrolHandler) CreateRoute(c *gin.Context) {
+	var req dto.PatrolRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	route, err := h.service.CreateRoute(c.Request.Context(), patrolRouteInput(req), c.GetString("user_id"))
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, route)
+}
+
+// UpdateRoute godoc
+// @Summary Update patrol route
+// @Description Replace a patrol route. Checkpoints with an id are kept, those left out are deleted. Open patrols are not affected.
+// @Tags patrols
+// @Accept json
+// @Produce json
+// @Param id path string true "Route ID"
+// @Param payload body dto.PatrolRouteRequest true "Route"
+// @Success 200 {object} models.PatrolRoute
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes/{id} [put]
+func (h *PatrolHandler) UpdateRoute(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Patrol route not found", err)
+		return
+	}
+	var req dto.PatrolRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	route, err := h.service.UpdateRoute(c.Request.Context(), id, patrolRouteInput(req), c.GetString("user_id"))
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, route)
+}
+
+// DeleteRoute godoc
+// @Summary Delete patrol route
+// @Description Delete a patrol route that has never been walked; deactivate routes with patrol history instead
+// @Tags patrols
+// @Produce json
+// @Param id path string true "Route ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes/{id} [delete]
+func (h *PatrolHandler) DeleteRoute(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Patrol route not found", err)
+		return
+	}
+	if err := h.service.DeleteRoute(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// StartPatrol godoc
+// @Summary Start patrol
+// @Description Start walking a route, or start the guard's scheduled patrol of it. Checkpoints of an on-demand patrol are due from now.
+// @Tags patrols
+// @Produce json
+// @Param id path string true "Route ID"
+// @Success 200 {object} models.PatrolRun
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/routes/{id}/start [post]
+func (h *PatrolHandler) StartPatrol(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	routeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Patrol route not found", err)
+		return
+	}
+	run, err := h.service.StartPatrol(c.Request.Context(), routeID, guardID)
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, run)
+}
+
+// Scan godoc
+// @Summary Scan checkpoint
+// @Description Record a QR or NFC checkpoint tag read on the guard's open patrol. Scans after the tolerance are late and raise an alert.
+// @Tags patrols
+// @Accept json
+// @Produce json
+// @Param payload body dto.PatrolScanRequest true "Tag and position"
+// @Success 200 {object} models.PatrolRun
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/scan [post]
+func (h *PatrolHandler) Scan(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.PatrolScanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	run, err := h.service.Scan(c.Request.Context(), guardID, services.PatrolScan{
+		TagCode: req.TagCode,
+		Fix:     guardFix(req.Latitude, req.Longitude, req.Accuracy),
+	})
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, run)
+}
+
+// GetRuns godoc
+// @Summary Get patrols
+// @Description List patrol runs, newest first. Guards only see their own.
+// @Tags patrols
+// @Produce json
+// @Param route_id query string false "Route ID"
+// @Param premise_id query string false "Premise ID"
+// @Param guard_id query string false "Guard ID"
+// @Param status query string false "scheduled, in_progress, completed or incomplete"
+// @Param from query string false "Created at or after (RFC3339)"
+// @Param to query string false "Created before (RFC3339)"
+// @Success 200 {array} models.PatrolRun
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/runs [get]
+func (h *PatrolHandler) GetRuns(c *gin.Context) {
+	var filter services.PatrolRunFilter
+	var err error
+	for name, target := range map[string]**uuid.UUID{"route_id": &filter.RouteID, "premise_id": &filter.PremiseID, "guard_id": &filter.GuardID} {
+		if *target, err = queryUUID(c, name); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid "+name, err)
+			return
+		}
+	}
+	switch status := models.PatrolRunStatus(c.Query("status")); status {
+	case "", models.PatrolRunScheduled, models.PatrolRunInProgress, models.PatrolRunCompleted, models.PatrolRunIncomplete:
+		filter.Status = status
+	default:
+		response.Error(c, http.StatusBadRequest, "Invalid status", nil)
+		return
+	}
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				response.Error(c, http.StatusBadRequest, "Invalid "+name, err)
+				return
+			}
+			*target = &t
+		}
+	}
+
+	role, _ := c.Get("role")
+	runs, err := h.service.ListRuns(c.Request.Context(), filter, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch patrols", err)
+		return
+	}
+	response.Success(c, http.StatusOK, runs)
+}
+
+// GetRun godoc
+// @Summary Get patrol
+// @Description Get a patrol run with the status of each checkpoint
+// @Tags patrols
+// @Produce json
+// @Param id path string true "Run ID"
+// @Success 200 {object} models.PatrolRun
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/runs/{id} [get]
+func (h *PatrolHandler) GetRun(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Patrol not found", err)
+		return
+	}
+	role, _ := c.Get("role")
+	run, err := h.service.GetRun(c.Request.Context(), id, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, run)
+}
+
+// GetCompliance godoc
+// @Summary Get patrol compliance
+// @Description On-time, late and missed checkpoints per guard or per premise for checkpoints due in the range (defaults to the last 30 days). Guards only get their own figures.
+// @Tags patrols
+// @Produce json
+// @Param group_by query string false "guard (default) or premise"
+// @Param premise_id query string false "Premise ID"
+// @Param guard_id query string false "Guard ID"
+// @Param from query string false "Start (RFC3339)"
+// @Param to query string false "End (RFC3339)"
+// @Success 200 {object} services.PatrolComplianceReport
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/patrols/compliance [get]
+func (h *PatrolHandler) GetCompliance(c *gin.Context) {
+	query := services.PatrolComplianceQuery{GroupBy: c.Query("group_by"), To: time.Now()}
+	query.From = query.To.Add(-defaultComplianceWindow)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid from", err)
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid to", err)
+			return
+		}
+	}
+	if query.PremiseID, err = queryUUID(c, "premise_id"); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid premise_id", err)
+		return
+	}
+	if query.GuardID, err = queryUUID(c, "guard_id"); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid guard_id", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	report, err := h.service.Compliance(c.Request.Context(), query, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		patrolError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+func patrolRouteInput(req dto.PatrolRouteRequest) services.PatrolRouteInput {
+	input := services.PatrolRouteInput{
+		PremiseID:   uuid.MustParse(req.PremiseID),
+		Name:        req.Name,
+		Description: req.Description,
+		StartTimes:  req.StartTimes,
+		Timezone:    req.Timezone,
+		IsActive:    req.IsActive == nil || *req.IsActive,
+	}
+	if req.GuardID != nil {
+		guardID := uuid.MustParse(*req.GuardID)
+		input.GuardID = &guardID
+	}
+	for _, cp := range req.Checkpoints {
+		checkpoint := services.PatrolCheckpointInput{
+			Name:                  cp.Name,
+			TagCode:               cp.TagCode,
+			TagType:               models.TagType(cp.TagType),
+			ExpectedOffsetMinutes: cp.ExpectedOffsetMinutes,
+			ToleranceMinutes:      cp.ToleranceMinutes,
+			Latitude:              cp.Latitude,
+			Longitude:             cp.Longitude,
+		}
+		if cp.ID != nil {
+			id := uuid.MustParse(*cp.ID)
+			checkpoint.ID = &id
+		}
+		input.Checkpoints = append(input.Checkpoints, checkpoint)
+	}
+	return input
+}
+
+// queryUUID parses an optional UUID query parameter
+func queryUUID(c *gin.Context, name string) (*uuid.UUID, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func patrolError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrUnknownTag):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrPermissionDenied):
+		response.Error(c, http.StatusForbidden, "Access denied", err)
+	case errors.Is(err, services.ErrInvalidPatrolRoute), errors.Is(err, services.ErrInvalidGroupBy),
+		errors.Is(err, services.ErrInvalidTimeRange):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	case errors.Is(err, services.ErrDuplicateTagCode), errors.Is(err, services.ErrPatrolRouteInUse),
+		errors.Is(err, services.ErrPatrolRouteInactive), errors.Is(err, services.ErrPatrolInProgress),
+		errors.Is(err, services.ErrNoPatrolRun), errors.Is(err, services.ErrCheckpointScanned):
+		response.Error(c, http.StatusConflict, err.Error(), err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
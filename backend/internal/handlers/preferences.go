@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PreferenceHandler handles the current user's notification preferences
+type PreferenceHandler struct {
+	service services.PreferencesService
+}
+
+func NewPreferenceHandler(service services.PreferencesService) *PreferenceHandler {
+	return &PreferenceHandler{service: service}
+}
+
+// GetMyPreferences godoc
+// @Summary Get my notification preferences
+// @Description Quiet hours and, for every event, the channels it reaches the current user on with the lowest severity per channel. Events marked default follow the role's defaults.
+// @Tags preferences
+// @Produce json
+// @Success 200 {object} services.Preferences
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/preferences [get]
+func (h *PreferenceHandler) GetMyPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	prefs, err := h.service.GetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		preferenceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, prefs)
+}
+
+// UpdateMyPreferences godoc
+// @Summary Update my notification preferences
+// @Description Replace the quiet hours ("HH:MM" in timezone; past midnight when the end is earlier) and the channels of the events listed. During quiet hours nothing reaches the user on any channel, realtime included, unless critical_overrides_quiet lets critical events through. guard_sos and lone_worker_missed always reach the realtime feed, so their realtime channel must be listed without a threshold. Events: alert_created, guard_dispatched, check_in_due, guard_sos, lone_worker_missed, delivery_failed.
+// @Tags preferences
+// @Accept json
+// @Produce json
+// @Param payload body dto.PreferencesRequest true "Preferences"
+// @Success 200 {object} services.Preferences
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/preferences [put]
+func (h *PreferenceHandler) UpdateMyPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	input := services.PreferencesInput{
+		Timezone:               req.Timezone,
+		QuietHoursEnabled:      req.QuietHoursEnabled,
+		QuietHoursStart:        req.QuietHoursStart,
+		QuietHoursEnd:          req.QuietHoursEnd,
+		CriticalOverridesQuiet: req.CriticalOverridesQuiet == nil || *req.CriticalOverridesQuiet,
+		Events:                 make(map[string]models.ChannelThresholds, len(req.Events)),
+	}
+	for event, channels := range req.Events {
+		input.Events[event] = channelThresholds(channels)
+	}
+	prefs, err := h.service.UpdatePreferences(c.Request.Context(), userID, input)
+	if err != nil {
+		preferenceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, prefs)
+}
+
+// ResetMyPreferences godoc
+// @Summary Reset my notification preferences
+// @Description Remove quiet hours and return every event to the role's defaults
+// @Tags preferences
+// @Produce json
+// @Success 200 {object} services.Preferences
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/preferences [delete]
+func (h *PreferenceHandler) ResetMyPreferences(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	prefs, err := h.service.ResetPreferences(c.Request.Context(), userID)
+	if err != nil {
+		preferenceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, prefs)
+}
+
+// SetMyEventPreference godoc
+// @Summary Set my channels for an event
+// @Description Choose the channels an event reaches the current user on, e.g. {"channels":{"realtime":"","sms":"high"}} for every alert in the app and only high and critical ones by SMS. No channels turns the event off, except on the realtime feed for alert_created, guard_sos and lone_worker_missed, which must keep "realtime":"".
+// @Tags preferences
+// @Accept json
+// @Produce json
+// @Param event path string true "Event"
+// @Param payload body dto.EventPreferenceRequest true "Channels"
+// @Success 200 {object} services.Preferences
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/preferences/events/{event} [put]
+func (h *PreferenceHandler) SetMyEventPreference(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.EventPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	prefs, err := h.service.SetEventChannels(c.Request.Context(), userID, c.Param("event"), channelThresholds(req.Channels))
+	if err != nil {
+		preferenceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, prefs)
+}
+
+// ResetMyEventPreference godoc
+// @Summary Reset my channels for an event
+// @Description Return an event to the role's default channels
+// @Tags preferences
+// @Produce json
+// @Param event path string true "Event"
+// @Success 200 {object} services.Preferences
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/preferences/events/{event} [delete]
+func (h *PreferenceHandler) ResetMyEventPreference(c *gin.Context) {
+	userID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	prefs, err := h.service.ResetEvent(c.Request.Context(), userID, c.Param("event"))
+	if err != nil {
+		preferenceError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, prefs)
+}
+
+func channelThresholds(channels map[string]string) models.ChannelThresholds {
+	thresholds := make(models.ChannelThresholds, len(channels))
+	for channel, severity := range channels {
+		thresholds[models.NotificationChannel(channel)] = models.AlertSeverity(severity)
+	}
+	return thresholds
+}
+
+func preferenceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidPreferences):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
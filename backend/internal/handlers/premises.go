@@ -20,21 +20,35 @@ func NewPremiseHandler(service services.PremisesService) *PremisesHandler {
 
 // GetPremises godoc
 // @Summary Get all premises
-// @Description Retrieve all premises in the system
+// @Description List premises a page at a time, by name. Filters take comma separated values; sort keys are created_at, name and type.
 // @Tags premises
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, name and type, - for descending (e.g. type,name)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: cameras, alerts"
+// @Param type query string false "Filter by premise type"
+// @Param is_active query bool false "Filter by active flag"
 // @Success 200 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
 // @Router /api/premises [get]
 func (h *PremisesHandler) GetPremises(c *gin.Context) {
-	ctx := c.Request.Context()
-	premises, err := h.service.GetPremises(ctx)
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.GetPremises(c.Request.Context(), q)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, "Failed to fetch premises", err)
+		listError(c, err, "Failed to fetch premises")
 		return
 	}
-	response.Success(c, http.StatusOK, premises)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 }
 
 // GetPremise godoc
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PresenceHandler exposes realtime presence and connection diagnostics
+type PresenceHandler struct {
+	service services.PresenceService
+}
+
+func NewPresenceHandler(service services.PresenceService) *PresenceHandler {
+	return &PresenceHandler{service: service}
+}
+
+// GetPresence godoc
+// @Summary Get user presence
+// @Description Online status, connection count, last seen and client details per active user (SCS Operator). Changes are pushed as presence_changed events on the presence topic.
+// @Tags presence
+// @Produce json
+// @Param role query string false "Filter by role" Enums(scs_operator, security_guard)
+// @Success 200 {array} services.UserPresence
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/presence [get]
+func (h *PresenceHandler) GetPresence(c *gin.Context) {
+	presence, err := h.service.GetPresence(c.Request.Context(), c.Query("role"))
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to get presence", err)
+		return
+	}
+	response.Success(c, http.StatusOK, presence)
+}
+
+// GetConnections godoc
+// @Summary List live connections
+// @Description Every websocket and event stream connection in the cluster with its send-queue depth (SCS Operator)
+// @Tags presence
+// @Produce json
+// @Success 200 {array} websocket.ConnectionInfo
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/admin/connections [get]
+func (h *PresenceHandler) GetConnections(c *gin.Context) {
+	connections, err := h.service.GetConnections(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to list connections", err)
+		return
+	}
+	response.Success(c, http.StatusOK, connections)
+}
+
+// Disconnect godoc
+// @Summary Force-disconnect a session
+// @Description Close a live connection; the client receives session_closed with the reason first (SCS Operator)
+// @Tags presence
+// @Accept json
+// @Produce json
+// @Param id path string true "Connection ID"
+// @Param payload body dto.DisconnectRequest false "Disconnect reason"
+// @Success 200 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/admin/connections/{id} [delete]
+func (h *PresenceHandler) Disconnect(c *gin.Context) {
+	var req dto.DisconnectRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	err := h.service.Disconnect(c.Request.Context(), c.Param("id"), req.Reason, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, websocket.ErrConnectionNotFound) {
+			response.Error(c, http.StatusNotFound, "Connection not found", err)
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to disconnect", err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
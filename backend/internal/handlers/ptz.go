@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/onvif"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultPTZMoveDuration = 500 * time.Millisecond
+
+// PTZHandler handles camera pan/tilt/zoom control endpoints
+type PTZHandler struct {
+	service services.PTZService
+}
+
+func NewPTZHandler(service services.PTZService) *PTZHandler {
+	return &PTZHandler{service: service}
+}
+
+// GetLock godoc
+// @Summary Get camera control lock
+// @Description Get the operator currently controlling the camera, if any
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Success 200 {object} models.PTZLock
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/lock [get]
+func (h *PTZHandler) GetLock(c *gin.Context) {
+	lock, err := h.service.GetLock(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, lock)
+}
+
+// AcquireLock godoc
+// @Summary Acquire camera control lock
+// @Description Take exclusive PTZ control of a camera; re-acquiring extends the lease
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Success 200 {object} models.PTZLock
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/lock [post]
+func (h *PTZHandler) AcquireLock(c *gin.Context) {
+	role, _ := c.Get("role")
+	lock, err := h.service.AcquireLock(c.Request.Context(), c.Param("id"), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, lock)
+}
+
+// ReleaseLock godoc
+// @Summary Release camera control lock
+// @Description Release PTZ control of a camera held by the current operator
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/lock [delete]
+func (h *PTZHandler) ReleaseLock(c *gin.Context) {
+	role, _ := c.Get("role")
+	if err := h.service.ReleaseLock(c.Request.Context(), c.Param("id"), c.GetString("user_id"), role.(models.UserRole)); err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// Move godoc
+// @Summary Pan/tilt camera
+// @Description Move the camera at the given normalized velocity for a short duration
+// @Tags ptz
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.PTZMoveRequest true "Move payload"
+// @Success 200 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/move [post]
+func (h *PTZHandler) Move(c *gin.Context) {
+	var req dto.PTZMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	velocity := onvif.Vector{Pan: req.Pan, Tilt: req.Tilt}
+	err := h.service.Move(c.Request.Context(), c.Param("id"), velocity, moveDuration(req.DurationMs), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// Zoom godoc
+// @Summary Zoom camera
+// @Description Zoom in (positive) or out (negative) for a short duration
+// @Tags ptz
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.PTZZoomRequest true "Zoom payload"
+// @Success 200 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/zoom [post]
+func (h *PTZHandler) Zoom(c *gin.Context) {
+	var req dto.PTZZoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	velocity := onvif.Vector{Zoom: req.Zoom}
+	err := h.service.Move(c.Request.Context(), c.Param("id"), velocity, moveDuration(req.DurationMs), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// Stop godoc
+// @Summary Stop camera movement
+// @Description Stop any ongoing pan/tilt/zoom movement
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/stop [post]
+func (h *PTZHandler) Stop(c *gin.Context) {
+	role, _ := c.Get("role")
+	if err := h.service.Stop(c.Request.Context(), c.Param("id"), c.GetString("user_id"), role.(models.UserRole)); err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// GetPresets godoc
+// @Summary List camera presets
+// @Description List stored PTZ presets of a camera
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Success 200 {array} onvif.Preset
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/presets [get]
+func (h *PTZHandler) GetPresets(c *gin.Context) {
+	role, _ := c.Get("role")
+	presets, err := h.service.GetPresets(c.Request.Context(), c.Param("id"), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, presets)
+}
+
+// GotoPreset godoc
+// @Summary Go to camera preset
+// @Description Move the camera to a stored preset
+// @Tags ptz
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param token path string true "Preset token"
+// @Success 200 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/presets/{token}/goto [post]
+func (h *PTZHandler) GotoPreset(c *gin.Context) {
+	role, _ := c.Get("role")
+	err := h.service.GotoPreset(c.Request.Context(), c.Param("id"), c.Param("token"), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// SavePreset godoc
+// @Summary Save camera preset
+// @Description Store the current camera position as a named preset
+// @Tags ptz
+// @Accept json
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param payload body dto.SavePresetRequest true "Preset payload"
+// @Success 201 {object} onvif.Preset
+// @Failure 400 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/ptz/presets [post]
+func (h *PTZHandler) SavePreset(c *gin.Context) {
+	var req dto.SavePresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	preset, err := h.service.SavePreset(c.Request.Context(), c.Param("id"), req.Name, c.GetString("user_id"), role.(models.UserRole))
+	if err != nil {
+		ptzError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, preset)
+}
+
+func moveDuration(ms int) time.Duration {
+	if ms == 0 {
+		return defaultPTZMoveDuration
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func ptzError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Camera not found", err)
+	case errors.Is(err, services.ErrPTZNotSupported), errors.Is(err, services.ErrPresetsNotSupported):
+		response.Error(c, http.StatusBadRequest, "Unsupported camera operation", err)
+	case errors.Is(err, services.ErrCameraLocked), errors.Is(err, services.ErrLockNotHeld):
+		response.Error(c, http.StatusConflict, "Camera control conflict", err)
+	default:
+		response.Error(c, http.StatusBadGateway, "Camera command failed", err)
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultClipBefore = 30 * time.Second
+	defaultClipAfter  = 60 * time.Second
+	maxClipWindow     = 10 * time.Minute
+)
+
+// RecordingHandler handles recording catalogue and clip endpoints
+type RecordingHandler struct {
+	service services.RecordingsService
+	alerts  services.AlertsService
+	cameras services.CameraService
+}
+
+func NewRecordingHandler(service services.RecordingsService, alerts services.AlertsService, cameras services.CameraService) *RecordingHandler {
+	return &RecordingHandler{service: service, alerts: alerts, cameras: cameras}
+}
+
+// GetCameraRecordings godoc
+// @Summary Get camera recordings
+// @Description List recorded segments of a camera in a time range (defaults to the last hour)
+// @Tags recordings
+// @Produce json
+// @Param id path string true "Camera ID"
+// @Param from query string false "Start (RFC3339)"
+// @Param to query string false "End (RFC3339)"
+// @Success 200 {array} models.RecordingSegment
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/cameras/{id}/recordings [get]
+func (h *RecordingHandler) GetCameraRecordings(c *gin.Context) {
+	role, _ := c.Get("role")
+	camera, err := h.cameras.GetByID(c.Request.Context(), c.Param("id"), c.GetString("user_id"), role.(models.UserRole))
+	if err != nil || camera == nil {
+		response.Error(c, http.StatusNotFound, "Camera not found", err)
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid from", err)
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid to", err)
+			return
+		}
+	}
+
+	segments, err := h.service.GetSegments(c.Request.Context(), camera.ID.String(), from, to)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch recordings", err)
+		return
+	}
+	response.Success(c, http.StatusOK, segments)
+}
+
+// GetAlertClip godoc
+// @Summary Download alert clip
+// @Description Assemble the recorded footage around an alert into a single MPEG-TS clip
+// @Tags recordings
+// @Produce video/mp2t
+// @Param id path string true "Alert ID"
+// @Param before query string false "Footage before the alert (Go duration, default 30s)"
+// @Param after query string false "Footage after the alert (Go duration, default 60s)"
+// @Success 200 {file} binary
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 502 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/alerts/{id}/clip [get]
+func (h *RecordingHandler) GetAlertClip(c *gin.Context) {
+	before, err := clipDuration(c.Query("before"), defaultClipBefore)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid before", err)
+		return
+	}
+	after, err := clipDuration(c.Query("after"), defaultClipAfter)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid after", err)
+		return
+	}
+
+	role, _ := c.Get("role")
+	alert, err := h.alerts.GetAlert(c.Request.Context(), c.Param("id"), role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Alert not found", err)
+		return
+	}
+
+	segments, err := h.service.GetClipSegments(c.Request.Context(), alert, before, after)
+	if err != nil {
+		if errors.Is(err, services.ErrNoRecordings) {
+			response.Error(c, http.StatusNotFound, "No recordings for this alert", err)
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch recordings", err)
+		return
+	}
+
+	clip, err := h.service.OpenClip(c.Request.Context(), segments)
+	if err != nil {
+		if errors.Is(err, services.ErrNoRecordings) {
+			response.Error(c, http.StatusNotFound, "Recording no longer available", err)
+			return
+		}
+		response.Error(c, http.StatusBadGateway, "Failed to open recording", err)
+		return
+	}
+	defer clip.Close()
+
+	c.Header("Content-Type", "video/mp2t")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="alert-%s.ts"`, alert.ID))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, clip); err != nil {
+		log.Printf("Failed to stream clip for alert %s: %v", alert.ID, err)
+	}
+}
+
+// GetRetentionPolicy godoc
+// @Summary Get premise retention policy
+// @Description Get how long recordings of a premise are kept
+// @Tags recordings
+// @Produce json
+// @Param id path string true "Premise ID"
+// @Success 200 {object} models.RetentionPolicy
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/premises/{id}/retention [get]
+func (h *RecordingHandler) GetRetentionPolicy(c *gin.Context) {
+	premiseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	policy, err := h.service.GetRetentionPolicy(c.Request.Context(), premiseID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch retention policy", err)
+		return
+	}
+	response.Success(c, http.StatusOK, policy)
+}
+
+// UpdateRetentionPolicy godoc
+// @Summary Update premise retention policy
+// @Description Set how long recordings of a premise (and footage around alerts) are kept
+// @Tags recordings
+// @Accept json
+// @Produce json
+// @Param id path string true "Premise ID"
+// @Param payload body dto.UpdateRetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} models.RetentionPolicy
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/premises/{id}/retention [put]
+func (h *RecordingHandler) UpdateRetentionPolicy(c *gin.Context) {
+	premiseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	var req dto.UpdateRetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	policy, err := h.service.SetRetentionPolicy(c.Request.Context(), premiseID, req.RetentionDays, req.AlertRetentionDays)
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Premise not found", err)
+		return
+	}
+	response.Success(c, http.StatusOK, policy)
+}
+
+func clipDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 || d > maxClipWindow {
+		return 0, fmt.Errorf("must be between 0 and %s", maxClipWindow)
+	}
+	return d, nil
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReportHandler handles report schedules and the report archive
+type ReportHandler struct {
+	service services.ReportsService
+}
+
+func NewReportHandler(service services.ReportsService) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// GetSchedules godoc
+// @Summary Get report schedules
+// @Description List report schedules (SCS Operator)
+// @Tags reports
+// @Produce json
+// @Success 200 {array} models.ReportSchedule
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules [get]
+func (h *ReportHandler) GetSchedules(c *gin.Context) {
+	schedules, err := h.service.ListSchedules(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch report schedules", err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedules)
+}
+
+// GetSchedule godoc
+// @Summary Get report schedule
+// @Description Get a report schedule with its next run (SCS Operator)
+// @Tags reports
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.ReportSchedule
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules/{id} [get]
+func (h *ReportHandler) GetSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report schedule not found", err)
+		return
+	}
+	schedule, err := h.service.GetSchedule(c.Request.Context(), id)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedule)
+}
+
+// CreateSchedule godoc
+// @Summary Create report schedule
+// @Description Schedule a report (SCS Operator). cron is a five-field expression (minute hour day-of-month month day-of-week, or @daily, @weekly...) evaluated in timezone. Each run covers the time since the previous one and is emailed to the recipients.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param payload body dto.ReportScheduleRequest true "Schedule"
+// @Success 201 {object} models.ReportSchedule
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules [post]
+func (h *ReportHandler) CreateSchedule(c *gin.Context) {
+	var req dto.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	schedule, err := h.service.CreateSchedule(c.Request.Context(), reportScheduleInput(req), c.GetString("user_id"))
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, schedule)
+}
+
+// UpdateSchedule godoc
+// @Summary Update report schedule
+// @Description Replace a report schedule; the next run is recalculated (SCS Operator)
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param payload body dto.ReportScheduleRequest true "Schedule"
+// @Success 200 {object} models.ReportSchedule
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules/{id} [put]
+func (h *ReportHandler) UpdateSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report schedule not found", err)
+		return
+	}
+	var req dto.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	schedule, err := h.service.UpdateSchedule(c.Request.Context(), id, reportScheduleInput(req), c.GetString("user_id"))
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, schedule)
+}
+
+// DeleteSchedule godoc
+// @Summary Delete report schedule
+// @Description Delete a report schedule. Reports it generated stay in the archive. (SCS Operator)
+// @Tags reports
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules/{id} [delete]
+func (h *ReportHandler) DeleteSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report schedule not found", err)
+		return
+	}
+	if err := h.service.DeleteSchedule(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// RunSchedule godoc
+// @Summary Run report schedule now
+// @Description Generate and email a schedule's report now, covering the time since its last run; the next scheduled run is unchanged (SCS Operator)
+// @Tags reports
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 201 {object} models.Report
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/report-schedules/{id}/run [post]
+func (h *ReportHandler) RunSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report schedule not found", err)
+		return
+	}
+	report, err := h.service.RunSchedule(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, report)
+}
+
+// GenerateReport godoc
+// @Summary Generate report
+// @Description Generate a report on demand and archive it, emailing it to any recipients given (SCS Operator). Without from, a shift handover covers 12 hours, a premise summary 7 days and an incident report 24 hours.
+// @Tags reports
+// @Accept json
+// @Produce json
+// @Param payload body dto.GenerateReportRequest true "Report"
+// @Success 201 {object} models.Report
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/reports [post]
+func (h *ReportHandler) GenerateReport(c *gin.Context) {
+	var req dto.GenerateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	input := services.ReportRequest{
+		Kind:       models.ReportKind(req.Kind),
+		Format:     models.ReportFormat(req.Format),
+		PremiseID:  optionalUUID(req.PremiseID),
+		Timezone:   req.Timezone,
+		Recipients: req.Recipients,
+	}
+	if req.From != nil {
+		input.From = *req.From
+	}
+	if req.To != nil {
+		input.To = *req.To
+	}
+	report, err := h.service.Generate(c.Request.Context(), input, c.GetString("user_id"))
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, report)
+}
+
+// GetReports godoc
+// @Summary Get reports
+// @Description List archived reports, newest first (SCS Operator). Filters: kind, format, premise_id, schedule_id, delivery_status; sort by created_at or period_start; expand=premise.
+// @Tags reports
+// @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at and period_start, - for descending (e.g. -period_start)"
+// @Param kind query string false "Comma separated kinds"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Param schedule_id query string false "Comma separated schedule IDs"
+// @Success 200 {array} models.Report
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/reports [get]
+func (h *ReportHandler) GetReports(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.ListReports(c.Request.Context(), q)
+	if err != nil {
+		listError(c, err, "Failed to fetch reports")
+		return
+	}
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
+}
+
+// GetReport godoc
+// @Summary Get report
+// @Description Get an archived report's details and delivery status (SCS Operator)
+// @Tags reports
+// @Produce json
+// @Param id path string true "Report ID"
+// @Success 200 {object} models.Report
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/reports/{id} [get]
+func (h *ReportHandler) GetReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report not found", err)
+		return
+	}
+	report, err := h.service.GetReport(c.Request.Context(), id)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// DownloadReport godoc
+// @Summary Download report
+// @Description Download an archived report as PDF or CSV (SCS Operator)
+// @Tags reports
+// @Produce application/pdf
+// @Produce text/csv
+// @Param id path string true "Report ID"
+// @Success 200 {file} binary
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/reports/{id}/download [get]
+func (h *ReportHandler) DownloadReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Report not found", err)
+		return
+	}
+	report, r, err := h.service.OpenReport(c.Request.Context(), id)
+	if err != nil {
+		reportError(c, err)
+		return
+	}
+	defer r.Close()
+
+	c.Header("Content-Type", report.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(report.SizeBytes, 10))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, report.FileName))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, r)
+}
+
+func reportScheduleInput(req dto.ReportScheduleRequest) services.ReportScheduleInput {
+	input := services.ReportScheduleInput{
+		Name:       req.Name,
+		Kind:       models.ReportKind(req.Kind),
+		Format:     models.ReportFormat(req.Format),
+		PremiseID:  optionalUUID(req.PremiseID),
+		Cron:       req.Cron,
+		Timezone:   req.Timezone,
+		Recipients: req.Recipients,
+		IsActive:   true,
+	}
+	if req.IsActive != nil {
+		input.IsActive = *req.IsActive
+	}
+	return input
+}
+
+// optionalUUID converts an optional ID already validated by binding
+func optionalUUID(value *string) *uuid.UUID {
+	if value == nil {
+		return nil
+	}
+	id := uuid.MustParse(*value)
+	return &id
+}
+
+func reportError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidReport), errors.Is(err, services.ErrInvalidAnalyticsQuery):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
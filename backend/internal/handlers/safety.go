@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SafetyHandler handles guard SOS and lone-worker check-ins
+type SafetyHandler struct {
+	service services.SafetyService
+}
+
+func NewSafetyHandler(service services.SafetyService) *SafetyHandler {
+	return &SafetyHandler{service: service}
+}
+
+// RaiseSOS godoc
+// @Summary Raise SOS
+// @Description Panic button for the authenticated guard. Sends every operator a guard_sos message that must be acknowledged, then raises a critical guard_distress alert at the guard's position (or last reported location). When the alert cannot be raised, for example because no premise can be found for the guard, operators have still been alerted and 202 is returned.
+// @Tags safety
+// @Accept json
+// @Produce json
+// @Param payload body dto.SOSRequest false "Position and message"
+// @Success 201 {object} models.Alert
+// @Success 202 {object} response.ApiResponse
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/sos [post]
+func (h *SafetyHandler) RaiseSOS(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	// The body is optional so that a bare POST always raises the alarm
+	var req dto.SOSRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	alert, err := h.service.RaiseSOS(c.Request.Context(), guardID, services.SOSRequest{
+		Fix:     guardFix(req.Latitude, req.Longitude, req.Accuracy),
+		Message: req.Message,
+	})
+	if errors.Is(err, services.ErrSOSNotRecorded) {
+		response.Error(c, http.StatusAccepted, "Operators alerted", err)
+		return
+	}
+	if err != nil {
+		safetyError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, alert)
+}
+
+// GetMyLoneWorker godoc
+// @Summary Get lone-worker session
+// @Description The authenticated guard's open lone-worker session
+// @Tags safety
+// @Produce json
+// @Success 200 {object} models.LoneWorkerSession
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/lone-worker [get]
+func (h *SafetyHandler) GetMyLoneWorker(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	session, err := h.service.GetLoneWorker(c.Request.Context(), guardID)
+	if err != nil {
+		safetyError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, session)
+}
+
+// StartLoneWorker godoc
+// @Summary Start lone-worker mode
+// @Description Require check-ins every interval_minutes. A missed check-in first sends the guard check_in_due, then after the grace period raises a missed_check_in alert and sends operators lone_worker_missed. Starting again changes the interval.
+// @Tags safety
+// @Accept json
+// @Produce json
+// @Param payload body dto.StartLoneWorkerRequest true "Check-in interval"
+// @Success 200 {object} models.LoneWorkerSession
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/lone-worker [post]
+func (h *SafetyHandler) StartLoneWorker(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.StartLoneWorkerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	session, err := h.service.StartLoneWorker(c.Request.Context(), guardID, req.IntervalMinutes)
+	if err != nil {
+		safetyError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, session)
+}
+
+// CheckIn godoc
+// @Summary Lone-worker check-in
+// @Description Reset the check-in timer, optionally reporting the current position
+// @Tags safety
+// @Accept json
+// @Produce json
+// @Param payload body dto.CheckInRequest false "Position"
+// @Success 200 {object} models.LoneWorkerSession
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/lone-worker/check-in [post]
+func (h *SafetyHandler) CheckIn(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	var req dto.CheckInRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	session, err := h.service.CheckIn(c.Request.Context(), guardID, guardFix(req.Latitude, req.Longitude, req.Accuracy))
+	if err != nil {
+		safetyError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, session)
+}
+
+// EndLoneWorker godoc
+// @Summary End lone-worker mode
+// @Description Stop requiring check-ins
+// @Tags safety
+// @Produce json
+// @Success 200 {object} models.LoneWorkerSession
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/auth/me/lone-worker [delete]
+func (h *SafetyHandler) EndLoneWorker(c *gin.Context) {
+	guardID, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		response.Error(c, http.StatusUnauthorized, "Invalid user", err)
+		return
+	}
+	session, err := h.service.EndLoneWorker(c.Request.Context(), guardID)
+	if err != nil {
+		safetyError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, session)
+}
+
+// GetLoneWorkers godoc
+// @Summary List lone workers
+// @Description Open lone-worker sessions, soonest check-in first (SCS Operator). Changes are published on the safety topic.
+// @Tags safety
+// @Produce json
+// @Success 200 {array} models.LoneWorkerSession
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/lone-workers [get]
+func (h *SafetyHandler) GetLoneWorkers(c *gin.Context) {
+	sessions, err := h.service.ListLoneWorkers(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to list lone workers", err)
+		return
+	}
+	response.Success(c, http.StatusOK, sessions)
+}
+
+// guardFix converts an optional position from a request
+func guardFix(lat, lon, accuracy *float64) *services.GuardFix {
+	if lat == nil || lon == nil {
+		return nil
+	}
+	return &services.GuardFix{Latitude: *lat, Longitude: *lon, Accuracy: accuracy}
+}
+
+func safetyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoLoneWorkerSession), errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidCheckInWindow):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	case errors.Is(err, services.ErrNoGuardPremise):
+		response.Error(c, http.StatusUnprocessableEntity, "No premise for guard", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SearchHandler handles full-text search
+type SearchHandler struct {
+	service services.SearchService
+}
+
+func NewSearchHandler(service services.SearchService) *SearchHandler {
+	return &SearchHandler{service: service}
+}
+
+// Search godoc
+// @Summary Search
+// @Description Full-text search over alert titles and descriptions, incident descriptions, incident updates, camera names and premise names, best matches first. q takes web-search syntax: "quoted phrases", or, -excluded. Snippets are HTML with matches in <mark>. Guards only find what they are assigned to.
+// @Tags search
+// @Produce json
+// @Param q query string true "Search text"
+// @Param types query string false "Comma separated: alert, incident, incident_update, camera, premise"
+// @Param premise_id query string false "Comma separated premise IDs"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param limit query int false "Max hits (default 20, max 100)"
+// @Success 200 {object} services.SearchResults
+// @Failure 400 {object} response.ApiResponse
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/search [get]
+func (h *SearchHandler) Search(c *gin.Context) {
+	q := services.SearchQuery{
+		Text:  c.Query("q"),
+		Types: splitList(c.QueryArray("types")),
+	}
+	for _, raw := range splitList(c.QueryArray("premise_id")) {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid query", errors.New("premise_id must be UUIDs"))
+			return
+		}
+		q.PremiseIDs = append(q.PremiseIDs, id)
+	}
+	var err error
+	if q.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	if q.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	if raw := c.Query("limit"); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 1 {
+			response.Error(c, http.StatusBadRequest, "Invalid query", errors.New("limit must be a positive integer"))
+			return
+		}
+	}
+
+	role, _ := c.Get("role")
+	results, err := h.service.Search(c.Request.Context(), q, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSearch) {
+			response.Error(c, http.StatusBadRequest, "Invalid query", err)
+			return
+		}
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+		return
+	}
+	response.Success(c, http.StatusOK, results)
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SOPHandler handles SOP templates and incident checklists
+type SOPHandler struct {
+	service services.SOPService
+}
+
+func NewSOPHandler(service services.SOPService) *SOPHandler {
+	return &SOPHandler{service: service}
+}
+
+// GetTemplates godoc
+// @Summary Get SOP templates
+// @Description List SOP templates with their steps
+// @Tags sop
+// @Produce json
+// @Success 200 {array} models.SOPTemplate
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/sop-templates [get]
+func (h *SOPHandler) GetTemplates(c *gin.Context) {
+	templates, err := h.service.ListTemplates(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch SOP templates", err)
+		return
+	}
+	response.Success(c, http.StatusOK, templates)
+}
+
+// GetTemplate godoc
+// @Summary Get SOP template
+// @Description Get an SOP template with its steps in order
+// @Tags sop
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.SOPTemplate
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/sop-templates/{id} [get]
+func (h *SOPHandler) GetTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "SOP template not found", err)
+		return
+	}
+	template, err := h.service.GetTemplate(c.Request.Context(), id)
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, template)
+}
+
+// CreateTemplate godoc
+// @Summary Create SOP template
+// @Description Create an SOP template. alert_type, premise_type and severity are optional keys; an incident gets the most specific active template matching its alert when the alert is assigned.
+// @Tags sop
+// @Accept json
+// @Produce json
+// @Param payload body dto.SOPTemplateRequest true "Template"
+// @Success 201 {object} models.SOPTemplate
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/sop-templates [post]
+func (h *SOPHandler) CreateTemplate(c *gin.Context) {
+	var req dto.SOPTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	template, err := h.service.CreateTemplate(c.Request.Context(), sopTemplateInput(req), c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, template)
+}
+
+// UpdateTemplate godoc
+// @Summary Update SOP template
+// @Description Replace an SOP template and its steps. Checklists already on incidents are not changed.
+// @Tags sop
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param payload body dto.SOPTemplateRequest true "Template"
+// @Success 200 {object} models.SOPTemplate
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/sop-templates/{id} [put]
+func (h *SOPHandler) UpdateTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "SOP template not found", err)
+		return
+	}
+	var req dto.SOPTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	template, err := h.service.UpdateTemplate(c.Request.Context(), id, sopTemplateInput(req), c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, template)
+}
+
+// DeleteTemplate godoc
+// @Summary Delete SOP template
+// @Description Delete an SOP template. Checklists already on incidents are kept.
+// @Tags sop
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/sop-templates/{id} [delete]
+func (h *SOPHandler) DeleteTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "SOP template not found", err)
+		return
+	}
+	if err := h.service.DeleteTemplate(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// GetChecklist godoc
+// @Summary Get incident checklist
+// @Description The SOP checklist of an incident, with the number of mandatory steps outstanding and whether it can be resolved; guards must be assigned
+// @Tags sop
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Success 200 {object} services.IncidentChecklist
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/checklist [get]
+func (h *SOPHandler) GetChecklist(c *gin.Context) {
+	role, _ := c.Get("role")
+	checklist, err := h.service.GetChecklist(c.Request.Context(), c.Param("id"), role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, checklist)
+}
+
+// CompleteStep godoc
+// @Summary Complete checklist step
+// @Description Tick a checklist step. Steps that require a photo take a multipart form with a photo file; published as incident_checklist_updated.
+// @Tags sop
+// @Accept json
+// @Accept mpfd
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param item_id path string true "Checklist item ID"
+// @Param payload body dto.CompleteChecklistStepRequest false "Note"
+// @Param photo formData file false "Photo (image)"
+// @Success 200 {object} models.IncidentChecklistItem
+// @Failure 400 {object} response.ApiResponse
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/checklist/items/{item_id}/complete [post]
+func (h *SOPHandler) CompleteStep(c *gin.Context) {
+	var req dto.CompleteChecklistStepRequest
+	var completion services.StepCompletion
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBind(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+		if fileHeader, err := c.FormFile("photo"); err == nil {
+			file, err := fileHeader.Open()
+			if err != nil {
+				response.Error(c, http.StatusBadRequest, "Invalid photo", err)
+				return
+			}
+			defer file.Close()
+			completion.Photo = &services.AttachmentUpload{FileName: fileHeader.Filename, Reader: file}
+		}
+	} else if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+			return
+		}
+	}
+	completion.Note = req.Note
+
+	role, _ := c.Get("role")
+	item, err := h.service.CompleteStep(c.Request.Context(), c.Param("id"), c.Param("item_id"), completion, role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, item)
+}
+
+// ReopenStep godoc
+// @Summary Reopen checklist step
+// @Description Untick a checklist step of an incident that is not resolved
+// @Tags sop
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param item_id path string true "Checklist item ID"
+// @Success 200 {object} models.IncidentChecklistItem
+// @Failure 403 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/checklist/items/{item_id}/complete [delete]
+func (h *SOPHandler) ReopenStep(c *gin.Context) {
+	role, _ := c.Get("role")
+	item, err := h.service.ReopenStep(c.Request.Context(), c.Param("id"), c.Param("item_id"), role.(models.UserRole), c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, item)
+}
+
+// OverrideChecklist godoc
+// @Summary Override incident checklist
+// @Description Allow the incident to be resolved with mandatory steps outstanding (SCS Operator). The reason is kept on the incident and in the audit log.
+// @Tags sop
+// @Accept json
+// @Produce json
+// @Param id path string true "Incident ID"
+// @Param payload body dto.ChecklistOverrideRequest true "Reason"
+// @Success 200 {object} services.IncidentChecklist
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/incidents/{id}/checklist/override [post]
+func (h *SOPHandler) OverrideChecklist(c *gin.Context) {
+	var req dto.ChecklistOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	checklist, err := h.service.OverrideChecklist(c.Request.Context(), c.Param("id"), req.Reason, c.GetString("user_id"))
+	if err != nil {
+		sopError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, checklist)
+}
+
+func sopTemplateInput(req dto.SOPTemplateRequest) services.SOPTemplateInput {
+	input := services.SOPTemplateInput{
+		Name:        req.Name,
+		Description: req.Description,
+		AlertType:   models.AlertType(req.AlertType),
+		PremiseType: models.PremiseType(req.PremiseType),
+		Severity:    models.AlertSeverity(req.Severity),
+		IsActive:    req.IsActive == nil || *req.IsActive,
+	}
+	for _, step := range req.Steps {
+		input.Steps = append(input.Steps, services.SOPStepInput{
+			Title:         step.Title,
+			Instructions:  step.Instructions,
+			Mandatory:     step.Mandatory,
+			RequiresPhoto: step.RequiresPhoto,
+		})
+	}
+	return input
+}
+
+func sopError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrChecklistItemNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrPermissionDenied):
+		response.Error(c, http.StatusForbidden, "Access denied", err)
+	case errors.Is(err, services.ErrInvalidSOPTemplate), errors.Is(err, services.ErrPhotoRequired), errors.Is(err, services.ErrInvalidPhoto):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	case errors.Is(err, services.ErrIncidentClosed):
+		response.Error(c, http.StatusConflict, "Incident is closed", err)
+	case errors.Is(err, services.ErrIncidentReportLocked):
+		response.Error(c, http.StatusConflict, "Incident report is finalized", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
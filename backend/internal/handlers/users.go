@@ -22,11 +22,22 @@ func NewUserHandler(service services.UserService) *UserHandler {
 
 // GetUsers godoc
 // @Summary Get all users
-// @Description Get a list of all users (SCS Operator only)
+// @Description List users a page at a time, by username (SCS Operator only). Filters take comma separated values; sort keys are created_at, username, last_name and role.
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param sort query string false "Comma separated sort keys of created_at, username, last_name and role, - for descending (e.g. role,-created_at)"
+// @Param created_after query string false "Created at or after (RFC 3339)"
+// @Param created_before query string false "Created before (RFC 3339)"
+// @Param fields query string false "Comma separated fields to return"
+// @Param expand query string false "Relations to include: camera_assignments, incident_assignments"
+// @Param role query string false "Filter by role"
+// @Param is_active query bool false "Filter by active flag"
+// @Param on_duty query bool false "Filter by on-duty flag"
 // @Success 200 {array} models.User
+// @Failure 400 {object} response.ApiResponse
 // @Failure 403 {object} response.ApiResponse
 // @Failure 500 {object} response.ApiResponse
 // @Security BearerAuth
@@ -37,17 +48,18 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 		response.Error(c, http.StatusUnauthorized, "Role not found", nil)
 		return
 	}
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
 
-	users, err := h.service.GetAll(c.Request.Context(), role.(models.UserRole))
+	page, err := h.service.GetAll(c.Request.Context(), q, role.(models.UserRole))
 	if err != nil {
-		if err.Error() == "permission denied" {
-			response.Error(c, http.StatusForbidden, "Insufficient permissions", err)
-			return
-		}
-		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+		listError(c, err, "Internal Server")
 		return
 	}
-	response.Success(c, http.StatusOK, users)
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
 }
 
 // GetUsersByAssignedCamera godoc
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookHandler handles outbound webhook subscriptions and their deliveries
+type WebhookHandler struct {
+	service services.WebhooksService
+}
+
+func NewWebhookHandler(service services.WebhooksService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// GetWebhooks godoc
+// @Summary Get webhooks
+// @Description List webhook subscriptions (SCS Operator). Secrets are never returned here.
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription
+// @Failure 500 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks [get]
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	subscriptions, err := h.service.ListWebhooks(c.Request.Context())
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, "Failed to fetch webhooks", err)
+		return
+	}
+	response.Success(c, http.StatusOK, subscriptions)
+}
+
+// GetWebhook godoc
+// @Summary Get webhook
+// @Description Get a webhook subscription, with its failure count and why it was disabled if it was (SCS Operator)
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	subscription, err := h.service.GetWebhook(c.Request.Context(), id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, subscription)
+}
+
+// CreateWebhook godoc
+// @Summary Create webhook
+// @Description Subscribe a URL to alert and incident events (SCS Operator). Events: alert_created, alert_acknowledged, alert_assigned, alert_updated, incident_updated, incident_update_received; omit event_types or premise_ids for all. Each request is a JSON POST of {id, type, created_at, premise_id, data} signed with HMAC-SHA256 in X-SCS-Signature ("sha256=" + hex of "<X-SCS-Timestamp>.<body>"). URLs on loopback, private or link-local addresses are refused unless the server allows private targets. The secret is returned only here and on rotation.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param payload body dto.WebhookRequest true "Webhook"
+// @Success 201 {object} services.WebhookWithSecret
+// @Failure 400 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks [post]
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req dto.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	created, err := h.service.CreateWebhook(c.Request.Context(), webhookInput(req), c.GetString("user_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusCreated, created)
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook
+// @Description Replace a webhook subscription (SCS Operator). Setting active to true re-enables a disabled webhook and clears its failure count.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param payload body dto.WebhookRequest true "Webhook"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req dto.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	subscription, err := h.service.UpdateWebhook(c.Request.Context(), id, webhookInput(req), c.GetString("user_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, subscription)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete a webhook subscription with its deliveries (SCS Operator)
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteWebhook(c.Request.Context(), id, c.GetString("user_id")); err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, nil)
+}
+
+// RotateWebhookSecret godoc
+// @Summary Rotate webhook secret
+// @Description Replace the signing secret (SCS Operator). Requests are signed with the new secret from the next attempt on.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} services.WebhookWithSecret
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id}/rotate-secret [post]
+func (h *WebhookHandler) RotateWebhookSecret(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	rotated, err := h.service.RotateSecret(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, rotated)
+}
+
+// PingWebhook godoc
+// @Summary Ping webhook
+// @Description Queue a ping event to check the receiver and its signature verification (SCS Operator)
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id}/ping [post]
+func (h *WebhookHandler) PingWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	delivery, err := h.service.Ping(c.Request.Context(), id, c.GetString("user_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusAccepted, delivery)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description A webhook's deliveries, newest first (SCS Operator). Filters: status (pending, delivered, failed), event_type, event_id.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param status query string false "Comma separated statuses"
+// @Param event_type query string false "Comma separated event types"
+// @Param event_id query string false "Comma separated event IDs"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} response.ApiResponse
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	q, err := parseListQuery(c)
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	page, err := h.service.ListDeliveries(c.Request.Context(), id, q)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			webhookError(c, err)
+			return
+		}
+		listError(c, err, "Failed to fetch deliveries")
+		return
+	}
+	response.SuccessPage(c, http.StatusOK, page.Data, page.NextCursor)
+}
+
+// GetWebhookDelivery godoc
+// @Summary Get webhook delivery
+// @Description A delivery with the payload sent and every attempt: status code, duration, error and the start of the response (SCS Operator)
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 404 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id}/deliveries/{delivery_id} [get]
+func (h *WebhookHandler) GetWebhookDelivery(c *gin.Context) {
+	id, deliveryID, ok := webhookDeliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, err := h.service.GetDelivery(c.Request.Context(), id, deliveryID)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, delivery)
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver webhook
+// @Description Send a delivery again with the same event ID and payload and a fresh set of attempts (SCS Operator). The webhook must be active.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 404 {object} response.ApiResponse
+// @Failure 409 {object} response.ApiResponse
+// @Security BearerAuth
+// @Router /api/webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	id, deliveryID, ok := webhookDeliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, err := h.service.Redeliver(c.Request.Context(), id, deliveryID, c.GetString("user_id"))
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, http.StatusAccepted, delivery)
+}
+
+func webhookInput(req dto.WebhookRequest) services.WebhookInput {
+	return services.WebhookInput{
+		Name:       req.Name,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		PremiseIDs: req.PremiseIDs,
+		Active:     req.Active,
+	}
+}
+
+func webhookID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Webhook not found", err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func webhookDeliveryID(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	id, ok := webhookID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		response.Error(c, http.StatusNotFound, "Delivery not found", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, deliveryID, true
+}
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.Error(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, services.ErrInvalidWebhook):
+		response.Error(c, http.StatusBadRequest, "Invalid request", err)
+	case errors.Is(err, services.ErrWebhookDisabled):
+		response.Error(c, http.StatusConflict, "Webhook is disabled", err)
+	default:
+		response.Error(c, http.StatusInternalServerError, "Internal Server", err)
+	}
+}
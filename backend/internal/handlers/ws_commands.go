@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Websocket command types
+const (
+	CommandAlertAcknowledge     = "alert.acknowledge"
+	CommandIncidentUpdateStatus = "incident.update_status"
+	CommandIncidentAddUpdate    = "incident.add_update"
+	CommandIncidentSendMessage  = "incident.send_message"
+	CommandIncidentMarkRead     = "incident.mark_read"
+	CommandGuardSOS             = "guard.sos"
+	CommandGuardCheckIn         = "guard.check_in"
+	CommandPatrolScan           = "patrol.scan"
+)
+
+// WSCommandRouter executes websocket commands through the same services as
+// the REST handlers, so authorization, persistence and auditing are shared
+type WSCommandRouter struct {
+	alerts    services.AlertsService
+	incidents services.IncidentsService
+	messages  services.IncidentMessagesService
+	safety    services.SafetyService
+	patrols   services.PatrolsService
+}
+
+func NewWSCommandRouter(alerts services.AlertsService, incidents services.IncidentsService, messages services.IncidentMessagesService, safety services.SafetyService, patrols services.PatrolsService) *WSCommandRouter {
+	return &WSCommandRouter{alerts: alerts, incidents: incidents, messages: messages, safety: safety, patrols: patrols}
+}
+
+func (r *WSCommandRouter) HandleCommand(ctx context.Context, userID, role string, cmd websocket.Command) (any, error) {
+	userRole := models.UserRole(role)
+
+	switch cmd.Type {
+	case CommandAlertAcknowledge:
+		var req dto.AcknowledgeAlertCommand
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		alert, err := r.alerts.AcknowledgeAlert(ctx, req.AlertID, userRole, userID)
+		return alert, commandError(err)
+
+	case CommandIncidentUpdateStatus:
+		var req dto.UpdateIncidentStatusCommand
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		incident, err := r.incidents.UpdateIncident(ctx, req.IncidentID, models.IncidentStatus(req.Status), userRole, userID)
+		return incident, commandError(err)
+
+	case CommandIncidentAddUpdate:
+		var req dto.AddIncidentUpdateCommand
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		update := models.IncidentUpdate{
+			Type:      models.UpdateType(req.Type),
+			Message:   req.Message,
+			MediaURLs: req.MediaURLs,
+			Location:  req.Location,
+		}
+		saved, err := r.incidents.AddIncidentUpdate(ctx, req.IncidentID, update, userRole, userID)
+		return saved, commandError(err)
+
+	case CommandIncidentSendMessage:
+		var req dto.SendIncidentMessageCommand
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		message, err := r.messages.SendMessage(ctx, req.IncidentID, services.NewIncidentMessage{
+			Body:         req.Body,
+			QuickReplyID: req.QuickReplyID,
+		}, userRole, userID)
+		return message, commandError(err)
+
+	case CommandIncidentMarkRead:
+		var req dto.MarkMessagesReadCommand
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		receipt, err := r.messages.MarkRead(ctx, req.IncidentID, req.MessageID, userRole, userID)
+		return receipt, commandError(err)
+
+	case CommandGuardSOS:
+		var req dto.SOSRequest
+		if err := decodeOptionalCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		guardID, err := guardCommandUser(userRole, userID)
+		if err != nil {
+			return nil, err
+		}
+		alert, err := r.safety.RaiseSOS(ctx, guardID, services.SOSRequest{
+			Fix:     guardFix(req.Latitude, req.Longitude, req.Accuracy),
+			Message: req.Message,
+		})
+		return alert, commandError(err)
+
+	case CommandGuardCheckIn:
+		var req dto.CheckInRequest
+		if err := decodeOptionalCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		guardID, err := guardCommandUser(userRole, userID)
+		if err != nil {
+			return nil, err
+		}
+		session, err := r.safety.CheckIn(ctx, guardID, guardFix(req.Latitude, req.Longitude, req.Accuracy))
+		return session, commandError(err)
+
+	case CommandPatrolScan:
+		var req dto.PatrolScanRequest
+		if err := decodeCommand(cmd, &req); err != nil {
+			return nil, err
+		}
+		guardID, err := guardCommandUser(userRole, userID)
+		if err != nil {
+			return nil, err
+		}
+		run, err := r.patrols.Scan(ctx, guardID, services.PatrolScan{
+			TagCode: req.TagCode,
+			Fix:     guardFix(req.Latitude, req.Longitude, req.Accuracy),
+		})
+		return run, commandError(err)
+	}
+	return nil, websocket.NewCommandError(websocket.ErrCodeUnknownCommand, "unknown command type "+cmd.Type)
+}
+
+// decodeCommand unmarshals and validates a command payload with the same
+// binding rules used for request bodies
+func decodeCommand(cmd websocket.Command, v any) error {
+	if len(cmd.Payload) == 0 {
+		return websocket.NewCommandError(websocket.ErrCodeInvalidRequest, "payload is required")
+	}
+	if err := json.Unmarshal(cmd.Payload, v); err != nil {
+		return websocket.NewCommandError(websocket.ErrCodeInvalidRequest, err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(v); err != nil {
+		return websocket.NewCommandError(websocket.ErrCodeInvalidRequest, err.Error())
+	}
+	return nil
+}
+
+// decodeOptionalCommand is decodeCommand for commands whose payload may be omitted
+func decodeOptionalCommand(cmd websocket.Command, v any) error {
+	if len(cmd.Payload) == 0 || string(cmd.Payload) == "null" {
+		return nil
+	}
+	return decodeCommand(cmd, v)
+}
+
+// guardCommandUser returns the ID of a guard issuing a guard-only command
+func guardCommandUser(userRole models.UserRole, userID string) (uuid.UUID, error) {
+	guardID, err := uuid.Parse(userID)
+	if userRole != models.RoleSecurityGuard || err != nil {
+		return uuid.Nil, websocket.NewCommandError(websocket.ErrCodeForbidden, "guards only")
+	}
+	return guardID, nil
+}
+
+func commandError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrInvalidData) || err.Error() == "permission denied":
+		return websocket.NewCommandError(websocket.ErrCodeForbidden, "access denied")
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrQuickReplyNotFound),
+		errors.Is(err, services.ErrNoLoneWorkerSession), errors.Is(err, services.ErrUnknownTag):
+		return websocket.NewCommandError(websocket.ErrCodeNotFound, "resource not found")
+	case errors.Is(err, services.ErrIncidentClosed), errors.Is(err, services.ErrNoGuardPremise), errors.Is(err, services.ErrSOSNotRecorded),
+		errors.Is(err, services.ErrNoPatrolRun), errors.Is(err, services.ErrCheckpointScanned),
+		errors.Is(err, services.ErrChecklistIncomplete), errors.Is(err, services.ErrIncidentReportLocked):
+		return websocket.NewCommandError(websocket.ErrCodeConflict, err.Error())
+	case errors.Is(err, services.ErrEmptyMessage), errors.Is(err, services.ErrMessageTooLong):
+		return websocket.NewCommandError(websocket.ErrCodeInvalidRequest, err.Error())
+	}
+	return err
+}
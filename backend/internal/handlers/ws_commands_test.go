@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"smart-city-surveillance/internal/handlers/dto"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/internal/services"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// commandCode returns the code of a command error, or "" for other errors
+func commandCode(err error) string {
+	var cmdErr *websocket.CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.Code
+	}
+	return ""
+}
+
+func TestDecodeCommandValidatesThePayload(t *testing.T) {
+	for _, payload := range []string{
+		``,
+		`{"incident_id":`,
+		`{"status":"open"}`,
+		`{"incident_id":"not-a-uuid","status":"open"}`,
+		`{"incident_id":"` + uuid.NewString() + `","status":"archived"}`,
+	} {
+		var req dto.UpdateIncidentStatusCommand
+		err := decodeCommand(websocket.Command{Payload: json.RawMessage(payload)}, &req)
+		if commandCode(err) != websocket.ErrCodeInvalidRequest {
+			t.Errorf("decodeCommand(%s) = %v, want invalid_request", payload, err)
+		}
+	}
+
+	id := uuid.NewString()
+	var req dto.UpdateIncidentStatusCommand
+	if err := decodeCommand(websocket.Command{Payload: json.RawMessage(`{"incident_id":"` + id + `","status":"resolved"}`)}, &req); err != nil {
+		t.Fatalf("decodeCommand: %v", err)
+	}
+	if req.IncidentID != id || req.Status != "resolved" {
+		t.Errorf("decoded %+v", req)
+	}
+
+	// Optional payloads may be left out, but not malformed
+	var sos dto.SOSRequest
+	for _, payload := range []string{``, `null`} {
+		if err := decodeOptionalCommand(websocket.Command{Payload: json.RawMessage(payload)}, &sos); err != nil {
+			t.Errorf("decodeOptionalCommand(%q) = %v", payload, err)
+		}
+	}
+	if err := decodeOptionalCommand(websocket.Command{Payload: json.RawMessage(`[`)}, &sos); commandCode(err) != websocket.ErrCodeInvalidRequest {
+		t.Errorf("decodeOptionalCommand of a malformed payload = %v", err)
+	}
+}
+
+func TestGuardCommandUser(t *testing.T) {
+	id := uuid.New()
+	if got, err := guardCommandUser(models.RoleSecurityGuard, id.String()); err != nil || got != id {
+		t.Errorf("guardCommandUser = %v, %v", got, err)
+	}
+	if _, err := guardCommandUser(models.RoleSCSOperator, id.String()); commandCode(err) != websocket.ErrCodeForbidden {
+		t.Errorf("guardCommandUser for an operator = %v, want forbidden", err)
+	}
+	if _, err := guardCommandUser(models.RoleSecurityGuard, "guard"); commandCode(err) != websocket.ErrCodeForbidden {
+		t.Errorf("guardCommandUser with a malformed ID = %v, want forbidden", err)
+	}
+}
+
+func TestCommandErrorCodes(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code string
+	}{
+		{errors.New("permission denied"), websocket.ErrCodeForbidden},
+		{gorm.ErrRecordNotFound, websocket.ErrCodeNotFound},
+		{fmt.Errorf("loading tag: %w", services.ErrUnknownTag), websocket.ErrCodeNotFound},
+		{services.ErrIncidentClosed, websocket.ErrCodeConflict},
+		{services.ErrChecklistIncomplete, websocket.ErrCodeConflict},
+		{services.ErrEmptyMessage, websocket.ErrCodeInvalidRequest},
+		{errors.New("connection reset"), ""},
+	} {
+		if code := commandCode(commandError(tt.err)); code != tt.code {
+			t.Errorf("commandError(%v) has code %q, want %q", tt.err, code, tt.code)
+		}
+	}
+	if commandError(nil) != nil {
+		t.Error("commandError(nil) is not nil")
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	router := NewWSCommandRouter(nil, nil, nil, nil, nil)
+	_, err := router.HandleCommand(context.Background(), uuid.NewString(), string(models.RoleSCSOperator), websocket.Command{Version: 1, ID: "1", Type: "camera.delete"})
+	if commandCode(err) != websocket.ErrCodeUnknownCommand {
+		t.Errorf("HandleCommand of an unknown type = %v, want unknown_command", err)
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -40,23 +41,44 @@ func AuthMiddleware(config *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-			return []byte(config.JWT.SecretKey), nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := ParseToken(tokenString, config)
+		if err != nil {
 			response.Error(c, http.StatusUnauthorized, "Invalid token", err)
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			response.Error(c, http.StatusUnauthorized, "Invalid token claims", nil)
+		// Store user info in context
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("role", claims.Role)
+
+		c.Next()
+	}
+}
+
+// StreamAuthMiddleware validates JWT tokens for streaming endpoints. Browsers
+// cannot set headers on WebSocket or EventSource requests, so the token may
+// also be passed as the access_token query parameter.
+func StreamAuthMiddleware(config *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("access_token")
+		}
+		if tokenString == "" {
+			response.Error(c, http.StatusUnauthorized, "Access token required", nil)
+			c.Abort()
+			return
+		}
+
+		claims, err := ParseToken(tokenString, config)
+		if err != nil {
+			response.Error(c, http.StatusUnauthorized, "Invalid token", err)
 			c.Abort()
 			return
 		}
 
-		// Store user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
@@ -65,6 +87,21 @@ func AuthMiddleware(config *config.Config) gin.HandlerFunc {
 	}
 }
 
+// ParseToken validates a JWT and returns its claims
+func ParseToken(tokenString string, config *config.Config) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
+		return []byte(config.JWT.SecretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
 // RoleMiddleware checks if user has required role
 func RoleMiddleware(requiredRole models.UserRole) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,16 @@
+package middleware
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	for uri, want := range map[string]string{
+		"/ws":                                    "/ws",
+		"/ws?access_token=eyJhbGci.eyJ1c2Vy.sig": "/ws?access_token=REDACTED",
+		"/api/events/stream?topics=a&access_token=x": "/api/events/stream?topics=a&access_token=REDACTED",
+		"/api/alerts?status=new&token=keep":          "/api/alerts?status=new&token=keep",
+	} {
+		if got := redactQuery(uri); got != want {
+			t.Errorf("redactQuery(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,9 +25,13 @@ type User struct {
 	LastName  string    `json:"last_name" gorm:"not null"`
 	Phone     string    `json:"phone"`
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
+	OnDuty    bool      `json:"on_duty" gorm:"default:false"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// LastSeenAt is when a realtime connection of the user last opened or closed
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+
 	// Relationships
 	CameraAssignments   []CameraGuard   `json:"camera_assignments,omitempty" gorm:"foreignKey:GuardID"`
 	IncidentAssignments []IncidentGuard `json:"incident_assignments,omitempty" gorm:"foreignKey:GuardID"`
@@ -46,15 +53,18 @@ type Premise struct {
 	Name        string      `json:"name" gorm:"not null"`
 	Address     string      `json:"address" gorm:"not null"`
 	Type        PremiseType `json:"type" gorm:"not null"`
-	FloorPlans  string      `json:"floor_plans"`
+	FloorPlans  string      `json:"floor_plans"` // legacy single floor plan URL; see Floors
 	Description string      `json:"description"`
 	IsActive    bool        `json:"is_active" gorm:"default:true"`
+	Latitude    *float64    `json:"latitude,omitempty"`
+	Longitude   *float64    `json:"longitude,omitempty"`
 	CreatedAt   time.Time   `json:"created_at"`
 	UpdatedAt   time.Time   `json:"updated_at"`
 
 	// Relationships
-	Cameras []Camera `json:"cameras,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
-	Alerts  []Alert  `json:"alerts,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Cameras []Camera    `json:"cameras,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Alerts  []Alert     `json:"alerts,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Floors  []FloorPlan `json:"floors,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
 }
 
 type PremiseType string
@@ -71,6 +81,29 @@ type Camera struct {
 	StreamURL      string    `json:"stream_url" gorm:"not null"`
 	Status         CameraStatus `json:"status" gorm:"default:'active'"`
 	PremiseID      uuid.UUID    `json:"premise_id" gorm:"type:uuid;not null"`
+
+	// Capabilities
+	PTZSupported     bool   `json:"ptz_supported" gorm:"default:false"`
+	PresetsSupported bool   `json:"presets_supported" gorm:"default:false"`
+	AudioSupported   bool   `json:"audio_supported" gorm:"default:false"`
+	ONVIFAddress     string `json:"onvif_address,omitempty"`
+	ONVIFProfile     string `json:"-"`
+	ONVIFUsername    string `json:"-"`
+	ONVIFPassword    string `json:"-"`
+
+	// Placement on a floor plan; coordinates are normalized to [0,1] of the
+	// floor image, heading and field of view are in degrees
+	FloorPlanID *uuid.UUID `json:"floor_plan_id,omitempty" gorm:"type:uuid;index"`
+	PositionX   *float64   `json:"position_x,omitempty"`
+	PositionY   *float64   `json:"position_y,omitempty"`
+	Heading     *float64   `json:"heading,omitempty"`
+	FieldOfView *float64   `json:"field_of_view,omitempty"`
+	ZoneID      *uuid.UUID `json:"zone_id,omitempty" gorm:"type:uuid"`
+
+	// Geographic position; cameras without one are shown at their premise
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+
 	CreatedAt      time.Time    `json:"created_at"`
 	UpdatedAt      time.Time    `json:"updated_at"`
 
@@ -87,6 +120,86 @@ const (
 	CameraStatusMaintenance  CameraStatus = "maintenance"
 )
 
+// PTZLock is an exclusive, expiring PTZ control lease on a camera. It lives
+// in the database so every backend replica sees the same holder.
+type PTZLock struct {
+	CameraID   uuid.UUID `json:"camera_id" gorm:"type:uuid;primaryKey"`
+	UserID     string    `json:"user_id" gorm:"not null"`
+	AcquiredAt time.Time `json:"acquired_at" gorm:"not null"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"not null"`
+}
+
+// =======================
+// Floor Plan & Zone
+// =======================
+
+// FloorPlan is one floor of a premise with an uploaded plan image
+type FloorPlan struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	PremiseID uuid.UUID `json:"premise_id" gorm:"type:uuid;not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Level     int       `json:"level"`
+	ImageKey  string    `json:"-"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Signed image URL, populated on read
+	ImageURL string `json:"image_url,omitempty" gorm:"-"`
+
+	// Relationships
+	Zones   []Zone   `json:"zones,omitempty" gorm:"foreignKey:FloorPlanID;references:ID"`
+	Cameras []Camera `json:"cameras,omitempty" gorm:"foreignKey:FloorPlanID;references:ID"`
+}
+
+// Zone is a named area of a floor
+type Zone struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	FloorPlanID uuid.UUID `json:"floor_plan_id" gorm:"type:uuid;not null;index"`
+	Name        string    `json:"name" gorm:"not null"`
+	Polygon     Polygon   `json:"polygon" gorm:"type:jsonb;not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Point is a position on a floor plan, normalized to [0,1]
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Polygon is a closed shape on a floor plan stored as a jsonb array of points
+type Polygon []Point
+
+func (p Polygon) Value() (driver.Value, error) {
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+func (p *Polygon) Scan(value any) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return errors.New("unsupported type for Polygon")
+	}
+}
+
+// Contains reports whether pt lies inside the polygon (ray casting)
+func (p Polygon) Contains(pt Point) bool {
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if (p[i].Y > pt.Y) != (p[j].Y > pt.Y) &&
+			pt.X < (p[j].X-p[i].X)*(pt.Y-p[i].Y)/(p[j].Y-p[i].Y)+p[i].X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
 // =======================
 // Alert & Incident
 // =======================
@@ -102,14 +215,45 @@ type Alert struct {
 	CameraID    *uuid.UUID    `json:"camera_id,omitempty" gorm:"type:uuid"`
 	PremiseID   uuid.UUID     `json:"premise_id" gorm:"type:uuid;not null"`
 	AssignedGuardID *uuid.UUID `json:"assigned_guard_id,omitempty" gorm:"type:uuid"`
+	ZoneID      *uuid.UUID    `json:"zone_id,omitempty" gorm:"type:uuid"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
 
+	// GuardID is the guard an SOS or missed check-in alert is about; the
+	// coordinates are where the guard was last seen
+	GuardID   *uuid.UUID `json:"guard_id,omitempty" gorm:"type:uuid;index"`
+	Latitude  *float64   `json:"latitude,omitempty"`
+	Longitude *float64   `json:"longitude,omitempty"`
+
+	// DowngradedFrom is the severity the alert was raised with before the
+	// arming policy lowered it for coming from a disarmed area
+	DowngradedFrom AlertSeverity `json:"downgraded_from,omitempty"`
+
 	// Relationships
 	Camera   *Camera   `json:"camera,omitempty" gorm:"foreignKey:CameraID;references:ID"`
 	Premise  Premise   `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
 	AssignedGuard *User `json:"assigned_guard,omitempty" gorm:"foreignKey:AssignedGuardID;references:ID"`
 	Incident *Incident `json:"incident,omitempty" gorm:"foreignKey:AlertID;references:ID"`
+	Snapshots []AlertSnapshot `json:"snapshots,omitempty" gorm:"foreignKey:AlertID;references:ID"`
+	Zone     *Zone     `json:"zone,omitempty" gorm:"foreignKey:ZoneID;references:ID"`
+	Guard    *User     `json:"guard,omitempty" gorm:"foreignKey:GuardID;references:ID"`
+}
+
+// AlertSnapshot is a still frame captured around the time an alert was raised.
+// OffsetMs is relative to the alert creation time (negative = before).
+type AlertSnapshot struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	AlertID      uuid.UUID `json:"alert_id" gorm:"type:uuid;not null;index"`
+	CameraID     uuid.UUID `json:"camera_id" gorm:"type:uuid;not null"`
+	StorageKey   string    `json:"-" gorm:"not null"`
+	ThumbnailKey string    `json:"-" gorm:"not null"`
+	OffsetMs     int64     `json:"offset_ms"`
+	CapturedAt   time.Time `json:"captured_at"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Signed URLs, populated on read
+	URL          string `json:"url,omitempty" gorm:"-"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty" gorm:"-"`
 }
 
 type AlertType string
@@ -118,6 +262,10 @@ const (
 	AlertTypeSuspiciousActivity AlertType = "suspicious_activity"
 	AlertTypeEquipmentDamage    AlertType = "equipment_damage"
 	AlertTypeSystemFailure      AlertType = "system_failure"
+	AlertTypeGuardDistress      AlertType = "guard_distress"
+	AlertTypeMissedCheckIn      AlertType = "missed_check_in"
+	AlertTypePatrolLate         AlertType = "patrol_checkpoint_late"
+	AlertTypePatrolMissed       AlertType = "patrol_checkpoint_missed"
 )
 
 type AlertSeverity string
@@ -135,6 +283,7 @@ const (
 	AlertStatusAssigned    AlertStatus = "assigned"
 	AlertStatusResolved    AlertStatus = "resolved"
 	AlertStatusClosed      AlertStatus = "closed"
+	AlertStatusFalseAlarm  AlertStatus = "false_alarm"
 )
 
 type Incident struct {
@@ -146,10 +295,18 @@ type Incident struct {
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 
+	// SOP checklist instantiated at assignment. An operator override lets the
+	// incident be resolved with mandatory steps outstanding.
+	SOPTemplateID           *uuid.UUID `json:"sop_template_id,omitempty" gorm:"type:uuid"`
+	ChecklistOverrideByID   *uuid.UUID `json:"checklist_override_by_id,omitempty" gorm:"type:uuid"`
+	ChecklistOverrideAt     *time.Time `json:"checklist_override_at,omitempty"`
+	ChecklistOverrideReason string     `json:"checklist_override_reason,omitempty"`
+
 	// Relationships
 	Alert          Alert            `json:"alert,omitempty" gorm:"foreignKey:AlertID;references:ID"`
 	AssignedGuards []User           `json:"assigned_guards,omitempty" gorm:"many2many:incident_guards;joinForeignKey:IncidentID;JoinReferences:GuardID"`
 	Updates        []IncidentUpdate `json:"updates,omitempty" gorm:"foreignKey:IncidentID;references:ID"`
+	Checklist      []IncidentChecklistItem `json:"checklist,omitempty" gorm:"foreignKey:IncidentID;references:ID"`
 }
 
 type IncidentStatus string
@@ -182,6 +339,801 @@ const (
 	UpdateTypeResolution    UpdateType = "resolution"
 )
 
+// StatusChange is one status transition of an alert, or of its incident when
+// IncidentID is set. Response-time analytics are computed from these.
+type StatusChange struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	AlertID    uuid.UUID  `json:"alert_id" gorm:"type:uuid;not null;index"`
+	IncidentID *uuid.UUID `json:"incident_id,omitempty" gorm:"type:uuid;index"`
+	FromStatus string     `json:"from_status,omitempty"`
+	ToStatus   string     `json:"to_status" gorm:"not null"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+}
+
+// =======================
+// Standard Operating Procedures
+// =======================
+
+// SOPTemplate is the checklist a guard follows for an alert. Empty keys
+// match anything; the most specific active template is used.
+type SOPTemplate struct {
+	ID          uuid.UUID     `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name        string        `json:"name" gorm:"not null"`
+	Description string        `json:"description"`
+	AlertType   AlertType     `json:"alert_type,omitempty" gorm:"index"`
+	PremiseType PremiseType   `json:"premise_type,omitempty"`
+	Severity    AlertSeverity `json:"severity,omitempty"`
+	IsActive    bool          `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+
+	// Relationships
+	Steps []SOPStep `json:"steps,omitempty" gorm:"foreignKey:TemplateID;references:ID"`
+}
+
+type SOPStep struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	TemplateID    uuid.UUID `json:"template_id" gorm:"type:uuid;not null;index"`
+	Sequence      int       `json:"sequence" gorm:"not null"`
+	Title         string    `json:"title" gorm:"not null"`
+	Instructions  string    `json:"instructions"`
+	Mandatory     bool      `json:"mandatory"`
+	RequiresPhoto bool      `json:"requires_photo"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// IncidentChecklistItem is a step copied from the SOP template when the
+// incident was created, so later template edits do not change it
+type IncidentChecklistItem struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	IncidentID    uuid.UUID  `json:"incident_id" gorm:"type:uuid;not null;index"`
+	StepID        *uuid.UUID `json:"step_id,omitempty" gorm:"type:uuid"`
+	Sequence      int        `json:"sequence" gorm:"not null"`
+	Title         string     `json:"title" gorm:"not null"`
+	Instructions  string     `json:"instructions"`
+	Mandatory     bool       `json:"mandatory"`
+	RequiresPhoto bool       `json:"requires_photo"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	CompletedByID *uuid.UUID `json:"completed_by_id,omitempty" gorm:"type:uuid"`
+	Note          string     `json:"note,omitempty"`
+	PhotoKey      string     `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Signed URL, populated on read
+	PhotoURL string `json:"photo_url,omitempty" gorm:"-"`
+
+	// Relationships
+	CompletedBy *User `json:"completed_by,omitempty" gorm:"foreignKey:CompletedByID;references:ID"`
+}
+
+// =======================
+// Incident Chat
+// =======================
+
+// IncidentMessage is a chat message between operators and the guards
+// assigned to an incident
+type IncidentMessage struct {
+	ID           uuid.UUID   `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	IncidentID   uuid.UUID   `json:"incident_id" gorm:"type:uuid;not null;index:idx_incident_message_time,priority:1"`
+	SenderID     uuid.UUID   `json:"sender_id" gorm:"type:uuid;not null"`
+	Kind         MessageKind `json:"kind" gorm:"not null"`
+	Body         string      `json:"body"`
+	QuickReplyID *uuid.UUID  `json:"quick_reply_id,omitempty" gorm:"type:uuid"`
+	CreatedAt    time.Time   `json:"created_at" gorm:"index:idx_incident_message_time,priority:2"`
+
+	// Relationships
+	Sender      User                `json:"sender,omitempty" gorm:"foreignKey:SenderID;references:ID"`
+	Attachments []MessageAttachment `json:"attachments,omitempty" gorm:"foreignKey:MessageID;references:ID"`
+}
+
+type MessageKind string
+const (
+	MessageKindText       MessageKind = "text"
+	MessageKindQuickReply MessageKind = "quick_reply"
+)
+
+// MessageAttachment is a file sent with an incident message
+type MessageAttachment struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	MessageID   uuid.UUID `json:"message_id" gorm:"type:uuid;not null;index"`
+	StorageKey  string    `json:"-" gorm:"not null"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Signed download URL, populated on read
+	URL string `json:"url,omitempty" gorm:"-"`
+}
+
+// IncidentReadReceipt is how far a user has read an incident's thread
+type IncidentReadReceipt struct {
+	IncidentID        uuid.UUID `json:"incident_id" gorm:"type:uuid;primaryKey"`
+	UserID            uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	LastReadMessageID uuid.UUID `json:"last_read_message_id" gorm:"type:uuid;not null"`
+	// LastReadAt is the creation time of the last read message
+	LastReadAt time.Time `json:"last_read_at" gorm:"not null"`
+	ReadAt     time.Time `json:"read_at" gorm:"not null"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID"`
+}
+
+// QuickReply is a canned message offered in the chat. An empty Role makes
+// it available to everyone.
+type QuickReply struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Text      string    `json:"text" gorm:"not null"`
+	Role      UserRole  `json:"role,omitempty"`
+	SortOrder int       `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// =======================
+// Guard Location
+// =======================
+
+// GuardLocation is the last reported position of a guard
+type GuardLocation struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	GuardID    uuid.UUID `json:"guard_id" gorm:"type:uuid;uniqueIndex;not null"`
+	Latitude   float64   `json:"latitude" gorm:"not null"`
+	Longitude  float64   `json:"longitude" gorm:"not null"`
+	Accuracy   *float64  `json:"accuracy,omitempty"` // metres
+	Heading    *float64  `json:"heading,omitempty"`  // degrees
+	RecordedAt time.Time `json:"recorded_at" gorm:"not null"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Relationships
+	Guard User `json:"guard,omitempty" gorm:"foreignKey:GuardID;references:ID"`
+}
+
+// LoneWorkerSession requires a guard working alone to check in every
+// IntervalMinutes. A guard has at most one session that has not ended.
+type LoneWorkerSession struct {
+	ID              uuid.UUID        `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	GuardID         uuid.UUID        `json:"guard_id" gorm:"type:uuid;not null;uniqueIndex:idx_lone_worker_open,where:status <> 'ended'"`
+	Status          LoneWorkerStatus `json:"status" gorm:"not null;index"`
+	IntervalMinutes int              `json:"interval_minutes" gorm:"not null"`
+	StartedAt       time.Time        `json:"started_at" gorm:"not null"`
+	LastCheckInAt   time.Time        `json:"last_check_in_at" gorm:"not null"`
+	NextDueAt       time.Time        `json:"next_due_at" gorm:"not null;index"`
+	WarnedAt        *time.Time       `json:"warned_at,omitempty"`
+	EscalatedAt     *time.Time       `json:"escalated_at,omitempty"`
+	AlertID         *uuid.UUID       `json:"alert_id,omitempty" gorm:"type:uuid"`
+	EndedAt         *time.Time       `json:"ended_at,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+
+	// Relationships
+	Guard User `json:"guard,omitempty" gorm:"foreignKey:GuardID;references:ID"`
+}
+
+type LoneWorkerStatus string
+const (
+	LoneWorkerActive  LoneWorkerStatus = "active"
+	LoneWorkerOverdue LoneWorkerStatus = "overdue"
+	LoneWorkerEnded   LoneWorkerStatus = "ended"
+)
+
+// =======================
+// Patrols
+// =======================
+
+// PatrolRoute is an ordered set of checkpoints a guard walks at a premise.
+// A route with a guard and StartTimes ("HH:MM" in Timezone) is scheduled
+// daily; any active route can also be started on demand.
+type PatrolRoute struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	PremiseID   uuid.UUID      `json:"premise_id" gorm:"type:uuid;not null;index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	GuardID     *uuid.UUID     `json:"guard_id,omitempty" gorm:"type:uuid;index"`
+	StartTimes  pq.StringArray `json:"start_times,omitempty" gorm:"type:text[]" swaggertype:"array,string"`
+	Timezone    string         `json:"timezone" gorm:"not null;default:'UTC'"`
+	IsActive    bool           `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+
+	// Relationships
+	Premise     *Premise           `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Guard       *User              `json:"guard,omitempty" gorm:"foreignKey:GuardID;references:ID"`
+	Checkpoints []PatrolCheckpoint `json:"checkpoints,omitempty" gorm:"foreignKey:RouteID;references:ID"`
+}
+
+// PatrolCheckpoint is a point on a route identified by a QR or NFC tag. It is
+// due ExpectedOffsetMinutes after the patrol starts and is on time when
+// scanned within ToleranceMinutes of that.
+type PatrolCheckpoint struct {
+	ID                    uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	RouteID               uuid.UUID `json:"route_id" gorm:"type:uuid;not null;index"`
+	Sequence              int       `json:"sequence" gorm:"not null"`
+	Name                  string    `json:"name" gorm:"not null"`
+	TagCode               string    `json:"tag_code,omitempty" gorm:"not null;uniqueIndex"`
+	TagType               TagType   `json:"tag_type" gorm:"not null"`
+	ExpectedOffsetMinutes int       `json:"expected_offset_minutes" gorm:"not null"`
+	ToleranceMinutes      int       `json:"tolerance_minutes" gorm:"not null"`
+	Latitude              *float64  `json:"latitude,omitempty"`
+	Longitude             *float64  `json:"longitude,omitempty"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+type TagType string
+const (
+	TagTypeQR  TagType = "qr"
+	TagTypeNFC TagType = "nfc"
+)
+
+// PatrolRun is one walk of a route by a guard. Scheduled runs are due from
+// ScheduledStart whether or not the guard starts them; on-demand runs from
+// StartedAt. A route has at most one open run.
+type PatrolRun struct {
+	ID             uuid.UUID       `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	RouteID        uuid.UUID       `json:"route_id" gorm:"type:uuid;not null;uniqueIndex:idx_patrol_run_schedule,priority:1;uniqueIndex:idx_patrol_run_open,where:status IN ('scheduled'\\,'in_progress')"`
+	GuardID        uuid.UUID       `json:"guard_id" gorm:"type:uuid;not null;index"`
+	Status         PatrolRunStatus `json:"status" gorm:"not null;index"`
+	ScheduledStart *time.Time      `json:"scheduled_start,omitempty" gorm:"uniqueIndex:idx_patrol_run_schedule,priority:2"`
+	StartedAt      *time.Time      `json:"started_at,omitempty"`
+	EndedAt        *time.Time      `json:"ended_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"index"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// Relationships
+	Route  *PatrolRoute  `json:"route,omitempty" gorm:"foreignKey:RouteID;references:ID"`
+	Guard  *User         `json:"guard,omitempty" gorm:"foreignKey:GuardID;references:ID"`
+	Visits []PatrolVisit `json:"visits,omitempty" gorm:"foreignKey:RunID;references:ID"`
+}
+
+type PatrolRunStatus string
+const (
+	PatrolRunScheduled  PatrolRunStatus = "scheduled"
+	PatrolRunInProgress PatrolRunStatus = "in_progress"
+	PatrolRunCompleted  PatrolRunStatus = "completed"  // every checkpoint scanned
+	PatrolRunIncomplete PatrolRunStatus = "incomplete" // at least one checkpoint missed
+)
+
+// PatrolVisit is one checkpoint of a run. Name and sequence are copied from
+// the checkpoint so reports survive route edits.
+type PatrolVisit struct {
+	ID           uuid.UUID         `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	RunID        uuid.UUID         `json:"run_id" gorm:"type:uuid;not null;uniqueIndex:idx_patrol_visit,priority:1"`
+	CheckpointID uuid.UUID         `json:"checkpoint_id" gorm:"type:uuid;not null;uniqueIndex:idx_patrol_visit,priority:2"`
+	Sequence     int               `json:"sequence" gorm:"not null"`
+	Name         string            `json:"name" gorm:"not null"`
+	Status       PatrolVisitStatus `json:"status" gorm:"not null;index"`
+	DueAt        time.Time         `json:"due_at" gorm:"not null;index"`
+	LateAt       time.Time         `json:"late_at" gorm:"not null;index"` // DueAt plus the tolerance
+	ScannedAt    *time.Time        `json:"scanned_at,omitempty"`
+	Latitude     *float64          `json:"latitude,omitempty"`
+	Longitude    *float64          `json:"longitude,omitempty"`
+	AlertID      *uuid.UUID        `json:"alert_id,omitempty" gorm:"type:uuid"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+type PatrolVisitStatus string
+const (
+	PatrolVisitPending PatrolVisitStatus = "pending"
+	PatrolVisitOnTime  PatrolVisitStatus = "on_time"
+	PatrolVisitLate    PatrolVisitStatus = "late"
+	PatrolVisitMissed  PatrolVisitStatus = "missed"
+)
+
+// =======================
+// Recordings
+// =======================
+
+// RecordingSegment is a catalogued piece of footage for a camera.
+// Location is interpreted by the adapter named in Source.
+type RecordingSegment struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CameraID  uuid.UUID `json:"camera_id" gorm:"type:uuid;not null;index:idx_recording_camera_time,priority:1;uniqueIndex:idx_recording_location,priority:1"`
+	StartTime time.Time `json:"start_time" gorm:"not null;index:idx_recording_camera_time,priority:2"`
+	EndTime   time.Time `json:"end_time" gorm:"not null;index"`
+	Source    string    `json:"source" gorm:"not null;uniqueIndex:idx_recording_location,priority:2"`
+	Location  string    `json:"-" gorm:"not null;uniqueIndex:idx_recording_location,priority:3"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RetentionPolicy controls how long recordings of a premise are kept.
+// Segments around an alert are kept for AlertRetentionDays when longer.
+type RetentionPolicy struct {
+	ID                 uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	PremiseID          uuid.UUID `json:"premise_id" gorm:"type:uuid;uniqueIndex;not null"`
+	RetentionDays      int       `json:"retention_days" gorm:"not null"`
+	AlertRetentionDays int       `json:"alert_retention_days"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// =======================
+// Reports
+// =======================
+
+// ReportSchedule generates a report each time Cron (five fields, evaluated in
+// Timezone) fires and emails it to Recipients. A schedule without a premise
+// covers every premise.
+type ReportSchedule struct {
+	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name        string         `json:"name" gorm:"not null"`
+	Kind        ReportKind     `json:"kind" gorm:"not null"`
+	Format      ReportFormat   `json:"format" gorm:"not null"`
+	PremiseID   *uuid.UUID     `json:"premise_id,omitempty" gorm:"type:uuid;index"`
+	Cron        string         `json:"cron" gorm:"not null"`
+	Timezone    string         `json:"timezone" gorm:"not null;default:'UTC'"`
+	Recipients  pq.StringArray `json:"recipients" gorm:"type:text[]" swaggertype:"array,string"`
+	IsActive    bool           `json:"is_active" gorm:"default:true"`
+	NextRunAt   *time.Time     `json:"next_run_at,omitempty" gorm:"index"`
+	LastRunAt   *time.Time     `json:"last_run_at,omitempty"`
+	CreatedByID *uuid.UUID     `json:"created_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+
+	// Relationships
+	Premise *Premise `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+}
+
+type ReportKind string
+const (
+	ReportKindShiftHandover  ReportKind = "shift_handover"  // open work and what happened during the shift
+	ReportKindPremiseSummary ReportKind = "premise_summary" // volumes, response times, false alarms and guards
+	ReportKindIncidents      ReportKind = "incident_report" // every incident of the period with its updates
+)
+
+type ReportFormat string
+const (
+	ReportFormatPDF ReportFormat = "pdf"
+	ReportFormatCSV ReportFormat = "csv"
+)
+
+// Report is a generated report archived in media storage, whether it was
+// scheduled or requested on demand
+type Report struct {
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ScheduleID     *uuid.UUID     `json:"schedule_id,omitempty" gorm:"type:uuid;index"`
+	Kind           ReportKind     `json:"kind" gorm:"not null;index"`
+	Format         ReportFormat   `json:"format" gorm:"not null"`
+	Title          string         `json:"title" gorm:"not null"`
+	PremiseID      *uuid.UUID     `json:"premise_id,omitempty" gorm:"type:uuid;index"`
+	PeriodStart    time.Time      `json:"period_start" gorm:"not null"`
+	PeriodEnd      time.Time      `json:"period_end" gorm:"not null"`
+	Timezone       string         `json:"timezone" gorm:"not null"`
+	StorageKey     string         `json:"-" gorm:"not null"`
+	FileName       string         `json:"file_name" gorm:"not null"`
+	ContentType    string         `json:"content_type" gorm:"not null"`
+	SizeBytes      int64          `json:"size_bytes"`
+	Recipients     pq.StringArray `json:"recipients,omitempty" gorm:"type:text[]" swaggertype:"array,string"`
+	DeliveryStatus ReportDelivery `json:"delivery_status" gorm:"not null;default:'none'"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+	DeliveryError  string         `json:"delivery_error,omitempty"`
+	RequestedByID  *uuid.UUID     `json:"requested_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt      time.Time      `json:"created_at" gorm:"index"`
+
+	// Relationships
+	Premise *Premise `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+}
+
+type ReportDelivery string
+const (
+	ReportDeliveryNone   ReportDelivery = "none" // no recipients
+	ReportDeliverySent   ReportDelivery = "sent"
+	ReportDeliveryFailed ReportDelivery = "failed"
+)
+
+// IncidentReport holds the written parts of an incident's post-incident
+// report; the rest is assembled from the incident when it is read. Once
+// finalized it is locked and shows the incident as it stood at sign-off.
+type IncidentReport struct {
+	ID              uuid.UUID            `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	IncidentID      uuid.UUID            `json:"incident_id" gorm:"type:uuid;uniqueIndex;not null"`
+	Status          IncidentReportStatus `json:"status" gorm:"not null;default:'draft'"`
+	Summary         string               `json:"summary"`
+	ResolutionNotes string               `json:"resolution_notes"`
+	Recommendations string               `json:"recommendations"`
+	PreparedByID    *uuid.UUID           `json:"prepared_by_id,omitempty" gorm:"type:uuid"`
+	SignOffName     string               `json:"sign_off_name,omitempty"`
+	SignOffTitle    string               `json:"sign_off_title,omitempty"`
+	SignedOffByID   *uuid.UUID           `json:"signed_off_by_id,omitempty" gorm:"type:uuid"`
+	FinalizedAt     *time.Time           `json:"finalized_at,omitempty"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+
+	// Relationships
+	PreparedBy  *User `json:"prepared_by,omitempty" gorm:"foreignKey:PreparedByID;references:ID"`
+	SignedOffBy *User `json:"signed_off_by,omitempty" gorm:"foreignKey:SignedOffByID;references:ID"`
+}
+
+type IncidentReportStatus string
+const (
+	IncidentReportDraft     IncidentReportStatus = "draft"
+	IncidentReportFinalized IncidentReportStatus = "finalized"
+)
+
+// =======================
+// Notifications
+// =======================
+
+// DeviceToken is a mobile app installation that receives push notifications
+type DeviceToken struct {
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID     uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	Platform   DevicePlatform `json:"platform" gorm:"not null"`
+	Token      string         `json:"token" gorm:"uniqueIndex;not null"`
+	CreatedAt  time.Time      `json:"created_at"`
+	LastSeenAt time.Time      `json:"last_seen_at"`
+}
+
+type DevicePlatform string
+const (
+	DevicePlatformAndroid DevicePlatform = "android"
+	DevicePlatformIOS     DevicePlatform = "ios"
+)
+
+type NotificationChannel string
+const (
+	// NotificationChannelRealtime is the websocket and event stream feed
+	NotificationChannelRealtime NotificationChannel = "realtime"
+	NotificationChannelEmail    NotificationChannel = "email"
+	NotificationChannelSMS      NotificationChannel = "sms"
+	NotificationChannelPush     NotificationChannel = "push"
+)
+
+// NotificationPreference picks the channels a user gets an event on and the
+// lowest severity each channel carries. Without one the defaults for the
+// user's role apply; no channels turns the event off.
+type NotificationPreference struct {
+	UserID    uuid.UUID         `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Event     string            `json:"event" gorm:"primaryKey"`
+	Channels  ChannelThresholds `json:"channels" gorm:"type:jsonb;not null"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// ChannelThresholds maps a channel to the lowest severity sent on it; an
+// empty severity sends everything
+type ChannelThresholds map[NotificationChannel]AlertSeverity
+
+func (t ChannelThresholds) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *ChannelThresholds) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return errors.New("unsupported type for ChannelThresholds")
+	}
+}
+
+// NotificationSettings hold a user's quiet hours. Between QuietHoursStart and
+// QuietHoursEnd ("HH:MM" in Timezone, wrapping past midnight when the end is
+// earlier) nothing reaches the user, unless CriticalOverridesQuiet lets
+// critical events through. Users without settings have no quiet hours.
+type NotificationSettings struct {
+	UserID                 uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Timezone               string    `json:"timezone" gorm:"not null"`
+	QuietHoursEnabled      bool      `json:"quiet_hours_enabled"`
+	QuietHoursStart        string    `json:"quiet_hours_start"`
+	QuietHoursEnd          string    `json:"quiet_hours_end"`
+	CriticalOverridesQuiet bool      `json:"critical_overrides_quiet"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// NotificationDelivery is a notification to one address over one channel.
+// Pending deliveries are the send queue; all of them form the delivery log.
+type NotificationDelivery struct {
+	ID            uuid.UUID           `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID        uuid.UUID           `json:"user_id" gorm:"type:uuid;not null;index"`
+	Event         string              `json:"event" gorm:"not null;index"`
+	Channel       NotificationChannel `json:"channel" gorm:"not null"`
+	Address       string              `json:"address" gorm:"not null"`
+	Platform      DevicePlatform      `json:"platform,omitempty"`
+	Subject       string              `json:"subject"`
+	Body          string              `json:"body"`
+	Data          JSONMap             `json:"data,omitempty" gorm:"type:jsonb"`
+	Status        NotificationStatus  `json:"status" gorm:"not null;default:'pending';index:idx_notification_due,priority:1"`
+	Attempts      int                 `json:"attempts"`
+	NextAttemptAt time.Time           `json:"next_attempt_at" gorm:"index:idx_notification_due,priority:2"`
+	LastError     string              `json:"last_error,omitempty"`
+	SentAt        *time.Time          `json:"sent_at,omitempty"`
+	CreatedAt     time.Time           `json:"created_at" gorm:"index"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+
+	// Relationships
+	User *User `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID"`
+}
+
+type NotificationStatus string
+const (
+	NotificationPending NotificationStatus = "pending" // queued or waiting to retry
+	NotificationSent    NotificationStatus = "sent"
+	NotificationFailed  NotificationStatus = "failed"
+)
+
+// =======================
+// Webhooks
+// =======================
+
+// WebhookSubscription posts matching events to a third-party URL, signed
+// with Secret. Empty EventTypes or PremiseIDs match every event or premise.
+// A subscription that keeps failing is disabled until it is re-enabled.
+type WebhookSubscription struct {
+	ID                  uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name                string         `json:"name" gorm:"not null"`
+	URL                 string         `json:"url" gorm:"not null"`
+	Secret              string         `json:"-" gorm:"not null"`
+	EventTypes          pq.StringArray `json:"event_types" gorm:"type:text[]" swaggertype:"array,string"`
+	PremiseIDs          pq.StringArray `json:"premise_ids" gorm:"type:text[]" swaggertype:"array,string"`
+	Active              bool           `json:"active" gorm:"not null"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	DisabledAt          *time.Time     `json:"disabled_at,omitempty"`
+	DisabledReason      string         `json:"disabled_reason,omitempty"`
+	CreatedByID         *uuid.UUID     `json:"created_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+}
+
+// WebhookDelivery is one event queued for one subscription. Payload is the
+// request body; pending deliveries are the send queue.
+type WebhookDelivery struct {
+	ID             uuid.UUID             `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SubscriptionID uuid.UUID             `json:"subscription_id" gorm:"type:uuid;not null;index"`
+	EventID        uuid.UUID             `json:"event_id" gorm:"type:uuid;not null;index"`
+	EventType      string                `json:"event_type" gorm:"not null"`
+	Payload        JSONMap               `json:"payload" gorm:"type:jsonb"`
+	Status         WebhookDeliveryStatus `json:"status" gorm:"not null;default:'pending';index:idx_webhook_due,priority:1"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at" gorm:"index:idx_webhook_due,priority:2"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time             `json:"created_at" gorm:"index"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+
+	// Relationships
+	AttemptLog []WebhookAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:DeliveryID"`
+}
+
+type WebhookDeliveryStatus string
+const (
+	WebhookPending   WebhookDeliveryStatus = "pending" // queued or waiting to retry
+	WebhookDelivered WebhookDeliveryStatus = "delivered"
+	WebhookFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookAttempt records one request of a delivery and the response to it
+type WebhookAttempt struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	DeliveryID   uuid.UUID `json:"delivery_id" gorm:"type:uuid;not null;index"`
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// =======================
+// Maintenance
+// =======================
+
+// MaintenanceWindow suppresses alerts at a premise, or from one camera of it,
+// during planned work. A one-off window runs from StartsAt to EndsAt, or until
+// it is ended when EndsAt is empty. A recurring window opens at each time of
+// its Recurrence cron expression in Timezone for DurationMinutes, from
+// StartsAt until EndsAt. A window without rules suppresses every alert in its
+// scope; otherwise an alert must match one of its rules.
+type MaintenanceWindow struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name            string     `json:"name" gorm:"not null"`
+	Reason          string     `json:"reason,omitempty"`
+	PremiseID       uuid.UUID  `json:"premise_id" gorm:"type:uuid;not null;index"`
+	CameraID        *uuid.UUID `json:"camera_id,omitempty" gorm:"type:uuid;index"`
+	StartsAt        time.Time  `json:"starts_at" gorm:"not null"`
+	EndsAt          *time.Time `json:"ends_at,omitempty"`
+	Recurrence      string     `json:"recurrence,omitempty" example:"0 22 * * SAT"`
+	DurationMinutes int        `json:"duration_minutes,omitempty"`
+	Timezone        string     `json:"timezone" gorm:"not null;default:'UTC'"`
+	// Automatic windows are opened by putting a camera into maintenance and
+	// end when it is back in service
+	Automatic   bool       `json:"automatic" gorm:"not null"`
+	CreatedByID *uuid.UUID `json:"created_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	Rules   []SuppressionRule `json:"rules" gorm:"foreignKey:WindowID;references:ID"`
+	Premise *Premise          `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Camera  *Camera           `json:"camera,omitempty" gorm:"foreignKey:CameraID;references:ID"`
+}
+
+// SuppressionRule narrows what a maintenance window suppresses. Each list
+// left empty matches anything; an alert must match every list that is set.
+type SuppressionRule struct {
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	WindowID   uuid.UUID      `json:"window_id" gorm:"type:uuid;not null;index"`
+	AlertTypes pq.StringArray `json:"alert_types" gorm:"type:text[]" swaggertype:"array,string"`
+	Severities pq.StringArray `json:"severities" gorm:"type:text[]" swaggertype:"array,string"`
+	CameraIDs  pq.StringArray `json:"camera_ids" gorm:"type:text[]" swaggertype:"array,string"`
+}
+
+// SuppressedAlert is an alert raised during a maintenance window, or
+// discarded by the arming policy for coming from a disarmed area. It is
+// recorded here instead of being raised, so operators are not notified of
+// it. WindowName is kept for when the window is deleted.
+type SuppressedAlert struct {
+	ID          uuid.UUID        `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Cause       SuppressionCause `json:"cause" gorm:"not null;default:'maintenance'"`
+	Type        AlertType        `json:"type" gorm:"not null"`
+	Severity    AlertSeverity    `json:"severity" gorm:"not null"`
+	Title       string           `json:"title" gorm:"not null"`
+	Description string           `json:"description"`
+	Location    string           `json:"location"`
+	PremiseID   uuid.UUID        `json:"premise_id" gorm:"type:uuid;not null;index"`
+	CameraID    *uuid.UUID       `json:"camera_id,omitempty" gorm:"type:uuid;index"`
+	ZoneID      *uuid.UUID       `json:"zone_id,omitempty" gorm:"type:uuid"`
+	WindowID    *uuid.UUID       `json:"window_id,omitempty" gorm:"type:uuid;index"`
+	RuleID      *uuid.UUID       `json:"rule_id,omitempty" gorm:"type:uuid"`
+	WindowName  string           `json:"window_name,omitempty"`
+	CreatedAt   time.Time        `json:"created_at" gorm:"index"`
+
+	// Relationships
+	Premise *Premise           `json:"premise,omitempty" gorm:"foreignKey:PremiseID;references:ID"`
+	Camera  *Camera            `json:"camera,omitempty" gorm:"foreignKey:CameraID;references:ID"`
+	Window  *MaintenanceWindow `json:"window,omitempty" gorm:"foreignKey:WindowID;references:ID"`
+}
+
+type SuppressionCause string
+
+const (
+	SuppressedByMaintenance SuppressionCause = "maintenance"
+	SuppressedByDisarmed    SuppressionCause = "disarmed"
+)
+
+// =======================
+// Arming
+// =======================
+
+// ArmingSchedule says when a premise, or one zone of it, is disarmed: during
+// each of its periods, in Timezone. It is armed the rest of the time and all
+// day on the holidays of its calendar. A zone's schedule takes precedence
+// over its premise's; an area without a schedule is always armed.
+type ArmingSchedule struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name              string     `json:"name" gorm:"not null"`
+	PremiseID         uuid.UUID  `json:"premise_id" gorm:"type:uuid;not null;uniqueIndex:idx_arming_schedule_area"`
+	ZoneID            *uuid.UUID `json:"zone_id,omitempty" gorm:"type:uuid;uniqueIndex:idx_arming_schedule_area"`
+	Timezone          string     `json:"timezone" gorm:"not null;default:'UTC'"`
+	HolidayCalendarID *uuid.UUID `json:"holiday_calendar_id,omitempty" gorm:"type:uuid;index"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// Relationships
+	Periods         []ArmingPeriod   `json:"periods" gorm:"foreignKey:ScheduleID;references:ID"`
+	HolidayCalendar *HolidayCalendar `json:"holiday_calendar,omitempty" gorm:"foreignKey:HolidayCalendarID;references:ID"`
+}
+
+// ArmingPeriod disarms its schedule's area from DisarmAt to ArmAt ("15:04")
+// on each of Weekdays ("mon".."sun"). A period whose ArmAt is not after its
+// DisarmAt runs past midnight into the next day.
+type ArmingPeriod struct {
+	ID         uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ScheduleID uuid.UUID      `json:"schedule_id" gorm:"type:uuid;not null;index"`
+	Weekdays   pq.StringArray `json:"weekdays" gorm:"type:text[]" swaggertype:"array,string"`
+	DisarmAt   string         `json:"disarm_at" gorm:"not null" example:"08:00"`
+	ArmAt      string         `json:"arm_at" gorm:"not null" example:"18:00"`
+}
+
+// HolidayCalendar is a named set of holidays shared by arming schedules
+type HolidayCalendar struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Holidays []Holiday `json:"holidays" gorm:"foreignKey:CalendarID;references:ID"`
+}
+
+// Holiday is a date ("2006-01-02") in the schedule's timezone
+type Holiday struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	CalendarID uuid.UUID `json:"calendar_id" gorm:"type:uuid;not null;uniqueIndex:idx_holiday_date"`
+	Date       string    `json:"date" gorm:"not null;uniqueIndex:idx_holiday_date" example:"2026-09-02"`
+	Name       string    `json:"name"`
+}
+
+// ArmingOverride arms or disarms a premise, or one zone of it, by hand until
+// Until, or until it is cleared. The latest override in effect wins over the
+// schedule; a zone's over its premise's.
+type ArmingOverride struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	PremiseID   uuid.UUID  `json:"premise_id" gorm:"type:uuid;not null;index"`
+	ZoneID      *uuid.UUID `json:"zone_id,omitempty" gorm:"type:uuid;index"`
+	Armed       bool       `json:"armed" gorm:"not null"`
+	Reason      string     `json:"reason,omitempty"`
+	Until       *time.Time `json:"until,omitempty"`
+	ClearedAt   *time.Time `json:"cleared_at,omitempty"`
+	CreatedByID *uuid.UUID `json:"created_by_id,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+
+	// Relationships
+	CreatedBy *User `json:"created_by,omitempty" gorm:"foreignKey:CreatedByID;references:ID"`
+}
+
+// ArmingPolicy is what happens to alerts of a type raised in a disarmed
+// area. Types without a policy are raised as usual.
+type ArmingPolicy struct {
+	AlertType AlertType          `json:"alert_type" gorm:"primaryKey"`
+	Action    ArmingPolicyAction `json:"action" gorm:"not null"`
+	// Severity is what a downgraded alert is lowered to
+	Severity  AlertSeverity `json:"severity,omitempty"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type ArmingPolicyAction string
+
+const (
+	ArmingRaise     ArmingPolicyAction = "raise"
+	ArmingDowngrade ArmingPolicyAction = "downgrade"
+	ArmingDiscard   ArmingPolicyAction = "discard"
+)
+
+// =======================
+// Audit
+// =======================
+
+// AuditLog records who did what to which resource
+type AuditLog struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ActorID      string    `json:"actor_id" gorm:"index"`
+	ActorRole    UserRole  `json:"actor_role"`
+	Action       string    `json:"action" gorm:"not null;index"`
+	ResourceType string    `json:"resource_type" gorm:"not null"`
+	ResourceID   string    `json:"resource_id" gorm:"index"`
+	Success      bool      `json:"success"`
+	Details      JSONMap   `json:"details,omitempty" gorm:"type:jsonb"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
+
+// JSONMap is a free-form JSON object stored in a jsonb column
+type JSONMap map[string]any
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+func (m *JSONMap) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return errors.New("unsupported type for JSONMap")
+	}
+}
+
 // =======================
 // Custom Join Tables
 // =======================
@@ -230,6 +1182,20 @@ func (c *Camera) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (f *FloorPlan) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
+func (z *Zone) BeforeCreate(tx *gorm.DB) error {
+	if z.ID == uuid.Nil {
+		z.ID = uuid.New()
+	}
+	return nil
+}
+
 func (a *Alert) BeforeCreate(tx *gorm.DB) error {
 	if a.ID == uuid.Nil {
 		a.ID = uuid.New()
@@ -237,6 +1203,41 @@ func (a *Alert) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (as *AlertSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if as.ID == uuid.Nil {
+		as.ID = uuid.New()
+	}
+	return nil
+}
+
+func (gl *GuardLocation) BeforeCreate(tx *gorm.DB) error {
+	if gl.ID == uuid.Nil {
+		gl.ID = uuid.New()
+	}
+	return nil
+}
+
+func (rs *RecordingSegment) BeforeCreate(tx *gorm.DB) error {
+	if rs.ID == uuid.Nil {
+		rs.ID = uuid.New()
+	}
+	return nil
+}
+
+func (rp *RetentionPolicy) BeforeCreate(tx *gorm.DB) error {
+	if rp.ID == uuid.Nil {
+		rp.ID = uuid.New()
+	}
+	return nil
+}
+
+func (al *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if al.ID == uuid.Nil {
+		al.ID = uuid.New()
+	}
+	return nil
+}
+
 func (i *Incident) BeforeCreate(tx *gorm.DB) error {
 	if i.ID == uuid.Nil {
 		i.ID = uuid.New()
@@ -249,4 +1250,200 @@ func (iu *IncidentUpdate) BeforeCreate(tx *gorm.DB) error {
 		iu.ID = uuid.New()
 	}
 	return nil
-} 
\ No newline at end of file
+} 
+
+func (im *IncidentMessage) BeforeCreate(tx *gorm.DB) error {
+	if im.ID == uuid.Nil {
+		im.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ma *MessageAttachment) BeforeCreate(tx *gorm.DB) error {
+	if ma.ID == uuid.Nil {
+		ma.ID = uuid.New()
+	}
+	return nil
+}
+
+func (qr *QuickReply) BeforeCreate(tx *gorm.DB) error {
+	if qr.ID == uuid.Nil {
+		qr.ID = uuid.New()
+	}
+	return nil
+}
+
+func (lw *LoneWorkerSession) BeforeCreate(tx *gorm.DB) error {
+	if lw.ID == uuid.Nil {
+		lw.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pr *PatrolRoute) BeforeCreate(tx *gorm.DB) error {
+	if pr.ID == uuid.Nil {
+		pr.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pc *PatrolCheckpoint) BeforeCreate(tx *gorm.DB) error {
+	if pc.ID == uuid.Nil {
+		pc.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pr *PatrolRun) BeforeCreate(tx *gorm.DB) error {
+	if pr.ID == uuid.Nil {
+		pr.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pv *PatrolVisit) BeforeCreate(tx *gorm.DB) error {
+	if pv.ID == uuid.Nil {
+		pv.ID = uuid.New()
+	}
+	return nil
+}
+
+func (st *SOPTemplate) BeforeCreate(tx *gorm.DB) error {
+	if st.ID == uuid.Nil {
+		st.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ss *SOPStep) BeforeCreate(tx *gorm.DB) error {
+	if ss.ID == uuid.Nil {
+		ss.ID = uuid.New()
+	}
+	return nil
+}
+
+func (ci *IncidentChecklistItem) BeforeCreate(tx *gorm.DB) error {
+	if ci.ID == uuid.Nil {
+		ci.ID = uuid.New()
+	}
+	return nil
+}
+
+func (sc *StatusChange) BeforeCreate(tx *gorm.DB) error {
+	if sc.ID == uuid.Nil {
+		sc.ID = uuid.New()
+	}
+	return nil
+}
+
+func (rs *ReportSchedule) BeforeCreate(tx *gorm.DB) error {
+	if rs.ID == uuid.Nil {
+		rs.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *Report) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *IncidentReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *DeviceToken) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *NotificationDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (w *WebhookSubscription) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (a *WebhookAttempt) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (w *MaintenanceWindow) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *SuppressionRule) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (a *SuppressedAlert) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *ArmingSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *ArmingPeriod) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *HolidayCalendar) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (h *Holiday) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+func (o *ArmingOverride) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
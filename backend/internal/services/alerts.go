@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"smart-city-surveillance/internal/models"
 	"smart-city-surveillance/pkg/websocket"
@@ -14,59 +16,68 @@ import (
 
 // AlertsService defines alert-related operations
 type AlertsService interface {
-	GetAlerts(ctx context.Context, filters AlertsFilter, userRole models.UserRole, userID string) ([]models.Alert, error)
+	GetAlerts(ctx context.Context, q ListQuery, userRole models.UserRole, userID string) (*Page[models.Alert], error)
 	GetAlert(ctx context.Context, id string, userRole models.UserRole, userID string) (*models.Alert, error)
-	AcknowledgeAlert(ctx context.Context, id string, userRole models.UserRole) (*models.Alert, error)
+	AcknowledgeAlert(ctx context.Context, id string, userRole models.UserRole, userID string) (*models.Alert, error)
 	AssignAlert(ctx context.Context, id string, guardID []string) (*models.Alert, *models.Incident, error)
+	// CreateAlert raises an alert, or returns an AlertSuppressedError when a
+	// maintenance window covers it or the arming policy discards it
 	CreateAlert(ctx context.Context, alert models.Alert) (*models.Alert, error)
 	UpdateAlert(ctx context.Context, id string, status models.AlertStatus) (*models.Alert, error)
 }
 
-// AlertsFilter contains optional filter parameters for listing alerts
-type AlertsFilter struct {
-	Status    string
-	Severity  string
-	Type      string
-	PremiseID string
+var alertListSpec = &listSpec[models.Alert]{
+	table: "alerts",
+	id:    func(a *models.Alert) uuid.UUID { return a.ID },
+	sorts: map[string]listColumn[models.Alert]{
+		"created_at": {expr: "alerts.created_at", kind: cursorTime, value: func(a *models.Alert) any { return a.CreatedAt }},
+		"updated_at": {expr: "alerts.updated_at", kind: cursorTime, value: func(a *models.Alert) any { return a.UpdatedAt }},
+		"severity":   {expr: severityRankSQL("alerts.severity"), kind: cursorInt, value: func(a *models.Alert) any { return severityRank(string(a.Severity)) }},
+		"status":     {expr: "alerts.status", kind: cursorString, value: func(a *models.Alert) any { return string(a.Status) }},
+		"type":       {expr: "alerts.type", kind: cursorString, value: func(a *models.Alert) any { return string(a.Type) }},
+		"title":      {expr: "alerts.title", kind: cursorString, value: func(a *models.Alert) any { return a.Title }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"status":            {clause: "alerts.status IN ?"},
+		"severity":          {clause: "alerts.severity IN ?"},
+		"type":              {clause: "alerts.type IN ?"},
+		"premise_id":        {clause: "alerts.premise_id IN ?", kind: filterUUID},
+		"camera_id":         {clause: "alerts.camera_id IN ?", kind: filterUUID},
+		"zone_id":           {clause: "alerts.zone_id IN ?", kind: filterUUID},
+		"assigned_guard_id": {clause: "alerts.assigned_guard_id IN ?", kind: filterUUID},
+	},
+	relations: map[string]listRelation{
+		"camera":         {preload: "Camera"},
+		"premise":        {preload: "Premise"},
+		"assigned_guard": {preload: "AssignedGuard"},
+		"zone":           {preload: "Zone"},
+		"incident":       {preload: "Incident"},
+		"guard":          {preload: "Guard"},
+	},
 }
 
 type alertsService struct {
-	db    *gorm.DB
-	wsHub *websocket.Hub
+	db          *gorm.DB
+	wsHub       *websocket.Hub
+	snapshots   SnapshotService
+	notify      NotificationsService
+	maintenance MaintenanceService
+	arming      ArmingService
+	mapDiff     *mapPublisher
+	audit       AuditService
 }
 
-func NewAlertsService(db *gorm.DB, wsHub *websocket.Hub) AlertsService {
-	return &alertsService{db: db, wsHub: wsHub}
+func NewAlertsService(db *gorm.DB, wsHub *websocket.Hub, snapshots SnapshotService, notify NotificationsService, maintenance MaintenanceService, arming ArmingService, audit AuditService) AlertsService {
+	return &alertsService{db: db, wsHub: wsHub, snapshots: snapshots, notify: notify, maintenance: maintenance, arming: arming, mapDiff: newMapPublisher(db, wsHub), audit: audit}
 }
 
-func (s *alertsService) GetAlerts(ctx context.Context, filters AlertsFilter, userRole models.UserRole, userID string) ([]models.Alert, error) {
-	var alerts []models.Alert
-	query := s.db.WithContext(ctx).Preload("Camera").Preload("Premise").Preload("AssignedGuard")
-
-	if filters.Status != "" {
-		query = query.Where("status = ?", filters.Status)
-	}
-	if filters.Severity != "" {
-		query = query.Where("severity = ?", filters.Severity)
-	}
-	if filters.Type != "" {
-		query = query.Where("type = ?", filters.Type)
-	}
-	if filters.PremiseID != "" {
-		if premiseUUID, err := uuid.Parse(filters.PremiseID); err == nil {
-			query = query.Where("premise_id = ?", premiseUUID)
-		}
-	}
-
+func (s *alertsService) GetAlerts(ctx context.Context, q ListQuery, userRole models.UserRole, userID string) (*Page[models.Alert], error) {
+	query := s.db.WithContext(ctx).Model(&models.Alert{})
 	if userRole == models.RoleSecurityGuard {
-		query = query.Where("assigned_guard_id = ?", userID)
+		query = query.Where("alerts.assigned_guard_id = ?", userID)
 	}
-
-	query = query.Order("created_at DESC")
-	if err := query.Find(&alerts).Error; err != nil {
-		return nil, err
-	}
-	return alerts, nil
+	return alertListSpec.find(query, q)
 }
 
 func (s *alertsService) GetAlert(ctx context.Context, id string, userRole models.UserRole, userID string) (*models.Alert, error) {
@@ -76,17 +87,28 @@ func (s *alertsService) GetAlert(ctx context.Context, id string, userRole models
 	}
 
 	var alert models.Alert
-	query := s.db.WithContext(ctx).Preload("Camera").Preload("Premise").Preload("AssignedGuard").Preload("Incident")
+	query := s.db.WithContext(ctx).Preload("Camera").Preload("Premise").Preload("AssignedGuard").Preload("Incident").Preload("Zone").
+		Preload("Snapshots", func(db *gorm.DB) *gorm.DB {
+			return db.Order("captured_at ASC")
+		})
 	if userRole == models.RoleSecurityGuard {
 		query = query.Where("assigned_guard_id = ?", userID)
 	}
 	if err := query.First(&alert, "id = ?", alertID).Error; err != nil {
 		return nil, err
 	}
+	s.snapshots.SignSnapshots(alert.Snapshots)
 	return &alert, nil
 }
 
-func (s *alertsService) AcknowledgeAlert(ctx context.Context, id string, userRole models.UserRole) (*models.Alert, error) {
+func (s *alertsService) AcknowledgeAlert(ctx context.Context, id string, userRole models.UserRole, userID string) (alert *models.Alert, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "alert.acknowledge", "alert", normalizeID(id), userID, userRole, err, nil)
+	}()
+	return s.acknowledgeAlert(ctx, id, userRole)
+}
+
+func (s *alertsService) acknowledgeAlert(ctx context.Context, id string, userRole models.UserRole) (*models.Alert, error) {
 	if userRole != models.RoleSCSOperator {
 		return nil, gorm.ErrInvalidData
 	}
@@ -98,11 +120,14 @@ func (s *alertsService) AcknowledgeAlert(ctx context.Context, id string, userRol
 	if err := s.db.WithContext(ctx).First(&alert, "id = ?", alertID).Error; err != nil {
 		return nil, err
 	}
+	previous := alert.Status
 	alert.Status = models.AlertStatusAcknowledged
 	if err := s.db.WithContext(ctx).Save(&alert).Error; err != nil {
 		return nil, err
 	}
-	s.wsHub.Broadcast("alert_acknowledged", alert)
+	recordStatusChange(ctx, s.db, alert.ID, nil, string(previous), string(alert.Status))
+	s.wsHub.Publish(alertTopics(ctx, s.db, &alert), "alert_acknowledged", alert)
+	s.mapDiff.alert(ctx, &alert)
 	return &alert, nil
 }
 
@@ -118,6 +143,18 @@ func (s *alertsService) AssignAlert(ctx context.Context, id string, guardIDs []s
 		return nil, nil, fmt.Errorf("alert not found: %w", err)
 	}
 
+	// Once an incident of the alert is signed off, its response is over
+	var finalized int64
+	if err := s.db.WithContext(ctx).Model(&models.IncidentReport{}).
+		Joins("JOIN incidents ON incidents.id = incident_reports.incident_id").
+		Where("incidents.alert_id = ? AND incident_reports.status = ?", alertUUID, models.IncidentReportFinalized).
+		Count(&finalized).Error; err != nil {
+		return nil, nil, err
+	}
+	if finalized > 0 {
+		return nil, nil, ErrIncidentReportLocked
+	}
+
 	// Validate guard IDs
 	if len(guardIDs) == 0 {
 		return nil, nil, errors.New("no guard IDs provided")
@@ -133,62 +170,150 @@ func (s *alertsService) AssignAlert(ctx context.Context, id string, guardIDs []s
 		return nil, nil, errors.New("no valid guards found")
 	}
 
-	// Tạo incident
+	// The incident, its checklist and guards and the alert status change
+	// together, so that a failure leaves no incident behind
 	incident := models.Incident{
 		AlertID:     alertUUID,
 		Status:      models.IncidentStatusOpen,
 		Location:    alert.Location,
 		Description: alert.Description,
 	}
-	if err := s.db.WithContext(ctx).Create(&incident).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to create incident: %w", err)
-	}
+	previous := alert.Status
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Tạo incident
+		if err := tx.Create(&incident).Error; err != nil {
+			return fmt.Errorf("failed to create incident: %w", err)
+		}
+		if err := instantiateChecklist(ctx, tx, &incident, &alert); err != nil {
+			return fmt.Errorf("failed to create checklist: %w", err)
+		}
 
-	// Cập nhật alert status
-	alert.Status = models.AlertStatusAssigned
-	if err := s.db.WithContext(ctx).Save(&alert).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to update alert: %w", err)
-	}
+		// Cập nhật alert status
+		alert.Status = models.AlertStatusAssigned
+		if err := tx.Save(&alert).Error; err != nil {
+			return fmt.Errorf("failed to update alert: %w", err)
+		}
 
-	// Insert nhiều incident_guards
-	var incidentGuards []models.IncidentGuard
-	for _, g := range guards {
-		incidentGuards = append(incidentGuards, models.IncidentGuard{
-			IncidentID: incident.ID,
-			GuardID:    g.ID,
-		})
-	}
-	if err := s.db.WithContext(ctx).Create(&incidentGuards).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to assign guards: %w", err)
+		// Insert nhiều incident_guards
+		var incidentGuards []models.IncidentGuard
+		for _, g := range guards {
+			incidentGuards = append(incidentGuards, models.IncidentGuard{
+				IncidentID: incident.ID,
+				GuardID:    g.ID,
+			})
+		}
+		if err := tx.Create(&incidentGuards).Error; err != nil {
+			return fmt.Errorf("failed to assign guards: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	recordStatusChange(ctx, s.db, alert.ID, nil, string(previous), string(alert.Status))
+	recordStatusChange(ctx, s.db, alert.ID, &incident.ID, "", string(incident.Status))
 
 	// Gửi notification
 	for _, g := range guards {
-		s.wsHub.SendToUser(g.ID.String(), "guard_dispatched", map[string]any{
+		s.wsHub.SendToUserWithAck(g.ID.String(), "guard_dispatched", map[string]any{
 			"alert_id":    alert.ID,
 			"incident_id": incident.ID,
 			"title":       alert.Title,
 			"description": alert.Description,
 			"location":    alert.Location,
 			"severity":    alert.Severity,
+			"checklist":   incident.Checklist,
 		})
 	}
-	s.wsHub.BroadcastToRole("scs_operator", "alert_assigned", map[string]any{
+	guardIDList := make([]uuid.UUID, len(guards))
+	for i, g := range guards {
+		guardIDList[i] = g.ID
+	}
+	s.notify.Notify(ctx, guardIDList, Notification{
+		Event:    NotifyGuardDispatched,
+		Severity: alert.Severity,
+		Data: map[string]any{
+			"alert_id":    alert.ID,
+			"incident_id": incident.ID,
+			"title":       alert.Title,
+			"description": alert.Description,
+			"location":    alert.Location,
+			"severity":    alert.Severity,
+		},
+	})
+	s.wsHub.Publish(alertTopics(ctx, s.db, &alert), "alert_assigned", map[string]any{
 		"alert_id":    alert.ID,
 		"incident_id": incident.ID,
 		"guards":      guards,
 	})
+	s.mapDiff.alert(ctx, &alert)
 
 	return &alert, &incident, nil
 }
 
-
 func (s *alertsService) CreateAlert(ctx context.Context, alert models.Alert) (*models.Alert, error) {
 	alert.Status = models.AlertStatusPending
+
+	// Alerts inherit the zone of the camera that raised them
+	if alert.CameraID != nil && alert.ZoneID == nil {
+		var camera models.Camera
+		if err := s.db.WithContext(ctx).First(&camera, "id = ?", *alert.CameraID).Error; err == nil {
+			alert.ZoneID = camera.ZoneID
+		}
+	}
+
+	// Alerts covered by a maintenance window are recorded instead of raised.
+	// If the check fails the alert is raised rather than lost.
+	suppressed, err := s.maintenance.Suppress(ctx, &alert, time.Now())
+	if err != nil {
+		log.Printf("Maintenance window check failed for %s alert: %v", alert.Type, err)
+	} else if suppressed != nil {
+		return nil, &AlertSuppressedError{Suppressed: suppressed}
+	}
+
+	// Alerts from disarmed areas are downgraded or discarded as the policy
+	// for their type says
+	discarded, err := s.arming.Apply(ctx, &alert, time.Now())
+	if err != nil {
+		log.Printf("Arming check failed for %s alert: %v", alert.Type, err)
+	} else if discarded != nil {
+		return nil, &AlertSuppressedError{Suppressed: discarded}
+	}
+
 	if err := s.db.WithContext(ctx).Create(&alert).Error; err != nil {
 		return nil, err
 	}
-	s.wsHub.BroadcastToRole("scs_operator", "alert_created", alert)
+	recordStatusChange(ctx, s.db, alert.ID, nil, "", string(alert.Status))
+
+	// Pre-event and immediate snapshots go out with alert_created, the
+	// immediate one only if the camera answers within the alert timeout;
+	// later frames follow as a separate alert_snapshots_added event
+	if alert.CameraID != nil {
+		snapshots, err := s.snapshots.CaptureForAlert(ctx, &alert)
+		if err != nil {
+			log.Printf("Snapshot capture failed for alert %s: %v", alert.ID, err)
+		}
+		alert.Snapshots = snapshots
+		go s.snapshots.CapturePostEvent(alert)
+	}
+
+	s.wsHub.Publish(alertTopics(ctx, s.db, &alert), "alert_created", alert)
+	s.mapDiff.alert(ctx, &alert)
+
+	s.notify.NotifyRole(ctx, models.RoleSCSOperator, Notification{
+		Event:    NotifyAlertCreated,
+		Severity: alert.Severity,
+		Data: map[string]any{
+			"alert_id":    alert.ID,
+			"premise_id":  alert.PremiseID,
+			"title":       alert.Title,
+			"description": alert.Description,
+			"type":        alert.Type,
+			"location":    alert.Location,
+			"severity":    alert.Severity,
+			"raised_at":   alert.CreatedAt,
+		},
+	})
 	return &alert, nil
 }
 
@@ -201,10 +326,15 @@ func (s *alertsService) UpdateAlert(ctx context.Context, id string, status model
 	if err := s.db.WithContext(ctx).First(&alert, "id = ?", alertID).Error; err != nil {
 		return nil, err
 	}
+	previous := alert.Status
 	alert.Status = status
 	if err := s.db.WithContext(ctx).Save(&alert).Error; err != nil {
 		return nil, err
 	}
-	s.wsHub.Broadcast("alert_updated", alert)
+	if previous != status {
+		recordStatusChange(ctx, s.db, alert.ID, nil, string(previous), string(status))
+	}
+	s.wsHub.Publish(alertTopics(ctx, s.db, &alert), "alert_updated", alert)
+	s.mapDiff.alert(ctx, &alert)
 	return &alert, nil
 }
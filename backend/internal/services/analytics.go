@@ -0,0 +1,586 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/cache"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAnalyticsPeriod = 30 * 24 * time.Hour
+	maxAnalyticsBuckets    = 1000
+)
+
+// Analytics buckets
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// Alert volume dimensions
+const (
+	VolumeByType     = "type"
+	VolumeBySeverity = "severity"
+	VolumeByPremise  = "premise"
+	VolumeByCamera   = "camera"
+	VolumeByHour     = "hour"
+)
+
+var ErrInvalidAnalyticsQuery = errors.New("invalid analytics query")
+
+// AnalyticsService aggregates alert and incident history for reporting.
+// Alerts are counted in the bucket they were raised in; guard figures are
+// over the incidents dispatched in the period.
+//
+// Response times are means over the alerts where both ends are known:
+// acknowledge and assign from the alert being raised, arrive from dispatch to
+// the first arrival update, resolve from the alert being raised to the alert
+// or its incident first being resolved, closed or marked a false alarm.
+type AnalyticsService interface {
+	ResponseTimes(ctx context.Context, q AnalyticsQuery) (*ResponseTimesReport, error)
+	Volumes(ctx context.Context, q AnalyticsQuery, groupBy string) (*VolumeReport, error)
+	FalseAlarms(ctx context.Context, q AnalyticsQuery) (*FalseAlarmReport, error)
+	GuardPerformance(ctx context.Context, q AnalyticsQuery) (*GuardPerformanceReport, error)
+}
+
+// AnalyticsQuery selects the period, bucket size and timezone. Zero From and
+// To cover the last 30 days; Bucket defaults to day and Timezone to UTC.
+type AnalyticsQuery struct {
+	From       time.Time
+	To         time.Time
+	Bucket     string
+	Timezone   string
+	PremiseIDs []uuid.UUID
+}
+
+// AnalyticsPeriod is the resolved period a report covers
+type AnalyticsPeriod struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Bucket   string    `json:"bucket"`
+	Timezone string    `json:"timezone"`
+}
+
+// DurationStat is a mean over Count alerts; MeanSeconds is null when there are none
+type DurationStat struct {
+	Count       int      `json:"count"`
+	MeanSeconds *float64 `json:"mean_seconds"`
+}
+
+type ResponseTimes struct {
+	Alerts      int          `json:"alerts"`
+	Acknowledge DurationStat `json:"acknowledge"`
+	Assign      DurationStat `json:"assign"`
+	Arrive      DurationStat `json:"arrive"`
+	Resolve     DurationStat `json:"resolve"`
+}
+
+type ResponseTimesBucket struct {
+	Start time.Time `json:"start"`
+	ResponseTimes
+}
+
+type ResponseTimesReport struct {
+	AnalyticsPeriod
+	Overall ResponseTimes         `json:"overall"`
+	Buckets []ResponseTimesBucket `json:"buckets"`
+}
+
+// VolumeCount is the number of alerts with one value of the dimension
+type VolumeCount struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type VolumeBucket struct {
+	Start  time.Time     `json:"start"`
+	Total  int           `json:"total"`
+	Groups []VolumeCount `json:"groups"`
+}
+
+type VolumeReport struct {
+	AnalyticsPeriod
+	GroupBy string         `json:"group_by"`
+	Total   int            `json:"total"`
+	Totals  []VolumeCount  `json:"totals"`
+	Buckets []VolumeBucket `json:"buckets"`
+}
+
+// FalseAlarmStat relates false alarms to the alerts that have been closed
+// out, since open alerts may still turn out either way
+type FalseAlarmStat struct {
+	Alerts      int      `json:"alerts"`
+	Closed      int      `json:"closed"`
+	FalseAlarms int      `json:"false_alarms"`
+	Rate        *float64 `json:"rate"`
+}
+
+type FalseAlarmBucket struct {
+	Start time.Time `json:"start"`
+	FalseAlarmStat
+}
+
+type FalseAlarmReport struct {
+	AnalyticsPeriod
+	Overall FalseAlarmStat     `json:"overall"`
+	Buckets []FalseAlarmBucket `json:"buckets"`
+}
+
+// GuardPerformance is measured on the incidents a guard was dispatched to.
+// Arrive is to the guard's own first arrival update.
+type GuardPerformance struct {
+	GuardID   uuid.UUID    `json:"guard_id"`
+	Username  string       `json:"username"`
+	FirstName string       `json:"first_name"`
+	LastName  string       `json:"last_name"`
+	Incidents int          `json:"incidents"`
+	Resolved  int          `json:"resolved"`
+	Arrive    DurationStat `json:"arrive"`
+	Resolve   DurationStat `json:"resolve"`
+}
+
+type GuardPerformanceReport struct {
+	AnalyticsPeriod
+	Guards []GuardPerformance `json:"guards"`
+}
+
+type analyticsService struct {
+	db    *gorm.DB
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+func NewAnalyticsService(db *gorm.DB, cache cache.Cache, ttl time.Duration) AnalyticsService {
+	return &analyticsService{db: db, cache: cache, ttl: ttl}
+}
+
+// recordStatusChange keeps the history analytics are computed from. The
+// status itself has already been saved, so a failure is only logged.
+func recordStatusChange(ctx context.Context, db *gorm.DB, alertID uuid.UUID, incidentID *uuid.UUID, from, to string) {
+	change := models.StatusChange{AlertID: alertID, IncidentID: incidentID, FromStatus: from, ToStatus: to}
+	if err := db.WithContext(ctx).Create(&change).Error; err != nil {
+		log.Printf("Failed to record status change of alert %s: %v", alertID, err)
+	}
+}
+
+// analyticsRange is a validated AnalyticsQuery
+type analyticsRange struct {
+	period   AnalyticsPeriod
+	loc      *time.Location
+	premises []uuid.UUID
+}
+
+func (s *analyticsService) resolve(q AnalyticsQuery) (*analyticsRange, error) {
+	r := &analyticsRange{period: AnalyticsPeriod{From: q.From, To: q.To, Bucket: q.Bucket, Timezone: q.Timezone}}
+	if r.period.Bucket == "" {
+		r.period.Bucket = BucketDay
+	}
+	var bucketLength time.Duration
+	switch r.period.Bucket {
+	case BucketDay:
+		bucketLength = 24 * time.Hour
+	case BucketWeek:
+		bucketLength = 7 * 24 * time.Hour
+	case BucketMonth:
+		bucketLength = 28 * 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("%w: bucket must be day, week or month", ErrInvalidAnalyticsQuery)
+	}
+
+	if r.period.Timezone == "" {
+		r.period.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(r.period.Timezone)
+	if err != nil || r.period.Timezone == "Local" {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidAnalyticsQuery, r.period.Timezone)
+	}
+	r.loc = loc
+
+	// An open-ended period ends at the next minute, so that repeated polls
+	// share a cache entry
+	if r.period.To.IsZero() {
+		r.period.To = time.Now().Truncate(time.Minute).Add(time.Minute)
+	}
+	if r.period.From.IsZero() {
+		r.period.From = r.period.To.Add(-defaultAnalyticsPeriod)
+	}
+	r.period.From, r.period.To = r.period.From.In(loc), r.period.To.In(loc)
+	if !r.period.To.After(r.period.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidAnalyticsQuery)
+	}
+	if r.period.To.Sub(r.period.From)/bucketLength > maxAnalyticsBuckets {
+		return nil, fmt.Errorf("%w: period is too long for %s buckets", ErrInvalidAnalyticsQuery, r.period.Bucket)
+	}
+
+	r.premises = append([]uuid.UUID(nil), q.PremiseIDs...)
+	sort.Slice(r.premises, func(i, j int) bool { return r.premises[i].String() < r.premises[j].String() })
+	return r, nil
+}
+
+func (r *analyticsRange) params() map[string]any {
+	return map[string]any{
+		"bucket":   r.period.Bucket,
+		"tz":       r.period.Timezone,
+		"from":     r.period.From,
+		"to":       r.period.To,
+		"premises": r.premises,
+	}
+}
+
+// premiseFilter restricts column to the requested premises, if any
+func (r *analyticsRange) premiseFilter(column string) string {
+	if len(r.premises) == 0 {
+		return ""
+	}
+	return " AND " + column + " IN @premises"
+}
+
+func (r *analyticsRange) cacheKey(report string, extra ...string) string {
+	premises := make([]string, len(r.premises))
+	for i, id := range r.premises {
+		premises[i] = id.String()
+	}
+	return strings.Join(append([]string{
+		"analytics", report,
+		r.period.From.UTC().Format(time.RFC3339), r.period.To.UTC().Format(time.RFC3339),
+		r.period.Bucket, r.period.Timezone, strings.Join(premises, ","),
+	}, extra...), "|")
+}
+
+// cached returns the report stored under key, computing and storing it when
+// missing. The cache is best effort: when it fails the report is computed.
+func cached[T any](ctx context.Context, s *analyticsService, key string, compute func() (*T, error)) (*T, error) {
+	if s.cache != nil {
+		if data, ok, err := s.cache.Get(ctx, key); err != nil {
+			log.Printf("Analytics cache read failed: %v", err)
+		} else if ok {
+			var report T
+			if err := json.Unmarshal(data, &report); err == nil {
+				return &report, nil
+			}
+		}
+	}
+
+	report, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	if s.cache != nil {
+		if data, err := json.Marshal(report); err == nil {
+			if err := s.cache.Set(ctx, key, data, s.ttl); err != nil {
+				log.Printf("Analytics cache write failed: %v", err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// bucketSQL is the start of the bucket a timestamp falls in, in the query's
+// timezone
+const bucketSQL = "date_trunc(@bucket, %s AT TIME ZONE @tz) AT TIME ZONE @tz"
+
+// alertTimesSQL lists the alerts raised in the period with the moments they
+// were acknowledged, assigned, reached and resolved. Assignment falls back to
+// the incident being created for alerts older than the status history.
+const alertTimesSQL = `
+SELECT a.id, a.created_at, %s AS bucket,
+	(SELECT MIN(sc.created_at) FROM status_changes sc
+		WHERE sc.alert_id = a.id AND sc.incident_id IS NULL AND sc.to_status <> 'pending') AS acknowledged_at,
+	COALESCE((SELECT MIN(sc.created_at) FROM status_changes sc
+		WHERE sc.alert_id = a.id AND sc.incident_id IS NULL AND sc.to_status = 'assigned'), i.created_at) AS assigned_at,
+	i.created_at AS dispatched_at,
+	(SELECT MIN(u.created_at) FROM incident_updates u
+		WHERE u.incident_id = i.id AND u.type = 'arrival') AS arrived_at,
+	(SELECT MIN(sc.created_at) FROM status_changes sc
+		WHERE sc.alert_id = a.id AND sc.to_status IN ('resolved', 'closed', 'false_alarm')) AS resolved_at
+FROM alerts a
+LEFT JOIN incidents i ON i.alert_id = a.id
+WHERE a.created_at >= @from AND a.created_at < @to%s`
+
+type responseTimesRow struct {
+	Bucket             time.Time
+	Alerts             int
+	Acknowledged       int
+	AcknowledgeSeconds *float64
+	Assigned           int
+	AssignSeconds      *float64
+	Arrived            int
+	ArriveSeconds      *float64
+	Resolved           int
+	ResolveSeconds     *float64
+}
+
+func (s *analyticsService) ResponseTimes(ctx context.Context, q AnalyticsQuery) (*ResponseTimesReport, error) {
+	r, err := s.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	return cached(ctx, s, r.cacheKey("response_times"), func() (*ResponseTimesReport, error) {
+		query := `WITH alert_times AS (` +
+			fmt.Sprintf(alertTimesSQL, fmt.Sprintf(bucketSQL, "a.created_at"), r.premiseFilter("a.premise_id")) + `)
+SELECT bucket,
+	COUNT(*) AS alerts,
+	COUNT(acknowledged_at) AS acknowledged,
+	SUM(EXTRACT(EPOCH FROM acknowledged_at - created_at)) AS acknowledge_seconds,
+	COUNT(assigned_at) AS assigned,
+	SUM(EXTRACT(EPOCH FROM assigned_at - created_at)) AS assign_seconds,
+	COUNT(arrived_at) AS arrived,
+	SUM(EXTRACT(EPOCH FROM arrived_at - dispatched_at)) AS arrive_seconds,
+	COUNT(resolved_at) AS resolved,
+	SUM(EXTRACT(EPOCH FROM resolved_at - created_at)) AS resolve_seconds
+FROM alert_times
+GROUP BY bucket
+ORDER BY bucket`
+
+		var rows []responseTimesRow
+		if err := s.db.WithContext(ctx).Raw(query, r.params()).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		report := &ResponseTimesReport{AnalyticsPeriod: r.period, Buckets: []ResponseTimesBucket{}}
+		var total responseTimesRow
+		for _, row := range rows {
+			report.Buckets = append(report.Buckets, ResponseTimesBucket{Start: row.Bucket.In(r.loc), ResponseTimes: row.times()})
+			total.Alerts += row.Alerts
+			total.Acknowledged += row.Acknowledged
+			total.AcknowledgeSeconds = addSeconds(total.AcknowledgeSeconds, row.AcknowledgeSeconds)
+			total.Assigned += row.Assigned
+			total.AssignSeconds = addSeconds(total.AssignSeconds, row.AssignSeconds)
+			total.Arrived += row.Arrived
+			total.ArriveSeconds = addSeconds(total.ArriveSeconds, row.ArriveSeconds)
+			total.Resolved += row.Resolved
+			total.ResolveSeconds = addSeconds(total.ResolveSeconds, row.ResolveSeconds)
+		}
+		report.Overall = total.times()
+		return report, nil
+	})
+}
+
+func (row responseTimesRow) times() ResponseTimes {
+	return ResponseTimes{
+		Alerts:      row.Alerts,
+		Acknowledge: durationStat(row.Acknowledged, row.AcknowledgeSeconds),
+		Assign:      durationStat(row.Assigned, row.AssignSeconds),
+		Arrive:      durationStat(row.Arrived, row.ArriveSeconds),
+		Resolve:     durationStat(row.Resolved, row.ResolveSeconds),
+	}
+}
+
+func durationStat(count int, totalSeconds *float64) DurationStat {
+	stat := DurationStat{Count: count}
+	if count > 0 && totalSeconds != nil {
+		mean := *totalSeconds / float64(count)
+		stat.MeanSeconds = &mean
+	}
+	return stat
+}
+
+func addSeconds(total, seconds *float64) *float64 {
+	if seconds == nil {
+		return total
+	}
+	sum := *seconds
+	if total != nil {
+		sum += *total
+	}
+	return &sum
+}
+
+// volumeDimensions are the key and label of each dimension, and the join
+// they need
+var volumeDimensions = map[string]struct {
+	key, label, join string
+}{
+	VolumeByType:     {"a.type", "a.type", ""},
+	VolumeBySeverity: {"a.severity", "a.severity", ""},
+	VolumeByPremise:  {"a.premise_id::text", "p.name", "JOIN premises p ON p.id = a.premise_id"},
+	VolumeByCamera:   {"COALESCE(a.camera_id::text, '')", "COALESCE(c.name, '')", "LEFT JOIN cameras c ON c.id = a.camera_id"},
+	VolumeByHour:     {"to_char(a.created_at AT TIME ZONE @tz, 'HH24')", "to_char(a.created_at AT TIME ZONE @tz, 'HH24')", ""},
+}
+
+type volumeRow struct {
+	Bucket time.Time
+	Key    string
+	Label  string
+	Count  int
+}
+
+func (s *analyticsService) Volumes(ctx context.Context, q AnalyticsQuery, groupBy string) (*VolumeReport, error) {
+	if groupBy == "" {
+		groupBy = VolumeByType
+	}
+	dimension, ok := volumeDimensions[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: group_by must be type, severity, premise, camera or hour", ErrInvalidAnalyticsQuery)
+	}
+	r, err := s.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	return cached(ctx, s, r.cacheKey("volumes", groupBy), func() (*VolumeReport, error) {
+		query := fmt.Sprintf(`SELECT %s AS bucket, %s AS key, %s AS label, COUNT(*) AS count
+FROM alerts a %s
+WHERE a.created_at >= @from AND a.created_at < @to%s
+GROUP BY 1, 2, 3
+ORDER BY 1, 4 DESC, 2`,
+			fmt.Sprintf(bucketSQL, "a.created_at"), dimension.key, dimension.label, dimension.join, r.premiseFilter("a.premise_id"))
+
+		var rows []volumeRow
+		if err := s.db.WithContext(ctx).Raw(query, r.params()).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		report := &VolumeReport{AnalyticsPeriod: r.period, GroupBy: groupBy, Totals: []VolumeCount{}, Buckets: []VolumeBucket{}}
+		totals := map[string]*VolumeCount{}
+		for _, row := range rows {
+			start := row.Bucket.In(r.loc)
+			if n := len(report.Buckets); n == 0 || !report.Buckets[n-1].Start.Equal(start) {
+				report.Buckets = append(report.Buckets, VolumeBucket{Start: start, Groups: []VolumeCount{}})
+			}
+			bucket := &report.Buckets[len(report.Buckets)-1]
+			bucket.Groups = append(bucket.Groups, VolumeCount{Key: row.Key, Label: row.Label, Count: row.Count})
+			bucket.Total += row.Count
+			report.Total += row.Count
+
+			if totals[row.Key] == nil {
+				totals[row.Key] = &VolumeCount{Key: row.Key, Label: row.Label}
+			}
+			totals[row.Key].Count += row.Count
+		}
+		for _, count := range totals {
+			report.Totals = append(report.Totals, *count)
+		}
+		sort.Slice(report.Totals, func(i, j int) bool {
+			if groupBy == VolumeByHour {
+				return report.Totals[i].Key < report.Totals[j].Key
+			}
+			if report.Totals[i].Count != report.Totals[j].Count {
+				return report.Totals[i].Count > report.Totals[j].Count
+			}
+			return report.Totals[i].Key < report.Totals[j].Key
+		})
+		return report, nil
+	})
+}
+
+type falseAlarmRow struct {
+	Bucket      time.Time
+	Alerts      int
+	Closed      int
+	FalseAlarms int
+}
+
+func (s *analyticsService) FalseAlarms(ctx context.Context, q AnalyticsQuery) (*FalseAlarmReport, error) {
+	r, err := s.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	return cached(ctx, s, r.cacheKey("false_alarms"), func() (*FalseAlarmReport, error) {
+		query := fmt.Sprintf(`SELECT %s AS bucket,
+	COUNT(*) AS alerts,
+	COUNT(*) FILTER (WHERE a.status IN ('resolved', 'closed', 'false_alarm')) AS closed,
+	COUNT(*) FILTER (WHERE a.status = 'false_alarm') AS false_alarms
+FROM alerts a
+WHERE a.created_at >= @from AND a.created_at < @to%s
+GROUP BY 1
+ORDER BY 1`, fmt.Sprintf(bucketSQL, "a.created_at"), r.premiseFilter("a.premise_id"))
+
+		var rows []falseAlarmRow
+		if err := s.db.WithContext(ctx).Raw(query, r.params()).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		report := &FalseAlarmReport{AnalyticsPeriod: r.period, Buckets: []FalseAlarmBucket{}}
+		var total falseAlarmRow
+		for _, row := range rows {
+			report.Buckets = append(report.Buckets, FalseAlarmBucket{Start: row.Bucket.In(r.loc), FalseAlarmStat: row.stat()})
+			total.Alerts += row.Alerts
+			total.Closed += row.Closed
+			total.FalseAlarms += row.FalseAlarms
+		}
+		report.Overall = total.stat()
+		return report, nil
+	})
+}
+
+func (row falseAlarmRow) stat() FalseAlarmStat {
+	stat := FalseAlarmStat{Alerts: row.Alerts, Closed: row.Closed, FalseAlarms: row.FalseAlarms}
+	if row.Closed > 0 {
+		rate := float64(row.FalseAlarms) / float64(row.Closed)
+		stat.Rate = &rate
+	}
+	return stat
+}
+
+type guardPerformanceRow struct {
+	GuardID        uuid.UUID
+	Username       string
+	FirstName      string
+	LastName       string
+	Incidents      int
+	Resolved       int
+	Arrived        int
+	ArriveSeconds  *float64
+	ResolvedTimed  int
+	ResolveSeconds *float64
+}
+
+func (s *analyticsService) GuardPerformance(ctx context.Context, q AnalyticsQuery) (*GuardPerformanceReport, error) {
+	r, err := s.resolve(q)
+	if err != nil {
+		return nil, err
+	}
+	return cached(ctx, s, r.cacheKey("guards"), func() (*GuardPerformanceReport, error) {
+		query := `SELECT u.id AS guard_id, u.username, u.first_name, u.last_name,
+	COUNT(*) AS incidents,
+	COUNT(*) FILTER (WHERE i.status IN ('resolved', 'closed')) AS resolved,
+	COUNT(arrival.at) AS arrived,
+	SUM(EXTRACT(EPOCH FROM arrival.at - i.created_at)) AS arrive_seconds,
+	COUNT(resolution.at) AS resolved_timed,
+	SUM(EXTRACT(EPOCH FROM resolution.at - i.created_at)) AS resolve_seconds
+FROM incident_guards ig
+JOIN users u ON u.id = ig.guard_id
+JOIN incidents i ON i.id = ig.incident_id
+JOIN alerts a ON a.id = i.alert_id
+LEFT JOIN LATERAL (SELECT MIN(created_at) AS at FROM incident_updates
+	WHERE incident_id = i.id AND guard_id = ig.guard_id AND type = 'arrival') arrival ON true
+LEFT JOIN LATERAL (SELECT MIN(created_at) AS at FROM status_changes
+	WHERE incident_id = i.id AND to_status IN ('resolved', 'closed')) resolution ON true
+WHERE i.created_at >= @from AND i.created_at < @to` + r.premiseFilter("a.premise_id") + `
+GROUP BY u.id, u.username, u.first_name, u.last_name
+ORDER BY incidents DESC, u.username`
+
+		var rows []guardPerformanceRow
+		if err := s.db.WithContext(ctx).Raw(query, r.params()).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+
+		report := &GuardPerformanceReport{AnalyticsPeriod: r.period, Guards: []GuardPerformance{}}
+		for _, row := range rows {
+			report.Guards = append(report.Guards, GuardPerformance{
+				GuardID:   row.GuardID,
+				Username:  row.Username,
+				FirstName: row.FirstName,
+				LastName:  row.LastName,
+				Incidents: row.Incidents,
+				Resolved:  row.Resolved,
+				Arrive:    durationStat(row.Arrived, row.ArriveSeconds),
+				Resolve:   durationStat(row.ResolvedTimed, row.ResolveSeconds),
+			})
+		}
+		return report, nil
+	})
+}
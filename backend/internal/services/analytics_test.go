@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/pkg/cache"
+
+	"github.com/google/uuid"
+)
+
+func TestResolveAnalyticsRange(t *testing.T) {
+	s := &analyticsService{}
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	r, err := s.resolve(AnalyticsQuery{})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if p := r.period; p.Bucket != BucketDay || p.Timezone != "UTC" || p.To.Second() != 0 || p.To.Sub(p.From) != defaultAnalyticsPeriod {
+		t.Errorf("default period = %+v", p)
+	}
+
+	r, err = s.resolve(AnalyticsQuery{From: from, To: to, Bucket: BucketWeek, Timezone: "Europe/Berlin"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if p := r.period; !p.From.Equal(from) || !p.To.Equal(to) || p.From.Location() != r.loc || r.loc.String() != "Europe/Berlin" {
+		t.Errorf("period = %+v in %s", p, r.loc)
+	}
+
+	for _, tt := range []struct {
+		name string
+		q    AnalyticsQuery
+	}{
+		{"unknown bucket", AnalyticsQuery{From: from, To: to, Bucket: "hour"}},
+		{"unknown timezone", AnalyticsQuery{From: from, To: to, Timezone: "Mars/Olympus"}},
+		{"local timezone", AnalyticsQuery{From: from, To: to, Timezone: "Local"}},
+		{"empty period", AnalyticsQuery{From: to, To: to}},
+		{"reversed period", AnalyticsQuery{From: to, To: from}},
+		{"too many buckets", AnalyticsQuery{From: from.AddDate(-3, 0, 0), To: to}},
+	} {
+		if _, err := s.resolve(tt.q); !errors.Is(err, ErrInvalidAnalyticsQuery) {
+			t.Errorf("%s: resolve = %v, want ErrInvalidAnalyticsQuery", tt.name, err)
+		}
+	}
+	// The same period is fine in bigger buckets
+	if _, err := s.resolve(AnalyticsQuery{From: from.AddDate(-3, 0, 0), To: to, Bucket: BucketWeek}); err != nil {
+		t.Errorf("resolve three years by week: %v", err)
+	}
+}
+
+func TestAnalyticsCacheKeyIgnoresPremiseOrder(t *testing.T) {
+	s := &analyticsService{}
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, b := uuid.New(), uuid.New()
+	first, _ := s.resolve(AnalyticsQuery{From: from, To: from.AddDate(0, 1, 0), PremiseIDs: []uuid.UUID{a, b}})
+	second, _ := s.resolve(AnalyticsQuery{From: from, To: from.AddDate(0, 1, 0), PremiseIDs: []uuid.UUID{b, a}})
+	if first.cacheKey("volumes", "type") != second.cacheKey("volumes", "type") {
+		t.Errorf("cache keys differ:\n%s\n%s", first.cacheKey("volumes", "type"), second.cacheKey("volumes", "type"))
+	}
+	if first.cacheKey("volumes", "type") == first.cacheKey("volumes", "severity") {
+		t.Error("cache key does not include the dimension")
+	}
+	if filter := first.premiseFilter("a.premise_id"); filter != " AND a.premise_id IN @premises" {
+		t.Errorf("premiseFilter = %q", filter)
+	}
+}
+
+func TestCachedReportsAreReused(t *testing.T) {
+	s := &analyticsService{cache: cache.NewMemory(), ttl: time.Minute}
+	ctx := context.Background()
+	computed := 0
+	compute := func() (*FalseAlarmStat, error) {
+		computed++
+		return &FalseAlarmStat{Alerts: computed}, nil
+	}
+	for i := 0; i < 2; i++ {
+		stat, err := cached(ctx, s, "analytics|test", compute)
+		if err != nil || stat.Alerts != 1 {
+			t.Errorf("cached = %+v, %v, want the first report", stat, err)
+		}
+	}
+	if computed != 1 {
+		t.Errorf("computed %d times, want once", computed)
+	}
+
+	failed := errors.New("query failed")
+	if _, err := cached(ctx, s, "analytics|other", func() (*FalseAlarmStat, error) { return nil, failed }); !errors.Is(err, failed) {
+		t.Errorf("cached = %v, want the compute error", err)
+	}
+}
+
+func TestMeanStats(t *testing.T) {
+	total := addSeconds(addSeconds(nil, nil), ptrTo(30.0))
+	total = addSeconds(total, ptrTo(90.0))
+	if stat := durationStat(2, total); stat.Count != 2 || stat.MeanSeconds == nil || *stat.MeanSeconds != 60 {
+		t.Errorf("durationStat = %+v, want a mean of 60", stat)
+	}
+	if stat := durationStat(0, nil); stat.MeanSeconds != nil {
+		t.Errorf("durationStat without alerts = %+v", stat)
+	}
+
+	if stat := (falseAlarmRow{Alerts: 10, Closed: 4, FalseAlarms: 1}).stat(); stat.Rate == nil || *stat.Rate != 0.25 {
+		t.Errorf("false alarm stat = %+v, want a rate of 0.25", stat)
+	}
+	if stat := (falseAlarmRow{Alerts: 3}).stat(); stat.Rate != nil {
+		t.Errorf("false alarm stat without closed alerts = %+v", stat)
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,798 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+const (
+	armingTimeLayout = "15:04"
+	holidayLayout    = "2006-01-02"
+)
+
+var ErrInvalidArming = errors.New("invalid arming request")
+
+// Where an area's armed state comes from
+const (
+	ArmingSourceOverride = "override"
+	ArmingSourceHoliday  = "holiday"
+	ArmingSourceSchedule = "schedule"
+	ArmingSourceDefault  = "default"
+)
+
+var armingWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ArmingScheduleInput creates or replaces a schedule for a premise, or for
+// one zone of it
+type ArmingScheduleInput struct {
+	Name              string
+	PremiseID         uuid.UUID
+	ZoneID            *uuid.UUID
+	Timezone          string
+	HolidayCalendarID *uuid.UUID
+	Periods           []ArmingPeriodInput
+}
+
+// ArmingPeriodInput disarms from DisarmAt to ArmAt on each of Weekdays
+type ArmingPeriodInput struct {
+	Weekdays []string
+	DisarmAt string
+	ArmAt    string
+}
+
+type HolidayCalendarInput struct {
+	Name     string
+	Holidays []HolidayInput
+}
+
+type HolidayInput struct {
+	Date string
+	Name string
+}
+
+type ArmingPolicyInput struct {
+	Action   models.ArmingPolicyAction
+	Severity models.AlertSeverity
+}
+
+// ArmInput arms or disarms an area by hand, until Until or until resumed
+type ArmInput struct {
+	PremiseID uuid.UUID
+	ZoneID    *uuid.UUID
+	Until     *time.Time
+	Reason    string
+}
+
+// AreaState is whether a premise or zone is armed, and why
+type AreaState struct {
+	PremiseID  uuid.UUID              `json:"premise_id"`
+	ZoneID     *uuid.UUID             `json:"zone_id,omitempty"`
+	ZoneName   string                 `json:"zone_name,omitempty"`
+	Armed      bool                   `json:"armed"`
+	Source     string                 `json:"source"`
+	Override   *models.ArmingOverride `json:"override,omitempty"`
+	ScheduleID *uuid.UUID             `json:"schedule_id,omitempty"`
+	Holiday    string                 `json:"holiday,omitempty"`
+}
+
+// PremiseArmingState is the state of a premise and each of its zones
+type PremiseArmingState struct {
+	AreaState
+	At    time.Time   `json:"at"`
+	Zones []AreaState `json:"zones"`
+}
+
+// ArmingService keeps arming schedules, holiday calendars and manual
+// overrides, and applies the per-type policy to alerts from disarmed areas
+type ArmingService interface {
+	ListSchedules(ctx context.Context, premiseID *uuid.UUID) ([]models.ArmingSchedule, error)
+	GetSchedule(ctx context.Context, id uuid.UUID) (*models.ArmingSchedule, error)
+	CreateSchedule(ctx context.Context, input ArmingScheduleInput, userID string) (*models.ArmingSchedule, error)
+	UpdateSchedule(ctx context.Context, id uuid.UUID, input ArmingScheduleInput, userID string) (*models.ArmingSchedule, error)
+	DeleteSchedule(ctx context.Context, id uuid.UUID, userID string) error
+
+	ListCalendars(ctx context.Context) ([]models.HolidayCalendar, error)
+	GetCalendar(ctx context.Context, id uuid.UUID) (*models.HolidayCalendar, error)
+	CreateCalendar(ctx context.Context, input HolidayCalendarInput, userID string) (*models.HolidayCalendar, error)
+	UpdateCalendar(ctx context.Context, id uuid.UUID, input HolidayCalendarInput, userID string) (*models.HolidayCalendar, error)
+	DeleteCalendar(ctx context.Context, id uuid.UUID, userID string) error
+
+	ListPolicies(ctx context.Context) ([]models.ArmingPolicy, error)
+	SetPolicy(ctx context.Context, alertType models.AlertType, input ArmingPolicyInput, userID string) (*models.ArmingPolicy, error)
+	DeletePolicy(ctx context.Context, alertType models.AlertType, userID string) error
+
+	GetState(ctx context.Context, premiseID uuid.UUID, at time.Time) (*PremiseArmingState, error)
+	// SetArmed arms or disarms an area by hand over its schedule
+	SetArmed(ctx context.Context, input ArmInput, armed bool, userID string) (*AreaState, error)
+	// Resume clears the area's manual overrides, handing it back to its
+	// schedule
+	Resume(ctx context.Context, premiseID uuid.UUID, zoneID *uuid.UUID, userID string) (*AreaState, error)
+	ListOverrides(ctx context.Context, q ListQuery) (*Page[models.ArmingOverride], error)
+
+	// Apply lowers the severity of an alert from a disarmed area, or records
+	// it as suppressed and returns the record, as its type's policy says
+	Apply(ctx context.Context, alert *models.Alert, at time.Time) (*models.SuppressedAlert, error)
+}
+
+var armingOverrideListSpec = &listSpec[models.ArmingOverride]{
+	table: "arming_overrides",
+	id:    func(o *models.ArmingOverride) uuid.UUID { return o.ID },
+	sorts: map[string]listColumn[models.ArmingOverride]{
+		"created_at": {expr: "arming_overrides.created_at", kind: cursorTime, value: func(o *models.ArmingOverride) any { return o.CreatedAt }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"premise_id": {clause: "arming_overrides.premise_id IN ?", kind: filterUUID},
+		"zone_id":    {clause: "arming_overrides.zone_id IN ?", kind: filterUUID},
+		"armed":      {clause: "arming_overrides.armed IN ?", kind: filterBool},
+	},
+	relations: map[string]listRelation{
+		"created_by": {preload: "CreatedBy"},
+	},
+}
+
+type armingService struct {
+	db    *gorm.DB
+	wsHub *websocket.Hub
+	audit AuditService
+}
+
+func NewArmingService(db *gorm.DB, wsHub *websocket.Hub, audit AuditService) ArmingService {
+	return &armingService{db: db, wsHub: wsHub, audit: audit}
+}
+
+func (s *armingService) ListSchedules(ctx context.Context, premiseID *uuid.UUID) ([]models.ArmingSchedule, error) {
+	query := s.db.WithContext(ctx).Preload("Periods")
+	if premiseID != nil {
+		query = query.Where("premise_id = ?", *premiseID)
+	}
+	var schedules []models.ArmingSchedule
+	err := query.Order("premise_id, zone_id NULLS FIRST").Find(&schedules).Error
+	return schedules, err
+}
+
+func (s *armingService) GetSchedule(ctx context.Context, id uuid.UUID) (*models.ArmingSchedule, error) {
+	var schedule models.ArmingSchedule
+	if err := s.db.WithContext(ctx).Preload("Periods").Preload("HolidayCalendar").First(&schedule, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *armingService) CreateSchedule(ctx context.Context, input ArmingScheduleInput, userID string) (schedule *models.ArmingSchedule, err error) {
+	defer func() {
+		resourceID := ""
+		if schedule != nil {
+			resourceID = schedule.ID.String()
+		}
+		recordAction(ctx, s.audit, "arming_schedule.create", "arming_schedule", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	schedule = &models.ArmingSchedule{}
+	if err := s.applyScheduleInput(ctx, schedule, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(schedule).Error; err != nil {
+		return nil, scheduleAreaTaken(err)
+	}
+	return s.GetSchedule(ctx, schedule.ID)
+}
+
+func (s *armingService) UpdateSchedule(ctx context.Context, id uuid.UUID, input ArmingScheduleInput, userID string) (schedule *models.ArmingSchedule, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "arming_schedule.update", "arming_schedule", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	schedule, err = s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyScheduleInput(ctx, schedule, input); err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", id).Delete(&models.ArmingPeriod{}).Error; err != nil {
+			return err
+		}
+		periods := schedule.Periods
+		schedule.Periods, schedule.HolidayCalendar = nil, nil
+		if err := tx.Save(schedule).Error; err != nil {
+			return scheduleAreaTaken(err)
+		}
+		for i := range periods {
+			periods[i].ID = uuid.Nil
+			periods[i].ScheduleID = id
+		}
+		if len(periods) > 0 {
+			return tx.Create(&periods).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(ctx, id)
+}
+
+func (s *armingService) DeleteSchedule(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "arming_schedule.delete", "arming_schedule", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("schedule_id = ?", id).Delete(&models.ArmingPeriod{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.ArmingSchedule{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// scheduleAreaTaken reports a violation of the one-schedule-per-area
+// indexes (see database.Migrate) as an invalid request
+func scheduleAreaTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: the area already has a schedule", ErrInvalidArming)
+	}
+	return err
+}
+
+// applyScheduleInput validates the input into the schedule, replacing its
+// periods
+func (s *armingService) applyScheduleInput(ctx context.Context, schedule *models.ArmingSchedule, input ArmingScheduleInput) error {
+	schedule.Name = strings.TrimSpace(input.Name)
+	if schedule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidArming)
+	}
+	if err := s.checkArea(ctx, input.PremiseID, input.ZoneID); err != nil {
+		return err
+	}
+
+	schedule.PremiseID = input.PremiseID
+	schedule.ZoneID = input.ZoneID
+
+	schedule.Timezone = input.Timezone
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil || schedule.Timezone == "Local" {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidArming, schedule.Timezone)
+	}
+
+	schedule.HolidayCalendarID = input.HolidayCalendarID
+	if input.HolidayCalendarID != nil {
+		var found int64
+		if err := s.db.WithContext(ctx).Model(&models.HolidayCalendar{}).Where("id = ?", *input.HolidayCalendarID).Count(&found).Error; err != nil {
+			return err
+		}
+		if found == 0 {
+			return fmt.Errorf("%w: unknown holiday calendar", ErrInvalidArming)
+		}
+	}
+
+	periods := make([]models.ArmingPeriod, 0, len(input.Periods))
+	for _, in := range input.Periods {
+		period := models.ArmingPeriod{Weekdays: pq.StringArray{}}
+		if len(in.Weekdays) == 0 {
+			return fmt.Errorf("%w: a period needs at least one weekday", ErrInvalidArming)
+		}
+		for _, day := range in.Weekdays {
+			day = strings.ToLower(day)
+			if _, ok := armingWeekdays[day]; !ok {
+				return fmt.Errorf("%w: unknown weekday %q", ErrInvalidArming, day)
+			}
+			if !slices.Contains(period.Weekdays, day) {
+				period.Weekdays = append(period.Weekdays, day)
+			}
+		}
+		disarm, err1 := time.Parse(armingTimeLayout, in.DisarmAt)
+		arm, err2 := time.Parse(armingTimeLayout, in.ArmAt)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%w: disarm_at and arm_at must be HH:MM", ErrInvalidArming)
+		}
+		if disarm.Equal(arm) {
+			return fmt.Errorf("%w: disarm_at and arm_at must differ", ErrInvalidArming)
+		}
+		period.DisarmAt, period.ArmAt = disarm.Format(armingTimeLayout), arm.Format(armingTimeLayout)
+		periods = append(periods, period)
+	}
+	schedule.Periods = periods
+	return nil
+}
+
+func (s *armingService) ListCalendars(ctx context.Context) ([]models.HolidayCalendar, error) {
+	var calendars []models.HolidayCalendar
+	err := s.db.WithContext(ctx).Preload("Holidays", func(db *gorm.DB) *gorm.DB { return db.Order("date") }).
+		Order("name").Find(&calendars).Error
+	return calendars, err
+}
+
+func (s *armingService) GetCalendar(ctx context.Context, id uuid.UUID) (*models.HolidayCalendar, error) {
+	var calendar models.HolidayCalendar
+	if err := s.db.WithContext(ctx).Preload("Holidays", func(db *gorm.DB) *gorm.DB { return db.Order("date") }).
+		First(&calendar, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+func (s *armingService) CreateCalendar(ctx context.Context, input HolidayCalendarInput, userID string) (calendar *models.HolidayCalendar, err error) {
+	defer func() {
+		resourceID := ""
+		if calendar != nil {
+			resourceID = calendar.ID.String()
+		}
+		recordAction(ctx, s.audit, "holiday_calendar.create", "holiday_calendar", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	calendar = &models.HolidayCalendar{}
+	if err := applyCalendarInput(calendar, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(calendar).Error; err != nil {
+		return nil, err
+	}
+	return s.GetCalendar(ctx, calendar.ID)
+}
+
+func (s *armingService) UpdateCalendar(ctx context.Context, id uuid.UUID, input HolidayCalendarInput, userID string) (calendar *models.HolidayCalendar, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "holiday_calendar.update", "holiday_calendar", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	calendar, err = s.GetCalendar(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCalendarInput(calendar, input); err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_id = ?", id).Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		holidays := calendar.Holidays
+		calendar.Holidays = nil
+		if err := tx.Save(calendar).Error; err != nil {
+			return err
+		}
+		for i := range holidays {
+			holidays[i].ID = uuid.Nil
+			holidays[i].CalendarID = id
+		}
+		if len(holidays) > 0 {
+			return tx.Create(&holidays).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetCalendar(ctx, id)
+}
+
+func (s *armingService) DeleteCalendar(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "holiday_calendar.delete", "holiday_calendar", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	// Schedules on the calendar keep running without holidays
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ArmingSchedule{}).Where("holiday_calendar_id = ?", id).Update("holiday_calendar_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("calendar_id = ?", id).Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.HolidayCalendar{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func applyCalendarInput(calendar *models.HolidayCalendar, input HolidayCalendarInput) error {
+	calendar.Name = strings.TrimSpace(input.Name)
+	if calendar.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidArming)
+	}
+	seen := make(map[string]bool, len(input.Holidays))
+	holidays := make([]models.Holiday, 0, len(input.Holidays))
+	for _, in := range input.Holidays {
+		date, err := time.Parse(holidayLayout, in.Date)
+		if err != nil {
+			return fmt.Errorf("%w: holiday date %q must be YYYY-MM-DD", ErrInvalidArming, in.Date)
+		}
+		day := date.Format(holidayLayout)
+		if seen[day] {
+			return fmt.Errorf("%w: %s is listed twice", ErrInvalidArming, day)
+		}
+		seen[day] = true
+		holidays = append(holidays, models.Holiday{Date: day, Name: strings.TrimSpace(in.Name)})
+	}
+	calendar.Holidays = holidays
+	return nil
+}
+
+func (s *armingService) ListPolicies(ctx context.Context) ([]models.ArmingPolicy, error) {
+	var policies []models.ArmingPolicy
+	err := s.db.WithContext(ctx).Order("alert_type").Find(&policies).Error
+	return policies, err
+}
+
+func (s *armingService) SetPolicy(ctx context.Context, alertType models.AlertType, input ArmingPolicyInput, userID string) (policy *models.ArmingPolicy, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "arming_policy.update", "arming_policy", string(alertType), userID, models.RoleSCSOperator, err,
+			models.JSONMap{"action": string(input.Action), "severity": string(input.Severity)})
+	}()
+
+	// Guard safety alerts are raised whatever the arming state
+	if !suppressibleAlertTypes[alertType] {
+		return nil, fmt.Errorf("%w: alert type %q cannot be downgraded or discarded", ErrInvalidArming, alertType)
+	}
+	policy = &models.ArmingPolicy{AlertType: alertType, Action: input.Action}
+	switch input.Action {
+	case models.ArmingRaise, models.ArmingDiscard:
+	case models.ArmingDowngrade:
+		if severityRank(string(input.Severity)) == 0 {
+			return nil, fmt.Errorf("%w: downgrade needs a severity", ErrInvalidArming)
+		}
+		policy.Severity = input.Severity
+	default:
+		return nil, fmt.Errorf("%w: action must be raise, downgrade or discard", ErrInvalidArming)
+	}
+	if err := s.db.WithContext(ctx).Save(policy).Error; err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *armingService) DeletePolicy(ctx context.Context, alertType models.AlertType, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "arming_policy.delete", "arming_policy", string(alertType), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	result := s.db.WithContext(ctx).Delete(&models.ArmingPolicy{}, "alert_type = ?", alertType)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *armingService) GetState(ctx context.Context, premiseID uuid.UUID, at time.Time) (*PremiseArmingState, error) {
+	var found int64
+	if err := s.db.WithContext(ctx).Model(&models.Premise{}).Where("id = ?", premiseID).Count(&found).Error; err != nil {
+		return nil, err
+	}
+	if found == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	overrides, schedules, err := s.loadArea(ctx, premiseID, nil, at)
+	if err != nil {
+		return nil, err
+	}
+	state := &PremiseArmingState{AreaState: evaluateArea(premiseID, nil, overrides, schedules, at), At: at, Zones: []AreaState{}}
+
+	var zones []models.Zone
+	if err := s.db.WithContext(ctx).
+		Joins("JOIN floor_plans ON floor_plans.id = zones.floor_plan_id").
+		Where("floor_plans.premise_id = ?", premiseID).
+		Order("zones.name").Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	for _, zone := range zones {
+		zoneState := evaluateArea(premiseID, &zone.ID, overrides, schedules, at)
+		zoneState.ZoneName = zone.Name
+		state.Zones = append(state.Zones, zoneState)
+	}
+	return state, nil
+}
+
+func (s *armingService) SetArmed(ctx context.Context, input ArmInput, armed bool, userID string) (state *AreaState, err error) {
+	action := "arming.disarm"
+	if armed {
+		action = "arming.arm"
+	}
+	defer func() {
+		details := models.JSONMap{"premise_id": input.PremiseID.String(), "reason": input.Reason}
+		if input.ZoneID != nil {
+			details["zone_id"] = input.ZoneID.String()
+		}
+		if input.Until != nil {
+			details["until"] = input.Until.UTC().Format(time.RFC3339)
+		}
+		resourceID := ""
+		if state != nil && state.Override != nil {
+			resourceID = state.Override.ID.String()
+		}
+		recordAction(ctx, s.audit, action, "arming_override", resourceID, userID, models.RoleSCSOperator, err, details)
+	}()
+
+	if err := s.checkArea(ctx, input.PremiseID, input.ZoneID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if input.Until != nil && !input.Until.After(now) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidArming)
+	}
+	override := models.ArmingOverride{
+		PremiseID:   input.PremiseID,
+		ZoneID:      input.ZoneID,
+		Armed:       armed,
+		Reason:      strings.TrimSpace(input.Reason),
+		Until:       input.Until,
+		CreatedByID: requester(userID),
+	}
+	if err := s.db.WithContext(ctx).Create(&override).Error; err != nil {
+		return nil, err
+	}
+	return s.changed(ctx, input.PremiseID, input.ZoneID, now)
+}
+
+func (s *armingService) Resume(ctx context.Context, premiseID uuid.UUID, zoneID *uuid.UUID, userID string) (state *AreaState, err error) {
+	defer func() {
+		details := models.JSONMap{"premise_id": premiseID.String()}
+		if zoneID != nil {
+			details["zone_id"] = zoneID.String()
+		}
+		recordAction(ctx, s.audit, "arming.resume", "premise", premiseID.String(), userID, models.RoleSCSOperator, err, details)
+	}()
+
+	if err := s.checkArea(ctx, premiseID, zoneID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	query := s.db.WithContext(ctx).Model(&models.ArmingOverride{}).Where("premise_id = ? AND cleared_at IS NULL", premiseID)
+	if zoneID != nil {
+		query = query.Where("zone_id = ?", *zoneID)
+	} else {
+		query = query.Where("zone_id IS NULL")
+	}
+	if err := query.Update("cleared_at", now).Error; err != nil {
+		return nil, err
+	}
+	return s.changed(ctx, premiseID, zoneID, now)
+}
+
+// changed works out the area's new state and tells the premise's
+// subscribers about it
+func (s *armingService) changed(ctx context.Context, premiseID uuid.UUID, zoneID *uuid.UUID, at time.Time) (*AreaState, error) {
+	overrides, schedules, err := s.loadArea(ctx, premiseID, zoneID, at)
+	if err != nil {
+		return nil, err
+	}
+	state := evaluateArea(premiseID, zoneID, overrides, schedules, at)
+	s.wsHub.Publish([]string{PremiseTopic(premiseID)}, "arming_changed", state)
+	return &state, nil
+}
+
+func (s *armingService) ListOverrides(ctx context.Context, q ListQuery) (*Page[models.ArmingOverride], error) {
+	return armingOverrideListSpec.find(s.db.WithContext(ctx).Model(&models.ArmingOverride{}), q)
+}
+
+func (s *armingService) Apply(ctx context.Context, alert *models.Alert, at time.Time) (*models.SuppressedAlert, error) {
+	if !suppressibleAlertTypes[alert.Type] {
+		return nil, nil
+	}
+	var policy models.ArmingPolicy
+	if err := s.db.WithContext(ctx).First(&policy, "alert_type = ?", alert.Type).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if policy.Action != models.ArmingDowngrade && policy.Action != models.ArmingDiscard {
+		return nil, nil
+	}
+
+	overrides, schedules, err := s.loadArea(ctx, alert.PremiseID, alert.ZoneID, at)
+	if err != nil {
+		return nil, err
+	}
+	if evaluateArea(alert.PremiseID, alert.ZoneID, overrides, schedules, at).Armed {
+		return nil, nil
+	}
+
+	if policy.Action == models.ArmingDowngrade {
+		if severityRank(string(policy.Severity)) < severityRank(string(alert.Severity)) {
+			alert.DowngradedFrom = alert.Severity
+			alert.Severity = policy.Severity
+		}
+		return nil, nil
+	}
+	suppressed := models.SuppressedAlert{
+		Cause:       models.SuppressedByDisarmed,
+		Type:        alert.Type,
+		Severity:    alert.Severity,
+		Title:       alert.Title,
+		Description: alert.Description,
+		Location:    alert.Location,
+		PremiseID:   alert.PremiseID,
+		CameraID:    alert.CameraID,
+		ZoneID:      alert.ZoneID,
+		CreatedAt:   at,
+	}
+	if err := s.db.WithContext(ctx).Create(&suppressed).Error; err != nil {
+		return nil, err
+	}
+	return &suppressed, nil
+}
+
+// loadArea loads the overrides in effect and the schedules that may decide
+// the state of the premise and, given a zone, of that zone; with no zone the
+// overrides and schedules of every zone are loaded
+func (s *armingService) loadArea(ctx context.Context, premiseID uuid.UUID, zoneID *uuid.UUID, at time.Time) ([]models.ArmingOverride, []models.ArmingSchedule, error) {
+	var overrides []models.ArmingOverride
+	query := s.db.WithContext(ctx).
+		Where("premise_id = ? AND cleared_at IS NULL AND created_at <= ? AND (until IS NULL OR until > ?)", premiseID, at, at)
+	if zoneID != nil {
+		query = query.Where("zone_id IS NULL OR zone_id = ?", *zoneID)
+	}
+	if err := query.Order("created_at DESC").Find(&overrides).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var schedules []models.ArmingSchedule
+	query = s.db.WithContext(ctx).Preload("Periods").Preload("HolidayCalendar.Holidays").Where("premise_id = ?", premiseID)
+	if zoneID != nil {
+		query = query.Where("zone_id IS NULL OR zone_id = ?", *zoneID)
+	}
+	if err := query.Find(&schedules).Error; err != nil {
+		return nil, nil, err
+	}
+	return overrides, schedules, nil
+}
+
+// checkArea checks the premise exists and the zone, if any, is on one of its
+// floors
+func (s *armingService) checkArea(ctx context.Context, premiseID uuid.UUID, zoneID *uuid.UUID) error {
+	var found int64
+	if zoneID != nil {
+		if err := s.db.WithContext(ctx).Model(&models.Zone{}).
+			Joins("JOIN floor_plans ON floor_plans.id = zones.floor_plan_id").
+			Where("zones.id = ? AND floor_plans.premise_id = ?", *zoneID, premiseID).
+			Count(&found).Error; err != nil {
+			return err
+		}
+		if found == 0 {
+			return fmt.Errorf("%w: zone is not at the premise", ErrInvalidArming)
+		}
+		return nil
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Premise{}).Where("id = ?", premiseID).Count(&found).Error; err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("%w: unknown premise", ErrInvalidArming)
+	}
+	return nil
+}
+
+// evaluateArea decides whether the premise, or the zone, is armed at t. The
+// overrides are newest first. A zone's own override or schedule takes
+// precedence over the premise's; an area with neither is armed.
+func evaluateArea(premiseID uuid.UUID, zoneID *uuid.UUID, overrides []models.ArmingOverride, schedules []models.ArmingSchedule, t time.Time) AreaState {
+	state := AreaState{PremiseID: premiseID, ZoneID: zoneID, Armed: true, Source: ArmingSourceDefault}
+
+	var override *models.ArmingOverride
+	for i := range overrides {
+		o := &overrides[i]
+		if zoneID != nil && o.ZoneID != nil && *o.ZoneID == *zoneID {
+			override = o
+			break
+		}
+		if o.ZoneID == nil && override == nil {
+			override = o
+		}
+	}
+	if override != nil {
+		state.Armed, state.Source, state.Override = override.Armed, ArmingSourceOverride, override
+		return state
+	}
+
+	var schedule *models.ArmingSchedule
+	for i := range schedules {
+		sc := &schedules[i]
+		if zoneID != nil && sc.ZoneID != nil && *sc.ZoneID == *zoneID {
+			schedule = sc
+			break
+		}
+		if sc.ZoneID == nil {
+			schedule = sc
+		}
+	}
+	if schedule == nil {
+		return state
+	}
+	state.ScheduleID = &schedule.ID
+
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	if schedule.HolidayCalendar != nil {
+		today := local.Format(holidayLayout)
+		for _, holiday := range schedule.HolidayCalendar.Holidays {
+			if holiday.Date == today {
+				state.Source, state.Holiday = ArmingSourceHoliday, holiday.Name
+				if state.Holiday == "" {
+					state.Holiday = holiday.Date
+				}
+				return state
+			}
+		}
+	}
+
+	state.Source = ArmingSourceSchedule
+	for _, period := range schedule.Periods {
+		if periodCovers(period, local) {
+			state.Armed = false
+			break
+		}
+	}
+	return state
+}
+
+// periodCovers reports whether the period disarms at the local time t. A
+// period running past midnight covers the early hours of the day after each
+// of its weekdays.
+func periodCovers(period models.ArmingPeriod, t time.Time) bool {
+	disarm, err1 := time.Parse(armingTimeLayout, period.DisarmAt)
+	arm, err2 := time.Parse(armingTimeLayout, period.ArmAt)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	from := disarm.Hour()*60 + disarm.Minute()
+	to := arm.Hour()*60 + arm.Minute()
+	minute := t.Hour()*60 + t.Minute()
+
+	on := func(day time.Weekday) bool {
+		for _, name := range period.Weekdays {
+			if armingWeekdays[name] == day {
+				return true
+			}
+		}
+		return false
+	}
+	if from < to {
+		return on(t.Weekday()) && minute >= from && minute < to
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return (on(t.Weekday()) && minute >= from) || (on(yesterday) && minute < to)
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+func TestPeriodCovers(t *testing.T) {
+	office := models.ArmingPeriod{Weekdays: pq.StringArray{"mon", "tue", "wed", "thu", "fri"}, DisarmAt: "08:00", ArmAt: "18:00"}
+	// Saturday night, running into Sunday morning
+	party := models.ArmingPeriod{Weekdays: pq.StringArray{"sat"}, DisarmAt: "22:00", ArmAt: "02:30"}
+
+	for _, tt := range []struct {
+		name   string
+		period models.ArmingPeriod
+		at     string
+		covers bool
+	}{
+		{"Monday morning", office, "2026-03-02T08:00:00Z", true},
+		{"Monday before opening", office, "2026-03-02T07:59:00Z", false},
+		{"Monday at closing", office, "2026-03-02T18:00:00Z", false},
+		{"Saturday during office hours", office, "2026-03-07T10:00:00Z", false},
+		{"Saturday night", party, "2026-03-07T23:00:00Z", true},
+		{"Saturday before the party", party, "2026-03-07T21:59:00Z", false},
+		{"early Sunday", party, "2026-03-08T02:29:00Z", true},
+		{"Sunday at arming", party, "2026-03-08T02:30:00Z", false},
+		{"early Saturday", party, "2026-03-07T01:00:00Z", false},
+		{"unreadable times", models.ArmingPeriod{Weekdays: pq.StringArray{"mon"}, DisarmAt: "8am", ArmAt: "18:00"}, "2026-03-02T10:00:00Z", false},
+	} {
+		if got := periodCovers(tt.period, testTime(t, tt.at)); got != tt.covers {
+			t.Errorf("%s: periodCovers at %s = %v, want %v", tt.name, tt.at, got, tt.covers)
+		}
+	}
+}
+
+func TestEvaluateArea(t *testing.T) {
+	premise, zone, otherZone := uuid.New(), uuid.New(), uuid.New()
+	weekdays := []models.ArmingPeriod{{Weekdays: pq.StringArray{"mon", "tue", "wed", "thu", "fri"}, DisarmAt: "08:00", ArmAt: "18:00"}}
+	premiseSchedule := models.ArmingSchedule{
+		ID:        uuid.New(),
+		PremiseID: premise,
+		Timezone:  "Europe/Berlin",
+		Periods:   weekdays,
+		HolidayCalendar: &models.HolidayCalendar{Holidays: []models.Holiday{
+			{Date: "2026-04-06", Name: "Easter Monday"},
+			{Date: "2026-05-01"},
+		}},
+	}
+	zoneSchedule := models.ArmingSchedule{ID: uuid.New(), PremiseID: premise, ZoneID: &zone, Timezone: "UTC"}
+	premiseOverride := models.ArmingOverride{ID: uuid.New(), PremiseID: premise, Armed: true}
+	zoneOverride := models.ArmingOverride{ID: uuid.New(), PremiseID: premise, ZoneID: &zone, Armed: false}
+	otherOverride := models.ArmingOverride{ID: uuid.New(), PremiseID: premise, ZoneID: &otherZone, Armed: true}
+
+	monday := testTime(t, "2026-03-02T09:00:00Z") // 10:00 in Berlin
+	for _, tt := range []struct {
+		name      string
+		zoneID    *uuid.UUID
+		overrides []models.ArmingOverride
+		schedules []models.ArmingSchedule
+		at        string
+		armed     bool
+		source    string
+	}{
+		{"nothing set", nil, nil, nil, "2026-03-02T09:00:00Z", true, ArmingSourceDefault},
+		{"office hours", nil, nil, []models.ArmingSchedule{premiseSchedule}, "2026-03-02T09:00:00Z", false, ArmingSourceSchedule},
+		{"weekend", nil, nil, []models.ArmingSchedule{premiseSchedule}, "2026-03-08T09:00:00Z", true, ArmingSourceSchedule},
+		{"office hours on a holiday", nil, nil, []models.ArmingSchedule{premiseSchedule}, "2026-04-06T09:00:00Z", true, ArmingSourceHoliday},
+		{"premise override over the schedule", nil, []models.ArmingOverride{premiseOverride}, []models.ArmingSchedule{premiseSchedule}, "2026-03-02T09:00:00Z", true, ArmingSourceOverride},
+		{"zone follows its premise", &zone, nil, []models.ArmingSchedule{premiseSchedule}, "2026-03-02T09:00:00Z", false, ArmingSourceSchedule},
+		{"zone schedule over the premise's", &zone, nil, []models.ArmingSchedule{zoneSchedule, premiseSchedule}, "2026-03-02T09:00:00Z", true, ArmingSourceSchedule},
+		{"zone override over a newer premise override", &zone, []models.ArmingOverride{premiseOverride, zoneOverride}, nil, "2026-03-02T09:00:00Z", false, ArmingSourceOverride},
+		{"another zone's override", &zone, []models.ArmingOverride{otherOverride}, []models.ArmingSchedule{premiseSchedule}, "2026-03-02T09:00:00Z", false, ArmingSourceSchedule},
+	} {
+		state := evaluateArea(premise, tt.zoneID, tt.overrides, tt.schedules, testTime(t, tt.at))
+		if state.Armed != tt.armed || state.Source != tt.source {
+			t.Errorf("%s: armed %v from %s, want %v from %s", tt.name, state.Armed, state.Source, tt.armed, tt.source)
+		}
+	}
+
+	state := evaluateArea(premise, nil, nil, []models.ArmingSchedule{premiseSchedule}, testTime(t, "2026-05-01T09:00:00Z"))
+	if state.Holiday != "2026-05-01" || state.ScheduleID == nil || *state.ScheduleID != premiseSchedule.ID {
+		t.Errorf("holiday state = %+v, want the date for an unnamed holiday", state)
+	}
+	state = evaluateArea(premise, &zone, []models.ArmingOverride{zoneOverride}, nil, monday)
+	if state.Override == nil || state.Override.ID != zoneOverride.ID || state.ZoneID != &zone {
+		t.Errorf("override state = %+v", state)
+	}
+}
+
+func TestApplyCalendarInput(t *testing.T) {
+	var calendar models.HolidayCalendar
+	if err := applyCalendarInput(&calendar, HolidayCalendarInput{Name: " Berlin ", Holidays: []HolidayInput{{Date: "2026-10-03", Name: " Unity Day "}}}); err != nil {
+		t.Fatalf("applyCalendarInput: %v", err)
+	}
+	if calendar.Name != "Berlin" || len(calendar.Holidays) != 1 || calendar.Holidays[0].Name != "Unity Day" {
+		t.Errorf("calendar = %+v", calendar)
+	}
+	for _, input := range []HolidayCalendarInput{
+		{Name: ""},
+		{Name: "Berlin", Holidays: []HolidayInput{{Date: "03.10.2026"}}},
+		{Name: "Berlin", Holidays: []HolidayInput{{Date: "2026-10-03"}, {Date: "2026-10-03"}}},
+	} {
+		if err := applyCalendarInput(&models.HolidayCalendar{}, input); !errors.Is(err, ErrInvalidArming) {
+			t.Errorf("applyCalendarInput(%+v) = %v, want ErrInvalidArming", input, err)
+		}
+	}
+}
+
+func TestScheduleAreaTaken(t *testing.T) {
+	other := errors.New("connection reset")
+	for _, tt := range []struct {
+		name    string
+		err     error
+		invalid bool
+	}{
+		{"unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"wrapped unique violation", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), true},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, false},
+		{"other error", other, false},
+	} {
+		err := scheduleAreaTaken(tt.err)
+		if got := errors.Is(err, ErrInvalidArming); got != tt.invalid {
+			t.Errorf("%s: invalid = %v, want %v", tt.name, got, tt.invalid)
+		}
+		if !tt.invalid && err != tt.err {
+			t.Errorf("%s: err = %v, want it unchanged", tt.name, err)
+		}
+	}
+}
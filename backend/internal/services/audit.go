@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"smart-city-surveillance/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// AuditService records and lists audit log entries
+type AuditService interface {
+	Record(ctx context.Context, entry models.AuditLog)
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error)
+}
+
+// AuditFilter contains optional filter parameters for listing audit entries
+type AuditFilter struct {
+	ActorID      string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Limit        int
+}
+
+type auditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) AuditService {
+	return &auditService{db: db}
+}
+
+// Record stores an audit entry; failures are logged and never block the caller
+func (s *auditService) Record(ctx context.Context, entry models.AuditLog) {
+	if err := s.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit entry %s on %s/%s: %v", entry.Action, entry.ResourceType, entry.ResourceID, err)
+	}
+}
+
+func (s *auditService) List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{})
+
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+
+	if err := query.Order("created_at DESC").Limit(filter.Limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// recordAction audits a user action, including failed and denied attempts
+func recordAction(ctx context.Context, audit AuditService, action, resourceType, resourceID, userID string, userRole models.UserRole, err error, details models.JSONMap) {
+	if audit == nil {
+		return
+	}
+	if err != nil {
+		if details == nil {
+			details = models.JSONMap{}
+		}
+		details["error"] = err.Error()
+	}
+	audit.Record(ctx, models.AuditLog{
+		ActorID:      userID,
+		ActorRole:    userRole,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Success:      err == nil,
+		Details:      details,
+	})
+}
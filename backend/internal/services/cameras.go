@@ -5,34 +5,71 @@ import (
 	"errors"
 
 	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type CameraService interface {
-	GetAll(ctx context.Context, userRole models.UserRole) ([]models.Camera, error)
+	GetAll(ctx context.Context, q ListQuery, userRole models.UserRole) (*Page[models.Camera], error)
 	GetByID(ctx context.Context, id string,  userId string, userRole models.UserRole) (*models.Camera, error)
 	GetByPremiseID(ctx context.Context, premiseID string, userRole models.UserRole) ([]models.Camera, error)
 	GetAssignedByGuardID(ctx context.Context, guardID string) ([]models.Camera, error)
-	UpdateStatus(ctx context.Context, id string, status models.CameraStatus, userRole models.UserRole) error
+	UpdateStatus(ctx context.Context, id string, status models.CameraStatus, maintenance CameraMaintenance, userRole models.UserRole, userID string) error
+	UpdateCapabilities(ctx context.Context, id string, caps CameraCapabilities, userRole models.UserRole) (*models.Camera, error)
+}
+
+// CameraCapabilities describes what a camera supports and how to control it
+type CameraCapabilities struct {
+	PTZSupported     bool
+	PresetsSupported bool
+	AudioSupported   bool
+	ONVIFAddress     string
+	ONVIFProfile     string
+	ONVIFUsername    string
+	ONVIFPassword    string
+}
+
+var cameraListSpec = &listSpec[models.Camera]{
+	table: "cameras",
+	id:    func(c *models.Camera) uuid.UUID { return c.ID },
+	sorts: map[string]listColumn[models.Camera]{
+		"created_at": {expr: "cameras.created_at", kind: cursorTime, value: func(c *models.Camera) any { return c.CreatedAt }},
+		"updated_at": {expr: "cameras.updated_at", kind: cursorTime, value: func(c *models.Camera) any { return c.UpdatedAt }},
+		"name":       {expr: "cameras.name", kind: cursorString, value: func(c *models.Camera) any { return c.Name }},
+		"status":     {expr: "cameras.status", kind: cursorString, value: func(c *models.Camera) any { return string(c.Status) }},
+	},
+	defaultSort: []SortField{{Field: "name"}},
+	filters: map[string]listFilter{
+		"status":        {clause: "cameras.status IN ?"},
+		"premise_id":    {clause: "cameras.premise_id IN ?", kind: filterUUID},
+		"zone_id":       {clause: "cameras.zone_id IN ?", kind: filterUUID},
+		"floor_plan_id": {clause: "cameras.floor_plan_id IN ?", kind: filterUUID},
+		"ptz_supported": {clause: "cameras.ptz_supported IN ?", kind: filterBool},
+	},
+	relations: map[string]listRelation{
+		"premise": {preload: "Premise"},
+		"guards":  {preload: "Guards"},
+	},
 }
 
 type cameraService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	mapDiff     *mapPublisher
+	maintenance MaintenanceService
 }
 
-func NewCameraService(db *gorm.DB) CameraService {
-	return &cameraService{db: db}
+func NewCameraService(db *gorm.DB, wsHub *websocket.Hub, maintenance MaintenanceService) CameraService {
+	return &cameraService{db: db, mapDiff: newMapPublisher(db, wsHub), maintenance: maintenance}
 }
 
 // GetAll returns all cameras; only SCS Operator can access all cameras.
-func (s *cameraService) GetAll(ctx context.Context, userRole models.UserRole) ([]models.Camera, error) {
+func (s *cameraService) GetAll(ctx context.Context, q ListQuery, userRole models.UserRole) (*Page[models.Camera], error) {
 	if userRole != models.RoleSCSOperator {
 		return nil, errors.New("permission denied")
 	}
-	var cameras []models.Camera
-	err := s.db.WithContext(ctx).Preload("Premise").Preload("Guards").Find(&cameras).Error
-	return cameras, err
+	return cameraListSpec.find(s.db.WithContext(ctx).Model(&models.Camera{}), q)
 }
 
 // GetByID returns camera details by ID; SCS Operator can access all; Security Guard can access assigned cameras only.
@@ -78,10 +115,50 @@ func (s *cameraService) GetAssignedByGuardID(ctx context.Context, guardID string
 	return cameras, err
 }
 
-// UpdateStatus updates camera status; only SCS Operator can update status
-func (s *cameraService) UpdateStatus(ctx context.Context, id string, status models.CameraStatus, userRole models.UserRole) error {
+// UpdateStatus updates camera status; only SCS Operator can update status.
+// Putting a camera into maintenance can open a maintenance window for it,
+// which ends when the camera is given another status.
+func (s *cameraService) UpdateStatus(ctx context.Context, id string, status models.CameraStatus, maintenance CameraMaintenance, userRole models.UserRole, userID string) error {
 	if userRole != models.RoleSCSOperator {
 		return errors.New("permission denied")
 	}
-	return s.db.WithContext(ctx).Model(&models.Camera{}).Where("id = ?", id).Update("status", status).Error
+	if err := s.db.WithContext(ctx).Model(&models.Camera{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+		return err
+	}
+
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).Preload("Premise").First(&camera, "id = ?", id).Error; err == nil {
+		s.mapDiff.camera(&camera)
+		if err := s.maintenance.CameraStatusChanged(ctx, &camera, maintenance, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateCapabilities updates camera capability metadata; only SCS Operator can update
+func (s *cameraService) UpdateCapabilities(ctx context.Context, id string, caps CameraCapabilities, userRole models.UserRole) (*models.Camera, error) {
+	if userRole != models.RoleSCSOperator {
+		return nil, errors.New("permission denied")
+	}
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).First(&camera, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	camera.PTZSupported = caps.PTZSupported
+	camera.PresetsSupported = caps.PresetsSupported
+	camera.AudioSupported = caps.AudioSupported
+	camera.ONVIFAddress = caps.ONVIFAddress
+	camera.ONVIFProfile = caps.ONVIFProfile
+	camera.ONVIFUsername = caps.ONVIFUsername
+	// Keep the stored password unless a new one is provided
+	if caps.ONVIFPassword != "" {
+		camera.ONVIFPassword = caps.ONVIFPassword
+	}
+
+	if err := s.db.WithContext(ctx).Save(&camera).Error; err != nil {
+		return nil, err
+	}
+	return &camera, nil
 }
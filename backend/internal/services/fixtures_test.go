@@ -0,0 +1,89 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createTestRow inserts the row and deletes it after the test. Cleanups run
+// in reverse, so a row goes before the rows created ahead of it that it
+// refers to.
+func createTestRow[T any](t *testing.T, db *gorm.DB, row *T) *T {
+	t.Helper()
+	if err := db.Create(row).Error; err != nil {
+		t.Fatalf("create %T: %v", row, err)
+	}
+	t.Cleanup(func() { db.Delete(row) })
+	return row
+}
+
+// cleanupTestRows deletes the rows of model matching the query after the
+// test, ahead of the rows created so far. It covers rows that the code
+// under test creates.
+func cleanupTestRows(t *testing.T, db *gorm.DB, model any, query string, args ...any) {
+	t.Cleanup(func() { db.Where(query, args...).Delete(model) })
+}
+
+// createTestCamera adds a camera on a premise of its own; configure adjusts
+// the camera before it is saved
+func createTestCamera(t *testing.T, db *gorm.DB, configure ...func(*models.Camera)) *models.Camera {
+	t.Helper()
+	premise := createTestRow(t, db, &models.Premise{Name: "Test " + t.Name(), Address: "1 Test Street", Type: models.PremiseTypeOffice})
+	camera := &models.Camera{Name: "Camera " + t.Name(), Location: "Gate", StreamURL: "rtsp://test/stream", PremiseID: premise.ID}
+	for _, fn := range configure {
+		fn(camera)
+	}
+	return createTestRow(t, db, camera)
+}
+
+// createTestUser adds an operator reachable by email and SMS, with one push
+// device, and removes them and their deliveries after the test
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+	suffix := uuid.NewString()[:8]
+	user := createTestRow(t, db, &models.User{
+		Username:  "test-" + suffix,
+		Email:     "test-" + suffix + "@example.com",
+		Password:  "-",
+		Role:      models.RoleSCSOperator,
+		FirstName: "Test",
+		LastName:  suffix,
+		Phone:     "+1555" + suffix,
+		IsActive:  true,
+	})
+	createTestRow(t, db, &models.DeviceToken{UserID: user.ID, Platform: models.DevicePlatformAndroid, Token: "token-" + suffix, LastSeenAt: time.Now()})
+	cleanupTestRows(t, db, &models.NotificationDelivery{}, "user_id = ?", user.ID)
+	return user
+}
+
+// testClock is a clock that only moves when told to
+type testClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// useTestClock makes the queue run on a test clock set to now, to the
+// microsecond as Postgres keeps it
+func useTestClock(q *retryQueue) *testClock {
+	clock := &testClock{now: time.Now().Truncate(time.Microsecond)}
+	q.now = clock.Now
+	return clock
+}
+
+func (c *testClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxFloorImageBytes = 20 << 20
+
+var (
+	ErrInvalidPolygon    = errors.New("polygon needs at least 3 points within [0,1]")
+	ErrInvalidPosition   = errors.New("position must be within [0,1]")
+	ErrInvalidFloorImage = errors.New("floor plan must be a PNG, JPEG or GIF image")
+	ErrFloorMismatch     = errors.New("floor plan belongs to a different premise")
+)
+
+// activeAlertStatuses are the alert statuses shown on live overlays
+var activeAlertStatuses = []models.AlertStatus{
+	models.AlertStatusPending,
+	models.AlertStatusAcknowledged,
+	models.AlertStatusAssigned,
+}
+
+// FloorOverlay is a floor with its zones, cameras and currently active alerts
+type FloorOverlay struct {
+	Floor        *models.FloorPlan `json:"floor"`
+	ActiveAlerts []models.Alert    `json:"active_alerts"`
+}
+
+// CameraPosition places a camera on a floor plan
+type CameraPosition struct {
+	FloorPlanID uuid.UUID
+	X           float64
+	Y           float64
+	Heading     *float64
+	FieldOfView *float64
+}
+
+// FloorPlansService manages premise floors, zones and camera placement
+type FloorPlansService interface {
+	GetFloors(ctx context.Context, premiseID uuid.UUID) ([]models.FloorPlan, error)
+	CreateFloor(ctx context.Context, premiseID uuid.UUID, name string, level int, image io.Reader) (*models.FloorPlan, error)
+	DeleteFloor(ctx context.Context, id uuid.UUID) error
+	GetFloorOverlay(ctx context.Context, id uuid.UUID) (*FloorOverlay, error)
+	CreateZone(ctx context.Context, floorID uuid.UUID, name string, polygon models.Polygon) (*models.Zone, error)
+	UpdateZone(ctx context.Context, id uuid.UUID, name string, polygon models.Polygon) (*models.Zone, error)
+	DeleteZone(ctx context.Context, id uuid.UUID) error
+	PositionCamera(ctx context.Context, cameraID uuid.UUID, position CameraPosition) (*models.Camera, error)
+}
+
+type floorPlansService struct {
+	db     *gorm.DB
+	store  storage.Storage
+	urlTTL time.Duration
+}
+
+func NewFloorPlansService(db *gorm.DB, store storage.Storage, urlTTL time.Duration) FloorPlansService {
+	return &floorPlansService{db: db, store: store, urlTTL: urlTTL}
+}
+
+func (s *floorPlansService) GetFloors(ctx context.Context, premiseID uuid.UUID) ([]models.FloorPlan, error) {
+	var floors []models.FloorPlan
+	if err := s.db.WithContext(ctx).
+		Where("premise_id = ?", premiseID).
+		Preload("Zones").
+		Order("level ASC").
+		Find(&floors).Error; err != nil {
+		return nil, err
+	}
+	for i := range floors {
+		s.signImage(&floors[i])
+	}
+	return floors, nil
+}
+
+// CreateFloor stores the uploaded plan image and creates the floor
+func (s *floorPlansService) CreateFloor(ctx context.Context, premiseID uuid.UUID, name string, level int, r io.Reader) (*models.FloorPlan, error) {
+	if err := s.db.WithContext(ctx).First(&models.Premise{}, "id = ?", premiseID).Error; err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxFloorImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFloorImageBytes {
+		return nil, fmt.Errorf("%w: image exceeds %d bytes", ErrInvalidFloorImage, maxFloorImageBytes)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidFloorImage
+	}
+
+	floor := models.FloorPlan{
+		ID:        uuid.New(),
+		PremiseID: premiseID,
+		Name:      name,
+		Level:     level,
+		Width:     cfg.Width,
+		Height:    cfg.Height,
+	}
+	floor.ImageKey = fmt.Sprintf("floorplans/%s/%s.%s", premiseID, floor.ID, format)
+	if err := s.store.Put(ctx, floor.ImageKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store floor plan image: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Create(&floor).Error; err != nil {
+		s.store.Delete(ctx, floor.ImageKey)
+		return nil, err
+	}
+	s.signImage(&floor)
+	return &floor, nil
+}
+
+// DeleteFloor removes a floor, its zones and the placement of its cameras
+func (s *floorPlansService) DeleteFloor(ctx context.Context, id uuid.UUID) error {
+	var floor models.FloorPlan
+	if err := s.db.WithContext(ctx).First(&floor, "id = ?", id).Error; err != nil {
+		return err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		zoneIDs := tx.Model(&models.Zone{}).Select("id").Where("floor_plan_id = ?", id)
+		if err := detachZones(tx, zoneIDs); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Camera{}).Where("floor_plan_id = ?", id).Updates(map[string]any{
+			"floor_plan_id": nil,
+			"position_x":    nil,
+			"position_y":    nil,
+			"heading":       nil,
+			"field_of_view": nil,
+			"zone_id":       nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("floor_plan_id = ?", id).Delete(&models.Zone{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&floor).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if floor.ImageKey != "" {
+		if err := s.store.Delete(ctx, floor.ImageKey); err != nil {
+			log.Printf("Failed to delete floor plan image %s: %v", floor.ImageKey, err)
+		}
+	}
+	return nil
+}
+
+// GetFloorOverlay returns the floor with live camera statuses and active alerts
+func (s *floorPlansService) GetFloorOverlay(ctx context.Context, id uuid.UUID) (*FloorOverlay, error) {
+	var floor models.FloorPlan
+	if err := s.db.WithContext(ctx).
+		Preload("Zones").
+		Preload("Cameras").
+		First(&floor, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	s.signImage(&floor)
+
+	var alerts []models.Alert
+	if err := s.db.WithContext(ctx).
+		Preload("Camera").
+		Preload("Zone").
+		Where("status IN ?", activeAlertStatuses).
+		Where("camera_id IN (?) OR zone_id IN (?)",
+			s.db.Model(&models.Camera{}).Select("id").Where("floor_plan_id = ?", id),
+			s.db.Model(&models.Zone{}).Select("id").Where("floor_plan_id = ?", id)).
+		Order("created_at DESC").
+		Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+
+	return &FloorOverlay{Floor: &floor, ActiveAlerts: alerts}, nil
+}
+
+func (s *floorPlansService) CreateZone(ctx context.Context, floorID uuid.UUID, name string, polygon models.Polygon) (*models.Zone, error) {
+	if !validPolygon(polygon) {
+		return nil, ErrInvalidPolygon
+	}
+	if err := s.db.WithContext(ctx).First(&models.FloorPlan{}, "id = ?", floorID).Error; err != nil {
+		return nil, err
+	}
+
+	zone := models.Zone{FloorPlanID: floorID, Name: name, Polygon: polygon}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&zone).Error; err != nil {
+			return err
+		}
+		return assignCameraZones(tx, floorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (s *floorPlansService) UpdateZone(ctx context.Context, id uuid.UUID, name string, polygon models.Polygon) (*models.Zone, error) {
+	if !validPolygon(polygon) {
+		return nil, ErrInvalidPolygon
+	}
+	var zone models.Zone
+	if err := s.db.WithContext(ctx).First(&zone, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	zone.Name = name
+	zone.Polygon = polygon
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&zone).Error; err != nil {
+			return err
+		}
+		return assignCameraZones(tx, zone.FloorPlanID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (s *floorPlansService) DeleteZone(ctx context.Context, id uuid.UUID) error {
+	var zone models.Zone
+	if err := s.db.WithContext(ctx).First(&zone, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := detachZones(tx, []uuid.UUID{id}); err != nil {
+			return err
+		}
+		if err := tx.Delete(&zone).Error; err != nil {
+			return err
+		}
+		return assignCameraZones(tx, zone.FloorPlanID)
+	})
+}
+
+// detachZones drops the references to zones about to be deleted: alerts and
+// suppressed alerts keep their premise, while the zones' arming schedules and
+// overrides go with them. zoneIDs is a subquery or a slice of ids
+func detachZones(tx *gorm.DB, zoneIDs any) error {
+	if err := tx.Model(&models.Alert{}).Where("zone_id IN (?)", zoneIDs).Update("zone_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.SuppressedAlert{}).Where("zone_id IN (?)", zoneIDs).Update("zone_id", nil).Error; err != nil {
+		return err
+	}
+	scheduleIDs := tx.Model(&models.ArmingSchedule{}).Select("id").Where("zone_id IN (?)", zoneIDs)
+	if err := tx.Where("schedule_id IN (?)", scheduleIDs).Delete(&models.ArmingPeriod{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("zone_id IN (?)", zoneIDs).Delete(&models.ArmingSchedule{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("zone_id IN (?)", zoneIDs).Delete(&models.ArmingOverride{}).Error
+}
+
+// PositionCamera places a camera on a floor; its zone follows from the position
+func (s *floorPlansService) PositionCamera(ctx context.Context, cameraID uuid.UUID, position CameraPosition) (*models.Camera, error) {
+	if position.X < 0 || position.X > 1 || position.Y < 0 || position.Y > 1 {
+		return nil, ErrInvalidPosition
+	}
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).First(&camera, "id = ?", cameraID).Error; err != nil {
+		return nil, err
+	}
+	var floor models.FloorPlan
+	if err := s.db.WithContext(ctx).Preload("Zones").First(&floor, "id = ?", position.FloorPlanID).Error; err != nil {
+		return nil, err
+	}
+	if floor.PremiseID != camera.PremiseID {
+		return nil, ErrFloorMismatch
+	}
+
+	camera.FloorPlanID = &floor.ID
+	camera.PositionX = &position.X
+	camera.PositionY = &position.Y
+	camera.Heading = position.Heading
+	camera.FieldOfView = position.FieldOfView
+	camera.ZoneID = zoneAt(floor.Zones, models.Point{X: position.X, Y: position.Y})
+
+	if err := s.db.WithContext(ctx).Save(&camera).Error; err != nil {
+		return nil, err
+	}
+	return &camera, nil
+}
+
+func (s *floorPlansService) signImage(floor *models.FloorPlan) {
+	if floor.ImageKey != "" {
+		floor.ImageURL = s.store.SignedURL(floor.ImageKey, s.urlTTL)
+	}
+}
+
+// assignCameraZones recomputes the zone of every camera placed on a floor
+func assignCameraZones(tx *gorm.DB, floorID uuid.UUID) error {
+	var zones []models.Zone
+	if err := tx.Where("floor_plan_id = ?", floorID).Find(&zones).Error; err != nil {
+		return err
+	}
+	var cameras []models.Camera
+	if err := tx.Where("floor_plan_id = ?", floorID).Find(&cameras).Error; err != nil {
+		return err
+	}
+	for _, camera := range cameras {
+		if camera.PositionX == nil || camera.PositionY == nil {
+			continue
+		}
+		zoneID := zoneAt(zones, models.Point{X: *camera.PositionX, Y: *camera.PositionY})
+		if err := tx.Model(&models.Camera{}).Where("id = ?", camera.ID).Update("zone_id", zoneID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zoneAt returns the first zone containing pt
+func zoneAt(zones []models.Zone, pt models.Point) *uuid.UUID {
+	for _, z := range zones {
+		if z.Polygon.Contains(pt) {
+			id := z.ID
+			return &id
+		}
+	}
+	return nil
+}
+
+func validPolygon(p models.Polygon) bool {
+	if len(p) < 3 {
+		return false
+	}
+	for _, pt := range p {
+		if pt.X < 0 || pt.X > 1 || pt.Y < 0 || pt.Y > 1 {
+			return false
+		}
+	}
+	return true
+}
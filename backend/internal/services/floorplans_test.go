@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestZoneAt(t *testing.T) {
+	// An L-shaped lobby wrapping a square office, listed first
+	office := models.Zone{ID: uuid.New(), Polygon: models.Polygon{{X: 0.5, Y: 0.5}, {X: 1, Y: 0.5}, {X: 1, Y: 1}, {X: 0.5, Y: 1}}}
+	lobby := models.Zone{ID: uuid.New(), Polygon: models.Polygon{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 0.5}, {X: 0.5, Y: 0.5}, {X: 0.5, Y: 1}, {X: 0, Y: 1}}}
+	zones := []models.Zone{office, lobby}
+
+	for _, tt := range []struct {
+		name string
+		pt   models.Point
+		want *uuid.UUID
+	}{
+		{"office", models.Point{X: 0.75, Y: 0.75}, &office.ID},
+		{"lobby corridor", models.Point{X: 0.9, Y: 0.25}, &lobby.ID},
+		{"lobby wing", models.Point{X: 0.25, Y: 0.9}, &lobby.ID},
+		{"outside the plan", models.Point{X: 1.5, Y: 0.5}, nil},
+	} {
+		got := zoneAt(zones, tt.pt)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%s: zoneAt(%v) = %v, want %v", tt.name, tt.pt, got, tt.want)
+		}
+	}
+	if got := zoneAt(nil, models.Point{X: 0.5, Y: 0.5}); got != nil {
+		t.Errorf("zoneAt without zones = %v", got)
+	}
+}
+
+func TestValidPolygon(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		polygon models.Polygon
+		valid   bool
+	}{
+		{"triangle", models.Polygon{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}, true},
+		{"line", models.Polygon{{X: 0, Y: 0}, {X: 1, Y: 1}}, false},
+		{"empty", nil, false},
+		{"off the plan", models.Polygon{{X: 0, Y: 0}, {X: 1.2, Y: 0}, {X: 0, Y: 1}}, false},
+		{"negative", models.Polygon{{X: 0, Y: -0.1}, {X: 1, Y: 0}, {X: 0, Y: 1}}, false},
+	} {
+		if got := validPolygon(tt.polygon); got != tt.valid {
+			t.Errorf("%s: validPolygon = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestDeleteZoneDetachesAlertsAndDropsArming(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	premise := createTestRow(t, db, &models.Premise{Name: "Test " + t.Name(), Address: "1 Test Street", Type: models.PremiseTypeOffice})
+	floor := createTestRow(t, db, &models.FloorPlan{PremiseID: premise.ID, Name: "Ground"})
+	square := models.Polygon{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}
+	zone := createTestRow(t, db, &models.Zone{FloorPlanID: floor.ID, Name: "Lobby", Polygon: square})
+	alert := createTestRow(t, db, &models.Alert{
+		Type: models.AlertTypeSuspiciousActivity, Severity: models.AlertSeverityLow, Title: "Loitering",
+		Description: "-", Location: "Lobby", PremiseID: premise.ID, ZoneID: &zone.ID,
+	})
+	suppressed := createTestRow(t, db, &models.SuppressedAlert{
+		Type: models.AlertTypeSuspiciousActivity, Severity: models.AlertSeverityLow, Title: "Loitering",
+		PremiseID: premise.ID, ZoneID: &zone.ID,
+	})
+	schedule := createTestRow(t, db, &models.ArmingSchedule{
+		Name: "Office hours", PremiseID: premise.ID, ZoneID: &zone.ID, Timezone: "UTC",
+		Periods: []models.ArmingPeriod{{Weekdays: pq.StringArray{"mon"}, DisarmAt: "08:00", ArmAt: "18:00"}},
+	})
+	createTestRow(t, db, &models.ArmingOverride{PremiseID: premise.ID, ZoneID: &zone.ID, Armed: true})
+
+	if err := NewFloorPlansService(db, nil, time.Minute).DeleteZone(ctx, zone.ID); err != nil {
+		t.Fatalf("DeleteZone: %v", err)
+	}
+
+	for _, row := range []struct {
+		name  string
+		model any
+		query string
+		arg   any
+		want  int64
+	}{
+		{"alerts kept", &models.Alert{}, "id = ? AND zone_id IS NULL", alert.ID, 1},
+		{"suppressed alerts kept", &models.SuppressedAlert{}, "id = ? AND zone_id IS NULL", suppressed.ID, 1},
+		{"schedules", &models.ArmingSchedule{}, "zone_id = ?", zone.ID, 0},
+		{"periods", &models.ArmingPeriod{}, "schedule_id = ?", schedule.ID, 0},
+		{"overrides", &models.ArmingOverride{}, "zone_id = ?", zone.ID, 0},
+	} {
+		var count int64
+		if err := db.Model(row.model).Where(row.query, row.arg).Count(&count).Error; err != nil {
+			t.Fatalf("%s: %v", row.name, err)
+		}
+		if count != row.want {
+			t.Errorf("%s: %d rows, want %d", row.name, count, row.want)
+		}
+	}
+}
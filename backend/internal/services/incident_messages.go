@@ -0,0 +1,456 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/storage"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxMessageBody          = 4000
+	maxMessageAttachments   = 5
+	maxAttachmentBytes      = 25 << 20
+	defaultMessagePageLimit = 50
+	maxMessagePageLimit     = 200
+)
+
+var (
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrEmptyMessage       = errors.New("message needs a body, a quick reply or an attachment")
+	ErrMessageTooLong     = fmt.Errorf("message body exceeds %d characters", maxMessageBody)
+	ErrInvalidAttachment  = errors.New("attachments must be images, video, audio or PDF")
+	ErrTooManyAttachments = fmt.Errorf("at most %d attachments per message", maxMessageAttachments)
+	ErrIncidentClosed     = errors.New("incident is closed")
+	ErrQuickReplyNotFound = errors.New("quick reply not found")
+)
+
+// IncidentMessagesService is the chat thread between operators and the
+// guards assigned to an incident
+type IncidentMessagesService interface {
+	ListMessages(ctx context.Context, incidentID string, before string, limit int, userRole models.UserRole, userID string) (*MessageThread, error)
+	SendMessage(ctx context.Context, incidentID string, msg NewIncidentMessage, userRole models.UserRole, userID string) (*models.IncidentMessage, error)
+	MarkRead(ctx context.Context, incidentID string, messageID string, userRole models.UserRole, userID string) (*models.IncidentReadReceipt, error)
+	UnreadCounts(ctx context.Context, userRole models.UserRole, userID string) ([]UnreadCount, error)
+	ListQuickReplies(ctx context.Context, userRole models.UserRole) ([]models.QuickReply, error)
+	CreateQuickReply(ctx context.Context, reply models.QuickReply) (*models.QuickReply, error)
+	DeleteQuickReply(ctx context.Context, id string) error
+}
+
+// NewIncidentMessage is a message to send. Attachments are read and stored
+// before the message is saved.
+type NewIncidentMessage struct {
+	Body         string
+	QuickReplyID string
+	Attachments  []AttachmentUpload
+}
+
+// AttachmentUpload is a file sent with a message
+type AttachmentUpload struct {
+	FileName string
+	Reader   io.Reader
+}
+
+// MessageThread is a page of messages, oldest first, with everyone's read
+// position and the caller's unread count
+type MessageThread struct {
+	Messages []models.IncidentMessage     `json:"messages"`
+	Receipts []models.IncidentReadReceipt `json:"receipts"`
+	Unread   int64                        `json:"unread"`
+	HasMore  bool                         `json:"has_more"`
+}
+
+// UnreadCount is the number of unread messages in one incident thread
+type UnreadCount struct {
+	IncidentID uuid.UUID `json:"incident_id"`
+	Unread     int64     `json:"unread"`
+}
+
+type incidentMessagesService struct {
+	db     *gorm.DB
+	wsHub  *websocket.Hub
+	store  storage.Storage
+	urlTTL time.Duration
+}
+
+func NewIncidentMessagesService(db *gorm.DB, wsHub *websocket.Hub, store storage.Storage, urlTTL time.Duration) IncidentMessagesService {
+	return &incidentMessagesService{db: db, wsHub: wsHub, store: store, urlTTL: urlTTL}
+}
+
+// requireIncidentAccess loads the incident if the user may take part in it:
+// operators always, guards when assigned
+func requireIncidentAccess(ctx context.Context, db *gorm.DB, incidentID string, userRole models.UserRole, userID string) (*models.Incident, error) {
+	id, err := uuid.Parse(incidentID)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var incident models.Incident
+	if err := db.WithContext(ctx).First(&incident, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if userRole == models.RoleSCSOperator {
+		return &incident, nil
+	}
+	var count int64
+	if err := db.WithContext(ctx).Table("incident_guards").
+		Where("incident_id = ? AND guard_id = ?", id, userID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrPermissionDenied
+	}
+	return &incident, nil
+}
+
+func (s *incidentMessagesService) ListMessages(ctx context.Context, incidentID string, before string, limit int, userRole models.UserRole, userID string) (*MessageThread, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultMessagePageLimit
+	}
+	if limit > maxMessagePageLimit {
+		limit = maxMessagePageLimit
+	}
+
+	query := s.db.WithContext(ctx).
+		Preload("Sender").Preload("Attachments").
+		Where("incident_id = ?", incident.ID)
+	if before != "" {
+		var cursor models.IncidentMessage
+		if err := s.db.WithContext(ctx).Select("id", "created_at").
+			First(&cursor, "id = ? AND incident_id = ?", before, incident.ID).Error; err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var messages []models.IncidentMessage
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	thread := &MessageThread{HasMore: len(messages) > limit}
+	if thread.HasMore {
+		messages = messages[:limit]
+	}
+	// Pages are fetched newest first and returned oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	for i := range messages {
+		s.signAttachments(&messages[i])
+	}
+	thread.Messages = messages
+
+	if err := s.db.WithContext(ctx).Preload("User").
+		Where("incident_id = ?", incident.ID).
+		Find(&thread.Receipts).Error; err != nil {
+		return nil, err
+	}
+	if thread.Unread, err = s.unread(ctx, incident.ID, userID); err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+func (s *incidentMessagesService) SendMessage(ctx context.Context, incidentID string, msg NewIncidentMessage, userRole models.UserRole, userID string) (*models.IncidentMessage, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	if incident.Status == models.IncidentStatusClosed {
+		return nil, ErrIncidentClosed
+	}
+	// The thread is part of the signed-off report
+	if err := requireReportDraft(ctx, s.db, incident.ID); err != nil {
+		return nil, err
+	}
+	senderID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrPermissionDenied
+	}
+
+	message := models.IncidentMessage{
+		ID:         uuid.New(),
+		IncidentID: incident.ID,
+		SenderID:   senderID,
+		Kind:       models.MessageKindText,
+		Body:       strings.TrimSpace(msg.Body),
+	}
+	if msg.QuickReplyID != "" {
+		reply, err := s.quickReply(ctx, msg.QuickReplyID, userRole)
+		if err != nil {
+			return nil, err
+		}
+		message.Kind = models.MessageKindQuickReply
+		message.Body = reply.Text
+		message.QuickReplyID = &reply.ID
+	}
+	if len([]rune(message.Body)) > maxMessageBody {
+		return nil, ErrMessageTooLong
+	}
+	if message.Body == "" && len(msg.Attachments) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	if len(msg.Attachments) > maxMessageAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	// Store files first; they are removed again if the message can't be saved
+	for _, upload := range msg.Attachments {
+		attachment, err := s.storeAttachment(ctx, message.ID, upload)
+		if err != nil {
+			s.deleteAttachments(ctx, message.Attachments)
+			return nil, err
+		}
+		message.Attachments = append(message.Attachments, *attachment)
+	}
+	if err := s.db.WithContext(ctx).Create(&message).Error; err != nil {
+		s.deleteAttachments(ctx, message.Attachments)
+		return nil, err
+	}
+
+	// The sender has read their own message
+	if _, err := s.markRead(ctx, &message, senderID); err != nil {
+		log.Printf("Failed to update read receipt for user %s: %v", userID, err)
+	}
+
+	if err := s.db.WithContext(ctx).First(&message.Sender, "id = ?", senderID).Error; err != nil {
+		return nil, err
+	}
+	s.signAttachments(&message)
+	// The thread is private to the incident: premise and camera topics
+	// reach people who are not on it
+	s.wsHub.Publish([]string{IncidentTopic(incident.ID)}, "incident_message", message)
+	return &message, nil
+}
+
+func (s *incidentMessagesService) MarkRead(ctx context.Context, incidentID string, messageID string, userRole models.UserRole, userID string) (*models.IncidentReadReceipt, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	readerID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrPermissionDenied
+	}
+	var message models.IncidentMessage
+	if err := s.db.WithContext(ctx).First(&message, "id = ? AND incident_id = ?", messageID, incident.ID).Error; err != nil {
+		return nil, err
+	}
+
+	receipt, err := s.markRead(ctx, &message, readerID)
+	if err != nil {
+		return nil, err
+	}
+	s.wsHub.Publish([]string{IncidentTopic(incident.ID)}, "incident_message_read", receipt)
+	return receipt, nil
+}
+
+// markRead moves the user's read position forward to message; reading an
+// older message leaves it where it is
+func (s *incidentMessagesService) markRead(ctx context.Context, message *models.IncidentMessage, userID uuid.UUID) (*models.IncidentReadReceipt, error) {
+	receipt := models.IncidentReadReceipt{
+		IncidentID:        message.IncidentID,
+		UserID:            userID,
+		LastReadMessageID: message.ID,
+		LastReadAt:        message.CreatedAt,
+		ReadAt:            time.Now(),
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "incident_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_at", "read_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "incident_read_receipts.last_read_at < excluded.last_read_at"},
+		}},
+	}).Omit(clause.Associations).Create(&receipt).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).
+		First(&receipt, "incident_id = ? AND user_id = ?", message.IncidentID, userID).Error; err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (s *incidentMessagesService) unread(ctx context.Context, incidentID uuid.UUID, userID string) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.IncidentMessage{}).
+		Joins("LEFT JOIN incident_read_receipts r ON r.incident_id = incident_messages.incident_id AND r.user_id = ?", userID).
+		Where("incident_messages.incident_id = ? AND incident_messages.sender_id <> ?", incidentID, userID).
+		Where("r.last_read_at IS NULL OR incident_messages.created_at > r.last_read_at").
+		Count(&count).Error
+	return count, err
+}
+
+func (s *incidentMessagesService) UnreadCounts(ctx context.Context, userRole models.UserRole, userID string) ([]UnreadCount, error) {
+	query := s.db.WithContext(ctx).Model(&models.IncidentMessage{}).
+		Select("incident_messages.incident_id, COUNT(*) AS unread").
+		Joins("LEFT JOIN incident_read_receipts r ON r.incident_id = incident_messages.incident_id AND r.user_id = ?", userID).
+		Where("incident_messages.sender_id <> ?", userID).
+		Where("r.last_read_at IS NULL OR incident_messages.created_at > r.last_read_at")
+	if userRole != models.RoleSCSOperator {
+		query = query.Where("incident_messages.incident_id IN (?)",
+			s.db.Table("incident_guards").Select("incident_id").Where("guard_id = ?", userID))
+	}
+
+	counts := []UnreadCount{}
+	if err := query.Group("incident_messages.incident_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (s *incidentMessagesService) ListQuickReplies(ctx context.Context, userRole models.UserRole) ([]models.QuickReply, error) {
+	var replies []models.QuickReply
+	err := s.db.WithContext(ctx).
+		Where("role = '' OR role IS NULL OR role = ?", userRole).
+		Order("sort_order, text").
+		Find(&replies).Error
+	return replies, err
+}
+
+func (s *incidentMessagesService) CreateQuickReply(ctx context.Context, reply models.QuickReply) (*models.QuickReply, error) {
+	reply.ID = uuid.Nil
+	reply.Text = strings.TrimSpace(reply.Text)
+	if reply.Text == "" {
+		return nil, ErrEmptyMessage
+	}
+	if err := s.db.WithContext(ctx).Create(&reply).Error; err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (s *incidentMessagesService) DeleteQuickReply(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).Delete(&models.QuickReply{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrQuickReplyNotFound
+	}
+	return nil
+}
+
+func (s *incidentMessagesService) quickReply(ctx context.Context, id string, userRole models.UserRole) (*models.QuickReply, error) {
+	replyID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrQuickReplyNotFound
+	}
+	var reply models.QuickReply
+	if err := s.db.WithContext(ctx).First(&reply, "id = ?", replyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrQuickReplyNotFound
+		}
+		return nil, err
+	}
+	if reply.Role != "" && reply.Role != userRole {
+		return nil, ErrQuickReplyNotFound
+	}
+	return &reply, nil
+}
+
+// storeAttachment checks the file type from its content and saves it
+func (s *incidentMessagesService) storeAttachment(ctx context.Context, messageID uuid.UUID, upload AttachmentUpload) (*models.MessageAttachment, error) {
+	data, err := io.ReadAll(io.LimitReader(upload.Reader, maxAttachmentBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAttachmentBytes {
+		return nil, fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidAttachment, maxAttachmentBytes)
+	}
+	contentType := http.DetectContentType(data)
+	if !allowedAttachmentType(contentType) {
+		return nil, ErrInvalidAttachment
+	}
+
+	attachment := models.MessageAttachment{
+		ID:          uuid.New(),
+		MessageID:   messageID,
+		FileName:    path.Base(strings.ReplaceAll(upload.FileName, "\\", "/")),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+	}
+	// The key takes its extension from the content, never from the client's
+	// file name, since media is served with the type the extension implies
+	attachment.StorageKey = fmt.Sprintf("messages/%s/%s%s", messageID, attachment.ID, mediaExtension(contentType))
+	if err := s.store.Put(ctx, attachment.StorageKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return &attachment, nil
+}
+
+func (s *incidentMessagesService) deleteAttachments(ctx context.Context, attachments []models.MessageAttachment) {
+	for _, a := range attachments {
+		if err := s.store.Delete(ctx, a.StorageKey); err != nil {
+			log.Printf("Failed to delete attachment %s: %v", a.StorageKey, err)
+		}
+	}
+}
+
+func (s *incidentMessagesService) signAttachments(message *models.IncidentMessage) {
+	for i := range message.Attachments {
+		message.Attachments[i].URL = s.store.SignedURL(message.Attachments[i].StorageKey, s.urlTTL)
+	}
+}
+
+func allowedAttachmentType(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch {
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/"),
+		contentType == "application/pdf":
+		return true
+	}
+	return false
+}
+
+// mediaExtensions maps the content types http.DetectContentType reports for
+// accepted uploads to the extension they are stored under
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"image/x-icon":    ".ico",
+	"image/avif":      ".avif",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/avi":       ".avi",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/aiff":      ".aiff",
+	"audio/basic":     ".au",
+	"audio/midi":      ".mid",
+	"application/pdf": ".pdf",
+}
+
+// mediaExtension returns the extension to store content of the given sniffed
+// type under; unknown types get one that is served as a download
+func mediaExtension(contentType string) string {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	if ext, ok := mediaExtensions[contentType]; ok {
+		return ext
+	}
+	return ".bin"
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+func TestMediaExtensionFollowsTheContent(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	html := []byte("<!DOCTYPE html><script>alert(1)</script>")
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"png", png, ".png"},
+		{"pdf", []byte("%PDF-1.7\n"), ".pdf"},
+		{"html", html, ".bin"},
+		{"text", []byte("plain words"), ".bin"},
+	} {
+		if got := mediaExtension(http.DetectContentType(tc.data)); got != tc.want {
+			t.Errorf("%s: extension %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if allowedAttachmentType(http.DetectContentType(html)) {
+		t.Error("HTML is accepted as an attachment")
+	}
+}
+
+func TestAllowedAttachmentType(t *testing.T) {
+	for contentType, allowed := range map[string]bool{
+		"image/jpeg":                true,
+		"video/mp4":                 true,
+		"audio/mpeg":                true,
+		"application/pdf":           true,
+		"text/html; charset=utf-8":  false,
+		"text/plain; charset=utf-8": false,
+		"application/zip":           false,
+		"application/octet-stream":  false,
+	} {
+		if got := allowedAttachmentType(contentType); got != allowed {
+			t.Errorf("allowedAttachmentType(%s) = %v, want %v", contentType, got, allowed)
+		}
+	}
+}
+
+func TestStoreAttachment(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://localhost/media", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &incidentMessagesService{store: store}
+	ctx := context.Background()
+	messageID := uuid.New()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	attachment, err := s.storeAttachment(ctx, messageID, AttachmentUpload{FileName: `..\..\photo.html`, Reader: bytes.NewReader(png)})
+	if err != nil {
+		t.Fatalf("storeAttachment: %v", err)
+	}
+	if attachment.FileName != "photo.html" || attachment.ContentType != "image/png" || attachment.SizeBytes != int64(len(png)) {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	if !strings.HasPrefix(attachment.StorageKey, "messages/"+messageID.String()+"/") || !strings.HasSuffix(attachment.StorageKey, ".png") {
+		t.Errorf("stored under %s", attachment.StorageKey)
+	}
+	r, err := store.Open(ctx, attachment.StorageKey)
+	if err != nil {
+		t.Fatalf("stored attachment cannot be opened: %v", err)
+	}
+	r.Close()
+
+	_, err = s.storeAttachment(ctx, messageID, AttachmentUpload{FileName: "notes.pdf", Reader: strings.NewReader("<html><body>hi</body></html>")})
+	if !errors.Is(err, ErrInvalidAttachment) {
+		t.Errorf("storeAttachment of HTML = %v, want ErrInvalidAttachment", err)
+	}
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/pkg/pdf"
+)
+
+// FileName names a download of the report in the given format
+func (d *IncidentReportDocument) FileName(ext string) string {
+	return fmt.Sprintf("incident-%s-report.%s", d.IncidentID.String()[:8], ext)
+}
+
+// PDF renders the report with times in loc
+func (d *IncidentReportDocument) PDF(loc *time.Location) ([]byte, error) {
+	doc := pdf.New("Post-incident report — " + d.Alert.Title)
+	doc.Title("Post-incident report")
+	doc.Small(d.statusLine(loc))
+	doc.KeyValues(d.overview(loc))
+
+	if d.Alert.Description != "" || d.Description != "" {
+		doc.Heading("Description")
+		if d.Alert.Description != "" {
+			doc.Text(d.Alert.Description)
+		}
+		if d.Description != "" {
+			doc.Text(d.Description)
+		}
+	}
+
+	doc.Heading("Response times")
+	doc.KeyValues(d.durationRows())
+
+	doc.Heading("Dispatched guards")
+	if len(d.Guards) == 0 {
+		doc.Small("No guards were dispatched.")
+	} else {
+		rows := make([][]string, len(d.Guards))
+		for i, guard := range d.Guards {
+			rows[i] = []string{guard.Name, guard.Phone, reportTime(guard.DispatchedAt, loc)}
+		}
+		doc.Table([]string{"Guard", "Phone", "Dispatched"}, rows)
+	}
+
+	doc.Heading("Timeline")
+	rows := make([][]string, len(d.Timeline))
+	for i, event := range d.Timeline {
+		rows[i] = []string{reportTime(event.At, loc), "+" + formatDuration(time.Duration(event.SincePreviousSeconds)*time.Second), event.Event, event.Actor, event.Detail}
+	}
+	doc.Table([]string{"Time", "Since previous", "Event", "By", "Detail"}, rows)
+
+	doc.Heading("Updates")
+	if len(d.Updates) == 0 {
+		doc.Small("No updates were reported.")
+	}
+	for _, update := range d.Updates {
+		doc.Small(strings.Join(nonEmpty(reportTime(update.At, loc), statusLabel(string(update.Type)), update.Guard, update.Location), " · "))
+		doc.Text(update.Message)
+		if err := pdfMedia(doc, update.Media); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(d.Snapshots) > 0 {
+		doc.Heading("Camera snapshots")
+		if err := pdfMedia(doc, d.Snapshots); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, section := range d.notes() {
+		doc.Heading(section[0])
+		doc.Text(section[1])
+	}
+
+	doc.Heading("Sign-off")
+	doc.KeyValues(d.signOffRows(loc))
+	return doc.Bytes()
+}
+
+// pdfMedia places the thumbnails in a row and lists media without one
+func pdfMedia(doc *pdf.Document, media []IncidentReportMedia) error {
+	var thumbnails [][]byte
+	for _, m := range media {
+		if m.thumbnail != nil {
+			thumbnails = append(thumbnails, m.thumbnail)
+		} else {
+			doc.Small(m.URL)
+		}
+	}
+	return doc.Images(thumbnails, 90)
+}
+
+// HTML renders the report as a standalone page that Word opens as a
+// document, with thumbnails embedded and times in loc
+func (d *IncidentReportDocument) HTML(loc *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	err := incidentReportTemplate.Execute(&buf, map[string]any{
+		"Doc":       d,
+		"Status":    d.statusLine(loc),
+		"Overview":  d.overview(loc),
+		"Durations": d.durationRows(),
+		"Notes":     d.notes(),
+		"SignOff":   d.signOffRows(loc),
+		"Loc":       loc,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *IncidentReportDocument) statusLine(loc *time.Location) string {
+	line := "Incident " + d.IncidentID.String()
+	if d.SignOff.FinalizedAt != nil {
+		return line + " · finalized " + reportTime(*d.SignOff.FinalizedAt, loc)
+	}
+	return line + " · draft as of " + reportTime(d.AsOf, loc)
+}
+
+func (d *IncidentReportDocument) overview(loc *time.Location) [][2]string {
+	rows := [][2]string{
+		{"Alert", d.Alert.Title},
+		{"Type", statusLabel(string(d.Alert.Type))},
+		{"Severity", string(d.Alert.Severity)},
+		{"Raised", reportTime(d.Alert.RaisedAt, loc)},
+		{"Premise", strings.Join(nonEmpty(d.Premise.Name, d.Premise.Detail), ", ")},
+	}
+	if d.Camera != nil {
+		rows = append(rows, [2]string{"Camera", strings.Join(nonEmpty(d.Camera.Name, d.Camera.Detail), ", ")})
+	}
+	if d.Zone != "" {
+		rows = append(rows, [2]string{"Zone", d.Zone})
+	}
+	return append(rows,
+		[2]string{"Location", d.Location},
+		[2]string{"Incident status", statusLabel(string(d.IncidentStatus))},
+	)
+}
+
+func (d *IncidentReportDocument) durationRows() [][2]string {
+	value := func(seconds *int64) string {
+		if seconds == nil {
+			return "—"
+		}
+		return formatDuration(time.Duration(*seconds) * time.Second)
+	}
+	return [][2]string{
+		{"Acknowledged after", value(d.Durations.ToAcknowledgeSeconds)},
+		{"Guard dispatched after", value(d.Durations.ToDispatchSeconds)},
+		{"Guard on scene after", value(d.Durations.ToArrivalSeconds)},
+		{"Resolved after", value(d.Durations.ToResolveSeconds)},
+		{"Closed after", value(d.Durations.ToCloseSeconds)},
+	}
+}
+
+// notes are the written sections that have content
+func (d *IncidentReportDocument) notes() [][2]string {
+	var sections [][2]string
+	for _, section := range [][2]string{
+		{"Summary", d.Summary},
+		{"Resolution notes", d.ResolutionNotes},
+		{"Recommendations", d.Recommendations},
+	} {
+		if section[1] != "" {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+func (d *IncidentReportDocument) signOffRows(loc *time.Location) [][2]string {
+	if d.SignOff.FinalizedAt == nil {
+		return [][2]string{
+			{"Prepared by", d.SignOff.PreparedBy},
+			{"Status", "Draft — not signed off"},
+		}
+	}
+	return [][2]string{
+		{"Prepared by", d.SignOff.PreparedBy},
+		{"Signed off by", strings.Join(nonEmpty(d.SignOff.Name, d.SignOff.Title), ", ")},
+		{"Account", d.SignOff.SignedOffBy},
+		{"Date", reportTime(*d.SignOff.FinalizedAt, loc)},
+	}
+}
+
+func reportTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(reportTimeLayout + " MST")
+}
+
+func nonEmpty(values ...string) []string {
+	kept := values[:0]
+	for _, v := range values {
+		if v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// The Office namespaces and inline styles make Word keep the layout when
+// the page is opened or pasted as a document
+var incidentReportTemplate = template.Must(template.New("incident_report").Funcs(template.FuncMap{
+	"time": reportTime,
+	"since": func(seconds int64) string {
+		return "+" + formatDuration(time.Duration(seconds)*time.Second)
+	},
+	"label": func(v any) string { return statusLabel(fmt.Sprint(v)) },
+	"thumbnail": func(m IncidentReportMedia) template.URL {
+		// Generated from our own JPEG bytes, never from input
+		return template.URL(m.Thumbnail)
+	},
+}).Parse(`<!DOCTYPE html>
+<html xmlns:o="urn:schemas-microsoft-com:office:office" xmlns:w="urn:schemas-microsoft-com:office:word">
+<head>
+<meta charset="utf-8">
+<meta name="ProgId" content="Word.Document">
+<title>Post-incident report — {{.Doc.Alert.Title}}</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; font-size: 10pt; color: #222; }
+h1 { font-size: 18pt; margin-bottom: 2pt; }
+h2 { font-size: 12pt; margin-top: 16pt; border-bottom: 1px solid #999; }
+table { border-collapse: collapse; width: 100%; margin: 4pt 0; }
+th, td { border: 1px solid #bbb; padding: 3pt 5pt; text-align: left; vertical-align: top; font-size: 9pt; }
+th { background: #eee; }
+table.fields th { width: 30%; }
+.muted { color: #666; font-size: 8.5pt; }
+img { margin: 2pt 4pt 2pt 0; }
+</style>
+</head>
+<body>
+<h1>Post-incident report</h1>
+<p class="muted">{{.Status}}</p>
+<table class="fields">
+{{- range .Overview}}
+<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{- end}}
+</table>
+{{- if or .Doc.Alert.Description .Doc.Description}}
+<h2>Description</h2>
+{{- with .Doc.Alert.Description}}<p>{{.}}</p>{{end}}
+{{- with .Doc.Description}}<p>{{.}}</p>{{end}}
+{{- end}}
+<h2>Response times</h2>
+<table class="fields">
+{{- range .Durations}}
+<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{- end}}
+</table>
+<h2>Dispatched guards</h2>
+{{- if .Doc.Guards}}
+<table>
+<tr><th>Guard</th><th>Phone</th><th>Dispatched</th></tr>
+{{- range .Doc.Guards}}
+<tr><td>{{.Name}}</td><td>{{.Phone}}</td><td>{{time .DispatchedAt $.Loc}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p class="muted">No guards were dispatched.</p>
+{{- end}}
+<h2>Timeline</h2>
+<table>
+<tr><th>Time</th><th>Since previous</th><th>Event</th><th>By</th><th>Detail</th></tr>
+{{- range .Doc.Timeline}}
+<tr><td>{{time .At $.Loc}}</td><td>{{since .SincePreviousSeconds}}</td><td>{{.Event}}</td><td>{{.Actor}}</td><td>{{.Detail}}</td></tr>
+{{- end}}
+</table>
+<h2>Updates</h2>
+{{- range .Doc.Updates}}
+<p class="muted">{{time .At $.Loc}} · {{label .Type}}{{with .Guard}} · {{.}}{{end}}{{with .Location}} · {{.}}{{end}}</p>
+<p>{{.Message}}</p>
+{{- range .Media}}
+{{- if .Thumbnail}}
+<a href="{{.URL}}"><img src="{{thumbnail .}}" height="120" alt="Photo"></a>
+{{- else}}
+<p class="muted"><a href="{{.URL}}">{{.URL}}</a></p>
+{{- end}}
+{{- end}}
+{{- else}}
+<p class="muted">No updates were reported.</p>
+{{- end}}
+{{- if .Doc.Snapshots}}
+<h2>Camera snapshots</h2>
+<p>
+{{- range .Doc.Snapshots}}
+{{- if .Thumbnail}}
+<a href="{{.URL}}"><img src="{{thumbnail .}}" height="120" alt="Snapshot {{time .At $.Loc}}"></a>
+{{- else}}
+<a href="{{.URL}}">Snapshot {{time .At $.Loc}}</a>
+{{- end}}
+{{- end}}
+</p>
+{{- end}}
+{{- range .Notes}}
+<h2>{{index . 0}}</h2>
+<p style="white-space: pre-wrap">{{index . 1}}</p>
+{{- end}}
+<h2>Sign-off</h2>
+<table class="fields">
+{{- range .SignOff}}
+<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/capture"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Thumbnails are embedded in the document, so their number is capped
+	maxReportThumbnails = 24
+	maxReportSnapshots  = 6
+	maxReportMediaBytes = 20 << 20
+)
+
+var (
+	ErrIncidentReportLocked  = errors.New("incident report is finalized")
+	ErrIncidentNotResolved   = errors.New("incident is not resolved")
+	ErrInvalidIncidentReport = errors.New("invalid incident report")
+)
+
+// IncidentReportInput is the written part of a post-incident report
+type IncidentReportInput struct {
+	Summary         string
+	ResolutionNotes string
+	Recommendations string
+}
+
+// IncidentSignOff is the name and position the report is signed off under
+type IncidentSignOff struct {
+	Name  string
+	Title string
+}
+
+// IncidentReportDocument is a post-incident report: the incident assembled
+// from its alert, guards, status history and updates, with the written
+// notes and sign-off. A finalized report shows the incident as of sign-off.
+type IncidentReportDocument struct {
+	IncidentID      uuid.UUID                   `json:"incident_id"`
+	Status          models.IncidentReportStatus `json:"status"`
+	IncidentStatus  models.IncidentStatus       `json:"incident_status"`
+	AsOf            time.Time                   `json:"as_of"`
+	Location        string                      `json:"location"`
+	Description     string                      `json:"description,omitempty"`
+	Alert           IncidentReportAlert         `json:"alert"`
+	Premise         IncidentReportPlace         `json:"premise"`
+	Camera          *IncidentReportPlace        `json:"camera,omitempty"`
+	Zone            string                      `json:"zone,omitempty"`
+	Guards          []IncidentReportGuard       `json:"guards"`
+	Durations       IncidentReportDurations     `json:"durations"`
+	Timeline        []IncidentReportEvent       `json:"timeline"`
+	Updates         []IncidentReportUpdate      `json:"updates"`
+	Snapshots       []IncidentReportMedia       `json:"snapshots"`
+	Summary         string                      `json:"summary"`
+	ResolutionNotes string                      `json:"resolution_notes"`
+	Recommendations string                      `json:"recommendations"`
+	SignOff         IncidentReportSignOff       `json:"sign_off"`
+}
+
+type IncidentReportAlert struct {
+	ID          uuid.UUID            `json:"id"`
+	Type        models.AlertType     `json:"type"`
+	Severity    models.AlertSeverity `json:"severity"`
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Location    string               `json:"location"`
+	RaisedAt    time.Time            `json:"raised_at"`
+}
+
+type IncidentReportPlace struct {
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+type IncidentReportGuard struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Phone        string    `json:"phone,omitempty"`
+	DispatchedAt time.Time `json:"dispatched_at"`
+}
+
+// IncidentReportDurations are measured from when the alert was raised; a
+// milestone that was not reached is omitted
+type IncidentReportDurations struct {
+	ToAcknowledgeSeconds *int64 `json:"to_acknowledge_seconds,omitempty"`
+	ToDispatchSeconds    *int64 `json:"to_dispatch_seconds,omitempty"`
+	ToArrivalSeconds     *int64 `json:"to_arrival_seconds,omitempty"`
+	ToResolveSeconds     *int64 `json:"to_resolve_seconds,omitempty"`
+	ToCloseSeconds       *int64 `json:"to_close_seconds,omitempty"`
+}
+
+type IncidentReportEvent struct {
+	At                   time.Time `json:"at"`
+	Event                string    `json:"event"`
+	Detail               string    `json:"detail,omitempty"`
+	Actor                string    `json:"actor,omitempty"`
+	SincePreviousSeconds int64     `json:"since_previous_seconds"`
+	SinceAlertSeconds    int64     `json:"since_alert_seconds"`
+}
+
+type IncidentReportUpdate struct {
+	ID       uuid.UUID             `json:"id"`
+	At       time.Time             `json:"at"`
+	Type     models.UpdateType     `json:"type"`
+	Guard    string                `json:"guard"`
+	Message  string                `json:"message"`
+	Location string                `json:"location,omitempty"`
+	Media    []IncidentReportMedia `json:"media,omitempty"`
+}
+
+// IncidentReportMedia links a photo or snapshot. Media held in our storage
+// gets a fresh signed URL and, within the cap, an embedded JPEG thumbnail
+// as a data URI; other links are passed through untouched.
+type IncidentReportMedia struct {
+	URL       string    `json:"url"`
+	Thumbnail string    `json:"thumbnail,omitempty"`
+	At        time.Time `json:"at,omitempty"`
+
+	thumbnail []byte
+}
+
+type IncidentReportSignOff struct {
+	PreparedBy  string     `json:"prepared_by,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	SignedOffBy string     `json:"signed_off_by,omitempty"`
+	FinalizedAt *time.Time `json:"finalized_at,omitempty"`
+}
+
+// IncidentReportsService builds post-incident reports and manages their
+// notes and sign-off
+type IncidentReportsService interface {
+	GetReport(ctx context.Context, incidentID string, userRole models.UserRole, userID string) (*IncidentReportDocument, error)
+	UpdateReport(ctx context.Context, incidentID string, input IncidentReportInput, userID string) (*models.IncidentReport, error)
+	FinalizeReport(ctx context.Context, incidentID string, signOff IncidentSignOff, userID string) (*models.IncidentReport, error)
+}
+
+type incidentReportsService struct {
+	db     *gorm.DB
+	store  storage.Storage
+	urlTTL time.Duration
+	audit  AuditService
+}
+
+func NewIncidentReportsService(db *gorm.DB, store storage.Storage, urlTTL time.Duration, audit AuditService) IncidentReportsService {
+	return &incidentReportsService{db: db, store: store, urlTTL: urlTTL, audit: audit}
+}
+
+// loadIncidentReport returns the incident's report, or an unsaved draft if
+// nothing has been written yet
+func loadIncidentReport(ctx context.Context, db *gorm.DB, incidentID uuid.UUID) (*models.IncidentReport, error) {
+	var report models.IncidentReport
+	err := db.WithContext(ctx).Preload("PreparedBy").Preload("SignedOffBy").
+		First(&report, "incident_id = ?", incidentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.IncidentReport{IncidentID: incidentID, Status: models.IncidentReportDraft}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// requireReportDraft stops an incident from changing under a finalized report
+func requireReportDraft(ctx context.Context, db *gorm.DB, incidentID uuid.UUID) error {
+	var count int64
+	if err := db.WithContext(ctx).Model(&models.IncidentReport{}).
+		Where("incident_id = ? AND status = ?", incidentID, models.IncidentReportFinalized).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrIncidentReportLocked
+	}
+	return nil
+}
+
+func (s *incidentReportsService) GetReport(ctx context.Context, incidentID string, userRole models.UserRole, userID string) (*IncidentReportDocument, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := loadIncidentReport(ctx, s.db, incident.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.build(ctx, incident, report)
+}
+
+func (s *incidentReportsService) UpdateReport(ctx context.Context, incidentID string, input IncidentReportInput, userID string) (report *models.IncidentReport, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident_report.update", "incident", normalizeID(incidentID), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, models.RoleSCSOperator, userID)
+	if err != nil {
+		return nil, err
+	}
+	report, err = loadIncidentReport(ctx, s.db, incident.ID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == models.IncidentReportFinalized {
+		return nil, ErrIncidentReportLocked
+	}
+
+	report.Summary = strings.TrimSpace(input.Summary)
+	report.ResolutionNotes = strings.TrimSpace(input.ResolutionNotes)
+	report.Recommendations = strings.TrimSpace(input.Recommendations)
+	report.PreparedByID = requester(userID)
+	report.PreparedBy = nil
+	if report.ID == uuid.Nil {
+		err = s.db.WithContext(ctx).Create(report).Error
+	} else {
+		// Finalizing may have won the race since the report was read
+		result := s.db.WithContext(ctx).Model(report).
+			Where("status = ?", models.IncidentReportDraft).
+			Select("summary", "resolution_notes", "recommendations", "prepared_by_id", "updated_at").
+			Updates(report)
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
+			err = ErrIncidentReportLocked
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadIncidentReport(ctx, s.db, incident.ID)
+}
+
+// FinalizeReport signs the report off and locks it. The incident must be
+// resolved and the resolution written up; no updates can be added after.
+func (s *incidentReportsService) FinalizeReport(ctx context.Context, incidentID string, signOff IncidentSignOff, userID string) (report *models.IncidentReport, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident_report.finalize", "incident", normalizeID(incidentID), userID, models.RoleSCSOperator, err,
+			models.JSONMap{"sign_off_name": signOff.Name})
+	}()
+
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, models.RoleSCSOperator, userID)
+	if err != nil {
+		return nil, err
+	}
+	if incident.Status != models.IncidentStatusResolved && incident.Status != models.IncidentStatusClosed {
+		return nil, ErrIncidentNotResolved
+	}
+	report, err = loadIncidentReport(ctx, s.db, incident.ID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == models.IncidentReportFinalized {
+		return nil, ErrIncidentReportLocked
+	}
+	if report.ResolutionNotes == "" {
+		return nil, fmt.Errorf("%w: resolution notes are required", ErrInvalidIncidentReport)
+	}
+	name := strings.TrimSpace(signOff.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: sign-off name is required", ErrInvalidIncidentReport)
+	}
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.IncidentReport{}).
+		Where("id = ? AND status = ?", report.ID, models.IncidentReportDraft).
+		Updates(map[string]any{
+			"status":           models.IncidentReportFinalized,
+			"sign_off_name":    name,
+			"sign_off_title":   strings.TrimSpace(signOff.Title),
+			"signed_off_by_id": requester(userID),
+			"finalized_at":     now,
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrIncidentReportLocked
+	}
+	return loadIncidentReport(ctx, s.db, incident.ID)
+}
+
+// build assembles the document. Everything recorded after a finalized
+// report's sign-off is left out.
+func (s *incidentReportsService) build(ctx context.Context, incident *models.Incident, report *models.IncidentReport) (*IncidentReportDocument, error) {
+	db := s.db.WithContext(ctx)
+	asOf := time.Now()
+	if report.FinalizedAt != nil {
+		asOf = *report.FinalizedAt
+	}
+
+	var alert models.Alert
+	if err := db.Preload("Premise").Preload("Camera").Preload("Zone").
+		First(&alert, "id = ?", incident.AlertID).Error; err != nil {
+		return nil, err
+	}
+
+	var assignments []models.IncidentGuard
+	if err := db.Preload("Guard").
+		Where("incident_id = ? AND created_at <= ?", incident.ID, asOf).
+		Order("created_at ASC").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	var changes []models.StatusChange
+	if err := db.Where("alert_id = ? AND created_at <= ?", alert.ID, asOf).
+		Order("created_at ASC").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	var updates []models.IncidentUpdate
+	if err := db.Preload("Guard").
+		Where("incident_id = ? AND created_at <= ?", incident.ID, asOf).
+		Order("created_at ASC").Find(&updates).Error; err != nil {
+		return nil, err
+	}
+	var snapshots []models.AlertSnapshot
+	if err := db.Where("alert_id = ? AND created_at <= ?", alert.ID, asOf).
+		Order("captured_at ASC").Limit(maxReportSnapshots).Find(&snapshots).Error; err != nil {
+		return nil, err
+	}
+
+	doc := &IncidentReportDocument{
+		IncidentID:     incident.ID,
+		Status:         report.Status,
+		IncidentStatus: incident.Status,
+		AsOf:           asOf,
+		Location:       incident.Location,
+		Description:    incident.Description,
+		Alert: IncidentReportAlert{
+			ID:          alert.ID,
+			Type:        alert.Type,
+			Severity:    alert.Severity,
+			Title:       alert.Title,
+			Description: alert.Description,
+			Location:    alert.Location,
+			RaisedAt:    alert.CreatedAt,
+		},
+		Premise:         IncidentReportPlace{ID: alert.Premise.ID, Name: alert.Premise.Name, Detail: alert.Premise.Address},
+		Guards:          []IncidentReportGuard{},
+		Updates:         []IncidentReportUpdate{},
+		Snapshots:       []IncidentReportMedia{},
+		Summary:         report.Summary,
+		ResolutionNotes: report.ResolutionNotes,
+		Recommendations: report.Recommendations,
+		SignOff: IncidentReportSignOff{
+			PreparedBy:  userName(report.PreparedBy),
+			Name:        report.SignOffName,
+			Title:       report.SignOffTitle,
+			SignedOffBy: userName(report.SignedOffBy),
+			FinalizedAt: report.FinalizedAt,
+		},
+	}
+	if alert.Camera != nil {
+		doc.Camera = &IncidentReportPlace{ID: alert.Camera.ID, Name: alert.Camera.Name, Detail: alert.Camera.Location}
+	}
+	if alert.Zone != nil {
+		doc.Zone = alert.Zone.Name
+	}
+
+	var events []IncidentReportEvent
+	event := func(at time.Time, name, detail, actor string) {
+		events = append(events, IncidentReportEvent{At: at, Event: name, Detail: detail, Actor: actor})
+	}
+	event(alert.CreatedAt, "Alert raised", alert.Title, "")
+	event(incident.CreatedAt, "Incident opened", incident.Location, "")
+
+	for _, change := range changes {
+		subject := "Alert"
+		if change.IncidentID != nil {
+			subject = "Incident"
+			// The incident's own status at sign-off, not whatever came after
+			doc.IncidentStatus = models.IncidentStatus(change.ToStatus)
+		}
+		detail := ""
+		if change.FromStatus != "" {
+			detail = "from " + statusLabel(change.FromStatus)
+		}
+		event(change.CreatedAt, subject+" "+statusLabel(change.ToStatus), detail, "")
+	}
+
+	for _, assignment := range assignments {
+		name := userName(&assignment.Guard)
+		doc.Guards = append(doc.Guards, IncidentReportGuard{
+			ID:           assignment.GuardID,
+			Name:         name,
+			Phone:        assignment.Guard.Phone,
+			DispatchedAt: assignment.CreatedAt,
+		})
+		event(assignment.CreatedAt, "Guard dispatched", "", name)
+	}
+
+	if incident.ChecklistOverrideAt != nil && !incident.ChecklistOverrideAt.After(asOf) {
+		event(*incident.ChecklistOverrideAt, "Checklist overridden", incident.ChecklistOverrideReason, "")
+	}
+
+	budget := maxReportThumbnails
+	for _, update := range updates {
+		name := userName(&update.Guard)
+		entry := IncidentReportUpdate{
+			ID:       update.ID,
+			At:       update.CreatedAt,
+			Type:     update.Type,
+			Guard:    name,
+			Message:  update.Message,
+			Location: update.Location,
+		}
+		for _, raw := range update.MediaURLs {
+			entry.Media = append(entry.Media, s.media(ctx, raw, &budget))
+		}
+		doc.Updates = append(doc.Updates, entry)
+		event(update.CreatedAt, updateTitle(string(update.Type)), update.Message, name)
+	}
+
+	for _, snapshot := range snapshots {
+		media := IncidentReportMedia{URL: s.store.SignedURL(snapshot.StorageKey, s.urlTTL), At: snapshot.CapturedAt}
+		if budget > 0 {
+			// Snapshot thumbnails are stored ready to use
+			if data, err := s.read(ctx, snapshot.ThumbnailKey); err == nil {
+				media.setThumbnail(data)
+				budget--
+			}
+		}
+		doc.Snapshots = append(doc.Snapshots, media)
+	}
+
+	// Stable, so that events at the same instant keep the order above
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	for i := range events {
+		events[i].SinceAlertSeconds = int64(events[i].At.Sub(alert.CreatedAt) / time.Second)
+		if i > 0 {
+			events[i].SincePreviousSeconds = int64(events[i].At.Sub(events[i-1].At) / time.Second)
+		}
+	}
+	doc.Timeline = events
+	doc.Durations = reportDurations(alert.CreatedAt, changes, assignments, updates)
+	return doc, nil
+}
+
+// media resolves a link attached to an update. Links to other hosts are
+// never fetched.
+func (s *incidentReportsService) media(ctx context.Context, raw string, budget *int) IncidentReportMedia {
+	key, ok := s.store.KeyFromURL(raw)
+	if !ok {
+		return IncidentReportMedia{URL: raw}
+	}
+	media := IncidentReportMedia{URL: s.store.SignedURL(key, s.urlTTL)}
+	if *budget <= 0 {
+		return media
+	}
+	data, err := s.read(ctx, key)
+	if err != nil {
+		log.Printf("Incident report: failed to read media %s: %v", key, err)
+		return media
+	}
+	// Only JPEG photos get a thumbnail; anything else stays a link
+	if thumb, err := capture.Thumbnail(data, snapshotThumbnailWidth); err == nil {
+		media.setThumbnail(thumb)
+		*budget--
+	}
+	return media
+}
+
+func (s *incidentReportsService) read(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxReportMediaBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReportMediaBytes {
+		return nil, fmt.Errorf("media exceeds %d bytes", maxReportMediaBytes)
+	}
+	return data, nil
+}
+
+func (m *IncidentReportMedia) setThumbnail(jpeg []byte) {
+	m.thumbnail = jpeg
+	m.Thumbnail = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(jpeg)
+}
+
+func reportDurations(raised time.Time, changes []models.StatusChange, assignments []models.IncidentGuard, updates []models.IncidentUpdate) IncidentReportDurations {
+	var durations IncidentReportDurations
+	since := func(target **int64, at time.Time) {
+		if *target == nil {
+			seconds := int64(at.Sub(raised) / time.Second)
+			*target = &seconds
+		}
+	}
+	for _, change := range changes {
+		switch change.ToStatus {
+		case string(models.AlertStatusAcknowledged):
+			since(&durations.ToAcknowledgeSeconds, change.CreatedAt)
+		case string(models.AlertStatusResolved), string(models.AlertStatusFalseAlarm):
+			since(&durations.ToResolveSeconds, change.CreatedAt)
+		case string(models.AlertStatusClosed):
+			since(&durations.ToCloseSeconds, change.CreatedAt)
+		}
+	}
+	if len(assignments) > 0 {
+		since(&durations.ToDispatchSeconds, assignments[0].CreatedAt)
+	}
+	for _, update := range updates {
+		if update.Type == models.UpdateTypeArrival {
+			since(&durations.ToArrivalSeconds, update.CreatedAt)
+			break
+		}
+	}
+	return durations
+}
+
+// statusLabel turns a status such as in_progress into "in progress"
+func statusLabel(status string) string {
+	return strings.ReplaceAll(status, "_", " ")
+}
+
+// updateTitle names an update on the timeline, such as "Arrival update".
+// Updates saved without a type are just an "Update".
+func updateTitle(updateType string) string {
+	label := statusLabel(updateType)
+	if label == "" {
+		return "Update"
+	}
+	return strings.ToUpper(label[:1]) + label[1:] + " update"
+}
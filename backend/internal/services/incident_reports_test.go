@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+func TestUpdateTitle(t *testing.T) {
+	for updateType, want := range map[string]string{
+		"arrival":       "Arrival update",
+		"status_change": "Status change update",
+		"":              "Update",
+	} {
+		if got := updateTitle(updateType); got != want {
+			t.Errorf("updateTitle(%q) = %q, want %q", updateType, got, want)
+		}
+	}
+}
+
+func TestReportDurationsTakeTheFirstMilestone(t *testing.T) {
+	raised := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return raised.Add(time.Duration(minutes) * time.Minute) }
+	changes := []models.StatusChange{
+		{ToStatus: string(models.AlertStatusAcknowledged), CreatedAt: at(1)},
+		{ToStatus: string(models.AlertStatusAcknowledged), CreatedAt: at(3)},
+		{ToStatus: string(models.AlertStatusFalseAlarm), CreatedAt: at(20)},
+		{ToStatus: string(models.AlertStatusClosed), CreatedAt: at(25)},
+	}
+	assignments := []models.IncidentGuard{{CreatedAt: at(2)}, {CreatedAt: at(4)}}
+	updates := []models.IncidentUpdate{
+		{Type: models.UpdateTypeInvestigation, CreatedAt: at(5)},
+		{Type: models.UpdateTypeArrival, CreatedAt: at(10)},
+		{Type: models.UpdateTypeArrival, CreatedAt: at(12)},
+	}
+
+	d := reportDurations(raised, changes, assignments, updates)
+	for name, tt := range map[string]struct {
+		got  *int64
+		want int64
+	}{
+		"acknowledge": {d.ToAcknowledgeSeconds, 60},
+		"dispatch":    {d.ToDispatchSeconds, 120},
+		"arrival":     {d.ToArrivalSeconds, 600},
+		"resolve":     {d.ToResolveSeconds, 1200},
+		"close":       {d.ToCloseSeconds, 1500},
+	} {
+		if tt.got == nil {
+			t.Errorf("%s is missing, want %d seconds", name, tt.want)
+		} else if *tt.got != tt.want {
+			t.Errorf("%s after %d seconds, want %d", name, *tt.got, tt.want)
+		}
+	}
+
+	if d := reportDurations(raised, nil, nil, nil); d != (IncidentReportDurations{}) {
+		t.Errorf("durations without milestones = %+v", d)
+	}
+}
+
+func TestReportMedia(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://localhost/media", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &incidentReportsService{store: store, urlTTL: time.Hour}
+	ctx := context.Background()
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+	store.Put(ctx, "updates/photo.jpg", bytes.NewReader(photo.Bytes()))
+	store.Put(ctx, "updates/notes.txt", strings.NewReader("notes"))
+
+	budget := 1
+	if media := s.media(ctx, "https://example.com/photo.jpg", &budget); media.URL != "https://example.com/photo.jpg" || media.Thumbnail != "" {
+		t.Errorf("external media = %+v, want the link untouched", media)
+	}
+	if media := s.media(ctx, store.SignedURL("updates/notes.txt", time.Minute), &budget); media.Thumbnail != "" || budget != 1 {
+		t.Errorf("text media = %+v, want a link only", media)
+	}
+	media := s.media(ctx, store.SignedURL("updates/photo.jpg", time.Minute), &budget)
+	if !strings.HasPrefix(media.Thumbnail, "data:image/jpeg;base64,") || !strings.HasPrefix(media.URL, "http://localhost/media/updates/photo.jpg?") || budget != 0 {
+		t.Errorf("photo media = %+v with %d thumbnails left", media, budget)
+	}
+	// Past the budget photos are only linked
+	if media := s.media(ctx, store.SignedURL("updates/photo.jpg", time.Minute), &budget); media.Thumbnail != "" {
+		t.Error("thumbnail embedded past the budget")
+	}
+}
+
+func TestRenderIncidentReport(t *testing.T) {
+	raised := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	doc := &IncidentReportDocument{
+		IncidentID:     uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e"),
+		IncidentStatus: models.IncidentStatus("in_progress"),
+		AsOf:           raised.Add(time.Hour),
+		Alert:          IncidentReportAlert{Title: "Gate <forced>", Type: models.AlertType("intrusion"), RaisedAt: raised},
+		Premise:        IncidentReportPlace{Name: "Depot"},
+		Timeline:       []IncidentReportEvent{{At: raised, Event: "Alert raised"}},
+		Updates:        []IncidentReportUpdate{{At: raised.Add(time.Minute), Message: "On my way", Media: []IncidentReportMedia{{URL: "https://example.com/photo.jpg"}}}},
+		Summary:        "Nothing taken",
+		SignOff:        IncidentReportSignOff{PreparedBy: "Ann Operator"},
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+
+	if name := doc.FileName("pdf"); name != "incident-0f8fad5b-report.pdf" {
+		t.Errorf("FileName = %s", name)
+	}
+	html, err := doc.HTML(berlin)
+	if err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	for _, want := range []string{"Gate &lt;forced&gt;", "draft as of", "CET", "Nothing taken", "Draft — not signed off", "https://example.com/photo.jpg"} {
+		if !bytes.Contains(html, []byte(want)) {
+			t.Errorf("HTML report has no %q", want)
+		}
+	}
+	if bytes.Contains(html, []byte("Recommendations")) {
+		t.Error("HTML report has an empty Recommendations section")
+	}
+
+	finalized := raised.Add(2 * time.Hour)
+	doc.SignOff = IncidentReportSignOff{PreparedBy: "Ann Operator", Name: "Bo Manager", SignedOffBy: "bo", FinalizedAt: &finalized}
+	if line := doc.statusLine(time.UTC); !strings.HasSuffix(line, "finalized "+reportTime(finalized, time.UTC)) {
+		t.Errorf("status line = %s", line)
+	}
+	pdf, err := doc.PDF(berlin)
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Errorf("PDF starts with %q", pdf[:min(len(pdf), 8)])
+	}
+}
@@ -12,46 +12,53 @@ import (
 
 // IncidentsService defines operations on incidents
 type IncidentsService interface {
-	GetIncidents(ctx context.Context, userRole models.UserRole, userID string, status string) ([]models.Incident, error)
+	GetIncidents(ctx context.Context, q ListQuery, userRole models.UserRole, userID string) (*Page[models.Incident], error)
 	GetIncident(ctx context.Context, id string, userRole models.UserRole, userID string) (*models.Incident, error)
 	UpdateIncident(ctx context.Context, id string, status models.IncidentStatus, userRole models.UserRole, userID string) (*models.Incident, error)
 	AddIncidentUpdate(ctx context.Context, incidentID string, update models.IncidentUpdate, userRole models.UserRole, userID string) (*models.IncidentUpdate, error)
 	GetIncidentByAlertID(ctx context.Context, alertID string) (*models.Incident, error)
 }
 
+var incidentListSpec = &listSpec[models.Incident]{
+	table: "incidents",
+	id:    func(i *models.Incident) uuid.UUID { return i.ID },
+	sorts: map[string]listColumn[models.Incident]{
+		"created_at": {expr: "incidents.created_at", kind: cursorTime, value: func(i *models.Incident) any { return i.CreatedAt }},
+		"updated_at": {expr: "incidents.updated_at", kind: cursorTime, value: func(i *models.Incident) any { return i.UpdatedAt }},
+		"status":     {expr: "incidents.status", kind: cursorString, value: func(i *models.Incident) any { return string(i.Status) }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"status":            {clause: "incidents.status IN ?"},
+		"alert_id":          {clause: "incidents.alert_id IN ?", kind: filterUUID},
+		"premise_id":        {clause: "incidents.alert_id IN (SELECT id FROM alerts WHERE premise_id IN ?)", kind: filterUUID},
+		"severity":          {clause: "incidents.alert_id IN (SELECT id FROM alerts WHERE severity IN ?)"},
+		"assigned_guard_id": {clause: "incidents.id IN (SELECT incident_id FROM incident_guards WHERE guard_id IN ?)", kind: filterUUID},
+	},
+	relations: map[string]listRelation{
+		"alert":           {preload: "Alert"},
+		"assigned_guards": {preload: "AssignedGuards"},
+		"updates":         {preload: "Updates", order: "created_at ASC"},
+		"checklist":       {preload: "Checklist", order: "sequence ASC"},
+	},
+}
+
 type incidentsService struct {
 	db    *gorm.DB
 	wsHub *websocket.Hub
+	audit AuditService
 }
 
-func NewIncidentsService(db *gorm.DB, wsHub *websocket.Hub) IncidentsService {
-	return &incidentsService{db: db, wsHub: wsHub}
+func NewIncidentsService(db *gorm.DB, wsHub *websocket.Hub, audit AuditService) IncidentsService {
+	return &incidentsService{db: db, wsHub: wsHub, audit: audit}
 }
 
-func (s *incidentsService) GetIncidents(ctx context.Context, userRole models.UserRole, userID string, status string) ([]models.Incident, error) {
-	var incidents []models.Incident
-	query := s.db.WithContext(ctx).
-		Model(&models.Incident{}).
-		Preload("Alert").
-		Preload("AssignedGuards").
-		Preload("Updates")
-
+func (s *incidentsService) GetIncidents(ctx context.Context, q ListQuery, userRole models.UserRole, userID string) (*Page[models.Incident], error) {
+	query := s.db.WithContext(ctx).Model(&models.Incident{})
 	if userRole == models.RoleSecurityGuard {
-		// join bảng trung gian incident_guards để lọc các incident có guard tương ứng
-		query = query.Joins("JOIN incident_guards ig ON ig.incident_id = incidents.id").
-			Where("ig.guard_id = ?", userID)
+		query = query.Where("incidents.id IN (SELECT incident_id FROM incident_guards WHERE guard_id = ?)", userID)
 	}
-
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-
-	query = query.Order("incidents.created_at DESC")
-
-	if err := query.Find(&incidents).Error; err != nil {
-		return nil, err
-	}
-	return incidents, nil
+	return incidentListSpec.find(query, q)
 }
 
 func (s *incidentsService) GetIncident(ctx context.Context, id string, userRole models.UserRole, userID string) (*models.Incident, error) {
@@ -84,6 +91,20 @@ func (s *incidentsService) UpdateIncident(
 	status models.IncidentStatus,
 	userRole models.UserRole,
 	userID string,
+) (incident *models.Incident, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident.update_status", "incident", normalizeID(id), userID, userRole, err,
+			models.JSONMap{"status": string(status)})
+	}()
+	return s.updateIncident(ctx, id, status, userRole, userID)
+}
+
+func (s *incidentsService) updateIncident(
+	ctx context.Context,
+	id string,
+	status models.IncidentStatus,
+	userRole models.UserRole,
+	userID string,
 ) (*models.Incident, error) {
 	incidentID, err := uuid.Parse(id)
 	if err != nil {
@@ -109,12 +130,30 @@ func (s *incidentsService) UpdateIncident(
 		}
 	}
 
+	// A signed-off report covers the incident's status, so it cannot change
+	// after, which also keeps a finalized incident from being reopened
+	if err := requireReportDraft(ctx, s.db, incidentID); err != nil {
+		return nil, err
+	}
+
+	// Resolving or closing ends the response, so the SOP checklist must be
+	// done unless an operator overrode it
+	if (status == models.IncidentStatusResolved || status == models.IncidentStatusClosed) && status != incident.Status {
+		if err := requireChecklistDone(ctx, s.db, &incident); err != nil {
+			return nil, err
+		}
+	}
+
+	previous := incident.Status
 	incident.Status = status
 	if err := s.db.WithContext(ctx).Save(&incident).Error; err != nil {
 		return nil, err
 	}
+	if previous != status {
+		recordStatusChange(ctx, s.db, incident.AlertID, &incident.ID, string(previous), string(status))
+	}
 
-	s.wsHub.Broadcast("incident_updated", incident)
+	s.wsHub.Publish(incidentTopics(ctx, s.db, &incident), "incident_updated", incident)
 	return &incident, nil
 }
 
@@ -125,6 +164,20 @@ func (s *incidentsService) AddIncidentUpdate(
 	update models.IncidentUpdate,
 	userRole models.UserRole,
 	userID string,
+) (saved *models.IncidentUpdate, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident.add_update", "incident", normalizeID(incidentID), userID, userRole, err,
+			models.JSONMap{"type": string(update.Type)})
+	}()
+	return s.addIncidentUpdate(ctx, incidentID, update, userRole, userID)
+}
+
+func (s *incidentsService) addIncidentUpdate(
+	ctx context.Context,
+	incidentID string,
+	update models.IncidentUpdate,
+	userRole models.UserRole,
+	userID string,
 ) (*models.IncidentUpdate, error) {
 	iid, err := uuid.Parse(incidentID)
 	if err != nil {
@@ -150,6 +203,18 @@ func (s *incidentsService) AddIncidentUpdate(
 		}
 	}
 
+	// A signed-off report covers every update, so none can be added after
+	if err := requireReportDraft(ctx, s.db, iid); err != nil {
+		return nil, err
+	}
+
+	// A resolution resolves the incident, so the SOP checklist must be done
+	if update.Type == models.UpdateTypeResolution {
+		if err := requireChecklistDone(ctx, s.db, &incident); err != nil {
+			return nil, err
+		}
+	}
+
 	update.IncidentID = iid
 	if guardUUID, err := uuid.Parse(userID); err == nil {
 		update.GuardID = guardUUID
@@ -161,14 +226,18 @@ func (s *incidentsService) AddIncidentUpdate(
 
 	// ✅ Nếu update là loại resolution thì đổi status incident
 	if update.Type == models.UpdateTypeResolution {
+		previous := incident.Status
 		incident.Status = models.IncidentStatusResolved
 		if err := s.db.WithContext(ctx).Save(&incident).Error; err != nil {
 			return nil, err
 		}
+		if previous != incident.Status {
+			recordStatusChange(ctx, s.db, incident.AlertID, &incident.ID, string(previous), string(incident.Status))
+		}
 	}
 
 	// ✅ Broadcast event
-	s.wsHub.BroadcastToRole("scs_operator", "incident_update_received", map[string]any{
+	s.wsHub.Publish(incidentTopics(ctx, s.db, &incident), "incident_update_received", map[string]any{
 		"incident_id": iid,
 		"update":      update,
 		"guard_id":    userID,
@@ -0,0 +1,507 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// List endpoints share one query model: keyset pagination over a stable
+// sort, multi-value filters, a created_at range, field selection and opt-in
+// relations. Each resource describes what it allows in a listSpec.
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+// ListQuery is a parsed list request. A filter matches when the column equals
+// any of its values; CreatedAfter is inclusive and CreatedBefore exclusive.
+type ListQuery struct {
+	Limit         int
+	Cursor        string
+	Sort          []SortField
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Filters       map[string][]string
+	Fields        []string
+	Expand        []string
+}
+
+// SortField is one key of a multi-field sort
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Page is one page of a list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+
+	// Data is Items as returned to clients: trimmed to the selected fields,
+	// without relations that were not expanded
+	Data any
+}
+
+type cursorKind int
+
+const (
+	cursorTime cursorKind = iota
+	cursorString
+	cursorInt
+)
+
+// listColumn is a sortable key: the SQL it sorts and compares on and how to
+// read the same value from a loaded row for the next cursor. Sorts are keyed
+// by the JSON name of the field they read.
+type listColumn[T any] struct {
+	expr  string
+	kind  cursorKind
+	value func(*T) any
+}
+
+type filterKind int
+
+const (
+	filterText filterKind = iota
+	filterUUID
+	filterBool
+)
+
+// listFilter is a multi-value filter; clause has one placeholder for the values
+type listFilter struct {
+	clause string
+	kind   filterKind
+}
+
+// listRelation is a relation that can be expanded, keyed by its JSON name
+type listRelation struct {
+	preload string
+	order   string
+}
+
+type listSpec[T any] struct {
+	table       string
+	id          func(*T) uuid.UUID
+	sorts       map[string]listColumn[T]
+	defaultSort []SortField
+	filters     map[string]listFilter
+	relations   map[string]listRelation
+}
+
+// listCursor is the position after the last row of a page, valid only for
+// the sort it was issued with
+type listCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func invalidListQuery(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidListQuery, fmt.Sprintf(format, args...))
+}
+
+// find applies q to query, which should already be scoped to what the caller
+// may see, and loads one page
+func (spec *listSpec[T]) find(query *gorm.DB, q ListQuery) (*Page[T], error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	sorts := q.Sort
+	if len(sorts) == 0 {
+		sorts = spec.defaultSort
+	}
+	columns := make([]listColumn[T], 0, len(sorts))
+	seen := map[string]bool{}
+	for _, sort := range sorts {
+		column, ok := spec.sorts[sort.Field]
+		if !ok {
+			return nil, invalidListQuery("cannot sort by %q", sort.Field)
+		}
+		if seen[sort.Field] {
+			return nil, invalidListQuery("%q is sorted on twice", sort.Field)
+		}
+		seen[sort.Field] = true
+		columns = append(columns, column)
+	}
+	// The id breaks ties so that every row has a unique position
+	idDesc := sorts[len(sorts)-1].Desc
+	idColumn := spec.table + ".id"
+
+	for name, values := range q.Filters {
+		filter, ok := spec.filters[name]
+		if !ok {
+			return nil, invalidListQuery("unknown filter %q", name)
+		}
+		args, err := filterValues(name, filter.kind, values)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(filter.clause, args)
+	}
+
+	if q.CreatedAfter != nil {
+		query = query.Where(spec.table+".created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where(spec.table+".created_at < ?", *q.CreatedBefore)
+	}
+	if q.CreatedAfter != nil && q.CreatedBefore != nil && !q.CreatedBefore.After(*q.CreatedAfter) {
+		return nil, invalidListQuery("created_before must be after created_after")
+	}
+
+	expanded := map[string]bool{}
+	for _, name := range q.Expand {
+		relation, ok := spec.relations[name]
+		if !ok {
+			return nil, invalidListQuery("cannot expand %q", name)
+		}
+		expanded[name] = true
+		if relation.order != "" {
+			order := relation.order
+			query = query.Preload(relation.preload, func(db *gorm.DB) *gorm.DB {
+				return db.Order(order)
+			})
+		} else {
+			query = query.Preload(relation.preload)
+		}
+	}
+
+	fields := jsonFields(reflect.TypeOf((*T)(nil)).Elem())
+	for _, field := range q.Fields {
+		if !fields[field] {
+			return nil, invalidListQuery("unknown field %q", field)
+		}
+	}
+	if len(q.Fields) > 0 {
+		selected, err := spec.selectColumns(query, q.Fields, sorts, q.Expand)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Select(selected)
+	}
+
+	sortKey := sortString(sorts)
+	if q.Cursor != "" {
+		values, err := decodeCursor(q.Cursor, sortKey, columns)
+		if err != nil {
+			return nil, err
+		}
+		clause, args := keysetClause(columns, sorts, idColumn, idDesc, values)
+		query = query.Where(clause, args...)
+	}
+
+	for i, column := range columns {
+		query = query.Order(column.expr + direction(sorts[i].Desc))
+	}
+	query = query.Order(idColumn + direction(idDesc))
+
+	var rows []T
+	if err := query.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	page := &Page[T]{Items: rows}
+	if len(rows) > limit {
+		page.Items = rows[:limit]
+		page.NextCursor = encodeCursor(sortKey, columns, spec.id, &page.Items[limit-1])
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	data, err := spec.project(page.Items, q.Fields, expanded)
+	if err != nil {
+		return nil, err
+	}
+	page.Data = data
+	return page, nil
+}
+
+var listSchemaCache sync.Map
+
+// selectColumns is what to load for the selected fields: their columns, the
+// id, the columns sorted on and the keys the expanded relations are loaded by.
+// Fields without a column, such as relations, are skipped.
+func (spec *listSpec[T]) selectColumns(query *gorm.DB, fields []string, sorts []SortField, expand []string) ([]string, error) {
+	sch, err := schema.Parse(new(T), &listSchemaCache, query.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	byJSON := map[string]string{}
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if name != "-" {
+			byJSON[name] = field.DBName
+		}
+	}
+
+	var selected []string
+	seen := map[string]bool{}
+	add := func(column string) {
+		if column != "" && !seen[column] {
+			seen[column] = true
+			selected = append(selected, spec.table+"."+column)
+		}
+	}
+	add("id")
+	for _, field := range fields {
+		add(byJSON[field])
+	}
+	for _, sort := range sorts {
+		add(byJSON[sort.Field])
+	}
+	for _, name := range expand {
+		preload, _, _ := strings.Cut(spec.relations[name].preload, ".")
+		relation, ok := sch.Relationships.Relations[preload]
+		if !ok {
+			continue
+		}
+		for _, ref := range relation.References {
+			if ref.OwnPrimaryKey {
+				add(ref.PrimaryKey.DBName)
+			} else if ref.ForeignKey.Schema == sch {
+				add(ref.ForeignKey.DBName)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// project trims rows to the selected fields, plus expanded relations, and
+// drops relations that were not expanded
+func (spec *listSpec[T]) project(rows []T, fields []string, expanded map[string]bool) ([]map[string]json.RawMessage, error) {
+	keep := map[string]bool{}
+	for _, field := range fields {
+		keep[field] = true
+	}
+
+	encoded, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &objects); err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		for key := range object {
+			if _, isRelation := spec.relations[key]; isRelation {
+				if !expanded[key] {
+					delete(object, key)
+				}
+				continue
+			}
+			if len(keep) > 0 && !keep[key] {
+				delete(object, key)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func filterValues(name string, kind filterKind, values []string) (any, error) {
+	switch kind {
+	case filterUUID:
+		ids := make([]uuid.UUID, 0, len(values))
+		for _, value := range values {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return nil, invalidListQuery("%s must be UUIDs", name)
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	case filterBool:
+		flags := make([]bool, 0, len(values))
+		for _, value := range values {
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, invalidListQuery("%s must be true or false", name)
+			}
+			flags = append(flags, flag)
+		}
+		return flags, nil
+	default:
+		return values, nil
+	}
+}
+
+// keysetClause selects the rows after values in the sort order. Mixed
+// directions rule out a row comparison, so it expands to
+// (a > x) OR (a = x AND b < y) OR ...
+func keysetClause[T any](columns []listColumn[T], sorts []SortField, idColumn string, idDesc bool, values []any) (string, []any) {
+	exprs := make([]string, 0, len(columns)+1)
+	descs := make([]bool, 0, len(columns)+1)
+	for i, column := range columns {
+		exprs = append(exprs, column.expr)
+		descs = append(descs, sorts[i].Desc)
+	}
+	exprs = append(exprs, idColumn)
+	descs = append(descs, idDesc)
+
+	var ors []string
+	var args []any
+	for i := range exprs {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, exprs[j]+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if descs[i] {
+			op = " < ?"
+		}
+		ands = append(ands, exprs[i]+op)
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func encodeCursor[T any](sortKey string, columns []listColumn[T], id func(*T) uuid.UUID, row *T) string {
+	cursor := listCursor{Sort: sortKey}
+	for _, column := range columns {
+		switch value := column.value(row).(type) {
+		case time.Time:
+			cursor.Values = append(cursor.Values, value.UTC().Format(time.RFC3339Nano))
+		case int:
+			cursor.Values = append(cursor.Values, strconv.Itoa(value))
+		default:
+			cursor.Values = append(cursor.Values, fmt.Sprint(value))
+		}
+	}
+	cursor.Values = append(cursor.Values, id(row).String())
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor[T any](raw, sortKey string, columns []listColumn[T]) ([]any, error) {
+	invalid := invalidListQuery("invalid cursor")
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalid
+	}
+	if cursor.Sort != sortKey {
+		return nil, invalidListQuery("cursor was issued for a different sort")
+	}
+	if len(cursor.Values) != len(columns)+1 {
+		return nil, invalid
+	}
+
+	values := make([]any, 0, len(cursor.Values))
+	for i, column := range columns {
+		raw := cursor.Values[i]
+		switch column.kind {
+		case cursorTime:
+			t, err := time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				return nil, invalid
+			}
+			values = append(values, t)
+		case cursorInt:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, invalid
+			}
+			values = append(values, n)
+		default:
+			values = append(values, raw)
+		}
+	}
+	id, err := uuid.Parse(cursor.Values[len(columns)])
+	if err != nil {
+		return nil, invalid
+	}
+	return append(values, id), nil
+}
+
+func sortString(sorts []SortField) string {
+	keys := make([]string, len(sorts))
+	for i, sort := range sorts {
+		keys[i] = sort.Field
+		if sort.Desc {
+			keys[i] = "-" + sort.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func direction(desc bool) string {
+	if desc {
+		return " DESC"
+	}
+	return " ASC"
+}
+
+var jsonFieldCache sync.Map
+
+// jsonFields is the set of top-level JSON keys of a struct type
+func jsonFields(t reflect.Type) map[string]bool {
+	if cached, ok := jsonFieldCache.Load(t); ok {
+		return cached.(map[string]bool)
+	}
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = true
+	}
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// severityRankSQL orders alert severities from low to critical
+func severityRankSQL(column string) string {
+	return "CASE " + column + " WHEN 'critical' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END"
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type testListRow struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Priority  int       `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"-"`
+	Camera    *struct{} `json:"camera,omitempty"`
+}
+
+var testListSpec = listSpec[testListRow]{
+	table: "rows",
+	id:    func(r *testListRow) uuid.UUID { return r.ID },
+	sorts: map[string]listColumn[testListRow]{
+		"created_at": {expr: "rows.created_at", kind: cursorTime, value: func(r *testListRow) any { return r.CreatedAt }},
+		"name":       {expr: "rows.name", kind: cursorString, value: func(r *testListRow) any { return r.Name }},
+		"priority":   {expr: "rows.priority", kind: cursorInt, value: func(r *testListRow) any { return r.Priority }},
+	},
+	relations: map[string]listRelation{"camera": {preload: "Camera"}},
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	sorts := []SortField{{Field: "created_at", Desc: true}, {Field: "name"}, {Field: "priority"}}
+	columns := []listColumn[testListRow]{testListSpec.sorts["created_at"], testListSpec.sorts["name"], testListSpec.sorts["priority"]}
+	row := testListRow{
+		ID:        uuid.New(),
+		Name:      "Gate, north",
+		Priority:  3,
+		CreatedAt: time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.FixedZone("CET", 3600)),
+	}
+	sortKey := sortString(sorts)
+	if sortKey != "-created_at,name,priority" {
+		t.Errorf("sortString = %q", sortKey)
+	}
+
+	cursor := encodeCursor(sortKey, columns, testListSpec.id, &row)
+	values, err := decodeCursor(cursor, sortKey, columns)
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if len(values) != 4 || !values[0].(time.Time).Equal(row.CreatedAt) || values[1] != row.Name || values[2] != row.Priority || values[3] != row.ID {
+		t.Errorf("decoded %v from %+v", values, row)
+	}
+
+	if _, err := decodeCursor(cursor, "name", columns[1:2]); !errors.Is(err, ErrInvalidListQuery) || !strings.Contains(err.Error(), "different sort") {
+		t.Errorf("decodeCursor for another sort = %v", err)
+	}
+	for _, raw := range []string{"not base64!", "bm90IGpzb24", encodeCursor(sortKey, columns[:1], testListSpec.id, &row)} {
+		if _, err := decodeCursor(raw, sortKey, columns); !errors.Is(err, ErrInvalidListQuery) {
+			t.Errorf("decodeCursor(%q) = %v, want ErrInvalidListQuery", raw, err)
+		}
+	}
+}
+
+func TestKeysetClause(t *testing.T) {
+	columns := []listColumn[testListRow]{testListSpec.sorts["priority"], testListSpec.sorts["name"]}
+	sorts := []SortField{{Field: "priority", Desc: true}, {Field: "name"}}
+	id := uuid.New()
+	clause, args := keysetClause(columns, sorts, "rows.id", false, []any{3, "Gate", id})
+
+	want := "((rows.priority < ?) OR (rows.priority = ? AND rows.name > ?) OR (rows.priority = ? AND rows.name = ? AND rows.id > ?))"
+	if clause != want {
+		t.Errorf("keysetClause = %s, want %s", clause, want)
+	}
+	if wantArgs := []any{3, 3, "Gate", 3, "Gate", id}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("keysetClause args = %v, want %v", args, wantArgs)
+	}
+}
+
+func TestFilterValues(t *testing.T) {
+	id := uuid.New()
+	for _, tt := range []struct {
+		kind   filterKind
+		values []string
+		want   any
+		ok     bool
+	}{
+		{filterText, []string{"open", "closed"}, []string{"open", "closed"}, true},
+		{filterUUID, []string{id.String()}, []uuid.UUID{id}, true},
+		{filterUUID, []string{id.String(), "camera-1"}, nil, false},
+		{filterBool, []string{"true", "0"}, []bool{true, false}, true},
+		{filterBool, []string{"yes"}, nil, false},
+	} {
+		got, err := filterValues("f", tt.kind, tt.values)
+		if tt.ok && (err != nil || !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("filterValues(%d, %q) = %v, %v, want %v", tt.kind, tt.values, got, err, tt.want)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidListQuery) {
+			t.Errorf("filterValues(%d, %q) = %v, want ErrInvalidListQuery", tt.kind, tt.values, err)
+		}
+	}
+}
+
+func TestFindRejectsBadSorts(t *testing.T) {
+	for _, sorts := range [][]SortField{
+		{{Field: "password"}},
+		{{Field: "name"}, {Field: "name", Desc: true}},
+	} {
+		if _, err := testListSpec.find(nil, ListQuery{Sort: sorts}); !errors.Is(err, ErrInvalidListQuery) {
+			t.Errorf("find sorted by %v = %v, want ErrInvalidListQuery", sorts, err)
+		}
+	}
+}
+
+func TestProjectKeepsSelectedFieldsAndExpandedRelations(t *testing.T) {
+	rows := []testListRow{{ID: uuid.New(), Name: "Gate", Camera: &struct{}{}}}
+
+	objects, err := testListSpec.project(rows, []string{"id", "name"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects[0]) != 2 || objects[0]["id"] == nil || objects[0]["name"] == nil {
+		t.Errorf("projected to %v, want id and name", objects[0])
+	}
+
+	objects, err = testListSpec.project(rows, []string{"name"}, map[string]bool{"camera": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects[0]) != 2 || objects[0]["camera"] == nil {
+		t.Errorf("projected to %v, want name and the expanded camera", objects[0])
+	}
+
+	if fields := jsonFields(reflect.TypeOf(testListRow{})); len(fields) != 5 || fields["Secret"] || !fields["created_at"] {
+		t.Errorf("jsonFields = %v", fields)
+	}
+}
+
+func TestSelectColumnsKeepsKeysForSortsAndRelations(t *testing.T) {
+	db := dryRunDB(t)
+	selected, err := alertListSpec.selectColumns(db, []string{"title", "camera", "downgraded_from"},
+		[]SortField{{Field: "severity", Desc: true}}, []string{"camera", "incident"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"alerts.id", "alerts.title", "alerts.downgraded_from", "alerts.severity", "alerts.camera_id"}
+	if !slices.Equal(selected, want) {
+		t.Errorf("selectColumns = %v, want %v", selected, want)
+	}
+
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&models.Alert{}).Select(selected).Find(&[]models.Alert{})
+	})
+	if !strings.HasPrefix(sql, "SELECT alerts.id,alerts.title,alerts.downgraded_from,alerts.severity,alerts.camera_id FROM") {
+		t.Errorf("SQL = %s", sql)
+	}
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/cron"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// maxMaintenanceDuration bounds each occurrence of a recurring window
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+	ErrAlertSuppressed          = errors.New("alert suppressed")
+)
+
+// AlertSuppressedError is returned by CreateAlert for an alert raised in a
+// maintenance window or discarded for coming from a disarmed area, with the
+// record kept of it
+type AlertSuppressedError struct {
+	Suppressed *models.SuppressedAlert
+}
+
+func (e *AlertSuppressedError) Error() string {
+	if e.Suppressed.Cause == models.SuppressedByDisarmed {
+		return "alert discarded: area is disarmed"
+	}
+	return fmt.Sprintf("alert suppressed by maintenance window %q", e.Suppressed.WindowName)
+}
+
+func (e *AlertSuppressedError) Is(target error) bool { return target == ErrAlertSuppressed }
+
+// unsuppressedAlertTypes are about a guard's safety and are raised whatever
+// maintenance is going on
+var unsuppressedAlertTypes = map[models.AlertType]bool{
+	models.AlertTypeGuardDistress: true,
+	models.AlertTypeMissedCheckIn: true,
+}
+
+var suppressibleAlertTypes = map[models.AlertType]bool{
+	models.AlertTypeUnauthorizedAccess: true,
+	models.AlertTypeSuspiciousActivity: true,
+	models.AlertTypeEquipmentDamage:    true,
+	models.AlertTypeSystemFailure:      true,
+	models.AlertTypePatrolLate:         true,
+	models.AlertTypePatrolMissed:       true,
+}
+
+// MaintenanceWindowInput creates or replaces a window. Leaving Recurrence
+// empty makes a one-off window.
+type MaintenanceWindowInput struct {
+	Name            string
+	Reason          string
+	PremiseID       *uuid.UUID // defaults to the camera's premise
+	CameraID        *uuid.UUID
+	StartsAt        *time.Time // defaults to now
+	EndsAt          *time.Time
+	Recurrence      string
+	DurationMinutes int
+	Timezone        string
+	Rules           []SuppressionRuleInput
+}
+
+// SuppressionRuleInput is one rule of a window; empty lists match anything
+type SuppressionRuleInput struct {
+	AlertTypes []string
+	Severities []string
+	CameraIDs  []string
+}
+
+// MaintenanceWindowFilter narrows ListWindows. ActiveAt keeps the windows
+// suppressing alerts at that time.
+type MaintenanceWindowFilter struct {
+	PremiseID *uuid.UUID
+	CameraID  *uuid.UUID
+	ActiveAt  *time.Time
+}
+
+// CameraMaintenance is what to do about a window when a camera is put into
+// maintenance. Nil fields take the service's defaults; a duration of 0 keeps
+// the window open until the camera is back in service.
+type CameraMaintenance struct {
+	OpenWindow      *bool
+	DurationMinutes *int
+	Reason          string
+}
+
+// MaintenanceOptions are the defaults for camera maintenance windows
+type MaintenanceOptions struct {
+	CameraAutoWindow bool
+	CameraWindow     time.Duration
+}
+
+// MaintenanceService manages maintenance windows and records the alerts they
+// suppress
+type MaintenanceService interface {
+	ListWindows(ctx context.Context, filter MaintenanceWindowFilter) ([]models.MaintenanceWindow, error)
+	GetWindow(ctx context.Context, id uuid.UUID) (*models.MaintenanceWindow, error)
+	CreateWindow(ctx context.Context, input MaintenanceWindowInput, userID string) (*models.MaintenanceWindow, error)
+	UpdateWindow(ctx context.Context, id uuid.UUID, input MaintenanceWindowInput, userID string) (*models.MaintenanceWindow, error)
+	// EndWindow ends a window now, including any occurrence under way
+	EndWindow(ctx context.Context, id uuid.UUID, userID string) (*models.MaintenanceWindow, error)
+	DeleteWindow(ctx context.Context, id uuid.UUID, userID string) error
+
+	// Suppress records the alert as suppressed if a window covers it at the
+	// time, and returns nil otherwise
+	Suppress(ctx context.Context, alert *models.Alert, at time.Time) (*models.SuppressedAlert, error)
+	ListSuppressed(ctx context.Context, q ListQuery) (*Page[models.SuppressedAlert], error)
+
+	// CameraStatusChanged opens an automatic window for a camera put into
+	// maintenance and ends it when the camera is back in another status
+	CameraStatusChanged(ctx context.Context, camera *models.Camera, maintenance CameraMaintenance, userID string) error
+}
+
+var suppressedAlertListSpec = &listSpec[models.SuppressedAlert]{
+	table: "suppressed_alerts",
+	id:    func(a *models.SuppressedAlert) uuid.UUID { return a.ID },
+	sorts: map[string]listColumn[models.SuppressedAlert]{
+		"created_at": {expr: "suppressed_alerts.created_at", kind: cursorTime, value: func(a *models.SuppressedAlert) any { return a.CreatedAt }},
+		"severity":   {expr: severityRankSQL("suppressed_alerts.severity"), kind: cursorInt, value: func(a *models.SuppressedAlert) any { return severityRank(string(a.Severity)) }},
+		"type":       {expr: "suppressed_alerts.type", kind: cursorString, value: func(a *models.SuppressedAlert) any { return string(a.Type) }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"cause":      {clause: "suppressed_alerts.cause IN ?"},
+		"type":       {clause: "suppressed_alerts.type IN ?"},
+		"severity":   {clause: "suppressed_alerts.severity IN ?"},
+		"premise_id": {clause: "suppressed_alerts.premise_id IN ?", kind: filterUUID},
+		"camera_id":  {clause: "suppressed_alerts.camera_id IN ?", kind: filterUUID},
+		"window_id":  {clause: "suppressed_alerts.window_id IN ?", kind: filterUUID},
+	},
+	relations: map[string]listRelation{
+		"premise": {preload: "Premise"},
+		"camera":  {preload: "Camera"},
+		"window":  {preload: "Window"},
+	},
+}
+
+type maintenanceService struct {
+	db    *gorm.DB
+	audit AuditService
+	opts  MaintenanceOptions
+}
+
+func NewMaintenanceService(db *gorm.DB, audit AuditService, opts MaintenanceOptions) MaintenanceService {
+	return &maintenanceService{db: db, audit: audit, opts: opts}
+}
+
+func (s *maintenanceService) ListWindows(ctx context.Context, filter MaintenanceWindowFilter) ([]models.MaintenanceWindow, error) {
+	query := s.db.WithContext(ctx).Preload("Rules")
+	if filter.PremiseID != nil {
+		query = query.Where("premise_id = ?", *filter.PremiseID)
+	}
+	if filter.CameraID != nil {
+		query = query.Where("camera_id = ?", *filter.CameraID)
+	}
+	if filter.ActiveAt != nil {
+		query = query.Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", *filter.ActiveAt, *filter.ActiveAt)
+	}
+
+	var windows []models.MaintenanceWindow
+	if err := query.Order("starts_at DESC").Find(&windows).Error; err != nil {
+		return nil, err
+	}
+	if filter.ActiveAt == nil {
+		return windows, nil
+	}
+	active := windows[:0]
+	for _, window := range windows {
+		if windowOpen(&window, *filter.ActiveAt) {
+			active = append(active, window)
+		}
+	}
+	return active, nil
+}
+
+func (s *maintenanceService) GetWindow(ctx context.Context, id uuid.UUID) (*models.MaintenanceWindow, error) {
+	var window models.MaintenanceWindow
+	if err := s.db.WithContext(ctx).Preload("Rules").Preload("Premise").Preload("Camera").
+		First(&window, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func (s *maintenanceService) CreateWindow(ctx context.Context, input MaintenanceWindowInput, userID string) (window *models.MaintenanceWindow, err error) {
+	defer func() {
+		resourceID := ""
+		if window != nil {
+			resourceID = window.ID.String()
+		}
+		recordAction(ctx, s.audit, "maintenance_window.create", "maintenance_window", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	window = &models.MaintenanceWindow{CreatedByID: requester(userID)}
+	if err := s.applyInput(ctx, window, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(window).Error; err != nil {
+		return nil, err
+	}
+	return s.GetWindow(ctx, window.ID)
+}
+
+func (s *maintenanceService) UpdateWindow(ctx context.Context, id uuid.UUID, input MaintenanceWindowInput, userID string) (window *models.MaintenanceWindow, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "maintenance_window.update", "maintenance_window", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	window, err = s.GetWindow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyInput(ctx, window, input); err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("window_id = ?", id).Delete(&models.SuppressionRule{}).Error; err != nil {
+			return err
+		}
+		rules := window.Rules
+		window.Premise, window.Camera, window.Rules = nil, nil, nil
+		if err := tx.Save(window).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			rules[i].ID = uuid.Nil
+			rules[i].WindowID = id
+		}
+		if len(rules) > 0 {
+			return tx.Create(&rules).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWindow(ctx, id)
+}
+
+func (s *maintenanceService) EndWindow(ctx context.Context, id uuid.UUID, userID string) (window *models.MaintenanceWindow, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "maintenance_window.end", "maintenance_window", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&models.MaintenanceWindow{}).
+		Where("id = ? AND (ends_at IS NULL OR ends_at > ?)", id, now).
+		Update("ends_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return s.GetWindow(ctx, id)
+}
+
+func (s *maintenanceService) DeleteWindow(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "maintenance_window.delete", "maintenance_window", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	// Suppressed alerts stay on record under the window's name
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SuppressedAlert{}).Where("window_id = ?", id).
+			Updates(map[string]any{"window_id": nil, "rule_id": nil}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("window_id = ?", id).Delete(&models.SuppressionRule{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.MaintenanceWindow{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (s *maintenanceService) Suppress(ctx context.Context, alert *models.Alert, at time.Time) (*models.SuppressedAlert, error) {
+	if unsuppressedAlertTypes[alert.Type] {
+		return nil, nil
+	}
+
+	// Camera windows only cover alerts from their camera
+	query := s.db.WithContext(ctx).Preload("Rules").
+		Where("premise_id = ? AND starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", alert.PremiseID, at, at)
+	if alert.CameraID != nil {
+		query = query.Where("camera_id IS NULL OR camera_id = ?", *alert.CameraID)
+	} else {
+		query = query.Where("camera_id IS NULL")
+	}
+	var windows []models.MaintenanceWindow
+	if err := query.Order("starts_at").Find(&windows).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range windows {
+		window := &windows[i]
+		if !windowOpen(window, at) {
+			continue
+		}
+		rule, ok := matchRules(window.Rules, alert)
+		if !ok {
+			continue
+		}
+		suppressed := models.SuppressedAlert{
+			Cause:       models.SuppressedByMaintenance,
+			Type:        alert.Type,
+			Severity:    alert.Severity,
+			Title:       alert.Title,
+			Description: alert.Description,
+			Location:    alert.Location,
+			PremiseID:   alert.PremiseID,
+			CameraID:    alert.CameraID,
+			ZoneID:      alert.ZoneID,
+			WindowID:    &window.ID,
+			WindowName:  window.Name,
+			CreatedAt:   at,
+		}
+		if rule != nil {
+			suppressed.RuleID = &rule.ID
+		}
+		if err := s.db.WithContext(ctx).Create(&suppressed).Error; err != nil {
+			return nil, err
+		}
+		return &suppressed, nil
+	}
+	return nil, nil
+}
+
+func (s *maintenanceService) ListSuppressed(ctx context.Context, q ListQuery) (*Page[models.SuppressedAlert], error) {
+	return suppressedAlertListSpec.find(s.db.WithContext(ctx).Model(&models.SuppressedAlert{}), q)
+}
+
+func (s *maintenanceService) CameraStatusChanged(ctx context.Context, camera *models.Camera, maintenance CameraMaintenance, userID string) error {
+	now := time.Now()
+	if camera.Status != models.CameraStatusMaintenance {
+		result := s.db.WithContext(ctx).Model(&models.MaintenanceWindow{}).
+			Where("camera_id = ? AND automatic AND (ends_at IS NULL OR ends_at > ?)", camera.ID, now).
+			Update("ends_at", now)
+		if result.Error == nil && result.RowsAffected > 0 {
+			recordAction(ctx, s.audit, "maintenance_window.end", "camera", camera.ID.String(), userID, models.RoleSCSOperator, nil,
+				models.JSONMap{"camera_status": string(camera.Status)})
+		}
+		return result.Error
+	}
+
+	open := s.opts.CameraAutoWindow
+	if maintenance.OpenWindow != nil {
+		open = *maintenance.OpenWindow
+	}
+	if !open {
+		return nil
+	}
+	var existing int64
+	if err := s.db.WithContext(ctx).Model(&models.MaintenanceWindow{}).
+		Where("camera_id = ? AND automatic AND (ends_at IS NULL OR ends_at > ?)", camera.ID, now).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	duration := s.opts.CameraWindow
+	if maintenance.DurationMinutes != nil {
+		duration = time.Duration(*maintenance.DurationMinutes) * time.Minute
+	}
+	window := models.MaintenanceWindow{
+		Name:        fmt.Sprintf("Camera maintenance: %s", camera.Name),
+		Reason:      maintenance.Reason,
+		PremiseID:   camera.PremiseID,
+		CameraID:    &camera.ID,
+		StartsAt:    now,
+		Timezone:    "UTC",
+		Automatic:   true,
+		CreatedByID: requester(userID),
+	}
+	if duration > 0 {
+		ends := now.Add(duration)
+		window.EndsAt = &ends
+	}
+	err := s.db.WithContext(ctx).Create(&window).Error
+	recordAction(ctx, s.audit, "maintenance_window.create", "maintenance_window", window.ID.String(), userID, models.RoleSCSOperator, err,
+		models.JSONMap{"camera_id": camera.ID.String(), "automatic": true})
+	if err != nil {
+		log.Printf("Failed to open maintenance window for camera %s: %v", camera.ID, err)
+	}
+	return err
+}
+
+// applyInput validates the input into the window, replacing its rules
+func (s *maintenanceService) applyInput(ctx context.Context, window *models.MaintenanceWindow, input MaintenanceWindowInput) error {
+	window.Name = strings.TrimSpace(input.Name)
+	if window.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidMaintenanceWindow)
+	}
+	window.Reason = strings.TrimSpace(input.Reason)
+
+	if input.CameraID == nil && input.PremiseID == nil {
+		return fmt.Errorf("%w: premise_id or camera_id is required", ErrInvalidMaintenanceWindow)
+	}
+	window.CameraID = input.CameraID
+	if input.CameraID != nil {
+		var camera models.Camera
+		if err := s.db.WithContext(ctx).First(&camera, "id = ?", *input.CameraID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: unknown camera", ErrInvalidMaintenanceWindow)
+			}
+			return err
+		}
+		if input.PremiseID != nil && *input.PremiseID != camera.PremiseID {
+			return fmt.Errorf("%w: camera is not at the premise", ErrInvalidMaintenanceWindow)
+		}
+		window.PremiseID = camera.PremiseID
+	} else {
+		var found int64
+		if err := s.db.WithContext(ctx).Model(&models.Premise{}).Where("id = ?", *input.PremiseID).Count(&found).Error; err != nil {
+			return err
+		}
+		if found == 0 {
+			return fmt.Errorf("%w: unknown premise", ErrInvalidMaintenanceWindow)
+		}
+		window.PremiseID = *input.PremiseID
+	}
+
+	window.Timezone = input.Timezone
+	if window.Timezone == "" {
+		window.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(window.Timezone); err != nil || window.Timezone == "Local" {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidMaintenanceWindow, window.Timezone)
+	}
+
+	// A window being replaced keeps its start unless a new one is given
+	if input.StartsAt != nil {
+		window.StartsAt = *input.StartsAt
+	} else if window.StartsAt.IsZero() {
+		window.StartsAt = time.Now()
+	}
+	window.EndsAt = input.EndsAt
+	if window.EndsAt != nil && !window.EndsAt.After(window.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidMaintenanceWindow)
+	}
+
+	window.Recurrence = strings.TrimSpace(input.Recurrence)
+	window.DurationMinutes = 0
+	if window.Recurrence != "" {
+		if _, err := cron.Parse(window.Recurrence); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMaintenanceWindow, err)
+		}
+		duration := time.Duration(input.DurationMinutes) * time.Minute
+		if duration <= 0 || duration > maxMaintenanceDuration {
+			return fmt.Errorf("%w: a recurring window needs duration_minutes between 1 and %d", ErrInvalidMaintenanceWindow, int(maxMaintenanceDuration/time.Minute))
+		}
+		window.DurationMinutes = input.DurationMinutes
+	}
+
+	rules := make([]models.SuppressionRule, 0, len(input.Rules))
+	for _, in := range input.Rules {
+		rule := models.SuppressionRule{AlertTypes: pq.StringArray{}, Severities: pq.StringArray{}, CameraIDs: pq.StringArray{}}
+		for _, alertType := range in.AlertTypes {
+			if !suppressibleAlertTypes[models.AlertType(alertType)] {
+				return fmt.Errorf("%w: alert type %q cannot be suppressed", ErrInvalidMaintenanceWindow, alertType)
+			}
+			rule.AlertTypes = append(rule.AlertTypes, alertType)
+		}
+		for _, severity := range in.Severities {
+			if severityRank(severity) == 0 {
+				return fmt.Errorf("%w: unknown severity %q", ErrInvalidMaintenanceWindow, severity)
+			}
+			rule.Severities = append(rule.Severities, severity)
+		}
+		for _, raw := range in.CameraIDs {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return fmt.Errorf("%w: invalid camera id %q", ErrInvalidMaintenanceWindow, raw)
+			}
+			rule.CameraIDs = append(rule.CameraIDs, id.String())
+		}
+		if len(rule.CameraIDs) > 0 {
+			var found int64
+			if err := s.db.WithContext(ctx).Model(&models.Camera{}).
+				Where("id IN ? AND premise_id = ?", []string(rule.CameraIDs), window.PremiseID).Count(&found).Error; err != nil {
+				return err
+			}
+			if int(found) != len(rule.CameraIDs) {
+				return fmt.Errorf("%w: rule cameras must be at the window's premise", ErrInvalidMaintenanceWindow)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	window.Rules = rules
+	return nil
+}
+
+// windowOpen reports whether the window suppresses alerts at t
+func windowOpen(window *models.MaintenanceWindow, t time.Time) bool {
+	if t.Before(window.StartsAt) || (window.EndsAt != nil && !t.Before(*window.EndsAt)) {
+		return false
+	}
+	if window.Recurrence == "" {
+		return true
+	}
+	expr, err := cron.Parse(window.Recurrence)
+	if err != nil {
+		return false
+	}
+	loc, err := time.LoadLocation(window.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	// An occurrence is under way if one started within the last duration
+	duration := time.Duration(window.DurationMinutes) * time.Minute
+	start := expr.Next(t.In(loc).Add(-duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// matchRules returns the first rule the alert matches. A window without
+// rules matches every alert, with no rule to show for it.
+func matchRules(rules []models.SuppressionRule, alert *models.Alert) (*models.SuppressionRule, bool) {
+	if len(rules) == 0 {
+		return nil, true
+	}
+	camera := ""
+	if alert.CameraID != nil {
+		camera = alert.CameraID.String()
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if matchesAny(rule.AlertTypes, string(alert.Type)) &&
+			matchesAny(rule.Severities, string(alert.Severity)) &&
+			matchesAny(rule.CameraIDs, camera) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// matchesAny reports whether value is in values, or values is empty
+func matchesAny(values pq.StringArray, value string) bool {
+	return len(values) == 0 || slices.Contains(values, value)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestWindowOpen(t *testing.T) {
+	starts := testTime(t, "2026-03-01T00:00:00Z")
+	ends := testTime(t, "2026-04-01T00:00:00Z")
+	oneOff := &models.MaintenanceWindow{StartsAt: starts, EndsAt: &ends}
+	// Saturdays from 22:00 to midnight in Berlin, which is 21:00 to 23:00 UTC in March
+	weekly := &models.MaintenanceWindow{StartsAt: starts, EndsAt: &ends, Recurrence: "0 22 * * SAT", DurationMinutes: 120, Timezone: "Europe/Berlin"}
+
+	for _, tt := range []struct {
+		name   string
+		window *models.MaintenanceWindow
+		at     string
+		open   bool
+	}{
+		{"before a one-off window", oneOff, "2026-02-28T23:59:59Z", false},
+		{"at the start of a one-off window", oneOff, "2026-03-01T00:00:00Z", true},
+		{"at the end of a one-off window", oneOff, "2026-04-01T00:00:00Z", false},
+		{"before an occurrence", weekly, "2026-03-07T20:59:00Z", false},
+		{"at the start of an occurrence", weekly, "2026-03-07T21:00:00Z", true},
+		{"during an occurrence", weekly, "2026-03-07T22:59:00Z", true},
+		{"at the end of an occurrence", weekly, "2026-03-07T23:00:00Z", false},
+		{"on another day", weekly, "2026-03-08T21:30:00Z", false},
+		{"an occurrence after the window ends", weekly, "2026-04-04T20:30:00Z", false},
+	} {
+		if got := windowOpen(tt.window, testTime(t, tt.at)); got != tt.open {
+			t.Errorf("%s: windowOpen at %s = %v, want %v", tt.name, tt.at, got, tt.open)
+		}
+	}
+
+	endless := &models.MaintenanceWindow{StartsAt: starts}
+	if !windowOpen(endless, starts.AddDate(5, 0, 0)) {
+		t.Error("window without an end closed")
+	}
+	broken := &models.MaintenanceWindow{StartsAt: starts, Recurrence: "every saturday", DurationMinutes: 60}
+	if windowOpen(broken, starts.Add(time.Hour)) {
+		t.Error("window with an unreadable recurrence is open")
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	camera, other := uuid.New(), uuid.New()
+	alert := &models.Alert{Type: models.AlertTypeSystemFailure, Severity: models.AlertSeverityLow, CameraID: &camera}
+
+	if rule, ok := matchRules(nil, alert); !ok || rule != nil {
+		t.Errorf("window without rules: %v, %v, want a match without a rule", rule, ok)
+	}
+
+	rules := []models.SuppressionRule{
+		{ID: uuid.New(), AlertTypes: pq.StringArray{string(models.AlertTypeUnauthorizedAccess)}},
+		{ID: uuid.New(), Severities: pq.StringArray{"low", "medium"}, CameraIDs: pq.StringArray{camera.String()}},
+		{ID: uuid.New()},
+	}
+	if rule, ok := matchRules(rules, alert); !ok || rule.ID != rules[1].ID {
+		t.Errorf("matched %v, %v, want the second rule", rule, ok)
+	}
+	if rule, ok := matchRules(rules[:2], &models.Alert{Type: models.AlertTypeSystemFailure, Severity: models.AlertSeverityLow, CameraID: &other}); ok {
+		t.Errorf("alert from another camera matched %v", rule)
+	}
+	if rule, ok := matchRules(rules[:2], &models.Alert{Type: models.AlertTypeSystemFailure, Severity: models.AlertSeverityLow}); ok {
+		t.Errorf("alert without a camera matched the camera rule %v", rule)
+	}
+	if rule, ok := matchRules(rules[:2], &models.Alert{Type: models.AlertTypeSystemFailure, Severity: models.AlertSeverityHigh, CameraID: &camera}); ok {
+		t.Errorf("high alert matched the low and medium rule %v", rule)
+	}
+}
+
+func TestGuardSafetyAlertsAreNeverSuppressed(t *testing.T) {
+	s := NewMaintenanceService(nil, nil, MaintenanceOptions{})
+	for _, alertType := range []models.AlertType{models.AlertTypeGuardDistress, models.AlertTypeMissedCheckIn} {
+		if suppressed, err := s.Suppress(context.Background(), &models.Alert{Type: alertType}, time.Now()); suppressed != nil || err != nil {
+			t.Errorf("Suppress(%s) = %v, %v", alertType, suppressed, err)
+		}
+	}
+}
+
+func TestApplyInputNeedsANameAndAPlace(t *testing.T) {
+	s := &maintenanceService{}
+	for _, input := range []MaintenanceWindowInput{
+		{Name: "  "},
+		{Name: "Lens cleaning"},
+	} {
+		if err := s.applyInput(context.Background(), &models.MaintenanceWindow{}, input); !errors.Is(err, ErrInvalidMaintenanceWindow) {
+			t.Errorf("applyInput(%+v) = %v, want ErrInvalidMaintenanceWindow", input, err)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/geojson"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Map layers
+const (
+	MapLayerPremises = "premises"
+	MapLayerCameras  = "cameras"
+	MapLayerAlerts   = "alerts"
+	MapLayerGuards   = "guards"
+)
+
+// MapLayers lists every layer served by the map feed
+var MapLayers = []string{MapLayerPremises, MapLayerCameras, MapLayerAlerts, MapLayerGuards}
+
+// Map diff operations
+const (
+	MapOpUpsert = "upsert"
+	MapOpRemove = "remove"
+)
+
+var ErrInvalidCoordinates = errors.New("latitude must be within [-90,90] and longitude within [-180,180]")
+
+// MapFeed holds one feature collection per requested layer
+type MapFeed map[string]geojson.FeatureCollection
+
+// MapDiff is pushed over the websocket whenever a map feature changes
+type MapDiff struct {
+	Layer   string           `json:"layer"`
+	Op      string           `json:"op"`
+	ID      string           `json:"id"`
+	Feature *geojson.Feature `json:"feature,omitempty"`
+}
+
+// GuardFix is a position reported by a guard's device
+type GuardFix struct {
+	Latitude   float64
+	Longitude  float64
+	Accuracy   *float64
+	Heading    *float64
+	RecordedAt time.Time
+}
+
+// MapService serves the geospatial view of premises, cameras, alerts and guards
+type MapService interface {
+	GetMap(ctx context.Context, bbox *geojson.BBox, layers []string) (MapFeed, error)
+	SetPremiseLocation(ctx context.Context, premiseID uuid.UUID, lat, lon float64) (*models.Premise, error)
+	SetCameraLocation(ctx context.Context, cameraID uuid.UUID, lat, lon *float64) (*models.Camera, error)
+	UpdateGuardLocation(ctx context.Context, guardID uuid.UUID, fix GuardFix) (*models.GuardLocation, error)
+	SetOnDuty(ctx context.Context, guardID uuid.UUID, onDuty bool) (*models.User, error)
+}
+
+type mapService struct {
+	db   *gorm.DB
+	diff *mapPublisher
+}
+
+func NewMapService(db *gorm.DB, wsHub *websocket.Hub) MapService {
+	return &mapService{db: db, diff: newMapPublisher(db, wsHub)}
+}
+
+// GetMap returns the requested layers, limited to bbox when given
+func (s *mapService) GetMap(ctx context.Context, bbox *geojson.BBox, layers []string) (MapFeed, error) {
+	if len(layers) == 0 {
+		layers = MapLayers
+	}
+	feed := MapFeed{}
+	for _, layer := range layers {
+		var features []geojson.Feature
+		var err error
+		switch layer {
+		case MapLayerPremises:
+			features, err = s.premiseFeatures(ctx, bbox)
+		case MapLayerCameras:
+			features, err = s.cameraFeatures(ctx, bbox)
+		case MapLayerAlerts:
+			features, err = s.alertFeatures(ctx, bbox)
+		case MapLayerGuards:
+			features, err = s.guardFeatures(ctx, bbox)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		feed[layer] = geojson.NewFeatureCollection(features)
+	}
+	return feed, nil
+}
+
+func (s *mapService) SetPremiseLocation(ctx context.Context, premiseID uuid.UUID, lat, lon float64) (*models.Premise, error) {
+	if !validCoordinates(lat, lon) {
+		return nil, ErrInvalidCoordinates
+	}
+	var premise models.Premise
+	if err := s.db.WithContext(ctx).First(&premise, "id = ?", premiseID).Error; err != nil {
+		return nil, err
+	}
+	premise.Latitude = &lat
+	premise.Longitude = &lon
+	if err := s.db.WithContext(ctx).Save(&premise).Error; err != nil {
+		return nil, err
+	}
+
+	s.diff.premise(&premise)
+	// Cameras without their own position move with the premise
+	var cameras []models.Camera
+	if err := s.db.WithContext(ctx).Preload("Premise").
+		Where("premise_id = ? AND (latitude IS NULL OR longitude IS NULL)", premiseID).
+		Find(&cameras).Error; err == nil {
+		for i := range cameras {
+			s.diff.camera(&cameras[i])
+		}
+	}
+	return &premise, nil
+}
+
+// SetCameraLocation sets or, with nil coordinates, clears a camera's own position
+func (s *mapService) SetCameraLocation(ctx context.Context, cameraID uuid.UUID, lat, lon *float64) (*models.Camera, error) {
+	if (lat == nil) != (lon == nil) || (lat != nil && !validCoordinates(*lat, *lon)) {
+		return nil, ErrInvalidCoordinates
+	}
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).Preload("Premise").First(&camera, "id = ?", cameraID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(&camera).Updates(map[string]any{
+		"latitude":  lat,
+		"longitude": lon,
+	}).Error; err != nil {
+		return nil, err
+	}
+	camera.Latitude = lat
+	camera.Longitude = lon
+
+	s.diff.camera(&camera)
+	return &camera, nil
+}
+
+// UpdateGuardLocation stores the latest fix of a guard; it only shows on the
+// map while the guard is on duty
+func (s *mapService) UpdateGuardLocation(ctx context.Context, guardID uuid.UUID, fix GuardFix) (*models.GuardLocation, error) {
+	if !validCoordinates(fix.Latitude, fix.Longitude) {
+		return nil, ErrInvalidCoordinates
+	}
+	var guard models.User
+	if err := s.db.WithContext(ctx).First(&guard, "id = ? AND role = ?", guardID, models.RoleSecurityGuard).Error; err != nil {
+		return nil, err
+	}
+	if fix.RecordedAt.IsZero() || fix.RecordedAt.After(time.Now()) {
+		fix.RecordedAt = time.Now()
+	}
+
+	location := models.GuardLocation{
+		GuardID:    guardID,
+		Latitude:   fix.Latitude,
+		Longitude:  fix.Longitude,
+		Accuracy:   fix.Accuracy,
+		Heading:    fix.Heading,
+		RecordedAt: fix.RecordedAt,
+	}
+	// Out-of-order fixes never overwrite a newer position
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "guard_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"latitude", "longitude", "accuracy", "heading", "recorded_at", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "guard_locations.recorded_at <= excluded.recorded_at"},
+		}},
+	}).Create(&location).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).First(&location, "guard_id = ?", guardID).Error; err != nil {
+		return nil, err
+	}
+
+	if guard.OnDuty {
+		location.Guard = guard
+		s.diff.guard(&location)
+	}
+	return &location, nil
+}
+
+func (s *mapService) SetOnDuty(ctx context.Context, guardID uuid.UUID, onDuty bool) (*models.User, error) {
+	var guard models.User
+	if err := s.db.WithContext(ctx).First(&guard, "id = ? AND role = ?", guardID, models.RoleSecurityGuard).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(&guard).Update("on_duty", onDuty).Error; err != nil {
+		return nil, err
+	}
+
+	if !onDuty {
+		s.diff.remove(MapLayerGuards, guardID.String())
+		return &guard, nil
+	}
+	var location models.GuardLocation
+	if err := s.db.WithContext(ctx).First(&location, "guard_id = ?", guardID).Error; err == nil {
+		location.Guard = guard
+		s.diff.guard(&location)
+	}
+	return &guard, nil
+}
+
+func (s *mapService) premiseFeatures(ctx context.Context, bbox *geojson.BBox) ([]geojson.Feature, error) {
+	var premises []models.Premise
+	query := s.db.WithContext(ctx).Where("latitude IS NOT NULL AND longitude IS NOT NULL")
+	if err := withinBBox(query, bbox, "premises.latitude", "premises.longitude").
+		Find(&premises).Error; err != nil {
+		return nil, err
+	}
+	var features []geojson.Feature
+	for i := range premises {
+		if f := premiseFeature(&premises[i]); f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
+
+func (s *mapService) cameraFeatures(ctx context.Context, bbox *geojson.BBox) ([]geojson.Feature, error) {
+	var cameras []models.Camera
+	query := s.db.WithContext(ctx).Preload("Premise")
+	if bbox != nil {
+		// Cameras without their own position are shown at their premise
+		query = withinBBox(query.Joins("JOIN premises ON premises.id = cameras.premise_id"), bbox,
+			"COALESCE(cameras.latitude, premises.latitude)", "COALESCE(cameras.longitude, premises.longitude)")
+	}
+	if err := query.Find(&cameras).Error; err != nil {
+		return nil, err
+	}
+	var features []geojson.Feature
+	for i := range cameras {
+		if f := cameraFeature(&cameras[i]); f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
+
+func (s *mapService) alertFeatures(ctx context.Context, bbox *geojson.BBox) ([]geojson.Feature, error) {
+	var alerts []models.Alert
+	query := s.db.WithContext(ctx).
+		Preload("Camera").
+		Preload("Premise").
+		Where("alerts.status IN ?", activeAlertStatuses)
+	if bbox != nil {
+		// The same fallback as alertFeature: the alert's own position, then
+		// its camera's, then its premise's
+		query = withinBBox(query.
+			Joins("LEFT JOIN cameras ON cameras.id = alerts.camera_id").
+			Joins("JOIN premises ON premises.id = alerts.premise_id"), bbox,
+			"COALESCE(alerts.latitude, cameras.latitude, premises.latitude)",
+			"COALESCE(alerts.longitude, cameras.longitude, premises.longitude)")
+	}
+	if err := query.Order("alerts.created_at DESC").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	var features []geojson.Feature
+	for i := range alerts {
+		if f := alertFeature(&alerts[i]); f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
+
+func (s *mapService) guardFeatures(ctx context.Context, bbox *geojson.BBox) ([]geojson.Feature, error) {
+	var locations []models.GuardLocation
+	query := s.db.WithContext(ctx).
+		Joins("Guard").
+		Where(`"Guard".on_duty = ? AND "Guard".is_active = ?`, true, true)
+	if err := withinBBox(query, bbox, "guard_locations.latitude", "guard_locations.longitude").
+		Find(&locations).Error; err != nil {
+		return nil, err
+	}
+	var features []geojson.Feature
+	for i := range locations {
+		features = append(features, guardFeature(&locations[i]))
+	}
+	return features, nil
+}
+
+// mapPublisher pushes map feature diffs to subscribers of the map topic
+type mapPublisher struct {
+	db    *gorm.DB
+	wsHub *websocket.Hub
+}
+
+func newMapPublisher(db *gorm.DB, wsHub *websocket.Hub) *mapPublisher {
+	return &mapPublisher{db: db, wsHub: wsHub}
+}
+
+func (p *mapPublisher) premise(premise *models.Premise) {
+	if f := premiseFeature(premise); f != nil {
+		p.upsert(MapLayerPremises, f)
+	}
+}
+
+// camera publishes a camera; Premise must be loaded for the position fallback
+func (p *mapPublisher) camera(camera *models.Camera) {
+	if f := cameraFeature(camera); f != nil {
+		p.upsert(MapLayerCameras, f)
+	}
+}
+
+// alert publishes an open alert or removes a closed one
+func (p *mapPublisher) alert(ctx context.Context, alert *models.Alert) {
+	if !isActiveAlert(alert.Status) {
+		p.remove(MapLayerAlerts, alert.ID.String())
+		return
+	}
+	located := *alert
+	if err := p.db.WithContext(ctx).Preload("Camera").Preload("Premise").First(&located, "id = ?", alert.ID).Error; err != nil {
+		log.Printf("Map diff skipped for alert %s: %v", alert.ID, err)
+		return
+	}
+	if f := alertFeature(&located); f != nil {
+		p.upsert(MapLayerAlerts, f)
+	}
+}
+
+func (p *mapPublisher) guard(location *models.GuardLocation) {
+	f := guardFeature(location)
+	p.upsert(MapLayerGuards, &f)
+}
+
+func (p *mapPublisher) upsert(layer string, feature *geojson.Feature) {
+	p.wsHub.Publish([]string{TopicMap}, "map_diff", MapDiff{
+		Layer: layer, Op: MapOpUpsert, ID: feature.ID, Feature: feature,
+	})
+}
+
+func (p *mapPublisher) remove(layer, id string) {
+	p.wsHub.Publish([]string{TopicMap}, "map_diff", MapDiff{
+		Layer: layer, Op: MapOpRemove, ID: id,
+	})
+}
+
+func premiseFeature(premise *models.Premise) *geojson.Feature {
+	if premise.Latitude == nil || premise.Longitude == nil {
+		return nil
+	}
+	f := geojson.NewFeature(premise.ID.String(), geojson.Point(*premise.Longitude, *premise.Latitude), map[string]any{
+		"name":      premise.Name,
+		"address":   premise.Address,
+		"type":      premise.Type,
+		"is_active": premise.IsActive,
+	})
+	return &f
+}
+
+func cameraFeature(camera *models.Camera) *geojson.Feature {
+	lat, lon, ok := cameraCoordinates(camera)
+	if !ok {
+		return nil
+	}
+	f := geojson.NewFeature(camera.ID.String(), geojson.Point(lon, lat), map[string]any{
+		"name":          camera.Name,
+		"location":      camera.Location,
+		"status":        camera.Status,
+		"premise_id":    camera.PremiseID,
+		"ptz_supported": camera.PTZSupported,
+	})
+	return &f
+}
+
+// alertFeature places an alert at its camera, or at its premise when the
+// camera has no position
+func alertFeature(alert *models.Alert) *geojson.Feature {
+	lat, lon, ok := 0.0, 0.0, false
+	if alert.Latitude != nil && alert.Longitude != nil {
+		lat, lon, ok = *alert.Latitude, *alert.Longitude, true
+	} else if alert.Camera != nil {
+		camera := *alert.Camera
+		camera.Premise = alert.Premise
+		lat, lon, ok = cameraCoordinates(&camera)
+	} else if alert.Premise.Latitude != nil && alert.Premise.Longitude != nil {
+		lat, lon, ok = *alert.Premise.Latitude, *alert.Premise.Longitude, true
+	}
+	if !ok {
+		return nil
+	}
+	f := geojson.NewFeature(alert.ID.String(), geojson.Point(lon, lat), map[string]any{
+		"title":      alert.Title,
+		"type":       alert.Type,
+		"severity":   alert.Severity,
+		"status":     alert.Status,
+		"premise_id": alert.PremiseID,
+		"camera_id":  alert.CameraID,
+		"guard_id":   alert.GuardID,
+		"created_at": alert.CreatedAt,
+	})
+	return &f
+}
+
+func guardFeature(location *models.GuardLocation) geojson.Feature {
+	return geojson.NewFeature(location.GuardID.String(), geojson.Point(location.Longitude, location.Latitude), map[string]any{
+		"username":    location.Guard.Username,
+		"name":        location.Guard.FirstName + " " + location.Guard.LastName,
+		"accuracy":    location.Accuracy,
+		"heading":     location.Heading,
+		"recorded_at": location.RecordedAt,
+	})
+}
+
+func cameraCoordinates(camera *models.Camera) (lat, lon float64, ok bool) {
+	if camera.Latitude != nil && camera.Longitude != nil {
+		return *camera.Latitude, *camera.Longitude, true
+	}
+	if camera.Premise.Latitude != nil && camera.Premise.Longitude != nil {
+		return *camera.Premise.Latitude, *camera.Premise.Longitude, true
+	}
+	return 0, 0, false
+}
+
+// withinBBox limits the query to rows whose position, given as SQL
+// expressions, lies inside bbox, the same way geojson.BBox.Contains does
+func withinBBox(query *gorm.DB, bbox *geojson.BBox, lat, lon string) *gorm.DB {
+	if bbox == nil {
+		return query
+	}
+	query = query.Where(lat+" BETWEEN ? AND ?", bbox.MinLat, bbox.MaxLat)
+	if bbox.MinLon <= bbox.MaxLon {
+		return query.Where(lon+" BETWEEN ? AND ?", bbox.MinLon, bbox.MaxLon)
+	}
+	// The box crosses the antimeridian
+	return query.Where(lon+" >= ? OR "+lon+" <= ?", bbox.MinLon, bbox.MaxLon)
+}
+
+func isActiveAlert(status models.AlertStatus) bool {
+	for _, s := range activeAlertStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
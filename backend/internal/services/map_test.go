@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"smart-city-surveillance/internal/models"
+)
+
+func TestAlertFeaturePosition(t *testing.T) {
+	at := func(lat, lon float64) (*float64, *float64) { return &lat, &lon }
+	premise := models.Premise{}
+	premise.Latitude, premise.Longitude = at(52.5, 13.4)
+	placed := models.Camera{}
+	placed.Latitude, placed.Longitude = at(52.51, 13.41)
+	reported := models.Alert{Premise: premise, Camera: &placed}
+	reported.Latitude, reported.Longitude = at(52.52, 13.42)
+
+	for _, tt := range []struct {
+		name     string
+		alert    models.Alert
+		lon, lat float64
+	}{
+		{"own position", reported, 13.42, 52.52},
+		{"camera position", models.Alert{Premise: premise, Camera: &placed}, 13.41, 52.51},
+		{"premise of an unplaced camera", models.Alert{Premise: premise, Camera: &models.Camera{}}, 13.4, 52.5},
+		{"premise without a camera", models.Alert{Premise: premise}, 13.4, 52.5},
+	} {
+		f := alertFeature(&tt.alert)
+		if f == nil {
+			t.Errorf("%s: alert not placed", tt.name)
+			continue
+		}
+		coordinates := f.Geometry.Coordinates.([]float64)
+		if coordinates[0] != tt.lon || coordinates[1] != tt.lat {
+			t.Errorf("%s: alert placed at %v, want [%v %v]", tt.name, coordinates, tt.lon, tt.lat)
+		}
+	}
+
+	if f := alertFeature(&models.Alert{Camera: &models.Camera{}}); f != nil {
+		t.Errorf("alert without any position placed at %v", f.Geometry.Coordinates)
+	}
+}
+
+func TestValidCoordinates(t *testing.T) {
+	for _, tt := range []struct {
+		lat, lon float64
+		valid    bool
+	}{
+		{52.5, 13.4, true},
+		{-90, 180, true},
+		{90, -180, true},
+		{90.1, 0, false},
+		{0, -180.1, false},
+	} {
+		if got := validCoordinates(tt.lat, tt.lon); got != tt.valid {
+			t.Errorf("validCoordinates(%v, %v) = %v, want %v", tt.lat, tt.lon, got, tt.valid)
+		}
+	}
+}
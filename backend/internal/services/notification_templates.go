@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notification events
+const (
+	NotifyAlertCreated     = "alert_created"
+	NotifyGuardDispatched  = "guard_dispatched"
+	NotifyCheckInDue       = "check_in_due"
+	NotifyGuardSOS         = "guard_sos"
+	NotifyLoneWorkerMissed = "lone_worker_missed"
+	NotifyDeliveryFailed   = "delivery_failed"
+	NotifyTest             = "test"
+)
+
+// notificationTemplate renders an event for each channel: a subject (email
+// subject, push title), a body for email and a short text for SMS and push
+type notificationTemplate struct {
+	subject, body, short *template.Template
+}
+
+type renderedNotification struct {
+	subject, body, short string
+}
+
+var notificationTemplates = map[string]notificationTemplate{
+	NotifyAlertCreated: newNotificationTemplate(NotifyAlertCreated,
+		`New {{.severity}} alert: {{.title}}`,
+		`A {{.severity}} {{label .type}} alert was raised at {{time .raised_at}}.
+
+{{.title}}
+Location: {{.location}}
+{{- with .description}}
+
+{{.}}{{end}}`,
+		`{{.severity}} alert: {{.title}} at {{.location}}`),
+	NotifyGuardDispatched: newNotificationTemplate(NotifyGuardDispatched,
+		`Dispatched: {{.title}}`,
+		`You have been dispatched to a {{.severity}} alert.
+
+{{.title}}
+Location: {{.location}}
+{{- with .description}}
+
+{{.}}{{end}}
+
+Open the app to see the incident and its checklist.`,
+		`Dispatched to {{.severity}} alert: {{.title}} at {{.location}}`),
+	NotifyCheckInDue: newNotificationTemplate(NotifyCheckInDue,
+		`Check-in due`,
+		`Your lone-worker check-in was due at {{time .due_at}}. Check in before {{time .escalates_at}} or operators will be alerted.`,
+		`Check in now. Operators are alerted at {{time .escalates_at}}.`),
+	NotifyGuardSOS: newNotificationTemplate(NotifyGuardSOS,
+		`SOS from {{.guard}}`,
+		`{{.guard}} pressed the panic button at {{time .raised_at}}.
+
+Location: {{.location}}
+{{- with .message}}
+Message: {{.}}{{end}}
+
+Respond from the control room.`,
+		`SOS from {{.guard}} at {{.location}}{{with .message}}: {{.}}{{end}}`),
+	NotifyLoneWorkerMissed: newNotificationTemplate(NotifyLoneWorkerMissed,
+		`Missed check-in: {{.guard}}`,
+		`{{.guard}} missed a lone-worker check-in due at {{time .due_at}}. The last check-in was at {{time .last_check_in_at}}.
+
+Location: {{.location}}
+
+Respond from the control room.`,
+		`{{.guard}} missed a check-in due at {{time .due_at}}, last seen at {{.location}}`),
+	NotifyDeliveryFailed: newNotificationTemplate(NotifyDeliveryFailed,
+		`Undelivered {{label .message_type}} for {{.user}}`,
+		`A {{label .message_type}} message sent to {{.user}} at {{time .sent_at}} was never acknowledged. They may not have seen it.`,
+		`{{.user}} did not receive a {{label .message_type}} message sent at {{time .sent_at}}`),
+	NotifyTest: newNotificationTemplate(NotifyTest,
+		`Test notification`,
+		`Hello {{.user}}, this is a test notification. You will be reached here about events you have chosen to be notified of.`,
+		`Test notification for {{.user}}`),
+}
+
+func newNotificationTemplate(event, subject, body, short string) notificationTemplate {
+	parse := func(part, text string) *template.Template {
+		return template.Must(template.New(event + "." + part).Funcs(notificationFuncs).Parse(text))
+	}
+	return notificationTemplate{subject: parse("subject", subject), body: parse("body", body), short: parse("short", short)}
+}
+
+var notificationFuncs = template.FuncMap{
+	"time": func(v any) string {
+		switch t := v.(type) {
+		case time.Time:
+			return t.UTC().Format(reportTimeLayout + " MST")
+		case *time.Time:
+			if t != nil {
+				return t.UTC().Format(reportTimeLayout + " MST")
+			}
+			return ""
+		case nil:
+			return ""
+		}
+		return fmt.Sprint(v)
+	},
+	"label": func(v any) string { return statusLabel(fmt.Sprint(v)) },
+}
+
+func (t notificationTemplate) render(data map[string]any) (*renderedNotification, error) {
+	var out renderedNotification
+	for _, part := range []struct {
+		tmpl *template.Template
+		dst  *string
+	}{{t.subject, &out.subject}, {t.body, &out.body}, {t.short, &out.short}} {
+		var buf bytes.Buffer
+		if err := part.tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		// Missing or nil values in the data map print as "<no value>"
+		*part.dst = strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", ""))
+	}
+	return &out, nil
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/notify"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	notificationLease       = 2 * time.Minute
+	notificationSendTimeout = 30 * time.Second
+	maxNotificationBackoff  = time.Hour
+	notificationBatchSize   = 100
+	notificationSenders     = 8
+)
+
+var (
+	ErrUnknownNotificationEvent = errors.New("unknown notification event")
+	ErrInvalidDevice            = errors.New("invalid device")
+)
+
+// Notification is an event to tell users about. Data fills the event's
+// templates; ID values in it are also passed to push notifications so the
+// app can open the right screen.
+type Notification struct {
+	Event    string
+	Severity models.AlertSeverity
+	Data     map[string]any
+}
+
+// NotificationOptions tunes retries of failed deliveries
+type NotificationOptions struct {
+	MaxAttempts int
+	// RetryBase is the wait after the first failure; it doubles after each
+	RetryBase time.Duration
+}
+
+// NotificationsService sends notifications by email, SMS and push on the
+// channels, severities and hours each user's preferences allow, and keeps a
+// log of every delivery
+type NotificationsService interface {
+	// Notify queues the notification for the users; failures are logged
+	Notify(ctx context.Context, userIDs []uuid.UUID, n Notification)
+	// NotifyRole queues the notification for every active user with the role
+	NotifyRole(ctx context.Context, role models.UserRole, n Notification)
+	// NotifyUndelivered tells operators that a realtime message needing an
+	// ack never reached its user
+	NotifyUndelivered(ctx context.Context, entry websocket.OutboxEntry)
+	SendTest(ctx context.Context, userID uuid.UUID) ([]models.NotificationDelivery, error)
+
+	ListDevices(ctx context.Context, userID uuid.UUID) ([]models.DeviceToken, error)
+	RegisterDevice(ctx context.Context, userID uuid.UUID, platform models.DevicePlatform, token string) (*models.DeviceToken, error)
+	RemoveDevice(ctx context.Context, userID, id uuid.UUID) error
+
+	ListDeliveries(ctx context.Context, q ListQuery) (*Page[models.NotificationDelivery], error)
+	GetDelivery(ctx context.Context, id uuid.UUID) (*models.NotificationDelivery, error)
+
+	// Run sends queued deliveries until ctx is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+var notificationDeliveryListSpec = &listSpec[models.NotificationDelivery]{
+	table: "notification_deliveries",
+	id:    func(d *models.NotificationDelivery) uuid.UUID { return d.ID },
+	sorts: map[string]listColumn[models.NotificationDelivery]{
+		"created_at": {expr: "notification_deliveries.created_at", kind: cursorTime, value: func(d *models.NotificationDelivery) any { return d.CreatedAt }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"user_id": {clause: "notification_deliveries.user_id IN ?", kind: filterUUID},
+		"event":   {clause: "notification_deliveries.event IN ?"},
+		"channel": {clause: "notification_deliveries.channel IN ?"},
+		"status":  {clause: "notification_deliveries.status IN ?"},
+	},
+	relations: map[string]listRelation{
+		"user": {preload: "User"},
+	},
+}
+
+type notificationsService struct {
+	db        *gorm.DB
+	prefs     PreferencesService
+	providers map[models.NotificationChannel]notify.Provider
+	queue     *retryQueue
+	wake      chan struct{}
+}
+
+func NewNotificationsService(db *gorm.DB, prefs PreferencesService, providers map[models.NotificationChannel]notify.Provider, opts NotificationOptions) NotificationsService {
+	queue := &retryQueue{
+		table:      "notification_deliveries",
+		pending:    string(models.NotificationPending),
+		lease:      notificationLease,
+		batchSize:  notificationBatchSize,
+		senders:    notificationSenders,
+		maxBackoff: maxNotificationBackoff,
+		attempts:   opts.MaxAttempts,
+		retryBase:  opts.RetryBase,
+		now:        time.Now,
+	}
+	return &notificationsService{db: db, prefs: prefs, providers: providers, queue: queue, wake: make(chan struct{}, 1)}
+}
+
+func (s *notificationsService) Notify(ctx context.Context, userIDs []uuid.UUID, n Notification) {
+	if len(userIDs) == 0 {
+		return
+	}
+	var users []models.User
+	if err := s.db.WithContext(ctx).Where("id IN ? AND is_active = ?", userIDs, true).Find(&users).Error; err != nil {
+		log.Printf("Failed to load users for %s notification: %v", n.Event, err)
+		return
+	}
+	if _, err := s.enqueue(ctx, users, n, false); err != nil {
+		log.Printf("Failed to queue %s notification: %v", n.Event, err)
+	}
+}
+
+func (s *notificationsService) NotifyRole(ctx context.Context, role models.UserRole, n Notification) {
+	var users []models.User
+	if err := s.db.WithContext(ctx).Where("role = ? AND is_active = ?", role, true).Find(&users).Error; err != nil {
+		log.Printf("Failed to load users for %s notification: %v", n.Event, err)
+		return
+	}
+	if _, err := s.enqueue(ctx, users, n, false); err != nil {
+		log.Printf("Failed to queue %s notification: %v", n.Event, err)
+	}
+}
+
+func (s *notificationsService) NotifyUndelivered(ctx context.Context, entry websocket.OutboxEntry) {
+	var message websocket.Message
+	if err := json.Unmarshal(entry.Data, &message); err != nil {
+		log.Printf("Undelivered message %d for user %s is unreadable: %v", entry.Seq, entry.UserID, err)
+		return
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", entry.UserID).Error; err != nil {
+		log.Printf("Undelivered message %d: user %s not found: %v", entry.Seq, entry.UserID, err)
+		return
+	}
+	s.NotifyRole(ctx, models.RoleSCSOperator, Notification{
+		Event:    NotifyDeliveryFailed,
+		Severity: models.AlertSeverityHigh,
+		Data: map[string]any{
+			"user_id":      user.ID,
+			"user":         userName(&user),
+			"message_type": message.Type,
+			"sent_at":      entry.CreatedAt,
+		},
+	})
+}
+
+// SendTest notifies the user on every channel they can be reached on,
+// regardless of preferences
+func (s *notificationsService) SendTest(ctx context.Context, userID uuid.UUID) ([]models.NotificationDelivery, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return s.enqueue(ctx, []models.User{user}, Notification{
+		Event: NotifyTest,
+		Data:  map[string]any{"user": userName(&user)},
+	}, true)
+}
+
+// enqueue renders the notification for each user and queues a delivery per
+// channel and address. allChannels skips preferences.
+func (s *notificationsService) enqueue(ctx context.Context, users []models.User, n Notification, allChannels bool) ([]models.NotificationDelivery, error) {
+	tmpl, ok := notificationTemplates[n.Event]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNotificationEvent, n.Event)
+	}
+	message, err := tmpl.render(n.Data)
+	if err != nil {
+		return nil, err
+	}
+	data := pushData(n)
+
+	now := s.queue.now()
+	var deliveries []models.NotificationDelivery
+	for i := range users {
+		user := &users[i]
+		channels := allNotificationChannels
+		if !allChannels {
+			if channels, err = s.prefs.Channels(ctx, user.ID, n.Event, n.Severity, now); err != nil {
+				log.Printf("Skipping %s notification to user %s: %v", n.Event, user.ID, err)
+				continue
+			}
+		}
+		for _, channel := range channels {
+			addresses, err := s.addresses(ctx, user, channel)
+			if err != nil {
+				return nil, err
+			}
+			for _, address := range addresses {
+				delivery := models.NotificationDelivery{
+					UserID:        user.ID,
+					Event:         n.Event,
+					Channel:       channel,
+					Address:       address.to,
+					Platform:      address.platform,
+					Subject:       message.subject,
+					Body:          message.short,
+					Status:        models.NotificationPending,
+					NextAttemptAt: now,
+				}
+				switch channel {
+				case models.NotificationChannelEmail:
+					delivery.Body = message.body
+				case models.NotificationChannelPush:
+					delivery.Data = data
+				}
+				deliveries = append(deliveries, delivery)
+			}
+		}
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	if err := s.db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return deliveries, nil
+}
+
+type notificationAddress struct {
+	to       string
+	platform models.DevicePlatform
+}
+
+// addresses are where the user is reached on a channel; none when the user
+// has no email, phone number or registered device, and none for the realtime
+// feed, which callers send through the hub
+func (s *notificationsService) addresses(ctx context.Context, user *models.User, channel models.NotificationChannel) ([]notificationAddress, error) {
+	switch channel {
+	case models.NotificationChannelEmail:
+		if user.Email != "" {
+			return []notificationAddress{{to: user.Email}}, nil
+		}
+	case models.NotificationChannelSMS:
+		if user.Phone != "" {
+			return []notificationAddress{{to: user.Phone}}, nil
+		}
+	case models.NotificationChannelPush:
+		var devices []models.DeviceToken
+		if err := s.db.WithContext(ctx).Where("user_id = ?", user.ID).Find(&devices).Error; err != nil {
+			return nil, err
+		}
+		addresses := make([]notificationAddress, len(devices))
+		for i, device := range devices {
+			addresses[i] = notificationAddress{to: device.Token, platform: device.Platform}
+		}
+		return addresses, nil
+	}
+	return nil, nil
+}
+
+// pushData carries the event and the IDs in the notification data
+func pushData(n Notification) models.JSONMap {
+	data := models.JSONMap{"event": n.Event}
+	for key, value := range n.Data {
+		switch v := value.(type) {
+		case uuid.UUID:
+			data[key] = v.String()
+		case *uuid.UUID:
+			if v != nil {
+				data[key] = v.String()
+			}
+		}
+	}
+	return data
+}
+
+func (s *notificationsService) ListDevices(ctx context.Context, userID uuid.UUID) ([]models.DeviceToken, error) {
+	var devices []models.DeviceToken
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&devices).Error
+	return devices, err
+}
+
+// RegisterDevice adds the app installation's push token. A token already
+// registered moves to this user, as happens when someone else logs in.
+func (s *notificationsService) RegisterDevice(ctx context.Context, userID uuid.UUID, platform models.DevicePlatform, token string) (*models.DeviceToken, error) {
+	if platform != models.DevicePlatformAndroid && platform != models.DevicePlatformIOS {
+		return nil, fmt.Errorf("%w: unknown platform %q", ErrInvalidDevice, platform)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: token is required", ErrInvalidDevice)
+	}
+	now := time.Now()
+	device := models.DeviceToken{UserID: userID, Platform: platform, Token: token, CreatedAt: now, LastSeenAt: now}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "last_seen_at"}),
+	}).Create(&device).Error; err != nil {
+		return nil, err
+	}
+	var saved models.DeviceToken
+	if err := s.db.WithContext(ctx).First(&saved, "token = ?", token).Error; err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (s *notificationsService) RemoveDevice(ctx context.Context, userID, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *notificationsService) ListDeliveries(ctx context.Context, q ListQuery) (*Page[models.NotificationDelivery], error) {
+	return notificationDeliveryListSpec.find(s.db.WithContext(ctx).Model(&models.NotificationDelivery{}), q)
+}
+
+func (s *notificationsService) GetDelivery(ctx context.Context, id uuid.UUID) (*models.NotificationDelivery, error) {
+	var delivery models.NotificationDelivery
+	if err := s.db.WithContext(ctx).Preload("User").First(&delivery, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *notificationsService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sendDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// sendDue sends deliveries whose next attempt is due, a few at a time
+func (s *notificationsService) sendDue(ctx context.Context) {
+	var due []models.NotificationDelivery
+	if err := s.queue.due(s.db.WithContext(ctx), &due); err != nil {
+		log.Printf("Failed to load due notifications: %v", err)
+		return
+	}
+	s.queue.each(len(due), func(i int) {
+		s.deliver(ctx, &due[i])
+	})
+}
+
+func (s *notificationsService) deliver(ctx context.Context, delivery *models.NotificationDelivery) {
+	attempt, err := s.queue.claim(ctx, s.db, delivery.ID, delivery.Attempts)
+	if err != nil {
+		log.Printf("Failed to claim notification %s: %v", delivery.ID, err)
+		return
+	}
+	if attempt == 0 {
+		return
+	}
+
+	err = s.send(ctx, delivery)
+	now := s.queue.now()
+	updates := map[string]any{"last_error": ""}
+	switch {
+	case err == nil:
+		updates["status"] = models.NotificationSent
+		updates["sent_at"] = now
+	case errors.Is(err, notify.ErrPermanent) || s.queue.giveUp(attempt):
+		updates["status"] = models.NotificationFailed
+		updates["last_error"] = err.Error()
+		// The push service no longer knows the device
+		if delivery.Channel == models.NotificationChannelPush && errors.Is(err, notify.ErrPermanent) {
+			if err := s.db.WithContext(ctx).Where("token = ?", delivery.Address).Delete(&models.DeviceToken{}).Error; err != nil {
+				log.Printf("Failed to remove rejected device token: %v", err)
+			}
+		}
+	default:
+		updates["next_attempt_at"] = now.Add(s.queue.backoff(attempt))
+		updates["last_error"] = err.Error()
+	}
+	if err := s.db.WithContext(ctx).Model(&models.NotificationDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record notification %s: %v", delivery.ID, err)
+	}
+}
+
+func (s *notificationsService) send(ctx context.Context, delivery *models.NotificationDelivery) error {
+	provider, ok := s.providers[delivery.Channel]
+	if !ok {
+		return fmt.Errorf("%w: no %s provider", notify.ErrPermanent, delivery.Channel)
+	}
+	message := notify.Message{
+		To:       delivery.Address,
+		Subject:  delivery.Subject,
+		Body:     delivery.Body,
+		Platform: string(delivery.Platform),
+	}
+	if len(delivery.Data) > 0 {
+		message.Data = make(map[string]string, len(delivery.Data))
+		for key, value := range delivery.Data {
+			message.Data[key] = fmt.Sprint(value)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, notificationSendTimeout)
+	defer cancel()
+	return provider.Send(ctx, message)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/notify"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type testProviders struct {
+	email, sms, push *notify.Fake
+}
+
+func newTestNotifications(db *gorm.DB, opts NotificationOptions) (*notificationsService, testProviders) {
+	fakes := testProviders{email: notify.NewFake("email"), sms: notify.NewFake("sms"), push: notify.NewFake("push")}
+	providers := map[models.NotificationChannel]notify.Provider{
+		models.NotificationChannelEmail: fakes.email,
+		models.NotificationChannelSMS:   fakes.sms,
+		models.NotificationChannelPush:  fakes.push,
+	}
+	var prefs PreferencesService
+	if db != nil {
+		prefs = NewPreferencesService(db)
+	}
+	return NewNotificationsService(db, prefs, providers, opts).(*notificationsService), fakes
+}
+
+func TestNotificationSend(t *testing.T) {
+	s, fakes := newTestNotifications(nil, NotificationOptions{})
+	ctx := context.Background()
+
+	err := s.send(ctx, &models.NotificationDelivery{
+		Channel:  models.NotificationChannelPush,
+		Address:  "device-token",
+		Platform: models.DevicePlatformAndroid,
+		Subject:  "SOS",
+		Body:     "Guard needs help",
+		Data:     models.JSONMap{"event": NotifyGuardSOS, "count": 2},
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	sent := fakes.push.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("push provider got %d messages", len(sent))
+	}
+	msg := sent[0]
+	if msg.To != "device-token" || msg.Subject != "SOS" || msg.Body != "Guard needs help" || msg.Platform != "android" {
+		t.Errorf("sent %+v", msg)
+	}
+	if msg.Data["event"] != NotifyGuardSOS || msg.Data["count"] != "2" {
+		t.Errorf("push data = %v, want its values as strings", msg.Data)
+	}
+
+	// A channel without a provider cannot be fixed by retrying
+	err = s.send(ctx, &models.NotificationDelivery{Channel: models.NotificationChannelRealtime})
+	if !errors.Is(err, notify.ErrPermanent) {
+		t.Errorf("send without a provider = %v, want ErrPermanent", err)
+	}
+
+	fakes.sms.Fail(errors.New("gateway down"))
+	if err := s.send(ctx, &models.NotificationDelivery{Channel: models.NotificationChannelSMS, Address: "+15550100"}); err == nil {
+		t.Error("send through a failing provider succeeded")
+	}
+	if len(fakes.sms.Sent()) != 0 {
+		t.Error("a failed send was recorded")
+	}
+}
+
+// testDeliveries returns the user's deliveries by channel
+func testDeliveries(t *testing.T, db *gorm.DB, userID uuid.UUID) map[models.NotificationChannel]models.NotificationDelivery {
+	t.Helper()
+	var deliveries []models.NotificationDelivery
+	if err := db.Find(&deliveries, "user_id = ?", userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	byChannel := make(map[models.NotificationChannel]models.NotificationDelivery)
+	for _, delivery := range deliveries {
+		byChannel[delivery.Channel] = delivery
+	}
+	return byChannel
+}
+
+func TestNotificationRetriesUntilSent(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, fakes := newTestNotifications(db, NotificationOptions{MaxAttempts: 5, RetryBase: time.Minute})
+	clock := useTestClock(s.queue)
+	user := createTestUser(t, db)
+
+	if _, err := s.SendTest(ctx, user.ID); err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	// Email fails twice before the server recovers
+	fakes.email.Fail(errors.New("smtp unavailable"))
+	s.sendDue(ctx)
+	clock.Advance(s.queue.backoff(1))
+	s.sendDue(ctx)
+	fakes.email.Fail(nil)
+	clock.Advance(s.queue.backoff(2))
+	s.sendDue(ctx)
+
+	deliveries := testDeliveries(t, db, user.ID)
+	email := deliveries[models.NotificationChannelEmail]
+	if email.Status != models.NotificationSent || email.Attempts != 3 || email.LastError != "" || email.SentAt == nil {
+		t.Errorf("email is %s after %d attempts (%q)", email.Status, email.Attempts, email.LastError)
+	}
+	for _, channel := range []models.NotificationChannel{models.NotificationChannelSMS, models.NotificationChannelPush} {
+		if delivery := deliveries[channel]; delivery.Status != models.NotificationSent || delivery.Attempts != 1 {
+			t.Errorf("%s is %s after %d attempts", channel, delivery.Status, delivery.Attempts)
+		}
+	}
+	if len(fakes.email.Sent()) != 1 || fakes.email.Sent()[0].To != user.Email {
+		t.Errorf("email provider sent %+v", fakes.email.Sent())
+	}
+}
+
+func TestNotificationRetryWaitsForBackoff(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, fakes := newTestNotifications(db, NotificationOptions{MaxAttempts: 5, RetryBase: time.Hour})
+	clock := useTestClock(s.queue)
+	user := createTestUser(t, db)
+	fakes.sms.Fail(errors.New("gateway down"))
+
+	if _, err := s.SendTest(ctx, user.ID); err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	failedAt := clock.Now()
+	s.sendDue(ctx)
+	clock.Advance(time.Hour - time.Second)
+	s.sendDue(ctx)
+
+	sms := testDeliveries(t, db, user.ID)[models.NotificationChannelSMS]
+	if sms.Status != models.NotificationPending || sms.Attempts != 1 || sms.LastError != "gateway down" {
+		t.Errorf("sms is %s after %d attempts (%q), want pending after 1", sms.Status, sms.Attempts, sms.LastError)
+	}
+	if !sms.NextAttemptAt.Equal(failedAt.Add(time.Hour)) {
+		t.Errorf("next attempt in %v, want an hour", sms.NextAttemptAt.Sub(failedAt))
+	}
+
+	clock.Advance(time.Second)
+	s.sendDue(ctx)
+	if sms := testDeliveries(t, db, user.ID)[models.NotificationChannelSMS]; sms.Attempts != 2 {
+		t.Errorf("sms made %d attempts once the backoff was over, want 2", sms.Attempts)
+	}
+}
+
+func TestNotificationFailsAfterMaxAttempts(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, fakes := newTestNotifications(db, NotificationOptions{MaxAttempts: 3, RetryBase: time.Minute})
+	clock := useTestClock(s.queue)
+	user := createTestUser(t, db)
+	fakes.sms.Fail(errors.New("gateway down"))
+
+	if _, err := s.SendTest(ctx, user.ID); err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		s.sendDue(ctx)
+		clock.Advance(maxNotificationBackoff)
+	}
+	sms := testDeliveries(t, db, user.ID)[models.NotificationChannelSMS]
+	if sms.Status != models.NotificationFailed || sms.Attempts != 3 || sms.LastError != "gateway down" {
+		t.Errorf("sms is %s after %d attempts (%q), want failed after 3", sms.Status, sms.Attempts, sms.LastError)
+	}
+}
+
+func TestNotificationPermanentFailureRemovesDevice(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, fakes := newTestNotifications(db, NotificationOptions{MaxAttempts: 5, RetryBase: time.Minute})
+	user := createTestUser(t, db)
+	fakes.push.Fail(fmt.Errorf("%w: unregistered", notify.ErrPermanent))
+
+	if _, err := s.SendTest(ctx, user.ID); err != nil {
+		t.Fatalf("SendTest: %v", err)
+	}
+	s.sendDue(ctx)
+	push := testDeliveries(t, db, user.ID)[models.NotificationChannelPush]
+	if push.Status != models.NotificationFailed || push.Attempts != 1 {
+		t.Errorf("push is %s after %d attempts, want failed after 1", push.Status, push.Attempts)
+	}
+	var devices int64
+	db.Model(&models.DeviceToken{}).Where("user_id = ?", user.ID).Count(&devices)
+	if devices != 0 {
+		t.Errorf("%d devices left after the push service rejected the token", devices)
+	}
+}
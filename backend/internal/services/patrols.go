@@ -0,0 +1,1040 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PatrolGroupByGuard   = "guard"
+	PatrolGroupByPremise = "premise"
+)
+
+var (
+	ErrInvalidPatrolRoute  = errors.New("invalid patrol route")
+	ErrDuplicateTagCode    = errors.New("tag code is already used by another checkpoint")
+	ErrPatrolRouteInUse    = errors.New("patrol route has runs; deactivate it instead")
+	ErrPatrolRouteInactive = errors.New("patrol route is not active")
+	ErrPatrolInProgress    = errors.New("another guard is already walking this route")
+	ErrUnknownTag          = errors.New("unknown checkpoint tag")
+	ErrNoPatrolRun         = errors.New("no open patrol of this route for the guard")
+	ErrCheckpointScanned   = errors.New("checkpoint already scanned on this patrol")
+	ErrInvalidGroupBy      = errors.New("group_by must be guard or premise")
+	ErrInvalidTimeRange    = errors.New("to must be after from")
+)
+
+// openRunStatuses are the statuses of runs whose checkpoints can still be scanned
+var openRunStatuses = []models.PatrolRunStatus{models.PatrolRunScheduled, models.PatrolRunInProgress}
+
+// PatrolRouteInput creates or replaces a route. Checkpoints are walked in
+// the order given.
+type PatrolRouteInput struct {
+	PremiseID   uuid.UUID
+	Name        string
+	Description string
+	GuardID     *uuid.UUID
+	StartTimes  []string
+	Timezone    string
+	IsActive    bool
+	Checkpoints []PatrolCheckpointInput
+}
+
+type PatrolCheckpointInput struct {
+	// ID keeps an existing checkpoint of the route when updating
+	ID                    *uuid.UUID
+	Name                  string
+	TagCode               string // generated when empty
+	TagType               models.TagType
+	ExpectedOffsetMinutes int
+	ToleranceMinutes      int
+	Latitude              *float64
+	Longitude             *float64
+}
+
+// PatrolScan is a checkpoint tag read by the guard app
+type PatrolScan struct {
+	TagCode string
+	Fix     *GuardFix
+}
+
+type PatrolRunFilter struct {
+	RouteID   *uuid.UUID
+	PremiseID *uuid.UUID
+	GuardID   *uuid.UUID
+	Status    models.PatrolRunStatus
+	From      *time.Time
+	To        *time.Time
+}
+
+// PatrolComplianceQuery covers checkpoints due in [From, To)
+type PatrolComplianceQuery struct {
+	From      time.Time
+	To        time.Time
+	PremiseID *uuid.UUID
+	GuardID   *uuid.UUID
+	GroupBy   string
+}
+
+// PatrolCompliance counts the checkpoints of a guard or premise. Checkpoints
+// still pending are not counted.
+type PatrolCompliance struct {
+	GuardID        *uuid.UUID `json:"guard_id,omitempty"`
+	PremiseID      *uuid.UUID `json:"premise_id,omitempty"`
+	Name           string     `json:"name,omitempty" gorm:"-"`
+	Runs           int64      `json:"runs"`
+	CompletedRuns  int64      `json:"completed_runs"`
+	Checkpoints    int64      `json:"checkpoints"`
+	OnTime         int64      `json:"on_time"`
+	Late           int64      `json:"late"`
+	Missed         int64      `json:"missed"`
+	ComplianceRate float64    `json:"compliance_rate" gorm:"-"` // on time / checkpoints
+	CoverageRate   float64    `json:"coverage_rate" gorm:"-"`   // scanned / checkpoints
+}
+
+type PatrolComplianceReport struct {
+	From    time.Time          `json:"from"`
+	To      time.Time          `json:"to"`
+	GroupBy string             `json:"group_by"`
+	Rows    []PatrolCompliance `json:"rows"`
+	Total   PatrolCompliance   `json:"total"`
+}
+
+// PatrolsService manages patrol routes, checkpoint scans and compliance
+type PatrolsService interface {
+	ListRoutes(ctx context.Context, premiseID *uuid.UUID, userRole models.UserRole, userID string) ([]models.PatrolRoute, error)
+	GetRoute(ctx context.Context, id uuid.UUID, userRole models.UserRole, userID string) (*models.PatrolRoute, error)
+	CreateRoute(ctx context.Context, input PatrolRouteInput, userID string) (*models.PatrolRoute, error)
+	UpdateRoute(ctx context.Context, id uuid.UUID, input PatrolRouteInput, userID string) (*models.PatrolRoute, error)
+	DeleteRoute(ctx context.Context, id uuid.UUID, userID string) error
+	StartPatrol(ctx context.Context, routeID, guardID uuid.UUID) (*models.PatrolRun, error)
+	Scan(ctx context.Context, guardID uuid.UUID, scan PatrolScan) (*models.PatrolRun, error)
+	ListRuns(ctx context.Context, filter PatrolRunFilter, userRole models.UserRole, userID string) ([]models.PatrolRun, error)
+	GetRun(ctx context.Context, id uuid.UUID, userRole models.UserRole, userID string) (*models.PatrolRun, error)
+	Compliance(ctx context.Context, query PatrolComplianceQuery, userRole models.UserRole, userID string) (*PatrolComplianceReport, error)
+	// Run opens scheduled patrols and marks missed checkpoints until ctx is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type patrolsService struct {
+	db          *gorm.DB
+	wsHub       *websocket.Hub
+	alerts      AlertsService
+	maps        MapService
+	audit       AuditService
+	missedGrace time.Duration
+}
+
+func NewPatrolsService(db *gorm.DB, wsHub *websocket.Hub, alerts AlertsService, maps MapService, audit AuditService, missedGrace time.Duration) PatrolsService {
+	return &patrolsService{db: db, wsHub: wsHub, alerts: alerts, maps: maps, audit: audit, missedGrace: missedGrace}
+}
+
+// ListRoutes returns every route to operators. Guards see the routes
+// assigned to them and unassigned routes of premises they cover, without
+// tag codes.
+func (s *patrolsService) ListRoutes(ctx context.Context, premiseID *uuid.UUID, userRole models.UserRole, userID string) ([]models.PatrolRoute, error) {
+	query := s.db.WithContext(ctx).
+		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Preload("Guard").
+		Order("name")
+	if premiseID != nil {
+		query = query.Where("premise_id = ?", *premiseID)
+	}
+	if userRole != models.RoleSCSOperator {
+		query = guardRouteScope(query, userID)
+	}
+	var routes []models.PatrolRoute
+	if err := query.Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	if userRole != models.RoleSCSOperator {
+		for i := range routes {
+			hideTagCodes(&routes[i])
+		}
+	}
+	return routes, nil
+}
+
+func (s *patrolsService) GetRoute(ctx context.Context, id uuid.UUID, userRole models.UserRole, userID string) (*models.PatrolRoute, error) {
+	route, err := s.loadRoute(ctx, s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if userRole != models.RoleSCSOperator {
+		if err := s.requireRouteAccess(ctx, route.ID, userID); err != nil {
+			return nil, err
+		}
+		hideTagCodes(route)
+	}
+	return route, nil
+}
+
+func (s *patrolsService) CreateRoute(ctx context.Context, input PatrolRouteInput, userID string) (route *models.PatrolRoute, err error) {
+	defer func() {
+		resourceID := ""
+		if route != nil {
+			resourceID = route.ID.String()
+		}
+		recordAction(ctx, s.audit, "patrol_route.create", "patrol_route", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	if err := s.validateRoute(ctx, uuid.Nil, &input); err != nil {
+		return nil, err
+	}
+	created := models.PatrolRoute{
+		PremiseID:   input.PremiseID,
+		Name:        input.Name,
+		Description: input.Description,
+		GuardID:     input.GuardID,
+		StartTimes:  pq.StringArray(input.StartTimes),
+		Timezone:    input.Timezone,
+		IsActive:    true,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		// is_active defaults to true, so an inactive route is stored in a second step
+		if !input.IsActive {
+			if err := tx.Model(&created).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		for i, cp := range input.Checkpoints {
+			checkpoint := checkpointFromInput(created.ID, i, cp)
+			if err := tx.Create(&checkpoint).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.loadRoute(ctx, s.db, created.ID)
+}
+
+// UpdateRoute replaces the route and its checkpoints. Checkpoints left out
+// are deleted; open patrols keep the checkpoints they started with.
+func (s *patrolsService) UpdateRoute(ctx context.Context, id uuid.UUID, input PatrolRouteInput, userID string) (route *models.PatrolRoute, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "patrol_route.update", "patrol_route", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	if err := s.db.WithContext(ctx).First(&models.PatrolRoute{}, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.validateRoute(ctx, id, &input); err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PatrolRoute{}).Where("id = ?", id).Updates(map[string]any{
+			"premise_id":  input.PremiseID,
+			"name":        input.Name,
+			"description": input.Description,
+			"guard_id":    input.GuardID,
+			"start_times": pq.StringArray(input.StartTimes),
+			"timezone":    input.Timezone,
+			"is_active":   input.IsActive,
+		}).Error; err != nil {
+			return err
+		}
+
+		var existing []models.PatrolCheckpoint
+		if err := tx.Where("route_id = ?", id).Find(&existing).Error; err != nil {
+			return err
+		}
+		kept := make(map[uuid.UUID]bool, len(input.Checkpoints))
+		for _, cp := range input.Checkpoints {
+			if cp.ID != nil {
+				kept[*cp.ID] = true
+			}
+		}
+		var removed []uuid.UUID
+		for _, cp := range existing {
+			if !kept[cp.ID] {
+				removed = append(removed, cp.ID)
+			}
+		}
+		// Removed checkpoints go first so their tag codes can be reused
+		if len(removed) > 0 {
+			if err := tx.Delete(&models.PatrolCheckpoint{}, "id IN ?", removed).Error; err != nil {
+				return err
+			}
+		}
+		for i, cp := range input.Checkpoints {
+			checkpoint := checkpointFromInput(id, i, cp)
+			if cp.ID == nil {
+				if err := tx.Create(&checkpoint).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(&models.PatrolCheckpoint{}).Where("id = ?", *cp.ID).Updates(map[string]any{
+				"sequence":                checkpoint.Sequence,
+				"name":                    checkpoint.Name,
+				"tag_code":                checkpoint.TagCode,
+				"tag_type":                checkpoint.TagType,
+				"expected_offset_minutes": checkpoint.ExpectedOffsetMinutes,
+				"tolerance_minutes":       checkpoint.ToleranceMinutes,
+				"latitude":                checkpoint.Latitude,
+				"longitude":               checkpoint.Longitude,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.loadRoute(ctx, s.db, id)
+}
+
+// DeleteRoute deletes a route that was never walked; routes with patrol
+// history are deactivated instead so compliance reports keep them
+func (s *patrolsService) DeleteRoute(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "patrol_route.delete", "patrol_route", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.PatrolRoute{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		var runs int64
+		if err := tx.Model(&models.PatrolRun{}).Where("route_id = ?", id).Count(&runs).Error; err != nil {
+			return err
+		}
+		if runs > 0 {
+			return ErrPatrolRouteInUse
+		}
+		if err := tx.Delete(&models.PatrolCheckpoint{}, "route_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.PatrolRoute{}, "id = ?", id).Error
+	})
+}
+
+// StartPatrol starts walking a route on demand, or starts the guard's
+// scheduled patrol of it. A scheduled patrol nobody has started yet can be
+// taken over by another guard covering the route.
+func (s *patrolsService) StartPatrol(ctx context.Context, routeID, guardID uuid.UUID) (*models.PatrolRun, error) {
+	route, err := s.loadRoute(ctx, s.db, routeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireRouteAccess(ctx, route.ID, guardID.String()); err != nil {
+		return nil, err
+	}
+	if !route.IsActive {
+		return nil, ErrPatrolRouteInactive
+	}
+	if len(route.Checkpoints) == 0 {
+		return nil, fmt.Errorf("%w: route has no checkpoints", ErrInvalidPatrolRoute)
+	}
+
+	now := time.Now()
+	var run models.PatrolRun
+	err = s.db.WithContext(ctx).Where("route_id = ? AND status IN ?", routeID, openRunStatuses).First(&run).Error
+	switch {
+	case err == nil:
+		if run.Status == models.PatrolRunInProgress {
+			if run.GuardID != guardID {
+				return nil, ErrPatrolInProgress
+			}
+			return s.loadRun(ctx, run.ID)
+		}
+		result := s.db.WithContext(ctx).Model(&models.PatrolRun{}).
+			Where("id = ? AND status = ?", run.ID, models.PatrolRunScheduled).
+			Updates(map[string]any{"status": models.PatrolRunInProgress, "guard_id": guardID, "started_at": now})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrPatrolInProgress
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		created, err := s.createRun(ctx, route, guardID, now, nil)
+		if err != nil {
+			return nil, err
+		}
+		if created == nil {
+			return nil, ErrPatrolInProgress
+		}
+		run = *created
+	default:
+		return nil, err
+	}
+
+	started, err := s.loadRun(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.publish("patrol_run_started", started)
+	return started, nil
+}
+
+// Scan records a checkpoint tag read by the guard. Scans after the
+// tolerance are late and raise an alert unless the checkpoint was already
+// reported missed.
+func (s *patrolsService) Scan(ctx context.Context, guardID uuid.UUID, scan PatrolScan) (*models.PatrolRun, error) {
+	var checkpoint models.PatrolCheckpoint
+	err := s.db.WithContext(ctx).First(&checkpoint, "tag_code = ?", strings.TrimSpace(scan.TagCode)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownTag
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var run models.PatrolRun
+	err = s.db.WithContext(ctx).
+		Where("route_id = ? AND guard_id = ? AND status IN ?", checkpoint.RouteID, guardID, openRunStatuses).
+		First(&run).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoPatrolRun
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if scan.Fix != nil {
+		if _, err := s.maps.UpdateGuardLocation(ctx, guardID, *scan.Fix); err != nil {
+			log.Printf("Scan location from guard %s ignored: %v", guardID, err)
+		}
+	}
+
+	// The watcher may mark the checkpoint missed between reading and
+	// writing it, so the update is conditional on the status read
+	now := time.Now()
+	var visit models.PatrolVisit
+	var previous models.PatrolVisitStatus
+	scanned := false
+	for attempt := 0; attempt < 2 && !scanned; attempt++ {
+		err := s.db.WithContext(ctx).First(&visit, "run_id = ? AND checkpoint_id = ?", run.ID, checkpoint.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// The checkpoint was added to the route after this patrol started
+			return nil, ErrNoPatrolRun
+		}
+		if err != nil {
+			return nil, err
+		}
+		if visit.ScannedAt != nil {
+			return nil, ErrCheckpointScanned
+		}
+		previous = visit.Status
+		visit.Status = models.PatrolVisitOnTime
+		if previous == models.PatrolVisitMissed || now.After(visit.LateAt) {
+			visit.Status = models.PatrolVisitLate
+		}
+		visit.ScannedAt = &now
+		if scan.Fix != nil {
+			visit.Latitude, visit.Longitude = &scan.Fix.Latitude, &scan.Fix.Longitude
+		}
+		result := s.db.WithContext(ctx).Model(&models.PatrolVisit{}).
+			Where("id = ? AND status = ? AND scanned_at IS NULL", visit.ID, previous).
+			Updates(map[string]any{
+				"status":     visit.Status,
+				"scanned_at": visit.ScannedAt,
+				"latitude":   visit.Latitude,
+				"longitude":  visit.Longitude,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		scanned = result.RowsAffected == 1
+	}
+	if !scanned {
+		return nil, ErrCheckpointScanned
+	}
+
+	if run.Status == models.PatrolRunScheduled {
+		if err := s.db.WithContext(ctx).Model(&models.PatrolRun{}).
+			Where("id = ? AND status = ?", run.ID, models.PatrolRunScheduled).
+			Updates(map[string]any{"status": models.PatrolRunInProgress, "started_at": now}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if visit.Status == models.PatrolVisitLate && previous == models.PatrolVisitPending {
+		s.raiseVisitAlert(ctx, &run, &visit, models.AlertTypePatrolLate)
+	}
+	s.wsHub.Publish([]string{TopicPatrols}, "patrol_checkpoint_scanned", map[string]any{
+		"run_id":   run.ID,
+		"route_id": run.RouteID,
+		"guard_id": run.GuardID,
+		"visit":    visit,
+	})
+	s.finishRun(ctx, run.ID)
+
+	return s.loadRun(ctx, run.ID)
+}
+
+func (s *patrolsService) ListRuns(ctx context.Context, filter PatrolRunFilter, userRole models.UserRole, userID string) ([]models.PatrolRun, error) {
+	query := s.db.WithContext(ctx).Preload("Route").Preload("Guard").Order("created_at DESC")
+	if userRole != models.RoleSCSOperator {
+		query = query.Where("patrol_runs.guard_id = ?", userID)
+	} else if filter.GuardID != nil {
+		query = query.Where("patrol_runs.guard_id = ?", *filter.GuardID)
+	}
+	if filter.RouteID != nil {
+		query = query.Where("patrol_runs.route_id = ?", *filter.RouteID)
+	}
+	if filter.PremiseID != nil {
+		query = query.Where("patrol_runs.route_id IN (?)",
+			s.db.Model(&models.PatrolRoute{}).Select("id").Where("premise_id = ?", *filter.PremiseID))
+	}
+	if filter.Status != "" {
+		query = query.Where("patrol_runs.status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("patrol_runs.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("patrol_runs.created_at < ?", *filter.To)
+	}
+	var runs []models.PatrolRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s *patrolsService) GetRun(ctx context.Context, id uuid.UUID, userRole models.UserRole, userID string) (*models.PatrolRun, error) {
+	run, err := s.loadRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if userRole != models.RoleSCSOperator && run.GuardID.String() != userID {
+		return nil, ErrPermissionDenied
+	}
+	return run, nil
+}
+
+// Compliance aggregates checkpoint outcomes per guard or per premise.
+// Guards only get their own figures.
+func (s *patrolsService) Compliance(ctx context.Context, q PatrolComplianceQuery, userRole models.UserRole, userID string) (*PatrolComplianceReport, error) {
+	if userRole != models.RoleSCSOperator {
+		guardID, err := uuid.Parse(userID)
+		if err != nil {
+			return nil, ErrPermissionDenied
+		}
+		q.GuardID = &guardID
+	}
+	switch q.GroupBy {
+	case "":
+		q.GroupBy = PatrolGroupByGuard
+	case PatrolGroupByGuard, PatrolGroupByPremise:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidGroupBy, q.GroupBy)
+	}
+	if !q.To.After(q.From) {
+		return nil, ErrInvalidTimeRange
+	}
+
+	groupColumn := "patrol_runs.guard_id"
+	if q.GroupBy == PatrolGroupByPremise {
+		groupColumn = "patrol_routes.premise_id"
+	}
+	query := s.db.WithContext(ctx).Table("patrol_visits").
+		Select(groupColumn+" AS "+q.GroupBy+"_id, "+
+			"COUNT(DISTINCT patrol_runs.id) AS runs, "+
+			"COUNT(DISTINCT patrol_runs.id) FILTER (WHERE patrol_runs.status = ?) AS completed_runs, "+
+			"COUNT(*) AS checkpoints, "+
+			"COUNT(*) FILTER (WHERE patrol_visits.status = ?) AS on_time, "+
+			"COUNT(*) FILTER (WHERE patrol_visits.status = ?) AS late, "+
+			"COUNT(*) FILTER (WHERE patrol_visits.status = ?) AS missed",
+			models.PatrolRunCompleted, models.PatrolVisitOnTime, models.PatrolVisitLate, models.PatrolVisitMissed).
+		Joins("JOIN patrol_runs ON patrol_runs.id = patrol_visits.run_id").
+		Joins("JOIN patrol_routes ON patrol_routes.id = patrol_runs.route_id").
+		Where("patrol_visits.due_at >= ? AND patrol_visits.due_at < ?", q.From, q.To).
+		Where("patrol_visits.status <> ?", models.PatrolVisitPending).
+		Group(groupColumn).
+		Order(groupColumn)
+	if q.PremiseID != nil {
+		query = query.Where("patrol_routes.premise_id = ?", *q.PremiseID)
+	}
+	if q.GuardID != nil {
+		query = query.Where("patrol_runs.guard_id = ?", *q.GuardID)
+	}
+
+	report := PatrolComplianceReport{From: q.From, To: q.To, GroupBy: q.GroupBy, Rows: []PatrolCompliance{}}
+	if err := query.Scan(&report.Rows).Error; err != nil {
+		return nil, err
+	}
+	if err := s.nameComplianceRows(ctx, q.GroupBy, report.Rows); err != nil {
+		return nil, err
+	}
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		row.setRates()
+		report.Total.Runs += row.Runs
+		report.Total.CompletedRuns += row.CompletedRuns
+		report.Total.Checkpoints += row.Checkpoints
+		report.Total.OnTime += row.OnTime
+		report.Total.Late += row.Late
+		report.Total.Missed += row.Missed
+	}
+	report.Total.setRates()
+	return &report, nil
+}
+
+func (c *PatrolCompliance) setRates() {
+	if c.Checkpoints == 0 {
+		return
+	}
+	c.ComplianceRate = float64(c.OnTime) / float64(c.Checkpoints)
+	c.CoverageRate = float64(c.OnTime+c.Late) / float64(c.Checkpoints)
+}
+
+func (s *patrolsService) nameComplianceRows(ctx context.Context, groupBy string, rows []PatrolCompliance) error {
+	if groupBy == PatrolGroupByPremise {
+		var premises []models.Premise
+		if err := s.db.WithContext(ctx).Find(&premises).Error; err != nil {
+			return err
+		}
+		names := make(map[uuid.UUID]string, len(premises))
+		for _, p := range premises {
+			names[p.ID] = p.Name
+		}
+		for i := range rows {
+			if rows[i].PremiseID != nil {
+				rows[i].Name = names[*rows[i].PremiseID]
+			}
+		}
+		return nil
+	}
+
+	var guards []models.User
+	if err := s.db.WithContext(ctx).Where("role = ?", models.RoleSecurityGuard).Find(&guards).Error; err != nil {
+		return err
+	}
+	names := make(map[uuid.UUID]string, len(guards))
+	for _, g := range guards {
+		names[g.ID] = strings.TrimSpace(g.FirstName + " " + g.LastName)
+	}
+	for i := range rows {
+		if rows[i].GuardID != nil {
+			rows[i].Name = names[*rows[i].GuardID]
+		}
+	}
+	return nil
+}
+
+func (s *patrolsService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.openScheduled(ctx)
+			s.markMissed(ctx)
+		}
+	}
+}
+
+// openScheduled creates the runs of scheduled routes whose start time has
+// passed today (or yesterday, for patrols crossing midnight). The unique
+// index on route and start keeps replicas from opening a run twice.
+func (s *patrolsService) openScheduled(ctx context.Context) {
+	var routes []models.PatrolRoute
+	if err := s.db.WithContext(ctx).
+		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Where("is_active = ? AND guard_id IS NOT NULL AND cardinality(start_times) > 0", true).
+		Find(&routes).Error; err != nil {
+		log.Printf("Patrol schedule check failed: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range routes {
+		route := &routes[i]
+		if len(route.Checkpoints) == 0 {
+			continue
+		}
+		loc, err := time.LoadLocation(route.Timezone)
+		if err != nil {
+			log.Printf("Patrol route %s has an invalid timezone %q: %v", route.ID, route.Timezone, err)
+			continue
+		}
+		last := route.Checkpoints[len(route.Checkpoints)-1]
+		length := time.Duration(last.ExpectedOffsetMinutes+last.ToleranceMinutes)*time.Minute + s.missedGrace
+
+		local := now.In(loc)
+		for _, day := range []int{-1, 0} {
+			for _, startTime := range route.StartTimes {
+				clock, err := time.Parse("15:04", startTime)
+				if err != nil {
+					continue
+				}
+				start := time.Date(local.Year(), local.Month(), local.Day()+day, clock.Hour(), clock.Minute(), 0, 0, loc)
+				if start.After(now) || now.After(start.Add(length)) {
+					continue
+				}
+				run, err := s.createRun(ctx, route, *route.GuardID, start, &start)
+				if err != nil {
+					log.Printf("Failed to open scheduled patrol of route %s: %v", route.ID, err)
+					continue
+				}
+				if run == nil {
+					continue
+				}
+				s.wsHub.SendToUserWithAck(route.GuardID.String(), "patrol_due", map[string]any{
+					"run_id":          run.ID,
+					"route_id":        route.ID,
+					"route_name":      route.Name,
+					"scheduled_start": start,
+				})
+				s.publish("patrol_run_scheduled", run)
+			}
+		}
+	}
+}
+
+// markMissed marks checkpoints that are still unscanned a grace period
+// after turning late, and raises an alert for each
+func (s *patrolsService) markMissed(ctx context.Context) {
+	var visits []models.PatrolVisit
+	if err := s.db.WithContext(ctx).Model(&visits).Clauses(clause.Returning{}).
+		Where("status = ? AND late_at <= ?", models.PatrolVisitPending, time.Now().Add(-s.missedGrace)).
+		Update("status", models.PatrolVisitMissed).Error; err != nil {
+		log.Printf("Patrol missed checkpoint check failed: %v", err)
+		return
+	}
+
+	runs := make(map[uuid.UUID]bool)
+	for i := range visits {
+		visit := &visits[i]
+		var run models.PatrolRun
+		if err := s.db.WithContext(ctx).First(&run, "id = ?", visit.RunID).Error; err != nil {
+			log.Printf("Failed to load patrol run %s: %v", visit.RunID, err)
+			continue
+		}
+		s.raiseVisitAlert(ctx, &run, visit, models.AlertTypePatrolMissed)
+		s.wsHub.Publish([]string{TopicPatrols}, "patrol_checkpoint_missed", map[string]any{
+			"run_id":   run.ID,
+			"route_id": run.RouteID,
+			"guard_id": run.GuardID,
+			"visit":    visit,
+		})
+		runs[run.ID] = true
+	}
+	for runID := range runs {
+		s.finishRun(ctx, runID)
+	}
+}
+
+// finishRun closes a run once none of its checkpoints is pending
+func (s *patrolsService) finishRun(ctx context.Context, runID uuid.UUID) {
+	var pending, missed int64
+	if err := s.db.WithContext(ctx).Model(&models.PatrolVisit{}).
+		Where("run_id = ? AND status = ?", runID, models.PatrolVisitPending).
+		Count(&pending).Error; err != nil || pending > 0 {
+		return
+	}
+	if err := s.db.WithContext(ctx).Model(&models.PatrolVisit{}).
+		Where("run_id = ? AND status = ?", runID, models.PatrolVisitMissed).
+		Count(&missed).Error; err != nil {
+		return
+	}
+	status := models.PatrolRunCompleted
+	if missed > 0 {
+		status = models.PatrolRunIncomplete
+	}
+	result := s.db.WithContext(ctx).Model(&models.PatrolRun{}).
+		Where("id = ? AND status IN ?", runID, openRunStatuses).
+		Updates(map[string]any{"status": status, "ended_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("Failed to close patrol run %s: %v", runID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	if run, err := s.loadRun(ctx, runID); err == nil {
+		s.publish("patrol_run_ended", run)
+	}
+}
+
+// createRun opens a run with one visit per checkpoint, due from base. It
+// returns nil without an error when the route already has an open run or
+// the scheduled start already has one.
+func (s *patrolsService) createRun(ctx context.Context, route *models.PatrolRoute, guardID uuid.UUID, base time.Time, scheduledStart *time.Time) (*models.PatrolRun, error) {
+	run := models.PatrolRun{
+		ID:             uuid.New(),
+		RouteID:        route.ID,
+		GuardID:        guardID,
+		Status:         models.PatrolRunInProgress,
+		ScheduledStart: scheduledStart,
+	}
+	if scheduledStart != nil {
+		run.Status = models.PatrolRunScheduled
+	} else {
+		run.StartedAt = &base
+	}
+
+	created := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		for _, cp := range route.Checkpoints {
+			due := base.Add(time.Duration(cp.ExpectedOffsetMinutes) * time.Minute)
+			run.Visits = append(run.Visits, models.PatrolVisit{
+				RunID:        run.ID,
+				CheckpointID: cp.ID,
+				Sequence:     cp.Sequence,
+				Name:         cp.Name,
+				Status:       models.PatrolVisitPending,
+				DueAt:        due,
+				LateAt:       due.Add(time.Duration(cp.ToleranceMinutes) * time.Minute),
+			})
+		}
+		if err := tx.Create(&run.Visits).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil || !created {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// raiseVisitAlert raises a late or missed checkpoint alert at the premise
+// of the route and links it to the visit
+func (s *patrolsService) raiseVisitAlert(ctx context.Context, run *models.PatrolRun, visit *models.PatrolVisit, alertType models.AlertType) {
+	var route models.PatrolRoute
+	if err := s.db.WithContext(ctx).Preload("Premise").First(&route, "id = ?", run.RouteID).Error; err != nil {
+		log.Printf("Failed to load patrol route %s: %v", run.RouteID, err)
+		return
+	}
+	var guard models.User
+	if err := s.db.WithContext(ctx).First(&guard, "id = ?", run.GuardID).Error; err != nil {
+		log.Printf("Failed to load guard %s: %v", run.GuardID, err)
+		return
+	}
+
+	due := visit.DueAt
+	if loc, err := time.LoadLocation(route.Timezone); err == nil {
+		due = due.In(loc)
+	}
+	alert := models.Alert{
+		Type:      alertType,
+		Severity:  models.AlertSeverityHigh,
+		Title:     fmt.Sprintf("Missed patrol checkpoint: %s", visit.Name),
+		PremiseID: route.PremiseID,
+		GuardID:   &guard.ID,
+		Description: fmt.Sprintf("%s %s did not scan %s on %s (due %s)",
+			guard.FirstName, guard.LastName, visit.Name, route.Name, due.Format("15:04 MST")),
+	}
+	if alertType == models.AlertTypePatrolLate {
+		alert.Severity = models.AlertSeverityMedium
+		alert.Title = fmt.Sprintf("Late patrol checkpoint: %s", visit.Name)
+		alert.Description = fmt.Sprintf("%s %s scanned %s on %s late (due %s)",
+			guard.FirstName, guard.LastName, visit.Name, route.Name, due.Format("15:04 MST"))
+	}
+	alert.Location = visit.Name
+	if route.Premise != nil {
+		alert.Location = fmt.Sprintf("%s - %s", route.Premise.Name, visit.Name)
+	}
+	var checkpoint models.PatrolCheckpoint
+	if err := s.db.WithContext(ctx).First(&checkpoint, "id = ?", visit.CheckpointID).Error; err == nil {
+		alert.Latitude, alert.Longitude = checkpoint.Latitude, checkpoint.Longitude
+	}
+
+	created, err := s.alerts.CreateAlert(ctx, alert)
+	if errors.Is(err, ErrAlertSuppressed) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to raise %s alert for patrol run %s: %v", alertType, run.ID, err)
+		return
+	}
+	visit.AlertID = &created.ID
+	if err := s.db.WithContext(ctx).Model(&models.PatrolVisit{}).Where("id = ?", visit.ID).Update("alert_id", created.ID).Error; err != nil {
+		log.Printf("Failed to link alert to patrol visit %s: %v", visit.ID, err)
+	}
+}
+
+// validateRoute normalises the input and checks it against the premise,
+// the guard and the tag codes of other routes
+func (s *patrolsService) validateRoute(ctx context.Context, routeID uuid.UUID, input *PatrolRouteInput) error {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidPatrolRoute, input.Timezone)
+	}
+	for i, startTime := range input.StartTimes {
+		clock, err := time.Parse("15:04", strings.TrimSpace(startTime))
+		if err != nil {
+			return fmt.Errorf("%w: start time %q is not HH:MM", ErrInvalidPatrolRoute, startTime)
+		}
+		input.StartTimes[i] = clock.Format("15:04")
+	}
+	if len(input.Checkpoints) == 0 {
+		return fmt.Errorf("%w: at least one checkpoint is required", ErrInvalidPatrolRoute)
+	}
+
+	tags := make(map[string]bool, len(input.Checkpoints))
+	previousOffset := 0
+	for i := range input.Checkpoints {
+		cp := &input.Checkpoints[i]
+		if cp.ExpectedOffsetMinutes < previousOffset {
+			return fmt.Errorf("%w: checkpoint %q is expected before the one preceding it", ErrInvalidPatrolRoute, cp.Name)
+		}
+		previousOffset = cp.ExpectedOffsetMinutes
+		if cp.TagType == "" {
+			cp.TagType = models.TagTypeQR
+		}
+		cp.TagCode = strings.TrimSpace(cp.TagCode)
+		if cp.TagCode == "" {
+			cp.TagCode = newTagCode()
+		}
+		if tags[cp.TagCode] {
+			return fmt.Errorf("%w: %s", ErrDuplicateTagCode, cp.TagCode)
+		}
+		tags[cp.TagCode] = true
+	}
+
+	if err := s.db.WithContext(ctx).First(&models.Premise{}, "id = ?", input.PremiseID).Error; err != nil {
+		return err
+	}
+	if input.GuardID != nil {
+		err := s.db.WithContext(ctx).First(&models.User{}, "id = ? AND role = ?", *input.GuardID, models.RoleSecurityGuard).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: guard not found", ErrInvalidPatrolRoute)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if routeID != uuid.Nil {
+		var ids []uuid.UUID
+		if err := s.db.WithContext(ctx).Model(&models.PatrolCheckpoint{}).Where("route_id = ?", routeID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		own := make(map[uuid.UUID]bool, len(ids))
+		for _, id := range ids {
+			own[id] = true
+		}
+		for _, cp := range input.Checkpoints {
+			if cp.ID != nil && !own[*cp.ID] {
+				return fmt.Errorf("%w: checkpoint %s is not on this route", ErrInvalidPatrolRoute, cp.ID)
+			}
+		}
+	}
+
+	codes := make([]string, 0, len(tags))
+	for code := range tags {
+		codes = append(codes, code)
+	}
+	var taken []string
+	if err := s.db.WithContext(ctx).Model(&models.PatrolCheckpoint{}).
+		Where("tag_code IN ? AND route_id <> ?", codes, routeID).
+		Pluck("tag_code", &taken).Error; err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTagCode, strings.Join(taken, ", "))
+	}
+	return nil
+}
+
+// requireRouteAccess lets a guard use routes assigned to them and
+// unassigned routes of premises where they cover a camera
+func (s *patrolsService) requireRouteAccess(ctx context.Context, routeID uuid.UUID, guardID string) error {
+	var count int64
+	if err := guardRouteScope(s.db.WithContext(ctx).Model(&models.PatrolRoute{}), guardID).
+		Where("id = ?", routeID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+func guardRouteScope(query *gorm.DB, guardID string) *gorm.DB {
+	return query.Where("patrol_routes.guard_id = ? OR (patrol_routes.guard_id IS NULL AND patrol_routes.premise_id IN (?))", guardID,
+		query.Session(&gorm.Session{NewDB: true}).Table("cameras").
+			Select("cameras.premise_id").
+			Joins("JOIN camera_guards ON camera_guards.camera_id = cameras.id").
+			Where("camera_guards.guard_id = ?", guardID))
+}
+
+func (s *patrolsService) loadRoute(ctx context.Context, db *gorm.DB, id uuid.UUID) (*models.PatrolRoute, error) {
+	var route models.PatrolRoute
+	if err := db.WithContext(ctx).
+		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Preload("Guard").
+		First(&route, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func (s *patrolsService) loadRun(ctx context.Context, id uuid.UUID) (*models.PatrolRun, error) {
+	var run models.PatrolRun
+	if err := s.db.WithContext(ctx).
+		Preload("Visits", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Preload("Route").
+		Preload("Guard").
+		First(&run, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *patrolsService) publish(messageType string, run *models.PatrolRun) {
+	s.wsHub.Publish([]string{TopicPatrols}, messageType, run)
+}
+
+func checkpointFromInput(routeID uuid.UUID, index int, cp PatrolCheckpointInput) models.PatrolCheckpoint {
+	return models.PatrolCheckpoint{
+		RouteID:               routeID,
+		Sequence:              index + 1,
+		Name:                  cp.Name,
+		TagCode:               cp.TagCode,
+		TagType:               cp.TagType,
+		ExpectedOffsetMinutes: cp.ExpectedOffsetMinutes,
+		ToleranceMinutes:      cp.ToleranceMinutes,
+		Latitude:              cp.Latitude,
+		Longitude:             cp.Longitude,
+	}
+}
+
+// hideTagCodes keeps tag codes from guards so checkpoints cannot be scanned
+// without visiting them
+func hideTagCodes(route *models.PatrolRoute) {
+	for i := range route.Checkpoints {
+		route.Checkpoints[i].TagCode = ""
+	}
+}
+
+func newTagCode() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return "CP-" + strings.ToUpper(hex.EncodeToString(b))
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateRouteRejectsBadInput(t *testing.T) {
+	s := &patrolsService{}
+	checkpoints := []PatrolCheckpointInput{{Name: "Gate", TagCode: "GATE"}}
+	for _, tt := range []struct {
+		name  string
+		input PatrolRouteInput
+		want  error
+	}{
+		{"unknown timezone", PatrolRouteInput{Timezone: "Mars/Olympus", Checkpoints: checkpoints}, ErrInvalidPatrolRoute},
+		{"bad start time", PatrolRouteInput{StartTimes: []string{"25:00"}, Checkpoints: checkpoints}, ErrInvalidPatrolRoute},
+		{"no checkpoints", PatrolRouteInput{}, ErrInvalidPatrolRoute},
+		{"checkpoints out of order", PatrolRouteInput{Checkpoints: []PatrolCheckpointInput{
+			{Name: "Gate", ExpectedOffsetMinutes: 10},
+			{Name: "Yard", ExpectedOffsetMinutes: 5},
+		}}, ErrInvalidPatrolRoute},
+		{"tag used twice", PatrolRouteInput{Checkpoints: []PatrolCheckpointInput{
+			{Name: "Gate", TagCode: "GATE"},
+			{Name: "Back gate", TagCode: " GATE "},
+		}}, ErrDuplicateTagCode},
+	} {
+		if err := s.validateRoute(context.Background(), uuid.Nil, &tt.input); !errors.Is(err, tt.want) {
+			t.Errorf("%s: validateRoute = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Start times are normalized and the timezone defaults to UTC before the
+	// checkpoints are looked at
+	input := PatrolRouteInput{StartTimes: []string{" 9:05", "22:30"}}
+	s.validateRoute(context.Background(), uuid.Nil, &input)
+	if input.Timezone != "UTC" || input.StartTimes[0] != "09:05" || input.StartTimes[1] != "22:30" {
+		t.Errorf("normalized to %q in %s", input.StartTimes, input.Timezone)
+	}
+}
+
+func TestNewTagCode(t *testing.T) {
+	format := regexp.MustCompile(`^CP-[0-9A-F]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code := newTagCode()
+		if !format.MatchString(code) {
+			t.Fatalf("tag code %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("tag code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestComplianceRates(t *testing.T) {
+	c := PatrolCompliance{Checkpoints: 8, OnTime: 4, Late: 2, Missed: 2}
+	c.setRates()
+	if c.ComplianceRate != 0.5 || c.CoverageRate != 0.75 {
+		t.Errorf("compliance %v, coverage %v, want 0.5 and 0.75", c.ComplianceRate, c.CoverageRate)
+	}
+	empty := PatrolCompliance{}
+	empty.setRates()
+	if empty.ComplianceRate != 0 || empty.CoverageRate != 0 {
+		t.Errorf("rates without checkpoints = %v, %v", empty.ComplianceRate, empty.CoverageRate)
+	}
+}
+
+func TestCheckpointsFromInput(t *testing.T) {
+	routeID := uuid.New()
+	route := &models.PatrolRoute{}
+	for i, cp := range []PatrolCheckpointInput{{Name: "Gate", TagCode: "GATE"}, {Name: "Yard", TagCode: "YARD", ExpectedOffsetMinutes: 10}} {
+		route.Checkpoints = append(route.Checkpoints, checkpointFromInput(routeID, i, cp))
+	}
+	if cp := route.Checkpoints[1]; cp.RouteID != routeID || cp.Sequence != 2 || cp.TagCode != "YARD" || cp.ExpectedOffsetMinutes != 10 {
+		t.Errorf("checkpoint = %+v", cp)
+	}
+	hideTagCodes(route)
+	for _, cp := range route.Checkpoints {
+		if cp.TagCode != "" {
+			t.Errorf("tag code of %s still shown", cp.Name)
+		}
+	}
+}
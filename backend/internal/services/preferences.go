@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cached preferences older than this are reloaded in the background, which
+// is how changes made through another replica arrive
+const preferenceCacheTTL = 30 * time.Second
+
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// notificationEvents are the events users set preferences for, each sent
+// over the realtime feed under the same message type. Events about an alert
+// take its severity; the others always have the one given here.
+var notificationEvents = map[string]models.AlertSeverity{
+	NotifyAlertCreated:     "",
+	NotifyGuardDispatched:  "",
+	NotifyCheckInDue:       models.AlertSeverityHigh,
+	NotifyGuardSOS:         models.AlertSeverityCritical,
+	NotifyLoneWorkerMissed: models.AlertSeverityCritical,
+	NotifyDeliveryFailed:   models.AlertSeverityHigh,
+}
+
+// realtimeEvents always reach the realtime feed: safety events cannot be
+// muted there, so their thresholds and quiet hours only apply to email, SMS
+// and push.
+var realtimeEvents = map[string]bool{
+	NotifyGuardSOS:         true,
+	NotifyLoneWorkerMissed: true,
+}
+
+// defaultNotificationChannels apply to events a user has no preference for,
+// on top of the realtime feed, which carries every event by default. Guards
+// are reached on their phone; operators also get email for escalations.
+var defaultNotificationChannels = map[models.UserRole]map[string][]models.NotificationChannel{
+	models.RoleSecurityGuard: {
+		NotifyGuardDispatched: {models.NotificationChannelPush, models.NotificationChannelSMS},
+		NotifyCheckInDue:      {models.NotificationChannelPush},
+	},
+	models.RoleSCSOperator: {
+		NotifyGuardSOS:         {models.NotificationChannelPush, models.NotificationChannelSMS, models.NotificationChannelEmail},
+		NotifyLoneWorkerMissed: {models.NotificationChannelPush, models.NotificationChannelEmail},
+		NotifyDeliveryFailed:   {models.NotificationChannelPush, models.NotificationChannelEmail},
+	},
+}
+
+var allNotificationChannels = []models.NotificationChannel{
+	models.NotificationChannelRealtime,
+	models.NotificationChannelEmail,
+	models.NotificationChannelSMS,
+	models.NotificationChannelPush,
+}
+
+// Preferences are a user's quiet hours and, for every event, the channels
+// it reaches them on
+type Preferences struct {
+	Settings models.NotificationSettings `json:"settings"`
+	Events   []EventPreference           `json:"events"`
+}
+
+type EventPreference struct {
+	Event    string                   `json:"event"`
+	Channels models.ChannelThresholds `json:"channels" swaggertype:"object,string"`
+	// Default is set while the user has not chosen and the role's defaults apply
+	Default bool `json:"default"`
+}
+
+// PreferencesInput replaces the quiet hours and the channels of the events
+// listed; events left out keep their preference
+type PreferencesInput struct {
+	Timezone               string
+	QuietHoursEnabled      bool
+	QuietHoursStart        string
+	QuietHoursEnd          string
+	CriticalOverridesQuiet bool
+	Events                 map[string]models.ChannelThresholds
+}
+
+// PreferencesService stores notification preferences and answers, from a
+// cache, whether an event may reach a user on a channel. It filters the
+// realtime feed as the hub's MessageFilter, which loads a user's
+// preferences when they connect.
+type PreferencesService interface {
+	GetPreferences(ctx context.Context, userID uuid.UUID) (*Preferences, error)
+	UpdatePreferences(ctx context.Context, userID uuid.UUID, input PreferencesInput) (*Preferences, error)
+	SetEventChannels(ctx context.Context, userID uuid.UUID, event string, channels models.ChannelThresholds) (*Preferences, error)
+	// ResetEvent returns the event to the role's defaults
+	ResetEvent(ctx context.Context, userID uuid.UUID, event string) (*Preferences, error)
+	// ResetPreferences removes quiet hours and every event preference
+	ResetPreferences(ctx context.Context, userID uuid.UUID) (*Preferences, error)
+
+	// Channels lists the channels an event of the given severity reaches the
+	// user on at the given time
+	Channels(ctx context.Context, userID uuid.UUID, event string, severity models.AlertSeverity, at time.Time) ([]models.NotificationChannel, error)
+	websocket.MessageFilter
+}
+
+type preferencesService struct {
+	db         *gorm.DB
+	mutex      sync.Mutex
+	cache      map[uuid.UUID]*userPreferences
+	refreshing map[uuid.UUID]bool
+}
+
+func NewPreferencesService(db *gorm.DB) PreferencesService {
+	return &preferencesService{db: db, cache: make(map[uuid.UUID]*userPreferences), refreshing: make(map[uuid.UUID]bool)}
+}
+
+// userPreferences is what the checks need of a user, loaded in one go
+type userPreferences struct {
+	role     models.UserRole
+	settings *models.NotificationSettings
+	loc      *time.Location
+	events   map[string]models.ChannelThresholds
+	loadedAt time.Time
+}
+
+func (s *preferencesService) GetPreferences(ctx context.Context, userID uuid.UUID) (*Preferences, error) {
+	prefs, err := s.reload(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return prefs.view(userID), nil
+}
+
+func (s *preferencesService) UpdatePreferences(ctx context.Context, userID uuid.UUID, input PreferencesInput) (*Preferences, error) {
+	settings, err := validatePreferenceSettings(userID, input)
+	if err != nil {
+		return nil, err
+	}
+	for event, channels := range input.Events {
+		if err := validateEventChannels(event, channels); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.WithContext(ctx).First(&models.User{}, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(settings).Error; err != nil {
+			return err
+		}
+		for event, channels := range input.Events {
+			if err := saveEventChannels(tx, userID, event, channels); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func (s *preferencesService) SetEventChannels(ctx context.Context, userID uuid.UUID, event string, channels models.ChannelThresholds) (*Preferences, error) {
+	if err := validateEventChannels(event, channels); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).First(&models.User{}, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	if err := saveEventChannels(s.db.WithContext(ctx), userID, event, channels); err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func (s *preferencesService) ResetEvent(ctx context.Context, userID uuid.UUID, event string) (*Preferences, error) {
+	if _, ok := notificationEvents[event]; !ok {
+		return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidPreferences, event)
+	}
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND event = ?", userID, event).
+		Delete(&models.NotificationPreference{}).Error; err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func (s *preferencesService) ResetPreferences(ctx context.Context, userID uuid.UUID) (*Preferences, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.NotificationPreference{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.NotificationSettings{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
+
+func (s *preferencesService) Channels(ctx context.Context, userID uuid.UUID, event string, severity models.AlertSeverity, at time.Time) ([]models.NotificationChannel, error) {
+	prefs, err := s.cached(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var channels []models.NotificationChannel
+	for _, channel := range allNotificationChannels {
+		if prefs.allows(event, channel, severity, at) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels, nil
+}
+
+// AllowMessage decides whether a realtime message reaches the user. It runs
+// with the hub locked, so it only answers from the cache: message types that
+// are not notification events or are always sent in realtime get through,
+// and so does everything while the user's preferences are not loaded yet.
+func (s *preferencesService) AllowMessage(userID string, msg websocket.Message) bool {
+	severity, ok := notificationEvents[msg.Type]
+	if !ok || realtimeEvents[msg.Type] {
+		return true
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return true
+	}
+	prefs := s.peek(id)
+	if prefs == nil {
+		return true
+	}
+	if severity == "" {
+		severity = payloadSeverity(msg.Payload)
+	}
+	return prefs.allows(msg.Type, models.NotificationChannelRealtime, severity, time.Now())
+}
+
+// payloadSeverity reads the severity of the alert a message is about
+func payloadSeverity(payload any) models.AlertSeverity {
+	if m, ok := payload.(map[string]any); ok {
+		if severity, ok := m["severity"]; ok {
+			return models.AlertSeverity(fmt.Sprint(severity))
+		}
+		return ""
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	var alert struct {
+		Severity models.AlertSeverity `json:"severity"`
+	}
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return ""
+	}
+	return alert.Severity
+}
+
+// UserConnected loads the preferences of a user who connected to the
+// realtime feed, so the filter has them at hand
+func (s *preferencesService) UserConnected(userID string) {
+	if id, err := uuid.Parse(userID); err == nil {
+		s.peek(id)
+	}
+}
+
+// cached returns the user's preferences, loading them on first use
+func (s *preferencesService) cached(ctx context.Context, userID uuid.UUID) (*userPreferences, error) {
+	if prefs := s.peek(userID); prefs != nil {
+		return prefs, nil
+	}
+	return s.reload(ctx, userID)
+}
+
+// peek returns the cached preferences without touching the database. Missing
+// and stale entries are loaded in the background; stale ones are still
+// answered from meanwhile.
+func (s *preferencesService) peek(userID uuid.UUID) *userPreferences {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	prefs := s.cache[userID]
+	if (prefs == nil || time.Since(prefs.loadedAt) > preferenceCacheTTL) && !s.refreshing[userID] {
+		s.refreshing[userID] = true
+		go func() {
+			if _, err := s.reload(context.Background(), userID); err != nil {
+				log.Printf("Failed to load preferences of user %s: %v", userID, err)
+			}
+		}()
+	}
+	return prefs
+}
+
+// reload reads the user's preferences and replaces the cached copy
+func (s *preferencesService) reload(ctx context.Context, userID uuid.UUID) (*userPreferences, error) {
+	prefs, err := s.load(ctx, userID)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.refreshing, userID)
+	if err != nil {
+		return nil, err
+	}
+	// A reload that started before a change must not replace the newer copy
+	if current := s.cache[userID]; current == nil || !current.loadedAt.After(prefs.loadedAt) {
+		s.cache[userID] = prefs
+	}
+	return prefs, nil
+}
+
+func (s *preferencesService) load(ctx context.Context, userID uuid.UUID) (*userPreferences, error) {
+	loadedAt := time.Now()
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "role").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	prefs := &userPreferences{role: user.Role, loc: time.UTC, events: make(map[string]models.ChannelThresholds), loadedAt: loadedAt}
+
+	var settings models.NotificationSettings
+	err := s.db.WithContext(ctx).First(&settings, "user_id = ?", userID).Error
+	switch {
+	case err == nil:
+		prefs.settings = &settings
+		if loc, err := time.LoadLocation(settings.Timezone); err == nil {
+			prefs.loc = loc
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	var rows []models.NotificationPreference
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		prefs.events[row.Event] = row.Channels
+	}
+	return prefs, nil
+}
+
+// allows reports whether the event may reach the user on the channel
+func (p *userPreferences) allows(event string, channel models.NotificationChannel, severity models.AlertSeverity, at time.Time) bool {
+	if channel == models.NotificationChannelRealtime && realtimeEvents[event] {
+		return true
+	}
+	min, ok := p.channels(event)[channel]
+	if !ok || severityRank(string(severity)) < severityRank(string(min)) {
+		return false
+	}
+	if severity == models.AlertSeverityCritical && p.settings != nil && p.settings.CriticalOverridesQuiet {
+		return true
+	}
+	return !p.quiet(at)
+}
+
+func (p *userPreferences) channels(event string) models.ChannelThresholds {
+	if channels, ok := p.events[event]; ok {
+		return channels
+	}
+	return defaultEventChannels(p.role, event)
+}
+
+func defaultEventChannels(role models.UserRole, event string) models.ChannelThresholds {
+	channels := models.ChannelThresholds{models.NotificationChannelRealtime: ""}
+	for _, channel := range defaultNotificationChannels[role][event] {
+		channels[channel] = ""
+	}
+	return channels
+}
+
+// quiet reports whether the time falls in the user's quiet hours
+func (p *userPreferences) quiet(at time.Time) bool {
+	if p.settings == nil || !p.settings.QuietHoursEnabled {
+		return false
+	}
+	start, okStart := clockMinutes(p.settings.QuietHoursStart)
+	end, okEnd := clockMinutes(p.settings.QuietHoursEnd)
+	if !okStart || !okEnd {
+		return false
+	}
+	local := at.In(p.loc)
+	now := local.Hour()*60 + local.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// clockMinutes converts "HH:MM" to minutes after midnight
+func clockMinutes(value string) (int, bool) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return clock.Hour()*60 + clock.Minute(), true
+}
+
+// view lists every event with the channels that apply to it
+func (p *userPreferences) view(userID uuid.UUID) *Preferences {
+	view := &Preferences{Settings: models.NotificationSettings{UserID: userID, Timezone: "UTC", CriticalOverridesQuiet: true}}
+	if p.settings != nil {
+		view.Settings = *p.settings
+	}
+	for event := range notificationEvents {
+		_, chosen := p.events[event]
+		view.Events = append(view.Events, EventPreference{Event: event, Channels: p.channels(event), Default: !chosen})
+	}
+	sort.Slice(view.Events, func(i, j int) bool { return view.Events[i].Event < view.Events[j].Event })
+	return view
+}
+
+func validatePreferenceSettings(userID uuid.UUID, input PreferencesInput) (*models.NotificationSettings, error) {
+	settings := &models.NotificationSettings{
+		UserID:                 userID,
+		Timezone:               strings.TrimSpace(input.Timezone),
+		QuietHoursEnabled:      input.QuietHoursEnabled,
+		CriticalOverridesQuiet: input.CriticalOverridesQuiet,
+	}
+	if settings.Timezone == "" {
+		settings.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "Local" {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, settings.Timezone)
+	}
+
+	for _, clock := range []struct {
+		value string
+		dst   *string
+	}{{input.QuietHoursStart, &settings.QuietHoursStart}, {input.QuietHoursEnd, &settings.QuietHoursEnd}} {
+		value := strings.TrimSpace(clock.value)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: quiet hours %q are not HH:MM", ErrInvalidPreferences, value)
+		}
+		*clock.dst = parsed.Format("15:04")
+	}
+	if settings.QuietHoursEnabled {
+		if settings.QuietHoursStart == "" || settings.QuietHoursEnd == "" {
+			return nil, fmt.Errorf("%w: quiet hours need a start and an end", ErrInvalidPreferences)
+		}
+		if settings.QuietHoursStart == settings.QuietHoursEnd {
+			return nil, fmt.Errorf("%w: quiet hours start and end at the same time", ErrInvalidPreferences)
+		}
+	}
+	return settings, nil
+}
+
+func validateEventChannels(event string, channels models.ChannelThresholds) error {
+	if _, ok := notificationEvents[event]; !ok {
+		return fmt.Errorf("%w: unknown event %q", ErrInvalidPreferences, event)
+	}
+	for channel, severity := range channels {
+		switch channel {
+		case models.NotificationChannelRealtime, models.NotificationChannelEmail,
+			models.NotificationChannelSMS, models.NotificationChannelPush:
+		default:
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, channel)
+		}
+		if severity != "" && severityRank(string(severity)) == 0 {
+			return fmt.Errorf("%w: unknown severity %q", ErrInvalidPreferences, severity)
+		}
+	}
+	if realtimeEvents[event] {
+		if severity, ok := channels[models.NotificationChannelRealtime]; !ok || severity != "" {
+			return fmt.Errorf("%w: %s is always sent in realtime", ErrInvalidPreferences, event)
+		}
+	}
+	return nil
+}
+
+func saveEventChannels(tx *gorm.DB, userID uuid.UUID, event string, channels models.ChannelThresholds) error {
+	if channels == nil {
+		channels = models.ChannelThresholds{}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "event"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channels", "updated_at"}),
+	}).Create(&models.NotificationPreference{UserID: userID, Event: event, Channels: channels}).Error
+}
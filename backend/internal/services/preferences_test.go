@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+)
+
+// quietTestPreferences are an operator's with quiet hours from 22:00 to
+// 06:30 in Berlin, email for new alerts from high severity up and guard
+// dispatches muted
+func quietTestPreferences(t *testing.T, criticalOverrides bool) *userPreferences {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &userPreferences{
+		role: models.RoleSCSOperator,
+		settings: &models.NotificationSettings{
+			Timezone: "Europe/Berlin", QuietHoursEnabled: true, QuietHoursStart: "22:00", QuietHoursEnd: "06:30",
+			CriticalOverridesQuiet: criticalOverrides,
+		},
+		loc: loc,
+		events: map[string]models.ChannelThresholds{
+			NotifyAlertCreated:    {models.NotificationChannelRealtime: "", models.NotificationChannelEmail: models.AlertSeverityHigh},
+			NotifyGuardDispatched: {},
+		},
+		loadedAt: time.Now(),
+	}
+}
+
+func testTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
+
+func TestQuietHours(t *testing.T) {
+	prefs := quietTestPreferences(t, false)
+	for _, tt := range []struct {
+		at    string
+		quiet bool
+	}{
+		{"2026-01-15T20:59:00Z", false}, // 21:59 in Berlin
+		{"2026-01-15T21:00:00Z", true},
+		{"2026-01-16T02:00:00Z", true},
+		{"2026-01-16T05:29:00Z", true},
+		{"2026-01-16T05:30:00Z", false}, // 06:30 in Berlin
+		{"2026-07-15T04:15:00Z", true},  // 06:15 in Berlin summer time
+		{"2026-07-15T04:45:00Z", false},
+	} {
+		if got := prefs.quiet(testTime(t, tt.at)); got != tt.quiet {
+			t.Errorf("quiet at %s = %v, want %v", tt.at, got, tt.quiet)
+		}
+	}
+
+	// Quiet hours within one day do not wrap
+	prefs.settings.QuietHoursStart, prefs.settings.QuietHoursEnd = "09:00", "17:00"
+	if !prefs.quiet(testTime(t, "2026-01-15T12:00:00Z")) || prefs.quiet(testTime(t, "2026-01-15T20:00:00Z")) {
+		t.Error("quiet hours from 09:00 to 17:00 do not cover the day only")
+	}
+	prefs.settings.QuietHoursEnabled = false
+	if prefs.quiet(testTime(t, "2026-01-15T12:00:00Z")) {
+		t.Error("disabled quiet hours apply")
+	}
+}
+
+func TestPreferencesAllow(t *testing.T) {
+	day, night := testTime(t, "2026-01-15T12:00:00Z"), testTime(t, "2026-01-16T02:00:00Z")
+	for _, tt := range []struct {
+		name              string
+		criticalOverrides bool
+		event             string
+		channel           models.NotificationChannel
+		severity          models.AlertSeverity
+		at                time.Time
+		want              bool
+	}{
+		{"high alert by email", false, NotifyAlertCreated, models.NotificationChannelEmail, models.AlertSeverityHigh, day, true},
+		{"medium alert under the email threshold", false, NotifyAlertCreated, models.NotificationChannelEmail, models.AlertSeverityMedium, day, false},
+		{"alert on a channel not chosen", false, NotifyAlertCreated, models.NotificationChannelSMS, models.AlertSeverityCritical, day, false},
+		{"email in quiet hours", false, NotifyAlertCreated, models.NotificationChannelEmail, models.AlertSeverityCritical, night, false},
+		{"critical email overriding quiet hours", true, NotifyAlertCreated, models.NotificationChannelEmail, models.AlertSeverityCritical, night, true},
+		{"new alerts in realtime by day", false, NotifyAlertCreated, models.NotificationChannelRealtime, models.AlertSeverityLow, day, true},
+		{"new alerts in realtime in quiet hours", false, NotifyAlertCreated, models.NotificationChannelRealtime, models.AlertSeverityLow, night, false},
+		{"SOS always in realtime", false, NotifyGuardSOS, models.NotificationChannelRealtime, models.AlertSeverityCritical, night, true},
+		{"muted event in realtime", false, NotifyGuardDispatched, models.NotificationChannelRealtime, models.AlertSeverityHigh, day, false},
+		{"operator default for SOS", false, NotifyGuardSOS, models.NotificationChannelSMS, models.AlertSeverityCritical, day, true},
+		{"no default for check-ins", false, NotifyCheckInDue, models.NotificationChannelPush, models.AlertSeverityHigh, day, false},
+	} {
+		prefs := quietTestPreferences(t, tt.criticalOverrides)
+		if got := prefs.allows(tt.event, tt.channel, tt.severity, tt.at); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAllowMessageAnswersFromTheCache(t *testing.T) {
+	s := NewPreferencesService(nil).(*preferencesService)
+	userID := uuid.New()
+	prefs := quietTestPreferences(t, false)
+	prefs.settings.QuietHoursEnabled = false
+	prefs.events[NotifyCheckInDue] = models.ChannelThresholds{models.NotificationChannelRealtime: models.AlertSeverityCritical}
+	s.cache[userID] = prefs
+
+	for _, tt := range []struct {
+		msg  websocket.Message
+		want bool
+	}{
+		{websocket.Message{Type: NotifyGuardDispatched}, false},
+		{websocket.Message{Type: NotifyCheckInDue}, false}, // always high, under the threshold
+		{websocket.Message{Type: NotifyAlertCreated, Payload: map[string]any{"severity": "low"}}, true},
+		{websocket.Message{Type: NotifyGuardSOS}, true},
+		{websocket.Message{Type: "incident_updated"}, true},
+	} {
+		if got := s.AllowMessage(userID.String(), tt.msg); got != tt.want {
+			t.Errorf("AllowMessage(%s) = %v, want %v", tt.msg.Type, got, tt.want)
+		}
+	}
+
+	// Users whose preferences are still loading get everything
+	loading := uuid.New()
+	s.refreshing[loading] = true
+	if !s.AllowMessage(loading.String(), websocket.Message{Type: NotifyGuardDispatched}) {
+		t.Error("message held back while the preferences load")
+	}
+}
+
+func TestPayloadSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		payload any
+		want    models.AlertSeverity
+	}{
+		{map[string]any{"severity": "high"}, models.AlertSeverityHigh},
+		{models.Alert{Severity: models.AlertSeverityCritical}, models.AlertSeverityCritical},
+		{map[string]any{"title": "Gate"}, ""},
+		{"text", ""},
+		{nil, ""},
+	} {
+		if got := payloadSeverity(tt.payload); got != tt.want {
+			t.Errorf("payloadSeverity(%v) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePreferences(t *testing.T) {
+	userID := uuid.New()
+	settings, err := validatePreferenceSettings(userID, PreferencesInput{QuietHoursEnabled: true, QuietHoursStart: " 7:05", QuietHoursEnd: "23:00"})
+	if err != nil {
+		t.Fatalf("validatePreferenceSettings: %v", err)
+	}
+	if settings.UserID != userID || settings.Timezone != "UTC" || settings.QuietHoursStart != "07:05" {
+		t.Errorf("settings = %+v", settings)
+	}
+	for _, input := range []PreferencesInput{
+		{Timezone: "Local"},
+		{Timezone: "Mars/Olympus"},
+		{QuietHoursStart: "7pm"},
+		{QuietHoursEnabled: true, QuietHoursStart: "22:00"},
+		{QuietHoursEnabled: true, QuietHoursStart: "22:00", QuietHoursEnd: "22:00"},
+	} {
+		if _, err := validatePreferenceSettings(userID, input); !errors.Is(err, ErrInvalidPreferences) {
+			t.Errorf("validatePreferenceSettings(%+v) = %v, want ErrInvalidPreferences", input, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		event    string
+		channels models.ChannelThresholds
+	}{
+		{NotifyCheckInDue, models.ChannelThresholds{models.NotificationChannelSMS: models.AlertSeverityHigh}},
+		{NotifyAlertCreated, models.ChannelThresholds{models.NotificationChannelRealtime: models.AlertSeverityHigh}},
+		{NotifyAlertCreated, models.ChannelThresholds{models.NotificationChannelEmail: ""}},
+	} {
+		if err := validateEventChannels(tt.event, tt.channels); err != nil {
+			t.Errorf("validateEventChannels(%s, %v): %v", tt.event, tt.channels, err)
+		}
+	}
+	for _, tt := range []struct {
+		event    string
+		channels models.ChannelThresholds
+	}{
+		{"birthday", nil},
+		{NotifyCheckInDue, models.ChannelThresholds{"pager": ""}},
+		{NotifyCheckInDue, models.ChannelThresholds{models.NotificationChannelSMS: "urgent"}},
+		{NotifyGuardSOS, models.ChannelThresholds{models.NotificationChannelSMS: ""}},
+		{NotifyGuardSOS, models.ChannelThresholds{models.NotificationChannelRealtime: models.AlertSeverityHigh}},
+	} {
+		if err := validateEventChannels(tt.event, tt.channels); !errors.Is(err, ErrInvalidPreferences) {
+			t.Errorf("validateEventChannels(%s, %v) = %v, want ErrInvalidPreferences", tt.event, tt.channels, err)
+		}
+	}
+}
@@ -10,11 +10,30 @@ import (
 )
 
 type PremisesService interface {
-	GetPremises(ctx context.Context) ([]models.Premise, error)
+	GetPremises(ctx context.Context, q ListQuery) (*Page[models.Premise], error)
 	GetPremise(ctx context.Context, id uuid.UUID) (*models.Premise, error)
 	GetPremiseCameras(ctx context.Context, id uuid.UUID) ([]models.Camera, error)
 }
 
+var premiseListSpec = &listSpec[models.Premise]{
+	table: "premises",
+	id:    func(p *models.Premise) uuid.UUID { return p.ID },
+	sorts: map[string]listColumn[models.Premise]{
+		"created_at": {expr: "premises.created_at", kind: cursorTime, value: func(p *models.Premise) any { return p.CreatedAt }},
+		"name":       {expr: "premises.name", kind: cursorString, value: func(p *models.Premise) any { return p.Name }},
+		"type":       {expr: "premises.type", kind: cursorString, value: func(p *models.Premise) any { return string(p.Type) }},
+	},
+	defaultSort: []SortField{{Field: "name"}},
+	filters: map[string]listFilter{
+		"type":      {clause: "premises.type IN ?"},
+		"is_active": {clause: "premises.is_active IN ?", kind: filterBool},
+	},
+	relations: map[string]listRelation{
+		"cameras": {preload: "Cameras"},
+		"alerts":  {preload: "Alerts"},
+	},
+}
+
 type premisesService struct {
 	db *gorm.DB
 }
@@ -23,12 +42,8 @@ func NewPremisesService(db *gorm.DB) PremisesService {
 	return &premisesService{db: db}
 }
 
-func (s *premisesService) GetPremises(ctx context.Context) ([]models.Premise, error) {
-	var premises []models.Premise
-	if err := s.db.WithContext(ctx).Find(&premises).Error; err != nil {
-		return nil, err
-	}
-	return premises, nil
+func (s *premisesService) GetPremises(ctx context.Context, q ListQuery) (*Page[models.Premise], error) {
+	return premiseListSpec.find(s.db.WithContext(ctx).Model(&models.Premise{}), q)
 }
 
 func (s *premisesService) GetPremise(ctx context.Context, id uuid.UUID) (*models.Premise, error) {
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PresenceService reports who is connected to the realtime feed
+type PresenceService interface {
+	GetPresence(ctx context.Context, role string) ([]UserPresence, error)
+	GetConnections(ctx context.Context) ([]websocket.ConnectionInfo, error)
+	Disconnect(ctx context.Context, connectionID, reason string, userRole models.UserRole, userID string) error
+}
+
+// UserPresence is the realtime status of one user. AppVersion and Device
+// come from the user's most recent live connection.
+type UserPresence struct {
+	UserID      uuid.UUID       `json:"user_id"`
+	Username    string          `json:"username"`
+	FirstName   string          `json:"first_name"`
+	LastName    string          `json:"last_name"`
+	Role        models.UserRole `json:"role"`
+	OnDuty      bool            `json:"on_duty"`
+	Online      bool            `json:"online"`
+	Connections int             `json:"connections"`
+	LastSeenAt  *time.Time      `json:"last_seen_at,omitempty"`
+	AppVersion  string          `json:"app_version,omitempty"`
+	Device      string          `json:"device,omitempty"`
+}
+
+type presenceService struct {
+	db    *gorm.DB
+	wsHub *websocket.Hub
+	audit AuditService
+}
+
+// NewPresenceService records last-seen times and publishes presence_changed
+// events for connections opening and closing on this node
+func NewPresenceService(db *gorm.DB, wsHub *websocket.Hub, audit AuditService) PresenceService {
+	s := &presenceService{db: db, wsHub: wsHub, audit: audit}
+	wsHub.OnPresence(s.track)
+	return s
+}
+
+func (s *presenceService) track(event websocket.PresenceEvent) {
+	ctx := context.Background()
+	if err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", event.UserID).
+		Update("last_seen_at", event.At).Error; err != nil {
+		log.Printf("Failed to record last seen for user %s: %v", event.UserID, err)
+	}
+	s.wsHub.Publish([]string{TopicPresence}, "presence_changed", event)
+}
+
+func (s *presenceService) GetPresence(ctx context.Context, role string) ([]UserPresence, error) {
+	connections, err := s.wsHub.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]websocket.ConnectionInfo)
+	counts := make(map[string]int)
+	for _, conn := range connections {
+		counts[conn.UserID]++
+		if current, ok := latest[conn.UserID]; !ok || conn.ConnectedAt.After(current.ConnectedAt) {
+			latest[conn.UserID] = conn
+		}
+	}
+
+	var users []models.User
+	query := s.db.WithContext(ctx).Where("is_active = ?", true)
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if err := query.Order("username").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	presence := make([]UserPresence, 0, len(users))
+	for _, u := range users {
+		id := u.ID.String()
+		p := UserPresence{
+			UserID:      u.ID,
+			Username:    u.Username,
+			FirstName:   u.FirstName,
+			LastName:    u.LastName,
+			Role:        u.Role,
+			OnDuty:      u.OnDuty,
+			Online:      counts[id] > 0,
+			Connections: counts[id],
+			LastSeenAt:  u.LastSeenAt,
+		}
+		if conn, ok := latest[id]; ok {
+			p.AppVersion = conn.AppVersion
+			p.Device = conn.Device
+		}
+		presence = append(presence, p)
+	}
+	return presence, nil
+}
+
+func (s *presenceService) GetConnections(ctx context.Context) ([]websocket.ConnectionInfo, error) {
+	connections, err := s.wsHub.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if connections == nil {
+		connections = []websocket.ConnectionInfo{}
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+	return connections, nil
+}
+
+func (s *presenceService) Disconnect(ctx context.Context, connectionID, reason string, userRole models.UserRole, userID string) error {
+	if reason == "" {
+		reason = "closed by operator"
+	}
+	conn, err := s.wsHub.Disconnect(ctx, connectionID, reason)
+	details := models.JSONMap{"reason": reason}
+	if conn != nil {
+		details["user_id"] = conn.UserID
+		details["node_id"] = conn.NodeID
+	}
+	recordAction(ctx, s.audit, "connection.disconnect", "connection", connectionID, userID, userRole, err, details)
+	return err
+}
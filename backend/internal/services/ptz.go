@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/onvif"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPTZNotSupported     = errors.New("camera does not support PTZ")
+	ErrPresetsNotSupported = errors.New("camera does not support presets")
+	ErrCameraLocked        = errors.New("camera is controlled by another operator")
+	ErrLockNotHeld         = errors.New("camera control lock not held")
+)
+
+// PTZService controls pan/tilt/zoom cameras through ONVIF
+type PTZService interface {
+	GetLock(ctx context.Context, cameraID string) (*models.PTZLock, error)
+	AcquireLock(ctx context.Context, cameraID string, userID string, userRole models.UserRole) (*models.PTZLock, error)
+	ReleaseLock(ctx context.Context, cameraID string, userID string, userRole models.UserRole) error
+	Move(ctx context.Context, cameraID string, velocity onvif.Vector, duration time.Duration, userID string, userRole models.UserRole) error
+	Stop(ctx context.Context, cameraID string, userID string, userRole models.UserRole) error
+	GetPresets(ctx context.Context, cameraID string, userID string, userRole models.UserRole) ([]onvif.Preset, error)
+	GotoPreset(ctx context.Context, cameraID string, token string, userID string, userRole models.UserRole) error
+	SavePreset(ctx context.Context, cameraID string, name string, userID string, userRole models.UserRole) (*onvif.Preset, error)
+}
+
+type ptzService struct {
+	db      *gorm.DB
+	wsHub   *websocket.Hub
+	audit   AuditService
+	clients onvif.Factory
+	lockTTL time.Duration
+}
+
+func NewPTZService(db *gorm.DB, wsHub *websocket.Hub, audit AuditService, clients onvif.Factory, lockTTL time.Duration) PTZService {
+	return &ptzService{
+		db:      db,
+		wsHub:   wsHub,
+		audit:   audit,
+		clients: clients,
+		lockTTL: lockTTL,
+	}
+}
+
+// GetLock returns the current lock on a camera, or nil if it is free
+func (s *ptzService) GetLock(ctx context.Context, cameraID string) (*models.PTZLock, error) {
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).Select("id").First(&camera, "id = ?", cameraID).Error; err != nil {
+		return nil, err
+	}
+	var lock models.PTZLock
+	err := s.db.WithContext(ctx).First(&lock, "camera_id = ? AND expires_at > ?", camera.ID, time.Now()).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func (s *ptzService) AcquireLock(ctx context.Context, cameraID string, userID string, userRole models.UserRole) (*models.PTZLock, error) {
+	camera, err := s.ptzCamera(ctx, cameraID)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.lock(ctx, camera.ID, userID)
+	recordAction(ctx, s.audit, "ptz.lock", "camera", cameraID, userID, userRole, err, nil)
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (s *ptzService) ReleaseLock(ctx context.Context, cameraID string, userID string, userRole models.UserRole) error {
+	cameraID = normalizeID(cameraID)
+	result := s.db.WithContext(ctx).
+		Where("camera_id = ? AND user_id = ? AND expires_at > ?", cameraID, userID, time.Now()).
+		Delete(&models.PTZLock{})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		err = ErrLockNotHeld
+	}
+
+	recordAction(ctx, s.audit, "ptz.unlock", "camera", cameraID, userID, userRole, err, nil)
+	if err != nil {
+		return err
+	}
+	s.wsHub.BroadcastToRole("scs_operator", "camera_control_released", map[string]any{
+		"camera_id": cameraID,
+		"user_id":   userID,
+	})
+	return nil
+}
+
+func (s *ptzService) Move(ctx context.Context, cameraID string, velocity onvif.Vector, duration time.Duration, userID string, userRole models.UserRole) error {
+	client, err := s.control(ctx, cameraID, userID, false)
+	if err == nil {
+		err = client.ContinuousMove(ctx, velocity, duration)
+	}
+	recordAction(ctx, s.audit, "ptz.move", "camera", cameraID, userID, userRole, err, models.JSONMap{
+		"pan":         velocity.Pan,
+		"tilt":        velocity.Tilt,
+		"zoom":        velocity.Zoom,
+		"duration_ms": duration.Milliseconds(),
+	})
+	return err
+}
+
+func (s *ptzService) Stop(ctx context.Context, cameraID string, userID string, userRole models.UserRole) error {
+	client, err := s.control(ctx, cameraID, userID, false)
+	if err == nil {
+		err = client.Stop(ctx)
+	}
+	recordAction(ctx, s.audit, "ptz.stop", "camera", cameraID, userID, userRole, err, nil)
+	return err
+}
+
+func (s *ptzService) GetPresets(ctx context.Context, cameraID string, userID string, userRole models.UserRole) ([]onvif.Preset, error) {
+	camera, err := s.ptzCamera(ctx, cameraID)
+	if err != nil {
+		return nil, err
+	}
+	if !camera.PresetsSupported {
+		return nil, ErrPresetsNotSupported
+	}
+	return s.clients(device(camera)).GetPresets(ctx)
+}
+
+func (s *ptzService) GotoPreset(ctx context.Context, cameraID string, token string, userID string, userRole models.UserRole) error {
+	client, err := s.control(ctx, cameraID, userID, true)
+	if err == nil {
+		err = client.GotoPreset(ctx, token)
+	}
+	recordAction(ctx, s.audit, "ptz.goto_preset", "camera", cameraID, userID, userRole, err, models.JSONMap{"preset_token": token})
+	return err
+}
+
+func (s *ptzService) SavePreset(ctx context.Context, cameraID string, name string, userID string, userRole models.UserRole) (*onvif.Preset, error) {
+	var preset *onvif.Preset
+	client, err := s.control(ctx, cameraID, userID, true)
+	if err == nil {
+		var token string
+		if token, err = client.SetPreset(ctx, name); err == nil {
+			preset = &onvif.Preset{Token: token, Name: name}
+		}
+	}
+	details := models.JSONMap{"preset_name": name}
+	if preset != nil {
+		details["preset_token"] = preset.Token
+	}
+	recordAction(ctx, s.audit, "ptz.save_preset", "camera", cameraID, userID, userRole, err, details)
+	return preset, err
+}
+
+// control validates the camera, takes or refreshes the caller's lock and
+// returns a client for it
+func (s *ptzService) control(ctx context.Context, cameraID string, userID string, presets bool) (onvif.Client, error) {
+	camera, err := s.ptzCamera(ctx, cameraID)
+	if err != nil {
+		return nil, err
+	}
+	if presets && !camera.PresetsSupported {
+		return nil, ErrPresetsNotSupported
+	}
+	if _, err := s.lock(ctx, camera.ID, userID); err != nil {
+		return nil, err
+	}
+	return s.clients(device(camera)), nil
+}
+
+// lock acquires or extends the lock for userID in one statement, so two
+// replicas racing for a free camera cannot both win
+func (s *ptzService) lock(ctx context.Context, cameraID uuid.UUID, userID string) (*models.PTZLock, error) {
+	// Postgres keeps microseconds; truncating lets the returned acquired_at
+	// tell a new lock from an extended one
+	now := time.Now().Truncate(time.Microsecond)
+	lock := models.PTZLock{CameraID: cameraID, UserID: userID, AcquiredAt: now, ExpiresAt: now.Add(s.lockTTL)}
+
+	// A free or expired lock is taken over and the caller's own is extended;
+	// one held by someone else is left alone and no row comes back
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "camera_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"user_id":     userID,
+			"acquired_at": gorm.Expr("CASE WHEN ptz_locks.user_id = ? AND ptz_locks.expires_at > ? THEN ptz_locks.acquired_at ELSE ? END", userID, now, now),
+			"expires_at":  lock.ExpiresAt,
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("ptz_locks.user_id = ? OR ptz_locks.expires_at <= ?", userID, now),
+		}},
+	}, clause.Returning{}).Create(&lock)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCameraLocked
+	}
+
+	if lock.AcquiredAt.Equal(now) {
+		s.wsHub.BroadcastToRole("scs_operator", "camera_control_locked", lock)
+	}
+	return &lock, nil
+}
+
+func (s *ptzService) ptzCamera(ctx context.Context, cameraID string) (*models.Camera, error) {
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).First(&camera, "id = ?", cameraID).Error; err != nil {
+		return nil, err
+	}
+	if !camera.PTZSupported || camera.ONVIFAddress == "" {
+		return nil, ErrPTZNotSupported
+	}
+	return &camera, nil
+}
+
+// normalizeID returns the canonical form of a UUID string, or s unchanged
+func normalizeID(s string) string {
+	if id, err := uuid.Parse(s); err == nil {
+		return id.String()
+	}
+	return s
+}
+
+func device(camera *models.Camera) onvif.Device {
+	return onvif.Device{
+		Address:  camera.ONVIFAddress,
+		Username: camera.ONVIFUsername,
+		Password: camera.ONVIFPassword,
+		Profile:  camera.ONVIFProfile,
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/onvif"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// testAudit keeps audit entries in memory
+type testAudit struct {
+	mutex   sync.Mutex
+	entries []models.AuditLog
+}
+
+func (a *testAudit) Record(ctx context.Context, entry models.AuditLog) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.entries = append(a.entries, entry)
+}
+
+func (a *testAudit) List(ctx context.Context, filter AuditFilter) ([]models.AuditLog, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]models.AuditLog(nil), a.entries...), nil
+}
+
+// createTestPTZCamera adds a PTZ camera on the simulator and removes it with
+// its lock after the test
+func createTestPTZCamera(t *testing.T, db *gorm.DB) *models.Camera {
+	t.Helper()
+	camera := createTestCamera(t, db, func(camera *models.Camera) {
+		camera.PTZSupported = true
+		camera.PresetsSupported = true
+		camera.ONVIFAddress = "sim://" + uuid.NewString()
+	})
+	cleanupTestRows(t, db, &models.PTZLock{}, "camera_id = ?", camera.ID)
+	return camera
+}
+
+// newTestPTZReplicas returns services standing in for replicas of the API,
+// sharing the database and the simulated cameras
+func newTestPTZReplicas(db *gorm.DB, sim *onvif.Simulator, n int, lockTTL time.Duration) []PTZService {
+	replicas := make([]PTZService, n)
+	for i := range replicas {
+		hub := websocket.NewHub(websocket.NewMemoryBackplane(), websocket.NewMemoryOutbox(10, time.Hour), websocket.DeliveryOptions{})
+		replicas[i] = NewPTZService(db, hub, &testAudit{}, sim.Client, lockTTL)
+	}
+	return replicas
+}
+
+func TestPTZLockContention(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	sim := onvif.NewSimulator()
+	replicas := newTestPTZReplicas(db, sim, 2, time.Minute)
+	camera := createTestPTZCamera(t, db)
+	cameraID := camera.ID.String()
+	alice, bob := uuid.NewString(), uuid.NewString()
+	simulated := sim.Camera(camera.ONVIFAddress)
+
+	// Moving takes the lock
+	if err := replicas[0].Move(ctx, cameraID, onvif.Vector{Pan: 0.5}, time.Second, alice, models.RoleSCSOperator); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	lock, err := replicas[1].GetLock(ctx, cameraID)
+	if err != nil || lock == nil || lock.UserID != alice {
+		t.Fatalf("lock seen by the other replica = %+v, %v", lock, err)
+	}
+	acquired := lock.AcquiredAt
+
+	// The other operator is turned away on every replica and the camera
+	// does not move
+	for _, replica := range replicas {
+		if err := replica.Move(ctx, cameraID, onvif.Vector{Pan: -1}, time.Second, bob, models.RoleSCSOperator); !errors.Is(err, ErrCameraLocked) {
+			t.Errorf("Move by another operator = %v, want ErrCameraLocked", err)
+		}
+		if _, err := replica.AcquireLock(ctx, cameraID, bob, models.RoleSCSOperator); !errors.Is(err, ErrCameraLocked) {
+			t.Errorf("AcquireLock by another operator = %v, want ErrCameraLocked", err)
+		}
+		if err := replica.ReleaseLock(ctx, cameraID, bob, models.RoleSCSOperator); !errors.Is(err, ErrLockNotHeld) {
+			t.Errorf("ReleaseLock by another operator = %v, want ErrLockNotHeld", err)
+		}
+	}
+	if simulated.Moves != 1 || simulated.Position.Pan != 0.5 {
+		t.Errorf("camera moved %d times to %+v, want once to pan 0.5", simulated.Moves, simulated.Position)
+	}
+
+	// The holder keeps the lock across replicas, and extending it keeps
+	// the time it was first taken
+	preset, err := replicas[1].SavePreset(ctx, cameraID, "Gate", alice, models.RoleSCSOperator)
+	if err != nil {
+		t.Fatalf("SavePreset by the holder on the other replica: %v", err)
+	}
+	if lock, _ := replicas[0].GetLock(ctx, cameraID); lock == nil || !lock.AcquiredAt.Equal(acquired) {
+		t.Errorf("extended lock = %+v, want it acquired at %v", lock, acquired)
+	}
+
+	if err := replicas[1].ReleaseLock(ctx, cameraID, alice, models.RoleSCSOperator); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if lock, err := replicas[0].GetLock(ctx, cameraID); lock != nil || err != nil {
+		t.Errorf("lock after release = %+v, %v", lock, err)
+	}
+	if err := replicas[0].GotoPreset(ctx, cameraID, preset.Token, bob, models.RoleSCSOperator); err != nil {
+		t.Fatalf("GotoPreset once the camera is free: %v", err)
+	}
+	if lock, _ := replicas[1].GetLock(ctx, cameraID); lock == nil || lock.UserID != bob {
+		t.Errorf("lock = %+v, want it held by the second operator", lock)
+	}
+}
+
+func TestPTZLockExpires(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	replicas := newTestPTZReplicas(db, onvif.NewSimulator(), 2, 100*time.Millisecond)
+	camera := createTestPTZCamera(t, db)
+	cameraID := camera.ID.String()
+	alice, bob := uuid.NewString(), uuid.NewString()
+
+	if _, err := replicas[0].AcquireLock(ctx, cameraID, alice, models.RoleSCSOperator); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if _, err := replicas[1].AcquireLock(ctx, cameraID, bob, models.RoleSCSOperator); !errors.Is(err, ErrCameraLocked) {
+		t.Fatalf("AcquireLock of a held camera = %v, want ErrCameraLocked", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if lock, err := replicas[1].GetLock(ctx, cameraID); lock != nil || err != nil {
+		t.Errorf("expired lock still reported: %+v, %v", lock, err)
+	}
+	lock, err := replicas[1].AcquireLock(ctx, cameraID, bob, models.RoleSCSOperator)
+	if err != nil || lock.UserID != bob {
+		t.Fatalf("AcquireLock of an expired lock = %+v, %v", lock, err)
+	}
+	// The previous holder's release does not free the new holder's lock
+	if err := replicas[0].ReleaseLock(ctx, cameraID, alice, models.RoleSCSOperator); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("ReleaseLock by the previous holder = %v, want ErrLockNotHeld", err)
+	}
+}
+
+func TestPTZLockRaceHasOneWinner(t *testing.T) {
+	db := testDB(t)
+	replicas := newTestPTZReplicas(db, onvif.NewSimulator(), 4, time.Minute)
+	camera := createTestPTZCamera(t, db)
+
+	var wins atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(replica PTZService) {
+			defer wg.Done()
+			_, err := replica.AcquireLock(context.Background(), camera.ID.String(), uuid.NewString(), models.RoleSCSOperator)
+			switch {
+			case err == nil:
+				wins.Add(1)
+			case !errors.Is(err, ErrCameraLocked):
+				t.Errorf("AcquireLock: %v", err)
+			}
+		}(replicas[i%len(replicas)])
+	}
+	wg.Wait()
+	if wins.Load() != 1 {
+		t.Errorf("%d operators got the lock, want 1", wins.Load())
+	}
+}
+
+func TestPTZChecksTheCamera(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	ptz := newTestPTZReplicas(db, onvif.NewSimulator(), 1, time.Minute)[0]
+	user := uuid.NewString()
+
+	if _, err := ptz.GetLock(ctx, uuid.NewString()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetLock of an unknown camera = %v, want ErrRecordNotFound", err)
+	}
+	camera := createTestPTZCamera(t, db)
+	if err := db.Model(camera).Updates(map[string]any{"ptz_supported": false}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ptz.AcquireLock(ctx, camera.ID.String(), user, models.RoleSCSOperator); !errors.Is(err, ErrPTZNotSupported) {
+		t.Errorf("AcquireLock of a fixed camera = %v, want ErrPTZNotSupported", err)
+	}
+	db.Model(camera).Updates(map[string]any{"ptz_supported": true, "presets_supported": false})
+	if _, err := ptz.SavePreset(ctx, camera.ID.String(), "Gate", user, models.RoleSCSOperator); !errors.Is(err, ErrPresetsNotSupported) {
+		t.Errorf("SavePreset without preset support = %v, want ErrPresetsNotSupported", err)
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/recording"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoRecordings is returned when no footage covers the requested window
+var ErrNoRecordings = errors.New("no recordings found for the requested window")
+
+// alertFootageMargin is how far around an alert footage counts as alert-linked
+// for retention purposes
+const alertFootageMargin = 5 * time.Minute
+
+// RecordingsService maintains the recording catalogue and assembles clips
+type RecordingsService interface {
+	GetSegments(ctx context.Context, cameraID string, from, to time.Time) ([]models.RecordingSegment, error)
+	GetClipSegments(ctx context.Context, alert *models.Alert, before, after time.Duration) ([]models.RecordingSegment, error)
+	OpenClip(ctx context.Context, segments []models.RecordingSegment) (io.ReadCloser, error)
+	GetRetentionPolicy(ctx context.Context, premiseID uuid.UUID) (*models.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, premiseID uuid.UUID, retentionDays, alertRetentionDays int) (*models.RetentionPolicy, error)
+	Sync(ctx context.Context) error
+	Purge(ctx context.Context) (int, error)
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type recordingsService struct {
+	db                   *gorm.DB
+	adapter              recording.Adapter
+	recorder             recording.Recorder
+	defaultRetentionDays int
+}
+
+// NewRecordingsService creates the service. recorder may be nil when footage
+// is produced outside this process (NVR/VMS or an external recorder).
+func NewRecordingsService(db *gorm.DB, adapter recording.Adapter, recorder recording.Recorder, defaultRetentionDays int) RecordingsService {
+	return &recordingsService{db: db, adapter: adapter, recorder: recorder, defaultRetentionDays: defaultRetentionDays}
+}
+
+// GetSegments returns catalogued segments of a camera overlapping [from, to]
+func (s *recordingsService) GetSegments(ctx context.Context, cameraID string, from, to time.Time) ([]models.RecordingSegment, error) {
+	var segments []models.RecordingSegment
+	err := s.db.WithContext(ctx).
+		Where("camera_id = ? AND end_time >= ? AND start_time <= ?", cameraID, from, to).
+		Order("start_time ASC").
+		Find(&segments).Error
+	return segments, err
+}
+
+// GetClipSegments returns the segments covering the window around an alert
+func (s *recordingsService) GetClipSegments(ctx context.Context, alert *models.Alert, before, after time.Duration) ([]models.RecordingSegment, error) {
+	if alert.CameraID == nil {
+		return nil, ErrNoRecordings
+	}
+	segments, err := s.GetSegments(ctx, alert.CameraID.String(), alert.CreatedAt.Add(-before), alert.CreatedAt.Add(after))
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, ErrNoRecordings
+	}
+	return segments, nil
+}
+
+// OpenClip returns the given MPEG-TS segments read back to back. The first
+// segment is opened before returning, so a clip that cannot start fails here
+// rather than midway through the response: a purged segment is reported as
+// ErrNoRecordings. Later segments that have since been purged are skipped.
+func (s *recordingsService) OpenClip(ctx context.Context, segments []models.RecordingSegment) (io.ReadCloser, error) {
+	if len(segments) == 0 {
+		return nil, ErrNoRecordings
+	}
+	first, err := s.adapter.Open(ctx, segments[0].Location)
+	if err != nil {
+		if errors.Is(err, recording.ErrNotFound) {
+			return nil, fmt.Errorf("%w: segment %s is gone", ErrNoRecordings, segments[0].ID)
+		}
+		return nil, fmt.Errorf("failed to open segment %s: %w", segments[0].ID, err)
+	}
+	return &clipReader{ctx: ctx, adapter: s.adapter, current: first, segments: segments[1:]}, nil
+}
+
+// clipReader opens each segment of a clip as the previous one runs out
+type clipReader struct {
+	ctx      context.Context
+	adapter  recording.Adapter
+	current  io.ReadCloser
+	segments []models.RecordingSegment
+}
+
+func (r *clipReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.segments) == 0 {
+				return 0, io.EOF
+			}
+			seg := r.segments[0]
+			r.segments = r.segments[1:]
+			next, err := r.adapter.Open(r.ctx, seg.Location)
+			if errors.Is(err, recording.ErrNotFound) {
+				log.Printf("Skipping purged segment %s of clip", seg.ID)
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to open segment %s: %w", seg.ID, err)
+			}
+			r.current = next
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *clipReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+// GetRetentionPolicy returns the policy of a premise, or the default if none is set
+func (s *recordingsService) GetRetentionPolicy(ctx context.Context, premiseID uuid.UUID) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	err := s.db.WithContext(ctx).First(&policy, "premise_id = ?", premiseID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.RetentionPolicy{PremiseID: premiseID, RetentionDays: s.defaultRetentionDays}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (s *recordingsService) SetRetentionPolicy(ctx context.Context, premiseID uuid.UUID, retentionDays, alertRetentionDays int) (*models.RetentionPolicy, error) {
+	if err := s.db.WithContext(ctx).First(&models.Premise{}, "id = ?", premiseID).Error; err != nil {
+		return nil, err
+	}
+	policy := models.RetentionPolicy{
+		PremiseID:          premiseID,
+		RetentionDays:      retentionDays,
+		AlertRetentionDays: alertRetentionDays,
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "premise_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"retention_days", "alert_retention_days", "updated_at"}),
+	}).Create(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRetentionPolicy(ctx, premiseID)
+}
+
+// Sync pulls new segments from the adapter into the catalogue
+func (s *recordingsService) Sync(ctx context.Context) error {
+	var cameras []models.Camera
+	if err := s.db.WithContext(ctx).Find(&cameras).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, camera := range cameras {
+		// Re-read from the start of the newest known segment so that the
+		// segment currently being written gets its end time extended
+		from := now.Add(-24 * time.Hour)
+		var latest models.RecordingSegment
+		err := s.db.WithContext(ctx).
+			Where("camera_id = ? AND source = ?", camera.ID, s.adapter.Name()).
+			Order("start_time DESC").
+			First(&latest).Error
+		if err == nil {
+			from = latest.StartTime
+		}
+
+		found, err := s.adapter.List(ctx, recording.Camera{ID: camera.ID.String(), StreamURL: camera.StreamURL}, from, now)
+		if err != nil {
+			log.Printf("Recording sync failed for camera %s: %v", camera.ID, err)
+			continue
+		}
+		for _, seg := range found {
+			row := models.RecordingSegment{
+				CameraID:  camera.ID,
+				StartTime: seg.Start,
+				EndTime:   seg.End,
+				Source:    s.adapter.Name(),
+				Location:  seg.Location,
+				SizeBytes: seg.SizeBytes,
+			}
+			err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "camera_id"}, {Name: "source"}, {Name: "location"}},
+				DoUpdates: clause.AssignmentColumns([]string{"end_time", "size_bytes", "updated_at"}),
+			}).Create(&row).Error
+			if err != nil {
+				log.Printf("Failed to index segment %s: %v", seg.Location, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Purge deletes segments that fall outside their premise retention policy
+func (s *recordingsService) Purge(ctx context.Context) (int, error) {
+	var premises []models.Premise
+	if err := s.db.WithContext(ctx).Find(&premises).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	now := time.Now()
+	for _, premise := range premises {
+		policy, err := s.GetRetentionPolicy(ctx, premise.ID)
+		if err != nil {
+			return purged, err
+		}
+		if policy.RetentionDays <= 0 {
+			continue
+		}
+
+		query := s.db.WithContext(ctx).
+			Where("camera_id IN (?)", s.db.Model(&models.Camera{}).Select("id").Where("premise_id = ?", premise.ID)).
+			Where("end_time < ?", now.AddDate(0, 0, -policy.RetentionDays))
+		if policy.AlertRetentionDays > policy.RetentionDays {
+			// Keep footage around alerts until the longer alert retention expires
+			margin := fmt.Sprintf("interval '%d minutes'", int(alertFootageMargin.Minutes()))
+			query = query.Where(`NOT (end_time >= ? AND EXISTS (
+				SELECT 1 FROM alerts a WHERE a.camera_id = recording_segments.camera_id
+				AND a.created_at BETWEEN recording_segments.start_time - `+margin+` AND recording_segments.end_time + `+margin+`))`,
+				now.AddDate(0, 0, -policy.AlertRetentionDays))
+		}
+
+		var expired []models.RecordingSegment
+		if err := query.Find(&expired).Error; err != nil {
+			return purged, err
+		}
+		for _, seg := range expired {
+			if err := s.adapter.Delete(ctx, seg.Location); err != nil {
+				log.Printf("Failed to delete segment %s: %v", seg.Location, err)
+				continue
+			}
+			if err := s.db.WithContext(ctx).Delete(&seg).Error; err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Run syncs the catalogue every interval and purges expired footage hourly
+func (s *recordingsService) Run(ctx context.Context, interval time.Duration) {
+	syncTicker := time.NewTicker(interval)
+	purgeTicker := time.NewTicker(time.Hour)
+	defer syncTicker.Stop()
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			if s.recorder != nil {
+				s.startRecorders(ctx)
+			}
+			if err := s.Sync(ctx); err != nil {
+				log.Printf("Recording sync failed: %v", err)
+			}
+		case <-purgeTicker.C:
+			n, err := s.Purge(ctx)
+			if err != nil {
+				log.Printf("Recording purge failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Purged %d expired recording segments", n)
+			}
+		}
+	}
+}
+
+// startRecorders keeps the local recorder in line with the active cameras
+func (s *recordingsService) startRecorders(ctx context.Context) {
+	var cameras []models.Camera
+	if err := s.db.WithContext(ctx).Where("status = ?", models.CameraStatusActive).Find(&cameras).Error; err != nil {
+		log.Printf("Failed to list cameras to record: %v", err)
+		return
+	}
+	targets := make([]recording.Camera, 0, len(cameras))
+	for _, camera := range cameras {
+		targets = append(targets, recording.Camera{ID: camera.ID.String(), StreamURL: camera.StreamURL})
+	}
+	s.recorder.Record(ctx, targets)
+}
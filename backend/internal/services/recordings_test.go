@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/recording"
+)
+
+// testFootage is an adapter over segments kept in memory by location
+type testFootage map[string]string
+
+func (f testFootage) Name() string { return "test" }
+
+func (f testFootage) List(ctx context.Context, camera recording.Camera, from, to time.Time) ([]recording.Segment, error) {
+	return nil, nil
+}
+
+func (f testFootage) Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	data, ok := f[location]
+	if !ok {
+		return nil, recording.ErrNotFound
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (f testFootage) Delete(ctx context.Context, location string) error {
+	delete(f, location)
+	return nil
+}
+
+func TestOpenClipReadsSegmentsBackToBack(t *testing.T) {
+	footage := testFootage{"a.ts": "first,", "b.ts": "", "d.ts": "last"}
+	s := NewRecordingsService(nil, footage, nil, 30)
+	segments := []models.RecordingSegment{{Location: "a.ts"}, {Location: "b.ts"}, {Location: "c.ts"}, {Location: "d.ts"}}
+
+	// Empty and purged segments in the middle are skipped
+	clip, err := s.OpenClip(context.Background(), segments)
+	if err != nil {
+		t.Fatalf("OpenClip: %v", err)
+	}
+	data, err := io.ReadAll(clip)
+	clip.Close()
+	if err != nil || string(data) != "first,last" {
+		t.Errorf("clip reads %q, %v", data, err)
+	}
+
+	// A clip whose first segment is gone cannot start
+	if _, err := s.OpenClip(context.Background(), segments[2:]); !errors.Is(err, ErrNoRecordings) {
+		t.Errorf("OpenClip from a purged segment = %v, want ErrNoRecordings", err)
+	}
+	if _, err := s.OpenClip(context.Background(), nil); !errors.Is(err, ErrNoRecordings) {
+		t.Errorf("OpenClip of no segments = %v, want ErrNoRecordings", err)
+	}
+}
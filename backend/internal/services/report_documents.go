@@ -0,0 +1,443 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/pdf"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	reportTimeLayout  = "2006-01-02 15:04"
+	incidentAlertJoin = "JOIN alerts ON alerts.id = incidents.alert_id"
+)
+
+// reportDocument is the content of a report independent of its format: a
+// summary followed by sections, each with optional figures and a table
+type reportDocument struct {
+	title    string
+	period   string
+	summary  [][2]string
+	sections []reportSection
+}
+
+type reportSection struct {
+	heading string
+	summary [][2]string
+	columns []string
+	rows    [][]string
+}
+
+func (d *reportDocument) pdf() ([]byte, error) {
+	doc := pdf.New(d.title)
+	doc.Title(d.title)
+	doc.Small(d.period + " · generated " + time.Now().UTC().Format(reportTimeLayout) + " UTC")
+	if len(d.summary) > 0 {
+		doc.KeyValues(d.summary)
+	}
+	for _, section := range d.sections {
+		doc.Heading(section.heading)
+		if len(section.summary) > 0 {
+			doc.KeyValues(section.summary)
+		}
+		if len(section.columns) > 0 {
+			doc.Table(section.columns, section.rows)
+		}
+	}
+	return doc.Bytes()
+}
+
+// csv writes the sections one after another, separated by blank lines, so
+// the file opens as a single sheet
+func (d *reportDocument) csv() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	write := func(cells ...string) {
+		for i := range cells {
+			cells[i] = csvCell(cells[i])
+		}
+		w.Write(cells)
+	}
+	write(d.title)
+	write(d.period)
+	for _, pair := range d.summary {
+		write(pair[0], pair[1])
+	}
+	for _, section := range d.sections {
+		write()
+		write(section.heading)
+		for _, pair := range section.summary {
+			write(pair[0], pair[1])
+		}
+		if len(section.columns) > 0 {
+			write(section.columns...)
+			for _, row := range section.rows {
+				write(row...)
+			}
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvCell stops spreadsheets from evaluating text that starts like a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// reportSpec is a resolved request for one report
+type reportSpec struct {
+	kind      models.ReportKind
+	format    models.ReportFormat
+	premiseID *uuid.UUID
+	from, to  time.Time
+	loc       *time.Location
+}
+
+func (spec reportSpec) premises() []uuid.UUID {
+	if spec.premiseID == nil {
+		return nil
+	}
+	return []uuid.UUID{*spec.premiseID}
+}
+
+func (spec reportSpec) analyticsQuery(bucket string) AnalyticsQuery {
+	return AnalyticsQuery{From: spec.from, To: spec.to, Bucket: bucket, Timezone: spec.loc.String(), PremiseIDs: spec.premises()}
+}
+
+func (spec reportSpec) time(t time.Time) string {
+	return t.In(spec.loc).Format(reportTimeLayout)
+}
+
+// premiseScope restricts a query joined to alerts to the report's premise
+func (spec reportSpec) premiseScope(query *gorm.DB) *gorm.DB {
+	if spec.premiseID != nil {
+		return query.Where("alerts.premise_id = ?", *spec.premiseID)
+	}
+	return query
+}
+
+func (s *reportsService) buildDocument(ctx context.Context, spec reportSpec, premiseName string) (*reportDocument, error) {
+	doc := &reportDocument{
+		title:  reportTitle(spec.kind) + " — " + premiseName,
+		period: fmt.Sprintf("%s to %s (%s)", spec.time(spec.from), spec.time(spec.to), spec.loc),
+	}
+	var err error
+	switch spec.kind {
+	case models.ReportKindShiftHandover:
+		err = s.shiftHandover(ctx, spec, doc)
+	case models.ReportKindPremiseSummary:
+		err = s.premiseSummary(ctx, spec, doc)
+	case models.ReportKindIncidents:
+		err = s.incidentReport(ctx, spec, doc)
+	default:
+		err = fmt.Errorf("%w: unknown kind %q", ErrInvalidReport, spec.kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func reportTitle(kind models.ReportKind) string {
+	switch kind {
+	case models.ReportKindShiftHandover:
+		return "Shift handover"
+	case models.ReportKindPremiseSummary:
+		return "Security summary"
+	case models.ReportKindIncidents:
+		return "Incident report"
+	}
+	return string(kind)
+}
+
+// shiftHandover lists the work still open for the next shift and what
+// happened during this one
+func (s *reportsService) shiftHandover(ctx context.Context, spec reportSpec, doc *reportDocument) error {
+	db := s.db.WithContext(ctx)
+	openAlertStatuses := []models.AlertStatus{models.AlertStatusPending, models.AlertStatusAcknowledged, models.AlertStatusAssigned}
+	openIncidentStatuses := []models.IncidentStatus{models.IncidentStatusOpen, models.IncidentStatusInProgress}
+
+	var openAlerts []models.Alert
+	if err := spec.premiseScope(db.Preload("AssignedGuard")).
+		Where("alerts.status IN ?", openAlertStatuses).
+		Order(severityRankSQL("alerts.severity") + " DESC, alerts.created_at").
+		Find(&openAlerts).Error; err != nil {
+		return err
+	}
+
+	var openIncidents []models.Incident
+	if err := spec.premiseScope(db.Joins(incidentAlertJoin).Preload("Alert").Preload("AssignedGuards").
+		Preload("Updates", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") })).
+		Where("incidents.status IN ?", openIncidentStatuses).
+		Order("incidents.created_at").
+		Find(&openIncidents).Error; err != nil {
+		return err
+	}
+
+	var raised []models.Alert
+	if err := spec.premiseScope(db.Model(&models.Alert{})).
+		Where("alerts.created_at >= ? AND alerts.created_at < ?", spec.from, spec.to).
+		Order("alerts.created_at").
+		Find(&raised).Error; err != nil {
+		return err
+	}
+
+	var updates []models.IncidentUpdate
+	if err := spec.premiseScope(db.Preload("Guard").
+		Joins("JOIN incidents ON incidents.id = incident_updates.incident_id").
+		Joins(incidentAlertJoin)).
+		Preload("Incident.Alert").
+		Where("incident_updates.created_at >= ? AND incident_updates.created_at < ?", spec.from, spec.to).
+		Order("incident_updates.created_at").
+		Find(&updates).Error; err != nil {
+		return err
+	}
+
+	// Resolved as analytics counts it: the alert or its incident reaching a
+	// final status
+	var resolved int64
+	if err := spec.premiseScope(db.Model(&models.StatusChange{}).
+		Joins("JOIN alerts ON alerts.id = status_changes.alert_id")).
+		Where("status_changes.to_status IN ?", []string{"resolved", "closed", "false_alarm"}).
+		Where("status_changes.created_at >= ? AND status_changes.created_at < ?", spec.from, spec.to).
+		Distinct("status_changes.alert_id").
+		Count(&resolved).Error; err != nil {
+		return err
+	}
+
+	doc.summary = [][2]string{
+		{"Alerts raised this shift", fmt.Sprint(len(raised))},
+		{"Alerts resolved this shift", fmt.Sprint(resolved)},
+		{"Alerts still open", fmt.Sprint(len(openAlerts))},
+		{"Incidents still open", fmt.Sprint(len(openIncidents))},
+	}
+
+	open := reportSection{heading: "Open alerts", columns: []string{"Raised", "Severity", "Title", "Location", "Status", "Assigned guard"}}
+	for _, alert := range openAlerts {
+		open.rows = append(open.rows, []string{
+			spec.time(alert.CreatedAt), string(alert.Severity), alert.Title, alert.Location, string(alert.Status), userName(alert.AssignedGuard),
+		})
+	}
+
+	incidents := reportSection{heading: "Open incidents", columns: []string{"Opened", "Alert", "Status", "Guards", "Last update"}}
+	for _, incident := range openIncidents {
+		last := ""
+		if len(incident.Updates) > 0 {
+			latest := incident.Updates[0]
+			last = spec.time(latest.CreatedAt) + " " + string(latest.Type) + ": " + latest.Message
+		}
+		incidents.rows = append(incidents.rows, []string{
+			spec.time(incident.CreatedAt), incident.Alert.Title, string(incident.Status), guardNames(incident.AssignedGuards), last,
+		})
+	}
+
+	raisedSection := reportSection{heading: "Alerts raised this shift", columns: []string{"Raised", "Severity", "Type", "Title", "Status"}}
+	for _, alert := range raised {
+		raisedSection.rows = append(raisedSection.rows, []string{
+			spec.time(alert.CreatedAt), string(alert.Severity), string(alert.Type), alert.Title, string(alert.Status),
+		})
+	}
+
+	timeline := reportSection{heading: "Incident updates this shift", columns: []string{"Time", "Guard", "Incident", "Type", "Message"}}
+	for _, update := range updates {
+		timeline.rows = append(timeline.rows, []string{
+			spec.time(update.CreatedAt), userName(&update.Guard), update.Incident.Alert.Title, string(update.Type), update.Message,
+		})
+	}
+
+	doc.sections = []reportSection{open, incidents, raisedSection, timeline}
+	return nil
+}
+
+// premiseSummary is the periodic client summary built on the analytics
+// reports: volumes, response times, false alarms, guards and incidents
+func (s *reportsService) premiseSummary(ctx context.Context, spec reportSpec, doc *reportDocument) error {
+	bucket := BucketDay
+	if spec.to.Sub(spec.from) > 62*24*time.Hour {
+		bucket = BucketWeek
+	}
+	q := spec.analyticsQuery(bucket)
+
+	times, err := s.analytics.ResponseTimes(ctx, q)
+	if err != nil {
+		return err
+	}
+	falseAlarms, err := s.analytics.FalseAlarms(ctx, q)
+	if err != nil {
+		return err
+	}
+	bySeverity, err := s.analytics.Volumes(ctx, q, VolumeBySeverity)
+	if err != nil {
+		return err
+	}
+	byType, err := s.analytics.Volumes(ctx, q, VolumeByType)
+	if err != nil {
+		return err
+	}
+	guards, err := s.analytics.GuardPerformance(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	falseAlarmRate := "—"
+	if falseAlarms.Overall.Rate != nil {
+		falseAlarmRate = fmt.Sprintf("%.1f%%", *falseAlarms.Overall.Rate*100)
+	}
+	doc.summary = [][2]string{
+		{"Alerts raised", fmt.Sprint(times.Overall.Alerts)},
+		{"Alerts closed out", fmt.Sprint(falseAlarms.Overall.Closed)},
+		{"False alarms", fmt.Sprintf("%d (%s of closed)", falseAlarms.Overall.FalseAlarms, falseAlarmRate)},
+		{"Mean time to acknowledge", meanDuration(times.Overall.Acknowledge)},
+		{"Mean time to assign", meanDuration(times.Overall.Assign)},
+		{"Mean time to arrive", meanDuration(times.Overall.Arrive)},
+		{"Mean time to resolve", meanDuration(times.Overall.Resolve)},
+	}
+
+	severities := []string{string(models.AlertSeverityCritical), string(models.AlertSeverityHigh), string(models.AlertSeverityMedium), string(models.AlertSeverityLow)}
+	perBucket := reportSection{heading: "Alerts per " + bucket, columns: append([]string{"From", "Total"}, severities...)}
+	for _, b := range bySeverity.Buckets {
+		counts := map[string]int{}
+		for _, group := range b.Groups {
+			counts[group.Key] = group.Count
+		}
+		row := []string{b.Start.In(spec.loc).Format("2006-01-02"), fmt.Sprint(b.Total)}
+		for _, severity := range severities {
+			row = append(row, fmt.Sprint(counts[severity]))
+		}
+		perBucket.rows = append(perBucket.rows, row)
+	}
+
+	types := reportSection{heading: "Alerts by type", columns: []string{"Type", "Alerts"}}
+	for _, total := range byType.Totals {
+		types.rows = append(types.rows, []string{total.Label, fmt.Sprint(total.Count)})
+	}
+
+	guardSection := reportSection{heading: "Guard performance", columns: []string{"Guard", "Incidents", "Resolved", "Mean time to arrive", "Mean time to resolve"}}
+	for _, guard := range guards.Guards {
+		guardSection.rows = append(guardSection.rows, []string{
+			strings.TrimSpace(guard.FirstName + " " + guard.LastName), fmt.Sprint(guard.Incidents), fmt.Sprint(guard.Resolved),
+			meanDuration(guard.Arrive), meanDuration(guard.Resolve),
+		})
+	}
+
+	var incidents []models.Incident
+	if err := spec.premiseScope(s.db.WithContext(ctx).Joins(incidentAlertJoin).Preload("Alert").Preload("AssignedGuards")).
+		Where("incidents.created_at >= ? AND incidents.created_at < ?", spec.from, spec.to).
+		Order("incidents.created_at").
+		Find(&incidents).Error; err != nil {
+		return err
+	}
+	incidentSection := reportSection{heading: "Incidents", columns: []string{"Opened", "Alert", "Severity", "Status", "Guards"}}
+	for _, incident := range incidents {
+		incidentSection.rows = append(incidentSection.rows, []string{
+			spec.time(incident.CreatedAt), incident.Alert.Title, string(incident.Alert.Severity), string(incident.Status), guardNames(incident.AssignedGuards),
+		})
+	}
+
+	doc.sections = []reportSection{perBucket, types, guardSection, incidentSection}
+	if spec.premiseID == nil {
+		byPremise, err := s.analytics.Volumes(ctx, q, VolumeByPremise)
+		if err != nil {
+			return err
+		}
+		premises := reportSection{heading: "Alerts by premise", columns: []string{"Premise", "Alerts"}}
+		for _, total := range byPremise.Totals {
+			premises.rows = append(premises.rows, []string{total.Label, fmt.Sprint(total.Count)})
+		}
+		doc.sections = append(doc.sections[:2], append([]reportSection{premises}, doc.sections[2:]...)...)
+	}
+	return nil
+}
+
+// incidentReport details every incident opened in the period with its
+// timeline of updates
+func (s *reportsService) incidentReport(ctx context.Context, spec reportSpec, doc *reportDocument) error {
+	var incidents []models.Incident
+	if err := spec.premiseScope(s.db.WithContext(ctx).Joins(incidentAlertJoin).Preload("Alert.Premise").Preload("AssignedGuards").
+		Preload("Updates", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Updates.Guard")).
+		Where("incidents.created_at >= ? AND incidents.created_at < ?", spec.from, spec.to).
+		Order("incidents.created_at").
+		Find(&incidents).Error; err != nil {
+		return err
+	}
+
+	byStatus := map[models.IncidentStatus]int{}
+	for _, incident := range incidents {
+		byStatus[incident.Status]++
+	}
+	doc.summary = [][2]string{{"Incidents", fmt.Sprint(len(incidents))}}
+	for _, status := range []models.IncidentStatus{models.IncidentStatusOpen, models.IncidentStatusInProgress, models.IncidentStatusResolved, models.IncidentStatusClosed} {
+		doc.summary = append(doc.summary, [2]string{strings.ReplaceAll(string(status), "_", " "), fmt.Sprint(byStatus[status])})
+	}
+
+	for _, incident := range incidents {
+		section := reportSection{
+			heading: incident.Alert.Title,
+			summary: [][2]string{
+				{"Opened", spec.time(incident.CreatedAt)},
+				{"Status", string(incident.Status)},
+				{"Premise", incident.Alert.Premise.Name},
+				{"Location", incident.Location},
+				{"Type", string(incident.Alert.Type)},
+				{"Severity", string(incident.Alert.Severity)},
+				{"Guards", guardNames(incident.AssignedGuards)},
+				{"Description", incident.Description},
+			},
+			columns: []string{"Time", "Guard", "Type", "Message"},
+		}
+		for _, update := range incident.Updates {
+			section.rows = append(section.rows, []string{
+				spec.time(update.CreatedAt), userName(&update.Guard), string(update.Type), update.Message,
+			})
+		}
+		doc.sections = append(doc.sections, section)
+	}
+	return nil
+}
+
+// meanDuration formats a mean as hours, minutes and seconds
+func meanDuration(stat DurationStat) string {
+	if stat.MeanSeconds == nil {
+		return "—"
+	}
+	return formatDuration(time.Duration(*stat.MeanSeconds * float64(time.Second)))
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
+func userName(user *models.User) string {
+	if user == nil || user.ID == uuid.Nil {
+		return ""
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+func guardNames(guards []models.User) string {
+	names := make([]string, len(guards))
+	for i := range guards {
+		names[i] = userName(&guards[i])
+	}
+	return strings.Join(names, ", ")
+}
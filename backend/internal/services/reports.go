@@ -0,0 +1,595 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/cron"
+	mailer "smart-city-surveillance/pkg/mail"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxReportPeriod = 366 * 24 * time.Hour
+
+var ErrInvalidReport = errors.New("invalid report")
+
+// ReportScheduleInput creates or replaces a schedule
+type ReportScheduleInput struct {
+	Name       string
+	Kind       models.ReportKind
+	Format     models.ReportFormat
+	PremiseID  *uuid.UUID
+	Cron       string
+	Timezone   string
+	Recipients []string
+	IsActive   bool
+}
+
+// ReportRequest generates a report on demand. A zero From covers the
+// kind's default period before To, and a zero To ends now.
+type ReportRequest struct {
+	Kind       models.ReportKind
+	Format     models.ReportFormat
+	PremiseID  *uuid.UUID
+	From       time.Time
+	To         time.Time
+	Timezone   string
+	Recipients []string
+}
+
+// ReportsService generates shift handover, premise summary and incident
+// reports as PDF or CSV, on demand or on a cron schedule. Every report is
+// archived in media storage and emailed to its recipients, if any.
+//
+// A scheduled report covers the time since the schedule last ran, or the
+// kind's default period on the first run.
+type ReportsService interface {
+	ListSchedules(ctx context.Context) ([]models.ReportSchedule, error)
+	GetSchedule(ctx context.Context, id uuid.UUID) (*models.ReportSchedule, error)
+	CreateSchedule(ctx context.Context, input ReportScheduleInput, userID string) (*models.ReportSchedule, error)
+	UpdateSchedule(ctx context.Context, id uuid.UUID, input ReportScheduleInput, userID string) (*models.ReportSchedule, error)
+	DeleteSchedule(ctx context.Context, id uuid.UUID, userID string) error
+	// RunSchedule generates a schedule's report now, without moving its next run
+	RunSchedule(ctx context.Context, id uuid.UUID, userID string) (*models.Report, error)
+	Generate(ctx context.Context, req ReportRequest, userID string) (*models.Report, error)
+	ListReports(ctx context.Context, q ListQuery) (*Page[models.Report], error)
+	GetReport(ctx context.Context, id uuid.UUID) (*models.Report, error)
+	OpenReport(ctx context.Context, id uuid.UUID) (*models.Report, io.ReadCloser, error)
+	// Run generates scheduled reports as they fall due until ctx is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type reportsService struct {
+	db        *gorm.DB
+	store     storage.Storage
+	analytics AnalyticsService
+	mail      mailer.Sender
+	audit     AuditService
+}
+
+func NewReportsService(db *gorm.DB, store storage.Storage, analytics AnalyticsService, mail mailer.Sender, audit AuditService) ReportsService {
+	return &reportsService{db: db, store: store, analytics: analytics, mail: mail, audit: audit}
+}
+
+var reportListSpec = &listSpec[models.Report]{
+	table: "reports",
+	id:    func(r *models.Report) uuid.UUID { return r.ID },
+	sorts: map[string]listColumn[models.Report]{
+		"created_at":   {expr: "reports.created_at", kind: cursorTime, value: func(r *models.Report) any { return r.CreatedAt }},
+		"period_start": {expr: "reports.period_start", kind: cursorTime, value: func(r *models.Report) any { return r.PeriodStart }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"kind":            {clause: "reports.kind IN ?"},
+		"format":          {clause: "reports.format IN ?"},
+		"premise_id":      {clause: "reports.premise_id IN ?", kind: filterUUID},
+		"schedule_id":     {clause: "reports.schedule_id IN ?", kind: filterUUID},
+		"delivery_status": {clause: "reports.delivery_status IN ?"},
+	},
+	relations: map[string]listRelation{
+		"premise": {preload: "Premise"},
+	},
+}
+
+// defaultReportPeriod is what a report covers when nothing says otherwise:
+// a 12-hour shift, a week for summaries and a day of incidents
+func defaultReportPeriod(kind models.ReportKind) time.Duration {
+	switch kind {
+	case models.ReportKindShiftHandover:
+		return 12 * time.Hour
+	case models.ReportKindPremiseSummary:
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func validReportKind(kind models.ReportKind) bool {
+	switch kind {
+	case models.ReportKindShiftHandover, models.ReportKindPremiseSummary, models.ReportKindIncidents:
+		return true
+	}
+	return false
+}
+
+func validReportFormat(format models.ReportFormat) bool {
+	return format == models.ReportFormatPDF || format == models.ReportFormatCSV
+}
+
+func reportLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = "UTC"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidReport, name)
+	}
+	return loc, nil
+}
+
+// reportRecipients checks and normalises email addresses
+func reportRecipients(recipients []string) ([]string, error) {
+	addresses := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		recipient = strings.TrimSpace(recipient)
+		if recipient == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an email address", ErrInvalidReport, recipient)
+		}
+		addresses = append(addresses, address.String())
+	}
+	return addresses, nil
+}
+
+func (s *reportsService) checkPremise(ctx context.Context, premiseID *uuid.UUID) error {
+	if premiseID == nil {
+		return nil
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Premise{}).Where("id = ?", *premiseID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: premise not found", ErrInvalidReport)
+	}
+	return nil
+}
+
+func (s *reportsService) ListSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	var schedules []models.ReportSchedule
+	if err := s.db.WithContext(ctx).Preload("Premise").Order("name").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (s *reportsService) GetSchedule(ctx context.Context, id uuid.UUID) (*models.ReportSchedule, error) {
+	var schedule models.ReportSchedule
+	if err := s.db.WithContext(ctx).Preload("Premise").First(&schedule, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// applyScheduleInput validates input onto schedule and works out its next run
+func (s *reportsService) applyScheduleInput(ctx context.Context, schedule *models.ReportSchedule, input ReportScheduleInput) error {
+	if !validReportKind(input.Kind) {
+		return fmt.Errorf("%w: kind must be shift_handover, premise_summary or incident_report", ErrInvalidReport)
+	}
+	if !validReportFormat(input.Format) {
+		return fmt.Errorf("%w: format must be pdf or csv", ErrInvalidReport)
+	}
+	expr, err := cron.Parse(input.Cron)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+	}
+	timezone := input.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := reportLocation(timezone)
+	if err != nil {
+		return err
+	}
+	recipients, err := reportRecipients(input.Recipients)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("%w: at least one recipient is required", ErrInvalidReport)
+	}
+	if err := s.checkPremise(ctx, input.PremiseID); err != nil {
+		return err
+	}
+
+	schedule.Name = input.Name
+	schedule.Kind = input.Kind
+	schedule.Format = input.Format
+	schedule.PremiseID = input.PremiseID
+	schedule.Cron = strings.TrimSpace(input.Cron)
+	schedule.Timezone = timezone
+	schedule.Recipients = recipients
+	schedule.IsActive = input.IsActive
+	schedule.NextRunAt = nil
+	if input.IsActive {
+		next := expr.Next(time.Now().In(loc))
+		if next.IsZero() {
+			return fmt.Errorf("%w: %q never runs", ErrInvalidReport, input.Cron)
+		}
+		schedule.NextRunAt = &next
+	}
+	return nil
+}
+
+func (s *reportsService) CreateSchedule(ctx context.Context, input ReportScheduleInput, userID string) (schedule *models.ReportSchedule, err error) {
+	defer func() {
+		resourceID := ""
+		if schedule != nil {
+			resourceID = schedule.ID.String()
+		}
+		recordAction(ctx, s.audit, "report_schedule.create", "report_schedule", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	created := models.ReportSchedule{}
+	if err := s.applyScheduleInput(ctx, &created, input); err != nil {
+		return nil, err
+	}
+	if creator, err := uuid.Parse(userID); err == nil {
+		created.CreatedByID = &creator
+	}
+	if err := s.db.WithContext(ctx).Create(&created).Error; err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(ctx, created.ID)
+}
+
+func (s *reportsService) UpdateSchedule(ctx context.Context, id uuid.UUID, input ReportScheduleInput, userID string) (schedule *models.ReportSchedule, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "report_schedule.update", "report_schedule", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	var existing models.ReportSchedule
+	if err := s.db.WithContext(ctx).First(&existing, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.applyScheduleInput(ctx, &existing, input); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Save(&existing).Error; err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(ctx, id)
+}
+
+func (s *reportsService) DeleteSchedule(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "report_schedule.delete", "report_schedule", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	// Reports already generated stay in the archive
+	result := s.db.WithContext(ctx).Delete(&models.ReportSchedule{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (s *reportsService) RunSchedule(ctx context.Context, id uuid.UUID, userID string) (report *models.Report, err error) {
+	defer func() {
+		details := models.JSONMap{"schedule_id": id.String()}
+		resourceID := ""
+		if report != nil {
+			resourceID = report.ID.String()
+		}
+		recordAction(ctx, s.audit, "report.generate", "report", resourceID, userID, models.RoleSCSOperator, err, details)
+	}()
+
+	schedule, err := s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := reportLocation(schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now().Truncate(time.Minute)
+	spec := reportSpec{
+		kind:      schedule.Kind,
+		format:    schedule.Format,
+		premiseID: schedule.PremiseID,
+		from:      scheduledPeriodStart(schedule, to),
+		to:        to,
+		loc:       loc,
+	}
+	return s.generate(ctx, spec, schedule.Recipients, &schedule.ID, requester(userID))
+}
+
+func (s *reportsService) Generate(ctx context.Context, req ReportRequest, userID string) (report *models.Report, err error) {
+	defer func() {
+		resourceID := ""
+		if report != nil {
+			resourceID = report.ID.String()
+		}
+		recordAction(ctx, s.audit, "report.generate", "report", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	if !validReportKind(req.Kind) {
+		return nil, fmt.Errorf("%w: kind must be shift_handover, premise_summary or incident_report", ErrInvalidReport)
+	}
+	format := req.Format
+	if format == "" {
+		format = models.ReportFormatPDF
+	}
+	if !validReportFormat(format) {
+		return nil, fmt.Errorf("%w: format must be pdf or csv", ErrInvalidReport)
+	}
+	loc, err := reportLocation(req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := reportRecipients(req.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPremise(ctx, req.PremiseID); err != nil {
+		return nil, err
+	}
+
+	to := req.To
+	if to.IsZero() {
+		to = time.Now().Truncate(time.Minute)
+	}
+	from := req.From
+	if from.IsZero() {
+		from = to.Add(-defaultReportPeriod(req.Kind))
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidReport)
+	}
+	if to.Sub(from) > maxReportPeriod {
+		return nil, fmt.Errorf("%w: period is longer than a year", ErrInvalidReport)
+	}
+
+	spec := reportSpec{kind: req.Kind, format: format, premiseID: req.PremiseID, from: from, to: to, loc: loc}
+	return s.generate(ctx, spec, recipients, nil, requester(userID))
+}
+
+func requester(userID string) *uuid.UUID {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// scheduledPeriodStart continues from the previous run so that consecutive
+// reports cover the time between them without gaps
+func scheduledPeriodStart(schedule *models.ReportSchedule, to time.Time) time.Time {
+	if schedule.LastRunAt != nil && schedule.LastRunAt.Before(to) && to.Sub(*schedule.LastRunAt) <= maxReportPeriod {
+		return *schedule.LastRunAt
+	}
+	return to.Add(-defaultReportPeriod(schedule.Kind))
+}
+
+// generate renders, archives and delivers one report. A failed delivery is
+// recorded on the report rather than failing it.
+func (s *reportsService) generate(ctx context.Context, spec reportSpec, recipients []string, scheduleID, requestedBy *uuid.UUID) (*models.Report, error) {
+	premiseName := "All premises"
+	if spec.premiseID != nil {
+		var premise models.Premise
+		if err := s.db.WithContext(ctx).First(&premise, "id = ?", *spec.premiseID).Error; err != nil {
+			return nil, err
+		}
+		premiseName = premise.Name
+	}
+
+	doc, err := s.buildDocument(ctx, spec, premiseName)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	contentType := "application/pdf"
+	switch spec.format {
+	case models.ReportFormatCSV:
+		content, err = doc.csv()
+		contentType = "text/csv; charset=utf-8"
+	default:
+		content, err = doc.pdf()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+
+	report := &models.Report{
+		ID:             uuid.New(),
+		ScheduleID:     scheduleID,
+		Kind:           spec.kind,
+		Format:         spec.format,
+		Title:          doc.title,
+		PremiseID:      spec.premiseID,
+		PeriodStart:    spec.from,
+		PeriodEnd:      spec.to,
+		Timezone:       spec.loc.String(),
+		ContentType:    contentType,
+		SizeBytes:      int64(len(content)),
+		Recipients:     recipients,
+		DeliveryStatus: models.ReportDeliveryNone,
+		RequestedByID:  requestedBy,
+	}
+	report.FileName = reportFileName(spec, premiseName)
+	report.StorageKey = fmt.Sprintf("reports/%s/%s.%s", time.Now().UTC().Format("2006/01"), report.ID, spec.format)
+	if err := s.store.Put(ctx, report.StorageKey, bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("failed to store report: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		s.store.Delete(ctx, report.StorageKey)
+		return nil, err
+	}
+
+	if len(recipients) > 0 {
+		s.deliver(ctx, report, doc, content, spec)
+	}
+	return report, nil
+}
+
+func (s *reportsService) deliver(ctx context.Context, report *models.Report, doc *reportDocument, content []byte, spec reportSpec) {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n%s\n\n", doc.title, doc.period)
+	for _, pair := range doc.summary {
+		fmt.Fprintf(&text, "%s: %s\n", pair[0], pair[1])
+	}
+	text.WriteString("\nThe full report is attached.\n")
+
+	err := s.mail.Send(ctx, mailer.Message{
+		To:      report.Recipients,
+		Subject: doc.title + ", " + spec.from.In(spec.loc).Format("2 Jan") + " to " + spec.to.In(spec.loc).Format("2 Jan 2006"),
+		Text:    text.String(),
+		Attachments: []mailer.Attachment{
+			{Name: report.FileName, ContentType: report.ContentType, Data: content},
+		},
+	})
+
+	updates := map[string]any{}
+	if err != nil {
+		log.Printf("Failed to email report %s: %v", report.ID, err)
+		report.DeliveryStatus = models.ReportDeliveryFailed
+		report.DeliveryError = err.Error()
+		updates["delivery_error"] = report.DeliveryError
+	} else {
+		now := time.Now()
+		report.DeliveryStatus = models.ReportDeliverySent
+		report.DeliveredAt = &now
+		updates["delivered_at"] = now
+	}
+	updates["delivery_status"] = report.DeliveryStatus
+	if err := s.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", report.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record delivery of report %s: %v", report.ID, err)
+	}
+}
+
+var fileNameUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// reportFileName is what the download and attachment are called, such as
+// premise_summary-st-engineering-hq-2026-10-12.pdf
+func reportFileName(spec reportSpec, premiseName string) string {
+	premise := strings.Trim(fileNameUnsafe.ReplaceAllString(strings.ToLower(premiseName), "-"), "-")
+	return fmt.Sprintf("%s-%s-%s.%s", spec.kind, premise, spec.to.In(spec.loc).Format("2006-01-02"), spec.format)
+}
+
+func (s *reportsService) ListReports(ctx context.Context, q ListQuery) (*Page[models.Report], error) {
+	return reportListSpec.find(s.db.WithContext(ctx).Model(&models.Report{}), q)
+}
+
+func (s *reportsService) GetReport(ctx context.Context, id uuid.UUID) (*models.Report, error) {
+	var report models.Report
+	if err := s.db.WithContext(ctx).Preload("Premise").First(&report, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (s *reportsService) OpenReport(ctx context.Context, id uuid.UUID) (*models.Report, io.ReadCloser, error) {
+	var report models.Report
+	if err := s.db.WithContext(ctx).First(&report, "id = ?", id).Error; err != nil {
+		return nil, nil, err
+	}
+	r, err := s.store.Open(ctx, report.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &report, r, nil
+}
+
+func (s *reportsService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+// runDue generates the reports of schedules whose next run has passed.
+// Moving next_run_at is the claim, so with several replicas only one
+// generates each run. A run missed while the server was down happens once
+// on start-up rather than once per missed time.
+func (s *reportsService) runDue(ctx context.Context) {
+	now := time.Now()
+	var due []models.ReportSchedule
+	if err := s.db.WithContext(ctx).
+		Where("is_active = ? AND (next_run_at IS NULL OR next_run_at <= ?)", true, now).
+		Find(&due).Error; err != nil {
+		log.Printf("Report schedule check failed: %v", err)
+		return
+	}
+
+	for i := range due {
+		schedule := &due[i]
+		loc, err := reportLocation(schedule.Timezone)
+		if err != nil {
+			log.Printf("Report schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		expr, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			log.Printf("Report schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		next := expr.Next(now.In(loc))
+		updates := map[string]any{"next_run_at": nil}
+		if !next.IsZero() {
+			updates["next_run_at"] = next
+		}
+		fire := schedule.NextRunAt
+		if fire != nil {
+			updates["last_run_at"] = *fire
+		}
+		claim := s.db.WithContext(ctx).Model(&models.ReportSchedule{}).
+			Where("id = ? AND next_run_at IS NOT DISTINCT FROM ?", schedule.ID, fire).
+			Updates(updates)
+		if claim.Error != nil {
+			log.Printf("Failed to claim report schedule %s: %v", schedule.ID, claim.Error)
+			continue
+		}
+		// A schedule without a next run has only just been set up
+		if claim.RowsAffected == 0 || fire == nil {
+			continue
+		}
+
+		spec := reportSpec{
+			kind:      schedule.Kind,
+			format:    schedule.Format,
+			premiseID: schedule.PremiseID,
+			from:      scheduledPeriodStart(schedule, *fire),
+			to:        *fire,
+			loc:       loc,
+		}
+		report, err := s.generate(ctx, spec, schedule.Recipients, &schedule.ID, nil)
+		if err != nil {
+			log.Printf("Failed to generate scheduled report %s: %v", schedule.ID, err)
+			continue
+		}
+		log.Printf("Generated report %s for schedule %q", report.ID, schedule.Name)
+	}
+}
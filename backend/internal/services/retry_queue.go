@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// retryQueue is the sending side shared by the delivery tables of
+// notifications and webhooks. Rows wait in the table with a status, an
+// attempt count and the time of their next attempt. Due rows are claimed
+// before they are sent, so that instances sharing the table never make the
+// same attempt twice; a claimed row comes due again after the lease in case
+// its sender died.
+type retryQueue struct {
+	table     string
+	pending   string
+	lease     time.Duration
+	batchSize int
+	senders   int
+	// attempts are made at most; the wait after a failed one starts at
+	// retryBase and doubles up to maxBackoff
+	attempts   int
+	retryBase  time.Duration
+	maxBackoff time.Duration
+	// now is the queue's clock
+	now func() time.Time
+}
+
+// due loads the pending rows of query whose next attempt has come, oldest
+// first
+func (q *retryQueue) due(query *gorm.DB, dest any) error {
+	return query.
+		Where(q.table+".status = ? AND "+q.table+".next_attempt_at <= ?", q.pending, q.now()).
+		Order(q.table + ".next_attempt_at ASC").Limit(q.batchSize).
+		Find(dest).Error
+}
+
+// each calls send for every row index, a few at a time, and waits for all
+func (q *retryQueue) each(n int, send func(i int)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, q.senders)
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			send(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// claim takes the row read with the given attempt count for its next
+// attempt and returns that attempt's number. It returns 0 when another
+// sender claimed the row since it was read.
+func (q *retryQueue) claim(ctx context.Context, db *gorm.DB, id uuid.UUID, attempts int) (int, error) {
+	claim := db.WithContext(ctx).Table(q.table).
+		Where("id = ? AND status = ? AND attempts = ?", id, q.pending, attempts).
+		Updates(map[string]any{"attempts": attempts + 1, "next_attempt_at": q.now().Add(q.lease)})
+	if claim.Error != nil {
+		return 0, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return 0, nil
+	}
+	return attempts + 1, nil
+}
+
+// giveUp reports whether the attempt was the last one allowed
+func (q *retryQueue) giveUp(attempt int) bool {
+	return attempt >= q.attempts
+}
+
+// backoff is the wait before the next attempt after the given number of
+// failed ones
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	wait := q.retryBase
+	for i := 1; i < attempts && wait < q.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, q.maxBackoff)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryQueueBackoff(t *testing.T) {
+	q := &retryQueue{retryBase: 30 * time.Second, maxBackoff: time.Hour, attempts: 3}
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		7:  32 * time.Minute,
+		8:  time.Hour,
+		50: time.Hour,
+	} {
+		if got := q.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+	for attempt, want := range map[int]bool{1: false, 2: false, 3: true, 4: true} {
+		if got := q.giveUp(attempt); got != want {
+			t.Errorf("giveUp(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestRetryQueueSendsAFewAtATime(t *testing.T) {
+	q := &retryQueue{senders: 3}
+	var running, peak, sent atomic.Int32
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.each(10, func(i int) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			<-release
+			running.Add(-1)
+			sent.Add(1)
+		})
+	}()
+	for i := 0; i < 10; i++ {
+		release <- struct{}{}
+	}
+	<-done
+	if sent.Load() != 10 || peak.Load() > 3 {
+		t.Errorf("sent %d with up to %d at once, want 10 with at most 3", sent.Load(), peak.Load())
+	}
+}
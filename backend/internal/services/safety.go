@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoGuardPremise       = errors.New("no premise could be determined for the guard")
+	ErrInvalidCheckInWindow = errors.New("check-in interval is out of range")
+	ErrNoLoneWorkerSession  = errors.New("no active lone-worker session")
+	ErrSOSNotRecorded       = errors.New("operators were alerted but the SOS alert could not be recorded")
+)
+
+// SafetyOptions tunes lone-worker escalation
+type SafetyOptions struct {
+	// Grace is how long after a missed check-in the guard is reminded
+	// before operators are alerted
+	Grace       time.Duration
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// SOSRequest is sent when a guard presses the panic button. The position is
+// optional; the guard's last reported location is used without it.
+type SOSRequest struct {
+	Fix     *GuardFix
+	Message string
+}
+
+// SafetyService handles guard SOS alerts and lone-worker check-ins
+type SafetyService interface {
+	RaiseSOS(ctx context.Context, guardID uuid.UUID, req SOSRequest) (*models.Alert, error)
+	StartLoneWorker(ctx context.Context, guardID uuid.UUID, intervalMinutes int) (*models.LoneWorkerSession, error)
+	CheckIn(ctx context.Context, guardID uuid.UUID, fix *GuardFix) (*models.LoneWorkerSession, error)
+	EndLoneWorker(ctx context.Context, guardID uuid.UUID) (*models.LoneWorkerSession, error)
+	GetLoneWorker(ctx context.Context, guardID uuid.UUID) (*models.LoneWorkerSession, error)
+	ListLoneWorkers(ctx context.Context) ([]models.LoneWorkerSession, error)
+	// Run warns and escalates overdue check-ins until ctx is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type safetyService struct {
+	db     *gorm.DB
+	wsHub  *websocket.Hub
+	alerts AlertsService
+	maps   MapService
+	notify NotificationsService
+	audit  AuditService
+	opts   SafetyOptions
+}
+
+func NewSafetyService(db *gorm.DB, wsHub *websocket.Hub, alerts AlertsService, maps MapService, notify NotificationsService, audit AuditService, opts SafetyOptions) SafetyService {
+	return &safetyService{db: db, wsHub: wsHub, alerts: alerts, maps: maps, notify: notify, audit: audit, opts: opts}
+}
+
+// RaiseSOS raises a critical alert about the guard and sends every operator
+// a guard_sos message that is redelivered until acknowledged
+func (s *safetyService) RaiseSOS(ctx context.Context, guardID uuid.UUID, req SOSRequest) (alert *models.Alert, err error) {
+	defer func() {
+		resourceID := ""
+		if alert != nil {
+			resourceID = alert.ID.String()
+		}
+		recordAction(ctx, s.audit, "guard.sos", "alert", resourceID, guardID.String(), models.RoleSecurityGuard, err, nil)
+	}()
+
+	var guard models.User
+	if err := s.db.WithContext(ctx).First(&guard, "id = ? AND role = ?", guardID, models.RoleSecurityGuard).Error; err != nil {
+		return nil, err
+	}
+	// A bad fix must not stop the SOS; fall back to the last known position
+	if req.Fix != nil {
+		if _, err := s.maps.UpdateGuardLocation(ctx, guardID, *req.Fix); err != nil {
+			log.Printf("SOS location from guard %s ignored: %v", guardID, err)
+		}
+	}
+	location := s.lastLocation(ctx, guardID)
+
+	raisedAt := time.Now()
+
+	// Operators hear about the SOS before anything that can fail, so a guard
+	// with no premise to file the alert under is still helped
+	s.notifyOperators(ctx, "guard_sos", map[string]any{
+		"guard":     guardSummary(&guard),
+		"location":  location,
+		"message":   req.Message,
+		"raised_at": raisedAt,
+	})
+	s.notify.NotifyRole(ctx, models.RoleSCSOperator, Notification{
+		Event:    NotifyGuardSOS,
+		Severity: models.AlertSeverityCritical,
+		Data: map[string]any{
+			"guard":     userName(&guard),
+			"location":  sosLocation(location),
+			"message":   req.Message,
+			"raised_at": raisedAt,
+		},
+	})
+
+	description := req.Message
+	if description == "" {
+		description = "Guard pressed the panic button"
+	}
+	alert, err = s.raiseGuardAlert(ctx, &guard, location, models.AlertTypeGuardDistress,
+		fmt.Sprintf("SOS: %s %s", guard.FirstName, guard.LastName), description)
+	if err != nil {
+		log.Printf("SOS alert for guard %s could not be created: %v", guardID, err)
+		return nil, fmt.Errorf("%w: %w", ErrSOSNotRecorded, err)
+	}
+	return alert, nil
+}
+
+func (s *safetyService) StartLoneWorker(ctx context.Context, guardID uuid.UUID, intervalMinutes int) (*models.LoneWorkerSession, error) {
+	interval := time.Duration(intervalMinutes) * time.Minute
+	if interval < s.opts.MinInterval || interval > s.opts.MaxInterval {
+		return nil, fmt.Errorf("%w: %d-%d minutes", ErrInvalidCheckInWindow,
+			int(s.opts.MinInterval.Minutes()), int(s.opts.MaxInterval.Minutes()))
+	}
+	if err := s.db.WithContext(ctx).First(&models.User{}, "id = ? AND role = ?", guardID, models.RoleSecurityGuard).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session, err := s.openSession(ctx, guardID)
+	switch {
+	case errors.Is(err, ErrNoLoneWorkerSession):
+		session = &models.LoneWorkerSession{GuardID: guardID, StartedAt: now}
+	case err != nil:
+		return nil, err
+	}
+	// Starting again while a session is open changes the interval and counts
+	// as a check-in
+	session.Status = models.LoneWorkerActive
+	session.IntervalMinutes = intervalMinutes
+	session.LastCheckInAt = now
+	session.NextDueAt = now.Add(interval)
+	session.WarnedAt = nil
+	session.EscalatedAt = nil
+	if err := s.db.WithContext(ctx).Omit(clause.Associations).Save(session).Error; err != nil {
+		return nil, err
+	}
+	s.publish("lone_worker_started", session)
+	return session, nil
+}
+
+// CheckIn resets the timer. Checking in after an escalation tells
+// operators the guard has responded; the alert stays open for them to close.
+func (s *safetyService) CheckIn(ctx context.Context, guardID uuid.UUID, fix *GuardFix) (*models.LoneWorkerSession, error) {
+	session, err := s.openSession(ctx, guardID)
+	if err != nil {
+		return nil, err
+	}
+	if fix != nil {
+		if _, err := s.maps.UpdateGuardLocation(ctx, guardID, *fix); err != nil {
+			log.Printf("Check-in location from guard %s ignored: %v", guardID, err)
+		}
+	}
+
+	recovered := session.Status == models.LoneWorkerOverdue
+	now := time.Now()
+	session.Status = models.LoneWorkerActive
+	session.LastCheckInAt = now
+	session.NextDueAt = now.Add(time.Duration(session.IntervalMinutes) * time.Minute)
+	session.WarnedAt = nil
+	session.EscalatedAt = nil
+	if err := s.db.WithContext(ctx).Omit(clause.Associations).Save(session).Error; err != nil {
+		return nil, err
+	}
+
+	if recovered {
+		s.publish("lone_worker_recovered", session)
+	} else {
+		s.publish("lone_worker_checked_in", session)
+	}
+	return session, nil
+}
+
+func (s *safetyService) EndLoneWorker(ctx context.Context, guardID uuid.UUID) (*models.LoneWorkerSession, error) {
+	session, err := s.openSession(ctx, guardID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session.Status = models.LoneWorkerEnded
+	session.EndedAt = &now
+	if err := s.db.WithContext(ctx).Omit(clause.Associations).Save(session).Error; err != nil {
+		return nil, err
+	}
+	s.publish("lone_worker_ended", session)
+	return session, nil
+}
+
+func (s *safetyService) GetLoneWorker(ctx context.Context, guardID uuid.UUID) (*models.LoneWorkerSession, error) {
+	return s.openSession(ctx, guardID)
+}
+
+func (s *safetyService) ListLoneWorkers(ctx context.Context) ([]models.LoneWorkerSession, error) {
+	var sessions []models.LoneWorkerSession
+	err := s.db.WithContext(ctx).Preload("Guard").
+		Where("status <> ?", models.LoneWorkerEnded).
+		Order("next_due_at").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *safetyService) openSession(ctx context.Context, guardID uuid.UUID) (*models.LoneWorkerSession, error) {
+	var session models.LoneWorkerSession
+	err := s.db.WithContext(ctx).
+		First(&session, "guard_id = ? AND status <> ?", guardID, models.LoneWorkerEnded).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoLoneWorkerSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *safetyService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.warnDue(ctx)
+			s.escalateOverdue(ctx)
+		}
+	}
+}
+
+// warnDue reminds guards whose check-in is due. Claiming rows with a
+// conditional update keeps several backend replicas from sending twice.
+func (s *safetyService) warnDue(ctx context.Context) {
+	now := time.Now()
+	var sessions []models.LoneWorkerSession
+	if err := s.db.WithContext(ctx).Model(&sessions).Clauses(clause.Returning{}).
+		Where("status = ? AND next_due_at <= ? AND warned_at IS NULL", models.LoneWorkerActive, now).
+		Update("warned_at", now).Error; err != nil {
+		log.Printf("Lone-worker reminder check failed: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		s.wsHub.SendToUserWithAck(session.GuardID.String(), "check_in_due", map[string]any{
+			"session_id":   session.ID,
+			"due_at":       session.NextDueAt,
+			"escalates_at": session.NextDueAt.Add(s.opts.Grace),
+		})
+		s.notify.Notify(ctx, []uuid.UUID{session.GuardID}, Notification{
+			Event:    NotifyCheckInDue,
+			Severity: models.AlertSeverityHigh,
+			Data: map[string]any{
+				"session_id":   session.ID,
+				"due_at":       session.NextDueAt,
+				"escalates_at": session.NextDueAt.Add(s.opts.Grace),
+			},
+		})
+	}
+}
+
+// escalateOverdue raises a missed check-in alert once the grace period has passed
+func (s *safetyService) escalateOverdue(ctx context.Context) {
+	now := time.Now()
+	var sessions []models.LoneWorkerSession
+	if err := s.db.WithContext(ctx).Model(&sessions).Clauses(clause.Returning{}).
+		Where("status = ? AND next_due_at <= ?", models.LoneWorkerActive, now.Add(-s.opts.Grace)).
+		Updates(map[string]any{"status": models.LoneWorkerOverdue, "escalated_at": now}).Error; err != nil {
+		log.Printf("Lone-worker escalation check failed: %v", err)
+		return
+	}
+
+	for i := range sessions {
+		session := &sessions[i]
+		var guard models.User
+		if err := s.db.WithContext(ctx).First(&guard, "id = ?", session.GuardID).Error; err != nil {
+			log.Printf("Lone-worker escalation for guard %s failed: %v", session.GuardID, err)
+			continue
+		}
+		location := s.lastLocation(ctx, session.GuardID)
+		alert, err := s.raiseGuardAlert(ctx, &guard, location, models.AlertTypeMissedCheckIn,
+			fmt.Sprintf("Missed check-in: %s %s", guard.FirstName, guard.LastName),
+			fmt.Sprintf("No check-in since %s (every %d minutes)", session.LastCheckInAt.Format(time.RFC3339), session.IntervalMinutes))
+		if err != nil {
+			log.Printf("Failed to raise missed check-in alert for guard %s: %v", guard.ID, err)
+		} else {
+			session.AlertID = &alert.ID
+			if err := s.db.WithContext(ctx).Model(session).Update("alert_id", alert.ID).Error; err != nil {
+				log.Printf("Failed to link alert to lone-worker session %s: %v", session.ID, err)
+			}
+		}
+		session.Guard = guard
+		recordAction(ctx, s.audit, "lone_worker.escalate", "lone_worker_session", session.ID.String(), "system", "", err, nil)
+
+		s.notifyOperators(ctx, "lone_worker_missed", map[string]any{
+			"session_id":       session.ID,
+			"alert_id":         session.AlertID,
+			"guard":            guardSummary(&guard),
+			"location":         location,
+			"last_check_in_at": session.LastCheckInAt,
+			"due_at":           session.NextDueAt,
+		})
+		place := "unknown"
+		if alert != nil {
+			place = alert.Location
+		}
+		s.notify.NotifyRole(ctx, models.RoleSCSOperator, Notification{
+			Event:    NotifyLoneWorkerMissed,
+			Severity: models.AlertSeverityCritical,
+			Data: map[string]any{
+				"session_id":       session.ID,
+				"alert_id":         session.AlertID,
+				"guard":            userName(&guard),
+				"location":         place,
+				"last_check_in_at": session.LastCheckInAt,
+				"due_at":           session.NextDueAt,
+			},
+		})
+	}
+}
+
+// raiseGuardAlert creates a critical alert about a guard at their last location
+func (s *safetyService) raiseGuardAlert(ctx context.Context, guard *models.User, location *models.GuardLocation, alertType models.AlertType, title, description string) (*models.Alert, error) {
+	premise, err := s.guardPremise(ctx, guard.ID, location)
+	if err != nil {
+		return nil, err
+	}
+	alert := models.Alert{
+		Type:        alertType,
+		Severity:    models.AlertSeverityCritical,
+		Title:       title,
+		Description: description,
+		Location:    premise.Name,
+		PremiseID:   premise.ID,
+		GuardID:     &guard.ID,
+	}
+	if location != nil {
+		alert.Latitude, alert.Longitude = &location.Latitude, &location.Longitude
+		alert.Location = fmt.Sprintf("%s (%.6f, %.6f)", premise.Name, location.Latitude, location.Longitude)
+	}
+	return s.alerts.CreateAlert(ctx, alert)
+}
+
+// guardPremise picks the premise an alert about the guard belongs to: the
+// premise of the guard's open incident, else the nearest premise to the
+// guard, else the premise of a camera the guard is assigned to
+func (s *safetyService) guardPremise(ctx context.Context, guardID uuid.UUID, location *models.GuardLocation) (*models.Premise, error) {
+	var premise models.Premise
+	err := s.db.WithContext(ctx).
+		Joins("JOIN alerts ON alerts.premise_id = premises.id").
+		Joins("JOIN incidents ON incidents.alert_id = alerts.id").
+		Joins("JOIN incident_guards ON incident_guards.incident_id = incidents.id").
+		Where("incident_guards.guard_id = ? AND incidents.status IN ?", guardID,
+			[]models.IncidentStatus{models.IncidentStatusOpen, models.IncidentStatusInProgress}).
+		Order("incidents.created_at DESC").
+		First(&premise).Error
+	if err == nil {
+		return &premise, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if location != nil {
+		var premises []models.Premise
+		if err := s.db.WithContext(ctx).
+			Where("latitude IS NOT NULL AND longitude IS NOT NULL").
+			Find(&premises).Error; err != nil {
+			return nil, err
+		}
+		nearest, best := -1, math.Inf(1)
+		for i, p := range premises {
+			if d := distanceMetres(location.Latitude, location.Longitude, *p.Latitude, *p.Longitude); d < best {
+				nearest, best = i, d
+			}
+		}
+		if nearest >= 0 {
+			return &premises[nearest], nil
+		}
+	}
+
+	err = s.db.WithContext(ctx).
+		Joins("JOIN cameras ON cameras.premise_id = premises.id").
+		Joins("JOIN camera_guards ON camera_guards.camera_id = cameras.id").
+		Where("camera_guards.guard_id = ?", guardID).
+		First(&premise).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoGuardPremise
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &premise, nil
+}
+
+func (s *safetyService) lastLocation(ctx context.Context, guardID uuid.UUID) *models.GuardLocation {
+	var location models.GuardLocation
+	if err := s.db.WithContext(ctx).First(&location, "guard_id = ?", guardID).Error; err != nil {
+		return nil
+	}
+	return &location
+}
+
+// notifyOperators sends every active operator a message that is redelivered
+// until acknowledged, regardless of their topic subscriptions
+func (s *safetyService) notifyOperators(ctx context.Context, messageType string, payload any) {
+	var operators []models.User
+	if err := s.db.WithContext(ctx).
+		Where("role = ? AND is_active = ?", models.RoleSCSOperator, true).
+		Find(&operators).Error; err != nil {
+		log.Printf("Failed to load operators for %s: %v", messageType, err)
+		return
+	}
+	for _, op := range operators {
+		s.wsHub.SendToUserWithAck(op.ID.String(), messageType, payload)
+	}
+}
+
+func (s *safetyService) publish(messageType string, session *models.LoneWorkerSession) {
+	s.wsHub.Publish([]string{TopicSafety}, messageType, session)
+}
+
+// sosLocation describes where an SOS came from before its alert exists
+func sosLocation(location *models.GuardLocation) string {
+	if location == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.6f, %.6f", location.Latitude, location.Longitude)
+}
+
+func guardSummary(guard *models.User) map[string]any {
+	return map[string]any{
+		"id":         guard.ID,
+		"username":   guard.Username,
+		"first_name": guard.FirstName,
+		"last_name":  guard.LastName,
+		"phone":      guard.Phone,
+	}
+}
+
+// distanceMetres is the great-circle distance between two points
+func distanceMetres(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
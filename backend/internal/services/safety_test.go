@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+)
+
+var testSafetyOptions = SafetyOptions{Grace: 2 * time.Minute, MinInterval: 5 * time.Minute, MaxInterval: 2 * time.Hour}
+
+func TestDistanceMetres(t *testing.T) {
+	for _, tt := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 52.52, 13.405, 52.52, 13.405, 0},
+		{"one degree of latitude", 0, 0, 1, 0, 111195},
+		{"Berlin to Paris", 52.52, 13.405, 48.8566, 2.3522, 877500},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111195},
+	} {
+		if got := distanceMetres(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.want) > tt.want*0.001+1 {
+			t.Errorf("%s: distance %.0f m, want %.0f m", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSOSLocation(t *testing.T) {
+	if got := sosLocation(nil); got != "unknown" {
+		t.Errorf("sosLocation(nil) = %q", got)
+	}
+	if got := sosLocation(&models.GuardLocation{Latitude: 52.52, Longitude: 13.405}); got != "52.520000, 13.405000" {
+		t.Errorf("sosLocation = %q", got)
+	}
+}
+
+func TestLoneWorkerIntervalIsChecked(t *testing.T) {
+	s := NewSafetyService(nil, nil, nil, nil, nil, nil, testSafetyOptions)
+	for _, minutes := range []int{0, 4, 121} {
+		if _, err := s.StartLoneWorker(context.Background(), uuid.New(), minutes); !errors.Is(err, ErrInvalidCheckInWindow) {
+			t.Errorf("StartLoneWorker every %d minutes = %v, want ErrInvalidCheckInWindow", minutes, err)
+		}
+	}
+}
+
+func TestLoneWorkerCheckInRestartsTheTimer(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	hub := websocket.NewHub(websocket.NewMemoryBackplane(), websocket.NewMemoryOutbox(10, time.Hour), websocket.DeliveryOptions{})
+	s := NewSafetyService(db, hub, nil, nil, nil, nil, testSafetyOptions)
+	guard := createTestUser(t, db)
+	if err := db.Model(guard).Update("role", models.RoleSecurityGuard).Error; err != nil {
+		t.Fatal(err)
+	}
+	cleanupTestRows(t, db, &models.LoneWorkerSession{}, "guard_id = ?", guard.ID)
+
+	if _, err := s.CheckIn(ctx, guard.ID, nil); !errors.Is(err, ErrNoLoneWorkerSession) {
+		t.Errorf("CheckIn without a session = %v, want ErrNoLoneWorkerSession", err)
+	}
+	started, err := s.StartLoneWorker(ctx, guard.ID, 30)
+	if err != nil {
+		t.Fatalf("StartLoneWorker: %v", err)
+	}
+	if started.Status != models.LoneWorkerActive || !started.NextDueAt.Equal(started.LastCheckInAt.Add(30*time.Minute)) {
+		t.Errorf("started session = %+v", started)
+	}
+
+	// An escalated session is active again after the guard checks in
+	escalated := time.Now().Add(-time.Minute)
+	if err := db.Model(started).Updates(map[string]any{
+		"status": models.LoneWorkerOverdue, "warned_at": escalated, "escalated_at": escalated,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	session, err := s.CheckIn(ctx, guard.ID, nil)
+	if err != nil {
+		t.Fatalf("CheckIn: %v", err)
+	}
+	if session.ID != started.ID || session.Status != models.LoneWorkerActive || session.WarnedAt != nil || session.EscalatedAt != nil ||
+		!session.NextDueAt.After(started.NextDueAt) {
+		t.Errorf("checked in session = %+v", session)
+	}
+
+	if _, err := s.EndLoneWorker(ctx, guard.ID); err != nil {
+		t.Fatalf("EndLoneWorker: %v", err)
+	}
+	if _, err := s.GetLoneWorker(ctx, guard.ID); !errors.Is(err, ErrNoLoneWorkerSession) {
+		t.Errorf("GetLoneWorker after the end = %v, want ErrNoLoneWorkerSession", err)
+	}
+}
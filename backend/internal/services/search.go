@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// ts_headline marks matches with control characters, which are swapped
+	// for <mark> after the rest of the snippet is HTML-escaped
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=\x02, StopSel=\x03, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \""
+)
+
+// Search result types
+const (
+	SearchTypeAlert          = "alert"
+	SearchTypeIncident       = "incident"
+	SearchTypeIncidentUpdate = "incident_update"
+	SearchTypeCamera         = "camera"
+	SearchTypePremise        = "premise"
+)
+
+var ErrInvalidSearch = errors.New("invalid search")
+
+// Searchable documents. The GIN indexes created in database.Migrate are on
+// to_tsvector('english', <document>) and must use the same expressions.
+const (
+	alertDocument          = "coalesce(alerts.title, '') || ' ' || coalesce(alerts.description, '') || ' ' || coalesce(alerts.location, '')"
+	incidentDocument       = "coalesce(incidents.description, '') || ' ' || coalesce(incidents.location, '')"
+	incidentUpdateDocument = "coalesce(incident_updates.message, '')"
+	cameraDocument         = "coalesce(cameras.name, '') || ' ' || coalesce(cameras.location, '')"
+	premiseDocument        = "coalesce(premises.name, '') || ' ' || coalesce(premises.address, '')"
+)
+
+// SearchService searches free text across alerts, incidents, incident
+// updates, cameras and premises
+type SearchService interface {
+	Search(ctx context.Context, q SearchQuery, userRole models.UserRole, userID string) (*SearchResults, error)
+}
+
+// SearchQuery is a web-search style query (quoted phrases, or, -word) with
+// optional structured filters. Empty Types searches everything.
+type SearchQuery struct {
+	Text          string
+	Types         []string
+	PremiseIDs    []uuid.UUID
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+}
+
+// SearchHit is one match. Snippet is HTML-escaped with matches in <mark>.
+// Incident updates link to their incident and alerts to theirs.
+type SearchHit struct {
+	Type        string     `json:"type"`
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Snippet     string     `json:"snippet"`
+	Rank        float64    `json:"rank"`
+	Status      string     `json:"status,omitempty"`
+	PremiseID   *uuid.UUID `json:"premise_id,omitempty"`
+	PremiseName string     `json:"premise_name,omitempty"`
+	AlertID     *uuid.UUID `json:"alert_id,omitempty"`
+	IncidentID  *uuid.UUID `json:"incident_id,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SearchResults are the best hits across all types, by rank
+type SearchResults struct {
+	Query string         `json:"query"`
+	Hits  []SearchHit    `json:"hits"`
+	Total map[string]int `json:"total"`
+}
+
+type searchService struct {
+	db *gorm.DB
+}
+
+func NewSearchService(db *gorm.DB) SearchService {
+	return &searchService{db: db}
+}
+
+// searchSource describes how one type is matched, shown and scoped
+type searchSource struct {
+	kind     string
+	table    string
+	document string
+	columns  string
+	joins    []string
+	premise  string
+	guard    string
+}
+
+var searchSources = []searchSource{
+	{
+		kind:     SearchTypeAlert,
+		table:    "alerts",
+		document: alertDocument,
+		columns:  "alerts.id, alerts.title, alerts.status, alerts.premise_id, premises.name AS premise_name, alerts.id AS alert_id, alerts.created_at",
+		joins:    []string{"JOIN premises ON premises.id = alerts.premise_id"},
+		premise:  "alerts.premise_id",
+		guard:    "alerts.assigned_guard_id = ?",
+	},
+	{
+		kind:     SearchTypeIncident,
+		table:    "incidents",
+		document: incidentDocument,
+		columns:  "incidents.id, alerts.title, incidents.status, alerts.premise_id, premises.name AS premise_name, incidents.alert_id, incidents.id AS incident_id, incidents.created_at",
+		joins:    []string{"JOIN alerts ON alerts.id = incidents.alert_id", "JOIN premises ON premises.id = alerts.premise_id"},
+		premise:  "alerts.premise_id",
+		guard:    "incidents.id IN (SELECT incident_id FROM incident_guards WHERE guard_id = ?)",
+	},
+	{
+		kind:     SearchTypeIncidentUpdate,
+		table:    "incident_updates",
+		document: incidentUpdateDocument,
+		columns:  "incident_updates.id, alerts.title, incident_updates.type AS status, alerts.premise_id, premises.name AS premise_name, incidents.alert_id, incident_updates.incident_id, incident_updates.created_at",
+		joins: []string{
+			"JOIN incidents ON incidents.id = incident_updates.incident_id",
+			"JOIN alerts ON alerts.id = incidents.alert_id",
+			"JOIN premises ON premises.id = alerts.premise_id",
+		},
+		premise: "alerts.premise_id",
+		guard:   "incident_updates.incident_id IN (SELECT incident_id FROM incident_guards WHERE guard_id = ?)",
+	},
+	{
+		kind:     SearchTypeCamera,
+		table:    "cameras",
+		document: cameraDocument,
+		columns:  "cameras.id, cameras.name AS title, cameras.status, cameras.premise_id, premises.name AS premise_name, cameras.created_at",
+		joins:    []string{"JOIN premises ON premises.id = cameras.premise_id"},
+		premise:  "cameras.premise_id",
+		guard:    "cameras.id IN (SELECT camera_id FROM camera_guards WHERE guard_id = ?)",
+	},
+	{
+		kind:     SearchTypePremise,
+		table:    "premises",
+		document: premiseDocument,
+		columns:  "premises.id, premises.name AS title, premises.type AS status, premises.id AS premise_id, premises.name AS premise_name, premises.created_at",
+		premise:  "premises.id",
+		guard:    "premises.id IN (SELECT cameras.premise_id FROM cameras JOIN camera_guards ON camera_guards.camera_id = cameras.id WHERE camera_guards.guard_id = ?)",
+	},
+}
+
+func (s *searchService) Search(ctx context.Context, q SearchQuery, userRole models.UserRole, userID string) (*SearchResults, error) {
+	text := strings.TrimSpace(q.Text)
+	if text == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidSearch)
+	}
+	wanted := map[string]bool{}
+	for _, kind := range q.Types {
+		if !isSearchType(kind) {
+			return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidSearch, kind)
+		}
+		wanted[kind] = true
+	}
+	if q.CreatedAfter != nil && q.CreatedBefore != nil && !q.CreatedBefore.After(*q.CreatedAfter) {
+		return nil, fmt.Errorf("%w: created_before must be after created_after", ErrInvalidSearch)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	results := &SearchResults{Query: text, Hits: []SearchHit{}, Total: map[string]int{}}
+	for _, source := range searchSources {
+		if len(wanted) > 0 && !wanted[source.kind] {
+			continue
+		}
+		hits, total, err := s.searchSource(ctx, source, text, q, limit, userRole, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", source.table, err)
+		}
+		results.Hits = append(results.Hits, hits...)
+		results.Total[source.kind] = total
+	}
+
+	sort.SliceStable(results.Hits, func(i, j int) bool {
+		if results.Hits[i].Rank != results.Hits[j].Rank {
+			return results.Hits[i].Rank > results.Hits[j].Rank
+		}
+		return results.Hits[i].CreatedAt.After(results.Hits[j].CreatedAt)
+	})
+	if len(results.Hits) > limit {
+		results.Hits = results.Hits[:limit]
+	}
+	return results, nil
+}
+
+// searchSource returns the best hits of one type and how many there are in all
+func (s *searchService) searchSource(ctx context.Context, source searchSource, text string, q SearchQuery, limit int, userRole models.UserRole, userID string) ([]SearchHit, int, error) {
+	vector := "to_tsvector('english', " + source.document + ")"
+	query := scopeSearch(s.db.WithContext(ctx), source, text, q, userRole, userID)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return []SearchHit{}, 0, nil
+	}
+
+	var hits []SearchHit
+	err := query.
+		Select(source.columns+", ts_rank("+vector+", search_query) AS rank, "+
+			"ts_headline('english', "+source.document+", search_query, ?) AS snippet", headlineOptions).
+		Order("rank DESC, " + source.table + ".created_at DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range hits {
+		hits[i].Type = source.kind
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+	return hits, int(total), nil
+}
+
+// scopeSearch matches text against one type and narrows it to what the
+// caller may see and the filters of q
+func scopeSearch(db *gorm.DB, source searchSource, text string, q SearchQuery, userRole models.UserRole, userID string) *gorm.DB {
+	query := db.Table(source.table).
+		Joins("CROSS JOIN websearch_to_tsquery('english', ?) AS search_query", text)
+	for _, join := range source.joins {
+		query = query.Joins(join)
+	}
+	query = query.Where("to_tsvector('english', " + source.document + ") @@ search_query")
+
+	if userRole == models.RoleSecurityGuard {
+		query = query.Where(source.guard, userID)
+	}
+	if len(q.PremiseIDs) > 0 {
+		query = query.Where(source.premise+" IN ?", q.PremiseIDs)
+	}
+	if q.CreatedAfter != nil {
+		query = query.Where(source.table+".created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where(source.table+".created_at < ?", *q.CreatedBefore)
+	}
+	return query
+}
+
+// highlight escapes a ts_headline snippet and turns its markers into <mark>
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, headlineStart, "<mark>")
+	return strings.ReplaceAll(snippet, headlineStop, "</mark>")
+}
+
+func isSearchType(kind string) bool {
+	for _, source := range searchSources {
+		if source.kind == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestSearchValidatesTheQuery(t *testing.T) {
+	s := NewSearchService(nil)
+	now := time.Now()
+	for _, q := range []SearchQuery{
+		{Text: "  "},
+		{Text: "gate", Types: []string{SearchTypeAlert, "user"}},
+		{Text: "gate", CreatedAfter: &now, CreatedBefore: &now},
+	} {
+		if _, err := s.Search(context.Background(), q, models.RoleSCSOperator, uuid.NewString()); !errors.Is(err, ErrInvalidSearch) {
+			t.Errorf("Search(%+v) = %v, want ErrInvalidSearch", q, err)
+		}
+	}
+}
+
+func TestScopeSearch(t *testing.T) {
+	db := dryRunDB(t)
+	guardID := uuid.NewString()
+	premiseID := uuid.New()
+	after := time.Now().Add(-time.Hour)
+
+	for _, source := range searchSources {
+		sql := func(role models.UserRole, q SearchQuery) string {
+			return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				var n int64
+				return scopeSearch(tx, source, "gate", q, role, guardID).Count(&n)
+			})
+		}
+
+		// Guards only find what they are assigned to; operators see everything
+		guard := sql(models.RoleSecurityGuard, SearchQuery{})
+		if want := strings.Replace(source.guard, "?", "'"+guardID+"'", 1); !strings.Contains(guard, want) {
+			t.Errorf("%s: guard search\n%s\nis not scoped by %s", source.kind, guard, want)
+		}
+		if operator := sql(models.RoleSCSOperator, SearchQuery{}); strings.Contains(operator, guardID) {
+			t.Errorf("%s: operator search is scoped to a guard:\n%s", source.kind, operator)
+		}
+
+		filtered := sql(models.RoleSCSOperator, SearchQuery{PremiseIDs: []uuid.UUID{premiseID}, CreatedAfter: &after})
+		for _, want := range []string{
+			source.premise + " IN ('" + premiseID.String() + "')",
+			source.table + ".created_at >= ",
+			"websearch_to_tsquery('english', 'gate')",
+		} {
+			if !strings.Contains(filtered, want) {
+				t.Errorf("%s: filtered search\n%s\nhas no %s", source.kind, filtered, want)
+			}
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	snippet := "<b>" + headlineStart + "Gate" + headlineStop + "</b> & fence"
+	if got, want := highlight(snippet), "&lt;b&gt;<mark>Gate</mark>&lt;/b&gt; &amp; fence"; got != want {
+		t.Errorf("highlight = %q, want %q", got, want)
+	}
+}
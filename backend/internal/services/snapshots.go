@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"smart-city-surveillance/internal/config"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/capture"
+	"smart-city-surveillance/pkg/storage"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const snapshotThumbnailWidth = 320
+
+// SnapshotService captures still frames from cameras and attaches them to alerts
+type SnapshotService interface {
+	CaptureCamera(ctx context.Context, camera *models.Camera) ([]byte, error)
+	CaptureForAlert(ctx context.Context, alert *models.Alert) ([]models.AlertSnapshot, error)
+	CapturePostEvent(alert models.Alert)
+	SignSnapshots(snapshots []models.AlertSnapshot)
+	RunPrebuffer(ctx context.Context)
+}
+
+type snapshotService struct {
+	db      *gorm.DB
+	wsHub   *websocket.Hub
+	backend capture.Backend
+	store   storage.Storage
+	buffer  *capture.Buffer
+	cfg     config.CaptureConfig
+	urlTTL  time.Duration
+
+	// Immediate frames that missed alert_created, by alert; the post-event
+	// capture sends them on
+	lateMutex sync.Mutex
+	late      map[uuid.UUID]<-chan *capture.Frame
+}
+
+func NewSnapshotService(db *gorm.DB, wsHub *websocket.Hub, backend capture.Backend, store storage.Storage, cfg *config.Config) SnapshotService {
+	return &snapshotService{
+		db:      db,
+		wsHub:   wsHub,
+		backend: backend,
+		store:   store,
+		buffer:  capture.NewBuffer(time.Duration(cfg.Capture.PreEventSeconds) * time.Second),
+		cfg:     cfg.Capture,
+		urlTTL:  time.Duration(cfg.Media.URLTTL) * time.Minute,
+		late:    make(map[uuid.UUID]<-chan *capture.Frame),
+	}
+}
+
+// CaptureCamera grabs a single still frame from the camera stream
+func (s *snapshotService) CaptureCamera(ctx context.Context, camera *models.Camera) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+	return s.backend.Capture(ctx, camera.StreamURL)
+}
+
+// CaptureForAlert stores the buffered pre-event frames plus a frame captured
+// now, and returns them signed so that they go out with alert_created. The
+// immediate frame is waited for AlertTimeoutSeconds at most; a slower one is
+// left to CapturePostEvent, which sends it with the post-event frames.
+func (s *snapshotService) CaptureForAlert(ctx context.Context, alert *models.Alert) ([]models.AlertSnapshot, error) {
+	if alert.CameraID == nil {
+		return nil, nil
+	}
+	var camera models.Camera
+	if err := s.db.WithContext(ctx).First(&camera, "id = ?", *alert.CameraID).Error; err != nil {
+		return nil, fmt.Errorf("camera not found: %w", err)
+	}
+
+	frames := s.preEventFrames(camera.ID.String(), alert.CreatedAt)
+	immediate := s.captureImmediate(&camera)
+	wait := time.NewTimer(time.Duration(s.cfg.AlertTimeoutSeconds) * time.Second)
+	defer wait.Stop()
+	select {
+	case frame := <-immediate:
+		if frame != nil {
+			frames = append(frames, *frame)
+		}
+	case <-wait.C:
+		s.lateMutex.Lock()
+		s.late[alert.ID] = immediate
+		s.lateMutex.Unlock()
+	}
+
+	snapshots := s.saveFrames(ctx, alert, frames)
+	s.SignSnapshots(snapshots)
+	return snapshots, nil
+}
+
+// captureImmediate grabs a frame from the camera in the background, bounded
+// by TimeoutSeconds. The channel yields the frame, or nil if the grab failed.
+func (s *snapshotService) captureImmediate(camera *models.Camera) <-chan *capture.Frame {
+	immediate := make(chan *capture.Frame, 1)
+	go func() {
+		data, err := s.CaptureCamera(context.Background(), camera)
+		if err != nil {
+			log.Printf("Snapshot capture failed for camera %s: %v", camera.ID, err)
+			immediate <- nil
+			return
+		}
+		immediate <- &capture.Frame{Data: data, CapturedAt: time.Now()}
+	}()
+	return immediate
+}
+
+// takeLate returns the immediate frame of the alert that missed
+// alert_created, if any, and forgets it
+func (s *snapshotService) takeLate(alertID uuid.UUID) <-chan *capture.Frame {
+	s.lateMutex.Lock()
+	defer s.lateMutex.Unlock()
+	immediate := s.late[alertID]
+	delete(s.late, alertID)
+	return immediate
+}
+
+// CapturePostEvent captures frames for a few seconds after the alert and
+// pushes them to operators as alert_snapshots_added once done, together with
+// an immediate frame that was too slow for alert_created. Meant to run in its
+// own goroutine; failures are logged.
+func (s *snapshotService) CapturePostEvent(alert models.Alert) {
+	late := s.takeLate(alert.ID)
+	if alert.CameraID == nil {
+		return
+	}
+	schedule := s.postEventTimes(alert.CreatedAt)
+	if len(schedule) == 0 && late == nil {
+		return
+	}
+	ctx := context.Background()
+
+	var frames []capture.Frame
+	if late != nil {
+		if frame := <-late; frame != nil {
+			frames = append(frames, *frame)
+		}
+	}
+
+	var camera models.Camera
+	if len(schedule) > 0 {
+		if err := s.db.WithContext(ctx).First(&camera, "id = ?", *alert.CameraID).Error; err != nil {
+			log.Printf("Post-event capture skipped for alert %s: %v", alert.ID, err)
+			schedule = nil
+		}
+	}
+	for _, at := range schedule {
+		time.Sleep(time.Until(at))
+		data, err := s.CaptureCamera(ctx, &camera)
+		if err != nil {
+			log.Printf("Post-event capture failed for camera %s: %v", camera.ID, err)
+			continue
+		}
+		frames = append(frames, capture.Frame{Data: data, CapturedAt: time.Now()})
+	}
+
+	snapshots := s.saveFrames(ctx, &alert, frames)
+	if len(snapshots) == 0 {
+		return
+	}
+	s.SignSnapshots(snapshots)
+	s.wsHub.Publish(alertTopics(ctx, s.db, &alert), "alert_snapshots_added", map[string]any{
+		"alert_id":  alert.ID,
+		"snapshots": snapshots,
+	})
+}
+
+// preEventFrames returns the buffered frames of the camera from the
+// pre-event window before raisedAt
+func (s *snapshotService) preEventFrames(cameraID string, raisedAt time.Time) []capture.Frame {
+	if s.cfg.PreEventSeconds <= 0 {
+		return nil
+	}
+	return s.buffer.Since(cameraID, raisedAt.Add(-time.Duration(s.cfg.PreEventSeconds)*time.Second))
+}
+
+// postEventTimes returns when to capture after an alert raised at raisedAt:
+// every interval until the post-event window is over
+func (s *snapshotService) postEventTimes(raisedAt time.Time) []time.Time {
+	if s.cfg.PostEventSeconds <= 0 || s.cfg.IntervalSeconds <= 0 {
+		return nil
+	}
+	interval := time.Duration(s.cfg.IntervalSeconds) * time.Second
+	end := raisedAt.Add(time.Duration(s.cfg.PostEventSeconds) * time.Second)
+	var times []time.Time
+	for at := raisedAt.Add(interval); !at.After(end); at = at.Add(interval) {
+		times = append(times, at)
+	}
+	return times
+}
+
+// saveFrames stores the frames against the alert, skipping the ones that
+// fail to store
+func (s *snapshotService) saveFrames(ctx context.Context, alert *models.Alert, frames []capture.Frame) []models.AlertSnapshot {
+	var snapshots []models.AlertSnapshot
+	for _, f := range frames {
+		snapshot, err := s.saveFrame(ctx, alert, f)
+		if err != nil {
+			log.Printf("Failed to store snapshot for alert %s: %v", alert.ID, err)
+			continue
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots
+}
+
+// SignSnapshots fills in the signed URLs of the given snapshots
+func (s *snapshotService) SignSnapshots(snapshots []models.AlertSnapshot) {
+	for i := range snapshots {
+		snapshots[i].URL = s.store.SignedURL(snapshots[i].StorageKey, s.urlTTL)
+		snapshots[i].ThumbnailURL = s.store.SignedURL(snapshots[i].ThumbnailKey, s.urlTTL)
+	}
+}
+
+// RunPrebuffer periodically samples all active cameras so that frames from
+// before an alert are available. Disabled when no pre-event window is set.
+func (s *snapshotService) RunPrebuffer(ctx context.Context) {
+	if s.cfg.PreEventSeconds <= 0 || s.cfg.IntervalSeconds <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(s.cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var cameras []models.Camera
+			if err := s.db.WithContext(ctx).Where("status = ?", models.CameraStatusActive).Find(&cameras).Error; err != nil {
+				log.Printf("Prebuffer failed to list cameras: %v", err)
+				continue
+			}
+
+			var wg sync.WaitGroup
+			for i := range cameras {
+				wg.Add(1)
+				go func(camera *models.Camera) {
+					defer wg.Done()
+					data, err := s.CaptureCamera(ctx, camera)
+					if err != nil {
+						return
+					}
+					s.buffer.Add(camera.ID.String(), capture.Frame{Data: data, CapturedAt: time.Now()})
+				}(&cameras[i])
+			}
+			wg.Wait()
+		}
+	}
+}
+
+func (s *snapshotService) saveFrame(ctx context.Context, alert *models.Alert, frame capture.Frame) (*models.AlertSnapshot, error) {
+	thumb, err := capture.Thumbnail(frame.Data, snapshotThumbnailWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("snapshots/%s/%d", alert.ID, frame.CapturedAt.UnixMilli())
+	snapshot := models.AlertSnapshot{
+		AlertID:      alert.ID,
+		CameraID:     *alert.CameraID,
+		StorageKey:   base + ".jpg",
+		ThumbnailKey: base + "_thumb.jpg",
+		OffsetMs:     frame.CapturedAt.Sub(alert.CreatedAt).Milliseconds(),
+		CapturedAt:   frame.CapturedAt,
+	}
+	if err := s.store.Put(ctx, snapshot.StorageKey, bytes.NewReader(frame.Data)); err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(ctx, snapshot.ThumbnailKey, bytes.NewReader(thumb)); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(&snapshot).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/config"
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/capture"
+	"smart-city-surveillance/pkg/storage"
+	"smart-city-surveillance/pkg/websocket"
+
+	"gorm.io/gorm"
+)
+
+// testPublished records the topic events published on a hub
+type testPublished struct {
+	mutex  sync.Mutex
+	events []string
+	last   map[string]any
+}
+
+func recordPublished(hub *websocket.Hub) *testPublished {
+	published := &testPublished{last: make(map[string]any)}
+	hub.OnPublish(func(topics []string, messageType string, payload any) {
+		published.mutex.Lock()
+		defer published.mutex.Unlock()
+		published.events = append(published.events, messageType)
+		published.last[messageType] = payload
+	})
+	return published
+}
+
+func (p *testPublished) payload(messageType string) any {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.last[messageType]
+}
+
+func newTestSnapshots(t *testing.T, db *gorm.DB, captureCfg config.CaptureConfig) (*snapshotService, *testPublished) {
+	t.Helper()
+	store, err := storage.NewLocal(t.TempDir(), "http://media.test", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if captureCfg.TimeoutSeconds == 0 {
+		captureCfg.TimeoutSeconds = 5
+	}
+	if captureCfg.AlertTimeoutSeconds == 0 {
+		captureCfg.AlertTimeoutSeconds = 5
+	}
+	cfg := &config.Config{Capture: captureCfg, Media: config.MediaConfig{URLTTL: 60}}
+	hub := websocket.NewHub(websocket.NewMemoryBackplane(), websocket.NewMemoryOutbox(10, time.Hour), websocket.DeliveryOptions{})
+	published := recordPublished(hub)
+	return NewSnapshotService(db, hub, &capture.Simulated{}, store, cfg).(*snapshotService), published
+}
+
+func TestSnapshotPreEventWindow(t *testing.T) {
+	s, _ := newTestSnapshots(t, nil, config.CaptureConfig{PreEventSeconds: 4, IntervalSeconds: 2})
+	raised := time.Date(2026, 3, 1, 12, 0, 10, 0, time.UTC)
+	for i := 0; i <= 10; i++ {
+		s.buffer.Add("front", capture.Frame{Data: []byte{byte(i)}, CapturedAt: raised.Add(time.Duration(i-10) * time.Second)})
+	}
+
+	frames := s.preEventFrames("front", raised)
+	if len(frames) != 5 || frames[0].Data[0] != 6 || frames[4].Data[0] != 10 {
+		t.Errorf("pre-event frames = %v, want the ones from the last 4s", frames)
+	}
+	s.cfg.PreEventSeconds = 0
+	if frames := s.preEventFrames("front", raised); len(frames) != 0 {
+		t.Errorf("pre-event frames without a window = %d, want none", len(frames))
+	}
+}
+
+func TestSnapshotPostEventTimes(t *testing.T) {
+	raised := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name           string
+		post, interval int
+		want           []time.Duration
+	}{
+		{"every interval to the end", 4, 2, []time.Duration{2 * time.Second, 4 * time.Second}},
+		{"window not a multiple", 5, 2, []time.Duration{2 * time.Second, 4 * time.Second}},
+		{"interval past the window", 1, 2, nil},
+		{"no window", 0, 2, nil},
+		{"no interval", 4, 0, nil},
+	} {
+		s, _ := newTestSnapshots(t, nil, config.CaptureConfig{PostEventSeconds: tc.post, IntervalSeconds: tc.interval})
+		got := s.postEventTimes(raised)
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: %d captures, want %d", tc.name, len(got), len(tc.want))
+			continue
+		}
+		for i, offset := range tc.want {
+			if !got[i].Equal(raised.Add(offset)) {
+				t.Errorf("%s: capture %d at %v, want %v", tc.name, i, got[i].Sub(raised), offset)
+			}
+		}
+	}
+}
+
+// createTestAlert adds a camera alert with its premise and camera and
+// removes them with their snapshots after the test
+func createTestAlert(t *testing.T, db *gorm.DB, raisedAt time.Time) *models.Alert {
+	t.Helper()
+	camera := createTestCamera(t, db)
+	alert := createTestRow(t, db, &models.Alert{
+		Type:        models.AlertTypeSuspiciousActivity,
+		Severity:    models.AlertSeverityHigh,
+		Title:       "Movement at the gate",
+		Description: "Someone climbed the fence",
+		Location:    "Gate",
+		CameraID:    &camera.ID,
+		PremiseID:   camera.PremiseID,
+		CreatedAt:   raisedAt,
+	})
+	cleanupTestRows(t, db, &models.AlertSnapshot{}, "alert_id = ?", alert.ID)
+	return alert
+}
+
+func TestSnapshotsSplitAroundTheAlert(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, published := newTestSnapshots(t, db, config.CaptureConfig{PreEventSeconds: 4, PostEventSeconds: 4, IntervalSeconds: 2})
+	// Raised in the past so that the post-event captures are all due
+	raised := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	alert := createTestAlert(t, db, raised)
+	frame, err := (&capture.Simulated{}).Capture(ctx, "rtsp://test/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, offset := range []time.Duration{-6 * time.Second, -3 * time.Second, -time.Second} {
+		s.buffer.Add(alert.CameraID.String(), capture.Frame{Data: frame, CapturedAt: raised.Add(offset)})
+	}
+
+	// The buffered frames within the window and one taken now are stored,
+	// signed and returned for alert_created
+	snapshots, err := s.CaptureForAlert(ctx, alert)
+	if err != nil {
+		t.Fatalf("CaptureForAlert: %v", err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("CaptureForAlert returned %d snapshots, want 2 pre-event and the immediate one", len(snapshots))
+	}
+	for i, want := range []int64{-3000, -1000} {
+		if snapshots[i].OffsetMs != want {
+			t.Errorf("pre-event snapshot %d at %dms, want %dms", i, snapshots[i].OffsetMs, want)
+		}
+	}
+	if snapshots[2].OffsetMs < time.Minute.Milliseconds() {
+		t.Errorf("immediate snapshot at %dms, want it taken now", snapshots[2].OffsetMs)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.URL == "" || snapshot.ThumbnailURL == "" {
+			t.Errorf("snapshot %s is not signed", snapshot.ID)
+		}
+	}
+	if payload := published.payload("alert_snapshots_added"); payload != nil {
+		t.Errorf("CaptureForAlert published %v, want the snapshots returned only", payload)
+	}
+
+	// Only the post-event frames follow as alert_snapshots_added
+	s.CapturePostEvent(*alert)
+	payload, ok := published.payload("alert_snapshots_added").(map[string]any)
+	if !ok {
+		t.Fatal("no alert_snapshots_added after the post-event capture")
+	}
+	added := payload["snapshots"].([]models.AlertSnapshot)
+	if len(added) != 2 {
+		t.Fatalf("alert_snapshots_added carries %d snapshots, want the 2 post-event ones", len(added))
+	}
+	for _, snapshot := range added {
+		if snapshot.OffsetMs <= 0 || snapshot.URL == "" {
+			t.Errorf("post-event snapshot %+v", snapshot)
+		}
+	}
+
+	var stored int64
+	db.Model(&models.AlertSnapshot{}).Where("alert_id = ?", alert.ID).Count(&stored)
+	if stored != 5 {
+		t.Errorf("%d snapshots stored, want 5", stored)
+	}
+}
+
+// slowCapture is a simulated camera that takes delay to answer
+type slowCapture struct {
+	delay time.Duration
+}
+
+func (c *slowCapture) Capture(ctx context.Context, streamURL string) ([]byte, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return (&capture.Simulated{}).Capture(ctx, streamURL)
+}
+
+func TestSlowImmediateSnapshotFollowsTheAlert(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s, published := newTestSnapshots(t, db, config.CaptureConfig{AlertTimeoutSeconds: 1})
+	s.backend = &slowCapture{delay: 1500 * time.Millisecond}
+	alert := createTestAlert(t, db, time.Now().Truncate(time.Millisecond))
+
+	// alert_created does not wait for the camera beyond the alert timeout
+	start := time.Now()
+	snapshots, err := s.CaptureForAlert(ctx, alert)
+	if err != nil {
+		t.Fatalf("CaptureForAlert: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 1200*time.Millisecond {
+		t.Errorf("CaptureForAlert took %v, want about the 1s alert timeout", elapsed)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("CaptureForAlert returned %d snapshots, want none from a slow camera", len(snapshots))
+	}
+
+	// The late frame goes out as alert_snapshots_added, even without a
+	// post-event window
+	s.CapturePostEvent(*alert)
+	payload, ok := published.payload("alert_snapshots_added").(map[string]any)
+	if !ok {
+		t.Fatal("no alert_snapshots_added for the late immediate frame")
+	}
+	if added := payload["snapshots"].([]models.AlertSnapshot); len(added) != 1 {
+		t.Errorf("alert_snapshots_added carries %d snapshots, want the late immediate one", len(added))
+	}
+	if late := s.takeLate(alert.ID); late != nil {
+		t.Error("late frame still pending after the post-event capture")
+	}
+}
@@ -0,0 +1,561 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/storage"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxChecklistPhotoBytes = 20 << 20
+
+var (
+	ErrInvalidSOPTemplate    = errors.New("invalid SOP template")
+	ErrChecklistIncomplete   = errors.New("mandatory checklist steps are not done")
+	ErrChecklistItemNotFound = errors.New("checklist step not found")
+	ErrPhotoRequired         = errors.New("this step needs a photo")
+	ErrInvalidPhoto          = errors.New("photo must be an image")
+)
+
+// SOPTemplateInput creates or replaces a template; steps are kept in the
+// order given
+type SOPTemplateInput struct {
+	Name        string
+	Description string
+	AlertType   models.AlertType
+	PremiseType models.PremiseType
+	Severity    models.AlertSeverity
+	IsActive    bool
+	Steps       []SOPStepInput
+}
+
+type SOPStepInput struct {
+	Title         string
+	Instructions  string
+	Mandatory     bool
+	RequiresPhoto bool
+}
+
+// StepCompletion ticks a checklist step, with a photo when the step needs one
+type StepCompletion struct {
+	Note  string
+	Photo *AttachmentUpload
+}
+
+// IncidentChecklist is the SOP checklist of an incident and whether it
+// still blocks resolution
+type IncidentChecklist struct {
+	IncidentID         uuid.UUID                      `json:"incident_id"`
+	SOPTemplateID      *uuid.UUID                     `json:"sop_template_id,omitempty"`
+	Items              []models.IncidentChecklistItem `json:"items"`
+	MandatoryRemaining int                            `json:"mandatory_remaining"`
+	OverrideByID       *uuid.UUID                     `json:"override_by_id,omitempty"`
+	OverrideAt         *time.Time                     `json:"override_at,omitempty"`
+	OverrideReason     string                         `json:"override_reason,omitempty"`
+	Resolvable         bool                           `json:"resolvable"`
+}
+
+// SOPService manages SOP templates and the checklists instantiated from
+// them when alerts are assigned
+type SOPService interface {
+	ListTemplates(ctx context.Context) ([]models.SOPTemplate, error)
+	GetTemplate(ctx context.Context, id uuid.UUID) (*models.SOPTemplate, error)
+	CreateTemplate(ctx context.Context, input SOPTemplateInput, userID string) (*models.SOPTemplate, error)
+	UpdateTemplate(ctx context.Context, id uuid.UUID, input SOPTemplateInput, userID string) (*models.SOPTemplate, error)
+	DeleteTemplate(ctx context.Context, id uuid.UUID, userID string) error
+	GetChecklist(ctx context.Context, incidentID string, userRole models.UserRole, userID string) (*IncidentChecklist, error)
+	CompleteStep(ctx context.Context, incidentID, itemID string, completion StepCompletion, userRole models.UserRole, userID string) (*models.IncidentChecklistItem, error)
+	ReopenStep(ctx context.Context, incidentID, itemID string, userRole models.UserRole, userID string) (*models.IncidentChecklistItem, error)
+	OverrideChecklist(ctx context.Context, incidentID string, reason string, userID string) (*IncidentChecklist, error)
+}
+
+type sopService struct {
+	db     *gorm.DB
+	wsHub  *websocket.Hub
+	store  storage.Storage
+	audit  AuditService
+	urlTTL time.Duration
+}
+
+func NewSOPService(db *gorm.DB, wsHub *websocket.Hub, store storage.Storage, audit AuditService, urlTTL time.Duration) SOPService {
+	return &sopService{db: db, wsHub: wsHub, store: store, audit: audit, urlTTL: urlTTL}
+}
+
+func (s *sopService) ListTemplates(ctx context.Context) ([]models.SOPTemplate, error) {
+	var templates []models.SOPTemplate
+	if err := s.db.WithContext(ctx).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Order("alert_type, premise_type, severity, name").
+		Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *sopService) GetTemplate(ctx context.Context, id uuid.UUID) (*models.SOPTemplate, error) {
+	var template models.SOPTemplate
+	if err := s.db.WithContext(ctx).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		First(&template, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func (s *sopService) CreateTemplate(ctx context.Context, input SOPTemplateInput, userID string) (template *models.SOPTemplate, err error) {
+	defer func() {
+		resourceID := ""
+		if template != nil {
+			resourceID = template.ID.String()
+		}
+		recordAction(ctx, s.audit, "sop_template.create", "sop_template", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	if len(input.Steps) == 0 {
+		return nil, fmt.Errorf("%w: at least one step is required", ErrInvalidSOPTemplate)
+	}
+	created := models.SOPTemplate{
+		Name:        input.Name,
+		Description: input.Description,
+		AlertType:   input.AlertType,
+		PremiseType: input.PremiseType,
+		Severity:    input.Severity,
+		IsActive:    true,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		// is_active defaults to true, so an inactive template is stored in a second step
+		if !input.IsActive {
+			if err := tx.Model(&created).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		return createSOPSteps(tx, created.ID, input.Steps)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTemplate(ctx, created.ID)
+}
+
+// UpdateTemplate replaces the template and its steps. Checklists already
+// instantiated from it are not changed.
+func (s *sopService) UpdateTemplate(ctx context.Context, id uuid.UUID, input SOPTemplateInput, userID string) (template *models.SOPTemplate, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "sop_template.update", "sop_template", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	if len(input.Steps) == 0 {
+		return nil, fmt.Errorf("%w: at least one step is required", ErrInvalidSOPTemplate)
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.SOPTemplate{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.SOPTemplate{}).Where("id = ?", id).Updates(map[string]any{
+			"name":         input.Name,
+			"description":  input.Description,
+			"alert_type":   input.AlertType,
+			"premise_type": input.PremiseType,
+			"severity":     input.Severity,
+			"is_active":    input.IsActive,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.SOPStep{}, "template_id = ?", id).Error; err != nil {
+			return err
+		}
+		return createSOPSteps(tx, id, input.Steps)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTemplate(ctx, id)
+}
+
+func (s *sopService) DeleteTemplate(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "sop_template.delete", "sop_template", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.SOPTemplate{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.SOPStep{}, "template_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SOPTemplate{}, "id = ?", id).Error
+	})
+}
+
+func (s *sopService) GetChecklist(ctx context.Context, incidentID string, userRole models.UserRole, userID string) (*IncidentChecklist, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.checklist(ctx, incident)
+}
+
+// CompleteStep ticks a step. Ticking a step that is already done returns
+// it unchanged.
+func (s *sopService) CompleteStep(ctx context.Context, incidentID, itemID string, completion StepCompletion, userRole models.UserRole, userID string) (item *models.IncidentChecklistItem, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident.checklist_complete", "incident", normalizeID(incidentID), userID, userRole, err,
+			models.JSONMap{"item_id": itemID})
+	}()
+
+	incident, item, err := s.checklistItem(ctx, incidentID, itemID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	if item.CompletedAt != nil {
+		s.signPhoto(item)
+		return item, nil
+	}
+	if item.RequiresPhoto && completion.Photo == nil {
+		return nil, ErrPhotoRequired
+	}
+
+	if completion.Photo != nil {
+		if item.PhotoKey, err = s.storePhoto(ctx, incident.ID, item.ID, *completion.Photo); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	completedBy, _ := uuid.Parse(userID)
+	result := s.db.WithContext(ctx).Model(&models.IncidentChecklistItem{}).
+		Where("id = ? AND completed_at IS NULL", item.ID).
+		Updates(map[string]any{
+			"completed_at":    now,
+			"completed_by_id": completedBy,
+			"note":            completion.Note,
+			"photo_key":       item.PhotoKey,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// Someone else ticked it first; keep theirs
+		if item.PhotoKey != "" {
+			s.deletePhoto(ctx, item.PhotoKey)
+		}
+		if result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	item, err = s.loadItem(ctx, incident.ID, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.publishItem(ctx, incident, item)
+	return item, nil
+}
+
+// ReopenStep unticks a step of an incident that is not yet resolved
+func (s *sopService) ReopenStep(ctx context.Context, incidentID, itemID string, userRole models.UserRole, userID string) (item *models.IncidentChecklistItem, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident.checklist_reopen", "incident", normalizeID(incidentID), userID, userRole, err,
+			models.JSONMap{"item_id": itemID})
+	}()
+
+	incident, item, err := s.checklistItem(ctx, incidentID, itemID, userRole, userID)
+	if err != nil {
+		return nil, err
+	}
+	if incident.Status == models.IncidentStatusResolved {
+		return nil, ErrIncidentClosed
+	}
+	if item.CompletedAt == nil {
+		return item, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.IncidentChecklistItem{}).
+		Where("id = ?", item.ID).
+		Updates(map[string]any{
+			"completed_at":    nil,
+			"completed_by_id": nil,
+			"note":            "",
+			"photo_key":       "",
+		}).Error; err != nil {
+		return nil, err
+	}
+	if item.PhotoKey != "" {
+		s.deletePhoto(ctx, item.PhotoKey)
+	}
+
+	item, err = s.loadItem(ctx, incident.ID, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.publishItem(ctx, incident, item)
+	return item, nil
+}
+
+// OverrideChecklist lets the incident be resolved with mandatory steps
+// outstanding. Only operators may override, and the reason is kept.
+func (s *sopService) OverrideChecklist(ctx context.Context, incidentID string, reason string, userID string) (checklist *IncidentChecklist, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "incident.checklist_override", "incident", normalizeID(incidentID), userID, models.RoleSCSOperator, err,
+			models.JSONMap{"reason": reason})
+	}()
+
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, models.RoleSCSOperator, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireReportDraft(ctx, s.db, incident.ID); err != nil {
+		return nil, err
+	}
+	operatorID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrPermissionDenied
+	}
+	now := time.Now()
+	incident.ChecklistOverrideByID = &operatorID
+	incident.ChecklistOverrideAt = &now
+	incident.ChecklistOverrideReason = reason
+	if err := s.db.WithContext(ctx).Model(&models.Incident{}).Where("id = ?", incident.ID).Updates(map[string]any{
+		"checklist_override_by_id":  operatorID,
+		"checklist_override_at":     now,
+		"checklist_override_reason": reason,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	checklist, err = s.checklist(ctx, incident)
+	if err != nil {
+		return nil, err
+	}
+	s.wsHub.Publish(incidentTopics(ctx, s.db, incident), "incident_checklist_overridden", checklist)
+	return checklist, nil
+}
+
+func (s *sopService) checklist(ctx context.Context, incident *models.Incident) (*IncidentChecklist, error) {
+	checklist := IncidentChecklist{
+		IncidentID:     incident.ID,
+		SOPTemplateID:  incident.SOPTemplateID,
+		Items:          []models.IncidentChecklistItem{},
+		OverrideByID:   incident.ChecklistOverrideByID,
+		OverrideAt:     incident.ChecklistOverrideAt,
+		OverrideReason: incident.ChecklistOverrideReason,
+	}
+	if err := s.db.WithContext(ctx).Preload("CompletedBy").
+		Where("incident_id = ?", incident.ID).
+		Order("sequence").
+		Find(&checklist.Items).Error; err != nil {
+		return nil, err
+	}
+	for i := range checklist.Items {
+		item := &checklist.Items[i]
+		s.signPhoto(item)
+		if item.Mandatory && item.CompletedAt == nil {
+			checklist.MandatoryRemaining++
+		}
+	}
+	checklist.Resolvable = checklist.MandatoryRemaining == 0 || checklist.OverrideAt != nil
+	return &checklist, nil
+}
+
+// checklistItem loads a step of an incident the user takes part in.
+// Closed incidents and those with a finalized report cannot be changed.
+func (s *sopService) checklistItem(ctx context.Context, incidentID, itemID string, userRole models.UserRole, userID string) (*models.Incident, *models.IncidentChecklistItem, error) {
+	incident, err := requireIncidentAccess(ctx, s.db, incidentID, userRole, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if incident.Status == models.IncidentStatusClosed {
+		return nil, nil, ErrIncidentClosed
+	}
+	if err := requireReportDraft(ctx, s.db, incident.ID); err != nil {
+		return nil, nil, err
+	}
+	id, err := uuid.Parse(itemID)
+	if err != nil {
+		return nil, nil, ErrChecklistItemNotFound
+	}
+	item, err := s.loadItem(ctx, incident.ID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return incident, item, nil
+}
+
+func (s *sopService) loadItem(ctx context.Context, incidentID, itemID uuid.UUID) (*models.IncidentChecklistItem, error) {
+	var item models.IncidentChecklistItem
+	err := s.db.WithContext(ctx).Preload("CompletedBy").
+		First(&item, "id = ? AND incident_id = ?", itemID, incidentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChecklistItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.signPhoto(&item)
+	return &item, nil
+}
+
+// storePhoto checks that the upload is an image and saves it
+func (s *sopService) storePhoto(ctx context.Context, incidentID, itemID uuid.UUID, upload AttachmentUpload) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(upload.Reader, maxChecklistPhotoBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxChecklistPhotoBytes {
+		return "", fmt.Errorf("%w: file exceeds %d bytes", ErrInvalidPhoto, maxChecklistPhotoBytes)
+	}
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", ErrInvalidPhoto
+	}
+	key := fmt.Sprintf("checklists/%s/%s-%s%s", incidentID, itemID, uuid.NewString(), mediaExtension(contentType))
+	if err := s.store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("failed to store photo: %w", err)
+	}
+	return key, nil
+}
+
+func (s *sopService) deletePhoto(ctx context.Context, key string) {
+	if err := s.store.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete checklist photo %s: %v", key, err)
+	}
+}
+
+func (s *sopService) signPhoto(item *models.IncidentChecklistItem) {
+	if item.PhotoKey != "" {
+		item.PhotoURL = s.store.SignedURL(item.PhotoKey, s.urlTTL)
+	}
+}
+
+func (s *sopService) publishItem(ctx context.Context, incident *models.Incident, item *models.IncidentChecklistItem) {
+	s.wsHub.Publish(incidentTopics(ctx, s.db, incident), "incident_checklist_updated", map[string]any{
+		"incident_id": incident.ID,
+		"item":        item,
+	})
+}
+
+func createSOPSteps(tx *gorm.DB, templateID uuid.UUID, inputs []SOPStepInput) error {
+	steps := make([]models.SOPStep, 0, len(inputs))
+	for i, in := range inputs {
+		steps = append(steps, models.SOPStep{
+			TemplateID:    templateID,
+			Sequence:      i + 1,
+			Title:         in.Title,
+			Instructions:  in.Instructions,
+			Mandatory:     in.Mandatory,
+			RequiresPhoto: in.RequiresPhoto,
+		})
+	}
+	return tx.Create(&steps).Error
+}
+
+// matchSOPTemplate picks the active template for an alert. A key that is
+// set must match; among matches the alert type counts most, then the
+// premise type, then the severity, then the most recently edited.
+func matchSOPTemplate(ctx context.Context, db *gorm.DB, alert *models.Alert) (*models.SOPTemplate, error) {
+	var premise models.Premise
+	if err := db.WithContext(ctx).Select("id", "type").First(&premise, "id = ?", alert.PremiseID).Error; err != nil {
+		return nil, err
+	}
+	var templates []models.SOPTemplate
+	if err := db.WithContext(ctx).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("sequence") }).
+		Where("is_active = ?", true).
+		Where("alert_type = ? OR alert_type = ''", alert.Type).
+		Where("premise_type = ? OR premise_type = ''", premise.Type).
+		Where("severity = ? OR severity = ''", alert.Severity).
+		Order("updated_at DESC").
+		Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return mostSpecificSOPTemplate(templates), nil
+}
+
+// mostSpecificSOPTemplate picks the template with the most keys set,
+// weighted by importance; the first one wins a tie
+func mostSpecificSOPTemplate(templates []models.SOPTemplate) *models.SOPTemplate {
+	var best *models.SOPTemplate
+	bestScore := -1
+	for i := range templates {
+		t := &templates[i]
+		score := 0
+		if t.AlertType != "" {
+			score += 4
+		}
+		if t.PremiseType != "" {
+			score += 2
+		}
+		if t.Severity != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best
+}
+
+// instantiateChecklist copies the matching SOP template onto a new
+// incident. Incidents without a matching template get no checklist.
+func instantiateChecklist(ctx context.Context, db *gorm.DB, incident *models.Incident, alert *models.Alert) error {
+	template, err := matchSOPTemplate(ctx, db, alert)
+	if err != nil || template == nil {
+		return err
+	}
+	items := make([]models.IncidentChecklistItem, 0, len(template.Steps))
+	for _, step := range template.Steps {
+		stepID := step.ID
+		items = append(items, models.IncidentChecklistItem{
+			IncidentID:    incident.ID,
+			StepID:        &stepID,
+			Sequence:      step.Sequence,
+			Title:         step.Title,
+			Instructions:  step.Instructions,
+			Mandatory:     step.Mandatory,
+			RequiresPhoto: step.RequiresPhoto,
+		})
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.Incident{}).Where("id = ?", incident.ID).Update("sop_template_id", template.ID).Error; err != nil {
+			return err
+		}
+		incident.SOPTemplateID = &template.ID
+		incident.Checklist = items
+		return nil
+	})
+}
+
+// requireChecklistDone stops an incident from being resolved while
+// mandatory steps are outstanding, unless an operator overrode the checklist
+func requireChecklistDone(ctx context.Context, db *gorm.DB, incident *models.Incident) error {
+	if incident.ChecklistOverrideAt != nil {
+		return nil
+	}
+	var remaining int64
+	if err := db.WithContext(ctx).Model(&models.IncidentChecklistItem{}).
+		Where("incident_id = ? AND mandatory = ? AND completed_at IS NULL", incident.ID, true).
+		Count(&remaining).Error; err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%w: %d remaining", ErrChecklistIncomplete, remaining)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/storage"
+
+	"github.com/google/uuid"
+)
+
+func TestMostSpecificSOPTemplate(t *testing.T) {
+	if got := mostSpecificSOPTemplate(nil); got != nil {
+		t.Errorf("mostSpecificSOPTemplate(nil) = %+v", got)
+	}
+	for _, tt := range []struct {
+		name      string
+		templates []models.SOPTemplate
+		want      string
+	}{
+		{"only a fallback", []models.SOPTemplate{{Name: "fallback"}}, "fallback"},
+		{"alert type beats premise type and severity", []models.SOPTemplate{
+			{Name: "premise and severity", PremiseType: "bank", Severity: "high"},
+			{Name: "alert", AlertType: "intrusion"},
+		}, "alert"},
+		{"premise type beats severity", []models.SOPTemplate{
+			{Name: "severity", Severity: "high"},
+			{Name: "premise", PremiseType: "bank"},
+		}, "premise"},
+		{"every key set wins", []models.SOPTemplate{
+			{Name: "alert", AlertType: "intrusion"},
+			{Name: "all", AlertType: "intrusion", PremiseType: "bank", Severity: "high"},
+			{Name: "fallback"},
+		}, "all"},
+		{"first of a tie wins", []models.SOPTemplate{
+			{Name: "newest", AlertType: "intrusion"},
+			{Name: "older", AlertType: "intrusion"},
+		}, "newest"},
+	} {
+		if got := mostSpecificSOPTemplate(tt.templates); got == nil || got.Name != tt.want {
+			t.Errorf("%s: picked %+v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStorePhoto(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://localhost/media", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &sopService{store: store}
+	ctx := context.Background()
+	incidentID, itemID := uuid.New(), uuid.New()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	key, err := s.storePhoto(ctx, incidentID, itemID, AttachmentUpload{FileName: "photo.html", Reader: bytes.NewReader(png)})
+	if err != nil {
+		t.Fatalf("storePhoto: %v", err)
+	}
+	if prefix := fmt.Sprintf("checklists/%s/%s-", incidentID, itemID); !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, ".png") {
+		t.Errorf("stored as %s, want %s….png", key, prefix)
+	}
+
+	for _, upload := range []AttachmentUpload{
+		{FileName: "photo.png", Reader: strings.NewReader("<html><script>alert(1)</script></html>")},
+		{FileName: "photo.png", Reader: bytes.NewReader(append(png, make([]byte, maxChecklistPhotoBytes)...))},
+	} {
+		if _, err := s.storePhoto(ctx, incidentID, itemID, upload); !errors.Is(err, ErrInvalidPhoto) {
+			t.Errorf("storePhoto = %v, want ErrInvalidPhoto", err)
+		}
+	}
+}
+
+func TestCreateTemplateNeedsSteps(t *testing.T) {
+	s := NewSOPService(nil, nil, nil, nil, time.Minute)
+	if _, err := s.CreateTemplate(context.Background(), SOPTemplateInput{Name: "Intrusion"}, uuid.NewString()); !errors.Is(err, ErrInvalidSOPTemplate) {
+		t.Errorf("CreateTemplate without steps = %v, want ErrInvalidSOPTemplate", err)
+	}
+}
+
+func TestOverriddenChecklistIsDone(t *testing.T) {
+	overridden := time.Now()
+	if err := requireChecklistDone(context.Background(), nil, &models.Incident{ChecklistOverrideAt: &overridden}); err != nil {
+		t.Errorf("requireChecklistDone after an override = %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"smart-city-surveillance/internal/database"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	testDBOnce sync.Once
+	testDBConn *gorm.DB
+	testDBErr  error
+)
+
+// testDB connects to the Postgres database in TEST_DATABASE_DSN and
+// migrates it once per run. Tests that need it are skipped without it; each
+// removes the rows it creates.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	testDBOnce.Do(func() {
+		testDBConn, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr != nil {
+			return
+		}
+		database.DB = testDBConn
+		testDBErr = database.Migrate()
+	})
+	if testDBErr != nil {
+		t.Fatalf("test database: %v", testDBErr)
+	}
+	return testDBConn
+}
+
+// dryRunDB builds Postgres SQL without a connection, for checking the
+// statements a query produces
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("dry run database: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/websocket"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Realtime topics. Alert events are published to every severity topic at or
+// below the alert's severity, so a subscription to alerts:severity>=high
+// receives high and critical alerts.
+const (
+	TopicIncidents = "incidents"
+	TopicMap       = "map"
+	TopicPresence  = "presence"
+	TopicSafety    = "safety"
+	TopicPatrols   = "patrols"
+
+	topicPremisePrefix  = "premise:"
+	topicCameraPrefix   = "camera:"
+	topicIncidentPrefix = "incident:"
+	topicSeverityPrefix = "alerts:severity>="
+)
+
+var ErrTopicNotFound = errors.New("unknown topic")
+
+// severityOrder lists alert severities from lowest to highest
+var severityOrder = []models.AlertSeverity{
+	models.AlertSeverityLow,
+	models.AlertSeverityMedium,
+	models.AlertSeverityHigh,
+	models.AlertSeverityCritical,
+}
+
+func PremiseTopic(id uuid.UUID) string  { return topicPremisePrefix + id.String() }
+func CameraTopic(id uuid.UUID) string   { return topicCameraPrefix + id.String() }
+func IncidentTopic(id uuid.UUID) string { return topicIncidentPrefix + id.String() }
+
+func SeverityTopic(severity models.AlertSeverity) string {
+	return topicSeverityPrefix + string(severity)
+}
+
+// alertTopics returns the topics an alert event is published to. Guards
+// only follow incident topics, so the alert's incidents are included for the
+// guards assigned to them.
+func alertTopics(ctx context.Context, db *gorm.DB, alert *models.Alert) []string {
+	topics := []string{PremiseTopic(alert.PremiseID)}
+	if alert.CameraID != nil {
+		topics = append(topics, CameraTopic(*alert.CameraID))
+	}
+	for _, severity := range severityOrder {
+		topics = append(topics, SeverityTopic(severity))
+		if severity == alert.Severity {
+			break
+		}
+	}
+	var incidentIDs []uuid.UUID
+	if err := db.WithContext(ctx).Model(&models.Incident{}).Where("alert_id = ?", alert.ID).Pluck("id", &incidentIDs).Error; err == nil {
+		for _, id := range incidentIDs {
+			topics = append(topics, IncidentTopic(id))
+		}
+	}
+	return topics
+}
+
+// incidentTopics returns the topics an incident event is published to; the
+// incident's alert decides premise and camera
+func incidentTopics(ctx context.Context, db *gorm.DB, incident *models.Incident) []string {
+	topics := []string{IncidentTopic(incident.ID), TopicIncidents}
+	var alert models.Alert
+	if err := db.WithContext(ctx).Select("premise_id", "camera_id").First(&alert, "id = ?", incident.AlertID).Error; err == nil {
+		topics = append(topics, PremiseTopic(alert.PremiseID))
+		if alert.CameraID != nil {
+			topics = append(topics, CameraTopic(*alert.CameraID))
+		}
+	}
+	return topics
+}
+
+// DefaultOperatorTopics are subscribed for operators on connect
+var DefaultOperatorTopics = []string{SeverityTopic(models.AlertSeverityLow), TopicIncidents, TopicMap, TopicPresence, TopicSafety, TopicPatrols}
+
+type topicAuthorizer struct {
+	db *gorm.DB
+}
+
+// NewTopicAuthorizer checks subscriptions against the same rules as the REST
+// endpoints: operators see everything, guards only the incidents assigned to
+// them. Premise and camera topics carry every alert there, so they are for
+// operators only.
+func NewTopicAuthorizer(db *gorm.DB) websocket.TopicAuthorizer {
+	return &topicAuthorizer{db: db}
+}
+
+func (a *topicAuthorizer) AuthorizeTopic(ctx context.Context, userID, role, topic string) error {
+	isOperator := models.UserRole(role) == models.RoleSCSOperator
+
+	switch {
+	case topic == TopicIncidents || topic == TopicMap || topic == TopicPresence || topic == TopicSafety ||
+		topic == TopicPatrols:
+		return requireOperator(isOperator)
+
+	case strings.HasPrefix(topic, topicSeverityPrefix):
+		severity := models.AlertSeverity(strings.TrimPrefix(topic, topicSeverityPrefix))
+		if !validSeverity(severity) {
+			return ErrTopicNotFound
+		}
+		return requireOperator(isOperator)
+
+	case strings.HasPrefix(topic, topicPremisePrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, topicPremisePrefix))
+		if err != nil {
+			return ErrTopicNotFound
+		}
+		if err := a.db.WithContext(ctx).First(&models.Premise{}, "id = ?", id).Error; err != nil {
+			return ErrTopicNotFound
+		}
+		return requireOperator(isOperator)
+
+	case strings.HasPrefix(topic, topicCameraPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, topicCameraPrefix))
+		if err != nil {
+			return ErrTopicNotFound
+		}
+		if err := a.db.WithContext(ctx).First(&models.Camera{}, "id = ?", id).Error; err != nil {
+			return ErrTopicNotFound
+		}
+		return requireOperator(isOperator)
+
+	case strings.HasPrefix(topic, topicIncidentPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(topic, topicIncidentPrefix))
+		if err != nil {
+			return ErrTopicNotFound
+		}
+		if err := a.db.WithContext(ctx).First(&models.Incident{}, "id = ?", id).Error; err != nil {
+			return ErrTopicNotFound
+		}
+		if isOperator {
+			return nil
+		}
+		return a.requireCount(ctx, a.db.WithContext(ctx).Table("incident_guards").
+			Where("incident_id = ? AND guard_id = ?", id, userID))
+	}
+	return ErrTopicNotFound
+}
+
+func (a *topicAuthorizer) requireCount(ctx context.Context, query *gorm.DB) error {
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("authorization check failed: %w", err)
+	}
+	if count == 0 {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+func requireOperator(isOperator bool) error {
+	if !isOperator {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+func validSeverity(severity models.AlertSeverity) bool {
+	for _, s := range severityOrder {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
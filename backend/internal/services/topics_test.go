@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"smart-city-surveillance/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthorizeNamedTopics(t *testing.T) {
+	ctx := context.Background()
+	a := NewTopicAuthorizer(nil)
+	operator, guard := string(models.RoleSCSOperator), string(models.RoleSecurityGuard)
+
+	for _, topic := range append([]string{SeverityTopic(models.AlertSeverityCritical)}, DefaultOperatorTopics...) {
+		if err := a.AuthorizeTopic(ctx, "operator", operator, topic); err != nil {
+			t.Errorf("operator denied %s: %v", topic, err)
+		}
+		if err := a.AuthorizeTopic(ctx, "guard", guard, topic); err == nil {
+			t.Errorf("guard granted %s", topic)
+		}
+	}
+
+	// Unknown and malformed topics are refused before any lookup
+	for _, topic := range []string{
+		"",
+		"alerts",
+		"alerts:severity>=urgent",
+		"premise:not-a-uuid",
+		"camera:",
+		"incident:" + uuid.NewString()[:8],
+		"zone:" + uuid.NewString(),
+	} {
+		if err := a.AuthorizeTopic(ctx, "operator", operator, topic); !errors.Is(err, ErrTopicNotFound) {
+			t.Errorf("AuthorizeTopic(%q) = %v, want ErrTopicNotFound", topic, err)
+		}
+	}
+}
+
+func TestAuthorizeIncidentTopics(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	a := NewTopicAuthorizer(db)
+	camera := createTestCamera(t, db)
+	alert := createTestRow(t, db, &models.Alert{
+		Type:      models.AlertTypeSuspiciousActivity,
+		Severity:  models.AlertSeverityHigh,
+		Title:     "Movement at the gate",
+		Location:  "Gate",
+		CameraID:  &camera.ID,
+		PremiseID: camera.PremiseID,
+	})
+	incident := createTestRow(t, db, &models.Incident{AlertID: alert.ID, Status: models.IncidentStatusOpen, Location: "Gate"})
+	assigned, other := createTestUser(t, db).ID, createTestUser(t, db).ID
+	createTestRow(t, db, &models.IncidentGuard{IncidentID: incident.ID, GuardID: assigned})
+	guard := string(models.RoleSecurityGuard)
+
+	topic := IncidentTopic(incident.ID)
+	if err := a.AuthorizeTopic(ctx, assigned.String(), guard, topic); err != nil {
+		t.Errorf("assigned guard denied %s: %v", topic, err)
+	}
+	if err := a.AuthorizeTopic(ctx, other.String(), guard, topic); err == nil {
+		t.Errorf("unassigned guard granted %s", topic)
+	}
+	if err := a.AuthorizeTopic(ctx, other.String(), string(models.RoleSCSOperator), topic); err != nil {
+		t.Errorf("operator denied %s: %v", topic, err)
+	}
+	// Premise and camera topics carry every alert there
+	for _, topic := range []string{PremiseTopic(camera.PremiseID), CameraTopic(camera.ID)} {
+		if err := a.AuthorizeTopic(ctx, assigned.String(), guard, topic); err == nil {
+			t.Errorf("guard granted %s", topic)
+		}
+	}
+	if err := a.AuthorizeTopic(ctx, assigned.String(), guard, IncidentTopic(uuid.New())); !errors.Is(err, ErrTopicNotFound) {
+		t.Errorf("AuthorizeTopic of an unknown incident = %v, want ErrTopicNotFound", err)
+	}
+}
@@ -6,15 +6,37 @@ import (
 
 	"smart-city-surveillance/internal/models"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type UserService interface {
-	GetAll(ctx context.Context, userRole models.UserRole) ([]models.User, error)
+	GetAll(ctx context.Context, q ListQuery, userRole models.UserRole) (*Page[models.User], error)
 	GetByAssignedCameraID(ctx context.Context, cameraID string, userRole models.UserRole) ([]models.User, error)
 	GetByAssignedIncidentID(ctx context.Context, incidentID string, userRole models.UserRole) ([]models.User, error)
 }
 
+var userListSpec = &listSpec[models.User]{
+	table: "users",
+	id:    func(u *models.User) uuid.UUID { return u.ID },
+	sorts: map[string]listColumn[models.User]{
+		"created_at": {expr: "users.created_at", kind: cursorTime, value: func(u *models.User) any { return u.CreatedAt }},
+		"username":   {expr: "users.username", kind: cursorString, value: func(u *models.User) any { return u.Username }},
+		"last_name":  {expr: "users.last_name", kind: cursorString, value: func(u *models.User) any { return u.LastName }},
+		"role":       {expr: "users.role", kind: cursorString, value: func(u *models.User) any { return string(u.Role) }},
+	},
+	defaultSort: []SortField{{Field: "username"}},
+	filters: map[string]listFilter{
+		"role":      {clause: "users.role IN ?"},
+		"is_active": {clause: "users.is_active IN ?", kind: filterBool},
+		"on_duty":   {clause: "users.on_duty IN ?", kind: filterBool},
+	},
+	relations: map[string]listRelation{
+		"camera_assignments":   {preload: "CameraAssignments"},
+		"incident_assignments": {preload: "IncidentAssignments"},
+	},
+}
+
 type userService struct {
 	db *gorm.DB
 }
@@ -23,13 +45,11 @@ func NewUserService(db *gorm.DB) UserService {
 	return &userService{db: db}
 }
 
-func (s *userService) GetAll(ctx context.Context, userRole models.UserRole) ([]models.User, error) {
+func (s *userService) GetAll(ctx context.Context, q ListQuery, userRole models.UserRole) (*Page[models.User], error) {
 	if userRole != models.RoleSCSOperator {
 		return nil, errors.New("permission denied")
 	}
-	var users []models.User
-	err := s.db.WithContext(ctx).Find(&users).Error
-	return users, err
+	return userListSpec.find(s.db.WithContext(ctx).Model(&models.User{}), q)
 }
 
 func (s *userService) GetByAssignedCameraID(ctx context.Context, cameraID string, userRole models.UserRole) ([]models.User, error) {
@@ -0,0 +1,708 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/webhook"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	webhookLease          = 2 * time.Minute
+	maxWebhookBackoff     = 6 * time.Hour
+	webhookBatchSize      = 100
+	webhookQueueTimeout   = 10 * time.Second
+	webhookSenders        = 8
+	webhookResponseLimit  = 1024
+	webhookUserAgent      = "SmartCitySurveillance-Webhook/1.0"
+	WebhookEventPing      = "ping"
+	maxWebhookURLLength   = 2048
+	webhookDisabledReason = "disabled after %d failed attempts in a row"
+)
+
+var (
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrWebhookDisabled = errors.New("webhook is disabled")
+	// ErrWebhookTarget refuses to reach an address inside the network
+	ErrWebhookTarget = errors.New("webhook target is a private address")
+)
+
+// webhookEvents are the realtime events forwarded to subscriptions, under
+// the same type and with the same payload
+var webhookEvents = map[string]bool{
+	"alert_created":            true,
+	"alert_acknowledged":       true,
+	"alert_assigned":           true,
+	"alert_updated":            true,
+	"incident_updated":         true,
+	"incident_update_received": true,
+}
+
+// WebhookInput creates or replaces a subscription. An empty Secret keeps
+// the current one, or generates one for a new subscription.
+type WebhookInput struct {
+	Name       string
+	URL        string
+	Secret     string
+	EventTypes []string
+	PremiseIDs []string
+	// Active re-enables a disabled subscription; nil leaves it as it is
+	Active *bool
+}
+
+// WebhookWithSecret is returned when the secret is set, the only time it
+// is shown
+type WebhookWithSecret struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookOptions tunes delivery
+type WebhookOptions struct {
+	// MaxAttempts and RetryBase work as in NotificationOptions
+	MaxAttempts int
+	RetryBase   time.Duration
+	Timeout     time.Duration
+	// DisableAfter failed attempts in a row disable the subscription
+	DisableAfter int
+	// AllowPrivateTargets lets subscriptions reach loopback, private and
+	// link-local addresses, for a receiver on the local network
+	AllowPrivateTargets bool
+}
+
+// WebhooksService manages webhook subscriptions and posts alert and
+// incident events to them from a retrying queue
+type WebhooksService interface {
+	ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (*models.WebhookSubscription, error)
+	CreateWebhook(ctx context.Context, input WebhookInput, userID string) (*WebhookWithSecret, error)
+	UpdateWebhook(ctx context.Context, id uuid.UUID, input WebhookInput, userID string) (*models.WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID, userID string) error
+	RotateSecret(ctx context.Context, id uuid.UUID, userID string) (*WebhookWithSecret, error)
+	// Ping queues a ping event for the subscription alone
+	Ping(ctx context.Context, id uuid.UUID, userID string) (*models.WebhookDelivery, error)
+
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, q ListQuery) (*Page[models.WebhookDelivery], error)
+	GetDelivery(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*models.WebhookDelivery, error)
+	// Redeliver queues a delivery again with a fresh set of attempts
+	Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID, userID string) (*models.WebhookDelivery, error)
+
+	// Publish stores a delivery for each subscription the event matches
+	// before returning, so that queued events survive a restart. It is the
+	// hub's publish hook, so every realtime event passes through it.
+	Publish(topics []string, messageType string, payload any)
+	// Run sends queued deliveries until ctx is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+var webhookDeliveryListSpec = &listSpec[models.WebhookDelivery]{
+	table: "webhook_deliveries",
+	id:    func(d *models.WebhookDelivery) uuid.UUID { return d.ID },
+	sorts: map[string]listColumn[models.WebhookDelivery]{
+		"created_at": {expr: "webhook_deliveries.created_at", kind: cursorTime, value: func(d *models.WebhookDelivery) any { return d.CreatedAt }},
+	},
+	defaultSort: []SortField{{Field: "created_at", Desc: true}},
+	filters: map[string]listFilter{
+		"status":     {clause: "webhook_deliveries.status IN ?"},
+		"event_type": {clause: "webhook_deliveries.event_type IN ?"},
+		"event_id":   {clause: "webhook_deliveries.event_id IN ?", kind: filterUUID},
+	},
+}
+
+type webhooksService struct {
+	db     *gorm.DB
+	audit  AuditService
+	opts   WebhookOptions
+	client *http.Client
+	queue  *retryQueue
+	wake   chan struct{}
+}
+
+func NewWebhooksService(db *gorm.DB, audit AuditService, opts WebhookOptions) WebhooksService {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !opts.AllowPrivateTargets {
+		// Checked on the address actually dialed, so a host that resolves
+		// differently after the subscription was saved is still refused
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookTarget, host)
+			}
+			return nil
+		}
+	}
+	return &webhooksService{
+		db:    db,
+		audit: audit,
+		opts:  opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// No proxy, which would dial the target on our behalf unchecked
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConnsPerHost: webhookSenders,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// A redirect is reported as the response it is rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		queue: &retryQueue{
+			table:      "webhook_deliveries",
+			pending:    string(models.WebhookPending),
+			lease:      webhookLease,
+			batchSize:  webhookBatchSize,
+			senders:    webhookSenders,
+			attempts:   opts.MaxAttempts,
+			retryBase:  opts.RetryBase,
+			maxBackoff: maxWebhookBackoff,
+			now:        time.Now,
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// privateAddress reports whether the address is inside the network or the
+// host: loopback, private, link-local (cloud metadata included), CGNAT and
+// unspecified addresses
+func privateAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4[0] == 0 || (ip4[0] == 100 && ip4[1]&0xc0 == 64)
+	}
+	return false
+}
+
+func (s *webhooksService) ListWebhooks(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := s.db.WithContext(ctx).Order("created_at").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (s *webhooksService) GetWebhook(ctx context.Context, id uuid.UUID) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	if err := s.db.WithContext(ctx).First(&subscription, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (s *webhooksService) CreateWebhook(ctx context.Context, input WebhookInput, userID string) (created *WebhookWithSecret, err error) {
+	defer func() {
+		resourceID := ""
+		if created != nil {
+			resourceID = created.ID.String()
+		}
+		recordAction(ctx, s.audit, "webhook.create", "webhook", resourceID, userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	subscription := models.WebhookSubscription{Active: true}
+	if err := s.applyInput(ctx, &subscription, input); err != nil {
+		return nil, err
+	}
+	if subscription.Secret == "" {
+		if subscription.Secret, err = webhook.NewSecret(); err != nil {
+			return nil, err
+		}
+	}
+	subscription.CreatedByID = requester(userID)
+	if err := s.db.WithContext(ctx).Create(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &WebhookWithSecret{WebhookSubscription: subscription, Secret: subscription.Secret}, nil
+}
+
+func (s *webhooksService) UpdateWebhook(ctx context.Context, id uuid.UUID, input WebhookInput, userID string) (subscription *models.WebhookSubscription, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "webhook.update", "webhook", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	existing, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyInput(ctx, existing, input); err != nil {
+		return nil, err
+	}
+	if input.Active != nil {
+		if *input.Active && !existing.Active {
+			existing.ConsecutiveFailures = 0
+			existing.DisabledAt = nil
+			existing.DisabledReason = ""
+		}
+		existing.Active = *input.Active
+	}
+	if err := s.db.WithContext(ctx).Save(existing).Error; err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *webhooksService) DeleteWebhook(ctx context.Context, id uuid.UUID, userID string) (err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "webhook.delete", "webhook", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("delivery_id IN (?)", tx.Model(&models.WebhookDelivery{}).Select("id").Where("subscription_id = ?", id)).
+			Delete(&models.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.WebhookSubscription{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// RotateSecret replaces the secret; requests are signed with the new one
+// from the next attempt on
+func (s *webhooksService) RotateSecret(ctx context.Context, id uuid.UUID, userID string) (rotated *WebhookWithSecret, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "webhook.rotate_secret", "webhook", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	subscription, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Secret, err = webhook.NewSecret(); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(subscription).Update("secret", subscription.Secret).Error; err != nil {
+		return nil, err
+	}
+	return &WebhookWithSecret{WebhookSubscription: *subscription, Secret: subscription.Secret}, nil
+}
+
+func (s *webhooksService) Ping(ctx context.Context, id uuid.UUID, userID string) (delivery *models.WebhookDelivery, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "webhook.ping", "webhook", id.String(), userID, models.RoleSCSOperator, err, nil)
+	}()
+
+	subscription, err := s.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !subscription.Active {
+		return nil, ErrWebhookDisabled
+	}
+	deliveries, err := s.enqueue(ctx, []models.WebhookSubscription{*subscription}, WebhookEventPing, nil, map[string]any{
+		"webhook_id": subscription.ID,
+		"message":    "Webhook is set up",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+func (s *webhooksService) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, q ListQuery) (*Page[models.WebhookDelivery], error) {
+	if _, err := s.GetWebhook(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	query := s.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("webhook_deliveries.subscription_id = ?", subscriptionID)
+	return webhookDeliveryListSpec.find(query, q)
+}
+
+func (s *webhooksService) GetDelivery(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := s.db.WithContext(ctx).
+		Preload("AttemptLog", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		First(&delivery, "id = ? AND subscription_id = ?", deliveryID, subscriptionID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *webhooksService) Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID, userID string) (delivery *models.WebhookDelivery, err error) {
+	defer func() {
+		recordAction(ctx, s.audit, "webhook.redeliver", "webhook_delivery", deliveryID.String(), userID, models.RoleSCSOperator, err,
+			models.JSONMap{"webhook_id": subscriptionID.String()})
+	}()
+
+	subscription, err := s.GetWebhook(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if !subscription.Active {
+		return nil, ErrWebhookDisabled
+	}
+	result := s.db.WithContext(ctx).Model(&models.WebhookDelivery{}).
+		Where("id = ? AND subscription_id = ? AND status <> ?", deliveryID, subscriptionID, models.WebhookPending).
+		Updates(map[string]any{
+			"status":          models.WebhookPending,
+			"attempts":        0,
+			"next_attempt_at": s.queue.now(),
+			"last_error":      "",
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// A delivery that is still pending is already queued
+	if result.RowsAffected > 0 {
+		s.wakeUp()
+	}
+	return s.GetDelivery(ctx, subscriptionID, deliveryID)
+}
+
+func (s *webhooksService) Publish(topics []string, messageType string, payload any) {
+	if !webhookEvents[messageType] {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookQueueTimeout)
+	defer cancel()
+	s.queueEvent(ctx, topics, messageType, payload)
+}
+
+// queueEvent queues the event for the subscriptions it matches
+func (s *webhooksService) queueEvent(ctx context.Context, topics []string, messageType string, payload any) {
+	var premiseID *uuid.UUID
+	for _, topic := range topics {
+		if id, err := uuid.Parse(strings.TrimPrefix(topic, topicPremisePrefix)); err == nil && strings.HasPrefix(topic, topicPremisePrefix) {
+			premiseID = &id
+			break
+		}
+	}
+	premise := ""
+	if premiseID != nil {
+		premise = premiseID.String()
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := s.db.WithContext(ctx).
+		Where("active").
+		Where("COALESCE(cardinality(event_types), 0) = 0 OR ? = ANY(event_types)", messageType).
+		Where("COALESCE(cardinality(premise_ids), 0) = 0 OR ? = ANY(premise_ids)", premise).
+		Find(&subscriptions).Error; err != nil {
+		log.Printf("Failed to match webhooks for %s: %v", messageType, err)
+		return
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+	if _, err := s.enqueue(ctx, subscriptions, messageType, premiseID, payload); err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", messageType, err)
+	}
+}
+
+// enqueue queues the event for each subscription. The body is fixed now, so
+// every attempt and redelivery sends the same event.
+func (s *webhooksService) enqueue(ctx context.Context, subscriptions []models.WebhookSubscription, eventType string, premiseID *uuid.UUID, payload any) ([]models.WebhookDelivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	now := s.queue.now()
+	eventID := uuid.New()
+	body := models.JSONMap{
+		"id":         eventID,
+		"type":       eventType,
+		"created_at": now.UTC(),
+		"premise_id": premiseID,
+		"data":       decoded,
+	}
+
+	deliveries := make([]models.WebhookDelivery, len(subscriptions))
+	for i, subscription := range subscriptions {
+		deliveries[i] = models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        body,
+			Status:         models.WebhookPending,
+			NextAttemptAt:  now,
+		}
+	}
+	if err := s.db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	s.wakeUp()
+	return deliveries, nil
+}
+
+func (s *webhooksService) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *webhooksService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sendDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// sendDue sends due deliveries of active subscriptions, a few at a time
+func (s *webhooksService) sendDue(ctx context.Context) {
+	var due []models.WebhookDelivery
+	if err := s.queue.due(s.db.WithContext(ctx).
+		Joins("JOIN webhook_subscriptions ON webhook_subscriptions.id = webhook_deliveries.subscription_id AND webhook_subscriptions.active"),
+		&due); err != nil {
+		log.Printf("Failed to load due webhooks: %v", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(due))
+	for _, delivery := range due {
+		ids = append(ids, delivery.SubscriptionID)
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&subscriptions).Error; err != nil {
+		log.Printf("Failed to load webhook subscriptions: %v", err)
+		return
+	}
+	byID := make(map[uuid.UUID]*models.WebhookSubscription, len(subscriptions))
+	for i := range subscriptions {
+		byID[subscriptions[i].ID] = &subscriptions[i]
+	}
+
+	s.queue.each(len(due), func(i int) {
+		if subscription := byID[due[i].SubscriptionID]; subscription != nil {
+			s.deliver(ctx, subscription, &due[i])
+		}
+	})
+}
+
+func (s *webhooksService) deliver(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) {
+	attempts, err := s.queue.claim(ctx, s.db, delivery.ID, delivery.Attempts)
+	if err != nil {
+		log.Printf("Failed to claim webhook delivery %s: %v", delivery.ID, err)
+		return
+	}
+	if attempts == 0 {
+		return
+	}
+
+	attempt := s.post(ctx, subscription, delivery)
+	attempt.DeliveryID = delivery.ID
+	attempt.Attempt = attempts
+	if err := s.db.WithContext(ctx).Create(&attempt).Error; err != nil {
+		log.Printf("Failed to log webhook attempt for %s: %v", delivery.ID, err)
+	}
+
+	now := s.queue.now()
+	updates := map[string]any{"last_status_code": attempt.StatusCode, "last_error": attempt.Error}
+	delivered := attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300
+	// Timeouts, throttling and server errors are worth retrying; a receiver
+	// that rejects the request will keep rejecting it
+	retryable := attempt.StatusCode == 0 || attempt.StatusCode == http.StatusRequestTimeout ||
+		attempt.StatusCode == http.StatusTooManyRequests || attempt.StatusCode >= 500
+	switch {
+	case delivered:
+		updates["status"] = models.WebhookDelivered
+		updates["delivered_at"] = now
+	case !retryable || s.queue.giveUp(attempts):
+		updates["status"] = models.WebhookFailed
+	default:
+		updates["next_attempt_at"] = now.Add(s.queue.backoff(attempts))
+	}
+	if err := s.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+
+	if delivered {
+		if subscription.ConsecutiveFailures > 0 {
+			if err := s.db.WithContext(ctx).Model(&models.WebhookSubscription{}).Where("id = ?", subscription.ID).
+				Update("consecutive_failures", 0).Error; err != nil {
+				log.Printf("Failed to reset failures of webhook %s: %v", subscription.ID, err)
+			}
+		}
+		return
+	}
+	s.recordFailure(ctx, subscription.ID)
+}
+
+// post sends the delivery and describes the outcome as an attempt
+func (s *webhooksService) post(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	var attempt models.WebhookAttempt
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	webhook.SetHeaders(req.Header, subscription.Secret, delivery.EventType, delivery.ID.String(), time.Now(), body)
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	attempt.StatusCode = resp.StatusCode
+	attempt.ResponseBody = strings.ToValidUTF8(string(response), "")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = resp.Status
+	}
+	return attempt
+}
+
+// recordFailure counts a failed attempt against the subscription and
+// disables it once too many have failed in a row. Its queued deliveries
+// fail with it; they can be redelivered after it is re-enabled.
+func (s *webhooksService) recordFailure(ctx context.Context, id uuid.UUID) {
+	var counted []models.WebhookSubscription
+	if err := s.db.WithContext(ctx).Model(&counted).Clauses(clause.Returning{}).
+		Where("id = ?", id).
+		Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+		log.Printf("Failed to count failure of webhook %s: %v", id, err)
+		return
+	}
+	if len(counted) == 0 || counted[0].ConsecutiveFailures < s.opts.DisableAfter {
+		return
+	}
+
+	now := time.Now()
+	reason := fmt.Sprintf(webhookDisabledReason, counted[0].ConsecutiveFailures)
+	disable := s.db.WithContext(ctx).Model(&models.WebhookSubscription{}).
+		Where("id = ? AND active", id).
+		Updates(map[string]any{"active": false, "disabled_at": now, "disabled_reason": reason})
+	if disable.Error != nil {
+		log.Printf("Failed to disable webhook %s: %v", id, disable.Error)
+		return
+	}
+	if disable.RowsAffected == 0 {
+		return
+	}
+	log.Printf("Webhook %s (%s) %s", id, counted[0].URL, reason)
+	recordAction(ctx, s.audit, "webhook.disable", "webhook", id.String(), "system", "", nil, models.JSONMap{"reason": reason})
+
+	if err := s.db.WithContext(ctx).Model(&models.WebhookDelivery{}).
+		Where("subscription_id = ? AND status = ?", id, models.WebhookPending).
+		Updates(map[string]any{"status": models.WebhookFailed, "last_error": "webhook disabled"}).Error; err != nil {
+		log.Printf("Failed to fail queued deliveries of webhook %s: %v", id, err)
+	}
+}
+
+// applyInput validates the input into the subscription
+func (s *webhooksService) applyInput(ctx context.Context, subscription *models.WebhookSubscription, input WebhookInput) error {
+	subscription.Name = strings.TrimSpace(input.Name)
+	if subscription.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidWebhook)
+	}
+
+	target, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" || len(input.URL) > maxWebhookURLLength {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if err := s.checkTarget(ctx, target.Hostname()); err != nil {
+		return err
+	}
+	subscription.URL = target.String()
+
+	if input.Secret != "" {
+		if len(input.Secret) < 16 {
+			return fmt.Errorf("%w: secret must be at least 16 characters", ErrInvalidWebhook)
+		}
+		subscription.Secret = input.Secret
+	}
+
+	subscription.EventTypes = pq.StringArray{}
+	for _, eventType := range input.EventTypes {
+		if !webhookEvents[eventType] {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+		subscription.EventTypes = append(subscription.EventTypes, eventType)
+	}
+
+	subscription.PremiseIDs = pq.StringArray{}
+	for _, raw := range input.PremiseIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("%w: invalid premise id %q", ErrInvalidWebhook, raw)
+		}
+		subscription.PremiseIDs = append(subscription.PremiseIDs, id.String())
+	}
+	if len(subscription.PremiseIDs) > 0 {
+		var found int64
+		if err := s.db.WithContext(ctx).Model(&models.Premise{}).Where("id IN ?", []string(subscription.PremiseIDs)).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(subscription.PremiseIDs) {
+			return fmt.Errorf("%w: unknown premise", ErrInvalidWebhook)
+		}
+	}
+	return nil
+}
+
+// checkTarget refuses a host that is or resolves to a private address,
+// unless those are allowed. Delivery checks the dialed address again.
+func (s *webhooksService) checkTarget(ctx context.Context, host string) error {
+	if s.opts.AllowPrivateTargets {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if privateAddress(ip) {
+			return fmt.Errorf("%w: %w: %s", ErrInvalidWebhook, ErrWebhookTarget, host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s", ErrInvalidWebhook, host)
+	}
+	for _, addr := range addrs {
+		if privateAddress(addr.IP) {
+			return fmt.Errorf("%w: %w: %s resolves to %s", ErrInvalidWebhook, ErrWebhookTarget, host, addr.IP)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smart-city-surveillance/internal/models"
+	"smart-city-surveillance/pkg/webhook"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func newTestWebhooks(db *gorm.DB, opts WebhookOptions) *webhooksService {
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	return NewWebhooksService(db, nil, opts).(*webhooksService)
+}
+
+// webhookReceiver answers with the statuses in turn, repeating the last, and
+// checks every request's signature against secret
+func webhookReceiver(t *testing.T, secret *string, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(hits.Add(1))
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(*secret, r.Header, body, time.Minute, time.Now()); err != nil {
+			t.Errorf("request %d: %v", n, err)
+		}
+		w.WriteHeader(statuses[min(n, len(statuses))-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestPrivateAddress(t *testing.T) {
+	for addr, private := range map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.64.0.1":       true,
+		"0.0.0.0":          true,
+		"::1":              true,
+		"fd00::1":          true,
+		"fe80::1":          true,
+		"::ffff:127.0.0.1": true,
+		"93.184.216.34":    false,
+		"100.128.0.1":      false,
+		"2606:4700::1111":  false,
+	} {
+		if got := privateAddress(net.ParseIP(addr)); got != private {
+			t.Errorf("privateAddress(%s) = %v, want %v", addr, got, private)
+		}
+	}
+}
+
+func TestWebhookInputRefusesPrivateTargets(t *testing.T) {
+	ctx := context.Background()
+	s := newTestWebhooks(nil, WebhookOptions{})
+	for _, target := range []string{
+		"http://127.0.0.1:9000/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"https://10.0.0.5/hook",
+		"http://[::1]/hook",
+	} {
+		err := s.applyInput(ctx, &models.WebhookSubscription{}, WebhookInput{Name: "test", URL: target})
+		if !errors.Is(err, ErrInvalidWebhook) || !errors.Is(err, ErrWebhookTarget) {
+			t.Errorf("applyInput(%s) = %v, want ErrWebhookTarget", target, err)
+		}
+	}
+	if err := s.applyInput(ctx, &models.WebhookSubscription{}, WebhookInput{Name: "test", URL: "https://93.184.216.34/hook"}); err != nil {
+		t.Errorf("applyInput of a public address = %v", err)
+	}
+
+	allowed := newTestWebhooks(nil, WebhookOptions{AllowPrivateTargets: true})
+	if err := allowed.applyInput(ctx, &models.WebhookSubscription{}, WebhookInput{Name: "test", URL: "http://127.0.0.1:9000/hook"}); err != nil {
+		t.Errorf("applyInput with private targets allowed = %v", err)
+	}
+}
+
+func TestWebhookPostRefusesPrivateTargetsAtDial(t *testing.T) {
+	secret := "whsec_0123456789abcdef"
+	server, hits := webhookReceiver(t, &secret, http.StatusNoContent)
+	subscription := &models.WebhookSubscription{URL: server.URL, Secret: secret}
+	delivery := &models.WebhookDelivery{ID: uuid.New(), EventType: "alert_created", Payload: models.JSONMap{"id": "1"}}
+
+	// A subscription saved while its host was public is still refused once
+	// it points inside the network
+	attempt := newTestWebhooks(nil, WebhookOptions{}).post(context.Background(), subscription, delivery)
+	if attempt.StatusCode != 0 || !strings.Contains(attempt.Error, ErrWebhookTarget.Error()) {
+		t.Errorf("post to %s = %d %q, want it refused", server.URL, attempt.StatusCode, attempt.Error)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("receiver got %d requests, want none", hits.Load())
+	}
+
+	attempt = newTestWebhooks(nil, WebhookOptions{AllowPrivateTargets: true}).post(context.Background(), subscription, delivery)
+	if attempt.StatusCode != http.StatusNoContent || attempt.Error != "" {
+		t.Errorf("post with private targets allowed = %d %q", attempt.StatusCode, attempt.Error)
+	}
+}
+
+// createTestWebhook subscribes the URL to alert_created and removes the
+// subscription with its deliveries after the test
+func createTestWebhook(t *testing.T, s *webhooksService, url string) *models.WebhookSubscription {
+	t.Helper()
+	ctx := context.Background()
+	created, err := s.CreateWebhook(ctx, WebhookInput{Name: "test " + t.Name(), URL: url, EventTypes: []string{"alert_created"}}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.DeleteWebhook(ctx, created.ID, ""); err != nil {
+			t.Errorf("DeleteWebhook: %v", err)
+		}
+	})
+	return &created.WebhookSubscription
+}
+
+// sendTestRounds runs the sender the given number of times, moving the clock
+// past the longest backoff after each, and returns the delivery
+func sendTestRounds(t *testing.T, s *webhooksService, clock *testClock, id uuid.UUID, rounds int) models.WebhookDelivery {
+	t.Helper()
+	for i := 0; i < rounds; i++ {
+		s.sendDue(context.Background())
+		clock.Advance(maxWebhookBackoff)
+	}
+	var delivery models.WebhookDelivery
+	if err := s.db.First(&delivery, "id = ?", id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+func queueTestDelivery(t *testing.T, s *webhooksService, subscription *models.WebhookSubscription) uuid.UUID {
+	t.Helper()
+	deliveries, err := s.enqueue(context.Background(), []models.WebhookSubscription{*subscription}, "alert_created", nil, map[string]any{"id": uuid.New()})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return deliveries[0].ID
+}
+
+func TestWebhookRetriesUntilDelivered(t *testing.T) {
+	db := testDB(t)
+	var secret string
+	server, hits := webhookReceiver(t, &secret, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	s := newTestWebhooks(db, WebhookOptions{MaxAttempts: 5, RetryBase: time.Minute, DisableAfter: 10, AllowPrivateTargets: true})
+	clock := useTestClock(s.queue)
+	subscription := createTestWebhook(t, s, server.URL)
+	secret = subscription.Secret
+
+	delivery := sendTestRounds(t, s, clock, queueTestDelivery(t, s, subscription), 3)
+	if delivery.Status != models.WebhookDelivered || delivery.Attempts != 3 || hits.Load() != 3 {
+		t.Errorf("delivery is %s after %d attempts and %d requests, want delivered after 3", delivery.Status, delivery.Attempts, hits.Load())
+	}
+	var attempts []models.WebhookAttempt
+	db.Order("attempt").Find(&attempts, "delivery_id = ?", delivery.ID)
+	if len(attempts) != 3 || attempts[0].StatusCode != http.StatusServiceUnavailable || attempts[2].StatusCode != http.StatusOK {
+		t.Errorf("attempt log = %+v", attempts)
+	}
+	// Delivering clears the failures counted so far
+	var stored models.WebhookSubscription
+	db.First(&stored, "id = ?", subscription.ID)
+	if stored.ConsecutiveFailures != 0 || !stored.Active {
+		t.Errorf("subscription has %d failures, active %v", stored.ConsecutiveFailures, stored.Active)
+	}
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	db := testDB(t)
+	var secret string
+	server, hits := webhookReceiver(t, &secret, http.StatusInternalServerError)
+	s := newTestWebhooks(db, WebhookOptions{MaxAttempts: 3, RetryBase: time.Minute, DisableAfter: 10, AllowPrivateTargets: true})
+	clock := useTestClock(s.queue)
+	subscription := createTestWebhook(t, s, server.URL)
+	secret = subscription.Secret
+
+	delivery := sendTestRounds(t, s, clock, queueTestDelivery(t, s, subscription), 4)
+	if delivery.Status != models.WebhookFailed || delivery.Attempts != 3 || hits.Load() != 3 {
+		t.Errorf("delivery is %s after %d attempts and %d requests, want failed after 3", delivery.Status, delivery.Attempts, hits.Load())
+	}
+}
+
+func TestWebhookDoesNotRetryRejectedRequests(t *testing.T) {
+	db := testDB(t)
+	var secret string
+	server, hits := webhookReceiver(t, &secret, http.StatusBadRequest)
+	s := newTestWebhooks(db, WebhookOptions{MaxAttempts: 5, RetryBase: time.Minute, DisableAfter: 10, AllowPrivateTargets: true})
+	clock := useTestClock(s.queue)
+	subscription := createTestWebhook(t, s, server.URL)
+	secret = subscription.Secret
+
+	delivery := sendTestRounds(t, s, clock, queueTestDelivery(t, s, subscription), 2)
+	if delivery.Status != models.WebhookFailed || hits.Load() != 1 {
+		t.Errorf("delivery is %s after %d requests, want failed after 1", delivery.Status, hits.Load())
+	}
+}
+
+func TestWebhookDisabledAfterFailuresInARow(t *testing.T) {
+	db := testDB(t)
+	var secret string
+	server, hits := webhookReceiver(t, &secret, http.StatusBadGateway)
+	s := newTestWebhooks(db, WebhookOptions{MaxAttempts: 10, RetryBase: time.Minute, DisableAfter: 3, AllowPrivateTargets: true})
+	clock := useTestClock(s.queue)
+	subscription := createTestWebhook(t, s, server.URL)
+	secret = subscription.Secret
+
+	first := queueTestDelivery(t, s, subscription)
+	delivery := sendTestRounds(t, s, clock, first, 4)
+	if delivery.Status != models.WebhookFailed || delivery.LastError != "webhook disabled" || hits.Load() != 3 {
+		t.Errorf("delivery is %s (%q) after %d requests, want failed by disabling after 3", delivery.Status, delivery.LastError, hits.Load())
+	}
+	var stored models.WebhookSubscription
+	db.First(&stored, "id = ?", subscription.ID)
+	if stored.Active || stored.DisabledAt == nil || stored.DisabledReason == "" {
+		t.Fatalf("subscription active %v, disabled at %v (%q)", stored.Active, stored.DisabledAt, stored.DisabledReason)
+	}
+
+	// A disabled subscription takes no new events
+	ctx := context.Background()
+	s.queueEvent(ctx, nil, "alert_created", map[string]any{"id": uuid.New()})
+	var queued int64
+	db.Model(&models.WebhookDelivery{}).Where("subscription_id = ? AND id <> ?", subscription.ID, first).Count(&queued)
+	if queued != 0 {
+		t.Errorf("%d deliveries queued for a disabled subscription", queued)
+	}
+	if _, err := s.Ping(ctx, subscription.ID, ""); !errors.Is(err, ErrWebhookDisabled) {
+		t.Errorf("Ping = %v, want ErrWebhookDisabled", err)
+	}
+
+	// Re-enabling clears the failures and redelivery sends it again
+	active := true
+	if _, err := s.UpdateWebhook(ctx, subscription.ID, WebhookInput{Name: stored.Name, URL: stored.URL, EventTypes: stored.EventTypes, Active: &active}, ""); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	db.First(&stored, "id = ?", subscription.ID)
+	if !stored.Active || stored.ConsecutiveFailures != 0 || stored.DisabledAt != nil {
+		t.Errorf("re-enabled subscription active %v with %d failures", stored.Active, stored.ConsecutiveFailures)
+	}
+	if _, err := s.Redeliver(ctx, subscription.ID, first, ""); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	db.First(&delivery, "id = ?", first)
+	if delivery.Status != models.WebhookPending || delivery.Attempts != 0 {
+		t.Errorf("redelivered delivery is %s with %d attempts", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestWebhookPublishStoresDeliveries(t *testing.T) {
+	db := testDB(t)
+	s := newTestWebhooks(db, WebhookOptions{AllowPrivateTargets: true})
+	subscription := createTestWebhook(t, s, "http://127.0.0.1:9/hook")
+
+	s.Publish(nil, "camera_status_changed", map[string]any{"id": "1"})
+	s.Publish(nil, "alert_created", map[string]any{"id": "2"})
+
+	// The delivery is stored by the time Publish returns, with no sender
+	// running, so it survives a restart
+	var deliveries []models.WebhookDelivery
+	if err := db.Find(&deliveries, "subscription_id = ?", subscription.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries stored, want 1 for alert_created", len(deliveries))
+	}
+	delivery := deliveries[0]
+	data, _ := delivery.Payload["data"].(map[string]any)
+	if delivery.EventType != "alert_created" || delivery.Status != models.WebhookPending || data["id"] != "2" {
+		t.Errorf("stored %s delivery is %s with %v", delivery.EventType, delivery.Status, delivery.Payload)
+	}
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Set(ctx, "fresh", []byte("1"), time.Minute)
+	m.Set(ctx, "stale", []byte("2"), -time.Second)
+
+	if value, ok, err := m.Get(ctx, "fresh"); err != nil || !ok || string(value) != "1" {
+		t.Errorf("Get(fresh) = %q, %v, %v", value, ok, err)
+	}
+	if _, ok, _ := m.Get(ctx, "stale"); ok {
+		t.Error("expired entry was returned")
+	}
+	if _, ok, _ := m.Get(ctx, "missing"); ok {
+		t.Error("missing entry was found")
+	}
+
+	// Setting another entry sweeps out the expired ones
+	m.Set(ctx, "stale", []byte("2"), -time.Second)
+	m.Set(ctx, "other", []byte("3"), time.Minute)
+	if _, ok := m.entries["stale"]; ok || len(m.entries) != 2 {
+		t.Errorf("entries after a sweep = %v", m.entries)
+	}
+}
@@ -0,0 +1,175 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend grabs a single JPEG still frame from a camera stream
+type Backend interface {
+	Capture(ctx context.Context, streamURL string) ([]byte, error)
+}
+
+// Frame is a captured still image
+type Frame struct {
+	Data       []byte
+	CapturedAt time.Time
+}
+
+const (
+	BackendFFmpeg    = "ffmpeg"
+	BackendSimulated = "simulated"
+)
+
+// New returns the backend registered under name
+func New(name string, ffmpegPath string) (Backend, error) {
+	switch name {
+	case BackendFFmpeg:
+		return &FFmpeg{Path: ffmpegPath}, nil
+	case BackendSimulated, "":
+		return &Simulated{}, nil
+	default:
+		return nil, fmt.Errorf("unknown capture backend %q", name)
+	}
+}
+
+// FFmpeg captures frames by shelling out to ffmpeg
+type FFmpeg struct {
+	Path string
+}
+
+func (f *FFmpeg) Capture(ctx context.Context, streamURL string) ([]byte, error) {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if strings.HasPrefix(streamURL, "rtsp://") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args, "-i", streamURL, "-frames:v", "1", "-f", "image2", "-vcodec", "mjpeg", "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, f.Path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg capture failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg returned no frame for %s", streamURL)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Simulated renders a synthetic frame; used for development and tests where
+// no real camera is reachable
+type Simulated struct{}
+
+func (s *Simulated) Capture(ctx context.Context, streamURL string) ([]byte, error) {
+	const w, h = 640, 360
+
+	hash := fnv.New32a()
+	hash.Write([]byte(streamURL))
+	seed := hash.Sum32()
+	base := color.RGBA{R: uint8(seed), G: uint8(seed >> 8), B: uint8(seed >> 16), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	bar := int(time.Now().UnixMilli()/50) % w
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{
+				R: base.R/2 + uint8(x*127/w),
+				G: base.G/2 + uint8(y*127/h),
+				B: base.B / 2,
+				A: 255,
+			}
+			if x >= bar && x < bar+8 {
+				c = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Thumbnail downscales a JPEG so that it is at most maxWidth pixels wide
+func Thumbnail(data []byte, maxWidth int) ([]byte, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+
+	b := src.Bounds()
+	if b.Dx() <= maxWidth {
+		return data, nil
+	}
+	w := maxWidth
+	h := b.Dy() * maxWidth / b.Dx()
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 70}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Buffer keeps the most recent frames per camera so that pre-event
+// snapshots are available when an alert arrives
+type Buffer struct {
+	window time.Duration
+	frames map[string][]Frame
+	mutex  sync.Mutex
+}
+
+// NewBuffer creates a buffer that retains frames for window
+func NewBuffer(window time.Duration) *Buffer {
+	return &Buffer{
+		window: window,
+		frames: make(map[string][]Frame),
+	}
+}
+
+// Add appends a frame for the given camera and drops frames outside the window
+func (b *Buffer) Add(cameraID string, frame Frame) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	cutoff := frame.CapturedAt.Add(-b.window)
+	frames := append(b.frames[cameraID], frame)
+	for len(frames) > 0 && frames[0].CapturedAt.Before(cutoff) {
+		frames = frames[1:]
+	}
+	b.frames[cameraID] = frames
+}
+
+// Since returns buffered frames for a camera captured at or after t
+func (b *Buffer) Since(cameraID string, t time.Time) []Frame {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var out []Frame
+	for _, f := range b.frames[cameraID] {
+		if !f.CapturedAt.Before(t) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package capture
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBufferKeepsTheWindow(t *testing.T) {
+	buffer := NewBuffer(4 * time.Second)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= 10; i += 2 {
+		buffer.Add("front", Frame{Data: []byte{byte(i)}, CapturedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	buffer.Add("back", Frame{Data: []byte{99}, CapturedAt: start.Add(10 * time.Second)})
+
+	// Frames older than the window before the latest one are dropped
+	frames := buffer.Since("front", start)
+	if len(frames) != 3 {
+		t.Fatalf("buffer kept %d frames, want the 3 within 4s of the latest", len(frames))
+	}
+	for i, want := range []byte{6, 8, 10} {
+		if frames[i].Data[0] != want {
+			t.Errorf("frame %d = %d, want %d", i, frames[i].Data[0], want)
+		}
+	}
+
+	// Since includes a frame captured at exactly t
+	if got := buffer.Since("front", start.Add(8*time.Second)); len(got) != 2 {
+		t.Errorf("Since(8s) = %d frames, want 2", len(got))
+	}
+	if got := buffer.Since("front", start.Add(11*time.Second)); len(got) != 0 {
+		t.Errorf("Since after the latest frame = %d frames, want none", len(got))
+	}
+	if got := buffer.Since("side", start); len(got) != 0 {
+		t.Errorf("unknown camera has %d frames", len(got))
+	}
+	if got := buffer.Since("back", start); len(got) != 1 || got[0].Data[0] != 99 {
+		t.Errorf("cameras share frames: %v", got)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	frame, err := (&Simulated{}).Capture(context.Background(), "rtsp://test/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := Thumbnail(frame, 320)
+	if err != nil {
+		t.Fatalf("Thumbnail: %v", err)
+	}
+	if len(thumb) == 0 || len(thumb) >= len(frame) {
+		t.Errorf("thumbnail is %d bytes for a %d byte frame", len(thumb), len(frame))
+	}
+	if same, _ := Thumbnail(thumb, 320); len(same) != len(thumb) {
+		t.Error("a frame within the width was re-encoded")
+	}
+	if _, err := Thumbnail([]byte("not a jpeg"), 320); err == nil {
+		t.Error("Thumbnail of garbage succeeded")
+	}
+}
@@ -0,0 +1,126 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalidExpression", expr, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2024, 5, 1, 10, 0, 30, 0, utc), time.Date(2024, 5, 1, 10, 1, 0, 0, utc)},
+		{"strictly after", "0 7 * * *", time.Date(2024, 5, 1, 7, 0, 0, 0, utc), time.Date(2024, 5, 2, 7, 0, 0, 0, utc)},
+		{"step", "*/15 * * * *", time.Date(2024, 5, 1, 10, 16, 0, 0, utc), time.Date(2024, 5, 1, 10, 30, 0, 0, utc)},
+		{"range with step", "0 8-18/2 * * *", time.Date(2024, 5, 1, 18, 30, 0, 0, utc), time.Date(2024, 5, 2, 8, 0, 0, 0, utc)},
+		{"weekday name", "0 7 * * MON", time.Date(2024, 5, 1, 0, 0, 0, 0, utc), time.Date(2024, 5, 6, 7, 0, 0, 0, utc)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2024, 5, 1, 0, 0, 0, 0, utc), time.Date(2024, 5, 5, 0, 0, 0, 0, utc)},
+		{"macro", "@monthly", time.Date(2024, 5, 15, 0, 0, 0, 0, utc), time.Date(2024, 6, 1, 0, 0, 0, 0, utc)},
+		// Either restricted day field matches
+		{"day of month or week", "0 0 13 * FRI", time.Date(2024, 5, 1, 0, 0, 0, 0, utc), time.Date(2024, 5, 3, 0, 0, 0, 0, utc)},
+		{"leap day", "0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, utc), time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		{"never", "0 0 30 2 *", time.Date(2024, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	// 2024-03-10 02:00 EST became 03:00 EDT; 2024-11-03 02:00 EDT became
+	// 01:00 EST
+	est := time.FixedZone("EST", -5*3600)
+	edt := time.FixedZone("EDT", -4*3600)
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"hourly over the gap", "0 * * * *", time.Date(2024, 3, 10, 1, 30, 0, 0, est), time.Date(2024, 3, 10, 3, 0, 0, 0, edt)},
+		{"minutes over the gap", "*/20 * * * *", time.Date(2024, 3, 10, 1, 50, 0, 0, est), time.Date(2024, 3, 10, 3, 0, 0, 0, edt)},
+		// 02:30 does not exist that night
+		{"time in the gap", "30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, est), time.Date(2024, 3, 11, 2, 30, 0, 0, edt)},
+		{"daily after the gap", "0 7 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, est), time.Date(2024, 3, 10, 7, 0, 0, 0, edt)},
+		{"hourly into the fold", "0 * * * *", time.Date(2024, 11, 3, 0, 30, 0, 0, edt), time.Date(2024, 11, 3, 1, 0, 0, 0, edt)},
+		// The repeated hour is a new hour on the clock
+		{"hourly through the fold", "0 * * * *", time.Date(2024, 11, 3, 1, 0, 0, 0, edt), time.Date(2024, 11, 3, 1, 0, 0, 0, est)},
+		{"hourly out of the fold", "0 * * * *", time.Date(2024, 11, 3, 1, 0, 0, 0, est), time.Date(2024, 11, 3, 2, 0, 0, 0, est)},
+		{"daily over the fold", "0 0 * * *", time.Date(2024, 11, 3, 0, 0, 0, 0, edt), time.Date(2024, 11, 4, 0, 0, 0, 0, est)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := schedule.Next(tt.from.In(ny))
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from.In(ny), got, tt.want.In(ny))
+			}
+			if got.Location() != ny {
+				t.Errorf("Next returned a time in %v, want %v", got.Location(), ny)
+			}
+		})
+	}
+}
+
+func TestNextIsMonotonicAcrossDSTYear(t *testing.T) {
+	ny := mustLocation(t, "America/New_York")
+	schedule, err := Parse("*/30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Elapsed time between runs stays 30 minutes through both changes
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, ny)
+	for i := 0; i < 366*48; i++ {
+		next := schedule.Next(at)
+		if d := next.Sub(at); d != 30*time.Minute {
+			t.Fatalf("Next(%v) = %v, %v later, want 30m", at, next, d)
+		}
+		at = next
+	}
+}
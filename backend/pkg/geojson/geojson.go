@@ -0,0 +1,93 @@
+// Package geojson contains the small subset of RFC 7946 used by the map feed.
+package geojson
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Geometry is a GeoJSON geometry object
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// Point returns a Point geometry. GeoJSON orders coordinates longitude first.
+func Point(lon, lat float64) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: []float64{lon, lat}}
+}
+
+// Feature is a GeoJSON feature
+type Feature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id,omitempty"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// NewFeature creates a feature with the given id, geometry and properties
+func NewFeature(id string, geometry *Geometry, properties map[string]any) Feature {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return Feature{Type: "Feature", ID: id, Geometry: geometry, Properties: properties}
+}
+
+// FeatureCollection is a GeoJSON feature collection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// NewFeatureCollection wraps features in a collection; never encodes features as null
+func NewFeatureCollection(features []Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// BBox is a bounding box in degrees. MinLon may exceed MaxLon when the box
+// crosses the antimeridian.
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+var ErrInvalidBBox = errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+
+// ParseBBox parses "minLon,minLat,maxLon,maxLat"
+func ParseBBox(s string) (*BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, ErrInvalidBBox
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+	b := &BBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if b.MinLat > b.MaxLat || b.MinLat < -90 || b.MaxLat > 90 ||
+		b.MinLon < -180 || b.MinLon > 180 || b.MaxLon < -180 || b.MaxLon > 180 {
+		return nil, ErrInvalidBBox
+	}
+	return b, nil
+}
+
+// Contains reports whether the point lies inside the box
+func (b BBox) Contains(lon, lat float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
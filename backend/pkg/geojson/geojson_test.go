@@ -0,0 +1,79 @@
+package geojson
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseBBox(t *testing.T) {
+	b, err := ParseBBox(" 13.3, 52.4,13.5 ,52.6")
+	if err != nil {
+		t.Fatalf("ParseBBox: %v", err)
+	}
+	if *b != (BBox{MinLon: 13.3, MinLat: 52.4, MaxLon: 13.5, MaxLat: 52.6}) {
+		t.Errorf("ParseBBox = %+v", *b)
+	}
+	// Across the antimeridian the western edge has the larger longitude
+	if _, err := ParseBBox("170,-20,-170,-10"); err != nil {
+		t.Errorf("ParseBBox across the antimeridian: %v", err)
+	}
+
+	for _, s := range []string{
+		"",
+		"1,2,3",
+		"1,2,3,4,5",
+		"a,2,3,4",
+		"0,10,1,5",
+		"0,-91,1,0",
+		"0,0,1,91",
+		"-181,0,1,1",
+		"0,0,181,1",
+	} {
+		if _, err := ParseBBox(s); !errors.Is(err, ErrInvalidBBox) {
+			t.Errorf("ParseBBox(%q) = %v, want ErrInvalidBBox", s, err)
+		}
+	}
+}
+
+func TestBBoxContains(t *testing.T) {
+	berlin := BBox{MinLon: 13.3, MinLat: 52.4, MaxLon: 13.5, MaxLat: 52.6}
+	fiji := BBox{MinLon: 170, MinLat: -20, MaxLon: -170, MaxLat: -10}
+	for _, tt := range []struct {
+		name     string
+		box      BBox
+		lon, lat float64
+		want     bool
+	}{
+		{"inside", berlin, 13.4, 52.5, true},
+		{"on the edge", berlin, 13.5, 52.4, true},
+		{"east", berlin, 13.6, 52.5, false},
+		{"north", berlin, 13.4, 52.7, false},
+		{"west of the antimeridian", fiji, 178, -18, true},
+		{"east of the antimeridian", fiji, -179, -18, true},
+		{"between the edges", fiji, 0, -18, false},
+		{"south of the wrapping box", fiji, 178, -25, false},
+	} {
+		if got := tt.box.Contains(tt.lon, tt.lat); got != tt.want {
+			t.Errorf("%s: Contains(%v, %v) = %v, want %v", tt.name, tt.lon, tt.lat, got, tt.want)
+		}
+	}
+}
+
+func TestFeatureCollectionEncoding(t *testing.T) {
+	data, err := json.Marshal(NewFeatureCollection(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"type":"FeatureCollection","features":[]}` {
+		t.Errorf("empty collection encodes as %s", data)
+	}
+
+	data, err = json.Marshal(NewFeature("cam-1", Point(13.4, 52.5), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"type":"Feature","id":"cam-1","geometry":{"type":"Point","coordinates":[13.4,52.5]},"properties":{}}` {
+		t.Errorf("feature encodes as %s", data)
+	}
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"smart-city-surveillance/pkg/mail"
+)
+
+const httpTimeout = 15 * time.Second
+
+// Email sends notifications as plain text mail
+type Email struct {
+	sender mail.Sender
+}
+
+func NewEmail(sender mail.Sender) *Email {
+	return &Email{sender: sender}
+}
+
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	return e.sender.Send(ctx, mail.Message{To: []string{msg.To}, Subject: msg.Subject, Text: msg.Body})
+}
+
+// SMSGateway posts {"from","to","body"} as JSON to a gateway URL with a
+// bearer API key, the shape most SMS gateways accept
+type SMSGateway struct {
+	url    string
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func NewSMSGateway(url, apiKey, from string) *SMSGateway {
+	return &SMSGateway{url: url, apiKey: apiKey, from: from, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (g *SMSGateway) Send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, g.client, g.url, map[string]string{"Authorization": "Bearer " + g.apiKey}, map[string]any{
+		"from": g.from,
+		"to":   msg.To,
+		"body": msg.Body,
+	})
+}
+
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+)
+
+// PushConfig holds the endpoints push is sent to. FCMURL takes an FCM HTTP v1
+// message; APNsURL is the APNs host, to which /3/device/<token> is added.
+type PushConfig struct {
+	FCMURL    string
+	FCMToken  string
+	APNsURL   string
+	APNsToken string
+	APNsTopic string
+}
+
+// Push sends Android devices FCM messages and iOS devices APNs notifications
+type Push struct {
+	cfg    PushConfig
+	client *http.Client
+}
+
+func NewPush(cfg PushConfig) *Push {
+	return &Push{cfg: cfg, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (p *Push) Send(ctx context.Context, msg Message) error {
+	switch msg.Platform {
+	case PlatformAndroid:
+		return postJSON(ctx, p.client, p.cfg.FCMURL, map[string]string{"Authorization": "Bearer " + p.cfg.FCMToken}, map[string]any{
+			"message": map[string]any{
+				"token":        msg.To,
+				"notification": map[string]string{"title": msg.Subject, "body": msg.Body},
+				"data":         msg.Data,
+				"android":      map[string]string{"priority": "high"},
+			},
+		})
+	case PlatformIOS:
+		body := map[string]any{
+			"aps": map[string]any{
+				"alert": map[string]string{"title": msg.Subject, "body": msg.Body},
+				"sound": "default",
+			},
+		}
+		for k, v := range msg.Data {
+			if k != "aps" {
+				body[k] = v
+			}
+		}
+		endpoint := strings.TrimRight(p.cfg.APNsURL, "/") + "/3/device/" + url.PathEscape(msg.To)
+		return postJSON(ctx, p.client, endpoint, map[string]string{
+			"Authorization":  "bearer " + p.cfg.APNsToken,
+			"apns-topic":     p.cfg.APNsTopic,
+			"apns-push-type": "alert",
+			"apns-priority":  "10",
+		}, body)
+	default:
+		return fmt.Errorf("%w: unknown platform %q", ErrPermanent, msg.Platform)
+	}
+}
+
+// postJSON treats 2xx as delivered, 408, 429 and 5xx as worth retrying and
+// any other status as permanent
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(detail))
+	default:
+		return fmt.Errorf("%w: %s: %s", ErrPermanent, resp.Status, bytes.TrimSpace(detail))
+	}
+}
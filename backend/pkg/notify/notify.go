@@ -0,0 +1,74 @@
+// Package notify delivers notifications to people outside the app: email,
+// SMS through an HTTP gateway and mobile push in FCM or APNs form. Every
+// channel can be swapped for a Fake that records messages instead.
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// ErrPermanent marks failures that retrying cannot fix, such as a rejected
+// phone number or an unregistered device
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Message is one notification to one address: an email address, a phone
+// number or a device token
+type Message struct {
+	To      string
+	Subject string // email subject, push title
+	Body    string
+	// Push only
+	Platform string
+	Data     map[string]string
+}
+
+// Provider sends messages over one channel
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+const (
+	ProviderFake = "fake"
+	ProviderHTTP = "http"
+	ProviderSMTP = "smtp"
+)
+
+// Fake records messages instead of sending them, for tests and local runs
+type Fake struct {
+	name  string
+	mutex sync.Mutex
+	sent  []Message
+	err   error
+}
+
+func NewFake(name string) *Fake {
+	return &Fake{name: name}
+}
+
+func (f *Fake) Send(ctx context.Context, msg Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	log.Printf("[%s] to %s: %s %s", f.name, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Sent returns the messages recorded so far
+func (f *Fake) Sent() []Message {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]Message(nil), f.sent...)
+}
+
+// Fail makes every following Send return err; nil restores delivery
+func (f *Fake) Fail(err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.err = err
+}
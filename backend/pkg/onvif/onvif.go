@@ -0,0 +1,318 @@
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vector is a pan/tilt/zoom value. Velocities are in the normalized ONVIF
+// range [-1, 1]; zoom velocity uses the same range.
+type Vector struct {
+	Pan  float64 `json:"pan"`
+	Tilt float64 `json:"tilt"`
+	Zoom float64 `json:"zoom"`
+}
+
+// Preset is a stored camera position
+type Preset struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+}
+
+// Device identifies an ONVIF endpoint and its credentials
+type Device struct {
+	Address  string
+	Username string
+	Password string
+	Profile  string
+}
+
+// Client controls the PTZ service of a single camera
+type Client interface {
+	ContinuousMove(ctx context.Context, velocity Vector, timeout time.Duration) error
+	Stop(ctx context.Context) error
+	GotoPreset(ctx context.Context, token string) error
+	SetPreset(ctx context.Context, name string) (string, error)
+	GetPresets(ctx context.Context) ([]Preset, error)
+}
+
+// Factory returns a client for a device
+type Factory func(device Device) Client
+
+const (
+	ModeSOAP      = "soap"
+	ModeSimulator = "simulator"
+)
+
+// NewFactory returns the client factory for the given mode
+func NewFactory(mode string) (Factory, error) {
+	switch mode {
+	case ModeSOAP:
+		httpClient := &http.Client{Timeout: 10 * time.Second}
+		return func(device Device) Client {
+			return NewSOAPClient(device, httpClient)
+		}, nil
+	case ModeSimulator, "":
+		sim := NewSimulator()
+		return sim.Client, nil
+	default:
+		return nil, fmt.Errorf("unknown onvif mode %q", mode)
+	}
+}
+
+// =======================
+// SOAP client
+// =======================
+
+const ptzNamespace = "http://www.onvif.org/ver20/ptz/wsdl"
+
+// SOAPClient speaks ONVIF PTZ over SOAP 1.2 with WS-Security digest auth
+type SOAPClient struct {
+	device     Device
+	httpClient *http.Client
+}
+
+func NewSOAPClient(device Device, httpClient *http.Client) *SOAPClient {
+	return &SOAPClient{device: device, httpClient: httpClient}
+}
+
+func (c *SOAPClient) ContinuousMove(ctx context.Context, velocity Vector, timeout time.Duration) error {
+	body := fmt.Sprintf(`<tptz:ContinuousMove><tptz:ProfileToken>%s</tptz:ProfileToken>`+
+		`<tptz:Velocity><tt:PanTilt x="%.3f" y="%.3f"/><tt:Zoom x="%.3f"/></tptz:Velocity>`+
+		`<tptz:Timeout>PT%.3fS</tptz:Timeout></tptz:ContinuousMove>`,
+		escape(c.device.Profile), velocity.Pan, velocity.Tilt, velocity.Zoom, timeout.Seconds())
+	return c.call(ctx, body, nil)
+}
+
+func (c *SOAPClient) Stop(ctx context.Context) error {
+	body := fmt.Sprintf(`<tptz:Stop><tptz:ProfileToken>%s</tptz:ProfileToken>`+
+		`<tptz:PanTilt>true</tptz:PanTilt><tptz:Zoom>true</tptz:Zoom></tptz:Stop>`, escape(c.device.Profile))
+	return c.call(ctx, body, nil)
+}
+
+func (c *SOAPClient) GotoPreset(ctx context.Context, token string) error {
+	body := fmt.Sprintf(`<tptz:GotoPreset><tptz:ProfileToken>%s</tptz:ProfileToken>`+
+		`<tptz:PresetToken>%s</tptz:PresetToken></tptz:GotoPreset>`, escape(c.device.Profile), escape(token))
+	return c.call(ctx, body, nil)
+}
+
+func (c *SOAPClient) SetPreset(ctx context.Context, name string) (string, error) {
+	body := fmt.Sprintf(`<tptz:SetPreset><tptz:ProfileToken>%s</tptz:ProfileToken>`+
+		`<tptz:PresetName>%s</tptz:PresetName></tptz:SetPreset>`, escape(c.device.Profile), escape(name))
+	var resp struct {
+		Token string `xml:"Body>SetPresetResponse>PresetToken"`
+	}
+	if err := c.call(ctx, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
+
+func (c *SOAPClient) GetPresets(ctx context.Context) ([]Preset, error) {
+	body := fmt.Sprintf(`<tptz:GetPresets><tptz:ProfileToken>%s</tptz:ProfileToken></tptz:GetPresets>`, escape(c.device.Profile))
+	var resp struct {
+		Presets []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+		} `xml:"Body>GetPresetsResponse>Preset"`
+	}
+	if err := c.call(ctx, body, &resp); err != nil {
+		return nil, err
+	}
+	presets := make([]Preset, 0, len(resp.Presets))
+	for _, p := range resp.Presets {
+		presets = append(presets, Preset{Token: p.Token, Name: p.Name})
+	}
+	return presets, nil
+}
+
+func (c *SOAPClient) call(ctx context.Context, body string, out any) error {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tptz="` + ptzNamespace + `" xmlns:tt="http://www.onvif.org/ver10/schema">` +
+		`<s:Header>` + c.security() + `</s:Header><s:Body>` + body + `</s:Body></s:Envelope>`
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.device.Address, strings.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("onvif request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var fault struct {
+			Reason string `xml:"Body>Fault>Reason>Text"`
+		}
+		if xml.Unmarshal(data, &fault) == nil && fault.Reason != "" {
+			return fmt.Errorf("onvif fault: %s", fault.Reason)
+		}
+		return fmt.Errorf("onvif request failed with status %d", resp.StatusCode)
+	}
+	if out != nil {
+		return xml.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// security builds a WS-Security UsernameToken with a password digest
+func (c *SOAPClient) security() string {
+	if c.device.Username == "" {
+		return ""
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	created := time.Now().UTC().Format(time.RFC3339)
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(c.device.Password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	return `<wsse:Security s:mustUnderstand="1" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` +
+		`<wsse:UsernameToken><wsse:Username>` + escape(c.device.Username) + `</wsse:Username>` +
+		`<wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + digest + `</wsse:Password>` +
+		`<wsse:Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-soap-message-security-1.0#Base64Binary">` + base64.StdEncoding.EncodeToString(nonce) + `</wsse:Nonce>` +
+		`<wsu:Created>` + created + `</wsu:Created></wsse:UsernameToken></wsse:Security>`
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// =======================
+// Simulator
+// =======================
+
+// ErrPresetNotFound is returned by the simulator for unknown preset tokens
+var ErrPresetNotFound = errors.New("preset not found")
+
+// Simulator keeps PTZ state in memory, one virtual camera per device address
+type Simulator struct {
+	devices map[string]*SimulatedCamera
+	mutex   sync.Mutex
+}
+
+// SimulatedCamera is the state of one virtual PTZ camera
+type SimulatedCamera struct {
+	Position Vector
+	Presets  map[string]Preset
+	Moves    int
+
+	positions map[string]Vector
+	nextToken int
+	mutex     sync.Mutex
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{devices: make(map[string]*SimulatedCamera)}
+}
+
+// Client returns the simulated client for a device; matches Factory
+func (s *Simulator) Client(device Device) Client {
+	return s.Camera(device.Address)
+}
+
+// Camera returns the virtual camera registered under address
+func (s *Simulator) Camera(address string) *SimulatedCamera {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	cam, ok := s.devices[address]
+	if !ok {
+		cam = &SimulatedCamera{
+			Presets:   make(map[string]Preset),
+			positions: make(map[string]Vector),
+		}
+		s.devices[address] = cam
+	}
+	return cam
+}
+
+func (c *SimulatedCamera) ContinuousMove(ctx context.Context, velocity Vector, timeout time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	secs := timeout.Seconds()
+	c.Position.Pan = clamp(c.Position.Pan + velocity.Pan*secs)
+	c.Position.Tilt = clamp(c.Position.Tilt + velocity.Tilt*secs)
+	c.Position.Zoom = clampZoom(c.Position.Zoom + velocity.Zoom*secs)
+	c.Moves++
+	return nil
+}
+
+func (c *SimulatedCamera) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (c *SimulatedCamera) GotoPreset(ctx context.Context, token string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pos, ok := c.positions[token]
+	if !ok {
+		return ErrPresetNotFound
+	}
+	c.Position = pos
+	return nil
+}
+
+func (c *SimulatedCamera) SetPreset(ctx context.Context, name string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.nextToken++
+	token := fmt.Sprintf("preset_%d", c.nextToken)
+	c.Presets[token] = Preset{Token: token, Name: name}
+	c.positions[token] = c.Position
+	return token, nil
+}
+
+func (c *SimulatedCamera) GetPresets(ctx context.Context) ([]Preset, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	presets := make([]Preset, 0, len(c.Presets))
+	for i := 1; i <= c.nextToken; i++ {
+		if p, ok := c.Presets[fmt.Sprintf("preset_%d", i)]; ok {
+			presets = append(presets, p)
+		}
+	}
+	return presets, nil
+}
+
+func clamp(v float64) float64 {
+	if v < -1 {
+		return -1
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+func clampZoom(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
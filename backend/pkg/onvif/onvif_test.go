@@ -0,0 +1,156 @@
+package onvif
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFactory(t *testing.T) {
+	for _, mode := range []string{ModeSimulator, "", ModeSOAP} {
+		if factory, err := NewFactory(mode); err != nil || factory == nil {
+			t.Errorf("NewFactory(%q) = %v", mode, err)
+		}
+	}
+	if _, err := NewFactory("vapix"); err == nil {
+		t.Error("NewFactory accepted an unknown mode")
+	}
+}
+
+func TestSimulatorMovesAndClamps(t *testing.T) {
+	ctx := context.Background()
+	sim := NewSimulator()
+	camera := sim.Client(Device{Address: "sim://a"})
+
+	if err := camera.ContinuousMove(ctx, Vector{Pan: 0.5, Tilt: -0.25, Zoom: 0.5}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	state := sim.Camera("sim://a")
+	if state.Position != (Vector{Pan: 0.5, Tilt: -0.25, Zoom: 0.5}) || state.Moves != 1 {
+		t.Errorf("after one move the camera is at %+v with %d moves", state.Position, state.Moves)
+	}
+	camera.ContinuousMove(ctx, Vector{Pan: 1, Tilt: -1, Zoom: -1}, 2*time.Second)
+	if state.Position != (Vector{Pan: 1, Tilt: -1, Zoom: 0}) {
+		t.Errorf("position %+v is outside the camera's range", state.Position)
+	}
+
+	// Cameras are kept per address
+	if other := sim.Camera("sim://b"); other.Moves != 0 || other == state {
+		t.Error("cameras at different addresses share state")
+	}
+	if sim.Client(Device{Address: "sim://a"}) != Client(state) {
+		t.Error("the same address gave a different camera")
+	}
+}
+
+func TestSimulatorPresets(t *testing.T) {
+	ctx := context.Background()
+	camera := NewSimulator().Camera("sim://a")
+
+	camera.ContinuousMove(ctx, Vector{Pan: 0.5}, time.Second)
+	gate, err := camera.SetPreset(ctx, "Gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	camera.ContinuousMove(ctx, Vector{Tilt: 0.5}, time.Second)
+	yard, _ := camera.SetPreset(ctx, "Yard")
+
+	presets, err := camera.GetPresets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presets) != 2 || presets[0] != (Preset{Token: gate, Name: "Gate"}) || presets[1] != (Preset{Token: yard, Name: "Yard"}) {
+		t.Errorf("presets = %+v, want Gate then Yard", presets)
+	}
+
+	if err := camera.GotoPreset(ctx, gate); err != nil {
+		t.Fatal(err)
+	}
+	if camera.Position != (Vector{Pan: 0.5}) {
+		t.Errorf("at %+v after going to Gate", camera.Position)
+	}
+	if err := camera.GotoPreset(ctx, "preset_99"); !errors.Is(err, ErrPresetNotFound) {
+		t.Errorf("GotoPreset of an unknown token = %v, want ErrPresetNotFound", err)
+	}
+}
+
+// soapRequest is the part of a request the fake camera checks
+type soapRequest struct {
+	Username string `xml:"Header>Security>UsernameToken>Username"`
+	Password string `xml:"Header>Security>UsernameToken>Password"`
+	Nonce    string `xml:"Header>Security>UsernameToken>Nonce"`
+	Created  string `xml:"Header>Security>UsernameToken>Created"`
+	Body     struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+func TestSOAPClient(t *testing.T) {
+	const password = "secret"
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var req soapRequest
+		if err := xml.Unmarshal(data, &req); err != nil {
+			t.Errorf("undecodable request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		nonce, _ := base64.StdEncoding.DecodeString(req.Nonce)
+		h := sha1.New()
+		h.Write(nonce)
+		h.Write([]byte(req.Created))
+		h.Write([]byte(password))
+		if req.Username != "admin" || req.Password != base64.StdEncoding.EncodeToString(h.Sum(nil)) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><s:Fault><s:Reason><s:Text>Sender not authorized</s:Text></s:Reason></s:Fault></s:Body></s:Envelope>`)
+			return
+		}
+		body := string(req.Body.Inner)
+		switch {
+		case strings.Contains(body, "GetPresets"):
+			calls = append(calls, "GetPresets")
+			io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body><tptz:GetPresetsResponse xmlns:tptz="`+ptzNamespace+`">`+
+				`<tptz:Preset token="1"><tt:Name xmlns:tt="http://www.onvif.org/ver10/schema">Gate</tt:Name></tptz:Preset>`+
+				`</tptz:GetPresetsResponse></s:Body></s:Envelope>`)
+		case strings.Contains(body, "ContinuousMove"):
+			calls = append(calls, "ContinuousMove")
+			if !strings.Contains(body, `x="0.500"`) || !strings.Contains(body, "<tptz:Timeout>PT1.500S</tptz:Timeout>") {
+				t.Errorf("unexpected move %s", body)
+			}
+			io.WriteString(w, `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body/></s:Envelope>`)
+		default:
+			t.Errorf("unexpected call %s", body)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewSOAPClient(Device{Address: server.URL, Username: "admin", Password: password, Profile: "profile_1"}, server.Client())
+	if err := client.ContinuousMove(ctx, Vector{Pan: 0.5}, 1500*time.Millisecond); err != nil {
+		t.Fatalf("ContinuousMove: %v", err)
+	}
+	presets, err := client.GetPresets(ctx)
+	if err != nil {
+		t.Fatalf("GetPresets: %v", err)
+	}
+	if len(presets) != 1 || presets[0] != (Preset{Token: "1", Name: "Gate"}) {
+		t.Errorf("presets = %+v", presets)
+	}
+	if strings.Join(calls, ",") != "ContinuousMove,GetPresets" {
+		t.Errorf("camera got %v", calls)
+	}
+
+	wrong := NewSOAPClient(Device{Address: server.URL, Username: "admin", Password: "wrong"}, server.Client())
+	if err := wrong.Stop(ctx); err == nil || !strings.Contains(err.Error(), "Sender not authorized") {
+		t.Errorf("Stop with a wrong password = %v, want the camera's fault", err)
+	}
+}
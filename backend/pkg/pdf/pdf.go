@@ -0,0 +1,432 @@
+// Package pdf writes simple flowing A4 documents: headings, wrapped text,
+// key/value lists, tables and JPEG images in the standard Helvetica fonts.
+// It covers what reports need without a third-party dependency.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"time"
+)
+
+// A4 in points, with the margins every page uses
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	margin       = 48.0
+	footerHeight = 24.0
+	contentWidth = pageWidth - 2*margin
+)
+
+const (
+	bodySize    = 9.5
+	lineSpacing = 1.35
+	cellPadding = 4.0
+)
+
+// Document is built top to bottom; content that does not fit on the current
+// page continues on a new one
+type Document struct {
+	title   string
+	pages   []*bytes.Buffer
+	page    *bytes.Buffer
+	y       float64
+	images  []pdfImage
+	created time.Time
+}
+
+type pdfImage struct {
+	data       []byte
+	width      int
+	height     int
+	colorSpace string
+}
+
+// New starts a document. The title is set in the document info and repeated
+// in every page footer.
+func New(title string) *Document {
+	d := &Document{title: title, created: time.Now()}
+	d.addPage()
+	return d
+}
+
+func (d *Document) addPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin
+}
+
+// ensure starts a new page unless height points are left on this one
+func (d *Document) ensure(height float64) {
+	if d.y-height < margin+footerHeight && d.y < pageHeight-margin {
+		d.addPage()
+	}
+}
+
+// Title writes the document heading
+func (d *Document) Title(text string) {
+	d.block(text, 18, true, 8)
+}
+
+// Heading starts a section
+func (d *Document) Heading(text string) {
+	d.ensure(14*lineSpacing + 3*bodySize*lineSpacing)
+	d.y -= 6
+	d.block(text, 13, true, 4)
+}
+
+// Text writes a wrapped paragraph
+func (d *Document) Text(text string) {
+	d.block(text, bodySize, false, 6)
+}
+
+// Small writes a wrapped paragraph in a smaller grey type
+func (d *Document) Small(text string) {
+	fmt.Fprintf(d.page, "0.4 g\n")
+	d.block(text, 8, false, 4)
+	fmt.Fprintf(d.page, "0 g\n")
+}
+
+func (d *Document) block(text string, size float64, bold bool, after float64) {
+	leading := size * lineSpacing
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, line := range wrap(paragraph, size, bold, contentWidth) {
+			d.ensure(leading)
+			d.y -= leading
+			d.text(margin, d.y+size*0.25, size, bold, line)
+		}
+	}
+	d.y -= after
+}
+
+// KeyValues writes label/value pairs in two columns
+func (d *Document) KeyValues(pairs [][2]string) {
+	labelWidth := 0.0
+	for _, pair := range pairs {
+		labelWidth = max(labelWidth, textWidth(pair[0], bodySize, true))
+	}
+	labelWidth = min(labelWidth+12, contentWidth/3)
+	leading := bodySize * lineSpacing
+	for _, pair := range pairs {
+		labels := wrap(pair[0], bodySize, true, labelWidth-12)
+		values := wrap(pair[1], bodySize, false, contentWidth-labelWidth)
+		for i := 0; i < max(len(labels), len(values)); i++ {
+			d.ensure(leading)
+			d.y -= leading
+			if i < len(labels) {
+				d.text(margin, d.y+bodySize*0.25, bodySize, true, labels[i])
+			}
+			if i < len(values) {
+				d.text(margin+labelWidth, d.y+bodySize*0.25, bodySize, false, values[i])
+			}
+		}
+	}
+	d.y -= 6
+}
+
+// Table writes rows under a shaded header, repeated on every page the table
+// spans. Columns are sized to their content and cells wrap.
+func (d *Document) Table(columns []string, rows [][]string) {
+	if len(columns) == 0 {
+		return
+	}
+	widths := columnWidths(columns, rows)
+	leading := bodySize * lineSpacing
+
+	header := func() {
+		lines, height := d.cellLines(columns, widths, true)
+		d.ensure(height + leading + 2*cellPadding)
+		fmt.Fprintf(d.page, "0.9 g %.2f %.2f %.2f %.2f re f 0 g\n", margin, d.y-height, contentWidth, height)
+		d.row(lines, widths, true)
+	}
+	header()
+
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		copy(cells, row)
+		lines, height := d.cellLines(cells, widths, false)
+		if d.y-height < margin+footerHeight {
+			d.addPage()
+			header()
+		}
+		d.row(lines, widths, false)
+		fmt.Fprintf(d.page, "0.8 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, d.y, margin+contentWidth, d.y)
+	}
+	if len(rows) == 0 {
+		d.y -= leading
+		d.text(margin+cellPadding, d.y+bodySize*0.25, bodySize, false, "None")
+	}
+	d.y -= 10
+}
+
+func (d *Document) cellLines(cells []string, widths []float64, bold bool) ([][]string, float64) {
+	lines := make([][]string, len(cells))
+	most := 1
+	for i, cell := range cells {
+		lines[i] = wrap(cell, bodySize, bold, widths[i]-2*cellPadding)
+		most = max(most, len(lines[i]))
+	}
+	return lines, float64(most)*bodySize*lineSpacing + 2*cellPadding
+}
+
+func (d *Document) row(lines [][]string, widths []float64, bold bool) {
+	leading := bodySize * lineSpacing
+	top := d.y - cellPadding
+	x := margin
+	bottom := top
+	for i, cell := range lines {
+		y := top
+		for _, line := range cell {
+			y -= leading
+			d.text(x+cellPadding, y+bodySize*0.25, bodySize, bold, line)
+		}
+		bottom = min(bottom, y)
+		x += widths[i]
+	}
+	d.y = bottom - cellPadding
+}
+
+// columnWidths shares the content width by each column's widest cell, with
+// long columns capped so that short ones keep their natural width
+func columnWidths(columns []string, rows [][]string) []float64 {
+	natural := make([]float64, len(columns))
+	for i, column := range columns {
+		natural[i] = textWidth(column, bodySize, true)
+	}
+	for _, row := range rows {
+		for i := 0; i < len(columns) && i < len(row); i++ {
+			natural[i] = max(natural[i], textWidth(row[i], bodySize, false))
+		}
+	}
+	total := 0.0
+	for i := range natural {
+		natural[i] += 2*cellPadding + 1
+		total += natural[i]
+	}
+	widths := make([]float64, len(columns))
+	if total <= contentWidth {
+		// Spare width goes to the columns pro rata
+		for i := range natural {
+			widths[i] = natural[i] * contentWidth / total
+		}
+		return widths
+	}
+
+	// Columns under a fair share keep their width; the rest split what is left
+	remaining, wide := contentWidth, 0.0
+	fair := contentWidth / float64(len(columns))
+	for i := range natural {
+		if natural[i] <= fair {
+			widths[i] = natural[i]
+			remaining -= natural[i]
+		} else {
+			wide += natural[i]
+		}
+	}
+	for i := range natural {
+		if widths[i] == 0 {
+			widths[i] = natural[i] * remaining / wide
+		}
+	}
+	return widths
+}
+
+// Image places a JPEG scaled to fit within maxWidth by maxHeight points
+func (d *Document) Image(data []byte, maxWidth, maxHeight float64) error {
+	img, err := decodeImage(data)
+	if err != nil {
+		return err
+	}
+	maxWidth = min(maxWidth, contentWidth)
+	scale := min(maxWidth/float64(img.width), maxHeight/float64(img.height))
+	width, height := float64(img.width)*scale, float64(img.height)*scale
+
+	d.ensure(height + 6)
+	d.y -= height
+	d.place(img, margin, width, height)
+	d.y -= 6
+	return nil
+}
+
+// Images places JPEGs side by side at the given height, wrapping onto as
+// many rows as needed
+func (d *Document) Images(data [][]byte, height float64) error {
+	const gap = 6.0
+	images := make([]pdfImage, len(data))
+	for i := range data {
+		img, err := decodeImage(data[i])
+		if err != nil {
+			return err
+		}
+		images[i] = img
+	}
+
+	x := contentWidth // forces a new row for the first image
+	for _, img := range images {
+		width := float64(img.width) * height / float64(img.height)
+		h := height
+		if width > contentWidth {
+			width, h = contentWidth, float64(img.height)*contentWidth/float64(img.width)
+		}
+		if x > 0 && x+width > contentWidth {
+			if x < contentWidth {
+				d.y -= gap
+			}
+			d.ensure(height + gap)
+			d.y -= height
+			x = 0
+		}
+		d.place(img, margin+x, width, h)
+		x += width + gap
+	}
+	if len(images) > 0 {
+		d.y -= gap
+	}
+	return nil
+}
+
+func decodeImage(data []byte) (pdfImage, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, fmt.Errorf("pdf: image is not a JPEG: %w", err)
+	}
+	colorSpace := "DeviceRGB"
+	switch config.ColorModel {
+	case color.GrayModel:
+		colorSpace = "DeviceGray"
+	case color.CMYKModel:
+		colorSpace = "DeviceCMYK"
+	}
+	return pdfImage{data: data, width: config.Width, height: config.Height, colorSpace: colorSpace}, nil
+}
+
+// place draws img with its lower left corner at x and the current y
+func (d *Document) place(img pdfImage, x, width, height float64) {
+	d.images = append(d.images, img)
+	fmt.Fprintf(d.page, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", width, height, x, d.y, len(d.images))
+}
+
+// Rule draws a horizontal line across the page
+func (d *Document) Rule() {
+	d.ensure(8)
+	d.y -= 4
+	fmt.Fprintf(d.page, "0.6 G 0.75 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, d.y, margin+contentWidth, d.y)
+	d.y -= 4
+}
+
+func (d *Document) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() ([]byte, error) {
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed; images and pages follow
+	const (
+		catalogObj = 1
+		pagesObj   = 2
+		fontObj    = 3
+		boldObj    = 4
+		infoObj    = 5
+	)
+	firstImage := infoObj + 1
+	firstPage := firstImage + len(d.images)
+
+	w.object(catalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObj))
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	w.object(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	w.object(fontObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	w.object(boldObj, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	w.object(infoObj, fmt.Sprintf("<< /Title (%s) /Producer (Smart City Surveillance) /CreationDate (D:%s) >>",
+		escape(d.title), d.created.UTC().Format("20060102150405Z")))
+
+	xobjects := make([]string, len(d.images))
+	for i, img := range d.images {
+		xobjects[i] = fmt.Sprintf("/Im%d %d 0 R", i+1, firstImage+i)
+		decode := ""
+		if img.colorSpace == "DeviceCMYK" {
+			// Adobe writes CMYK JPEGs inverted
+			decode = " /Decode [1 0 1 0 1 0 1 0]"
+		}
+		w.stream(firstImage+i, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /DCTDecode%s",
+			img.width, img.height, img.colorSpace, decode), img.data)
+	}
+	resources := fmt.Sprintf("/Font << /F1 %d 0 R /F2 %d 0 R >>", fontObj, boldObj)
+	if len(xobjects) > 0 {
+		resources += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+	}
+
+	for i, page := range d.pages {
+		content := bytes.NewBuffer(page.Bytes())
+		footer := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		fmt.Fprintf(content, "0.4 g BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET\n", margin, margin/2, escape(d.title))
+		fmt.Fprintf(content, "BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET 0 g\n", pageWidth-margin-textWidth(footer, 8, false), margin/2, footer)
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		pageObj := firstPage + 2*i
+		w.object(pageObj, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << %s >> /Contents %d 0 R >>",
+			pagesObj, pageWidth, pageHeight, resources, pageObj+1))
+		w.stream(pageObj+1, "/Filter /FlateDecode", compressed.Bytes())
+	}
+
+	return w.finish(catalogObj, infoObj), nil
+}
+
+// writer lays out numbered objects and the cross-reference table
+type writer struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (w *writer) object(id int, body string) {
+	w.begin(id)
+	w.buf.WriteString(body)
+	w.buf.WriteString("\nendobj\n")
+}
+
+func (w *writer) stream(id int, dict string, data []byte) {
+	w.begin(id)
+	fmt.Fprintf(&w.buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (w *writer) begin(id int) {
+	if w.offsets == nil {
+		w.offsets = map[int]int{}
+	}
+	w.offsets[id] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", id)
+}
+
+func (w *writer) finish(root, info int) []byte {
+	size := len(w.offsets) + 1
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for id := 1; id < size; id++ {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", w.offsets[id])
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, root, info, xref)
+	return w.buf.Bytes()
+}
@@ -0,0 +1,139 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Glyph widths of printable ASCII (32-126) in thousandths of the font size,
+// from the Adobe core font metrics
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// Characters outside Latin-1 that WinAnsiEncoding places in 0x80-0x9F
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '•': 0x95,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// encode maps s to WinAnsiEncoding; characters it lacks become '?'
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r >= 32 && r < 127, r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsiExtras[r]; ok {
+				out = append(out, b)
+			} else if r >= 32 {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+// escape encodes s as the body of a PDF literal string
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range encode(s) {
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func charWidth(c byte, bold bool) float64 {
+	if c >= 32 && c < 127 {
+		if bold {
+			return float64(helveticaBoldWidths[c-32])
+		}
+		return float64(helveticaWidths[c-32])
+	}
+	// Accented letters and punctuation beyond ASCII are close to a digit
+	return 556
+}
+
+// textWidth is the width of s in points
+func textWidth(s string, size float64, bold bool) float64 {
+	total := 0.0
+	for _, c := range encode(s) {
+		total += charWidth(c, bold)
+	}
+	return total * size / 1000
+}
+
+// wrap breaks s into lines no wider than width, splitting words that are
+// wider than a whole line
+func wrap(s string, size float64, bold bool, width float64) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	line := ""
+	for _, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, size, bold) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		for textWidth(word, size, bold) > width {
+			cut := fitRunes(word, size, bold, width)
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+		}
+		line = word
+	}
+	return append(lines, line)
+}
+
+// fitRunes is the byte length of the longest prefix of s that fits in width,
+// at least one rune so that wrapping always progresses
+func fitRunes(s string, size float64, bold bool, width float64) int {
+	fit := 0
+	for i := range s {
+		if i == 0 {
+			continue
+		}
+		if textWidth(s[:i], size, bold) > width {
+			break
+		}
+		fit = i
+	}
+	if fit == 0 {
+		_, fit = utf8.DecodeRuneInString(s)
+	}
+	return fit
+}
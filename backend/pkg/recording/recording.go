@@ -0,0 +1,325 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a segment location does not exist
+var ErrNotFound = errors.New("segment not found")
+
+// Camera identifies a camera to an adapter
+type Camera struct {
+	ID        string
+	StreamURL string
+}
+
+// Segment is a contiguous piece of recorded footage. Segments are MPEG-TS,
+// so consecutive segments can be concatenated byte-wise into a clip.
+type Segment struct {
+	CameraID  string    `json:"camera_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Location  string    `json:"location"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// Adapter exposes the recordings of an NVR/VMS or of the local recorder
+type Adapter interface {
+	Name() string
+	List(ctx context.Context, camera Camera, from, to time.Time) ([]Segment, error)
+	Open(ctx context.Context, location string) (io.ReadCloser, error)
+	Delete(ctx context.Context, location string) error
+}
+
+// Recorder produces footage for a set of cameras
+type Recorder interface {
+	Record(ctx context.Context, cameras []Camera)
+}
+
+const (
+	AdapterLocal = "local"
+	AdapterNVR   = "nvr"
+)
+
+// =======================
+// Local recorder
+// =======================
+
+// Local stores segments as <root>/<camera id>/<unix start>.ts. When recording
+// is enabled it runs one ffmpeg segmenter per camera; otherwise it only
+// indexes files written there by an external recorder.
+type Local struct {
+	root           string
+	ffmpegPath     string
+	segmentSeconds int
+
+	running map[string]context.CancelFunc
+	mutex   sync.Mutex
+}
+
+func NewLocal(root, ffmpegPath string, segmentSeconds int) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording root: %w", err)
+	}
+	return &Local{
+		root:           root,
+		ffmpegPath:     ffmpegPath,
+		segmentSeconds: segmentSeconds,
+		running:        make(map[string]context.CancelFunc),
+	}, nil
+}
+
+func (l *Local) Name() string { return AdapterLocal }
+
+// Record makes sure exactly the given cameras are being recorded
+func (l *Local) Record(ctx context.Context, cameras []Camera) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	wanted := make(map[string]Camera, len(cameras))
+	for _, c := range cameras {
+		wanted[c.ID] = c
+	}
+	for id, cancel := range l.running {
+		if _, ok := wanted[id]; !ok {
+			cancel()
+			delete(l.running, id)
+		}
+	}
+	for id, camera := range wanted {
+		if _, ok := l.running[id]; ok {
+			continue
+		}
+		recCtx, cancel := context.WithCancel(ctx)
+		l.running[id] = cancel
+		go l.record(recCtx, camera)
+	}
+}
+
+func (l *Local) record(ctx context.Context, camera Camera) {
+	dir := filepath.Join(l.root, camera.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Recorder for camera %s failed: %v", camera.ID, err)
+		return
+	}
+
+	for {
+		args := []string{"-hide_banner", "-loglevel", "error"}
+		if strings.HasPrefix(camera.StreamURL, "rtsp://") {
+			args = append(args, "-rtsp_transport", "tcp")
+		}
+		args = append(args, "-i", camera.StreamURL, "-c", "copy", "-f", "segment",
+			"-segment_time", strconv.Itoa(l.segmentSeconds), "-segment_format", "mpegts",
+			"-reset_timestamps", "1", "-strftime", "1", filepath.Join(dir, "%s.ts"))
+
+		cmd := exec.CommandContext(ctx, l.ffmpegPath, args...)
+		if err := cmd.Run(); err != nil && ctx.Err() == nil {
+			log.Printf("Recorder for camera %s exited: %v", camera.ID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (l *Local) List(ctx context.Context, camera Camera, from, to time.Time) ([]Segment, error) {
+	dir := filepath.Join(l.root, camera.ID)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		start time.Time
+		info  os.FileInfo
+		name  string
+	}
+	var files []file
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".ts") {
+			continue
+		}
+		unix, err := strconv.ParseInt(strings.TrimSuffix(name, ".ts"), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{start: time.Unix(unix, 0), info: info, name: name})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].start.Before(files[j].start) })
+
+	var segments []Segment
+	for i, f := range files {
+		// A segment ends where the next one starts; the newest one is still
+		// being written and ends at its last modification
+		end := f.info.ModTime()
+		if i+1 < len(files) {
+			end = files[i+1].start
+		}
+		if end.Before(from) || f.start.After(to) {
+			continue
+		}
+		segments = append(segments, Segment{
+			CameraID:  camera.ID,
+			Start:     f.start,
+			End:       end,
+			Location:  camera.ID + "/" + f.name,
+			SizeBytes: f.info.Size(),
+		})
+	}
+	return segments, nil
+}
+
+func (l *Local) Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	p, err := l.path(location)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, location string) error {
+	p, err := l.path(location)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) path(location string) (string, error) {
+	clean := filepath.Clean("/" + location)
+	if clean == "/" {
+		return "", ErrNotFound
+	}
+	return filepath.Join(l.root, clean), nil
+}
+
+// =======================
+// NVR / VMS adapter
+// =======================
+
+// NVR talks to a VMS exposing a simple REST recordings index:
+//
+//	GET    {base}/cameras/{id}/recordings?from=RFC3339&to=RFC3339 -> []Segment
+//	GET    {location}  -> MPEG-TS bytes
+//	DELETE {location}
+type NVR struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewNVR(baseURL, token string) *NVR {
+	return &NVR{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		// No overall timeout: a long clip can take minutes to stream, so
+		// only connecting and waiting for response headers are bounded
+		httpClient: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		}},
+	}
+}
+
+func (n *NVR) Name() string { return AdapterNVR }
+
+func (n *NVR) List(ctx context.Context, camera Camera, from, to time.Time) ([]Segment, error) {
+	q := url.Values{}
+	q.Set("from", from.UTC().Format(time.RFC3339))
+	q.Set("to", to.UTC().Format(time.RFC3339))
+	endpoint := fmt.Sprintf("%s/cameras/%s/recordings?%s", n.baseURL, url.PathEscape(camera.ID), q.Encode())
+
+	resp, err := n.do(ctx, http.MethodGet, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var segments []Segment
+	if err := json.NewDecoder(resp.Body).Decode(&segments); err != nil {
+		return nil, fmt.Errorf("invalid NVR recordings response: %w", err)
+	}
+	for i := range segments {
+		segments[i].CameraID = camera.ID
+	}
+	return segments, nil
+}
+
+func (n *NVR) Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	resp, err := n.do(ctx, http.MethodGet, location)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (n *NVR) Delete(ctx context.Context, location string) error {
+	resp, err := n.do(ctx, http.MethodDelete, location)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (n *NVR) do(ctx context.Context, method, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("NVR request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("NVR request failed with status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeTestSegment writes a segment file starting at start and last written
+// at modified
+func writeTestSegment(t *testing.T, root, cameraID string, start, modified time.Time, data string) {
+	t.Helper()
+	dir := filepath.Join(root, cameraID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, strconv.FormatInt(start.Unix(), 10)+".ts")
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalListsSegmentsInTheWindow(t *testing.T) {
+	root := t.TempDir()
+	l, err := NewLocal(root, "ffmpeg", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	camera := Camera{ID: "cam-1"}
+	base := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 3; i++ {
+		start := base.Add(time.Duration(i) * time.Minute)
+		writeTestSegment(t, root, camera.ID, start, start.Add(time.Minute), "segment")
+	}
+	// Files that are not segments are ignored
+	os.WriteFile(filepath.Join(root, camera.ID, "notes.txt"), nil, 0o644)
+	os.WriteFile(filepath.Join(root, camera.ID, "partial.ts"), nil, 0o644)
+
+	segments, err := l.List(context.Background(), camera, base.Add(90*time.Second), base.Add(150*time.Second))
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("listed %d segments, want the 2 overlapping the window", len(segments))
+	}
+	first, last := segments[0], segments[1]
+	if !first.Start.Equal(base.Add(time.Minute)) || !first.End.Equal(base.Add(2*time.Minute)) {
+		t.Errorf("first segment runs %v to %v, want it to end where the next starts", first.Start, first.End)
+	}
+	// The newest segment ends at its last write
+	if !last.End.Equal(base.Add(3*time.Minute)) || last.Location != "cam-1/"+strconv.FormatInt(base.Add(2*time.Minute).Unix(), 10)+".ts" {
+		t.Errorf("last segment = %+v", last)
+	}
+	if last.SizeBytes != int64(len("segment")) || last.CameraID != camera.ID {
+		t.Errorf("last segment = %+v", last)
+	}
+
+	if segments, err := l.List(context.Background(), Camera{ID: "cam-2"}, base, base.Add(time.Hour)); err != nil || len(segments) != 0 {
+		t.Errorf("List of a camera without recordings = %v, %v", segments, err)
+	}
+}
+
+func TestLocalStaysInsideItsRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "recordings")
+	l, err := NewLocal(root, "ffmpeg", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(parent, "secret.ts"), []byte("secret"), 0o644)
+	writeTestSegment(t, root, "cam-1", time.Unix(100, 0), time.Unix(160, 0), "footage")
+
+	ctx := context.Background()
+	if _, err := l.Open(ctx, "../secret.ts"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open outside the root = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Open(ctx, "/"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open of the root = %v, want ErrNotFound", err)
+	}
+
+	r, err := l.Open(ctx, "cam-1/100.ts")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "footage" {
+		t.Errorf("read %q", data)
+	}
+
+	if err := l.Delete(ctx, "../secret.ts"); err != nil {
+		t.Fatalf("Delete outside the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "secret.ts")); err != nil {
+		t.Errorf("a file outside the root was deleted: %v", err)
+	}
+	if err := l.Delete(ctx, "cam-1/100.ts"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := l.Open(ctx, "cam-1/100.ts"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open of a deleted segment = %v, want ErrNotFound", err)
+	}
+}
@@ -9,6 +9,9 @@ type ApiResponse struct {
 	Message string      `json:"message,omitempty"`
 	Data    any `json:"data,omitempty"`
 	Error   any `json:"error,omitempty"`
+
+	// NextCursor fetches the next page of a list; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 func Success(c *gin.Context, code int, data any) {
@@ -18,6 +21,15 @@ func Success(c *gin.Context, code int, data any) {
 	})
 }
 
+// SuccessPage responds with one page of a list
+func SuccessPage(c *gin.Context, code int, data any, nextCursor string) {
+	c.JSON(code, ApiResponse{
+		Status:     "success",
+		Data:       data,
+		NextCursor: nextCursor,
+	})
+}
+
 func Error(c *gin.Context, code int, message string, err error) {
     var errMsg any
     if err != nil {
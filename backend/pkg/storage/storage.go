@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKey is returned when a key escapes the storage root
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores media objects (snapshots, uploads, clips) by key
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	SignedURL(key string, ttl time.Duration) string
+	Verify(key string, expires string, signature string) bool
+	KeyFromURL(rawURL string) (string, bool)
+}
+
+// Local stores media on the local filesystem and signs URLs with HMAC-SHA256
+type Local struct {
+	root      string
+	publicURL string
+	secret    []byte
+}
+
+// NewLocal creates a filesystem storage rooted at root. publicURL is the
+// externally reachable prefix under which keys are served.
+func NewLocal(root, publicURL, secret string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create media root: %w", err)
+	}
+	return &Local{
+		root:      root,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		secret:    []byte(secret),
+	}, nil
+}
+
+func (s *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, clean), nil
+}
+
+// Put writes the content of r under key, replacing any existing object
+func (s *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Open returns a reader for the object stored under key
+func (s *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete removes the object stored under key; missing objects are ignored
+func (s *Local) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL returns a URL for key that is valid for ttl
+func (s *Local) SignedURL(key string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(key, expires))
+	return s.publicURL + "/" + strings.TrimLeft(key, "/") + "?" + q.Encode()
+}
+
+// Verify checks a signature produced by SignedURL and that it has not expired
+func (s *Local) Verify(key string, expires string, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+// KeyFromURL returns the key of a URL produced by SignedURL, whether or not
+// it has expired. URLs the store did not sign are rejected.
+func (s *Local) KeyFromURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	public, err := url.Parse(s.publicURL)
+	if err != nil {
+		return "", false
+	}
+	// Clients may keep only the path of the URL they were given
+	if u.Host != "" && (u.Scheme != public.Scheme || u.Host != public.Host) {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(u.Path, strings.TrimRight(public.Path, "/")+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+	q := u.Query()
+	if !hmac.Equal([]byte(q.Get("signature")), []byte(s.sign(key, q.Get("expires")))) {
+		return "", false
+	}
+	return key, true
+}
+
+func (s *Local) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.TrimLeft(key, "/")))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
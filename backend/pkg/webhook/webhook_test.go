@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+func signedHeader(t *testing.T, at time.Time, body []byte) http.Header {
+	t.Helper()
+	header := http.Header{}
+	SetHeaders(header, testSecret, "alert_created", "delivery-1", at, body)
+	return header
+}
+
+func TestSignIsStable(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	first := Sign(testSecret, 1700000000, body)
+	if first != Sign(testSecret, 1700000000, body) {
+		t.Fatal("Sign is not deterministic")
+	}
+	if !strings.HasPrefix(first, signaturePrefix) {
+		t.Errorf("Sign() = %q, want the %q prefix", first, signaturePrefix)
+	}
+	for name, other := range map[string]string{
+		"secret":    Sign("whsec_other", 1700000000, body),
+		"timestamp": Sign(testSecret, 1700000001, body),
+		"body":      Sign(testSecret, 1700000000, []byte(`{"id":"2"}`)),
+	} {
+		if other == first {
+			t.Errorf("a different %s gives the same signature", name)
+		}
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	body := []byte(`{}`)
+	header := signedHeader(t, at, body)
+	if got := header.Get(HeaderEvent); got != "alert_created" {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+	if got := header.Get(HeaderDelivery); got != "delivery-1" {
+		t.Errorf("%s = %q", HeaderDelivery, got)
+	}
+	if got := header.Get(HeaderTimestamp); got != "1700000000" {
+		t.Errorf("%s = %q", HeaderTimestamp, got)
+	}
+	if got := header.Get(HeaderSignature); got != Sign(testSecret, 1700000000, body) {
+		t.Errorf("%s = %q", HeaderSignature, got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"alert_created"}`)
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		secret string
+		ok     bool
+	}{
+		{"valid", func() http.Header { return signedHeader(t, now, body) }, body, testSecret, true},
+		{"within tolerance", func() http.Header { return signedHeader(t, now.Add(-4*time.Minute), body) }, body, testSecret, true},
+		{"too old", func() http.Header { return signedHeader(t, now.Add(-6*time.Minute), body) }, body, testSecret, false},
+		{"from the future", func() http.Header { return signedHeader(t, now.Add(6*time.Minute), body) }, body, testSecret, false},
+		{"tampered body", func() http.Header { return signedHeader(t, now, body) }, []byte(`{"type":"alert_updated"}`), testSecret, false},
+		{"wrong secret", func() http.Header { return signedHeader(t, now, body) }, body, "whsec_other", false},
+		{"missing timestamp", func() http.Header {
+			header := signedHeader(t, now, body)
+			header.Del(HeaderTimestamp)
+			return header
+		}, body, testSecret, false},
+		{"replayed with a new timestamp", func() http.Header {
+			header := signedHeader(t, now.Add(-time.Hour), body)
+			header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+			return header
+		}, body, testSecret, false},
+		{"missing prefix", func() http.Header {
+			header := signedHeader(t, now, body)
+			header.Set(HeaderSignature, strings.TrimPrefix(header.Get(HeaderSignature), signaturePrefix))
+			return header
+		}, body, testSecret, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header(), tt.body, tolerance, now)
+			if tt.ok && err != nil {
+				t.Errorf("Verify() = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify() = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(first, "whsec_") || len(first) != len("whsec_")+64 {
+		t.Errorf("NewSecret() = %q", first)
+	}
+	if first == second {
+		t.Error("NewSecret returned the same secret twice")
+	}
+}
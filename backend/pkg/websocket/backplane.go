@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Backplane names
+const (
+	BackplaneMemory = "memory"
+	BackplaneRedis  = "redis"
+)
+
+// Envelope targets
+const (
+	TargetAll   = "all"
+	TargetRole  = "role"
+	TargetUser  = "user"
+	TargetTopic = "topic"
+	// TargetDisconnect closes the connection named by ClientID on whichever
+	// node holds it
+	TargetDisconnect = "disconnect"
+)
+
+// Envelope carries an encoded Message between hub nodes. The ID is assigned
+// once at publish time, so every node knows the event by the same ID.
+type Envelope struct {
+	ID       string          `json:"id"`
+	Origin   string          `json:"origin"`
+	Target   string          `json:"target"`
+	Role     string          `json:"role,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	Topics   []string        `json:"topics,omitempty"`
+	ClientID string          `json:"client_id,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// Backplane fans hub events out to every node and keeps track of the
+// connections held anywhere in the cluster
+type Backplane interface {
+	// Publish sends the envelope to every subscribed node, including the sender
+	Publish(ctx context.Context, env Envelope) error
+	// Subscribe calls deliver for every published envelope until ctx is done
+	Subscribe(ctx context.Context, deliver func(Envelope)) error
+	// SetPresence replaces the connections held by a node
+	SetPresence(ctx context.Context, nodeID string, connections []ConnectionInfo) error
+	// Presence returns the live connections of every node
+	Presence(ctx context.Context) ([]ConnectionInfo, error)
+	Close() error
+}
+
+// presenceTTL is how long a node's presence survives without a refresh,
+// so that users on a crashed node eventually show as offline
+const presenceTTL = 30 * time.Second
+
+// MemoryBackplane delivers in-process. Hubs sharing one instance behave like
+// nodes of a cluster, which is what tests use.
+type MemoryBackplane struct {
+	mu          sync.RWMutex
+	subscribers map[int]func(Envelope)
+	nextID      int
+	presence    map[string]memoryPresence
+}
+
+type memoryPresence struct {
+	connections []ConnectionInfo
+	updatedAt   time.Time
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		subscribers: make(map[int]func(Envelope)),
+		presence:    make(map[string]memoryPresence),
+	}
+}
+
+func (b *MemoryBackplane) Publish(ctx context.Context, env Envelope) error {
+	b.mu.RLock()
+	subscribers := make([]func(Envelope), 0, len(b.subscribers))
+	for _, deliver := range b.subscribers {
+		subscribers = append(subscribers, deliver)
+	}
+	b.mu.RUnlock()
+
+	for _, deliver := range subscribers {
+		deliver(env)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(ctx context.Context, deliver func(Envelope)) error {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = deliver
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, id)
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+func (b *MemoryBackplane) SetPresence(ctx context.Context, nodeID string, connections []ConnectionInfo) error {
+	copied := append([]ConnectionInfo(nil), connections...)
+	b.mu.Lock()
+	b.presence[nodeID] = memoryPresence{connections: copied, updatedAt: time.Now()}
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MemoryBackplane) Presence(ctx context.Context) ([]ConnectionInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var connections []ConnectionInfo
+	for _, p := range b.presence {
+		if time.Since(p.updatedAt) > presenceTTL {
+			continue
+		}
+		connections = append(connections, p.connections...)
+	}
+	return connections, nil
+}
+
+func (b *MemoryBackplane) Close() error {
+	return nil
+}
+
+const (
+	redisEventsChannel = "ws:events"
+	redisNodesKey      = "ws:nodes"
+	redisNodeKeyPrefix = "ws:node:"
+)
+
+// RedisBackplane uses Redis pub/sub for events and one hash per node for presence
+type RedisBackplane struct {
+	client *redis.Client
+}
+
+func NewRedisBackplane(addr, password string, db int) (*RedisBackplane, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis backplane: %w", err)
+	}
+	return &RedisBackplane{client: client}, nil
+}
+
+func (b *RedisBackplane) Publish(ctx context.Context, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, redisEventsChannel, data).Err()
+}
+
+func (b *RedisBackplane) Subscribe(ctx context.Context, deliver func(Envelope)) error {
+	sub := b.client.Subscribe(ctx, redisEventsChannel)
+	// Wait for the subscription to be confirmed so no event published after
+	// Subscribe returns is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return fmt.Errorf("redis backplane subscribe: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var env Envelope
+				if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+					log.Printf("Backplane dropped malformed event: %v", err)
+					continue
+				}
+				deliver(env)
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *RedisBackplane) SetPresence(ctx context.Context, nodeID string, connections []ConnectionInfo) error {
+	key := redisNodeKeyPrefix + nodeID
+	values := make(map[string]any, len(connections))
+	for _, conn := range connections {
+		data, err := json.Marshal(conn)
+		if err != nil {
+			return err
+		}
+		values[conn.ID] = data
+	}
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, values)
+			pipe.Expire(ctx, key, presenceTTL)
+		}
+		pipe.ZAdd(ctx, redisNodesKey, redis.Z{Score: float64(time.Now().Unix()), Member: nodeID})
+		return nil
+	})
+	return err
+}
+
+func (b *RedisBackplane) Presence(ctx context.Context) ([]ConnectionInfo, error) {
+	cutoff := time.Now().Add(-presenceTTL).Unix()
+	// Forget nodes that stopped refreshing
+	if err := b.client.ZRemRangeByScore(ctx, redisNodesKey, "-inf", fmt.Sprint(cutoff)).Err(); err != nil {
+		return nil, err
+	}
+	nodes, err := b.client.ZRange(ctx, redisNodesKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []ConnectionInfo
+	for _, nodeID := range nodes {
+		values, err := b.client.HGetAll(ctx, redisNodeKeyPrefix+nodeID).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range values {
+			var conn ConnectionInfo
+			if err := json.Unmarshal([]byte(raw), &conn); err != nil {
+				continue
+			}
+			connections = append(connections, conn)
+		}
+	}
+	return connections, nil
+}
+
+func (b *RedisBackplane) Close() error {
+	return b.client.Close()
+}
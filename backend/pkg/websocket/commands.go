@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// CommandVersion is the inbound command protocol version understood by the hub
+const CommandVersion = 1
+
+const commandTimeout = 15 * time.Second
+
+// Command error codes
+const (
+	ErrCodeInvalidRequest     = "invalid_request"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeUnknownCommand     = "unknown_command"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeConflict           = "conflict"
+	ErrCodeInternal           = "internal"
+)
+
+// Command is an inbound request from a client:
+// {"v":1,"id":"<request id>","type":"alert.acknowledge","payload":{...}}
+type Command struct {
+	Version int             `json:"v"`
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// CommandResult answers a command with the same id, as either
+// {"v":1,"type":"response","id":...,"payload":...} or
+// {"v":1,"type":"error","id":...,"error":{"code":...,"message":...}}
+type CommandResult struct {
+	Version int           `json:"v"`
+	Type    string        `json:"type"`
+	ID      string        `json:"id"`
+	Payload any           `json:"payload,omitempty"`
+	Error   *CommandError `json:"error,omitempty"`
+}
+
+// CommandError is returned to the client when a command fails
+type CommandError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewCommandError creates a command error with the given code
+func NewCommandError(code, message string) *CommandError {
+	return &CommandError{Code: code, Message: message}
+}
+
+// CommandHandler executes commands on behalf of the connected user
+type CommandHandler interface {
+	HandleCommand(ctx context.Context, userID, role string, cmd Command) (any, error)
+}
+
+// SetCommandHandler sets the handler for inbound commands
+func (h *Hub) SetCommandHandler(handler CommandHandler) {
+	h.commands = handler
+}
+
+// handleCommand runs a command and replies with a response or error frame
+func (c *Client) handleCommand(cmd Command) {
+	result := CommandResult{Version: CommandVersion, Type: "response", ID: cmd.ID}
+
+	var err error
+	switch {
+	case cmd.ID == "":
+		err = NewCommandError(ErrCodeInvalidRequest, "id is required")
+	case cmd.Version != CommandVersion:
+		err = NewCommandError(ErrCodeUnsupportedVersion, "supported version is 1")
+	case c.Hub.commands == nil:
+		err = NewCommandError(ErrCodeUnknownCommand, "commands are not enabled")
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		result.Payload, err = c.Hub.commands.HandleCommand(ctx, c.UserID, c.Role, cmd)
+		cancel()
+	}
+
+	if err != nil {
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			log.Printf("Command %s from client %s failed: %v", cmd.Type, c.ID, err)
+			cmdErr = NewCommandError(ErrCodeInternal, "internal error")
+		}
+		result.Type = "error"
+		result.Payload = nil
+		result.Error = cmdErr
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error marshaling command result: %v", err)
+		return
+	}
+	if !c.trySend(data) {
+		log.Printf("Client %s send buffer full, command result %s dropped", c.ID, cmd.ID)
+	}
+}
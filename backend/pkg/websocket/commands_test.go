@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// testCommands answers echo commands with their payload and fails the rest
+type testCommands struct{}
+
+func (testCommands) HandleCommand(ctx context.Context, userID, role string, cmd Command) (any, error) {
+	switch cmd.Type {
+	case "echo":
+		return map[string]string{"user": userID, "payload": string(cmd.Payload)}, nil
+	case "locked":
+		return nil, NewCommandError(ErrCodeConflict, "camera is locked")
+	}
+	return nil, errors.New("database is down")
+}
+
+// commandResult runs the command for the client and decodes the reply
+func commandResult(t *testing.T, client *Client, cmd Command) CommandResult {
+	t.Helper()
+	client.handleCommand(cmd)
+	select {
+	case data := <-client.Send:
+		var result CommandResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatalf("undecodable result %s: %v", data, err)
+		}
+		return result
+	default:
+		t.Fatalf("command %s got no reply", cmd.ID)
+	}
+	return CommandResult{}
+}
+
+func TestHandleCommand(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{})
+	client := connectTestClient(t, hub, "operator-1", "scs_operator")
+
+	// Without a handler every command is refused
+	if result := commandResult(t, client, Command{Version: 1, ID: "1", Type: "echo"}); result.Error == nil || result.Error.Code != ErrCodeUnknownCommand {
+		t.Errorf("command without a handler = %+v", result)
+	}
+
+	hub.SetCommandHandler(testCommands{})
+	for _, tt := range []struct {
+		name string
+		cmd  Command
+		code string
+	}{
+		{"missing id", Command{Version: 1, Type: "echo"}, ErrCodeInvalidRequest},
+		{"unsupported version", Command{Version: 2, ID: "2", Type: "echo"}, ErrCodeUnsupportedVersion},
+		{"command error", Command{Version: 1, ID: "3", Type: "locked"}, ErrCodeConflict},
+		{"internal error", Command{Version: 1, ID: "4", Type: "fail"}, ErrCodeInternal},
+	} {
+		result := commandResult(t, client, tt.cmd)
+		if result.Type != "error" || result.ID != tt.cmd.ID || result.Error == nil || result.Error.Code != tt.code || result.Payload != nil {
+			t.Errorf("%s: result = %+v, want a %s error", tt.name, result, tt.code)
+		}
+	}
+	// Internal errors are not shown to the client
+	if result := commandResult(t, client, Command{Version: 1, ID: "5", Type: "fail"}); result.Error.Message != "internal error" {
+		t.Errorf("internal error reported as %q", result.Error.Message)
+	}
+
+	result := commandResult(t, client, Command{Version: 1, ID: "6", Type: "echo", Payload: json.RawMessage(`{"n":1}`)})
+	payload, _ := result.Payload.(map[string]any)
+	if result.Type != "response" || result.ID != "6" || result.Error != nil || payload["user"] != "operator-1" || payload["payload"] != `{"n":1}` {
+		t.Errorf("echo result = %+v", result)
+	}
+}
@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// DeliveryOptions controls redelivery of messages sent with SendToUserWithAck
+type DeliveryOptions struct {
+	// AckTimeout is how long to wait for an ack before sending again
+	AckTimeout time.Duration
+	// MaxAttempts is the number of redeliveries before giving up
+	MaxAttempts int
+}
+
+// AckPayload is sent by clients as {"type":"ack","payload":{"seq":N}} and
+// acknowledges every message up to and including N
+type AckPayload struct {
+	Seq uint64 `json:"seq"`
+}
+
+// ResumePayload is sent by clients as {"type":"resume","payload":{"last_seq":N}}
+// (or as the last_seq query parameter on connect) to replay missed messages
+type ResumePayload struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// OnUndelivered registers a callback for messages that were never acked
+func (h *Hub) OnUndelivered(fn func(OutboxEntry)) {
+	h.onUndelivered = fn
+}
+
+func (h *Hub) undelivered(entry OutboxEntry) {
+	if h.onUndelivered != nil {
+		h.onUndelivered(entry)
+	}
+}
+
+// redeliver periodically resends unacked messages until they are acked or
+// run out of attempts
+func (h *Hub) redeliver(ctx context.Context) {
+	if h.delivery.AckTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.delivery.AckTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			due, expired, err := h.outbox.ClaimDue(ctx, h.delivery.AckTimeout)
+			if err != nil {
+				log.Printf("Outbox redelivery failed: %v", err)
+			}
+			for _, entry := range expired {
+				log.Printf("Message %d for user %s expired from the outbox before it was acknowledged", entry.Seq, entry.UserID)
+				h.undelivered(entry)
+			}
+			for _, entry := range due {
+				if entry.Attempts > h.delivery.MaxAttempts {
+					if err := h.outbox.Abandon(ctx, entry.UserID, entry.Seq); err != nil {
+						log.Printf("Failed to abandon message %d for user %s: %v", entry.Seq, entry.UserID, err)
+					}
+					log.Printf("Message %d for user %s was not acknowledged after %d attempts", entry.Seq, entry.UserID, h.delivery.MaxAttempts)
+					h.undelivered(entry)
+					continue
+				}
+				h.publishData(Envelope{Target: TargetUser, UserID: entry.UserID}, entry.Data)
+			}
+		}
+	}
+}
+
+// replay sends the client every stored message after lastSeq. When older
+// messages were already dropped from the outbox the client is told to resync.
+func (c *Client) replay(lastSeq uint64) {
+	entries, latest, err := c.Hub.outbox.Since(context.Background(), c.UserID, lastSeq)
+	if err != nil {
+		log.Printf("Replay failed for client %s: %v", c.ID, err)
+		return
+	}
+	if (len(entries) == 0 && latest > lastSeq) || (len(entries) > 0 && entries[0].Seq > lastSeq+1) {
+		data, _ := json.Marshal(Message{Type: "resync_required", Payload: map[string]any{
+			"last_seq":   lastSeq,
+			"latest_seq": latest,
+		}})
+		c.trySend(data)
+	}
+	for _, entry := range entries {
+		if !c.trySend(entry.Data) {
+			// The client resumes again once it has caught up
+			return
+		}
+	}
+}
+
+func (c *Client) ack(seq uint64) {
+	if err := c.Hub.Ack(context.Background(), c.UserID, seq); err != nil {
+		log.Printf("Ack failed for client %s: %v", c.ID, err)
+	}
+}
+
+// Ack acknowledges every message up to and including seq for the user. Clients
+// without an inbound channel, such as event streams, ack through the API.
+func (h *Hub) Ack(ctx context.Context, userID string, seq uint64) error {
+	return h.outbox.Ack(ctx, userID, seq)
+}
+
+// deliver queues an event for the client without blocking
+func (c *Client) deliver(env Envelope) bool {
+	if c.events == nil {
+		return c.trySend(env.Data)
+	}
+	select {
+	case c.events <- streamEvent{id: env.ID, data: env.Data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// trySend queues data without blocking; false means the buffer is full or
+// the client is gone
+func (c *Client) trySend(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes Send, which ends the client's write loop. Safe to call more
+// than once and while other goroutines are still sending.
+func (c *Client) close() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// decodePayload converts a generic message payload into v
+func decodePayload(payload any, v any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
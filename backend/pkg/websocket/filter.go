@@ -0,0 +1,45 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// MessageFilter lets users opt out of messages. Messages to one user are
+// checked before they are sequenced, so muted ones are never redelivered;
+// broadcasts are checked for every connection they reach while the hub is
+// locked, so AllowMessage must answer from memory. UserConnected is called
+// when a user connects, for the filter to load what it needs of them
+// without blocking.
+type MessageFilter interface {
+	AllowMessage(userID string, msg Message) bool
+	UserConnected(userID string)
+}
+
+// SetMessageFilter sets the filter applied to every outgoing message
+func (h *Hub) SetMessageFilter(filter MessageFilter) {
+	h.filter = filter
+}
+
+// filterable decodes a broadcast for the filter; nil means deliver it
+// unchecked. Messages to one user were checked when they were sent.
+func (h *Hub) filterable(env Envelope) *Message {
+	if h.filter == nil || env.Target == TargetUser {
+		return nil
+	}
+	var message Message
+	if err := json.Unmarshal(env.Data, &message); err != nil {
+		log.Printf("Undecodable message %s delivered unfiltered: %v", env.ID, err)
+		return nil
+	}
+	return &message
+}
+
+// reaches reports whether the envelope is for the client and not filtered
+// out; message is the envelope decoded by filterable
+func (h *Hub) reaches(client *Client, env Envelope, message *Message) bool {
+	if !client.matches(env) {
+		return false
+	}
+	return message == nil || h.filter.AllowMessage(client.UserID, *message)
+}
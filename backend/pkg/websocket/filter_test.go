@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFilter mutes message types per user and records who connected
+type testFilter struct {
+	mutex     sync.Mutex
+	muted     map[string]map[string]bool
+	connected []string
+}
+
+func (f *testFilter) AllowMessage(userID string, msg Message) bool {
+	return !f.muted[userID][msg.Type]
+}
+
+func (f *testFilter) UserConnected(userID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.connected = append(f.connected, userID)
+}
+
+func TestFilteredMessagesAreNotDelivered(t *testing.T) {
+	filter := &testFilter{muted: map[string]map[string]bool{"guard-1": {"check_in_due": true}}}
+	outbox := NewMemoryOutbox(10, time.Hour)
+	hub := NewHub(NewMemoryBackplane(), outbox, DeliveryOptions{})
+	hub.SetMessageFilter(filter)
+	hub.Start()
+	muted := connectTestClient(t, hub, "guard-1", "security_guard")
+	other := connectTestClient(t, hub, "guard-2", "security_guard")
+
+	hub.BroadcastToRole("security_guard", "check_in_due", nil)
+	if msg := receive(t, other); msg.Type != "check_in_due" {
+		t.Errorf("guard-2 received %s, want check_in_due", msg.Type)
+	}
+	expectNothing(t, muted)
+
+	// A muted message to one user is never sequenced, so it is not
+	// redelivered either
+	hub.SendToUser("guard-1", "check_in_due", nil)
+	hub.SendToUser("guard-1", "alert_created", nil)
+	if msg := receive(t, muted); msg.Type != "alert_created" || msg.Seq != 1 {
+		t.Errorf("guard-1 received %s #%d, want alert_created #1", msg.Type, msg.Seq)
+	}
+	if entries, _, _ := outbox.Since(context.Background(), "guard-1", 0); len(entries) != 1 {
+		t.Errorf("outbox holds %d entries, want only the message that was sent", len(entries))
+	}
+
+	filter.mutex.Lock()
+	defer filter.mutex.Unlock()
+	if len(filter.connected) != 2 || filter.connected[0] != "guard-1" || filter.connected[1] != "guard-2" {
+		t.Errorf("filter was told of %q connecting", filter.connected)
+	}
+}
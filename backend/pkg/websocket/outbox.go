@@ -0,0 +1,478 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OutboxEntry is a sequenced message kept for replay and redelivery
+type OutboxEntry struct {
+	UserID      string          `json:"user_id"`
+	Seq         uint64          `json:"seq"`
+	Data        json.RawMessage `json:"data"`
+	AckRequired bool            `json:"ack_required"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	// Attempts is the number of redeliveries so far; only set by ClaimDue
+	Attempts int `json:"-"`
+}
+
+// Outbox stores the last messages sent to each user under a per-user
+// sequence number so that reconnecting clients can catch up
+type Outbox interface {
+	// Append assigns the next sequence number to msg and stores it. Entries
+	// still waiting for an ack that are trimmed to make room are returned as
+	// dropped and no longer redelivered.
+	Append(ctx context.Context, userID string, msg Message) (entry OutboxEntry, dropped []OutboxEntry, err error)
+	// Since returns the stored entries after seq and the latest sequence number
+	Since(ctx context.Context, userID string, seq uint64) ([]OutboxEntry, uint64, error)
+	// Ack marks every entry up to and including seq as received
+	Ack(ctx context.Context, userID string, seq uint64) error
+	// ClaimDue returns unacked entries last sent more than ackTimeout ago and
+	// counts a new attempt for them. An entry is claimed by one node only.
+	// Entries that outlived the retention before they were acked are
+	// returned as expired and no longer redelivered.
+	ClaimDue(ctx context.Context, ackTimeout time.Duration) (due []OutboxEntry, expired []OutboxEntry, err error)
+	// Abandon stops redelivering an entry
+	Abandon(ctx context.Context, userID string, seq uint64) error
+}
+
+func encodeEntry(userID string, seq uint64, msg Message) (OutboxEntry, error) {
+	msg.Seq = seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	return OutboxEntry{
+		UserID:      userID,
+		Seq:         seq,
+		Data:        data,
+		AckRequired: msg.AckRequired,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// MemoryOutbox keeps outboxes in process memory
+type MemoryOutbox struct {
+	mu        sync.Mutex
+	size      int
+	retention time.Duration
+	users     map[string]*memoryUserOutbox
+}
+
+type memoryUserOutbox struct {
+	seq     uint64
+	acked   uint64
+	entries []OutboxEntry
+	// pending maps unacked sequence numbers to their last send time and attempts
+	pending map[uint64]*memoryPending
+}
+
+type memoryPending struct {
+	sentAt   time.Time
+	attempts int
+}
+
+// NewMemoryOutbox keeps at most size entries per user for the given retention
+func NewMemoryOutbox(size int, retention time.Duration) *MemoryOutbox {
+	return &MemoryOutbox{size: size, retention: retention, users: make(map[string]*memoryUserOutbox)}
+}
+
+func (o *MemoryOutbox) user(userID string) *memoryUserOutbox {
+	u, ok := o.users[userID]
+	if !ok {
+		u = &memoryUserOutbox{pending: make(map[uint64]*memoryPending)}
+		o.users[userID] = u
+	}
+	return u
+}
+
+func (o *MemoryOutbox) Append(ctx context.Context, userID string, msg Message) (OutboxEntry, []OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	u := o.user(userID)
+	u.seq++
+	entry, err := encodeEntry(userID, u.seq, msg)
+	if err != nil {
+		u.seq--
+		return OutboxEntry{}, nil, err
+	}
+
+	u.entries = append(u.entries, entry)
+	cutoff := time.Now().Add(-o.retention)
+	var dropped []OutboxEntry
+	drop := 0
+	for drop < len(u.entries) && (len(u.entries)-drop > o.size || u.entries[drop].CreatedAt.Before(cutoff)) {
+		old := u.entries[drop]
+		if p, ok := u.pending[old.Seq]; ok {
+			old.Attempts = p.attempts
+			dropped = append(dropped, old)
+			delete(u.pending, old.Seq)
+		}
+		drop++
+	}
+	u.entries = u.entries[drop:]
+
+	if entry.AckRequired {
+		u.pending[entry.Seq] = &memoryPending{sentAt: entry.CreatedAt}
+	}
+	return entry, dropped, nil
+}
+
+func (o *MemoryOutbox) Since(ctx context.Context, userID string, seq uint64) ([]OutboxEntry, uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	u, ok := o.users[userID]
+	if !ok {
+		return nil, 0, nil
+	}
+	cutoff := time.Now().Add(-o.retention)
+	var entries []OutboxEntry
+	for _, e := range u.entries {
+		if e.Seq > seq && !e.CreatedAt.Before(cutoff) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, u.seq, nil
+}
+
+func (o *MemoryOutbox) Ack(ctx context.Context, userID string, seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	u := o.user(userID)
+	if seq > u.seq {
+		seq = u.seq
+	}
+	if seq > u.acked {
+		u.acked = seq
+	}
+	for s := range u.pending {
+		if s <= u.acked {
+			delete(u.pending, s)
+		}
+	}
+	return nil
+}
+
+func (o *MemoryOutbox) ClaimDue(ctx context.Context, ackTimeout time.Duration) ([]OutboxEntry, []OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-o.retention)
+	var due, expired []OutboxEntry
+	for _, u := range o.users {
+		for _, e := range u.entries {
+			p, ok := u.pending[e.Seq]
+			if !ok || now.Sub(p.sentAt) < ackTimeout {
+				continue
+			}
+			if e.CreatedAt.Before(cutoff) {
+				e.Attempts = p.attempts
+				expired = append(expired, e)
+				delete(u.pending, e.Seq)
+				continue
+			}
+			p.attempts++
+			p.sentAt = now
+			e.Attempts = p.attempts
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	sort.Slice(expired, func(i, j int) bool { return expired[i].CreatedAt.Before(expired[j].CreatedAt) })
+	return due, expired, nil
+}
+
+func (o *MemoryOutbox) Abandon(ctx context.Context, userID string, seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if u, ok := o.users[userID]; ok {
+		delete(u.pending, seq)
+	}
+	return nil
+}
+
+const (
+	redisOutboxPrefix   = "ws:outbox:"
+	redisOutboxDue      = "ws:outbox:due"
+	redisOutboxAttempts = "ws:outbox:attempts"
+	redisOutboxPending  = "ws:outbox:pending"
+	redisClaimBatch     = 100
+)
+
+// advanceAck only ever moves the acked sequence number forward
+var advanceAck = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local seq = tonumber(ARGV[1])
+if seq > current then
+	redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+	return seq
+end
+return current
+`)
+
+// appendTrim adds an entry and trims the outbox to its size in one step,
+// returning the trimmed entries
+var appendTrim = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+local stop = -tonumber(ARGV[3]) - 1
+local trimmed = redis.call('ZRANGE', KEYS[1], 0, stop)
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, stop)
+return trimmed
+`)
+
+// RedisOutbox keeps outboxes in Redis so that they survive restarts and are
+// shared by every node
+type RedisOutbox struct {
+	client    *redis.Client
+	size      int
+	retention time.Duration
+}
+
+// NewRedisOutbox keeps at most size entries per user for the given retention
+func NewRedisOutbox(addr, password string, db, size int, retention time.Duration) (*RedisOutbox, error) {
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis outbox: %w", err)
+	}
+	return &RedisOutbox{client: client, size: size, retention: retention}, nil
+}
+
+func (o *RedisOutbox) Close() error {
+	return o.client.Close()
+}
+
+func outboxKey(userID string) string      { return redisOutboxPrefix + userID }
+func outboxSeqKey(userID string) string   { return redisOutboxPrefix + userID + ":seq" }
+func outboxAckedKey(userID string) string { return redisOutboxPrefix + userID + ":acked" }
+
+func pendingMember(userID string, seq uint64) string {
+	return userID + "|" + strconv.FormatUint(seq, 10)
+}
+
+func parsePendingMember(member string) (string, uint64, bool) {
+	userID, raw, ok := strings.Cut(member, "|")
+	if !ok {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(raw, 10, 64)
+	return userID, seq, err == nil
+}
+
+func (o *RedisOutbox) Append(ctx context.Context, userID string, msg Message) (OutboxEntry, []OutboxEntry, error) {
+	seq, err := o.client.Incr(ctx, outboxSeqKey(userID)).Uint64()
+	if err != nil {
+		return OutboxEntry{}, nil, err
+	}
+	entry, err := encodeEntry(userID, seq, msg)
+	if err != nil {
+		return OutboxEntry{}, nil, err
+	}
+	stored, err := json.Marshal(entry)
+	if err != nil {
+		return OutboxEntry{}, nil, err
+	}
+
+	key := outboxKey(userID)
+	trimmed, err := appendTrim.Run(ctx, o.client, []string{key}, seq, stored, o.size).StringSlice()
+	if err != nil {
+		return OutboxEntry{}, nil, err
+	}
+	_, err = o.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key, o.retention)
+		pipe.Expire(ctx, outboxSeqKey(userID), o.retention)
+		if entry.AckRequired {
+			// Kept apart from the outbox, which expires as a whole, so that an
+			// entry that is never acked can still be reported
+			member := pendingMember(userID, seq)
+			pipe.ZAdd(ctx, redisOutboxDue, redis.Z{Score: float64(entry.CreatedAt.UnixMilli()), Member: member})
+			pipe.HSet(ctx, redisOutboxPending, member, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		return OutboxEntry{}, nil, err
+	}
+	dropped, err := o.dropPending(ctx, userID, trimmed)
+	if err != nil {
+		log.Printf("Failed to check trimmed outbox entries of user %s: %v", userID, err)
+	}
+	return entry, dropped, nil
+}
+
+// dropPending stops redelivering the trimmed entries that were still waiting
+// for an ack and returns them. Only the node that removes an entry from the
+// due set returns it, so each is reported once.
+func (o *RedisOutbox) dropPending(ctx context.Context, userID string, trimmed []string) ([]OutboxEntry, error) {
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+	acked, err := o.client.Get(ctx, outboxAckedKey(userID)).Uint64()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	var dropped []OutboxEntry
+	for _, raw := range trimmed {
+		var e OutboxEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil || !e.AckRequired || e.Seq <= acked {
+			continue
+		}
+		member := pendingMember(userID, e.Seq)
+		removed, err := o.client.ZRem(ctx, redisOutboxDue, member).Result()
+		if err != nil {
+			return dropped, err
+		}
+		if removed == 0 {
+			continue
+		}
+		e.Attempts, _ = o.client.HGet(ctx, redisOutboxAttempts, member).Int()
+		o.forget(ctx, member)
+		dropped = append(dropped, e)
+	}
+	return dropped, nil
+}
+
+func (o *RedisOutbox) Since(ctx context.Context, userID string, seq uint64) ([]OutboxEntry, uint64, error) {
+	latest, err := o.client.Get(ctx, outboxSeqKey(userID)).Uint64()
+	if err == redis.Nil {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	raw, err := o.client.ZRangeByScore(ctx, outboxKey(userID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(seq, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := make([]OutboxEntry, 0, len(raw))
+	for _, r := range raw {
+		var e OutboxEntry
+		if err := json.Unmarshal([]byte(r), &e); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, latest, nil
+}
+
+func (o *RedisOutbox) Ack(ctx context.Context, userID string, seq uint64) error {
+	return advanceAck.Run(ctx, o.client, []string{outboxAckedKey(userID)}, seq, int(o.retention.Seconds())).Err()
+}
+
+func (o *RedisOutbox) ClaimDue(ctx context.Context, ackTimeout time.Duration) ([]OutboxEntry, []OutboxEntry, error) {
+	now := time.Now()
+	members, err := o.client.ZRangeByScore(ctx, redisOutboxDue, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.Add(-ackTimeout).UnixMilli(), 10),
+		Count: redisClaimBatch,
+	}).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cutoff := now.Add(-o.retention)
+	var due, expired []OutboxEntry
+	for _, member := range members {
+		// Only the node that removes the member owns this attempt
+		removed, err := o.client.ZRem(ctx, redisOutboxDue, member).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+		userID, seq, ok := parsePendingMember(member)
+		if !ok {
+			continue
+		}
+
+		acked, err := o.client.Get(ctx, outboxAckedKey(userID)).Uint64()
+		if err != nil && err != redis.Nil {
+			return due, expired, err
+		}
+		if seq <= acked {
+			o.forget(ctx, member)
+			continue
+		}
+
+		entry, ok, err := o.pendingEntry(ctx, userID, seq, member)
+		if err != nil {
+			return due, expired, err
+		}
+		if !ok {
+			log.Printf("Message %d for user %s is gone from the outbox and cannot be redelivered", seq, userID)
+			o.forget(ctx, member)
+			continue
+		}
+		if entry.CreatedAt.Before(cutoff) {
+			entry.Attempts, _ = o.client.HGet(ctx, redisOutboxAttempts, member).Int()
+			o.forget(ctx, member)
+			expired = append(expired, entry)
+			continue
+		}
+
+		attempts, err := o.client.HIncrBy(ctx, redisOutboxAttempts, member, 1).Result()
+		if err != nil {
+			return due, expired, err
+		}
+		entry.Attempts = int(attempts)
+		o.client.ZAdd(ctx, redisOutboxDue, redis.Z{Score: float64(now.UnixMilli()), Member: member})
+		due = append(due, entry)
+	}
+	return due, expired, nil
+}
+
+// pendingEntry reads an entry waiting for an ack. Entries appended before
+// they were kept apart are only found in the user's outbox.
+func (o *RedisOutbox) pendingEntry(ctx context.Context, userID string, seq uint64, member string) (OutboxEntry, bool, error) {
+	var entry OutboxEntry
+	raw, err := o.client.HGet(ctx, redisOutboxPending, member).Result()
+	if err == redis.Nil {
+		stored, err := o.client.ZRangeByScore(ctx, outboxKey(userID), &redis.ZRangeBy{
+			Min: strconv.FormatUint(seq, 10),
+			Max: strconv.FormatUint(seq, 10),
+		}).Result()
+		if err != nil || len(stored) == 0 {
+			return entry, false, err
+		}
+		raw = stored[0]
+	} else if err != nil {
+		return entry, false, err
+	}
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return entry, false, nil
+	}
+	return entry, true, nil
+}
+
+// forget drops what is kept of an entry for redelivery
+func (o *RedisOutbox) forget(ctx context.Context, member string) {
+	o.client.HDel(ctx, redisOutboxAttempts, member)
+	o.client.HDel(ctx, redisOutboxPending, member)
+}
+
+func (o *RedisOutbox) Abandon(ctx context.Context, userID string, seq uint64) error {
+	member := pendingMember(userID, seq)
+	_, err := o.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, redisOutboxDue, member)
+		pipe.HDel(ctx, redisOutboxAttempts, member)
+		pipe.HDel(ctx, redisOutboxPending, member)
+		return nil
+	})
+	return err
+}
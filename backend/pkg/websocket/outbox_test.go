@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func appendTestEntries(t *testing.T, outbox Outbox, userID string, n int, ack bool) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, _, err := outbox.Append(context.Background(), userID, Message{Type: "dispatch", AckRequired: ack}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+func entrySeqs(entries []OutboxEntry) []uint64 {
+	seqs := make([]uint64, len(entries))
+	for i, entry := range entries {
+		seqs[i] = entry.Seq
+	}
+	return seqs
+}
+
+func equalSeqs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryOutboxSequencesPerUser(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox(10, time.Hour)
+	appendTestEntries(t, outbox, "a", 3, false)
+	appendTestEntries(t, outbox, "b", 1, false)
+
+	entries, latest, err := outbox.Since(ctx, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 3 || !equalSeqs(entrySeqs(entries), []uint64{2, 3}) {
+		t.Errorf("Since(1) = %v latest %d, want [2 3] latest 3", entrySeqs(entries), latest)
+	}
+	if _, latest, _ := outbox.Since(ctx, "b", 0); latest != 1 {
+		t.Errorf("user b latest = %d, want 1", latest)
+	}
+	if entries, latest, _ := outbox.Since(ctx, "nobody", 0); len(entries) != 0 || latest != 0 {
+		t.Errorf("unknown user has %d entries, latest %d", len(entries), latest)
+	}
+}
+
+func TestMemoryOutboxTrimsAndReportsUnackedEntries(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox(2, time.Hour)
+	appendTestEntries(t, outbox, "a", 1, true)
+	appendTestEntries(t, outbox, "a", 1, false)
+
+	_, dropped, err := outbox.Append(ctx, "a", Message{Type: "dispatch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSeqs(entrySeqs(dropped), []uint64{1}) {
+		t.Errorf("dropped %v, want the unacked [1]", entrySeqs(dropped))
+	}
+	// Entries that need no ack are trimmed silently
+	if _, dropped, _ := outbox.Append(ctx, "a", Message{Type: "dispatch"}); len(dropped) != 0 {
+		t.Errorf("dropped %v, want none", entrySeqs(dropped))
+	}
+	entries, _, _ := outbox.Since(ctx, "a", 0)
+	if !equalSeqs(entrySeqs(entries), []uint64{3, 4}) {
+		t.Errorf("kept %v, want [3 4]", entrySeqs(entries))
+	}
+	// A trimmed entry is no longer redelivered
+	if due, _, _ := outbox.ClaimDue(ctx, 0); len(due) != 0 {
+		t.Errorf("trimmed entry still due: %v", entrySeqs(due))
+	}
+}
+
+func TestMemoryOutboxAckAndRedelivery(t *testing.T) {
+	ctx := context.Background()
+	outbox := NewMemoryOutbox(10, time.Hour)
+	appendTestEntries(t, outbox, "a", 3, true)
+
+	if due, _, _ := outbox.ClaimDue(ctx, time.Hour); len(due) != 0 {
+		t.Errorf("entries due before the ack timeout: %v", entrySeqs(due))
+	}
+	if err := outbox.Ack(ctx, "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	due, _, err := outbox.ClaimDue(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalSeqs(entrySeqs(due), []uint64{3}) || due[0].Attempts != 1 {
+		t.Fatalf("due after acking 2 = %v, want [3] on attempt 1", entrySeqs(due))
+	}
+	due, _, _ = outbox.ClaimDue(ctx, 0)
+	if len(due) != 1 || due[0].Attempts != 2 {
+		t.Fatalf("second claim = %+v, want attempt 2", due)
+	}
+
+	// Acks never move back and never pass the latest entry
+	outbox.Ack(ctx, "a", 100)
+	outbox.Ack(ctx, "a", 1)
+	appendTestEntries(t, outbox, "a", 1, true)
+	due, _, _ = outbox.ClaimDue(ctx, 0)
+	if !equalSeqs(entrySeqs(due), []uint64{4}) {
+		t.Errorf("due = %v, want the entry after the ack, [4]", entrySeqs(due))
+	}
+
+	outbox.Abandon(ctx, "a", 4)
+	if due, _, _ := outbox.ClaimDue(ctx, 0); len(due) != 0 {
+		t.Errorf("abandoned entry still due: %v", entrySeqs(due))
+	}
+}
+
+func TestOutboxReportsEntriesThatExpireBeforeTheirAck(t *testing.T) {
+	outboxes := map[string]Outbox{"memory": NewMemoryOutbox(10, time.Second)}
+	if redisOutbox := testRedisOutbox(t, 10, time.Second); redisOutbox != nil {
+		outboxes["redis"] = redisOutbox
+	}
+	for name, outbox := range outboxes {
+		ctx := context.Background()
+		userID := "expiry-" + time.Now().Format("150405.000000")
+		if redisOutbox, ok := outbox.(*RedisOutbox); ok {
+			cleanupRedisUser(t, redisOutbox, userID, 1)
+		}
+		appendTestEntries(t, outbox, userID, 1, true)
+		appendTestEntries(t, outbox, userID, 1, false)
+		if due, _, err := outbox.ClaimDue(ctx, 0); err != nil || !equalSeqs(entrySeqs(due), []uint64{1}) {
+			t.Fatalf("%s: due = %v, %v, want [1]", name, entrySeqs(due), err)
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+		due, expired, err := outbox.ClaimDue(ctx, 0)
+		if err != nil {
+			t.Fatalf("%s: ClaimDue: %v", name, err)
+		}
+		if len(due) != 0 || len(expired) != 1 || expired[0].Seq != 1 || expired[0].UserID != userID || expired[0].Attempts != 1 || len(expired[0].Data) == 0 {
+			t.Errorf("%s: due %v, expired %+v, want seq 1 expired after 1 attempt", name, entrySeqs(due), expired)
+		}
+		// An expired entry is reported once
+		if due, expired, _ := outbox.ClaimDue(ctx, 0); len(due) != 0 || len(expired) != 0 {
+			t.Errorf("%s: claimed %v and %v again", name, entrySeqs(due), entrySeqs(expired))
+		}
+	}
+}
+
+func TestMessageExpiredBeforeAckIsReported(t *testing.T) {
+	hub := NewHub(NewMemoryBackplane(), NewMemoryOutbox(10, 100*time.Millisecond), DeliveryOptions{AckTimeout: 20 * time.Millisecond, MaxAttempts: 1000})
+	undelivered := make(chan OutboxEntry, 1)
+	hub.OnUndelivered(func(entry OutboxEntry) { undelivered <- entry })
+	hub.Start()
+
+	hub.SendToUserWithAck("guard-1", "dispatch", nil)
+	select {
+	case entry := <-undelivered:
+		if entry.UserID != "guard-1" || entry.Seq != 1 || entry.Attempts == 0 {
+			t.Errorf("reported %+v as undelivered", entry)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message that expired before its ack was not reported")
+	}
+}
+
+func TestAckedMessageIsNotRedelivered(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{AckTimeout: 100 * time.Millisecond, MaxAttempts: 3})
+	client := connectTestClient(t, hub, "guard-1", "security_guard")
+
+	hub.SendToUserWithAck("guard-1", "dispatch", nil)
+	msg := receive(t, client)
+	if !msg.AckRequired || msg.Seq != 1 {
+		t.Fatalf("received %+v, want seq 1 needing an ack", msg)
+	}
+	if err := hub.Ack(context.Background(), "guard-1", msg.Seq); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-client.Send:
+		t.Fatalf("acked message sent again: %s", data)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestUnackedMessageIsRedeliveredThenReported(t *testing.T) {
+	delivery := DeliveryOptions{AckTimeout: 30 * time.Millisecond, MaxAttempts: 2}
+	hub := NewHub(NewMemoryBackplane(), NewMemoryOutbox(10, time.Hour), delivery)
+	undelivered := make(chan OutboxEntry, 1)
+	hub.OnUndelivered(func(entry OutboxEntry) { undelivered <- entry })
+	hub.Start()
+	client := connectTestClient(t, hub, "guard-1", "security_guard")
+
+	hub.SendToUserWithAck("guard-1", "dispatch", nil)
+	// The first send and one per redelivery, all with the same sequence
+	for i := 0; i <= delivery.MaxAttempts; i++ {
+		if msg := receive(t, client); msg.Seq != 1 || msg.Type != "dispatch" {
+			t.Fatalf("send %d = %+v, want dispatch seq 1", i, msg)
+		}
+	}
+	select {
+	case entry := <-undelivered:
+		if entry.UserID != "guard-1" || entry.Seq != 1 {
+			t.Errorf("reported %+v as undelivered", entry)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("unacked message was never reported")
+	}
+	expectNothing(t, client)
+}
+
+func TestMessageTrimmedBeforeAckIsReported(t *testing.T) {
+	hub := NewHub(NewMemoryBackplane(), NewMemoryOutbox(2, time.Hour), DeliveryOptions{})
+	undelivered := make(chan OutboxEntry, 1)
+	hub.OnUndelivered(func(entry OutboxEntry) { undelivered <- entry })
+	hub.Start()
+
+	hub.SendToUserWithAck("guard-1", "dispatch", nil)
+	hub.SendToUser("guard-1", "dispatch", nil)
+	hub.SendToUser("guard-1", "dispatch", nil)
+	select {
+	case entry := <-undelivered:
+		if entry.Seq != 1 {
+			t.Errorf("reported seq %d, want 1", entry.Seq)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message trimmed before its ack was not reported")
+	}
+}
+
+func TestReplayAfterReconnect(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), NewMemoryOutbox(3, time.Hour), DeliveryOptions{})
+	for i := 0; i < 4; i++ {
+		hub.SendToUser("guard-1", "dispatch", map[string]any{"n": i})
+	}
+	waitForDelivered(t, hub, 4)
+
+	// Resuming within the outbox replays what was missed
+	client := connectTestClient(t, hub, "guard-1", "security_guard")
+	client.replay(2)
+	for want := uint64(3); want <= 4; want++ {
+		if msg := receive(t, client); msg.Seq != want {
+			t.Errorf("replayed seq %d, want %d", msg.Seq, want)
+		}
+	}
+	expectNothing(t, client)
+
+	// Resuming from before the oldest entry asks the client to resync first
+	client.replay(0)
+	msg := receive(t, client)
+	if msg.Type != "resync_required" {
+		t.Fatalf("received %s, want resync_required", msg.Type)
+	}
+	for want := uint64(2); want <= 4; want++ {
+		if msg := receive(t, client); msg.Seq != want {
+			t.Errorf("replayed seq %d, want %d", msg.Seq, want)
+		}
+	}
+
+	// Nothing to replay once caught up
+	client.replay(4)
+	expectNothing(t, client)
+}
@@ -0,0 +1,248 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Transports a client can be connected over
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// Presence events
+const (
+	PresenceConnected    = "connected"
+	PresenceDisconnected = "disconnected"
+)
+
+// maxHandshakeField caps client-supplied handshake values
+const maxHandshakeField = 128
+
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// ConnectionInfo describes one live connection. QueueDepth is the number of
+// messages waiting to be written when the node last refreshed its presence.
+type ConnectionInfo struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	NodeID      string    `json:"node_id"`
+	Transport   string    `json:"transport"`
+	AppVersion  string    `json:"app_version,omitempty"`
+	Device      string    `json:"device,omitempty"`
+	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	QueueDepth  int       `json:"queue_depth"`
+}
+
+// PresenceEvent reports a connection opening or closing on this node, with
+// the user's cluster-wide connection count afterwards. Users on a node that
+// dies go offline when its presence expires, without an event.
+type PresenceEvent struct {
+	Event       string         `json:"event"`
+	UserID      string         `json:"user_id"`
+	Role        string         `json:"role"`
+	Online      bool           `json:"online"`
+	Connections int            `json:"connections"`
+	Connection  ConnectionInfo `json:"connection"`
+	At          time.Time      `json:"at"`
+}
+
+// OnPresence registers a callback for connections opening and closing on this node
+func (h *Hub) OnPresence(fn func(PresenceEvent)) {
+	h.onPresence = fn
+}
+
+// newClient creates a client from the handshake request. Apps identify
+// themselves with the app_version and device query parameters or the
+// X-App-Version and X-Device headers.
+func newClient(hub *Hub, userID, role, transport string, r *http.Request) *Client {
+	client := &Client{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Role:        role,
+		Send:        make(chan []byte, 256),
+		Hub:         hub,
+		Transport:   transport,
+		AppVersion:  handshakeValue(r, "app_version", "X-App-Version"),
+		Device:      handshakeValue(r, "device", "X-Device"),
+		RemoteAddr:  r.RemoteAddr,
+		ConnectedAt: time.Now(),
+		topics:      make(map[string]bool),
+	}
+	for _, topic := range hub.defaultTopicsFor(role) {
+		client.topics[topic] = true
+	}
+	return client
+}
+
+func handshakeValue(r *http.Request, param, header string) string {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		value = r.Header.Get(header)
+	}
+	if len(value) > maxHandshakeField {
+		value = value[:maxHandshakeField]
+	}
+	return value
+}
+
+func (c *Client) info(nodeID string) ConnectionInfo {
+	return ConnectionInfo{
+		ID:          c.ID,
+		UserID:      c.UserID,
+		Role:        c.Role,
+		NodeID:      nodeID,
+		Transport:   c.Transport,
+		AppVersion:  c.AppVersion,
+		Device:      c.Device,
+		RemoteAddr:  c.RemoteAddr,
+		ConnectedAt: c.ConnectedAt,
+		QueueDepth:  len(c.Send) + len(c.events),
+	}
+}
+
+// presenceChanged queues a presence event; the caller may hold h.mutex
+func (h *Hub) presenceChanged(client *Client, event string) {
+	select {
+	case h.presence <- PresenceEvent{Event: event, UserID: client.UserID, Role: client.Role, Connection: client.info(h.nodeID), At: time.Now()}:
+	default:
+		log.Printf("Presence queue full, %s event for client %s dropped", event, client.ID)
+	}
+}
+
+// syncPresence writes this node's connections to the backplane after every
+// connect and disconnect, refreshes them before they expire and announces
+// the changes
+func (h *Hub) syncPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.writePresence(ctx)
+		case event := <-h.presence:
+			// A burst of connects is written once
+			events := []PresenceEvent{event}
+		drain:
+			for {
+				select {
+				case event := <-h.presence:
+					events = append(events, event)
+				default:
+					break drain
+				}
+			}
+			if h.writePresence(ctx) {
+				h.announce(ctx, events)
+			}
+		}
+	}
+}
+
+func (h *Hub) writePresence(ctx context.Context) bool {
+	h.mutex.RLock()
+	connections := make([]ConnectionInfo, 0, len(h.clients))
+	for client := range h.clients {
+		connections = append(connections, client.info(h.nodeID))
+	}
+	h.mutex.RUnlock()
+
+	if err := h.backplane.SetPresence(ctx, h.nodeID, connections); err != nil {
+		log.Printf("Failed to publish presence: %v", err)
+		return false
+	}
+	return true
+}
+
+func (h *Hub) announce(ctx context.Context, events []PresenceEvent) {
+	if h.onPresence == nil {
+		return
+	}
+	counts, err := h.Presence(ctx)
+	if err != nil {
+		log.Printf("Presence lookup failed: %v", err)
+		return
+	}
+	for _, event := range events {
+		event.Connections = counts[event.UserID]
+		event.Online = event.Connections > 0
+		h.onPresence(event)
+	}
+}
+
+// Connections returns every live connection in the cluster
+func (h *Hub) Connections(ctx context.Context) ([]ConnectionInfo, error) {
+	return h.backplane.Presence(ctx)
+}
+
+// Presence returns the number of connections per online user across the cluster
+func (h *Hub) Presence(ctx context.Context) (map[string]int, error) {
+	connections, err := h.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[string]int)
+	for _, conn := range connections {
+		online[conn.UserID]++
+	}
+	return online, nil
+}
+
+// IsOnline reports whether the user is connected to any node
+func (h *Hub) IsOnline(ctx context.Context, userID string) bool {
+	online, err := h.Presence(ctx)
+	if err != nil {
+		log.Printf("Presence lookup failed: %v", err)
+		return false
+	}
+	return online[userID] > 0
+}
+
+// Disconnect closes a connection on whichever node holds it. The client is
+// sent a session_closed message with the reason first.
+func (h *Hub) Disconnect(ctx context.Context, connectionID, reason string) (*ConnectionInfo, error) {
+	connections, err := h.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, conn := range connections {
+		if conn.ID != connectionID {
+			continue
+		}
+		data, err := json.Marshal(Message{Type: "session_closed", Payload: map[string]string{"reason": reason}})
+		if err != nil {
+			return nil, err
+		}
+		h.publishData(Envelope{Target: TargetDisconnect, ClientID: connectionID}, data)
+		return &conn, nil
+	}
+	return nil, ErrConnectionNotFound
+}
+
+// disconnectLocal closes the client named by the envelope if it is held by
+// this node; the caller holds h.mutex
+func (h *Hub) disconnectLocal(env Envelope) {
+	for client := range h.clients {
+		if client.ID != env.ClientID {
+			continue
+		}
+		client.trySend(env.Data)
+		delete(h.clients, client)
+		client.close()
+		h.presenceChanged(client, PresenceDisconnected)
+		log.Printf("Client %s disconnected by request", client.ID)
+		return
+	}
+}
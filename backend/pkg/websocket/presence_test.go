@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandshakeValue(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws?app_version=2.1.0", nil)
+	r.Header.Set("X-App-Version", "1.0.0")
+	r.Header.Set("X-Device", strings.Repeat("d", maxHandshakeField+10))
+
+	if got := handshakeValue(r, "app_version", "X-App-Version"); got != "2.1.0" {
+		t.Errorf("app version = %q, want the query parameter", got)
+	}
+	if got := handshakeValue(r, "device", "X-Device"); len(got) != maxHandshakeField {
+		t.Errorf("device has %d characters, want it cut to %d", len(got), maxHandshakeField)
+	}
+	if got := handshakeValue(r, "missing", "X-Missing"); got != "" {
+		t.Errorf("missing value = %q", got)
+	}
+}
+
+func TestPresenceCountsConnectionsAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	backplane := NewMemoryBackplane()
+	events := make(chan PresenceEvent, 16)
+	nodeA := NewHub(backplane, NewMemoryOutbox(10, time.Hour), DeliveryOptions{})
+	nodeA.OnPresence(func(event PresenceEvent) { events <- event })
+	nodeA.Start()
+	nodeB := startTestHub(t, backplane, nil, DeliveryOptions{})
+
+	nextEvent := func() PresenceEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(2 * time.Second):
+			t.Fatal("no presence event")
+		}
+		return PresenceEvent{}
+	}
+
+	phone := connectTestClient(t, nodeA, "guard-1", "security_guard")
+	if event := nextEvent(); event.Event != PresenceConnected || event.UserID != "guard-1" || !event.Online || event.Connections != 1 ||
+		event.Connection.ID != phone.ID || event.Connection.NodeID != nodeA.NodeID() {
+		t.Errorf("connect event = %+v", event)
+	}
+	connectTestClient(t, nodeB, "guard-1", "security_guard")
+	connectTestClient(t, nodeB, "operator-1", "scs_operator")
+
+	// Every node sees the connections of the others once they are written
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		counts, err := nodeA.Presence(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts["guard-1"] == 2 && counts["operator-1"] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("presence = %v, want guard-1 twice and operator-1 once", counts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Closing one of two connections leaves the user online
+	nodeA.unregister <- phone
+	if event := nextEvent(); event.Event != PresenceDisconnected || !event.Online || event.Connections != 1 {
+		t.Errorf("disconnect event = %+v, want guard-1 still online once", event)
+	}
+	if !nodeA.IsOnline(ctx, "guard-1") || nodeA.IsOnline(ctx, "guard-2") {
+		t.Error("IsOnline does not follow the connections")
+	}
+}
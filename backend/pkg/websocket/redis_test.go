@@ -0,0 +1,38 @@
+package websocket
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// testRedisOutbox connects to the Redis server in TEST_REDIS_ADDR; tests
+// that also cover the Redis outbox run without it on the memory one only
+func testRedisOutbox(t *testing.T, size int, retention time.Duration) *RedisOutbox {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		return nil
+	}
+	outbox, err := NewRedisOutbox(addr, "", 0, size, retention)
+	if err != nil {
+		t.Fatalf("test redis: %v", err)
+	}
+	t.Cleanup(func() { outbox.Close() })
+	return outbox
+}
+
+// cleanupRedisUser removes the user's outbox and the entries of theirs
+// waiting for an ack after the test
+func cleanupRedisUser(t *testing.T, outbox *RedisOutbox, userID string, seqs ...uint64) {
+	t.Cleanup(func() {
+		ctx := context.Background()
+		outbox.client.Del(ctx, outboxKey(userID), outboxSeqKey(userID), outboxAckedKey(userID))
+		for _, seq := range seqs {
+			member := pendingMember(userID, seq)
+			outbox.client.ZRem(ctx, redisOutboxDue, member)
+			outbox.forget(ctx, member)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// historySize is the number of recent events each node keeps for
+	// Last-Event-ID resume
+	historySize = 512
+	// streamRetry is the reconnect delay suggested to EventSource clients
+	streamRetry = 3 * time.Second
+	// streamHeartbeat keeps proxies from closing idle streams
+	streamHeartbeat = 25 * time.Second
+)
+
+type streamEvent struct {
+	id   string
+	data []byte
+}
+
+// remember appends an event to the resume history; the caller holds h.mutex
+func (h *Hub) remember(env Envelope) {
+	if env.ID == "" {
+		return
+	}
+	h.history = append(h.history, env)
+	if len(h.history) > historySize {
+		h.history = append(h.history[:0:0], h.history[len(h.history)-historySize:]...)
+	}
+}
+
+// attachStream registers an event stream client and queues the events it
+// missed after lastEventID. Both happen under the hub lock so no event is
+// lost or repeated in between. It returns false when lastEventID is no
+// longer in the history.
+func (h *Hub) attachStream(client *Client, lastEventID string) bool {
+	if h.filter != nil {
+		h.filter.UserConnected(client.UserID)
+	}
+	h.mutex.Lock()
+	resumed := true
+	if lastEventID != "" {
+		start := -1
+		for i := len(h.history) - 1; i >= 0; i-- {
+			if h.history[i].ID == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			resumed = false
+		} else {
+			for _, env := range h.history[start:] {
+				if h.reaches(client, env, h.filterable(env)) {
+					client.deliver(env)
+				}
+			}
+		}
+	}
+	h.clients[client] = true
+	h.presenceChanged(client, PresenceConnected)
+	h.mutex.Unlock()
+
+	log.Printf("Event stream client %s connected", client.ID)
+	return resumed
+}
+
+// ServeEvents streams hub events as Server-Sent Events, for networks that
+// block WebSocket upgrades. Each data line is the same JSON message a
+// WebSocket client receives. Topics are requested with ?topics=a,b and a
+// reconnecting client resumes from the Last-Event-ID header (or the
+// last_event_id query parameter).
+func ServeEvents(hub *Hub, userID, role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		client := newClient(hub, userID, role, TransportSSE, r)
+		client.events = make(chan streamEvent, historySize+256)
+		if raw := r.URL.Query().Get("topics"); raw != "" {
+			client.subscribe(splitTopics(raw))
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+		if !hub.attachStream(client, lastEventID) {
+			data, _ := json.Marshal(Message{Type: "resync_required", Payload: map[string]any{
+				"last_event_id": lastEventID,
+			}})
+			client.trySend(data)
+		}
+		defer func() {
+			hub.unregister <- client
+		}()
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case data, ok := <-client.Send:
+				if !ok {
+					return
+				}
+				err = writeStreamEvent(w, "", data)
+			case event := <-client.events:
+				err = writeStreamEvent(w, event.id, event.data)
+			case <-heartbeat.C:
+				_, err = io.WriteString(w, ": ping\n\n")
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeStreamEvent writes one SSE event; control frames have no id and
+// don't move the client's resume position
+func writeStreamEvent(w io.Writer, id string, data []byte) error {
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+func splitTopics(raw string) []string {
+	var topics []string
+	for _, topic := range strings.Split(raw, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
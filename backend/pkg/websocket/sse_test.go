@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamTestEvent is an event read back from a stream
+type streamTestEvent struct {
+	id      string
+	message Message
+}
+
+// openTestStream connects to the hub's event stream and returns its events
+// as they are read
+func openTestStream(t *testing.T, hub *Hub, lastEventID string) <-chan streamTestEvent {
+	t.Helper()
+	server := httptest.NewServer(ServeEvents(hub, "operator-1", "scs_operator"))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("stream served as %s", ct)
+	}
+
+	events := make(chan streamTestEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var event streamTestEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.message)
+				events <- event
+				event = streamTestEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextTestEvent(t *testing.T, events <-chan streamTestEvent) streamTestEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream sent nothing")
+	}
+	return streamTestEvent{}
+}
+
+func TestEventStreamResumesAfterTheLastEvent(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{})
+	for i := 0; i < 3; i++ {
+		hub.Broadcast("tick", map[string]any{"n": i})
+	}
+	waitForDelivered(t, hub, 3)
+	hub.mutex.RLock()
+	first, missed := hub.history[0].ID, hub.history[1:]
+	hub.mutex.RUnlock()
+
+	events := openTestStream(t, hub, first)
+	for _, want := range missed {
+		if event := nextTestEvent(t, events); event.id != want.ID || event.message.Type != "tick" {
+			t.Errorf("replayed %s %s, want tick %s", event.message.Type, event.id, want.ID)
+		}
+	}
+	// Events published after the resume follow
+	hub.Broadcast("tock", nil)
+	if event := nextTestEvent(t, events); event.message.Type != "tock" || event.id == "" {
+		t.Errorf("received %s %q, want tock with an id", event.message.Type, event.id)
+	}
+}
+
+func TestEventStreamAsksToResyncAfterAnUnknownEvent(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{})
+	events := openTestStream(t, hub, "forgotten")
+	event := nextTestEvent(t, events)
+	if event.message.Type != "resync_required" || event.id != "" {
+		t.Errorf("received %s %q, want resync_required without an id", event.message.Type, event.id)
+	}
+}
+
+func TestRememberKeepsTheRecentHistory(t *testing.T) {
+	hub := NewHub(NewMemoryBackplane(), NewMemoryOutbox(10, time.Hour), DeliveryOptions{})
+	hub.remember(Envelope{})
+	for i := 0; i < historySize+10; i++ {
+		hub.remember(Envelope{ID: strconv.Itoa(i)})
+	}
+	if len(hub.history) != historySize || hub.history[0].ID != "10" || hub.history[historySize-1].ID != strconv.Itoa(historySize+9) {
+		t.Errorf("history holds %d events from %s, want the last %d", len(hub.history), hub.history[0].ID, historySize)
+	}
+}
+
+func TestWriteStreamEvent(t *testing.T) {
+	var buf bytes.Buffer
+	writeStreamEvent(&buf, "e1", []byte(`{"type":"tick"}`))
+	writeStreamEvent(&buf, "", []byte(`{"type":"pong"}`))
+	if want := "id: e1\ndata: {\"type\":\"tick\"}\n\ndata: {\"type\":\"pong\"}\n\n"; buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+
+	if topics := splitTopics(" premise:1,,incident:2 , "); len(topics) != 2 || topics[0] != "premise:1" || topics[1] != "incident:2" {
+		t.Errorf("splitTopics = %q", topics)
+	}
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// TopicAuthorizer decides whether a user may subscribe to a topic
+type TopicAuthorizer interface {
+	AuthorizeTopic(ctx context.Context, userID, role, topic string) error
+}
+
+// TopicsPayload is the payload of subscribe/unsubscribe frames:
+// {"type":"subscribe","payload":{"topics":["premise:<id>"]}}
+type TopicsPayload struct {
+	Topics []string `json:"topics"`
+}
+
+// SetTopicAuthorizer sets the authorizer checked on every subscription.
+// Without one, clients can only hold their default topics.
+func (h *Hub) SetTopicAuthorizer(authorizer TopicAuthorizer) {
+	h.authorizer = authorizer
+}
+
+// SetDefaultTopics sets the topics a client of the given role is
+// subscribed to on connect
+func (h *Hub) SetDefaultTopics(role string, topics ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.defaultTopics == nil {
+		h.defaultTopics = make(map[string][]string)
+	}
+	h.defaultTopics[role] = topics
+}
+
+func (h *Hub) defaultTopicsFor(role string) []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.defaultTopics[role]
+}
+
+// Publish sends a message to every client subscribed to at least one of the topics
+func (h *Hub) Publish(topics []string, messageType string, payload any) {
+	if len(topics) == 0 {
+		return
+	}
+	h.publish(Envelope{Target: TargetTopic, Topics: topics}, messageType, payload)
+	if h.onPublish != nil {
+		h.onPublish(topics, messageType, payload)
+	}
+}
+
+// OnPublish registers a callback for every topic event published on this
+// node, for forwarding events outside the realtime feed. It runs on the
+// publisher's goroutine.
+func (h *Hub) OnPublish(fn func(topics []string, messageType string, payload any)) {
+	h.onPublish = fn
+}
+
+// subscribe authorizes and adds topics, reporting the outcome to the client
+func (c *Client) subscribe(topics []string) {
+	var granted []string
+	for _, topic := range topics {
+		if c.Hub.authorizer == nil {
+			c.sendSubscriptionError(topic, "subscriptions are disabled")
+			continue
+		}
+		if err := c.Hub.authorizer.AuthorizeTopic(context.Background(), c.UserID, c.Role, topic); err != nil {
+			c.sendSubscriptionError(topic, err.Error())
+			continue
+		}
+		granted = append(granted, topic)
+	}
+
+	c.topicsMu.Lock()
+	for _, topic := range granted {
+		c.topics[topic] = true
+	}
+	c.topicsMu.Unlock()
+
+	c.sendTopics("subscribed", granted)
+}
+
+func (c *Client) unsubscribe(topics []string) {
+	c.topicsMu.Lock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+	c.topicsMu.Unlock()
+
+	c.sendTopics("unsubscribed", topics)
+}
+
+// Topics returns the topics the client is subscribed to
+func (c *Client) Topics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+func (c *Client) subscribedToAny(topics []string) bool {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	for _, topic := range topics {
+		if c.topics[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) sendTopics(messageType string, topics []string) {
+	if topics == nil {
+		topics = []string{}
+	}
+	data, _ := json.Marshal(Message{Type: messageType, Payload: TopicsPayload{Topics: topics}})
+	c.trySend(data)
+}
+
+func (c *Client) sendSubscriptionError(topic, reason string) {
+	log.Printf("Client %s denied topic %s: %s", c.ID, topic, reason)
+	data, _ := json.Marshal(Message{Type: "subscription_error", Payload: map[string]string{
+		"topic": topic,
+		"error": reason,
+	}})
+	c.trySend(data)
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testAuthorizer grants the topics it holds
+type testAuthorizer map[string]bool
+
+func (a testAuthorizer) AuthorizeTopic(ctx context.Context, userID, role, topic string) error {
+	if !a[topic] {
+		return errors.New("permission denied")
+	}
+	return nil
+}
+
+func TestSubscribeGrantsOnlyAuthorizedTopics(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{})
+	hub.SetTopicAuthorizer(testAuthorizer{"incident:1": true})
+	guard := connectTestClient(t, hub, "guard-1", "security_guard")
+
+	guard.subscribe([]string{"incident:1", "premise:1"})
+	if msg := receive(t, guard); msg.Type != "subscription_error" {
+		t.Errorf("received %s, want subscription_error for premise:1", msg.Type)
+	}
+	var granted TopicsPayload
+	msg := receive(t, guard)
+	if err := decodePayload(msg.Payload, &granted); err != nil || msg.Type != "subscribed" ||
+		len(granted.Topics) != 1 || granted.Topics[0] != "incident:1" {
+		t.Fatalf("received %s %+v, want subscribed to incident:1", msg.Type, msg.Payload)
+	}
+
+	hub.Publish([]string{"premise:1"}, "alert_created", nil)
+	hub.Publish([]string{"premise:1", "incident:1"}, "incident_updated", nil)
+	if msg := receive(t, guard); msg.Type != "incident_updated" {
+		t.Errorf("received %s, want only incident_updated", msg.Type)
+	}
+
+	guard.unsubscribe([]string{"incident:1"})
+	if msg := receive(t, guard); msg.Type != "unsubscribed" {
+		t.Errorf("received %s, want unsubscribed", msg.Type)
+	}
+	hub.Publish([]string{"incident:1"}, "incident_updated", nil)
+	expectNothing(t, guard)
+}
+
+func TestSubscribeWithoutAnAuthorizer(t *testing.T) {
+	hub := startTestHub(t, NewMemoryBackplane(), nil, DeliveryOptions{})
+	client := connectTestClient(t, hub, "operator-1", "scs_operator")
+
+	client.subscribe([]string{"incidents"})
+	if msg := receive(t, client); msg.Type != "subscription_error" {
+		t.Errorf("received %s, want subscription_error", msg.Type)
+	}
+	if msg := receive(t, client); msg.Type != "subscribed" {
+		t.Errorf("received %s, want an empty subscribed", msg.Type)
+	}
+	if topics := client.Topics(); len(topics) != 0 {
+		t.Errorf("client holds %v, want no topics", topics)
+	}
+}
@@ -1,9 +1,11 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -11,6 +13,9 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// maxMessageSize is the largest inbound frame accepted from a client
+const maxMessageSize = 16 << 10
+
 // Client represents a WebSocket client
 type Client struct {
 	ID       string
@@ -19,124 +24,204 @@ type Client struct {
 	Conn     *websocket.Conn
 	Send     chan []byte
 	Hub      *Hub
+
+	// Handshake details reported in presence
+	Transport   string
+	AppVersion  string
+	Device      string
+	RemoteAddr  string
+	ConnectedAt time.Time
+
+	topics   map[string]bool
+	topicsMu sync.RWMutex
+
+	// closed is set once Send is closed; command results and acks still in
+	// flight for a disconnected client are then dropped. Guarded by sendMu.
+	closed bool
+	sendMu sync.Mutex
+
+	// events is set for Server-Sent Events clients, which need the event ID
+	// alongside the data
+	events chan streamEvent
 }
 
-// Hub manages all WebSocket connections
+// Hub manages the WebSocket connections of this node. Events are published
+// through the backplane and every node delivers them to its own clients.
 type Hub struct {
+	nodeID     string
+	backplane  Backplane
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	deliver    chan Envelope
 	register   chan *Client
 	unregister chan *Client
+	presence   chan PresenceEvent
 	mutex      sync.RWMutex
+
+	onPresence func(PresenceEvent)
+	onPublish  func(topics []string, messageType string, payload any)
+
+	outbox        Outbox
+	delivery      DeliveryOptions
+	onUndelivered func(OutboxEntry)
+
+	authorizer    TopicAuthorizer
+	filter        MessageFilter
+	defaultTopics map[string][]string
+	commands      CommandHandler
+
+	// history holds recent events for Last-Event-ID resume; guarded by mutex
+	history []Envelope
 }
 
-// Message represents a WebSocket message
+// Message represents a WebSocket message. Messages sent to a single user
+// carry a per-user Seq; clients ack it and resume from the last one seen.
 type Message struct {
-	Type    string      `json:"type"`
-	Payload any `json:"payload"`
-	UserID  string      `json:"user_id,omitempty"`
+	Type        string      `json:"type"`
+	Payload     any `json:"payload"`
+	UserID      string      `json:"user_id,omitempty"`
+	Seq         uint64      `json:"seq,omitempty"`
+	AckRequired bool        `json:"ack_required,omitempty"`
 }
 
-// NewHub creates a new WebSocket hub
-func NewHub() *Hub {
+// NewHub creates a new WebSocket hub on top of the given backplane; user
+// messages are sequenced and kept in outbox
+func NewHub(backplane Backplane, outbox Outbox, delivery DeliveryOptions) *Hub {
 	return &Hub{
+		nodeID:     uuid.New().String(),
+		backplane:  backplane,
+		outbox:     outbox,
+		delivery:   delivery,
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
+		deliver:    make(chan Envelope, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		presence:   make(chan PresenceEvent, 256),
 	}
 }
 
-// Run starts the WebSocket hub
-func (h *Hub) Run() {
+// NodeID identifies this hub within the cluster
+func (h *Hub) NodeID() string {
+	return h.nodeID
+}
+
+// Start subscribes the hub to the backplane and runs it in the background.
+// Events published before Start returns are lost, so call it once every
+// callback is set and before anything that publishes is started.
+func (h *Hub) Start() {
+	ctx := context.Background()
+	if err := h.backplane.Subscribe(ctx, h.enqueue); err != nil {
+		log.Printf("Backplane subscribe failed, events will only reach local clients: %v", err)
+	}
+	go h.syncPresence(ctx)
+	go h.redeliver(ctx)
+	go h.run()
+}
+
+func (h *Hub) run() {
 	for {
 		select {
 		case client := <-h.register:
 			h.mutex.Lock()
 			h.clients[client] = true
+			h.presenceChanged(client, PresenceConnected)
 			h.mutex.Unlock()
+			if h.filter != nil {
+				h.filter.UserConnected(client.UserID)
+			}
 			log.Printf("Client %s connected", client.ID)
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.Send)
+				client.close()
+				h.presenceChanged(client, PresenceDisconnected)
+				log.Printf("Client %s disconnected", client.ID)
 			}
 			h.mutex.Unlock()
-			log.Printf("Client %s disconnected", client.ID)
-
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
-				}
-			}
-			h.mutex.RUnlock()
+
+		case env := <-h.deliver:
+			h.deliverLocal(env)
 		}
 	}
 }
 
-// BroadcastToRole sends a message to all clients with a specific role
-func (h *Hub) BroadcastToRole(role string, messageType string, payload any) {
-	message := Message{
-		Type:    messageType,
-		Payload: payload,
-	}
-
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
+// deliverLocal sends an envelope to the matching clients of this node
+func (h *Hub) deliverLocal(env Envelope) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if env.Target == TargetDisconnect {
+		h.disconnectLocal(env)
 		return
 	}
-
-	h.mutex.RLock()
+	h.remember(env)
+	message := h.filterable(env)
 	for client := range h.clients {
-		if client.Role == role {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
+		if !h.reaches(client, env, message) {
+			continue
+		}
+		// A slow client misses the message rather than being disconnected;
+		// sequenced messages are recovered when it resumes
+		if !client.deliver(env) {
+			log.Printf("Client %s send buffer full, message dropped", client.ID)
 		}
 	}
-	h.mutex.RUnlock()
 }
 
-// SendToUser sends a message to a specific user
-func (h *Hub) SendToUser(userID string, messageType string, payload any) {
-	message := Message{
-		Type:    messageType,
-		Payload: payload,
+// matches reports whether the envelope is addressed to the client
+func (c *Client) matches(env Envelope) bool {
+	switch env.Target {
+	case TargetRole:
+		return c.Role == env.Role
+	case TargetUser:
+		return c.UserID == env.UserID
+	case TargetTopic:
+		return c.subscribedToAny(env.Topics)
 	}
+	return true
+}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
+// BroadcastToRole sends a message to all clients with a specific role
+func (h *Hub) BroadcastToRole(role string, messageType string, payload any) {
+	h.publish(Envelope{Target: TargetRole, Role: role}, messageType, payload)
+}
+
+// SendToUser sends a sequenced message to a specific user
+func (h *Hub) SendToUser(userID string, messageType string, payload any) {
+	h.sendToUser(userID, Message{Type: messageType, Payload: payload})
+}
+
+// SendToUserWithAck sends a sequenced message that is redelivered until the
+// user acks it or the delivery attempts run out
+func (h *Hub) SendToUserWithAck(userID string, messageType string, payload any) {
+	h.sendToUser(userID, Message{Type: messageType, Payload: payload, AckRequired: true})
+}
+
+func (h *Hub) sendToUser(userID string, message Message) {
+	if h.filter != nil && !h.filter.AllowMessage(userID, message) {
 		return
 	}
-
-	h.mutex.RLock()
-	for client := range h.clients {
-		if client.UserID == userID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
-		}
+	entry, dropped, err := h.outbox.Append(context.Background(), userID, message)
+	// Messages pushed out of a full outbox before they were acked are never
+	// going to arrive
+	for _, old := range dropped {
+		log.Printf("Message %d for user %s was dropped from the outbox before it was acknowledged", old.Seq, old.UserID)
+		h.undelivered(old)
+	}
+	if err != nil {
+		log.Printf("Outbox append failed for user %s, sending unsequenced: %v", userID, err)
+		h.publish(Envelope{Target: TargetUser, UserID: userID}, message.Type, message.Payload)
+		return
 	}
-	h.mutex.RUnlock()
+	h.publishData(Envelope{Target: TargetUser, UserID: userID}, entry.Data)
 }
 
 // Broadcast sends a message to all connected clients
 func (h *Hub) Broadcast(messageType string, payload any) {
+	h.publish(Envelope{Target: TargetAll}, messageType, payload)
+}
+
+func (h *Hub) publish(env Envelope, messageType string, payload any) {
 	message := Message{
 		Type:    messageType,
 		Payload: payload,
@@ -147,8 +232,36 @@ func (h *Hub) Broadcast(messageType string, payload any) {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
+	h.publishData(env, data)
+}
 
-	h.broadcast <- data
+func (h *Hub) publishData(env Envelope, data []byte) {
+	if env.ID == "" {
+		env.ID = uuid.New().String()
+	}
+	env.Origin = h.nodeID
+	env.Data = data
+	if err := h.backplane.Publish(context.Background(), env); err != nil {
+		log.Printf("Backplane publish failed, delivering locally: %v", err)
+		h.enqueue(env)
+	}
+}
+
+// enqueue hands an envelope to the run loop without blocking, since events
+// are also published from the run loop itself and from backplane callbacks.
+// When the queue is full the event is dropped for this node's clients;
+// sequenced user messages stay in the outbox and are redelivered or replayed.
+// Forced disconnects are too rare to drop and are queued in the background.
+func (h *Hub) enqueue(env Envelope) {
+	select {
+	case h.deliver <- env:
+	default:
+		if env.Target == TargetDisconnect {
+			go func() { h.deliver <- env }()
+			return
+		}
+		log.Printf("Hub delivery queue full, event %s dropped", env.ID)
+	}
 }
 
 // readPump reads messages from the WebSocket connection
@@ -158,7 +271,7 @@ func (c *Client) readPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(512)
+	c.Conn.SetReadLimit(maxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -174,6 +287,13 @@ func (c *Client) readPump() {
 			break
 		}
 
+		// Versioned commands carry "v"; everything else is a control frame
+		var cmd Command
+		if err := json.Unmarshal(message, &cmd); err == nil && cmd.Version != 0 {
+			c.handleCommand(cmd)
+			continue
+		}
+
 		// Handle incoming messages
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
@@ -230,15 +350,35 @@ func (c *Client) handleMessage(msg Message) {
 			Type: "pong",
 		}
 		data, _ := json.Marshal(response)
-		c.Send <- data
+		c.trySend(data)
+
+	case "ack":
+		var ack AckPayload
+		if err := decodePayload(msg.Payload, &ack); err != nil {
+			log.Printf("Invalid ack from client %s: %v", c.ID, err)
+			return
+		}
+		c.ack(ack.Seq)
 
-	case "incident_update":
-		// Broadcast incident update to SCS operators
-		c.Hub.BroadcastToRole("scs_operator", "incident_updated", msg.Payload)
+	case "resume":
+		var resume ResumePayload
+		if err := decodePayload(msg.Payload, &resume); err != nil {
+			log.Printf("Invalid resume from client %s: %v", c.ID, err)
+			return
+		}
+		c.replay(resume.LastSeq)
 
-	case "alert_acknowledge":
-		// Broadcast alert acknowledgment
-		c.Hub.Broadcast("alert_acknowledged", msg.Payload)
+	case "subscribe", "unsubscribe":
+		var req TopicsPayload
+		if err := decodePayload(msg.Payload, &req); err != nil {
+			log.Printf("Invalid %s from client %s: %v", msg.Type, c.ID, err)
+			return
+		}
+		if msg.Type == "subscribe" {
+			c.subscribe(req.Topics)
+		} else {
+			c.unsubscribe(req.Topics)
+		}
 
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
@@ -262,19 +402,19 @@ func ServeWebSocket(hub *Hub, userID, role string) http.HandlerFunc {
 			return
 		}
 
-		client := &Client{
-			ID:     uuid.New().String(),
-			UserID: userID,
-			Role:   role,
-			Conn:   conn,
-			Send:   make(chan []byte, 256),
-			Hub:    hub,
-		}
+		client := newClient(hub, userID, role, TransportWebSocket, r)
+		client.Conn = conn
 
 		client.Hub.register <- client
 
-		// Start goroutines for reading and writing
+		// Start goroutines for reading and writing; a reconnecting client
+		// passes the last sequence number it saw to catch up
 		go client.writePump()
+		if raw := r.URL.Query().Get("last_seq"); raw != "" {
+			if lastSeq, err := strconv.ParseUint(raw, 10, 64); err == nil {
+				client.replay(lastSeq)
+			}
+		}
 		go client.readPump()
 	}
 } 
\ No newline at end of file
@@ -0,0 +1,245 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startTestHub starts a hub as one node of the cluster behind backplane
+func startTestHub(t *testing.T, backplane Backplane, outbox Outbox, delivery DeliveryOptions) *Hub {
+	t.Helper()
+	if outbox == nil {
+		outbox = NewMemoryOutbox(100, time.Hour)
+	}
+	hub := NewHub(backplane, outbox, delivery)
+	hub.Start()
+	return hub
+}
+
+// connectTestClient registers a client with the hub as a connection would,
+// subscribed to the topics given
+func connectTestClient(t *testing.T, hub *Hub, userID, role string, topics ...string) *Client {
+	t.Helper()
+	client := newClient(hub, userID, role, "websocket", httptest.NewRequest("GET", "/ws", nil))
+	for _, topic := range topics {
+		client.topics[topic] = true
+	}
+	hub.register <- client
+	return client
+}
+
+// waitForDelivered waits until the hub has handled n events
+func waitForDelivered(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hub.mutex.RLock()
+		seen := len(hub.history)
+		hub.mutex.RUnlock()
+		if seen >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hub handled %d events, want %d", seen, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// receive waits for the client's next message
+func receive(t *testing.T, client *Client) Message {
+	t.Helper()
+	select {
+	case data, ok := <-client.Send:
+		if !ok {
+			t.Fatalf("client %s was closed", client.UserID)
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("undecodable message %s: %v", data, err)
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatalf("client %s received nothing", client.UserID)
+	}
+	return Message{}
+}
+
+// expectNothing checks that the client receives no message for a while
+func expectNothing(t *testing.T, client *Client) {
+	t.Helper()
+	select {
+	case data, ok := <-client.Send:
+		if ok {
+			t.Fatalf("client %s received %s, want nothing", client.UserID, data)
+		}
+		t.Fatalf("client %s was closed, want nothing", client.UserID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBackplaneFansOutToEveryNode(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	nodeA := startTestHub(t, backplane, nil, DeliveryOptions{})
+	nodeB := startTestHub(t, backplane, nil, DeliveryOptions{})
+
+	operatorA := connectTestClient(t, nodeA, "operator-a", "scs_operator")
+	operatorB := connectTestClient(t, nodeB, "operator-b", "scs_operator")
+	guardB := connectTestClient(t, nodeB, "guard-b", "security_guard", "premise:1")
+
+	nodeA.Broadcast("system_notice", map[string]any{"text": "hello"})
+	for _, client := range []*Client{operatorA, operatorB, guardB} {
+		if msg := receive(t, client); msg.Type != "system_notice" {
+			t.Errorf("%s received %s, want system_notice", client.UserID, msg.Type)
+		}
+	}
+
+	// Role broadcasts reach the role on every node and nobody else
+	nodeB.BroadcastToRole("scs_operator", "alert_created", map[string]any{"id": "1"})
+	for _, client := range []*Client{operatorA, operatorB} {
+		if msg := receive(t, client); msg.Type != "alert_created" {
+			t.Errorf("%s received %s, want alert_created", client.UserID, msg.Type)
+		}
+	}
+	expectNothing(t, guardB)
+
+	// Topic events reach subscribers wherever they are connected
+	nodeA.Publish([]string{"premise:2", "premise:1"}, "premise_updated", nil)
+	if msg := receive(t, guardB); msg.Type != "premise_updated" {
+		t.Errorf("guard received %s, want premise_updated", msg.Type)
+	}
+	expectNothing(t, operatorA)
+	expectNothing(t, operatorB)
+}
+
+func TestUserMessagesAreSequencedAcrossNodes(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	// Nodes share the outbox, as they share Redis in production
+	outbox := NewMemoryOutbox(100, time.Hour)
+	nodeA := startTestHub(t, backplane, outbox, DeliveryOptions{})
+	nodeB := startTestHub(t, backplane, outbox, DeliveryOptions{})
+
+	phone := connectTestClient(t, nodeB, "guard-1", "security_guard")
+	tablet := connectTestClient(t, nodeA, "guard-1", "security_guard")
+	other := connectTestClient(t, nodeB, "guard-2", "security_guard")
+
+	nodeA.SendToUser("guard-1", "dispatch", map[string]any{"n": 1})
+	nodeB.SendToUser("guard-1", "dispatch", map[string]any{"n": 2})
+	for _, client := range []*Client{phone, tablet} {
+		for want := uint64(1); want <= 2; want++ {
+			msg := receive(t, client)
+			if msg.Type != "dispatch" || msg.Seq != want {
+				t.Errorf("%s got %s seq %d, want dispatch seq %d", client.ID, msg.Type, msg.Seq, want)
+			}
+		}
+	}
+	expectNothing(t, other)
+}
+
+func TestStartDeliversEventsPublishedRightAfter(t *testing.T) {
+	hub := NewHub(NewMemoryBackplane(), NewMemoryOutbox(10, time.Hour), DeliveryOptions{})
+	hub.Start()
+
+	// Workers start publishing as soon as Start returns, before any client
+	// connects; the event must still reach the hub's history
+	hub.Broadcast("worker_event", nil)
+	waitForDelivered(t, hub, 1)
+}
+
+func TestDisconnectClosesTheClientOnItsNode(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	nodeA := startTestHub(t, backplane, nil, DeliveryOptions{})
+	nodeB := startTestHub(t, backplane, nil, DeliveryOptions{})
+	client := connectTestClient(t, nodeB, "guard-1", "security_guard")
+
+	// Presence is written in the background after the connect
+	deadline := time.Now().Add(2 * time.Second)
+	for !nodeA.IsOnline(context.Background(), "guard-1") {
+		if time.Now().After(deadline) {
+			t.Fatal("connection never showed up in presence")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := nodeA.Disconnect(context.Background(), client.ID, "signed out"); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if msg := receive(t, client); msg.Type != "session_closed" {
+		t.Errorf("received %s, want session_closed", msg.Type)
+	}
+	select {
+	case _, ok := <-client.Send:
+		if ok {
+			t.Error("client received more after session_closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client was not closed")
+	}
+	// Later sends to the closed client are dropped rather than panicking
+	if client.trySend([]byte(`{}`)) {
+		t.Error("trySend to a closed client succeeded")
+	}
+	nodeA.SendToUser("guard-1", "dispatch", nil)
+
+	if _, err := nodeA.Disconnect(context.Background(), "unknown", "signed out"); err != ErrConnectionNotFound {
+		t.Errorf("Disconnect of an unknown connection = %v, want ErrConnectionNotFound", err)
+	}
+}
+
+func TestPublishingNeverBlocksOnAFullQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backplane := NewMemoryBackplane()
+	hub := NewHub(backplane, NewMemoryOutbox(10, time.Hour), DeliveryOptions{AckTimeout: 50 * time.Millisecond, MaxAttempts: 3})
+	// Subscribed as Start does, but with the run loop held back so that the
+	// delivery queue fills up
+	if err := backplane.Subscribe(ctx, hub.enqueue); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < cap(hub.deliver)+10; i++ {
+			hub.Broadcast("flood", map[string]any{"n": i})
+		}
+		// Dropped for now, but kept in the outbox
+		hub.SendToUserWithAck("guard-1", "dispatch", nil)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishing blocked on a full delivery queue")
+	}
+	if len(hub.deliver) != cap(hub.deliver) {
+		t.Fatalf("queue holds %d events, want it full", len(hub.deliver))
+	}
+
+	go hub.run()
+	go hub.redeliver(ctx)
+	waitForDelivered(t, hub, cap(hub.deliver))
+	guard := connectTestClient(t, hub, "guard-1", "security_guard")
+
+	// The dropped message is redelivered from the outbox
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case data := <-guard.Send:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == "dispatch" {
+				if msg.Seq != 1 {
+					t.Errorf("redelivered dispatch seq %d, want 1", msg.Seq)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("dropped message was never redelivered")
+		}
+	}
+}